@@ -1,52 +1,30 @@
 // Package filesys provides an abstraction for working with file systems,
 // mainly to facilitate testing.
+//
+// This is the v1 API, kept for existing callers: each of its declarations
+// forwards to github.com/bdragon/dedup/v2/filesys.
 package filesys
 
 import (
-	"io"
-	"os"
-	"sort"
+	v2 "github.com/bdragon/dedup/v2/filesys"
 )
 
 // FileSystem provides the interface for operations over a file system.
-type FileSystem interface {
-	Open(path string) (File, error)
-	Lstat(path string) (os.FileInfo, error)
-	Readlink(path string) (string, error)
-	Readdirnames(path string) ([]string, error)
-}
+type FileSystem = v2.FileSystem
 
 // File provides the interface implemented by values returned from a file
 // system's Open method.
-type File interface {
-	io.Reader
-	io.Seeker
-	io.Closer
-}
+type File = v2.File
 
 // OS returns a FileSystem for working with os files.
 func OS() FileSystem {
-	return osFS{}
+	return v2.OS()
 }
 
-type osFS struct{}
-
-func (osFS) Open(pth string) (File, error) { return os.Open(pth) }
-
-func (osFS) Lstat(pth string) (os.FileInfo, error) { return os.Lstat(pth) }
-
-func (osFS) Readlink(pth string) (string, error) { return os.Readlink(pth) }
-
-func (osFS) Readdirnames(pth string) (names []string, err error) {
-	f, err := os.Open(pth)
-	if err != nil {
-		return
-	}
-	names, err = f.Readdirnames(0)
-	_ = f.Close()
-	if err != nil {
-		return
-	}
-	sort.Strings(names)
-	return
+// Map returns a FileSystem for m, wherein keys are file paths and values
+// are file contents. File paths should not contain a leading slash. If links
+// is not nil, it will be used to simulate symbolic links: for each key in m
+// that is also in links, its value in m is treated as the link target.
+func Map(m map[string][]byte, links []string) FileSystem {
+	return v2.Map(m, links)
 }
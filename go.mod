@@ -1,3 +1,10 @@
 module github.com/bdragon/dedup
 
 go 1.16
+
+// v2 is required at a commit of this repository until it is tagged, so that
+// callers of v1 resolve it without the replace below, which only applies to
+// builds within this repository.
+require github.com/bdragon/dedup/v2 v2.0.0-20261014161910-f8e0c7510b1c
+
+replace github.com/bdragon/dedup/v2 => ./v2
@@ -0,0 +1,152 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"sort"
+	"sync"
+)
+
+// Action disposes of the duplicates in a group of files with the same
+// checksum, such as those returned by Sums.DupGroups, keeping the first file
+// of the group. Actions are registered by name with RegisterAction, so that
+// they may be chosen by name, as with the -action flag of the dedup command.
+type Action interface {
+	// Apply disposes of every file in group.Files but the first, continuing
+	// past files that it fails to dispose of. If the returned error is
+	// non-nil, its type should be Errors.
+	Apply(group Group) error
+}
+
+// The ActionFunc type is an adapter to allow the use of ordinary functions as
+// Actions. If f is a function with the appropriate signature, ActionFunc(f) is
+// an Action that calls f.
+type ActionFunc func(group Group) error
+
+// Apply calls f(group).
+func (f ActionFunc) Apply(group Group) error { return f(group) }
+
+// Built-in Actions. Like the steps of a Plan, they only operate on regular
+// files in the local file system, leave alone files that are already hard
+// links to the file kept, and skip files that were modified since they were
+// evaluated.
+var (
+	Delete   Action = stepAction(OpDelete)  // Remove the duplicates.
+	Hardlink Action = stepAction(OpLink)    // Replace the duplicates with hard links to the file kept.
+	Symlink  Action = stepAction(OpSymlink) // Replace the duplicates with symbolic links to the file kept.
+)
+
+// MoveToQuarantine returns an Action that moves the duplicates into q instead
+// of deleting them.
+func MoveToQuarantine(q *Quarantine) Action {
+	return ActionFunc(func(group Group) error {
+		return applySteps(group, OpDelete, q.Move)
+	})
+}
+
+// stepAction returns an Action that applies the steps performing op.
+func stepAction(op string) Action {
+	return ActionFunc(func(group Group) error {
+		return applySteps(group, op, Step.Apply)
+	})
+}
+
+// applySteps calls apply for each step performing op on the duplicates in
+// group, keeping the first file.
+func applySteps(group Group, op string, apply func(Step) error) error {
+	if len(group.Files) < 2 {
+		return nil
+	}
+	var errs Errors
+	for _, st := range groupSteps(op, group.Sum, group.Files[0], group.Files[1:]) {
+		if err := apply(st); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+var (
+	actionsMu sync.Mutex
+	actions   = map[string]Action{
+		"delete":  Delete,
+		"link":    Hardlink,
+		"symlink": Symlink,
+		"trash": ActionFunc(func(group Group) error {
+			q, err := Trash()
+			if err != nil {
+				return Errors{err}
+			}
+			return MoveToQuarantine(q).Apply(group)
+		}),
+	}
+)
+
+// RegisterAction makes a available by name to LookupAction. The built-in
+// Actions are registered as "delete", "link", "symlink", and "trash", the
+// last moving the duplicates to the trash of the current user. It panics if
+// name is already registered.
+func RegisterAction(name string, a Action) {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+
+	if _, ok := actions[name]; ok {
+		panic("dedup: RegisterAction called twice for action " + name)
+	}
+	actions[name] = a
+}
+
+// LookupAction returns the Action registered by name, if any.
+func LookupAction(name string) (Action, bool) {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+
+	a, ok := actions[name]
+	return a, ok
+}
+
+// ActionNames returns the sorted names of the registered Actions.
+func ActionNames() []string {
+	actionsMu.Lock()
+	defer actionsMu.Unlock()
+
+	names := make([]string, 0, len(actions))
+	for name := range actions {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// groupSteps returns the steps performing op on each file among files that
+// is a copy of keep with the given checksum. Files that are not regular
+// files in the local file system, and files that are already hard links to
+// keep, are left alone, as is every file if keep is not such a file.
+func groupSteps(op string, sum Digest, keep *File, files []*File) []Step {
+	if !localRegular(keep) {
+		return nil
+	}
+	var steps []Step
+	for _, file := range files {
+		if file == keep || !localRegular(file) || sameFile(file, keep) {
+			continue
+		}
+		steps = append(steps, Step{
+			Op:      op,
+			Path:    file.Path,
+			Keep:    keep.Path,
+			Sum:     hex.EncodeToString([]byte(sum)),
+			Size:    file.Info.Size(),
+			ModTime: file.Info.ModTime(),
+		})
+	}
+	return steps
+}
+
+// localRegular reports whether file is a regular file in the local file
+// system.
+func localRegular(file *File) bool {
+	return isLocal(file.Path) && file.Info != nil && file.Info.Mode().IsRegular()
+}
@@ -0,0 +1,115 @@
+package dedup
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestActions(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		want os.FileMode // Type of b and c once applied, or 0 if removed.
+	}{
+		{"delete", 0},
+		{"link", 0644},
+		{"symlink", os.ModeSymlink},
+	} {
+		root, err := ioutil.TempDir("", "dedup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		for name, contents := range map[string]string{
+			"a": "same", "b": "same", "c": "same", "d": "other",
+		} {
+			if err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		sums, err := FilterDir(root, &Options{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		groups := sums.DupGroups()
+		if len(groups) != 1 {
+			t.Fatalf("DupGroups() = %d groups; want 1", len(groups))
+		}
+		a, ok := LookupAction(tc.name)
+		if !ok {
+			t.Fatalf("LookupAction(%q) = false", tc.name)
+		}
+		if err := a.Apply(groups[0]); err != nil {
+			t.Errorf("%s: Apply() = %v", tc.name, err)
+		}
+		for _, name := range []string{"b", "c"} {
+			info, err := os.Lstat(filepath.Join(root, name))
+			switch {
+			case tc.want == 0 && !os.IsNotExist(err):
+				t.Errorf("%s: %s exists; want removed", tc.name, name)
+			case tc.want != 0 && err != nil:
+				t.Errorf("%s: Lstat(%s) = %v", tc.name, name, err)
+			case tc.want == os.ModeSymlink && info.Mode()&os.ModeSymlink == 0:
+				t.Errorf("%s: %s is %v; want a symbolic link", tc.name, name, info.Mode())
+			case tc.want == 0644 && !info.Mode().IsRegular():
+				t.Errorf("%s: %s is %v; want a regular file", tc.name, name, info.Mode())
+			}
+			if tc.want == 0 {
+				continue
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(root, name)); err != nil || string(b) != "same" {
+				t.Errorf("%s: %s reads %q, %v; want %q", tc.name, name, b, err, "same")
+			}
+		}
+		for _, name := range []string{"a", "d"} {
+			if _, err := os.Lstat(filepath.Join(root, name)); err != nil {
+				t.Errorf("%s: %s = %v; want kept", tc.name, name, err)
+			}
+		}
+	}
+}
+
+func TestRegisterAction(t *testing.T) {
+	for _, name := range []string{"delete", "link", "symlink", "trash"} {
+		if _, ok := LookupAction(name); !ok {
+			t.Errorf("LookupAction(%q) = false; want built-in", name)
+		}
+	}
+
+	defer func() {
+		actionsMu.Lock()
+		delete(actions, "test")
+		actionsMu.Unlock()
+	}()
+	var got []string
+	RegisterAction("test", ActionFunc(func(group Group) error {
+		for _, file := range group.Files {
+			got = append(got, file.Path)
+		}
+		return Errors{errors.New("failed")}
+	}))
+	a, ok := LookupAction("test")
+	if !ok {
+		t.Fatal(`LookupAction("test") = false after RegisterAction`)
+	}
+	err := a.Apply(Group{Files: []*File{{Path: "a"}, {Path: "b"}}})
+	if want := []string{"a", "b"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Apply() was given %v; want %v", got, want)
+	}
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 {
+		t.Errorf("Apply() = %v; want 1 error", err)
+	}
+	if names := ActionNames(); !reflect.DeepEqual(names, []string{"delete", "link", "symlink", "test", "trash"}) {
+		t.Errorf("ActionNames() = %v", names)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("RegisterAction() twice did not panic")
+		}
+	}()
+	RegisterAction("test", a)
+}
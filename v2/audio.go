@@ -0,0 +1,149 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+)
+
+// AudioMatcher is a Matcher that computes the SHA1 checksum of the audio
+// data alone of each MP3, FLAC, or M4A file, leaving out its tags, so that
+// copies of the same track that were tagged anew, or given other cover art,
+// are grouped together. Containers are supported as follows:
+//
+//   - MP3: ID3v2 tags at the start of the file, and ID3v1 and APEv2 tags at
+//     its end, are left out; the MPEG frames between them are compared.
+//   - FLAC: the metadata blocks, including Vorbis comments and pictures,
+//     are left out, as are ID3v2 tags preceding them; the audio frames
+//     following them are compared.
+//   - M4A and other MP4 files: only the contents of the top-level mdat boxes,
+//     which hold the media data, are compared; the moov box, holding tags
+//     among the metadata, is left out.
+//
+// Other files, and audio files that cannot be parsed, are grouped by the
+// SHA1 checksum of their contents. Files whose audio was encoded anew, or
+// changed in any way, are not grouped together.
+type AudioMatcher struct{}
+
+var _ Matcher = AudioMatcher{}
+
+func (AudioMatcher) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	audio, ok := audioData(b)
+	if !ok {
+		sum := sha1.Sum(b)
+		return Digest(sum[:]), nil
+	}
+	h := sha1.New()
+	for _, part := range audio {
+		_, _ = h.Write(part)
+	}
+	return Digest(h.Sum(nil)), nil
+}
+
+// audioData returns the parts of the audio file b that hold its audio data,
+// and whether b could be parsed as one.
+func audioData(b []byte) ([][]byte, bool) {
+	if len(b) >= 8 && string(b[4:8]) == "ftyp" {
+		return mp4Data(b)
+	}
+	tagged := false
+	for len(b) >= 10 && string(b[:3]) == "ID3" {
+		// The size of an ID3v2 tag is stored in 7 bits of each of 4 bytes,
+		// and excludes its header, and its footer if any.
+		n := 10 + (int(b[6]&0x7f)<<21 | int(b[7]&0x7f)<<14 | int(b[8]&0x7f)<<7 | int(b[9]&0x7f))
+		if b[5]&0x10 != 0 {
+			n += 10
+		}
+		if n > len(b) {
+			return nil, false
+		}
+		b, tagged = b[n:], true
+	}
+	switch {
+	case bytes.HasPrefix(b, []byte("fLaC")):
+		return flacData(b)
+	case tagged || len(b) >= 2 && b[0] == 0xff && b[1]&0xe0 == 0xe0:
+		return [][]byte{mp3Frames(b)}, true
+	}
+	return nil, false
+}
+
+// mp3Frames returns the MPEG frames of b, the contents of an MP3 file
+// after its ID3v2 tags, without the ID3v1 and APEv2 tags at its end.
+func mp3Frames(b []byte) []byte {
+	for {
+		switch {
+		case len(b) >= 128 && string(b[len(b)-128:len(b)-125]) == "TAG":
+			b = b[:len(b)-128]
+		case len(b) >= 32 && string(b[len(b)-32:len(b)-24]) == "APETAGEX":
+			// An APEv2 footer records the size of the tag, footer
+			// included, and whether a header precedes it.
+			footer := b[len(b)-32:]
+			n := int(binary.LittleEndian.Uint32(footer[12:]))
+			if binary.LittleEndian.Uint32(footer[20:])&(1<<31) != 0 {
+				n += 32
+			}
+			if n < 32 || n > len(b) {
+				return b
+			}
+			b = b[:len(b)-n]
+		default:
+			return b
+		}
+	}
+}
+
+// flacData returns the audio frames of b, the contents of a FLAC file after
+// any ID3v2 tags, following its metadata blocks.
+func flacData(b []byte) ([][]byte, bool) {
+	for i := 4; i+4 <= len(b); {
+		last := b[i]&0x80 != 0
+		i += 4 + (int(b[i+1])<<16 | int(b[i+2])<<8 | int(b[i+3]))
+		if i > len(b) {
+			return nil, false
+		}
+		if last {
+			return [][]byte{b[i:]}, true
+		}
+	}
+	return nil, false
+}
+
+// mp4Data returns the contents of the top-level mdat boxes of b, the
+// contents of an MP4 file.
+func mp4Data(b []byte) ([][]byte, bool) {
+	var data [][]byte
+	for len(b) > 0 {
+		if len(b) < 8 {
+			return nil, false
+		}
+		n, header := uint64(binary.BigEndian.Uint32(b)), uint64(8)
+		switch n {
+		case 0: // The box extends to the end of the file.
+			n = uint64(len(b))
+		case 1: // The size follows the type, in 64 bits.
+			if len(b) < 16 {
+				return nil, false
+			}
+			n, header = binary.BigEndian.Uint64(b[8:]), 16
+		}
+		if n < header || n > uint64(len(b)) {
+			return nil, false
+		}
+		if string(b[4:8]) == "mdat" {
+			data = append(data, b[header:n])
+		}
+		b = b[n:]
+	}
+	return data, len(data) > 0
+}
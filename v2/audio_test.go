@@ -0,0 +1,80 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func id3v2Tag(data string) []byte {
+	n := len(data)
+	tag := []byte{'I', 'D', '3', 4, 0, 0, byte(n >> 21 & 0x7f), byte(n >> 14 & 0x7f), byte(n >> 7 & 0x7f), byte(n & 0x7f)}
+	return append(tag, data...)
+}
+
+func apeTag(data string) []byte {
+	footer := make([]byte, 32)
+	copy(footer, "APETAGEX")
+	binary.LittleEndian.PutUint32(footer[12:], uint32(len(data)+32))
+	return append([]byte(data), footer...)
+}
+
+func flacFile(comment, frames string) []byte {
+	b := []byte("fLaC")
+	b = append(b, 0, 0, 0, 4) // STREAMINFO, abridged.
+	b = append(b, "info"...)
+	n := len(comment)
+	b = append(b, 0x80|4, byte(n>>16), byte(n>>8), byte(n)) // Last: VORBIS_COMMENT.
+	return append(append(b, comment...), frames...)
+}
+
+func mp4Box(typ, data string) []byte {
+	box := make([]byte, 4, 8+len(data))
+	binary.BigEndian.PutUint32(box, uint32(8+len(data)))
+	return append(append(box, typ...), data...)
+}
+
+func joinBytes(parts ...[]byte) []byte {
+	var b []byte
+	for _, p := range parts {
+		b = append(b, p...)
+	}
+	return b
+}
+
+func TestAudioMatcher(t *testing.T) {
+	frames := []byte("\xff\xfb\x90\x00mpeg frames")
+	id3v1 := []byte("TAG" + strings.Repeat("\x00", 125))
+	ftyp, mdat := mp4Box("ftyp", "M4A "), mp4Box("mdat", "aac frames")
+	fs := filesys.Map(map[string][]byte{
+		"root/a.mp3":  frames,
+		"root/b.mp3":  joinBytes(id3v2Tag("TIT2 title"), frames, id3v1),
+		"root/c.mp3":  joinBytes(frames, apeTag("Artist=someone")),
+		"root/d.mp3":  []byte("\xff\xfb\x90\x00other frames"),
+		"root/e.flac": flacFile("artist=A", "flac frames"),
+		"root/f.flac": joinBytes(id3v2Tag("TIT2 title"), flacFile("artist=someone else", "flac frames")),
+		"root/g.m4a":  joinBytes(ftyp, mp4Box("moov", "udta A"), mdat),
+		"root/h.m4a":  joinBytes(ftyp, mdat, mp4Box("moov", "udta someone else")),
+		"root/i.txt":  []byte("not audio"),
+	}, nil)
+
+	sums, err := FilterDir("root", &Options{Matcher: AudioMatcher{}, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	var groups []string
+	for _, g := range sums.DupGroups() {
+		var paths []string
+		for _, file := range g.Files {
+			paths = append(paths, file.Path)
+		}
+		groups = append(groups, strings.Join(paths, " "))
+	}
+	sort.Strings(groups)
+	want := []string{"root/a.mp3 root/b.mp3 root/c.mp3", "root/e.flac root/f.flac", "root/g.m4a root/h.m4a"}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("DupGroups() = %q; want %q", groups, want)
+	}
+}
@@ -0,0 +1,136 @@
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// treeSpec describes a synthetic tree of files generated by genTree.
+type treeSpec struct {
+	Files    int     // Number of files.
+	Dirs     int     // Number of directories among which the files are spread.
+	MinSize  int     // Size of the smallest files.
+	MaxSize  int     // Size of the largest files, which are fewer, as sizes are log-uniform.
+	DupRatio float64 // Fraction of the files that are copies of others.
+	Seed     int64
+}
+
+// benchTrees are the trees the benchmarks evaluate: many small files, as in
+// source trees, and fewer large ones, as in photo libraries.
+var benchTrees = map[string]treeSpec{
+	"small": {Files: 2000, Dirs: 50, MinSize: 64, MaxSize: 64 << 10, DupRatio: 0.2, Seed: 1},
+	"large": {Files: 64, Dirs: 4, MinSize: 256 << 10, MaxSize: 8 << 20, DupRatio: 0.2, Seed: 1},
+}
+
+// genTree returns the contents of the files of a tree under root/ as
+// described by spec, by path.
+func genTree(spec treeSpec) map[string][]byte {
+	rnd := rand.New(rand.NewSource(spec.Seed))
+	files := make(map[string][]byte, spec.Files)
+	var paths []string
+	for i := 0; i < spec.Files; i++ {
+		path := fmt.Sprintf("root/%03d/%05d", rnd.Intn(spec.Dirs), i)
+		if len(paths) > 0 && rnd.Float64() < spec.DupRatio {
+			files[path] = files[paths[rnd.Intn(len(paths))]]
+		} else {
+			lo, hi := math.Log(float64(spec.MinSize)), math.Log(float64(spec.MaxSize))
+			b := make([]byte, int(math.Exp(lo+rnd.Float64()*(hi-lo))))
+			rnd.Read(b)
+			files[path] = b
+		}
+		paths = append(paths, path)
+	}
+	return files
+}
+
+// writeTree writes files, as returned by genTree, under dir.
+func writeTree(dir string, files map[string][]byte) error {
+	for path, b := range files {
+		path = filepath.Join(dir, filepath.FromSlash(path))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return err
+		}
+		if err := ioutil.WriteFile(path, b, 0644); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// benchWorkers runs f as a sub-benchmark of b for each of several numbers of
+// workers of each kind.
+func benchWorkers(b *testing.B, f func(b *testing.B)) {
+	defer func(n int) { maxProcs = n }(maxProcs)
+	for _, n := range []int{1, 2, 4, 8} {
+		maxProcs = n
+		b.Run(fmt.Sprintf("workers=%d", n), f)
+	}
+}
+
+// benchFilterDir evaluates the tree under root with opts b.N times,
+// reporting the throughput.
+func benchFilterDir(b *testing.B, root string, opts *Options) {
+	var n uint64
+	for i := 0; i < b.N; i++ {
+		sums, err := FilterDir(root, opts)
+		if err != nil {
+			b.Fatal(err)
+		}
+		n = sums.Stats().NumBytes
+	}
+	b.SetBytes(int64(n))
+}
+
+// BenchmarkFilterDirMap measures the overhead of the pipeline itself, on
+// trees held in memory.
+func BenchmarkFilterDirMap(b *testing.B) {
+	for name, spec := range benchTrees {
+		fs := filesys.Map(genTree(spec), nil)
+		b.Run(name, func(b *testing.B) {
+			benchWorkers(b, func(b *testing.B) {
+				benchFilterDir(b, "root", &Options{Recursive: true, FileSystem: fs})
+			})
+		})
+	}
+}
+
+// BenchmarkFilterDirDisk measures evaluations of trees in a temporary
+// directory, which are mostly read from the page cache.
+func BenchmarkFilterDirDisk(b *testing.B) {
+	dir, err := ioutil.TempDir("", "dedup-bench")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, spec := range benchTrees {
+		root := filepath.Join(dir, name)
+		if err := writeTree(root, genTree(spec)); err != nil {
+			b.Fatal(err)
+		}
+		b.Run(name, func(b *testing.B) {
+			benchWorkers(b, func(b *testing.B) {
+				benchFilterDir(b, filepath.Join(root, "root"), &Options{Recursive: true})
+			})
+		})
+	}
+}
+
+func TestGenTree(t *testing.T) {
+	spec := treeSpec{Files: 100, Dirs: 5, MinSize: 10, MaxSize: 1000, DupRatio: 0.5, Seed: 1}
+	files := genTree(spec)
+	if len(files) != spec.Files {
+		t.Fatalf("generated %d files; want %d", len(files), spec.Files)
+	}
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: filesys.Map(files, nil)})
+	checkErrors(t, "", err, nil)
+	if dups := sums.Stats().NumDupFiles; dups < 30 || dups > 70 {
+		t.Errorf("NumDupFiles = %d; want about half of %d", dups, spec.Files)
+	}
+}
@@ -0,0 +1,270 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"hash"
+	"math/bits"
+	"sync"
+)
+
+// This file implements the BLAKE3 hash function, as specified at
+// https://github.com/BLAKE3-team/BLAKE3-specs, for the "blake3" digest. As
+// the chunks of its input are hashed independently of one another, the
+// subtrees of large inputs are hashed by several goroutines at once.
+
+const (
+	blake3BlockLen = 64
+	blake3ChunkLen = 1024
+
+	blake3ChunkStart = 1 << 0
+	blake3ChunkEnd   = 1 << 1
+	blake3Parent     = 1 << 2
+	blake3Root       = 1 << 3
+
+	// blake3ParallelChunks is the fewest chunks of a subtree whose halves
+	// are hashed by goroutines of their own.
+	blake3ParallelChunks = 64
+)
+
+var blake3IV = [8]uint32{
+	0x6a09e667, 0xbb67ae85, 0x3c6ef372, 0xa54ff53a,
+	0x510e527f, 0x9b05688c, 0x1f83d9ab, 0x5be0cd19,
+}
+
+// blake3Schedule holds the order in which the words of a block are used in
+// each round, which permutes those of the round before.
+var blake3Schedule = [7][16]int{
+	{0, 1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13, 14, 15},
+	{2, 6, 3, 10, 7, 0, 4, 13, 1, 11, 12, 5, 9, 14, 15, 8},
+	{3, 4, 10, 12, 13, 2, 7, 14, 6, 5, 9, 0, 11, 15, 8, 1},
+	{10, 7, 12, 9, 14, 3, 13, 15, 4, 0, 11, 2, 5, 8, 1, 6},
+	{12, 13, 9, 11, 15, 10, 14, 8, 7, 2, 5, 3, 0, 1, 6, 4},
+	{9, 14, 11, 5, 8, 12, 15, 1, 13, 3, 0, 10, 2, 6, 4, 7},
+	{11, 15, 5, 0, 1, 9, 8, 6, 14, 10, 2, 12, 3, 4, 7, 13},
+}
+
+func blake3G(a, b, c, d, mx, my uint32) (uint32, uint32, uint32, uint32) {
+	a += b + mx
+	d = bits.RotateLeft32(d^a, -16)
+	c += d
+	b = bits.RotateLeft32(b^c, -12)
+	a += b + my
+	d = bits.RotateLeft32(d^a, -8)
+	c += d
+	b = bits.RotateLeft32(b^c, -7)
+	return a, b, c, d
+}
+
+// blake3Compress is the compression function of BLAKE3.
+func blake3Compress(cv *[8]uint32, block *[16]uint32, counter uint64, blockLen, flags uint32) [16]uint32 {
+	v0, v1, v2, v3, v4, v5, v6, v7 := cv[0], cv[1], cv[2], cv[3], cv[4], cv[5], cv[6], cv[7]
+	v8, v9, v10, v11 := blake3IV[0], blake3IV[1], blake3IV[2], blake3IV[3]
+	v12, v13, v14, v15 := uint32(counter), uint32(counter>>32), blockLen, flags
+	m := block
+	for i := range blake3Schedule {
+		s := &blake3Schedule[i]
+		v0, v4, v8, v12 = blake3G(v0, v4, v8, v12, m[s[0]], m[s[1]])
+		v1, v5, v9, v13 = blake3G(v1, v5, v9, v13, m[s[2]], m[s[3]])
+		v2, v6, v10, v14 = blake3G(v2, v6, v10, v14, m[s[4]], m[s[5]])
+		v3, v7, v11, v15 = blake3G(v3, v7, v11, v15, m[s[6]], m[s[7]])
+		v0, v5, v10, v15 = blake3G(v0, v5, v10, v15, m[s[8]], m[s[9]])
+		v1, v6, v11, v12 = blake3G(v1, v6, v11, v12, m[s[10]], m[s[11]])
+		v2, v7, v8, v13 = blake3G(v2, v7, v8, v13, m[s[12]], m[s[13]])
+		v3, v4, v9, v14 = blake3G(v3, v4, v9, v14, m[s[14]], m[s[15]])
+	}
+	return [16]uint32{
+		v0 ^ v8, v1 ^ v9, v2 ^ v10, v3 ^ v11, v4 ^ v12, v5 ^ v13, v6 ^ v14, v7 ^ v15,
+		v8 ^ cv[0], v9 ^ cv[1], v10 ^ cv[2], v11 ^ cv[3], v12 ^ cv[4], v13 ^ cv[5], v14 ^ cv[6], v15 ^ cv[7],
+	}
+}
+
+// blake3Words returns the 64-byte block b, padded with zeros, as words.
+func blake3Words(b []byte) (block [16]uint32) {
+	var buf [blake3BlockLen]byte
+	copy(buf[:], b)
+	for i := range block {
+		block[i] = binary.LittleEndian.Uint32(buf[4*i:])
+	}
+	return block
+}
+
+// blake3Output is a node of the tree, yet to be compressed into either a
+// chaining value or the root hash.
+type blake3Output struct {
+	cv       [8]uint32
+	block    [16]uint32
+	counter  uint64
+	blockLen uint32
+	flags    uint32
+}
+
+func (o *blake3Output) chainingValue() (cv [8]uint32) {
+	s := blake3Compress(&o.cv, &o.block, o.counter, o.blockLen, o.flags)
+	copy(cv[:], s[:8])
+	return cv
+}
+
+func blake3ParentOutput(left, right [8]uint32) blake3Output {
+	o := blake3Output{cv: blake3IV, blockLen: blake3BlockLen, flags: blake3Parent}
+	copy(o.block[:8], left[:])
+	copy(o.block[8:], right[:])
+	return o
+}
+
+// blake3Chunk is the state of the chunk being hashed.
+type blake3Chunk struct {
+	cv         [8]uint32
+	counter    uint64
+	block      [blake3BlockLen]byte
+	blockLen   int
+	compressed int // Number of blocks compressed.
+}
+
+func newBLAKE3Chunk(counter uint64) blake3Chunk {
+	return blake3Chunk{cv: blake3IV, counter: counter}
+}
+
+func (c *blake3Chunk) len() int {
+	return c.compressed*blake3BlockLen + c.blockLen
+}
+
+func (c *blake3Chunk) startFlag() uint32 {
+	if c.compressed == 0 {
+		return blake3ChunkStart
+	}
+	return 0
+}
+
+func (c *blake3Chunk) write(b []byte) {
+	for len(b) > 0 {
+		if c.blockLen == blake3BlockLen {
+			block := blake3Words(c.block[:])
+			s := blake3Compress(&c.cv, &block, c.counter, blake3BlockLen, c.startFlag())
+			copy(c.cv[:], s[:8])
+			c.compressed++
+			c.blockLen = 0
+		}
+		n := copy(c.block[c.blockLen:], b)
+		c.blockLen += n
+		b = b[n:]
+	}
+}
+
+func (c *blake3Chunk) output() blake3Output {
+	return blake3Output{
+		cv:       c.cv,
+		block:    blake3Words(c.block[:c.blockLen]),
+		counter:  c.counter,
+		blockLen: uint32(c.blockLen),
+		flags:    c.startFlag() | blake3ChunkEnd,
+	}
+}
+
+// blake3Subtree returns the chaining value of the subtree of the whole
+// chunks of b, a power of two of them, the first of which is numbered
+// counter.
+func blake3Subtree(b []byte, counter uint64) [8]uint32 {
+	n := len(b) / blake3ChunkLen
+	if n == 1 {
+		c := newBLAKE3Chunk(counter)
+		c.write(b)
+		o := c.output()
+		return o.chainingValue()
+	}
+	half := n / 2 * blake3ChunkLen
+	var left, right [8]uint32
+	if n >= blake3ParallelChunks {
+		var wg sync.WaitGroup
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			left = blake3Subtree(b[:half], counter)
+		}()
+		right = blake3Subtree(b[half:], counter+uint64(n/2))
+		wg.Wait()
+	} else {
+		left = blake3Subtree(b[:half], counter)
+		right = blake3Subtree(b[half:], counter+uint64(n/2))
+	}
+	o := blake3ParentOutput(left, right)
+	return o.chainingValue()
+}
+
+// blake3Hasher is a hash.Hash computing 32-byte BLAKE3 digests.
+type blake3Hasher struct {
+	chunk blake3Chunk
+	stack [][8]uint32 // Chaining values of the subtrees completed, largest first.
+}
+
+var _ hash.Hash = (*blake3Hasher)(nil)
+
+func newBLAKE3() hash.Hash {
+	return &blake3Hasher{chunk: newBLAKE3Chunk(0)}
+}
+
+// push adds the chaining value cv of a subtree of 1<<level chunks, after
+// which total chunks have been completed, merging the subtrees completed.
+func (h *blake3Hasher) push(cv [8]uint32, level int, total uint64) {
+	for total >>= uint(level); total&1 == 0; total >>= 1 {
+		o := blake3ParentOutput(h.stack[len(h.stack)-1], cv)
+		cv = o.chainingValue()
+		h.stack = h.stack[:len(h.stack)-1]
+	}
+	h.stack = append(h.stack, cv)
+}
+
+func (h *blake3Hasher) Write(b []byte) (int, error) {
+	n := len(b)
+	for len(b) > 0 {
+		if h.chunk.len() == blake3ChunkLen {
+			// More input follows, so the chunk is not the root.
+			o := h.chunk.output()
+			total := h.chunk.counter + 1
+			h.push(o.chainingValue(), 0, total)
+			h.chunk = newBLAKE3Chunk(total)
+		}
+		if h.chunk.len() == 0 && len(b) > 2*blake3ChunkLen {
+			// Hash as large a subtree of whole chunks as may follow the
+			// chunks completed at once, as long as more input follows.
+			done := h.chunk.counter
+			level := 0
+			for chunks := uint64(2); chunks*blake3ChunkLen < uint64(len(b)) && done%chunks == 0; chunks *= 2 {
+				level++
+			}
+			size := blake3ChunkLen << uint(level)
+			total := done + 1<<uint(level)
+			h.push(blake3Subtree(b[:size], done), level, total)
+			h.chunk = newBLAKE3Chunk(total)
+			b = b[size:]
+			continue
+		}
+		m := blake3ChunkLen - h.chunk.len()
+		if m > len(b) {
+			m = len(b)
+		}
+		h.chunk.write(b[:m])
+		b = b[m:]
+	}
+	return n, nil
+}
+
+func (h *blake3Hasher) Sum(b []byte) []byte {
+	o := h.chunk.output()
+	for i := len(h.stack) - 1; i >= 0; i-- {
+		o = blake3ParentOutput(h.stack[i], o.chainingValue())
+	}
+	s := blake3Compress(&o.cv, &o.block, 0, o.blockLen, o.flags|blake3Root)
+	for _, w := range s[:8] {
+		b = append(b, byte(w), byte(w>>8), byte(w>>16), byte(w>>24))
+	}
+	return b
+}
+
+func (h *blake3Hasher) Reset() {
+	h.chunk = newBLAKE3Chunk(0)
+	h.stack = h.stack[:0]
+}
+
+func (h *blake3Hasher) Size() int { return 32 }
+
+func (h *blake3Hasher) BlockSize() int { return blake3BlockLen }
@@ -0,0 +1,63 @@
+package dedup
+
+import "sync"
+
+// budget limits the number of files evaluated and their total size under the
+// MaxFiles and MaxTotalBytes options, for all workers together. A nil
+// *budget imposes no limit.
+type budget struct {
+	mu       sync.Mutex
+	files    int
+	bytes    int64
+	maxFiles int
+	maxBytes int64
+	exceeded *signal // Closed once a file is refused.
+}
+
+// newBudget returns a *budget of maxFiles files and maxBytes bytes, either of
+// which imposes no limit if not positive, or nil if neither does.
+func newBudget(maxFiles int, maxBytes int64) *budget {
+	if maxFiles <= 0 && maxBytes <= 0 {
+		return nil
+	}
+	return &budget{maxFiles: maxFiles, maxBytes: maxBytes, exceeded: newSignal()}
+}
+
+// take reports whether a file of size bytes may be evaluated within b, and
+// counts it if so. Once a file is refused, so are all others.
+func (b *budget) take(size int64) bool {
+	if b == nil {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	select {
+	case <-b.exceeded.C():
+		return false
+	default:
+	}
+	if b.maxFiles > 0 && b.files >= b.maxFiles || b.maxBytes > 0 && b.bytes+size > b.maxBytes {
+		b.exceeded.Once()
+		return false
+	}
+	b.files++
+	b.bytes += size
+	return true
+}
+
+// C returns a channel that is closed once b is exceeded, or nil if b is nil.
+func (b *budget) C() <-chan struct{} {
+	if b == nil {
+		return nil
+	}
+	return b.exceeded.C()
+}
+
+// err returns the *BudgetExceededError reporting what b let be evaluated.
+func (b *budget) err() error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	return &BudgetExceededError{Files: b.files, Bytes: b.bytes}
+}
@@ -0,0 +1,80 @@
+package dedup
+
+import (
+	"bytes"
+	"sync"
+)
+
+// BufferConfig bounds the buffers into which the contents of files are read
+// to compute their checksums; see Options.BufferConfig. Each file is read
+// whole into a buffer that grows to fit it, and buffers are then kept for
+// reuse by the files that follow, so that without bounds, the buffers kept
+// grow to the size of the largest files evaluated and stay that large until
+// the evaluation is done.
+type BufferConfig struct {
+	InitialSize int // Capacity of new buffers, in bytes, if positive.
+	MaxSize     int // Greatest capacity of the buffers kept for reuse, if positive; larger ones are dropped once used, for the garbage collector to reclaim.
+	PoolSize    int // Greatest number of buffers kept for reuse, if positive; otherwise as many as the garbage collector lets live.
+}
+
+// bufferPool wraps a *sync.Pool with Get and Put functions typed for byte
+// buffers, or a channel holding at most PoolSize buffers under the PoolSize
+// field of its config.
+type bufferPool struct {
+	config     BufferConfig
+	underlying *sync.Pool
+	idle       chan *bytes.Buffer // Buffers kept under PoolSize.
+}
+
+func newBufferPool(config BufferConfig) *bufferPool {
+	p := new(bufferPool)
+	p.config = config
+	if config.PoolSize > 0 {
+		p.idle = make(chan *bytes.Buffer, config.PoolSize)
+		return p
+	}
+	p.underlying = &sync.Pool{
+		New: func() interface{} { return p.newBuffer() },
+	}
+	return p
+}
+
+func (p *bufferPool) newBuffer() *bytes.Buffer {
+	if p.config.InitialSize > 0 {
+		return bytes.NewBuffer(make([]byte, 0, p.config.InitialSize))
+	}
+	return new(bytes.Buffer)
+}
+
+// Get retrieves a byte buffer from the pool and resets it so that it is
+// ready to use.
+func (p *bufferPool) Get() *bytes.Buffer {
+	var buf *bytes.Buffer
+	if p.idle != nil {
+		select {
+		case buf = <-p.idle:
+		default:
+			buf = p.newBuffer()
+		}
+	} else {
+		buf = p.underlying.Get().(*bytes.Buffer)
+	}
+	buf.Reset()
+	return buf
+}
+
+// Put returns buf to the pool, unless it grew beyond the MaxSize of its
+// config, or the pool already holds PoolSize buffers.
+func (p *bufferPool) Put(buf *bytes.Buffer) {
+	if p.config.MaxSize > 0 && buf.Cap() > p.config.MaxSize {
+		return
+	}
+	if p.idle != nil {
+		select {
+		case p.idle <- buf:
+		default:
+		}
+		return
+	}
+	p.underlying.Put(buf)
+}
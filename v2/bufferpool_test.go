@@ -0,0 +1,59 @@
+package dedup
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestBufferPoolBounds(t *testing.T) {
+	const maxSize, poolSize = 1 << 16, 2
+	p := newBufferPool(BufferConfig{InitialSize: 512, MaxSize: maxSize, PoolSize: poolSize})
+	if buf := p.Get(); buf.Cap() != 512 || buf.Len() != 0 {
+		t.Errorf("Get() = buffer of cap %d, len %d; want cap 512, len 0", buf.Cap(), buf.Len())
+	}
+
+	// Read files of mixed sizes, a few at once, as workers do: the buffers
+	// kept for reuse stay within the bounds however large the files get.
+	large := bytes.Repeat([]byte("x"), 4*maxSize)
+	small := []byte("small")
+	for i := 0; i < 100; i++ {
+		var bufs []*bytes.Buffer
+		for j := 0; j < 4; j++ {
+			buf := p.Get()
+			if (i+j)%3 == 0 {
+				_, _ = buf.ReadFrom(bytes.NewReader(large))
+			} else {
+				_, _ = buf.ReadFrom(bytes.NewReader(small))
+			}
+			bufs = append(bufs, buf)
+		}
+		for _, buf := range bufs {
+			p.Put(buf)
+		}
+	}
+	if n := len(p.idle); n > poolSize {
+		t.Errorf("pool holds %d buffers; want at most %d", n, poolSize)
+	}
+	for len(p.idle) > 0 {
+		if buf := <-p.idle; buf.Cap() > maxSize {
+			t.Errorf("pool holds a buffer of cap %d; want at most %d", buf.Cap(), maxSize)
+		}
+	}
+
+	// Without PoolSize, oversize buffers are still dropped.
+	p = newBufferPool(BufferConfig{MaxSize: maxSize})
+	buf := p.Get()
+	_, _ = buf.ReadFrom(bytes.NewReader(large))
+	p.Put(buf)
+	if buf := p.Get(); buf.Cap() > maxSize {
+		t.Errorf("Get() after Put of oversize buffer = buffer of cap %d; want at most %d", buf.Cap(), maxSize)
+	}
+}
+
+func TestFilterDirBufferConfig(t *testing.T) {
+	want, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	sums, _ := FilterDir("root", &Options{Recursive: true, BufferConfig: BufferConfig{InitialSize: 1, MaxSize: 4, PoolSize: 1}, FileSystem: FS})
+	if got, want := untimed(sums.Stats()), untimed(want.Stats()); got != want {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+}
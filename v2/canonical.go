@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Redundant pairs a file with the canonical copies of its contents.
+type Redundant struct {
+	File      *File
+	Sum       Digest
+	Canonical []*File // Sorted by path.
+}
+
+// canonicalCopies returns the files in canonical with checksum sum, other
+// than the file located at path itself.
+func canonicalCopies(canonical *Sums, sum Digest, path string) []*File {
+	files, ok := canonical.GetDigest(sum)
+	if !ok {
+		return nil
+	}
+	var copies []*File
+	for _, file := range files {
+		if file.Path != path {
+			copies = append(copies, file)
+		}
+	}
+	sort.Slice(copies, func(i, j int) bool { return copies[i].Path < copies[j].Path })
+	return copies
+}
+
+// Redundant returns every file in s whose checksum is also present in
+// canonical, a set of known content registered ahead of time (for instance,
+// loaded with ReadIndex). Files in s that are themselves canonical copies are
+// not included. The result is sorted by path.
+func (s *Sums) Redundant(canonical *Sums) []Redundant {
+	var rs []Redundant
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		for _, file := range files {
+			if copies := canonicalCopies(canonical, sum, file.Path); len(copies) > 0 {
+				rs = append(rs, Redundant{File: file, Sum: sum, Canonical: copies})
+			}
+		}
+		return true
+	})
+	sort.Slice(rs, func(i, j int) bool { return rs[i].File.Path < rs[j].File.Path })
+	return rs
+}
+
+// WriteRedundant writes a summary of the files returned by Redundant to w in
+// the following format:
+//
+//	"/path/to/copy":
+//	- "/path/to/canonical"
+//	...
+func (s *Sums) WriteRedundant(w io.Writer, canonical *Sums) error {
+	for _, r := range s.Redundant(canonical) {
+		if _, err := fmt.Fprintf(w, "%q:\n", r.File.Path); err != nil {
+			return err
+		}
+		for _, file := range r.Canonical {
+			if _, err := fmt.Fprintf(w, "- %q\n", file.Path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,34 @@
+package dedup
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestFilterCanonical(t *testing.T) {
+	canonical, _ := FilterDir("other", &Options{FileSystem: FS}) // other/{dup3,lime}
+
+	dup := NewCollector(-1)
+	sums, _ := FilterDir("root/qux", &Options{Canonical: canonical, DupSink: dup, FileSystem: FS})
+	results := dup.Results()
+	if len(results) != 1 || results[0].Path != "root/qux/dup3" {
+		t.Fatalf("dup results = %+v; want root/qux/dup3", results)
+	}
+	if c := results[0].Canonical; len(c) != 1 || c[0].Path != "other/dup3" {
+		t.Errorf("Canonical = %v; want other/dup3", c)
+	}
+
+	var buf bytes.Buffer
+	if err := sums.WriteRedundant(&buf, canonical); err != nil {
+		t.Fatalf("WriteRedundant() = %v", err)
+	}
+	if got, want := buf.String(), "\"root/qux/dup3\":\n- \"other/dup3\"\n"; got != want {
+		t.Errorf("WriteRedundant() wrote %q; want %q", got, want)
+	}
+
+	// Canonical copies are not redundant with themselves.
+	sums, _ = FilterDir("other", &Options{Canonical: canonical, FileSystem: FS})
+	if rs := sums.Redundant(canonical); len(rs) != 0 {
+		t.Errorf("Redundant() = %+v; want none", rs)
+	}
+}
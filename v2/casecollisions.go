@@ -0,0 +1,112 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// CaseCollisions records the entries of the directories read that have names
+// differing only in case, such as "README.md" and "readme.md", regardless of
+// their contents: only one of them survives a copy to a case-insensitive file
+// system, such as those of Windows and macOS by default. Set
+// Options.CaseCollisions to a *CaseCollisions returned by NewCaseCollisions;
+// its methods may then be called from any goroutine, during and after the
+// evaluation. Only directories read by FilterDir, FilterPaths, and Watcher are
+// examined, including the entries that are skipped, such as hidden files under
+// SkipHidden, but not directories read before resuming from a checkpoint.
+type CaseCollisions struct {
+	mu sync.Mutex
+	m  map[string][][]string // Groups of colliding names by directory.
+}
+
+// CaseCollision is a set of entries in the same directory whose names differ
+// only in case.
+type CaseCollision struct {
+	Dir   string   // Path of the directory, as read.
+	Names []string // Sorted names of the files and directories.
+}
+
+// NewCaseCollisions returns a *CaseCollisions for an evaluation that has yet
+// to start.
+func NewCaseCollisions() *CaseCollisions {
+	return &CaseCollisions{m: make(map[string][][]string)}
+}
+
+// Collisions returns the collisions recorded so far, sorted by directory and
+// then by name.
+func (c *CaseCollisions) Collisions() []CaseCollision {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var out []CaseCollision
+	for dir, groups := range c.m {
+		for _, names := range groups {
+			out = append(out, CaseCollision{Dir: dir, Names: append([]string(nil), names...)})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		if out[i].Dir != out[j].Dir {
+			return out[i].Dir < out[j].Dir
+		}
+		return out[i].Names[0] < out[j].Names[0]
+	})
+	return out
+}
+
+// WriteCollisions writes the collisions returned by Collisions to w in the
+// following format, where each line below a directory lists a set of names
+// that collide:
+//
+//	"/path/to/dir":
+//	- "Docs" "docs"
+//	- "README.md" "readme.md"
+//	...
+func (c *CaseCollisions) WriteCollisions(w io.Writer) error {
+	var dir string
+	for i, cc := range c.Collisions() {
+		if i == 0 || cc.Dir != dir {
+			dir = cc.Dir
+			if _, err := fmt.Fprintf(w, "%q:\n", dir); err != nil {
+				return err
+			}
+		}
+		quoted := make([]string, len(cc.Names))
+		for j, name := range cc.Names {
+			quoted[j] = strconv.Quote(name)
+		}
+		if _, err := fmt.Fprintf(w, "- %s\n", strings.Join(quoted, " ")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// record records the names of the entries of the directory located at dir
+// that collide, replacing those recorded when it was last read, if ever.
+func (c *CaseCollisions) record(dir string, names []string) {
+	byKey := make(map[string][]string, len(names))
+	for _, name := range names {
+		key := strings.ToLower(name)
+		byKey[key] = append(byKey[key], name)
+	}
+	var groups [][]string
+	for _, group := range byKey {
+		if len(group) > 1 {
+			sort.Strings(group)
+			groups = append(groups, group)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(groups) > 0 {
+		c.m[dir] = groups
+	} else {
+		delete(c.m, dir)
+	}
+}
@@ -0,0 +1,43 @@
+package dedup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestCaseCollisions(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/README.md":        []byte("a"),
+		"root/readme.md":        []byte("b"),
+		"root/Readme.MD":        []byte("c"),
+		"root/other":            []byte("a"),
+		"root/Docs/file":        []byte("d"),
+		"root/docs/File":        []byte("e"),
+		"root/docs/file":        []byte("e"),
+		"root/unique/.hidden":   []byte("f"),
+		"root/unique/.HIDDEN":   []byte("g"),
+		"root/unique/different": []byte("h"),
+	}, nil)
+	c := NewCaseCollisions()
+	if _, err := FilterDir("root", &Options{Recursive: true, SkipHidden: true, CaseCollisions: c, FileSystem: fs}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	if err := c.WriteCollisions(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := `"root":
+- "Docs" "docs"
+- "README.md" "Readme.MD" "readme.md"
+"root/docs":
+- "File" "file"
+"root/unique":
+- ".HIDDEN" ".hidden"
+`
+	if got := buf.String(); got != want {
+		t.Errorf("WriteCollisions() wrote\n%s\nwant\n%s", got, want)
+	}
+}
@@ -0,0 +1,53 @@
+package dedup
+
+import (
+	"sync"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// Checker reports whether files duplicate content seen before, one file at a
+// time, such as for an ingestion pipeline to skip content it already holds
+// without evaluating everything again. It is safe for concurrent use.
+type Checker struct {
+	mu   sync.Mutex
+	sums *Sums
+	fs   filesys.FileSystem // File system of the files checked, or nil for the local one.
+}
+
+// NewChecker returns a *Checker of files against the content in baseline,
+// such as an index read by ReadIndex, which must hold the checksums computed
+// under the default Options. The files checked are added to baseline in
+// turn, so that later files are also checked against them.
+func NewChecker(baseline *Sums) *Checker {
+	return &Checker{sums: baseline}
+}
+
+// CheckFile reads the file located at path, following symbolic links, and
+// reports whether its content is already in the baseline of c or was in a
+// file checked before. existing lists the files in which it was seen, not
+// counting any at path itself. Errors are reported as by HashFile, and the
+// file is then not added.
+func (c *Checker) CheckFile(path string) (dup bool, existing []*File, err error) {
+	sum, info, err := HashFile(c.fs, path, "sha1")
+	if err != nil {
+		return false, nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	files, _ := c.sums.GetDigest(sum)
+	seen := false
+	for _, file := range files {
+		if file.Path == path {
+			seen = true
+		} else {
+			existing = append(existing, file)
+		}
+	}
+	if !seen {
+		c.sums.AppendDigest(sum, &File{Path: path, Info: info})
+	}
+	return len(existing) > 0, existing, nil
+}
@@ -0,0 +1,48 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestChecker(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a":     []byte("old"),
+		"incoming/1": []byte("old"),
+		"incoming/2": []byte("new"),
+		"incoming/3": []byte("new"),
+	}, nil)
+	baseline, err := FilterDir("root", &Options{FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	if !baseline.Contains(sha1Sum([]byte("old"))) || baseline.Contains(sha1Sum([]byte("new"))) {
+		t.Fatalf("Contains reports the wrong content in the baseline")
+	}
+
+	c := NewChecker(baseline)
+	c.fs = fs
+	for i, tc := range []struct {
+		path string
+		dup  bool
+		want []string
+	}{
+		{"incoming/1", true, []string{"root/a"}},
+		{"incoming/2", false, nil},
+		{"incoming/3", true, []string{"incoming/2"}},
+		{"incoming/2", true, []string{"incoming/3"}},
+	} {
+		dup, existing, err := c.CheckFile(tc.path)
+		checkErrors(t, "", err, nil)
+		var got []string
+		for _, file := range existing {
+			got = append(got, file.Path)
+		}
+		if dup != tc.dup || len(got) != len(tc.want) || len(got) > 0 && got[0] != tc.want[0] {
+			t.Errorf("%d: CheckFile(%q) = %v, %q; want %v, %q", i, tc.path, dup, got, tc.dup, tc.want)
+		}
+	}
+
+	if _, _, err := c.CheckFile("incoming/missing"); err == nil {
+		t.Errorf("CheckFile of a missing file succeeded")
+	}
+}
@@ -0,0 +1,223 @@
+package dedup
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCheckpointInterval is how often progress is saved to
+// Options.StatePath if Options.CheckpointInterval is 0.
+const DefaultCheckpointInterval = time.Minute
+
+// state is the progress of an evaluation of the files and directories located
+// at Roots, as saved to Options.StatePath.
+type state struct {
+	Roots     []string    `json:"roots"`
+	Pending   []stateDir  `json:"pending"` // Directories that remain to be read.
+	Vanished  uint64      `json:"vanished"`
+	Special   uint64      `json:"special"`
+	BytesRead uint64      `json:"bytes_read"`
+	Skipped   uint64      `json:"skipped"`
+	Files     []indexFile `json:"files"` // Files evaluated so far.
+}
+
+// stateDir is the serialized form of a dirItem.
+type stateDir struct {
+	Path  string `json:"path"`
+	Depth int    `json:"depth"`
+	Dev   uint64 `json:"dev,omitempty"`
+	DevOK bool   `json:"dev_ok,omitempty"`
+}
+
+// readState reads the state saved to the file located at pth for an
+// evaluation of roots. It returns nil if no such file exists.
+func readState(pth string, roots []string) (*state, error) {
+	b, err := ioutil.ReadFile(pth)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	st := new(state)
+	if err := json.Unmarshal(b, st); err != nil {
+		return nil, fmt.Errorf("dedup: reading state: %w", err)
+	}
+	if !reflect.DeepEqual(st.Roots, roots) {
+		return nil, fmt.Errorf("dedup: %s: state is for %s, not %s",
+			pth, strings.Join(st.Roots, ", "), strings.Join(roots, ", "))
+	}
+	return st, nil
+}
+
+// write saves st to the file located at pth, replacing it atomically.
+func (st *state) write(pth string) error {
+	b, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return writeFile(pth, 0600, func(w io.Writer) error {
+		_, err := w.Write(append(b, '\n'))
+		return err
+	})
+}
+
+// resume configures d to continue the evaluation saved in st instead of
+// starting over. Not to be called after Start.
+func (d *dirFilter) resume(st *state) error {
+	sums, err := sumsOf(st.Files)
+	if err != nil {
+		return fmt.Errorf("dedup: reading state: %w", err)
+	}
+	sums.r.NumVanished, sums.r.NumSpecial = st.Vanished, st.Special
+	sums.r.BytesRead, sums.r.FilesSkipped = st.BytesRead, st.Skipped
+	d.f.sums.Merge(sums)
+	pending := make([]dirItem, len(st.Pending))
+	for i, dir := range st.Pending {
+		pending[i] = dirItem{path: dir.Path, depth: dir.Depth, dev: dir.Dev, devOK: dir.DevOK}
+	}
+	d.r.resume(pending)
+	return nil
+}
+
+// checkpoint pauses d until every file read so far has been evaluated, and
+// returns its progress. ok will be false if d was canceled meanwhile.
+func (d *dirFilter) checkpoint() (st *state, ok bool) {
+	pending := d.r.pause()
+	defer d.r.unpause()
+	// Paths sent on d.r.out are evaluated, and results consumed, while d.r is
+	// paused.
+	for atomic.LoadUint64(&d.f.handled) < atomic.LoadUint64(&d.r.emitted) {
+		select {
+		case <-d.r.cancel.C():
+			return nil, false
+		case <-d.f.cancel.C():
+			return nil, false
+		case <-time.After(time.Millisecond):
+		}
+	}
+	stats := d.f.sums.Stats()
+	st = &state{
+		Roots:     d.r.roots,
+		Pending:   []stateDir{},
+		Vanished:  stats.NumVanished,
+		Special:   stats.NumSpecial,
+		BytesRead: stats.BytesRead,
+		Skipped:   stats.FilesSkipped,
+		Files:     d.f.sums.indexFiles(),
+	}
+	for _, dir := range pending {
+		st.Pending = append(st.Pending, stateDir{Path: dir.path, Depth: dir.depth, Dev: dir.dev, DevOK: dir.devOK})
+	}
+	return st, true
+}
+
+// canceled reports whether d was canceled.
+func (d *dirFilter) canceled() bool {
+	select {
+	case <-d.f.cancel.C():
+		return true
+	default:
+		return d.r.canceled()
+	}
+}
+
+// checkpointFilter is an implementation of the filter interface that wraps a
+// dirFilter, saving its progress to a state file every interval. Errors
+// saving progress are sent on Err.
+type checkpointFilter struct {
+	*dirFilter
+	path     string
+	interval time.Duration
+	saveErr  chan error
+	err      <-chan error
+	stop     *signal // Signal the goroutine saving progress to return.
+}
+
+var _ filter = (*checkpointFilter)(nil)
+
+func newCheckpointFilter(d *dirFilter, path string, interval time.Duration) *checkpointFilter {
+	c := &checkpointFilter{dirFilter: d, path: path, interval: interval}
+	if c.interval <= 0 {
+		c.interval = DefaultCheckpointInterval
+	}
+	c.saveErr = make(chan error)
+	c.err = mergeErrors(d.f.cancel.C(), d.Err(), c.saveErr)
+	c.stop = newSignal()
+	return c
+}
+
+func (c *checkpointFilter) Err() <-chan error { return c.err }
+
+// Start instructs the dirFilter wrapped by c to start, and starts saving its
+// progress. Not to be called more than once on the same instance.
+func (c *checkpointFilter) Start() {
+	c.dirFilter.Start()
+	done := make(chan struct{})
+	go func() {
+		c.f.busyProcs.Wait()
+		close(done)
+	}()
+	go func() {
+		defer close(c.saveErr)
+		t := time.NewTicker(c.interval)
+		defer t.Stop()
+		for {
+			select {
+			case <-c.stop.C():
+				return
+			case <-done:
+				return
+			case <-t.C:
+				if err := c.save(); err != nil {
+					select {
+					case <-c.stop.C():
+						return
+					case c.saveErr <- err:
+					}
+				}
+			}
+		}
+	}()
+}
+
+// save writes the progress of c to its state file.
+func (c *checkpointFilter) save() error {
+	st, ok := c.checkpoint()
+	if !ok {
+		return nil
+	}
+	if err := st.write(c.path); err != nil {
+		return newError("checkpoint", c.path, err)
+	}
+	return nil
+}
+
+// Cancel stops saving progress, and interrupts the dirFilter wrapped by c.
+func (c *checkpointFilter) Cancel() {
+	c.stop.Once()
+	c.dirFilter.Cancel()
+}
+
+// finish removes the state file of c if every file was evaluated, since there
+// is nothing left to resume.
+func (c *checkpointFilter) finish() error {
+	if c.canceled() {
+		return nil
+	}
+	if err := os.Remove(c.path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// errChunkState is returned for Options that set both StatePath and ChunkMode,
+// since chunks are not saved.
+var errChunkState = errors.New("dedup: StatePath is not supported with ChunkMode")
@@ -0,0 +1,90 @@
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestFilterDirResume(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	data := filepath.Join(root, "data")
+	for i := 0; i < 40; i++ {
+		pth := filepath.Join(data, fmt.Sprint(i%4), fmt.Sprint(i/4%2), fmt.Sprint(i))
+		if err := os.MkdirAll(filepath.Dir(pth), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(pth, []byte(fmt.Sprint(i%10)), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	statePath := filepath.Join(root, "state.json")
+
+	// Interrupt the first evaluation once half the files are evaluated.
+	cancel := make(chan struct{})
+	var mu sync.Mutex
+	var seen []string
+	interrupt := StageFunc(func(r *Result) error {
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, r.Path)
+		if len(seen) == 20 {
+			close(cancel)
+		}
+		return nil
+	})
+	opts := &Options{
+		Recursive:          true,
+		MaxFilesPerSec:     200,
+		StatePath:          statePath,
+		CheckpointInterval: 10 * time.Millisecond,
+		Cancel:             cancel,
+		Stages:             &Stages{Report: []Stage{interrupt}},
+	}
+	if _, err := FilterDir(data, opts); !errors.Is(err, ErrCanceled) {
+		t.Fatalf("FilterDir() = %v; want ErrCanceled", err)
+	}
+	st, err := readState(statePath, []string{data})
+	if err != nil || st == nil {
+		t.Fatalf("readState() = %v, %v; want saved state", st, err)
+	}
+	if len(st.Files) == 0 || len(st.Files) > 20 || len(st.Pending) == 0 {
+		t.Fatalf("saved %d files and %d pending directories; want some of each", len(st.Files), len(st.Pending))
+	}
+
+	if _, err := FilterDir(root, &Options{Recursive: true, StatePath: statePath}); err == nil || !strings.Contains(err.Error(), "state is for") {
+		t.Errorf("FilterDir() of another directory = %v; want error", err)
+	}
+
+	// Resume, evaluating only the files not saved.
+	var resumed []string
+	record := StageFunc(func(r *Result) error {
+		mu.Lock()
+		defer mu.Unlock()
+		resumed = append(resumed, r.Path)
+		return nil
+	})
+	sums, err := FilterDir(data, &Options{Recursive: true, StatePath: statePath, Stages: &Stages{Stat: []Stage{record}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats := sums.Stats(); stats.NumFiles != 40 || stats.NumDupFiles != 30 {
+		t.Errorf("Stats() = %+v; want 40 files, 30 duplicates", stats)
+	}
+	if len(resumed)+len(st.Files) != 40 {
+		t.Errorf("evaluated %d files after resuming with %d saved; want 40 in total", len(resumed), len(st.Files))
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("state file remains after evaluation: %v", err)
+	}
+}
@@ -0,0 +1,219 @@
+package dedup
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+)
+
+// Chunk identifies a content-defined chunk of a file.
+type Chunk struct {
+	Sum  Digest // SHA1 checksum of the chunk's contents.
+	Size int
+}
+
+// Chunk sizes used by chunk, in bytes. Chunk boundaries depend only on the
+// contents of a file near them, so inserting or removing bytes in one part of
+// a file changes only the chunks in that part.
+const (
+	minChunkSize = 2 << 10
+	avgChunkSize = 8 << 10
+	maxChunkSize = 64 << 10
+)
+
+// Masks used by chunk to normalize chunk sizes around avgChunkSize: a
+// boundary is harder to find before the average size is reached, and easier
+// to find after.
+const (
+	hardChunkMask = 1<<15 - 1 // log2(avgChunkSize) + 2 bits.
+	easyChunkMask = 1<<11 - 1 // log2(avgChunkSize) - 2 bits.
+)
+
+// gear maps each byte value to a pseudorandom 64-bit value for the rolling
+// hash computed by chunk.
+var gear = func() (t [256]uint64) {
+	x := uint64(0x9e3779b97f4a7c15)
+	for i := range t {
+		// splitmix64.
+		x += 0x9e3779b97f4a7c15
+		z := x
+		z = (z ^ z>>30) * 0xbf58476d1ce4e5b9
+		z = (z ^ z>>27) * 0x94d049bb133111eb
+		t[i] = z ^ z>>31
+	}
+	return
+}()
+
+// chunk splits b into content-defined chunks with the FastCDC algorithm and
+// returns them in order.
+func chunk(b []byte) []Chunk {
+	var chunks []Chunk
+	for len(b) > 0 {
+		n := chunkBoundary(b)
+		sum := sha1.Sum(b[:n])
+		chunks = append(chunks, Chunk{Sum: Digest(sum[:]), Size: n})
+		b = b[n:]
+	}
+	return chunks
+}
+
+// chunkBoundary returns the length of the first chunk of b.
+func chunkBoundary(b []byte) int {
+	if len(b) <= minChunkSize {
+		return len(b)
+	}
+	n, normal := len(b), avgChunkSize
+	if n > maxChunkSize {
+		n = maxChunkSize
+	}
+	if n < normal {
+		normal = n
+	}
+	var h uint64
+	i := minChunkSize
+	for ; i < normal; i++ {
+		if h = h<<1 + gear[b[i]]; h&hardChunkMask == 0 {
+			return i
+		}
+	}
+	for ; i < n; i++ {
+		if h = h<<1 + gear[b[i]]; h&easyChunkMask == 0 {
+			return i
+		}
+	}
+	return n
+}
+
+// ChunkIndex maps the chunks of files to the files containing them. It is
+// safe for concurrent access from multiple goroutines.
+type ChunkIndex struct {
+	mu sync.Mutex
+	m  map[Digest]*chunkFiles
+}
+
+// chunkFiles lists the files containing a chunk.
+type chunkFiles struct {
+	size  int
+	files []*File
+}
+
+// NewChunkIndex initializes a ChunkIndex and returns a pointer to it.
+func NewChunkIndex() *ChunkIndex {
+	x := new(ChunkIndex)
+	x.m = make(map[Digest]*chunkFiles)
+	return x
+}
+
+// Add stores the chunks of file. Chunks that occur more than once in file
+// are stored once.
+func (x *ChunkIndex) Add(file *File, chunks []Chunk) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	seen := make(map[Digest]bool, len(chunks))
+	for _, c := range chunks {
+		if seen[c.Sum] {
+			continue
+		}
+		seen[c.Sum] = true
+		cf, ok := x.m[c.Sum]
+		if !ok {
+			cf = &chunkFiles{size: c.Size}
+			x.m[c.Sum] = cf
+		}
+		cf.files = append(cf.files, file)
+	}
+}
+
+// merge stores the chunks of every file in other in x.
+func (x *ChunkIndex) merge(other *ChunkIndex) {
+	other.mu.Lock()
+	m := make(map[Digest]chunkFiles, len(other.m))
+	for sum, cf := range other.m {
+		m[sum] = chunkFiles{size: cf.size, files: append([]*File(nil), cf.files...)}
+	}
+	other.mu.Unlock()
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+	for sum, cf := range m {
+		if dst, ok := x.m[sum]; ok {
+			dst.files = append(dst.files, cf.files...)
+		} else {
+			x.m[sum] = &chunkFiles{size: cf.size, files: cf.files}
+		}
+	}
+}
+
+// Similarity describes two files that share chunks.
+type Similarity struct {
+	A, B   *File
+	Shared uint64  // Number of bytes in chunks present in both files.
+	Share  float64 // Shared as a fraction of the size of the larger file.
+}
+
+// Similar returns pairs of files whose shared chunks make up at least
+// minShare, between 0 and 1, of the larger file, ordered by decreasing Share
+// and then by path.
+func (x *ChunkIndex) Similar(minShare float64) []Similarity {
+	type pair struct{ a, b *File }
+
+	x.mu.Lock()
+	shared := make(map[pair]uint64)
+	for _, cf := range x.m {
+		for i, a := range cf.files {
+			for _, b := range cf.files[i+1:] {
+				p := pair{a, b}
+				if b.Path < a.Path {
+					p = pair{b, a}
+				}
+				shared[p] += uint64(cf.size)
+			}
+		}
+	}
+	x.mu.Unlock()
+
+	var sims []Similarity
+	for p, n := range shared {
+		larger := p.a.Info.Size()
+		if size := p.b.Info.Size(); size > larger {
+			larger = size
+		}
+		share := 1.0
+		if larger > 0 {
+			share = float64(n) / float64(larger)
+		}
+		if share >= minShare {
+			sims = append(sims, Similarity{A: p.a, B: p.b, Shared: n, Share: share})
+		}
+	}
+	sort.Slice(sims, func(i, j int) bool {
+		if sims[i].Share != sims[j].Share {
+			return sims[i].Share > sims[j].Share
+		}
+		if sims[i].A.Path != sims[j].A.Path {
+			return sims[i].A.Path < sims[j].A.Path
+		}
+		return sims[i].B.Path < sims[j].B.Path
+	})
+	return sims
+}
+
+// WriteSimilar writes the pairs of files returned by Similar(minShare) to w
+// in the following format:
+//
+//	87% (1048576 B):
+//	- "/path/to/file1"
+//	- "/path/to/file2"
+//	...
+func (x *ChunkIndex) WriteSimilar(w io.Writer, minShare float64) error {
+	for _, sim := range x.Similar(minShare) {
+		if _, err := fmt.Fprintf(w, "%d%% (%d B):\n- %q\n- %q\n",
+			int(sim.Share*100), sim.Shared, sim.A.Path, sim.B.Path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
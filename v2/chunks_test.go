@@ -0,0 +1,63 @@
+package dedup
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestChunk(t *testing.T) {
+	b := randBytes(1 << 20)
+	chunks := chunk(b)
+	n := 0
+	for _, c := range chunks {
+		if c.Size < minChunkSize && n+c.Size != len(b) || c.Size > maxChunkSize {
+			t.Errorf("chunk at %d has size %d", n, c.Size)
+		}
+		n += c.Size
+	}
+	if n != len(b) {
+		t.Fatalf("chunks cover %d bytes; want %d", n, len(b))
+	}
+
+	// Inserting bytes should only change the chunks near the insertion.
+	shifted := append(append(append([]byte(nil), b[:n/2]...), "inserted"...), b[n/2:]...)
+	seen := make(map[Digest]bool)
+	for _, c := range chunks {
+		seen[c.Sum] = true
+	}
+	changed := 0
+	for _, c := range chunk(shifted) {
+		if !seen[c.Sum] {
+			changed++
+		}
+	}
+	if changed > 2 {
+		t.Errorf("inserting 8 bytes changed %d of %d chunks; want at most 2", changed, len(chunks))
+	}
+}
+
+func TestFilterChunkMode(t *testing.T) {
+	a := randBytes(1 << 18)
+	fs := filesys.Map(map[string][]byte{
+		"root/a":     a,
+		"root/a.bak": append(bytes.Repeat([]byte("header"), 10), a...),
+		"root/b":     randBytes(1 << 18),
+	}, nil)
+
+	sums, err := FilterDir("root", &Options{ChunkMode: true, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	sims := sums.Chunks().Similar(0.5)
+	if len(sims) != 1 || sims[0].A.Path != "root/a" || sims[0].B.Path != "root/a.bak" {
+		t.Fatalf("Similar(0.5) = %+v; want root/a, root/a.bak", sims)
+	}
+	if sims[0].Share < 0.9 || sims[0].Share > 1 {
+		t.Errorf("Share = %v; want between 0.9 and 1", sims[0].Share)
+	}
+
+	sums, _ = FilterDir("root", &Options{FileSystem: fs})
+	if sims := sums.Chunks().Similar(0); len(sims) != 0 {
+		t.Errorf("without ChunkMode, Similar(0) = %+v; want none", sims)
+	}
+}
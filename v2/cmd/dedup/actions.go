@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// An action disposes of the duplicate file located at path, a copy of keep
+// under checksum sum in sums, and updates sums accordingly.
+type action func(sums *dedup.Sums, sum dedup.Digest, keep, path string) error
+
+var actions = map[string]action{
+	dedup.OpDelete: deleteDup,
+	dedup.OpLink:   linkDup,
+}
+
+// deleteDup removes the duplicate file located at path.
+func deleteDup(sums *dedup.Sums, sum dedup.Digest, keep, path string) error {
+	return applyStep(sums, sum, dedup.OpDelete, keep, path)
+}
+
+// linkDup replaces the duplicate file located at path with a hard link to
+// keep.
+func linkDup(sums *dedup.Sums, sum dedup.Digest, keep, path string) error {
+	return applyStep(sums, sum, dedup.OpLink, keep, path)
+}
+
+// applyStep applies op to path as a dedup.Step, provided that keep and path
+// are distinct files under sum in sums, and removes path from sums if it was
+// deleted.
+func applyStep(sums *dedup.Sums, sum dedup.Digest, op, keep, path string) error {
+	files, _ := sums.GetDigest(sum)
+	var keepFile, dupFile *dedup.File
+	for _, file := range files {
+		switch file.Path {
+		case keep:
+			keepFile = file
+		case path:
+			dupFile = file
+		}
+	}
+	for _, f := range []struct {
+		path string
+		file *dedup.File
+	}{{keep, keepFile}, {path, dupFile}} {
+		if f.file == nil || f.file.Info == nil {
+			return fmt.Errorf("%s: not a file with checksum %x", f.path, sum)
+		}
+	}
+
+	st := dedup.Step{
+		Op:      op,
+		Path:    path,
+		Keep:    keep,
+		Sum:     hex.EncodeToString([]byte(sum)),
+		Size:    dupFile.Info.Size(),
+		ModTime: dupFile.Info.ModTime(),
+	}
+	if err := st.Apply(); err != nil {
+		return err
+	}
+	if op == dedup.OpDelete {
+		sums.Remove(sum, path)
+	}
+	return nil
+}
@@ -0,0 +1,204 @@
+package main
+
+import (
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// keepPolicies maps the values of -keep to the functions that implement them.
+var keepPolicies = map[string]func(files []*dedup.File) *dedup.File{
+	"first":  dedup.KeepFirst,
+	"oldest": dedup.KeepOldest,
+	"newest": dedup.KeepNewest,
+}
+
+// apply runs the apply subcommand with args, applying a plan written by
+// -dry-run -format json.
+func apply(args []string) {
+	flags := flag.NewFlagSet("apply", flag.ExitOnError)
+	quarantineDir := flags.String("quarantine", "", "Move files to be "+
+		"deleted into `dir` instead, as -quarantine does.")
+	trash := flags.Bool("trash", false, "Move files to be deleted into the "+
+		"trash instead, as -trash does.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup apply [-quarantine <dir> | -trash] <plan>\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || *quarantineDir != "" && *trash {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+	q, err := quarantine(*quarantineDir, *trash)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+
+	f, err := os.Open(flags.Arg(0))
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	plan, err := dedup.ReadPlan(f)
+	_ = f.Close()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	if err := applyPlan(plan, nil, q, false); err != nil {
+		os.Exit(exitErrors)
+	}
+}
+
+// restore runs the restore subcommand with args, restoring the files moved
+// into a quarantine or the trash.
+func restore(args []string) {
+	flags := flag.NewFlagSet("restore", flag.ExitOnError)
+	trash := flags.Bool("trash", false, "Restore the files moved into the "+
+		"trash by -trash.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup restore -trash | <dir>\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() > 1 || *trash == (flags.NArg() == 1) {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+	q, err := quarantine(flags.Arg(0), *trash)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+
+	restored, err := q.Restore()
+	for _, e := range restored {
+		_, _ = fmt.Fprintln(os.Stdout, e.Path)
+	}
+	if errs, ok := err.(dedup.Errors); ok {
+		for _, err := range errs {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+	} else if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "Restored %d files.\n", len(restored))
+	if err != nil {
+		os.Exit(exitErrors)
+	}
+}
+
+// quarantine returns the quarantine in dir, the trash if trash is set, or nil
+// if neither is.
+func quarantine(dir string, trash bool) (*dedup.Quarantine, error) {
+	if trash {
+		return dedup.Trash()
+	}
+	if dir != "" {
+		return dedup.NewQuarantine(dir), nil
+	}
+	return nil, nil
+}
+
+// applyPlan applies each step in plan, printing errors and, unless quiet, a
+// summary to stderr. Files to be deleted are moved into q instead if it is not
+// nil. Deleted files are removed from sums if it is not nil. If err is
+// non-nil, its type will be dedup.Errors.
+func applyPlan(plan *dedup.Plan, sums *dedup.Sums, q *dedup.Quarantine, quiet bool) error {
+	var errs dedup.Errors
+	var deleted, linked int
+	var reclaimed uint64
+	for _, st := range plan.Steps {
+		var err error
+		if q != nil && st.Op == dedup.OpDelete {
+			err = q.Move(st)
+		} else {
+			err = st.Apply()
+		}
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			errs = append(errs, err)
+			continue
+		}
+		if st.Op == dedup.OpLink {
+			linked++
+		} else {
+			deleted++
+			if sum, err := hex.DecodeString(st.Sum); err == nil && sums != nil {
+				sums.Remove(dedup.Digest(sum), st.Path)
+			}
+		}
+		reclaimed += uint64(st.Size)
+	}
+	if !quiet && q != nil {
+		_, _ = fmt.Fprintf(os.Stderr, "Moved %d duplicates to %s and linked %d.\n",
+			deleted, q.Dir(), linked)
+	} else if !quiet {
+		_, _ = fmt.Fprintf(os.Stderr, "Deleted %d and linked %d duplicates, reclaiming %s.\n",
+			deleted, linked, humanSize(reclaimed))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// applyAction applies the action registered by name to each group of
+// duplicates in sums, keeping the file chosen by keep, and prints errors and,
+// unless quiet, a summary to stderr. Files that no longer exist once the
+// action is applied are removed from sums. If err is non-nil, its type will
+// be dedup.Errors.
+func applyAction(name string, sums *dedup.Sums, keep func(files []*dedup.File) *dedup.File, quiet bool) error {
+	a, ok := dedup.LookupAction(name)
+	if !ok {
+		return dedup.Errors{fmt.Errorf("unknown action %q", name)}
+	}
+	var errs dedup.Errors
+	var groups, removed int
+	for _, g := range sums.DupGroups() {
+		kept := keep(g.Files)
+		files := []*dedup.File{kept}
+		for _, file := range g.Files {
+			if file != kept {
+				files = append(files, file)
+			}
+		}
+		g.Files = files
+		var local []*dedup.File // Duplicates in the local file system.
+		for _, file := range files[1:] {
+			if _, err := os.Lstat(file.Path); err == nil {
+				local = append(local, file)
+			}
+		}
+		if err := a.Apply(g); err != nil {
+			if aerrs, ok := err.(dedup.Errors); ok {
+				errs = append(errs, aerrs...)
+			} else {
+				errs = append(errs, err)
+			}
+		}
+		groups++
+		for _, file := range local {
+			if _, err := os.Lstat(file.Path); os.IsNotExist(err) {
+				sums.Remove(g.Sum, file.Path)
+				removed++
+			}
+		}
+	}
+	for _, err := range errs {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+	}
+	if !quiet {
+		_, _ = fmt.Fprintf(os.Stderr, "Applied %s to %d groups, removing %d duplicates.\n",
+			name, groups, removed)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
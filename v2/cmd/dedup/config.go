@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// configFlags maps the keys of the configuration file that differ from the
+// names of the flags they set to those names; other keys are flag names.
+var configFlags = map[string]string{
+	"recursive":       "R",
+	"follow-symlinks": "L",
+	"one-file-system": "x",
+	"exit-on-error":   "e",
+	"exit-on-dup":     "b",
+}
+
+// configPath returns the path of the configuration file: $DEDUP_CONFIG, or
+// dedup/config in the user's configuration directory, and whether it must
+// exist.
+func configPath() (path string, required bool) {
+	if path := os.Getenv("DEDUP_CONFIG"); path != "" {
+		return path, true
+	}
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", false
+	}
+	return filepath.Join(dir, "dedup", "config"), false
+}
+
+// loadConfig sets the flags of set named by the configuration file, if any,
+// to its settings, before the command line is parsed, so that flags
+// specified on the command line override them. Settings of the flags that
+// set does not accept, though dedup does, are left out.
+func loadConfig(set *flag.FlagSet) error {
+	path, required := configPath()
+	if path == "" {
+		return nil
+	}
+	f, err := os.Open(path)
+	if os.IsNotExist(err) && !required {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	settings, err := dedup.ReadConfig(f)
+	if err != nil {
+		return fmt.Errorf("%s: %v", path, err)
+	}
+	for _, s := range settings {
+		name := s.Key
+		if n, ok := configFlags[name]; ok {
+			name = n
+		}
+		if flag.Lookup(name) == nil {
+			return fmt.Errorf("%s:%d: unknown setting %q", path, s.Line, s.Key)
+		}
+		if set.Lookup(name) == nil {
+			continue
+		}
+		if err := set.Set(name, s.Value); err != nil {
+			return fmt.Errorf("%s:%d: %s: %v", path, s.Line, s.Key, err)
+		}
+	}
+	return nil
+}
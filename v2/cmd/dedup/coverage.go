@@ -0,0 +1,76 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bdragon/dedup/v2"
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// coverage runs the coverage subcommand with args, comparing a directory
+// against a backup of it.
+func coverage(args []string) {
+	flags := flag.NewFlagSet("coverage", flag.ExitOnError)
+	format := flags.String("format", "text", "Print the files present and "+
+		"missing in `format`: \"text\" or \"json\".")
+	missingOnly := flags.Bool("missing", false, "Only print the files "+
+		"missing from the backup.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup coverage [-format json] [-missing] <dir> <backup>\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 || *format != "text" && *format != "json" {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+
+	live, backup := flags.Arg(0), flags.Arg(1)
+	if filesys.IsArchive(backup) && !strings.Contains(backup, filesys.ArchiveSep) {
+		backup += filesys.ArchiveSep // Evaluate its members, not the archive itself.
+	}
+	cancel := make(chan struct{})
+	go handleInterrupt(cancel)
+	sums, err := dedup.FilterPaths([]string{live, backup}, &dedup.Options{
+		Recursive:      true,
+		Archives:       true,
+		ErrWriter:      os.Stderr,
+		Cancel:         cancel,
+		GracefulCancel: true,
+	})
+	if sums == nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	canceled, err := splitSentinel(err, dedup.ErrCanceled)
+
+	c := sums.Coverage(live, backup)
+	if *missingOnly {
+		c.Present = []dedup.CoveredFile{}
+	}
+	var werr error
+	if *format == "json" {
+		werr = c.WriteJSON(os.Stdout)
+	} else {
+		werr = c.WriteText(os.Stdout)
+	}
+	if werr != nil {
+		_, _ = fmt.Fprintln(os.Stderr, werr)
+		os.Exit(exitErrors)
+	}
+
+	status := exitOK
+	if !c.Complete() {
+		status |= exitDups
+	}
+	if err != nil {
+		status |= exitErrors
+	}
+	if canceled {
+		status = exitInterrupted
+	}
+	os.Exit(status)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+)
+
+// diff runs the diff subcommand with args, comparing two indexes written by
+// -index.
+func diff(args []string) {
+	flags := flag.NewFlagSet("diff", flag.ExitOnError)
+	format := flags.String("format", "text", "Print the differences in "+
+		"`format`: \"text\" or \"json\".")
+	verifyKeyPath := flags.String("verify-key", "", "Verify both indexes "+
+		"against their signatures, as -verify-key does, using the Ed25519 "+
+		"public key in PEM `file`.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup diff [-format json] [-verify-key <file>] <old index> <new index>\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 2 || *format != "text" && *format != "json" {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+
+	older, err := readIndex(flags.Arg(0), *verifyKeyPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	newer, err := readIndex(flags.Arg(1), *verifyKeyPath)
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	d := older.Diff(newer)
+	if *format == "json" {
+		err = d.WriteJSON(os.Stdout)
+	} else {
+		err = d.WriteText(os.Stdout)
+	}
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	if !d.Empty() {
+		os.Exit(exitDups)
+	}
+}
@@ -0,0 +1,1052 @@
+package main
+
+import (
+	"bufio"
+	"crypto/ed25519"
+	"flag"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/signal"
+	"regexp"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"text/tabwriter"
+	"text/template"
+	"time"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+var (
+	exitOnError = flag.Bool("e", false, "If an error occurs, print it to "+
+		"stderr and exit with non-zero status. The default behavior is to "+
+		"print the error to stderr and continue.")
+
+	groupErrors = flag.Bool("group-errors", false, "Print errors to stderr "+
+		"once all files have been evaluated, summarizing files in the same "+
+		"directory that failed for the same reason on a single line.")
+
+	exitOnDup = flag.Bool("b", false, "Stop processing and exit with "+
+		"non-zero status if a file with a previously-seen checksum is found.")
+
+	recursive = flag.Bool("R", false, "Read files from <dir> recursively. "+
+		"Has no effect when reading from stdin.")
+
+	maxDepth = flag.Int("max-depth", 0, "Descend at most `N` levels of "+
+		"directories below <dir> when reading recursively. The default, 0, "+
+		"means no limit.")
+
+	oneFileSystem = flag.Bool("x", false, "Do not descend into directories "+
+		"on other file systems than <dir>.")
+
+	followSymlinks = flag.Bool("L", false, "Follow symbolic links.")
+
+	followWithinRoot = flag.Bool("follow-within-root", false, "Follow "+
+		"symbolic links only if they lead within <dir>, so that stray links "+
+		"do not lead the evaluation into other directories or mounts. Links "+
+		"are then never followed when reading from stdin.")
+
+	printLinkSource = flag.Bool("print-link-source", false, "With -L or "+
+		"-follow-within-root, print the path of the symbolic link that led "+
+		"to a file, as given or found, instead of the path of the file, so "+
+		"that removing the path printed removes the link. With "+
+		"-print-target, print both, separated by a tab, with -u and -d, or "+
+		"as a further target field with -D.")
+
+	printTarget = flag.Bool("print-target", false, "With -L or "+
+		"-follow-within-root, print the path of the file that a symbolic "+
+		"link led to, which is the default, or, with -print-link-source, "+
+		"both paths.")
+
+	absPaths = flag.Bool("abs", false, "Print and record the paths of "+
+		"files as absolute, clean paths, whatever the form of the paths "+
+		"given, so that they stay valid from any working directory.")
+
+	relPaths = flag.Bool("rel", false, "Print and record the paths of "+
+		"files relative to <dir>, which must be the only one given.")
+
+	comments = flag.Bool("comments", false, "When reading from stdin, skip "+
+		"lines starting with #, as comments.")
+
+	unquote = flag.Bool("unquote", false, "When reading from stdin, unquote "+
+		"the paths read as a POSIX shell would, such as those printed by ls "+
+		"--quoting-style=shell-escape. Lines that are not quoted are read "+
+		"as they are.")
+
+	archives = flag.Bool("archives", false, "Also evaluate the files in zip "+
+		"and tar archives, optionally gzip-compressed, naming them like "+
+		"\"archive.zip!/inner/path\". Like sub-directories, archives are only "+
+		"read with -R, subject to -max-depth.")
+
+	match = flag.String("match", "content", "Compare files by `method`: "+
+		"\"content\" to compare the SHA1 checksums of their contents; "+
+		"\"image\" to compare GIF, JPEG, and PNG images by a perceptual hash "+
+		"of their pixels, so that visually identical images are duplicates "+
+		"even if they are encoded differently (other files are compared by "+
+		"content); \"photo\" to compare JPEG and PNG images by the SHA1 "+
+		"checksums of their contents without EXIF, XMP, and other metadata, "+
+		"so that copies whose metadata alone was edited are duplicates; "+
+		"\"audio\" to compare MP3, FLAC, and M4A files by the SHA1 checksums "+
+		"of their audio data without ID3, APEv2, Vorbis comment, or MP4 "+
+		"tags, so that copies of a track tagged anew are duplicates; "+
+		"\"name-size\" to compare their base names and sizes; or "+
+		"\"size-mtime\" to compare their sizes and modification times. The "+
+		"last two do not read files at all, for quick estimates on slow "+
+		"network file systems. Methods other than content may not be "+
+		"combined with -delete, -link, -action, or tui.")
+
+	normalizeText = flag.Bool("normalize-text", false, "Compare text files "+
+		"by the SHA1 checksums of their contents without the spaces, tabs, "+
+		"and carriage returns at the end of each line, so that the same "+
+		"document with CRLF and LF line endings is a duplicate. Files with "+
+		"NUL bytes among their first 8000 bytes are compared as they are. "+
+		"May not be combined with -delete, -link, -action, or tui.")
+
+	stripBOM = flag.Bool("strip-bom", false, "With -normalize-text, also "+
+		"ignore a UTF-8 byte order mark at the start of text files.")
+
+	imageThreshold = flag.Int("image-threshold", dedup.DefaultImageThreshold, "With -match image, the "+
+		"greatest number of bits in `N` by which the 64-bit perceptual "+
+		"hashes of images may differ for them to be considered identical.")
+
+	algo = flag.String("algo", "sha1", "Compare files by the checksums of "+
+		"their contents computed by the digest `name`, among blake3, md5, "+
+		"sha1, sha256, and sha512. blake3 is recommended for large files on "+
+		"machines with several cores, as it hashes each file on all of "+
+		"them at once. Checksums may only be compared with those of "+
+		"indexes written with the same -algo.")
+
+	digests = flag.String("digests", "", "Also compute the digests named in "+
+		"the comma-separated `names` of each file read, among blake3, md5, "+
+		"sha1, sha256, and sha512, as its contents are read, and include "+
+		"them in the output of -D and -index, or print them in place of the "+
+		"checksum with hash.")
+
+	readRetries = flag.Int("read-retries", 0, "Retry reading a file up to "+
+		"`N` times if an I/O error occurs, waiting longer before each retry.")
+
+	perFileTimeout = flag.Duration("file-timeout", 0, "Give up reading a file "+
+		"that takes longer than `duration`, retries included, and report it "+
+		"as an error, so that a file on an unresponsive network mount does "+
+		"not hold up the evaluation for good.")
+
+	slowReads = flag.Duration("slow", 0, "Print each file that took longer "+
+		"than `duration` to read, or that needed retries, to stderr along "+
+		"with the time taken and the number of retries.")
+
+	xattrCache = flag.Bool("xattr-cache", false, "Store the checksum of each "+
+		"file read in its user.dedup.sha1 extended attribute, and trust it "+
+		"instead of reading the file again while its size and modification "+
+		"time are unchanged. Only supported on Linux; has no effect with "+
+		"-match other than content, -etags, or -chunks.")
+
+	bwLimit = flag.String("bwlimit", "", "Read files no faster than `rate` "+
+		"bytes per second, in total, which may have a k, M, or G suffix, "+
+		"e.g. 50M.")
+
+	filesPerSec = flag.Int("files-per-sec", 0, "Evaluate at most `N` files "+
+		"per second, in total.")
+
+	maxFiles = flag.Int("max-files", 0, "Stop once `N` files have been "+
+		"evaluated, reporting the partial results, such as to sample a huge "+
+		"tree or bound the time taken by a CI job.")
+
+	maxBytes = flag.String("max-bytes", "", "Stop before the files "+
+		"evaluated would total more than `size` bytes, which may have a k, "+
+		"M, or G suffix, reporting the partial results.")
+
+	timeout = flag.Duration("timeout", 0, "Stop once `duration`, such as "+
+		"30m, has passed since dedup started, finishing the files being "+
+		"read and reporting the partial results, such as to bound a "+
+		"scheduled scan of a huge tree.")
+
+	precount = flag.Bool("precount", false, "List every file in <dir> "+
+		"with its size before reading any, and skip reading files whose "+
+		"sizes are unique, since they cannot have duplicates. Skipped files "+
+		"are not counted as evaluated. Has no effect with -match other than "+
+		"content, -etags, or -canonical.")
+
+	samplePercent = flag.Float64("sample", 0, "Estimate the duplication "+
+		"in <dir> from a random `percent` of the sizes shared by several "+
+		"files, reading only the files of those sizes, and print the "+
+		"estimated bytes of duplicates with 95% confidence bounds. Files "+
+		"are listed with their sizes first, as with -precount.")
+
+	background = flag.Bool("background", false, "Run as a low-priority "+
+		"background job: evaluate one file at a time and, on Linux, lower "+
+		"the CPU and I/O scheduling priorities of dedup, as by nice and "+
+		"ionice.")
+
+	ioHints = flag.Bool("io-hints", false, "On Linux, open files with "+
+		"O_NOATIME where permitted, and advise the kernel to drop their "+
+		"pages from the page cache once read, so that large scans neither "+
+		"update access times nor evict data cached for other programs.")
+
+	resumePath = flag.String("resume", "", "Save the progress of evaluating "+
+		"<dir> to the state `file` every minute, and if it exists, resume "+
+		"from the progress saved there instead of starting over. The file "+
+		"is removed once all files have been evaluated.")
+
+	spillDir = flag.String("spill-dir", "", "Hold the paths of the files "+
+		"evaluated in temporary files in `dir` instead of in memory, for "+
+		"evaluating more files than fit in memory. Hard links to the same "+
+		"file are then not recognized as such.")
+
+	lowMemory = flag.Bool("low-memory", false, "List every file in <dir> "+
+		"with its size to temporary files in the -spill-dir, or the default "+
+		"temporary directory, then evaluate the files of one range of sizes "+
+		"at a time, skipping files whose sizes are unique as with "+
+		"-precount, so that memory use stays bounded when evaluating "+
+		"hundreds of millions of files. Files are reported in order of size "+
+		"rather than as they are found.")
+
+	largestFirst = flag.Bool("largest-first", false, "List every file in "+
+		"<dir> before reading any, then evaluate the largest first, so that "+
+		"the duplicates wasting the most space are found early, such as "+
+		"with -b, -max-files, or -max-bytes, or when dedup may be "+
+		"interrupted.")
+
+	priorityDirs = flag.String("priority-dirs", "", "List every file in "+
+		"<dir> before reading any, then evaluate the files in the "+
+		"directories named in the comma-separated `dirs` first, in that "+
+		"order, before all others. With -largest-first, the files of each "+
+		"directory are evaluated from the largest.")
+
+	skipHidden = flag.Bool("skip-hidden", false, "Skip files and "+
+		"directories in <dir> whose names start with a dot, such as .git, "+
+		"or that are hidden on Windows.")
+
+	ignoreCase = flag.Bool("ignore-case", runtime.GOOS == "windows" ||
+		runtime.GOOS == "darwin", "Compare the <dir> arguments "+
+		"case-insensitively, so that a directory given twice under names "+
+		"differing in case, or within another one given, is read once. "+
+		"The default is true on Windows and macOS, whose file systems "+
+		"ignore case by default.")
+
+	ignoreFiles = flag.String("ignore-files", "", "Skip files and "+
+		"directories in <dir> matched by the rules of the ignore files named "+
+		"in the comma-separated `names`, such as .gitignore,.dedupignore, "+
+		"found in the directory containing them or in any of its ancestors "+
+		"up to <dir>. Rules have the syntax of .gitignore files.")
+
+	matchRegexp = flag.String("regex", "", "Only evaluate files whose paths "+
+		"match the regular expression `re`, such as '(?i)\\.jpe?g$'.")
+
+	excludeRegexp = flag.String("exclude-regex", "", "Skip files whose "+
+		"paths match the regular expression `re`, and directories whose "+
+		"paths match it with a trailing slash, such as '/node_modules/'.")
+
+	includeSpecial = flag.Bool("include-special", false, "Also evaluate "+
+		"named pipes, sockets, and devices, which are skipped by default "+
+		"since reading them may block or never end.")
+
+	skipModifiedWithin = flag.Duration("skip-modified-within", 0, "Skip "+
+		"files modified less than `duration` ago, such as 5m, which may "+
+		"still be being written to.")
+
+	detectChanges = flag.Bool("detect-changes", false, "Check each file "+
+		"again once read, and report a file whose size or modification time "+
+		"changed while it was read as an error instead of trusting its "+
+		"checksum, when evaluating directories in use.")
+
+	skipUnreadable = flag.Bool("skip-unreadable", false, "Skip files and "+
+		"directories that may not be read for lack of permission instead of "+
+		"reporting them as errors, so that they alone do not make dedup exit "+
+		"with status 2; they are counted in the summary.")
+
+	s3URL = flag.String("s3", "", "Read files from the objects in an S3 "+
+		"bucket under `url`, of the form s3://bucket/prefix, instead of <dir>, "+
+		"using the endpoint, region, and credentials set by the AWS_* "+
+		"environment variables.")
+
+	etags = flag.Bool("etags", false, "Compare files by the MD5 checksums "+
+		"of their contents, using the ETags of objects read from S3 that were "+
+		"uploaded in a single part instead of downloading them. May not be "+
+		"combined with -delete, -link, -action, or tui.")
+
+	printUniq = flag.Bool("u", false, "Print each file with a "+
+		"previously-unseen checksum to stdout.")
+
+	printDup = flag.Bool("d", false, "Print each file with a previously-seen "+
+		"checksum to stdout.")
+
+	outputBuffer = flag.Int("output-buffer", 0, "With -u or -d, let up to "+
+		"`N` paths wait to be printed, so that a slow consumer of stdout, "+
+		"such as a pipe, does not hold up the evaluation until then.")
+
+	outputDrop = flag.Int("output-drop", 0, "With -output-buffer, drop "+
+		"paths instead of waiting once `percent` of the buffer is full, "+
+		"when a consumer may miss paths but must not slow the evaluation.")
+
+	printBrokenLinks = flag.Bool("broken-links", false, "Print each broken "+
+		"symbolic link to stdout instead of reporting it as an error.")
+
+	indexPath = flag.String("index", "", "Write an index of all evaluated "+
+		"files and their checksums to `file` as JSON.")
+
+	sqlitePath = flag.String("export-sqlite", "", "Write every evaluated "+
+		"file, with its checksum, and the groups of duplicates to the "+
+		"tables files, digests, and dup_groups of a SQLite database in "+
+		"`file`, replacing it, for querying with sqlite3.")
+
+	signKeyPath = flag.String("sign-key", "", "Sign the index written by "+
+		"-index with the Ed25519 private key in PEM `file`, writing the "+
+		"signature to the index path with .sig appended.")
+
+	exportHost = flag.String("host", "", "Name the machine the files "+
+		"evaluated with export are on `name`, instead of its hostname.")
+
+	printVersions = flag.Bool("versions", false, "Print groups of files "+
+		"whose names indicate that they are copies of the same file, such "+
+		"as \"file.jpg\", \"file (1).jpg\", and \"Copy of file.jpg\", to stdout "+
+		"along with their checksums once all files have been evaluated.")
+
+	printConflicts = flag.Bool("conflicts", false, "Print groups of files "+
+		"that share the same name but not the same contents, wherever they "+
+		"lie, such as photos named alike in libraries being merged, to "+
+		"stdout along with their checksums once all files have been "+
+		"evaluated.")
+
+	printCaseCollisions = flag.Bool("case-collisions", false, "Print the "+
+		"files and directories in <dir> whose names differ only in case "+
+		"from those of others in the same directory, such as \"README.md\" "+
+		"and \"readme.md\", to stdout once all files have been evaluated, "+
+		"regardless of their contents: only one of them would survive a copy "+
+		"to a case-insensitive file system.")
+
+	canonicalPath = flag.String("canonical", "", "Treat files whose "+
+		"checksums appear in the index `file` written by -index as "+
+		"duplicates of the canonical copies listed there.")
+
+	verifyKeyPath = flag.String("verify-key", "", "Verify the index read by "+
+		"-canonical against its signature, read from the index path with "+
+		".sig appended, using the Ed25519 public key in PEM `file`.")
+
+	printRedundant = flag.Bool("redundant", false, "Print each file whose "+
+		"checksum appears in the -canonical index to stdout, followed by the "+
+		"canonical copies, once all files have been evaluated.")
+
+	printChunks = flag.Int("chunks", 0, "Split files into content-defined "+
+		"chunks and print each pair of files whose shared chunks make up at "+
+		"least `percent` of the larger file, such as a disk image and a "+
+		"modified backup of it, to stdout once all files have been "+
+		"evaluated.")
+
+	quiet = flag.Bool("quiet", false, "Do not print the summary of "+
+		"evaluated files and duplicates found to stderr.")
+
+	verbose = flag.Bool("v", false, "Print each file and directory skipped, "+
+		"and why, to stderr as it is skipped.")
+
+	veryVerbose = flag.Bool("vv", false, "Like -v, and also print each "+
+		"directory read and each file evaluated, with its checksum, to stderr.")
+
+	printSummary = flag.Bool("summary", false, "Print a machine-readable "+
+		"summary line to stderr before exiting, in the following stable "+
+		"format:\n\n"+
+		"\tsummary: files=N bytes=N dups=N dup_bytes=N vanished=N errors=N "+
+		"status=N\n")
+
+	deleteDups = flag.Bool("delete", false, "Delete duplicate files once all "+
+		"files have been evaluated, keeping one file in each group chosen "+
+		"by -keep.")
+
+	linkDups = flag.Bool("link", false, "Replace duplicate files with hard "+
+		"links to the file kept in each group, chosen by -keep, once all "+
+		"files have been evaluated.")
+
+	actionName = flag.String("action", "", "Apply the action registered "+
+		"as `name` to each group of duplicate files once all files have "+
+		"been evaluated, keeping the file chosen by -keep: \"delete\", "+
+		"\"link\", or \"symlink\" to delete the duplicates or replace them "+
+		"with hard or symbolic links to the file kept, or \"trash\" to move "+
+		"them into the trash.")
+
+	quarantineDir = flag.String("quarantine", "", "With -delete, move "+
+		"duplicate files into `dir` instead, at their absolute paths below "+
+		"it, recording them in a manifest there so that they may be "+
+		"restored with dedup restore <dir>.")
+
+	trash = flag.Bool("trash", false, "With -delete, move duplicate files "+
+		"into the trash of the current user instead, as specified by "+
+		"freedesktop.org, so that they may be restored with a file manager "+
+		"or with dedup restore -trash.")
+
+	keepPolicy = flag.String("keep", "first", "With -delete, -link, or "+
+		"-action, keep the file in each group chosen by `policy`: \"first\" "+
+		"for the path that sorts first, \"oldest\" for the file modified "+
+		"least recently, or \"newest\" for the file modified most recently.")
+
+	dryRun = flag.Bool("dry-run", false, "With -delete or -link, print the "+
+		"files that would be deleted or linked to stdout instead, in the "+
+		"format set by -format. A plan printed as JSON may be applied later "+
+		"with dedup apply.")
+
+	format = flag.String("format", "text", "Print the plan of -dry-run, or "+
+		"the summary of -D, in `format`: \"text\" or \"json\", or, for -D "+
+		"only, \"csv\", \"yaml\", \"fdupes\", or \"template\". The text "+
+		"summary of -D is only YAML-like; -format yaml writes one that YAML "+
+		"parsers accept. -format fdupes lists the paths of each group of "+
+		"duplicates followed by a blank line, as fdupes and jdupes do, for "+
+		"scripts written for them. -format template writes the summary "+
+		"with -template and -group-template.")
+
+	fileTemplate = flag.String("template", "", "With -format template, "+
+		"print each duplicate file by executing the text/template `text`, "+
+		"followed by a newline, with the fields Sum, Path, Size, Index, the "+
+		"position of the file in its group, and Link, the file that it is a "+
+		"hard link to, if any; for example, '{{.Sum}} {{.Path}} {{.Size}}'.")
+
+	groupTemplate = flag.String("group-template", "", "With -format "+
+		"template, print each group of duplicates, before its files, by "+
+		"executing the text/template `text`, followed by a newline, with "+
+		"the fields Sum, Size, Digests, and Files, which has the fields of "+
+		"-template for each file.")
+
+	outputPath = flag.String("output", "", "With -D, write the summary to "+
+		"`file` instead of stdout. The summary is written to a temporary "+
+		"file that replaces file once complete, so that a previous summary "+
+		"is never replaced by a partly written one.")
+
+	strictMatch = flag.String("strict", "", "Only consider files "+
+		"duplicates if they also share the metadata named in the "+
+		"comma-separated `fields`, among mtime, mode, and owner, such as to "+
+		"verify that a backup preserved it. Checksums printed are then "+
+		"followed by the metadata compared.")
+
+	sameDir = flag.Bool("same-dir", false, "Only consider files "+
+		"duplicates of files in the same directory. Checksums printed are "+
+		"then followed by the directory.")
+
+	crossDir = flag.Bool("cross-dir", false, "Only report files as "+
+		"duplicates once a copy in another directory has been found, "+
+		"ignoring copies kept side by side in one directory.")
+
+	longReport = flag.Bool("long", false, "With -D, also print the mode, "+
+		"owner, and modification time of each file after its path, as "+
+		"ls -l does, or include them as further fields with -format, to "+
+		"help choose which copy to keep.")
+
+	reportHeader = flag.Bool("report-header", false, "With -D and -format "+
+		"json, csv, or yaml, begin the summary with the version of dedup, "+
+		"the host, the start and end times of the evaluation, the digest "+
+		"compared, and the options set, as the header key under json, and "+
+		"as a comment line holding a JSON object under csv and yaml, so "+
+		"that the summary tells how it was made.")
+
+	groupOrder = flag.String("sort", "sum", "With -D, print groups of "+
+		"duplicates sorted by `key`: \"sum\", by checksum, or \"wasted\", "+
+		"by the bytes that removing all but one copy would free, most "+
+		"first. Either way, the order is the same from one run to the next.")
+
+	printStats = flag.Bool("stats", false, "Print tables of duplicate files "+
+		"and wasted bytes by file extension and by top-level directory to "+
+		"stderr once all files have been evaluated. With several <dir>, also "+
+		"print the duplicates within each <dir> and, for each pair, those "+
+		"in the latter <dir> of files in the former, such as to see how "+
+		"much of a backup duplicates its source.")
+
+	printTimings = flag.Bool("timings", false, "Print the time spent "+
+		"listing directories, reading and hashing files, and writing "+
+		"output, and the average throughput, to stderr once all files have "+
+		"been evaluated, to help compare -algo digests or storage.")
+
+	minCopies = flag.Int("min-copies", 0, "Only report duplicates, with "+
+		"-d, -D, and -b, once at least `N` files share their checksum, for "+
+		"when only heavily duplicated files matter. The summary still "+
+		"counts every duplicate.")
+
+	printAllDup = flag.Bool("D", false, "Print summary of duplicate "+
+		"files and their checksums to stdout in the following format after "+
+		"all files have been evaluated, listing the digests computed with "+
+		"-digests, if any, on indented lines, and noting files that are hard "+
+		"links to another listed before them:\n\n"+
+		"\tda39a3ee5e6b4b0d3255bfef95601890afd80709:\n"+
+		"\t  sha256: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855\n"+
+		"\t- \"/path/to/file1\"\n"+
+		"\t- \"/path/to/file2\"\n"+
+		"\t- \"/path/to/file3\" (hard link to \"/path/to/file1\")\n"+
+		"\t...\n")
+)
+
+// Exit statuses. exitDups and exitErrors are combined if both apply.
+const (
+	exitOK          = 0
+	exitDups        = 1 // Duplicates were found.
+	exitErrors      = 2 // Errors occurred, or the command line was invalid.
+	exitInterrupted = 130
+)
+
+func printUsageAndExit(hint string) {
+	if hint != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", hint)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "NAME\n"+
+		"  dedup - detect duplicate files\n\n"+
+		"SYNOPSIS\n"+
+		"  dedup -u [-b] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -d [-b] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -D [-long] [-sort sum|wasted] [-format json|csv|yaml|fdupes | -format template -template <text>] [-output <file>] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -broken-links [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -versions [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -redundant -canonical <file> [-verify-key <file>] [-e] [-L] "+
+		"[-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup -chunks <percent> [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup watch [-u | -d] [-b] [-e] [-L] [-R [-max-depth N] [-x]] <dir>\n"+
+		"  dedup tui [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup hash [-digests <names>] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup export [-host <name>] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup merge [-format json|csv|yaml|fdupes] <export>...\n"+
+		"  dedup -delete|-link [-keep <policy>] [-quarantine <dir> | -trash] "+
+		"[-dry-run [-format json]] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]\n"+
+		"  dedup apply [-quarantine <dir> | -trash] <plan>\n"+
+		"  dedup restore -trash | <dir>\n"+
+		"  dedup diff [-format json] [-verify-key <file>] <old index> <new index>\n"+
+		"  dedup verify [-quiet] [-read-retries N] <manifest>|-\n"+
+		"  dedup coverage [-format json] [-missing] <dir> <backup>\n"+
+		"  dedup serve [-addr <address>] [-metrics] [-token <token>]\n"+
+		"  dedup version\n\n"+
+		"DESCRIPTION\n"+
+		"  dedup reads file paths from stdin and looks for duplicates by "+
+		"computing the SHA1 checksum of each file. If <dir> is specified, "+
+		"dedup evaluates files in <dir> (recursively if -R is "+
+		"specified) instead, and in each further <dir> in turn; <dir> may "+
+		"also name a file to evaluate. <dir> may also be an s3:// url, as "+
+		"with -s3, or "+
+		"an sftp://[user@]host[:port]/path url, read over SFTP by running "+
+		"ssh.\n"+
+		"  By default, nothing is printed to stdout. To print paths of files "+
+		"with previously-unseen checksums to stdout, specify -u. To print "+
+		"paths of files with previously-seen checksums to stdout instead, "+
+		"specify -d. Or, to print a summary of all duplicate files and "+
+		"their checksums to stdout once all files have been evaluated, "+
+		"specify -D, along with -format json, csv, or yaml for a summary "+
+		"that other programs can read, -format template and -template to "+
+		"print it exactly as another program needs, or -output to write it to a file "+
+		"instead. To list broken symbolic links on stdout instead of "+
+		"reporting them as errors, specify -broken-links. To print groups of "+
+		"files named like copies of one another, specify -versions. To print "+
+		"files that share a name but not their contents, specify -conflicts. "+
+		"To print names that differ only in case within the same directory, "+
+		"specify -case-collisions. To print files that are copies of "+
+		"canonical content indexed with -index, specify -redundant and "+
+		"-canonical. To print pairs of files that share most of their "+
+		"contents, specify -chunks. Note that only one of -u, -d, -D, "+
+		"-broken-links, -versions, -conflicts, -case-collisions, -redundant, "+
+		"and -chunks may be specified.\n"+
+		"  After evaluating all files, dedup prints a summary to stderr, "+
+		"unless -quiet is specified, and exits with status 1 if any "+
+		"duplicates were found, 2 if any errors occurred, 3 if both, 0 "+
+		"otherwise, and 130 if interrupted. When interrupted, dedup finishes "+
+		"the files being read and prints the partial results as usual; "+
+		"interrupting it again exits immediately. Sending SIGUSR1, or SIGINFO "+
+		"on BSD and macOS, makes dedup print its progress so far and the "+
+		"files being evaluated to stderr without interrupting it. Invalid "+
+		"usage also exits with "+
+		"status 2. By default, if an error occurs, such as failure "+
+		"to open a file for reading, the error is printed to stderr and "+
+		"dedup continues. This behavior may be changed by specifying -e, "+
+		"which causes dedup to exit immediately if an error occurs. "+
+		"Similarly, specifying -b causes dedup to exit immediately if a file "+
+		"with a previously-seen checksum is encountered.\n"+
+		"  To dispose of duplicates, specify -delete to delete them, or -link "+
+		"to replace them with hard links, keeping one file in each group. "+
+		"With -dry-run, nothing is changed: the plan is printed instead, and "+
+		"a plan printed with -format json may be reviewed and then applied "+
+		"with dedup apply <plan>, which only deletes or links files that "+
+		"have not been modified since the plan was made. To move duplicates "+
+		"aside instead of deleting them, specify -quarantine or -trash along "+
+		"with -delete; dedup restore moves them back.\n"+
+		"  dedup diff compares two indexes of the same files written by "+
+		"-index at different times, such as to detect tampering, and prints "+
+		"the files added, removed, and changed between them, and the groups "+
+		"of files newly duplicated, exiting with status 1 if there are any "+
+		"differences.\n"+
+		"  dedup verify reads the files listed in a manifest, such as the "+
+		"output of sha1sum, sha256sum, or dedup hash, or an index written by "+
+		"-index, and prints whether each one still matches its checksum, "+
+		"exiting with status 1 if any do not or are missing, and 2 if any "+
+		"could not be read.\n"+
+		"  dedup coverage evaluates the files in <dir> and in <backup>, "+
+		"recursively, where <backup> is a directory or a zip or tar "+
+		"archive, and prints each file in <dir> that has a copy in "+
+		"<backup>, and so may be deleted without losing its contents, "+
+		"followed by each file that does not, exiting with status 1 if any "+
+		"are missing from <backup>.\n"+
+		"  dedup watch evaluates the files in <dir> in the same way, then keeps "+
+		"watching <dir> for files that are created, modified, or moved into "+
+		"it, evaluating each one as it appears, until interrupted. Watching "+
+		"is only supported on Linux.\n"+
+		"  dedup tui evaluates files in the same way, then presents each "+
+		"group of duplicates in an interactive terminal UI, where files may "+
+		"be marked to keep (space), delete (d), or replace with a hard link "+
+		"to the kept copy (l), and the marked actions applied (a).\n"+
+		"  dedup hash evaluates files in the same way, reading them with "+
+		"as many workers, but prints the checksum of each file followed by "+
+		"two spaces and its path to stdout as it is evaluated, as sha1sum "+
+		"does, whether or not it has duplicates; with -digests, the digests "+
+		"named are printed in place of the checksum, so that -digests sha256 "+
+		"prints what sha256sum would. Its exit status only reflects "+
+		"errors.\n"+
+		"  dedup export evaluates files in the same way, but writes every "+
+		"file evaluated to stdout once all have been, as a line giving its "+
+		"checksum, size, host, and path, and dedup merge reads the exports "+
+		"of several machines, such as of backup disks being consolidated, "+
+		"and prints the duplicates across all of them as -D does, naming "+
+		"each file host:path, exiting with status 1 if there are any; it "+
+		"also reads the output of fdupes and jdupes in place of exports, "+
+		"to report the duplicates they found in the formats of -D. The "+
+		"exit status of dedup export only reflects errors.\n"+
+		"  dedup watch, tui, hash, and export only accept the flags that "+
+		"apply to them, which dedup watch -h and so on list.\n"+
+		"  dedup serve runs an HTTP server instead, listening on "+
+		"localhost:8080 unless -addr is specified, whose JSON API starts "+
+		"scans in the background (POST /scans with a body such as "+
+		"{\"dir\": \"/data\", \"recursive\": true}), reports and streams their "+
+		"progress (GET /scans/{id} and /scans/{id}/events), lists the "+
+		"duplicate groups they found (GET /scans/{id}/groups), deletes "+
+		"duplicates or replaces them with hard links (POST "+
+		"/scans/{id}/actions with a body such as {\"action\": \"link\", "+
+		"\"sum\": \"...\", \"keep\": \"/data/a\", \"files\": [\"/data/b\"]}), "+
+		"and cancels them (DELETE /scans/{id}). With -metrics, it also "+
+		"exports the files evaluated, bytes read, errors, and duplicates "+
+		"of every scan to Prometheus (GET /metrics). Requests must carry "+
+		"the token given by -token or DEDUP_TOKEN, or printed at startup, "+
+		"in an Authorization: Bearer header, and POST bodies must be "+
+		"application/json; requests from web pages of other origins, or "+
+		"naming another host than -addr, are refused.\n"+
+		"  dedup version prints the version of dedup.\n"+
+		"  Unless DEDUP_CONFIG names another file, dedup reads the defaults "+
+		"of its flags from dedup/config in the user's configuration "+
+		"directory, such as ~/.config/dedup/config, if it exists: each line "+
+		"sets a flag, named without its dash, or recursive, follow-symlinks, "+
+		"one-file-system, exit-on-error, or exit-on-dup for -R, -L, -x, -e, "+
+		"and -b, as in TOML, such as recursive = true, exclude-regex = "+
+		"\"/\\\\.git/\", or digests = [\"sha256\"]. Flags on the command line "+
+		"override those settings; a boolean flag set there may be turned "+
+		"off with, say, -R=false. Settings of flags that a subcommand does "+
+		"not accept are left out when running it.\n\n"+
+		"OPTIONS\n")
+
+	flag.PrintDefaults()
+
+	_, _ = fmt.Fprintf(os.Stderr, "\nEXAMPLES\n"+
+		"  Print paths of unique images found in <dir> to stdout and "+
+		"discard error messages:\n\n"+
+		"    \t$ find <dir> -type f -regextype sed "+
+		"-iregex '.*\\.\\(gif\\|jpe\\?g\\|png\\)' | dedup -u 2>/dev/null\n\n"+
+		"  Write summary of files with duplicate checksums found in <dir> "+
+		"(following any symbolic links encountered) to <file> as YAML:\n\n"+
+		"    \t$ dedup -R -L -D <dir> > <file>\n\n"+
+		"  Remove files with previously-seen checksums from <dir>:\n\n"+
+		"    \t$ dedup -R -d <dir> | xargs rm --\n\n"+
+		"  Remove broken symbolic links from <dir>:\n\n"+
+		"    \t$ dedup -R -L -broken-links <dir> | xargs rm --\n\n"+
+		"  Write a signed index of <dir> to <file>, using a key pair "+
+		"generated with OpenSSL:\n\n"+
+		"    \t$ openssl genpkey -algorithm ed25519 -out key.pem\n"+
+		"    \t$ openssl pkey -in key.pem -pubout -out key.pub\n"+
+		"    \t$ dedup -R -index <file> -sign-key key.pem <dir>\n\n"+
+		"  Print files in <dir> that are copies of content in that signed "+
+		"index:\n\n"+
+		"    \t$ dedup -R -redundant -canonical <file> -verify-key key.pub <dir>\n")
+
+	os.Exit(exitErrors)
+}
+
+// subcommands are run in place of evaluating files, with flags of their own.
+var subcommands = map[string]func(args []string){
+	"serve":    serve,
+	"apply":    apply,
+	"restore":  restore,
+	"diff":     diff,
+	"verify":   verify,
+	"coverage": coverage,
+	"merge":    merge,
+	"version":  func([]string) { fmt.Println("dedup", dedup.Version) },
+}
+
+func main() {
+	if len(os.Args) > 1 {
+		if cmd, ok := subcommands[os.Args[1]]; ok {
+			cmd(os.Args[2:])
+			return
+		}
+		if m, ok := modes[os.Args[1]]; ok {
+			m.main(os.Args[2:])
+			return
+		}
+	}
+	defaultMode.main(os.Args[1:])
+}
+
+// writeIndex writes the index of sums to path. If keyPath is not empty, the
+// index is signed with the private key read from keyPath and the signature
+// is written to path + ".sig".
+func writeIndex(sums *dedup.Sums, path, keyPath string) error {
+	f, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	if keyPath == "" {
+		err = sums.WriteIndex(f)
+	} else {
+		var b []byte
+		var key ed25519.PrivateKey
+		var sig *os.File
+		if b, err = ioutil.ReadFile(keyPath); err != nil {
+			return err
+		}
+		if key, err = dedup.ParsePrivateKey(b); err != nil {
+			return err
+		}
+		if sig, err = os.Create(path + ".sig"); err != nil {
+			return err
+		}
+		defer sig.Close()
+		if err = sums.WriteSignedIndex(f, sig, key); err == nil {
+			err = sig.Close()
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// writeExport writes every file in sums to stdout as WriteExport does, naming
+// the machine host, or its hostname if host is empty.
+func writeExport(sums *dedup.Sums, host string) error {
+	if host == "" {
+		var err error
+		if host, err = os.Hostname(); err != nil {
+			return err
+		}
+	}
+	return sums.WriteExport(os.Stdout, host)
+}
+
+// readIndex reads an index from path. If keyPath is not empty, the index is
+// verified against the signature read from path + ".sig" using the public key
+// read from keyPath.
+func readIndex(path, keyPath string) (*dedup.Sums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if keyPath == "" {
+		return dedup.ReadIndex(f)
+	}
+	b, err := ioutil.ReadFile(keyPath)
+	if err != nil {
+		return nil, err
+	}
+	key, err := dedup.ParsePublicKey(b)
+	if err != nil {
+		return nil, err
+	}
+	sig, err := os.Open(path + ".sig")
+	if err != nil {
+		return nil, err
+	}
+	defer sig.Close()
+	return dedup.ReadSignedIndex(f, sig, key)
+}
+
+// writeGroupStats writes st to w as two tables.
+func writeGroupStats(w io.Writer, st dedup.GroupStats) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	for _, table := range []struct {
+		title string
+		rows  []dedup.CategoryStats
+	}{
+		{"EXTENSION", st.ByExt},
+		{"DIRECTORY", st.ByDir},
+	} {
+		_, _ = fmt.Fprintf(tw, "\n%s\tFILES\tSIZE\tDUPLICATES\tWASTED\t\n", table.title)
+		for _, row := range table.rows {
+			name := row.Category
+			if name == "" {
+				name = "(none)"
+			}
+			_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%d\t%s\t\n", name,
+				row.NumFiles, humanSize(row.NumBytes),
+				row.NumDupFiles, humanSize(row.NumDupBytes))
+		}
+	}
+	_ = tw.Flush()
+}
+
+// writeRootStats writes rs to w as a table, naming the duplicates within a
+// root "within <root>", and those across two "<root> ↔ <other>".
+func writeRootStats(w io.Writer, rs []dedup.RootStats) {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', tabwriter.AlignRight)
+	_, _ = fmt.Fprintf(tw, "\nROOTS\tDUPLICATES\tWASTED\tRECLAIMABLE\t\n")
+	name := func(root string) string {
+		if root == "" {
+			return "(elsewhere)"
+		}
+		return root
+	}
+	for _, r := range rs {
+		label := "within " + name(r.Root)
+		if !r.Within() {
+			label = name(r.Root) + " ↔ " + name(r.Other)
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%d\t%s\t%s\t\n", label, r.NumDupFiles,
+			humanSize(r.NumDupBytes), humanSize(r.ReclaimableBytes))
+	}
+	_ = tw.Flush()
+}
+
+// slowSink is a dedup.Sink that writes results for files that took longer
+// than min to read, or that needed retries, to w.
+type slowSink struct {
+	w   io.Writer
+	min time.Duration
+}
+
+func (s slowSink) Write(r dedup.Result) error {
+	if r.Read == nil || r.Read.Duration <= s.min && r.Read.Retries == 0 {
+		return nil
+	}
+	_, err := fmt.Fprintf(s.w, "slow read: %s (%v, %d retries)\n",
+		r.Path, r.Read.Duration.Round(time.Millisecond), r.Read.Retries)
+	return err
+}
+
+func (s slowSink) Flush() error { return nil }
+
+// hashSink is a dedup.Sink that prints the checksum of each file evaluated,
+// or its digests if any, followed by two spaces and its path, as sha1sum
+// does, to w, and passes results on to next, if not nil.
+type hashSink struct {
+	w       *bufio.Writer
+	digests []string // Names of the digests printed, in order.
+	next    dedup.Sink
+}
+
+func (s *hashSink) Write(r dedup.Result) error {
+	if len(s.digests) == 0 {
+		_, _ = fmt.Fprintf(s.w, "%x", r.Sum)
+	}
+	for i, name := range s.digests {
+		if i > 0 {
+			_ = s.w.WriteByte(' ')
+		}
+		_, _ = fmt.Fprintf(s.w, "%x", r.Digests[name])
+	}
+	if _, err := fmt.Fprintf(s.w, "  %s\n", r.Path); err != nil {
+		return err
+	}
+	if s.next != nil {
+		return s.next.Write(r)
+	}
+	return nil
+}
+
+func (s *hashSink) Flush() error {
+	if s.next != nil {
+		if err := s.next.Flush(); err != nil {
+			return err
+		}
+	}
+	return s.w.Flush()
+}
+
+// logger is a dedup.Logger that prints records to w as a message followed by
+// key=value pairs, omitting debug records unless debug is set. Errors are
+// printed as they are reported instead.
+type logger struct {
+	w     io.Writer
+	debug bool
+}
+
+func (l logger) Debug(msg string, args ...interface{}) {
+	if l.debug {
+		l.print(msg, args)
+	}
+}
+
+func (l logger) Info(msg string, args ...interface{}) { l.print(msg, args) }
+
+func (l logger) Error(msg string, args ...interface{}) {}
+
+func (l logger) print(msg string, args []interface{}) {
+	var b strings.Builder
+	b.WriteString(msg)
+	for i := 0; i+1 < len(args); i += 2 {
+		if s, ok := args[i+1].(string); ok {
+			_, _ = fmt.Fprintf(&b, " %v=%q", args[i], s)
+		} else {
+			_, _ = fmt.Fprintf(&b, " %v=%v", args[i], args[i+1])
+		}
+	}
+	b.WriteByte('\n')
+	_, _ = io.WriteString(l.w, b.String())
+}
+
+// handleInterrupt closes cancel on the first interrupt, so that the files
+// being read are finished and the partial results reported, and exits
+// immediately on the second.
+func handleInterrupt(cancel chan<- struct{}) {
+	interrupt := make(chan os.Signal, 2)
+	signal.Notify(interrupt, syscall.SIGINT, syscall.SIGQUIT, syscall.SIGTERM)
+
+	<-interrupt
+	_, _ = fmt.Fprintln(os.Stderr,
+		"Interrupted; finishing files being read (interrupt again to exit now)...")
+	close(cancel)
+	<-interrupt
+	_, _ = fmt.Fprintln(os.Stderr, "Interrupted again; exiting...")
+	os.Exit(exitInterrupted)
+}
+
+// handleStatus prints the progress reported by p to stderr whenever one of
+// statusSignals is received, such as SIGUSR1, without interrupting the
+// evaluation.
+func handleStatus(p *dedup.Progress) {
+	if len(statusSignals) == 0 {
+		return // signal.Notify would relay every signal.
+	}
+	status := make(chan os.Signal, 1)
+	signal.Notify(status, statusSignals...)
+	for range status {
+		printStatus(os.Stderr, p.StatsSnapshot())
+	}
+}
+
+// printStatus writes snap to w: the counts so far, as in the summary printed
+// once done, followed by the paths of the files being evaluated.
+func printStatus(w io.Writer, snap dedup.Snapshot) {
+	var b strings.Builder
+	_, _ = fmt.Fprintf(&b,
+		"Evaluated %d files (%s, %s read) and found %d duplicates (%s) so far in %v",
+		snap.NumFiles, humanSize(snap.NumBytes), humanSize(snap.BytesRead),
+		snap.NumDupFiles, humanSize(snap.NumDupBytes), snap.Elapsed.Round(time.Millisecond))
+	if snap.TotalBytes > 0 {
+		_, _ = fmt.Fprintf(&b, " (%.0f%% of %s)", snap.Percent, humanSize(snap.TotalBytes))
+	}
+	b.WriteString(".\n")
+	if len(snap.Current) > 0 {
+		b.WriteString("Evaluating:\n")
+	}
+	for _, path := range snap.Current {
+		_, _ = fmt.Fprintf(&b, "\t%s\n", path)
+	}
+	_, _ = io.WriteString(w, b.String())
+}
+
+func countTrue(bs ...bool) (n int) {
+	for _, b := range bs {
+		if b {
+			n++
+		}
+	}
+	return
+}
+
+// compileRegexp compiles expr, returning nil if it is empty.
+func compileRegexp(expr string) (*regexp.Regexp, error) {
+	if expr == "" {
+		return nil, nil
+	}
+	return regexp.Compile(expr)
+}
+
+// parseTemplate parses text as a text/template, returning nil if it is empty.
+func parseTemplate(text string) (*template.Template, error) {
+	if text == "" {
+		return nil, nil
+	}
+	return template.New("").Parse(text)
+}
+
+// splitBudget returns the *dedup.BudgetExceededError among the errors in err,
+// if any, and the other errors, or nil if there are none.
+func splitBudget(err error) (*dedup.BudgetExceededError, error) {
+	errs, ok := err.(dedup.Errors)
+	if !ok {
+		return nil, err
+	}
+	var budget *dedup.BudgetExceededError
+	var rest dedup.Errors
+	for _, e := range errs {
+		if b, ok := e.(*dedup.BudgetExceededError); ok {
+			budget = b
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	if len(rest) == 0 {
+		return budget, nil
+	}
+	return budget, rest
+}
+
+// splitSentinel reports whether err, as returned by Filter or FilterPaths,
+// includes sentinel, such as dedup.ErrCanceled, and returns the other errors
+// in err, if any.
+func splitSentinel(err, sentinel error) (bool, error) {
+	errs, ok := err.(dedup.Errors)
+	if !ok {
+		return false, err
+	}
+	var found bool
+	var rest dedup.Errors
+	for _, e := range errs {
+		if e == sentinel {
+			found = true
+		} else {
+			rest = append(rest, e)
+		}
+	}
+	if len(rest) == 0 {
+		return found, nil
+	}
+	return found, rest
+}
+
+// parseSize parses a non-negative number of bytes with an optional k, M, or G
+// suffix, as printed by humanSize. The empty string is 0.
+func parseSize(s string) (int64, error) {
+	if s == "" {
+		return 0, nil
+	}
+	mult := int64(1)
+	if i := strings.IndexByte("kMG", s[len(s)-1]); i >= 0 {
+		for ; i >= 0; i-- {
+			mult *= 1000
+		}
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid size: %q", s)
+	}
+	return n * mult, nil
+}
+
+func humanSize(b uint64) string {
+	unit := uint64(1000)
+	if b < unit {
+		return fmt.Sprintf("%d B", b)
+	}
+	div := unit
+	exp := 0
+	for n := b / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	const pre = "kMGTPE"
+	return fmt.Sprintf("%.2f %cB", float64(b)/float64(div), pre[exp])
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// merge runs the merge subcommand with args, combining exports written by
+// dedup export on several machines, or the output of fdupes, into a report
+// of the duplicates across all of them.
+func merge(args []string) {
+	flags := flag.NewFlagSet("merge", flag.ExitOnError)
+	format := flags.String("format", dedup.FormatText, "Print the duplicates "+
+		"in `format`, as -D does: \"text\", \"json\", \"csv\", \"yaml\", or "+
+		"\"fdupes\".")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup merge [-format json|csv|yaml|fdupes] <export>...\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	switch *format {
+	case dedup.FormatText, dedup.FormatJSON, dedup.FormatCSV, dedup.FormatYAML, dedup.FormatFdupes:
+	default:
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+	if flags.NArg() == 0 {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+
+	sums := dedup.NewSums()
+	for _, path := range flags.Args() {
+		exported, err := readExport(path)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitErrors)
+		}
+		sums.Merge(exported)
+	}
+	if err := sums.WriteReport(os.Stdout, *format); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	if sums.Stats().NumDupFiles > 0 {
+		os.Exit(exitDups)
+	}
+}
+
+// exportHeader starts the exports written by dedup export.
+const exportHeader = "# dedup export"
+
+// readExport reads an export written by dedup export from path, or the
+// output of fdupes or jdupes if it does not start as an export does.
+func readExport(path string) (*dedup.Sums, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	r := bufio.NewReader(f)
+	if header, _ := r.Peek(len(exportHeader)); string(header) != exportHeader {
+		return dedup.ReadFdupes(r)
+	}
+	return dedup.ReadExport(r)
+}
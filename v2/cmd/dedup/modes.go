@@ -0,0 +1,863 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// A mode evaluates files as dedup does, then reports them in its own way:
+// dedup itself, or one of the subcommands named in modes. Each mode accepts
+// evalFlags, which configure how files are found, read, and compared, and
+// the flags of its own, so that a flag that does not apply to it is refused.
+type mode struct {
+	name     string   // Subcommand that runs the mode; empty for dedup itself.
+	synopsis string   // Arguments of the subcommand, for its usage.
+	flags    []string // Names of the flags accepted beyond evalFlags.
+	run      func(m *mode)
+
+	set *flag.FlagSet // Flags accepted, once parsed by main.
+}
+
+// evalFlags name the flags accepted by every mode.
+var evalFlags = []string{
+	"e", "group-errors", "R", "max-depth", "x", "L", "follow-within-root",
+	"print-link-source", "print-target", "comments", "unquote", "archives",
+	"match", "normalize-text", "strip-bom", "image-threshold", "etags",
+	"algo", "digests", "strict", "same-dir", "cross-dir", "canonical",
+	"verify-key", "read-retries", "file-timeout", "slow", "xattr-cache",
+	"bwlimit", "files-per-sec", "max-files", "max-bytes", "timeout",
+	"background", "io-hints", "skip-hidden", "ignore-case", "ignore-files",
+	"regex", "exclude-regex", "include-special", "skip-modified-within",
+	"detect-changes", "skip-unreadable", "quiet", "v", "vv", "summary",
+}
+
+// scanFlags name the flags of the modes that evaluate the files at hand
+// once, rather than watching them; see setScan.
+var scanFlags = []string{
+	"s3", "index", "export-sqlite", "sign-key", "resume", "spill-dir",
+	"timings", "abs", "rel", "largest-first", "priority-dirs",
+}
+
+// skipFlags name the flags that skip files which cannot have duplicates;
+// see setSkips.
+var skipFlags = []string{"precount", "low-memory", "sample"}
+
+// printFlags name the flags that print files as they are evaluated; see
+// setPrint.
+var printFlags = []string{"u", "d", "b", "broken-links", "output-buffer", "output-drop"}
+
+// reportFlags name the flags with which dedup reports or disposes of the
+// duplicates found once all files have been evaluated.
+var reportFlags = []string{
+	"D", "long", "sort", "format", "template", "group-template", "output",
+	"report-header", "versions", "conflicts", "case-collisions",
+	"redundant", "chunks", "delete", "link", "action", "keep", "quarantine",
+	"trash", "dry-run",
+}
+
+// defaultMode is run by dedup itself.
+var defaultMode = &mode{
+	flags: concat(scanFlags, skipFlags, printFlags, reportFlags, []string{"min-copies", "stats"}),
+	run:   runDefault,
+}
+
+// modes are the subcommands that evaluate files as dedup itself does.
+var modes = map[string]*mode{
+	"watch": {
+		name:     "watch",
+		synopsis: "[-u | -d] [-b] [-e] [-L] [-R [-max-depth N] [-x]] <dir>",
+		flags:    concat(printFlags, []string{"min-copies"}),
+		run:      runWatch,
+	},
+	"tui": {
+		name:     "tui",
+		synopsis: "[-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]",
+		flags:    concat(scanFlags, skipFlags, []string{"min-copies", "stats"}),
+		run:      runTUIMode,
+	},
+	"hash": {
+		name:     "hash",
+		synopsis: "[-digests <names>] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]",
+		flags:    scanFlags,
+		run:      runHash,
+	},
+	"export": {
+		name:     "export",
+		synopsis: "[-host <name>] [-e] [-L] [-R [-max-depth N] [-x]] [<dir>...]",
+		flags:    concat(scanFlags, []string{"host"}),
+		run:      runExport,
+	},
+}
+
+func concat(lists ...[]string) []string {
+	var all []string
+	for _, l := range lists {
+		all = append(all, l...)
+	}
+	return all
+}
+
+// main parses args with the flags accepted by m, after the settings of the
+// configuration file, and runs m.
+func (m *mode) main(args []string) {
+	name := "dedup"
+	if m.name != "" {
+		name += " " + m.name
+	}
+	m.set = flag.NewFlagSet(name, flag.ExitOnError)
+	for _, names := range [][]string{evalFlags, m.flags} {
+		for _, name := range names {
+			f := flag.Lookup(name)
+			m.set.Var(f.Value, f.Name, f.Usage)
+		}
+	}
+	m.set.Usage = func() { m.usageAndExit("") }
+	if err := loadConfig(m.set); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	_ = m.set.Parse(args)
+	m.run(m)
+}
+
+// usageAndExit prints hint, if not empty, and the usage of m to stderr, and
+// exits.
+func (m *mode) usageAndExit(hint string) {
+	if m.name == "" {
+		printUsageAndExit(hint)
+	}
+	if hint != "" {
+		_, _ = fmt.Fprintf(os.Stderr, "%s\n", hint)
+	}
+	_, _ = fmt.Fprintf(os.Stderr, "usage: dedup %s %s\n", m.name, m.synopsis)
+	m.set.PrintDefaults()
+	os.Exit(exitErrors)
+}
+
+// dirs returns the roots of the files to evaluate: the arguments to m, or
+// the url given by -s3.
+func (m *mode) dirs() []string {
+	if *s3URL != "" {
+		return []string{*s3URL}
+	}
+	return m.set.Args()
+}
+
+// options returns the Options set by evalFlags, exiting with a usage hint if
+// they are invalid. It also sets MinGroupSize, whose flag is only accepted
+// by the modes that report duplicates.
+func (m *mode) options() *dedup.Options {
+	if *maxDepth < 0 {
+		m.usageAndExit("-max-depth must not be negative")
+	}
+	if *minCopies < 0 {
+		m.usageAndExit("-min-copies must not be negative")
+	}
+	if *readRetries < 0 {
+		m.usageAndExit("-read-retries must not be negative")
+	}
+	bytesPerSec, sizeErr := parseSize(*bwLimit)
+	if sizeErr != nil {
+		m.usageAndExit("invalid -bwlimit: " + *bwLimit)
+	}
+	maxTotalBytes, sizeErr := parseSize(*maxBytes)
+	if sizeErr != nil {
+		m.usageAndExit("invalid -max-bytes: " + *maxBytes)
+	}
+	if *maxFiles < 0 {
+		m.usageAndExit("-max-files must not be negative")
+	}
+	if *filesPerSec < 0 {
+		m.usageAndExit("-files-per-sec must not be negative")
+	}
+	if *perFileTimeout < 0 {
+		m.usageAndExit("-file-timeout must not be negative")
+	}
+	if *timeout < 0 {
+		m.usageAndExit("-timeout must not be negative")
+	}
+	if *skipModifiedWithin < 0 {
+		m.usageAndExit("-skip-modified-within must not be negative")
+	}
+	switch *match {
+	case "content", "image", "photo", "audio", "name-size", "size-mtime":
+	default:
+		m.usageAndExit("unknown -match method: " + *match)
+	}
+	switch *algo {
+	case "blake3", "md5", "sha1", "sha256", "sha512":
+	default:
+		m.usageAndExit("unknown -algo digest: " + *algo)
+	}
+	if *algo != "sha1" && (*match != "content" || *etags || *normalizeText) {
+		m.usageAndExit("-algo may not be combined with -match other than content, -etags, or -normalize-text")
+	}
+	if *digests != "" {
+		for _, name := range strings.Split(*digests, ",") {
+			switch name {
+			case "blake3", "md5", "sha1", "sha256", "sha512":
+			default:
+				m.usageAndExit("unknown -digests digest: " + name)
+			}
+		}
+	}
+	if *strictMatch != "" {
+		for _, name := range strings.Split(*strictMatch, ",") {
+			switch name {
+			case "mtime", "mode", "owner":
+			default:
+				m.usageAndExit("unknown -strict field: " + name)
+			}
+		}
+	}
+	if *strictMatch != "" && *canonicalPath != "" {
+		m.usageAndExit("only one may be provided: -strict, -canonical")
+	}
+	if countTrue(*sameDir, *crossDir, *canonicalPath != "") > 1 {
+		m.usageAndExit("only one may be provided: -same-dir, -cross-dir, -canonical")
+	}
+	if *etags && *match != "content" {
+		m.usageAndExit("only one may be provided: -etags, -match")
+	}
+	if *normalizeText && (*match != "content" || *etags) {
+		m.usageAndExit("-normalize-text may not be combined with -match other than content or -etags")
+	}
+	if *stripBOM && !*normalizeText {
+		m.usageAndExit("-strip-bom requires -normalize-text")
+	}
+	if (*printLinkSource || *printTarget) && !*followSymlinks && !*followWithinRoot {
+		m.usageAndExit("-print-link-source and -print-target require -L or -follow-within-root")
+	}
+	matchRE, reErr := compileRegexp(*matchRegexp)
+	if reErr != nil {
+		m.usageAndExit("invalid -regex: " + reErr.Error())
+	}
+	excludeRE, reErr := compileRegexp(*excludeRegexp)
+	if reErr != nil {
+		m.usageAndExit("invalid -exclude-regex: " + reErr.Error())
+	}
+	if *verifyKeyPath != "" && *canonicalPath == "" {
+		m.usageAndExit("-verify-key requires -canonical")
+	}
+
+	opts := new(dedup.Options)
+	opts.Recursive = *recursive
+	opts.MaxDepth = *maxDepth
+	opts.OneFileSystem = *oneFileSystem
+	opts.Archives = *archives
+	opts.SkipModifiedWithin = *skipModifiedWithin
+	opts.DetectChanges = *detectChanges
+	for _, name := range strings.Split(*strictMatch, ",") {
+		switch name {
+		case "mtime":
+			opts.StrictMatch.ModTime = true
+		case "mode":
+			opts.StrictMatch.Mode = true
+		case "owner":
+			opts.StrictMatch.Owner = true
+		}
+	}
+	if *algo != "sha1" {
+		opts.Algorithm = *algo
+	}
+	opts.NormalizeText = *normalizeText
+	opts.StripBOM = *stripBOM
+	opts.SameDirOnly = *sameDir
+	opts.CrossDirOnly = *crossDir
+	opts.SkipUnreadable = *skipUnreadable
+	opts.FollowSymlinks = *followSymlinks
+	opts.FollowWithinRoot = *followWithinRoot
+	switch {
+	case *printLinkSource && *printTarget:
+		opts.LinkPaths = dedup.LinkSourcesAndTargets
+	case *printLinkSource:
+		opts.LinkPaths = dedup.LinkSources
+	}
+	opts.MinGroupSize = *minCopies
+	opts.ExitOnError = *exitOnError
+	opts.ErrWriter = os.Stderr
+	opts.GroupErrors = *groupErrors
+	opts.ReadRetries = *readRetries
+	opts.PerFileTimeout = *perFileTimeout
+	opts.UseXattrCache = *xattrCache
+	opts.MaxBytesPerSec = bytesPerSec
+	opts.MaxFiles = *maxFiles
+	opts.MaxTotalBytes = maxTotalBytes
+	opts.MaxFilesPerSec = *filesPerSec
+	opts.LowPriority = *background
+	opts.RawIOHints = *ioHints
+	if *comments || *unquote {
+		opts.InputParser = dedup.LineParser{Comments: *comments, Unquote: *unquote}
+	}
+	opts.IncludeSpecial = *includeSpecial
+	opts.SkipHidden = *skipHidden
+	opts.IgnoreCase = *ignoreCase
+	if *verbose || *veryVerbose {
+		opts.Logger = logger{w: os.Stderr, debug: *veryVerbose}
+	}
+	if *ignoreFiles != "" {
+		opts.IgnoreFiles = strings.Split(*ignoreFiles, ",")
+	}
+	if *digests != "" {
+		opts.Digests = strings.Split(*digests, ",")
+	}
+	opts.MatchRegexp = matchRE
+	opts.ExcludeRegexp = excludeRE
+	switch {
+	case *match == "image":
+		opts.Matcher = dedup.NewImageMatcher(*imageThreshold)
+	case *match == "photo":
+		opts.Matcher = dedup.PhotoMatcher{}
+	case *match == "audio":
+		opts.Matcher = dedup.AudioMatcher{}
+	case *match == "name-size":
+		opts.Matcher = dedup.NameSizeMatcher{}
+	case *match == "size-mtime":
+		opts.Matcher = dedup.SizeModTimeMatcher{}
+	case *etags:
+		opts.Matcher = dedup.ETagMatcher{}
+	}
+	if *slowReads > 0 {
+		opts.TimeReads = true
+		opts.UniqSink = slowSink{os.Stderr, *slowReads}
+		opts.DupSink = opts.UniqSink
+	}
+	return opts
+}
+
+// setScan sets the Options of scanFlags, exiting with a usage hint if they
+// are invalid.
+func (m *mode) setScan(opts *dedup.Options) {
+	if *s3URL != "" && m.set.NArg() > 0 {
+		m.usageAndExit("only one may be provided: -s3, <dir>")
+	}
+	if *s3URL != "" && !strings.HasPrefix(*s3URL, "s3://") {
+		m.usageAndExit("-s3 requires an s3:// url")
+	}
+	if *signKeyPath != "" && *indexPath == "" {
+		m.usageAndExit("-sign-key requires -index")
+	}
+	if *resumePath != "" && len(m.dirs()) == 0 {
+		m.usageAndExit("-resume requires <dir>")
+	}
+	if *absPaths && *relPaths {
+		m.usageAndExit("only one may be provided: -abs, -rel")
+	}
+	if *relPaths && len(m.dirs()) != 1 {
+		m.usageAndExit("-rel requires one <dir>")
+	}
+	if (*largestFirst || *priorityDirs != "") && (len(m.dirs()) == 0 || *lowMemory || *resumePath != "") {
+		m.usageAndExit("-largest-first and -priority-dirs require <dir>, and may not be combined with -low-memory or -resume")
+	}
+	opts.AbsPaths = *absPaths
+	opts.RelPaths = *relPaths
+	opts.StatePath = *resumePath
+	opts.SpillDir = *spillDir
+	opts.Priority.LargestFirst = *largestFirst
+	if *priorityDirs != "" {
+		opts.Priority.Dirs = strings.Split(*priorityDirs, ",")
+	}
+}
+
+// setSkips sets the Options of skipFlags, exiting with a usage hint if they
+// are invalid.
+func (m *mode) setSkips(opts *dedup.Options) {
+	if *precount && len(m.dirs()) == 0 {
+		m.usageAndExit("-precount requires <dir>")
+	}
+	if *lowMemory && (len(m.dirs()) == 0 || *resumePath != "") {
+		m.usageAndExit("-low-memory requires <dir>, and may not be combined with -resume")
+	}
+	if *samplePercent < 0 || *samplePercent > 100 {
+		m.usageAndExit(fmt.Sprintf("invalid -sample: %g", *samplePercent))
+	}
+	if *samplePercent > 0 && (len(m.dirs()) == 0 || *match != "content" || *etags || *canonicalPath != "") {
+		m.usageAndExit("-sample requires <dir>, and may not be combined with -match other than content, -etags, or -canonical")
+	}
+	opts.Precount = *precount
+	opts.LowMemory = *lowMemory
+	opts.SamplePercent = *samplePercent
+}
+
+// setPrint sets the Options of printFlags, exiting with a usage hint if they
+// are invalid.
+func (m *mode) setPrint(opts *dedup.Options) {
+	if countTrue(*printUniq, *printDup, *printBrokenLinks) > 1 {
+		m.usageAndExit("only one may be provided: -u, -d, -broken-links")
+	}
+	if *outputBuffer < 0 {
+		m.usageAndExit("-output-buffer must not be negative")
+	}
+	if *outputDrop < 0 || *outputDrop > 100 || *outputDrop > 0 && *outputBuffer == 0 {
+		m.usageAndExit("-output-drop must be between 0 and 100, and requires -output-buffer")
+	}
+	opts.ExitOnDup = *exitOnDup
+	opts.OutputBuffer = *outputBuffer
+	opts.OutputDropPercent = *outputDrop
+	if *printUniq {
+		opts.UniqWriter = os.Stdout
+	} else if *printDup {
+		opts.DupWriter = os.Stdout
+	} else if *printBrokenLinks {
+		opts.BrokenLinkWriter = os.Stdout
+	}
+}
+
+// checkSafeMatch exits with a usage hint, naming what disposes of
+// duplicates, unless the files grouped by the match flags have the same
+// contents.
+func (m *mode) checkSafeMatch(what string) {
+	if *match != "content" || *etags || *normalizeText {
+		m.usageAndExit(what + " -match content, and may not be combined with -etags or -normalize-text")
+	}
+}
+
+// An evaluation is the files evaluated by a mode, and what stopped it early.
+type evaluation struct {
+	m      *mode
+	opts   *dedup.Options
+	sums   *dedup.Sums
+	err    error // Errors other than those that stop the evaluation early.
+	cancel chan struct{}
+	start  time.Time
+
+	overBudget   *dedup.BudgetExceededError
+	canceled     bool
+	pastDeadline bool
+}
+
+// evaluate evaluates the files of m with opts, by calling filter with the
+// roots of m, or by FilterPaths or Filter if nil, until interrupted, and
+// exits if no Sums are returned. The index named by -canonical is read first.
+func (m *mode) evaluate(opts *dedup.Options, filter func(dirs []string, opts *dedup.Options) (*dedup.Sums, error)) *evaluation {
+	if *canonicalPath != "" {
+		canonical, err := readIndex(*canonicalPath, *verifyKeyPath)
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitErrors)
+		}
+		opts.Canonical = canonical
+	}
+	e := &evaluation{m: m, opts: opts, cancel: make(chan struct{})}
+	go handleInterrupt(e.cancel)
+	opts.Cancel = e.cancel
+	opts.GracefulCancel = true
+	opts.Progress = dedup.NewProgress()
+	go handleStatus(opts.Progress)
+
+	e.start = time.Now()
+	if *timeout > 0 {
+		opts.Deadline = e.start.Add(*timeout)
+	}
+	var err error
+	switch dirs := m.dirs(); {
+	case filter != nil:
+		e.sums, err = filter(dirs, opts)
+	case len(dirs) > 0:
+		e.sums, err = dedup.FilterPaths(dirs, opts)
+	default:
+		e.sums, err = dedup.Filter(os.Stdin, opts)
+	}
+	if e.sums == nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+	// Exceeding -max-files, -max-bytes, or -timeout, or an interrupt, only
+	// stops the evaluation early.
+	e.overBudget, err = splitBudget(err)
+	e.canceled, err = splitSentinel(err, dedup.ErrCanceled)
+	e.pastDeadline, e.err = splitSentinel(err, dedup.ErrDeadlineExceeded)
+	return e
+}
+
+// fatal prints err to stderr, closes the Sums of e, and exits.
+func (e *evaluation) fatal(err error) {
+	_, _ = fmt.Fprintln(os.Stderr, err)
+	_ = e.sums.Close()
+	os.Exit(exitErrors)
+}
+
+// writeIndexes writes the files evaluated to the files named by -index and
+// -export-sqlite, if any.
+func (e *evaluation) writeIndexes() {
+	if *indexPath != "" {
+		if err := writeIndex(e.sums, *indexPath, *signKeyPath); err != nil {
+			e.fatal(err)
+		}
+	}
+	if *sqlitePath != "" {
+		if err := e.sums.WriteSQLiteFile(*sqlitePath); err != nil {
+			e.fatal(err)
+		}
+	}
+}
+
+// printEvaluated prints a summary of the files evaluated to stderr, unless
+// -quiet is specified, and the time taken with -timings.
+func (e *evaluation) printEvaluated() {
+	elapsed := time.Now().Sub(e.start)
+	result := e.sums.Stats()
+	if !*quiet {
+		_, _ = fmt.Fprintf(os.Stderr,
+			"Evaluated %d files (%s, %s read) and found %d duplicates (%s) in %v.\n",
+			result.NumFiles, humanSize(result.NumBytes), humanSize(result.BytesRead),
+			result.NumDupFiles, humanSize(result.NumDupBytes), elapsed)
+		if result.FilesSkipped > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Skipped reading %d files that were excluded, cached, or of unique size.\n",
+				result.FilesSkipped)
+		}
+		if result.ErrorsCount > 0 {
+			_, _ = fmt.Fprintf(os.Stderr, "Encountered %d errors.\n", result.ErrorsCount)
+		}
+		if linked := result.NumDupBytes - result.ReclaimableBytes; linked > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Duplicates include %s of hard links to other copies; %s could be reclaimed.\n",
+				humanSize(linked), humanSize(result.ReclaimableBytes))
+		}
+		if result.NumVanished > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Skipped %d files that vanished before they could be read.\n",
+				result.NumVanished)
+		}
+		if result.PermissionDenied > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Skipped %d files and directories that could not be read for lack of permission.\n",
+				result.PermissionDenied)
+		}
+		if result.OutputDropped > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Dropped %d paths that stdout could not take in time.\n",
+				result.OutputDropped)
+		}
+		if result.NumSpecial > 0 {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Skipped %d named pipes, sockets, and devices.\n",
+				result.NumSpecial)
+		}
+		if est, ok := e.sums.Estimate(); ok {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Estimated %s of duplicates (%s to %s at 95%% confidence) among %s in files that could have duplicates, from %d of %d sizes sampled.\n",
+				humanSize(est.DupBytes), humanSize(est.Low), humanSize(est.High),
+				humanSize(est.TotalBytes), est.SampledGroups, est.Groups)
+		}
+		if e.overBudget != nil {
+			_, _ = fmt.Fprintf(os.Stderr,
+				"Stopped after %d files (%s), as evaluating more would exceed -max-files or -max-bytes.\n",
+				e.overBudget.Files, humanSize(uint64(e.overBudget.Bytes)))
+		}
+		if e.pastDeadline {
+			_, _ = fmt.Fprintf(os.Stderr, "Stopped at the -timeout of %v.\n", *timeout)
+		}
+		if e.canceled {
+			_, _ = fmt.Fprintln(os.Stderr,
+				"Evaluation interrupted; results are partial.")
+		} else if e.sums.Partial() {
+			_, _ = fmt.Fprintln(os.Stderr,
+				"Evaluation stopped early; results are partial.")
+		}
+	}
+	if *printTimings {
+		_ = e.sums.WriteTimings(os.Stderr)
+	}
+}
+
+// printStats prints the statistics of the duplicates found to stderr with
+// -stats.
+func (e *evaluation) printStats() {
+	if *printStats {
+		writeGroupStats(os.Stderr, e.sums.GroupStats())
+		if dirs := e.m.set.Args(); len(dirs) > 1 {
+			writeRootStats(os.Stderr, e.sums.RootStats(dirs))
+		}
+	}
+}
+
+// exit closes the Sums of e and exits with the status of the evaluation,
+// including exitDups if dups is set and duplicates remain, printing it to
+// stderr with -summary.
+func (e *evaluation) exit(dups bool) {
+	result := e.sums.Stats()
+	status := exitOK
+	if dups && (result.NumDupFiles > 0 || e.opts.Canonical != nil && len(e.sums.Redundant(e.opts.Canonical)) > 0) {
+		status |= exitDups
+	}
+	err := e.err
+	if cerr := e.sums.Close(); cerr != nil {
+		_, _ = fmt.Fprintln(os.Stderr, cerr)
+		if err == nil {
+			err = dedup.Errors{cerr}
+		}
+	}
+	if err != nil {
+		status |= exitErrors
+	}
+	select {
+	case <-e.cancel:
+		status = exitInterrupted
+	default:
+	}
+	if *printSummary {
+		var numErrs int
+		if errs, ok := err.(dedup.Errors); ok {
+			numErrs = len(errs)
+		} else if err != nil {
+			numErrs = 1
+		}
+		_, _ = fmt.Fprintf(os.Stderr, "summary: files=%d bytes=%d dups=%d "+
+			"dup_bytes=%d vanished=%d errors=%d status=%d\n",
+			result.NumFiles, result.NumBytes, result.NumDupFiles,
+			result.NumDupBytes, result.NumVanished, numErrs, status)
+	}
+	os.Exit(status)
+}
+
+// runDefault runs dedup itself, printing the files evaluated as they are
+// with the print flags, and reporting or disposing of the duplicates found
+// once all have been with the report flags.
+func runDefault(m *mode) {
+	opts := m.options()
+	m.setScan(opts)
+	m.setSkips(opts)
+	m.setPrint(opts)
+	destructive := *deleteDups || *linkDups || *actionName != ""
+	if *printAllDup && *exitOnDup {
+		m.usageAndExit("only one may be provided: -b, -D")
+	}
+	if *printChunks < 0 || *printChunks > 100 {
+		m.usageAndExit("-chunks must be between 0 and 100")
+	}
+	if countTrue(*printUniq, *printDup, *printAllDup, *printBrokenLinks, *printVersions, *printConflicts, *printCaseCollisions, *printRedundant, *printChunks > 0, *dryRun) > 1 {
+		m.usageAndExit("only one may be provided: -u, -d, -D, -broken-links, -versions, -conflicts, -case-collisions, -redundant, -chunks, -dry-run")
+	}
+	if (*precount || *lowMemory || *samplePercent > 0) && *printUniq {
+		m.usageAndExit("-precount, -low-memory, and -sample may not be combined with -u")
+	}
+	if *resumePath != "" && *printChunks > 0 {
+		m.usageAndExit("-resume may not be combined with -chunks")
+	}
+	if *printCaseCollisions && len(m.dirs()) == 0 {
+		m.usageAndExit("-case-collisions requires <dir>")
+	}
+	if *printRedundant && *canonicalPath == "" {
+		m.usageAndExit("-redundant requires -canonical")
+	}
+	if *deleteDups && *linkDups || (*deleteDups || *linkDups) && *actionName != "" {
+		m.usageAndExit("only one may be provided: -delete, -link, -action")
+	}
+	if destructive && *exitOnDup {
+		m.usageAndExit("-delete, -link, and -action may not be combined with -b")
+	}
+	if destructive {
+		// Files grouped by other than their exact contents may differ.
+		m.checkSafeMatch("-delete, -link, and -action require")
+	}
+	if _, ok := dedup.LookupAction(*actionName); *actionName != "" && !ok {
+		m.usageAndExit("unknown -action: " + *actionName + "; registered: " + strings.Join(dedup.ActionNames(), ", "))
+	}
+	if (*quarantineDir != "" || *trash) && !*deleteDups {
+		m.usageAndExit("-quarantine and -trash require -delete")
+	}
+	if *quarantineDir != "" && *trash {
+		m.usageAndExit("only one may be provided: -quarantine, -trash")
+	}
+	if *dryRun && !*deleteDups && !*linkDups {
+		m.usageAndExit("-dry-run requires -delete or -link")
+	}
+	if *relPaths && (*deleteDups || *linkDups) && !*dryRun {
+		m.usageAndExit("-rel may not be combined with -delete or -link, except with -dry-run")
+	}
+	if _, ok := keepPolicies[*keepPolicy]; !ok {
+		m.usageAndExit("unknown -keep policy: " + *keepPolicy)
+	}
+	switch *format {
+	case "text", "json":
+	case "csv", "yaml", "fdupes", "template":
+		if *dryRun {
+			m.usageAndExit("-dry-run may not be combined with -format " + *format)
+		}
+	default:
+		m.usageAndExit("unknown -format: " + *format)
+	}
+	if *outputPath != "" && !*printAllDup {
+		m.usageAndExit("-output requires -D")
+	}
+	if *longReport && !*printAllDup {
+		m.usageAndExit("-long requires -D")
+	}
+	if *reportHeader && (!*printAllDup || *format != dedup.FormatJSON && *format != dedup.FormatCSV && *format != dedup.FormatYAML) {
+		m.usageAndExit("-report-header requires -D and -format json, csv, or yaml")
+	}
+	order, orderErr := dedup.ParseGroupOrder(*groupOrder)
+	if orderErr != nil {
+		m.usageAndExit("unknown -sort: " + *groupOrder)
+	}
+	if *groupOrder != "sum" && !*printAllDup {
+		m.usageAndExit("-sort requires -D")
+	}
+	if *format == "template" && (*outputPath != "" || *fileTemplate == "" && *groupTemplate == "") {
+		m.usageAndExit("-format template requires -template or -group-template, and may not be combined with -output")
+	}
+	if *format != "template" && (*fileTemplate != "" || *groupTemplate != "") {
+		m.usageAndExit("-template and -group-template require -format template")
+	}
+	fileTmpl, tmplErr := parseTemplate(*fileTemplate)
+	if tmplErr != nil {
+		m.usageAndExit("invalid -template: " + tmplErr.Error())
+	}
+	groupTmpl, tmplErr := parseTemplate(*groupTemplate)
+	if tmplErr != nil {
+		m.usageAndExit("invalid -group-template: " + tmplErr.Error())
+	}
+
+	opts.LongReport = *longReport
+	opts.ReportHeader = *reportHeader
+	opts.GroupOrder = order
+	opts.ChunkMode = *printChunks > 0
+	if *printCaseCollisions {
+		opts.CaseCollisions = dedup.NewCaseCollisions()
+	}
+
+	e := m.evaluate(opts, nil)
+	e.writeIndexes()
+	e.printEvaluated()
+	if e.err != nil {
+		e.exit(true)
+	}
+	e.printStats()
+	sums := e.sums
+	if *printAllDup {
+		if sums.Partial() {
+			_, _ = fmt.Fprintln(os.Stderr, "Partial summary of duplicate files:")
+		}
+		if *format == "template" {
+			if err := sums.WriteTemplate(os.Stdout, groupTmpl, fileTmpl); err != nil {
+				_, _ = fmt.Fprintln(os.Stderr, err)
+				e.err = dedup.Errors{err}
+			}
+		} else if *outputPath == "" {
+			_ = sums.WriteReport(os.Stdout, *format)
+		} else if err := sums.WriteAllDupToFile(*outputPath, *format); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			e.err = dedup.Errors{err}
+		}
+	}
+	if *printVersions {
+		_ = sums.WriteVersions(os.Stdout)
+	}
+	if *printConflicts {
+		_ = sums.WriteConflicts(os.Stdout)
+	}
+	if *printCaseCollisions {
+		_ = opts.CaseCollisions.WriteCollisions(os.Stdout)
+	}
+	if *printRedundant {
+		_ = sums.WriteRedundant(os.Stdout, opts.Canonical)
+	}
+	if *printChunks > 0 {
+		_ = sums.Chunks().WriteSimilar(os.Stdout, float64(*printChunks)/100)
+	}
+	if *deleteDups || *linkDups {
+		policy := dedup.Policy{Op: dedup.OpDelete, Keep: keepPolicies[*keepPolicy]}
+		if *linkDups {
+			policy.Op = dedup.OpLink
+		}
+		plan := sums.Plan(policy)
+		if *dryRun && *format == "json" {
+			_ = plan.WriteJSON(os.Stdout)
+		} else if *dryRun {
+			_ = plan.WriteText(os.Stdout)
+		} else if q, err := quarantine(*quarantineDir, *trash); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			e.err = dedup.Errors{err}
+		} else if err := applyPlan(plan, sums, q, *quiet); err != nil {
+			e.err = err
+		}
+	}
+	if *actionName != "" {
+		if err := applyAction(*actionName, sums, keepPolicies[*keepPolicy], *quiet); err != nil {
+			e.err = err
+		}
+	}
+	e.exit(true)
+}
+
+// runWatch runs the watch subcommand, evaluating the files in <dir>, then
+// those created, modified, or moved into it, until interrupted.
+func runWatch(m *mode) {
+	if m.set.NArg() != 1 {
+		m.usageAndExit("watch requires one <dir>")
+	}
+	opts := m.options()
+	m.setPrint(opts)
+	e := m.evaluate(opts, func(dirs []string, opts *dedup.Options) (*dedup.Sums, error) {
+		w := dedup.NewWatcher(dirs[0], opts)
+		err := w.Run()
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+		}
+		return w.Sums(), err
+	})
+	e.printEvaluated()
+	e.exit(true)
+}
+
+// runTUIMode runs the tui subcommand, presenting the duplicates found in the
+// terminal UI of runTUI.
+func runTUIMode(m *mode) {
+	opts := m.options()
+	m.setScan(opts)
+	m.setSkips(opts)
+	// The actions applied in the UI trust that files grouped have the same
+	// contents.
+	m.checkSafeMatch("tui requires")
+	e := m.evaluate(opts, nil)
+	e.writeIndexes()
+	e.printEvaluated()
+	if e.err != nil {
+		e.exit(true)
+	}
+	if err := runTUI(e.sums); err != nil {
+		e.fatal(err)
+	}
+	if !*quiet {
+		result := e.sums.Stats()
+		_, _ = fmt.Fprintf(os.Stderr, "%d duplicates (%s) remain.\n",
+			result.NumDupFiles, humanSize(result.NumDupBytes))
+	}
+	e.printStats()
+	e.exit(true)
+}
+
+// runHash runs the hash subcommand, printing the checksum of each file as it
+// is evaluated, as sha1sum does.
+func runHash(m *mode) {
+	opts := m.options()
+	m.setScan(opts)
+	opts.UniqSink = &hashSink{w: bufio.NewWriter(os.Stdout), digests: opts.Digests, next: opts.UniqSink}
+	opts.DupSink = opts.UniqSink
+	e := m.evaluate(opts, nil)
+	e.writeIndexes()
+	e.printEvaluated()
+	e.exit(false)
+}
+
+// runExport runs the export subcommand, writing every file evaluated to
+// stdout once all have been, for dedup merge to read.
+func runExport(m *mode) {
+	opts := m.options()
+	m.setScan(opts)
+	e := m.evaluate(opts, nil)
+	e.writeIndexes()
+	if err := writeExport(e.sums, *exportHost); err != nil {
+		e.fatal(err)
+	}
+	e.printEvaluated()
+	e.exit(false)
+}
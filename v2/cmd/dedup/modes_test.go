@@ -0,0 +1,33 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"testing"
+)
+
+func TestModeFlags(t *testing.T) {
+	accepted := make(map[string]bool)
+	all := []*mode{defaultMode}
+	for _, m := range modes {
+		all = append(all, m)
+	}
+	for _, m := range all {
+		seen := make(map[string]bool)
+		for _, names := range [][]string{evalFlags, m.flags} {
+			for _, name := range names {
+				if flag.Lookup(name) == nil {
+					t.Errorf("mode %q: unknown flag -%s", m.name, name)
+				} else if seen[name] {
+					t.Errorf("mode %q: flag -%s listed twice", m.name, name)
+				}
+				seen[name], accepted[name] = true, true
+			}
+		}
+	}
+	flag.VisitAll(func(f *flag.Flag) {
+		if !accepted[f.Name] && !strings.HasPrefix(f.Name, "test.") {
+			t.Errorf("flag -%s is accepted by no mode", f.Name)
+		}
+	})
+}
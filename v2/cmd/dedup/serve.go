@@ -0,0 +1,518 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// serve runs the serve subcommand with args, serving the HTTP API until it
+// fails.
+func serve(args []string) {
+	flags := flag.NewFlagSet("serve", flag.ExitOnError)
+	addr := flags.String("addr", "localhost:8080", "Listen on `address`.")
+	metrics := flags.Bool("metrics", false, "Export counts of the work "+
+		"done by every scan in the Prometheus text format on GET /metrics.")
+	token := flags.String("token", "", "Require requests to carry "+
+		"`token` as a bearer token; $DEDUP_TOKEN if empty, or a random "+
+		"token printed at startup if that is empty too.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup serve [-addr <address>] [-metrics] [-token <token>]\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() > 0 {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+	if *token == "" {
+		*token = os.Getenv("DEDUP_TOKEN")
+	}
+	if *token == "" {
+		b := make([]byte, 16)
+		if _, err := rand.Read(b); err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitErrors)
+		}
+		*token = hex.EncodeToString(b)
+		_, _ = fmt.Fprintf(os.Stderr, "Token: %s\n", *token)
+	}
+
+	_, _ = fmt.Fprintf(os.Stderr, "Listening on %s\n", *addr)
+	s := newServer(*addr, *token)
+	if *metrics {
+		s.counters = dedup.NewCounters()
+	}
+	if err := http.ListenAndServe(*addr, s); err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+}
+
+// server is the http.Handler of the HTTP API:
+//
+//	POST   /scans              start a scan of the directory in the request
+//	GET    /scans              list scans
+//	GET    /scans/{id}         report the progress of a scan
+//	DELETE /scans/{id}         cancel a scan and forget it
+//	GET    /scans/{id}/events  stream progress reports until a scan stops
+//	GET    /scans/{id}/groups  list the duplicate groups found by a scan
+//	POST   /scans/{id}/actions delete or link duplicates found by a scan
+//	GET    /metrics            export counts of the work done by every scan, if counters is set
+//
+// Since the API may delete files, every request must carry the token of the
+// server as a bearer token, and requests that a web page may have sent
+// instead are refused: those whose Host is not the address listened on,
+// which would have been resolved by DNS rebinding, those from another
+// Origin, and POST requests whose body is not application/json.
+type server struct {
+	hosts    map[string]bool // Host headers accepted; any if nil.
+	token    string
+	mu       sync.Mutex
+	scans    map[string]*scan
+	nextID   int
+	counters *dedup.Counters // Counts of every scan, for /metrics.
+}
+
+// newServer returns a server listening on addr, which requires token.
+func newServer(addr, token string) *server {
+	return &server{hosts: listenHosts(addr), token: token, scans: make(map[string]*scan)}
+}
+
+// listenHosts returns the Host headers naming addr, or nil if addr listens
+// on every interface, whose names are not known. The loopback interface is
+// named by localhost, 127.0.0.1, and [::1] alike.
+func listenHosts(addr string) map[string]bool {
+	host, port, err := net.SplitHostPort(addr)
+	if err != nil {
+		return map[string]bool{strings.ToLower(addr): true}
+	}
+	if ip := net.ParseIP(host); host == "" || ip != nil && ip.IsUnspecified() {
+		return nil
+	}
+	hosts := map[string]bool{strings.ToLower(addr): true}
+	if ip := net.ParseIP(host); strings.EqualFold(host, "localhost") || ip != nil && ip.IsLoopback() {
+		for _, h := range []string{"localhost", "127.0.0.1", "::1"} {
+			hosts[net.JoinHostPort(h, port)] = true
+		}
+	}
+	return hosts
+}
+
+// allowed reports whether r may be served, writing an error to w if not.
+func (s *server) allowed(w http.ResponseWriter, r *http.Request) bool {
+	host := strings.ToLower(r.Host)
+	if s.hosts != nil && !s.hosts[host] {
+		writeError(w, http.StatusForbidden, "unexpected host: "+r.Host)
+		return false
+	}
+	if origin := r.Header.Get("Origin"); origin != "" {
+		u, err := url.Parse(origin)
+		if err != nil || u.Scheme != "http" || strings.ToLower(u.Host) != host {
+			writeError(w, http.StatusForbidden, "cross-origin requests are not allowed")
+			return false
+		}
+	}
+	auth := r.Header.Get("Authorization")
+	if !strings.HasPrefix(auth, "Bearer ") ||
+		subtle.ConstantTimeCompare([]byte(auth[len("Bearer "):]), []byte(s.token)) != 1 {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeError(w, http.StatusUnauthorized, "missing or invalid token")
+		return false
+	}
+	if r.Method == http.MethodPost {
+		if typ, _, err := mime.ParseMediaType(r.Header.Get("Content-Type")); err != nil || typ != "application/json" {
+			writeError(w, http.StatusUnsupportedMediaType, "body must be application/json")
+			return false
+		}
+	}
+	return true
+}
+
+// scanRequest is the body of a request to start a scan.
+type scanRequest struct {
+	Dir              string `json:"dir"`
+	Recursive        bool   `json:"recursive"`
+	MaxDepth         int    `json:"maxDepth"`
+	OneFileSystem    bool   `json:"oneFileSystem"`
+	FollowSymlinks   bool   `json:"followSymlinks"`
+	FollowWithinRoot bool   `json:"followWithinRoot"`
+	Archives         bool   `json:"archives"`
+}
+
+// scan is a scan started by a request, which progresses in the background.
+type scan struct {
+	id     string
+	dir    string
+	start  time.Time
+	cancel chan struct{}
+	once   sync.Once // Close cancel.
+	done   chan struct{}
+
+	progress *dedup.Progress
+
+	mu    sync.Mutex
+	state string // "running", "done", "canceled", or "failed".
+	end   time.Time
+	errs  []string
+	sums  *dedup.Sums // Set once done.
+}
+
+// scanStatus is the JSON representation of a scan.
+type scanStatus struct {
+	ID          string   `json:"id"`
+	Dir         string   `json:"dir"`
+	State       string   `json:"state"`
+	Started     string   `json:"started"`
+	Elapsed     string   `json:"elapsed"`
+	Files       uint64   `json:"files"`
+	Bytes       uint64   `json:"bytes"`
+	DupFiles    uint64   `json:"dupFiles"`
+	DupBytes    uint64   `json:"dupBytes"`
+	Reclaimable uint64   `json:"reclaimable"`
+	FilesPerSec float64  `json:"filesPerSec"`
+	BytesPerSec float64  `json:"bytesPerSec"`
+	Vanished    uint64   `json:"vanished"`
+	Special     uint64   `json:"special"`
+	Errors      []string `json:"errors"`
+}
+
+// group is the JSON representation of files that share a checksum.
+type group struct {
+	Sum   string   `json:"sum"`
+	Size  int64    `json:"size"`
+	Files []string `json:"files"` // Sorted.
+}
+
+// actionRequest is the body of a request to dispose of duplicates of keep.
+type actionRequest struct {
+	Action string   `json:"action"` // "delete" or "link".
+	Sum    string   `json:"sum"`
+	Keep   string   `json:"keep"`
+	Files  []string `json:"files"`
+}
+
+// actionResult reports the outcome of an action on one of the files.
+type actionResult struct {
+	Path  string `json:"path"`
+	Error string `json:"error,omitempty"`
+}
+
+func (s *server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !s.allowed(w, r) {
+		return
+	}
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	if len(parts) == 1 && parts[0] == "metrics" && s.counters != nil {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_ = s.counters.WritePrometheus(w)
+		return
+	}
+	if parts[0] != "scans" || len(parts) > 3 {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+	if len(parts) == 1 {
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w)
+		case http.MethodPost:
+			s.start(w, r)
+		default:
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+		return
+	}
+
+	s.mu.Lock()
+	sc, ok := s.scans[parts[1]]
+	s.mu.Unlock()
+	if !ok {
+		writeError(w, http.StatusNotFound, "no such scan: "+parts[1])
+		return
+	}
+
+	var route string
+	if len(parts) == 3 {
+		route = parts[2]
+	}
+	switch {
+	case route == "" && r.Method == http.MethodGet:
+		writeJSON(w, http.StatusOK, sc.status())
+	case route == "" && r.Method == http.MethodDelete:
+		sc.stop()
+		<-sc.done
+		s.mu.Lock()
+		delete(s.scans, sc.id)
+		s.mu.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	case route == "events" && r.Method == http.MethodGet:
+		sc.stream(w, r)
+	case route == "groups" && r.Method == http.MethodGet:
+		sc.groups(w)
+	case route == "actions" && r.Method == http.MethodPost:
+		sc.act(w, r)
+	case route == "" || route == "events" || route == "groups" || route == "actions":
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+	default:
+		writeError(w, http.StatusNotFound, "not found")
+	}
+}
+
+func (s *server) list(w http.ResponseWriter) {
+	s.mu.Lock()
+	statuses := make([]scanStatus, 0, len(s.scans))
+	for _, sc := range s.scans {
+		statuses = append(statuses, sc.status())
+	}
+	s.mu.Unlock()
+
+	sort.Slice(statuses, func(i, j int) bool {
+		a, _ := strconv.Atoi(statuses[i].ID)
+		b, _ := strconv.Atoi(statuses[j].ID)
+		return a < b
+	})
+	writeJSON(w, http.StatusOK, statuses)
+}
+
+func (s *server) start(w http.ResponseWriter, r *http.Request) {
+	var req scanRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Dir == "" {
+		writeError(w, http.StatusBadRequest, "dir is required")
+		return
+	}
+	if req.MaxDepth < 0 {
+		writeError(w, http.StatusBadRequest, "maxDepth must not be negative")
+		return
+	}
+
+	s.mu.Lock()
+	s.nextID++
+	sc := &scan{
+		id:       strconv.Itoa(s.nextID),
+		dir:      req.Dir,
+		start:    time.Now(),
+		cancel:   make(chan struct{}),
+		done:     make(chan struct{}),
+		progress: dedup.NewProgress(),
+		state:    "running",
+	}
+	s.scans[sc.id] = sc
+	s.mu.Unlock()
+
+	opts := new(dedup.Options)
+	opts.Recursive = req.Recursive
+	opts.MaxDepth = req.MaxDepth
+	opts.OneFileSystem = req.OneFileSystem
+	opts.FollowSymlinks = req.FollowSymlinks
+	opts.FollowWithinRoot = req.FollowWithinRoot
+	opts.Archives = req.Archives
+	opts.Cancel = sc.cancel
+	opts.Progress = sc.progress
+	opts.ErrWriter = errWriter{sc}
+	if s.counters != nil {
+		opts.Metrics = s.counters
+	}
+	go sc.run(opts)
+
+	writeJSON(w, http.StatusCreated, sc.status())
+}
+
+func (sc *scan) run(opts *dedup.Options) {
+	defer close(sc.done)
+	sums, err := dedup.FilterDir(sc.dir, opts)
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+	sc.sums = sums
+	sc.end = time.Now()
+	select {
+	case <-sc.cancel:
+		sc.state = "canceled"
+		return
+	default:
+	}
+	if sums == nil && err != nil {
+		sc.state = "failed"
+		sc.errs = append(sc.errs, err.Error())
+	} else {
+		sc.state = "done"
+	}
+}
+
+// stop cancels sc if it is running.
+func (sc *scan) stop() {
+	sc.once.Do(func() { close(sc.cancel) })
+}
+
+func (sc *scan) status() scanStatus {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	snap := sc.progress.StatsSnapshot()
+	st := snap.Stats
+	if sc.sums != nil {
+		st = sc.sums.Stats()
+	}
+	end := sc.end
+	if end.IsZero() {
+		end = time.Now()
+	}
+	return scanStatus{
+		ID:          sc.id,
+		Dir:         sc.dir,
+		State:       sc.state,
+		Started:     sc.start.Format(time.RFC3339),
+		Elapsed:     end.Sub(sc.start).Round(time.Millisecond).String(),
+		Files:       st.NumFiles,
+		Bytes:       st.NumBytes,
+		DupFiles:    st.NumDupFiles,
+		DupBytes:    st.NumDupBytes,
+		Reclaimable: st.ReclaimableBytes,
+		FilesPerSec: snap.FilesPerSec,
+		BytesPerSec: snap.BytesPerSec,
+		Vanished:    st.NumVanished,
+		Special:     st.NumSpecial,
+		Errors:      append([]string{}, sc.errs...),
+	}
+}
+
+// streamInterval is how often progress is reported by the events endpoint.
+const streamInterval = 500 * time.Millisecond
+
+// stream writes the status of sc as newline-delimited JSON to w whenever it
+// changes, until sc stops or the client goes away.
+func (sc *scan) stream(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/x-ndjson")
+	flusher, _ := w.(http.Flusher)
+	enc := json.NewEncoder(w)
+	ticker := time.NewTicker(streamInterval)
+	defer ticker.Stop()
+
+	var last scanStatus
+	for {
+		st := sc.status()
+		if st.State != "running" || st.Files != last.Files || len(st.Errors) != len(last.Errors) || last.ID == "" {
+			if err := enc.Encode(st); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+			last = st
+		}
+		if st.State != "running" {
+			return
+		}
+		select {
+		case <-r.Context().Done():
+			return
+		case <-sc.done:
+		case <-ticker.C:
+		}
+	}
+}
+
+// finished returns the Sums of sc, writing an error to w and returning nil if
+// sc is still running.
+func (sc *scan) finished(w http.ResponseWriter) *dedup.Sums {
+	sc.mu.Lock()
+	sums := sc.sums
+	sc.mu.Unlock()
+	if sums == nil {
+		writeError(w, http.StatusConflict, "scan is still running")
+	}
+	return sums
+}
+
+func (sc *scan) groups(w http.ResponseWriter) {
+	sums := sc.finished(w)
+	if sums == nil {
+		return
+	}
+	groups := []group{}
+	for _, dg := range sums.DupGroups() {
+		g := group{Sum: fmt.Sprintf("%x", dg.Sum), Size: dg.Files[0].Info.Size()}
+		for _, file := range dg.Files {
+			g.Files = append(g.Files, file.Path)
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Files[0] < groups[j].Files[0] })
+	writeJSON(w, http.StatusOK, groups)
+}
+
+func (sc *scan) act(w http.ResponseWriter, r *http.Request) {
+	sums := sc.finished(w)
+	if sums == nil {
+		return
+	}
+	var req actionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	act, ok := actions[req.Action]
+	if !ok {
+		writeError(w, http.StatusBadRequest, "unknown action: "+req.Action)
+		return
+	}
+	sum, err := hex.DecodeString(req.Sum)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid sum: "+err.Error())
+		return
+	}
+
+	results := make([]actionResult, len(req.Files))
+	for i, path := range req.Files {
+		results[i].Path = path
+		if err := act(sums, dedup.Digest(sum), req.Keep, path); err != nil {
+			results[i].Error = err.Error()
+		}
+	}
+	writeJSON(w, http.StatusOK, results)
+}
+
+// errWriter is an io.Writer that records the errors of a scan, one per write.
+type errWriter struct{ sc *scan }
+
+func (e errWriter) Write(b []byte) (int, error) {
+	e.sc.mu.Lock()
+	defer e.sc.mu.Unlock()
+
+	e.sc.errs = append(e.sc.errs, strings.TrimSuffix(string(b), "\n"))
+	return len(b), nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
+
+func writeError(w http.ResponseWriter, code int, msg string) {
+	writeJSON(w, code, map[string]string{"error": msg})
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+func TestServeRefusesForeignRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	s := newServer("localhost:8080", "secret")
+	body := `{"dir": "` + strings.ReplaceAll(dir, `\`, `\\`) + `"}`
+
+	for _, tc := range []struct {
+		name    string
+		host    string
+		headers map[string]string
+		want    int
+	}{
+		{"authorized", "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json"}, http.StatusCreated},
+		{"loopback address", "127.0.0.1:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json; charset=utf-8"}, http.StatusCreated},
+		{"no token", "localhost:8080", map[string]string{"Content-Type": "application/json"}, http.StatusUnauthorized},
+		{"wrong token", "localhost:8080", map[string]string{"Authorization": "Bearer guess", "Content-Type": "application/json"}, http.StatusUnauthorized},
+		{"text body", "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "text/plain"}, http.StatusUnsupportedMediaType},
+		{"no content type", "localhost:8080", map[string]string{"Authorization": "Bearer secret"}, http.StatusUnsupportedMediaType},
+		{"foreign origin", "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json", "Origin": "http://evil.example"}, http.StatusForbidden},
+		{"null origin", "localhost:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json", "Origin": "null"}, http.StatusForbidden},
+		{"rebound host", "evil.example:8080", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json"}, http.StatusForbidden},
+		{"other port", "localhost:9090", map[string]string{"Authorization": "Bearer secret", "Content-Type": "application/json"}, http.StatusForbidden},
+	} {
+		req := httptest.NewRequest(http.MethodPost, "http://"+tc.host+"/scans", strings.NewReader(body))
+		for k, v := range tc.headers {
+			req.Header.Set(k, v)
+		}
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, req)
+		if w.Code != tc.want {
+			t.Errorf("%s: POST /scans = %d %s; want %d", tc.name, w.Code, w.Body, tc.want)
+		}
+	}
+	s.mu.Lock()
+	n := len(s.scans)
+	s.mu.Unlock()
+	if n != 2 {
+		t.Errorf("%d scans started; want 2", n)
+	}
+
+	// Reading is refused without the token as well.
+	req := httptest.NewRequest(http.MethodGet, "http://localhost:8080/scans", nil)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, req)
+	if w.Code != http.StatusUnauthorized || w.Header().Get("WWW-Authenticate") != "Bearer" {
+		t.Errorf("GET /scans = %d %v; want 401 with WWW-Authenticate", w.Code, w.Header())
+	}
+	for _, sc := range s.scans {
+		<-sc.done
+	}
+}
+
+func TestListenHosts(t *testing.T) {
+	for addr, want := range map[string][]string{
+		"localhost:8080": {"localhost:8080", "127.0.0.1:8080", "[::1]:8080"},
+		"192.168.1.2:80": {"192.168.1.2:80"},
+		"nas.lan:8080":   {"nas.lan:8080"},
+		":8080":          nil,
+		"0.0.0.0:8080":   nil,
+	} {
+		hosts := listenHosts(addr)
+		if len(hosts) != len(want) || want == nil && hosts != nil {
+			t.Errorf("listenHosts(%q) = %v; want %v", addr, hosts, want)
+			continue
+		}
+		for _, h := range want {
+			if !hosts[h] {
+				t.Errorf("listenHosts(%q) = %v; want %v", addr, hosts, want)
+			}
+		}
+	}
+}
@@ -0,0 +1,12 @@
+//go:build darwin || dragonfly || freebsd || netbsd || openbsd
+// +build darwin dragonfly freebsd netbsd openbsd
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals are the signals that make dedup print its status.
+var statusSignals = []os.Signal{syscall.SIGINFO, syscall.SIGUSR1}
@@ -0,0 +1,10 @@
+//go:build !aix && !android && !darwin && !dragonfly && !freebsd && !illumos && !linux && !netbsd && !openbsd && !solaris
+// +build !aix,!android,!darwin,!dragonfly,!freebsd,!illumos,!linux,!netbsd,!openbsd,!solaris
+
+package main
+
+import "os"
+
+// statusSignals are the signals that make dedup print its status: none, as
+// there is no SIGUSR1 on Windows, Plan 9, or js/wasm.
+var statusSignals []os.Signal
@@ -0,0 +1,12 @@
+//go:build aix || android || illumos || linux || solaris
+// +build aix android illumos linux solaris
+
+package main
+
+import (
+	"os"
+	"syscall"
+)
+
+// statusSignals are the signals that make dedup print its status.
+var statusSignals = []os.Signal{syscall.SIGUSR1}
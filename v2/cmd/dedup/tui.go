@@ -0,0 +1,327 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// mark is what to do with a file reviewed in the TUI.
+type mark byte
+
+const (
+	unmarked mark = ' '
+	keepMark mark = 'K' // Keep the file, as the copy that others are linked to.
+	dropMark mark = 'D' // Delete the file.
+	linkMark mark = 'L' // Replace the file with a hard link to the kept copy.
+)
+
+// markActions maps marks to the actions applied to the files they mark.
+var markActions = map[mark]string{dropMark: "delete", linkMark: "link"}
+
+// tuiGroup is a group of duplicate files reviewed in the TUI.
+type tuiGroup struct {
+	sum   dedup.Digest
+	size  int64
+	files []string // Sorted.
+	marks []mark
+}
+
+// tui is an interactive terminal UI for reviewing the duplicate groups of
+// sums, marking files to keep, delete, or link, and applying those actions.
+type tui struct {
+	sums   *dedup.Sums
+	groups []tuiGroup
+	g, f   int // Selected group and file.
+	height int // Lines available on the terminal.
+	status string
+	in     *bufio.Reader
+	out    *bufio.Writer
+}
+
+const tuiHelp = "j/k: file  n/p: group  space: keep  d: delete  l: link  " +
+	"u: unmark  a: apply  q: quit"
+
+// runTUI runs the TUI for sums on the terminal until the user quits.
+func runTUI(sums *dedup.Sums) error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+
+	state, err := stty(tty, "-g")
+	if err != nil {
+		return fmt.Errorf("tui requires a terminal: %v", err)
+	}
+	if _, err := stty(tty, "raw", "-echo"); err != nil {
+		return err
+	}
+	defer func() { _, _ = stty(tty, strings.TrimSpace(state)) }()
+
+	t := &tui{sums: sums, height: 24, in: bufio.NewReader(tty), out: bufio.NewWriter(tty)}
+	if size, err := stty(tty, "size"); err == nil {
+		if fields := strings.Fields(size); len(fields) == 2 {
+			if n, err := strconv.Atoi(fields[0]); err == nil && n > 0 {
+				t.height = n
+			}
+		}
+	}
+	t.load()
+
+	_, _ = t.out.WriteString("\x1b[?1049h\x1b[?25l") // Alternate screen; hide cursor.
+	defer func() {
+		_, _ = t.out.WriteString("\x1b[?25h\x1b[?1049l")
+		_ = t.out.Flush()
+	}()
+	return t.loop()
+}
+
+// stty runs stty with args on tty and returns its output.
+func stty(tty *os.File, args ...string) (string, error) {
+	cmd := exec.Command("stty", args...)
+	cmd.Stdin = tty
+	out, err := cmd.Output()
+	return string(out), err
+}
+
+// load reads the duplicate groups of t.sums, keeping the marks of files that
+// remain.
+func (t *tui) load() {
+	marks := make(map[string]mark)
+	for _, g := range t.groups {
+		for i, path := range g.files {
+			marks[path] = g.marks[i]
+		}
+	}
+
+	t.groups = t.groups[:0]
+	for _, dg := range t.sums.DupGroups() {
+		g := tuiGroup{sum: dg.Sum, size: dg.Files[0].Info.Size()}
+		for _, file := range dg.Files {
+			g.files = append(g.files, file.Path)
+		}
+		g.marks = make([]mark, len(g.files))
+		for i, path := range g.files {
+			if m, ok := marks[path]; ok {
+				g.marks[i] = m
+			} else {
+				g.marks[i] = unmarked
+			}
+		}
+		t.groups = append(t.groups, g)
+	}
+	sort.Slice(t.groups, func(i, j int) bool { return t.groups[i].files[0] < t.groups[j].files[0] })
+
+	if t.g >= len(t.groups) {
+		t.g = len(t.groups) - 1
+	}
+	if t.g < 0 {
+		t.g = 0
+	}
+	t.f = 0
+}
+
+func (t *tui) loop() error {
+	for {
+		t.draw()
+		if err := t.out.Flush(); err != nil {
+			return err
+		}
+		key, err := t.readKey()
+		if err != nil {
+			return err
+		}
+		t.status = ""
+		switch key {
+		case "q", "\x03": // Ctrl-C is not delivered as a signal in raw mode.
+			return nil
+		case "j", "down":
+			t.move(0, 1)
+		case "k", "up":
+			t.move(0, -1)
+		case "n", "right":
+			t.move(1, 0)
+		case "p", "left":
+			t.move(-1, 0)
+		case " ":
+			t.mark(keepMark)
+		case "d":
+			t.mark(dropMark)
+		case "l":
+			t.mark(linkMark)
+		case "u":
+			t.mark(unmarked)
+		case "a":
+			t.confirmApply()
+		default:
+			t.status = tuiHelp
+		}
+	}
+}
+
+// readKey reads a key press, naming arrow keys "up", "down", "right", and
+// "left".
+func (t *tui) readKey() (string, error) {
+	b, err := t.in.ReadByte()
+	if err != nil {
+		return "", err
+	}
+	if b != '\x1b' || t.in.Buffered() < 2 {
+		return string(b), nil
+	}
+	seq := make([]byte, 2)
+	if _, err := io.ReadFull(t.in, seq); err != nil {
+		return "", err
+	}
+	switch string(seq) {
+	case "[A":
+		return "up", nil
+	case "[B":
+		return "down", nil
+	case "[C":
+		return "right", nil
+	case "[D":
+		return "left", nil
+	}
+	return "", nil
+}
+
+// move moves the selection by dg groups and df files.
+func (t *tui) move(dg, df int) {
+	if len(t.groups) == 0 {
+		return
+	}
+	if dg != 0 {
+		t.g = (t.g + dg + len(t.groups)) % len(t.groups)
+		t.f = 0
+	}
+	if n := len(t.groups[t.g].files); df != 0 {
+		t.f = (t.f + df + n) % n
+	}
+}
+
+// mark marks the selected file with m. Only one file per group is kept.
+func (t *tui) mark(m mark) {
+	if len(t.groups) == 0 {
+		return
+	}
+	g := &t.groups[t.g]
+	if m == keepMark {
+		for i := range g.marks {
+			if g.marks[i] == keepMark {
+				g.marks[i] = unmarked
+			}
+		}
+	}
+	g.marks[t.f] = m
+	t.move(0, 1)
+}
+
+// confirmApply asks the user to confirm applying the actions marked in all
+// groups, then applies them.
+func (t *tui) confirmApply() {
+	n := 0
+	for _, g := range t.groups {
+		for _, m := range g.marks {
+			if _, ok := markActions[m]; ok {
+				n++
+			}
+		}
+	}
+	if n == 0 {
+		t.status = "No files are marked for deletion or linking."
+		return
+	}
+	t.status = fmt.Sprintf("Apply %d actions? (y/n)", n)
+	t.draw()
+	_ = t.out.Flush()
+	if key, err := t.readKey(); err != nil || key != "y" {
+		t.status = "Canceled."
+		return
+	}
+	t.status = t.apply()
+	t.load()
+}
+
+// apply applies the actions marked in all groups and returns a summary.
+func (t *tui) apply() string {
+	var done int
+	var errs []string
+	for gi := range t.groups {
+		g := &t.groups[gi]
+		keep := ""
+		for i, m := range g.marks {
+			if m == keepMark {
+				keep = g.files[i]
+			}
+		}
+		for i, m := range g.marks {
+			name, ok := markActions[m]
+			if !ok {
+				continue
+			}
+			err := errors.New("no file is marked to keep")
+			if keep != "" {
+				err = actions[name](t.sums, g.sum, keep, g.files[i])
+			}
+			if err != nil {
+				errs = append(errs, fmt.Sprintf("%s: %v", g.files[i], err))
+				continue
+			}
+			g.marks[i] = unmarked
+			done++
+		}
+	}
+	if len(errs) > 0 {
+		return fmt.Sprintf("Applied %d actions; %d failed: %s", done, len(errs), strings.Join(errs, "; "))
+	}
+	return fmt.Sprintf("Applied %d actions.", done)
+}
+
+func (t *tui) draw() {
+	w := t.out
+	_, _ = w.WriteString("\x1b[H\x1b[2J")
+	line := func(format string, args ...interface{}) {
+		_, _ = fmt.Fprintf(w, format+"\x1b[K\r\n", args...)
+	}
+
+	if len(t.groups) == 0 {
+		line("No duplicate files remain. Press q to quit.")
+	} else {
+		g := t.groups[t.g]
+		line("Group %d of %d: %x (%s each)", t.g+1, len(t.groups), g.sum, humanSize(uint64(g.size)))
+		line("")
+		// Scroll so that the selected file is visible, leaving room for the
+		// header and status lines.
+		rows := t.height - 5
+		if rows < 1 {
+			rows = 1
+		}
+		first := 0
+		if t.f >= rows {
+			first = t.f - rows + 1
+		}
+		for i := first; i < len(g.files) && i < first+rows; i++ {
+			cursor := " "
+			if i == t.f {
+				cursor = ">"
+			}
+			line("%s [%c] %s", cursor, g.marks[i], g.files[i])
+		}
+	}
+	line("")
+	if t.status != "" {
+		line("%s", t.status)
+	} else {
+		line("%s", tuiHelp)
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+// verify runs the verify subcommand with args, verifying the files listed in
+// a manifest against their checksums.
+func verify(args []string) {
+	flags := flag.NewFlagSet("verify", flag.ExitOnError)
+	quietOK := flags.Bool("quiet", false, "Do not print files that match "+
+		"their checksums.")
+	readRetries := flags.Int("read-retries", 0, "Retry reading a file up to "+
+		"`N` times if an I/O error occurs, as -read-retries does.")
+	flags.Usage = func() {
+		_, _ = fmt.Fprintf(os.Stderr, "usage: dedup verify [-quiet] [-read-retries N] <manifest>|-\n")
+		flags.PrintDefaults()
+	}
+	_ = flags.Parse(args)
+	if flags.NArg() != 1 || *readRetries < 0 {
+		flags.Usage()
+		os.Exit(exitErrors)
+	}
+
+	var r io.ReadCloser = os.Stdin
+	if flags.Arg(0) != "-" {
+		f, err := os.Open(flags.Arg(0))
+		if err != nil {
+			_, _ = fmt.Fprintln(os.Stderr, err)
+			os.Exit(exitErrors)
+		}
+		r = f
+	}
+	cancel := make(chan struct{})
+	go handleInterrupt(cancel)
+	results, err := dedup.Verify(r, &dedup.Options{
+		ReadRetries:    *readRetries,
+		Cancel:         cancel,
+		GracefulCancel: true,
+	})
+	_ = r.Close()
+	if err != nil {
+		_, _ = fmt.Fprintln(os.Stderr, err)
+		os.Exit(exitErrors)
+	}
+
+	status := exitOK
+	for _, res := range results {
+		switch res.Status {
+		case dedup.VerifyOK:
+			if !*quietOK {
+				fmt.Printf("%s: OK\n", res.Path)
+			}
+		case dedup.VerifyMismatch:
+			fmt.Printf("%s: MISMATCH\n", res.Path)
+			status |= exitDups
+		case dedup.VerifyMissing:
+			fmt.Printf("%s: MISSING\n", res.Path)
+			status |= exitDups
+		default:
+			fmt.Printf("%s: FAILED\n", res.Path)
+			_, _ = fmt.Fprintln(os.Stderr, res.Err)
+			status |= exitErrors
+		}
+	}
+	select {
+	case <-cancel:
+		status = exitInterrupted
+	default:
+	}
+	os.Exit(status)
+}
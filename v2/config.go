@@ -0,0 +1,361 @@
+package dedup
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ConfigSetting is a setting read from a configuration file by ReadConfig.
+type ConfigSetting struct {
+	Key   string
+	Value string // Arrays are joined by commas.
+	Line  int
+}
+
+// ReadConfig reads a configuration file in a subset of TOML from r, such as
+//
+//	# Defaults for evaluating backups.
+//	recursive = true
+//	exclude-regex = "/(node_modules|\\.git)/"
+//	digests = ["sha256"]
+//	read-retries = 2
+//
+// and returns its settings in order. Each non-blank line that is not a
+// comment sets a key to a string, quoted as in TOML, a boolean, a number, or
+// an array of strings on a single line. Tables are not supported.
+func ReadConfig(r io.Reader) ([]ConfigSetting, error) {
+	var settings []ConfigSetting
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || line[0] == '#' {
+			continue
+		}
+		i := strings.Index(line, "=")
+		if i < 0 {
+			return nil, fmt.Errorf("dedup: reading config: line %d: missing =", n)
+		}
+		key := strings.TrimSpace(line[:i])
+		if key == "" || strings.ContainsAny(key, " \t\"'[]") {
+			return nil, fmt.Errorf("dedup: reading config: line %d: invalid key %q", n, key)
+		}
+		value, err := configValue(strings.TrimSpace(line[i+1:]))
+		if err != nil {
+			return nil, fmt.Errorf("dedup: reading config: line %d: %v", n, err)
+		}
+		settings = append(settings, ConfigSetting{Key: key, Value: value, Line: n})
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("dedup: reading config: %w", err)
+	}
+	return settings, nil
+}
+
+// configValue parses the value s of a setting, followed by an optional
+// comment.
+func configValue(s string) (string, error) {
+	if strings.HasPrefix(s, "[") {
+		var elems []string
+		s = strings.TrimSpace(s[1:])
+		for !strings.HasPrefix(s, "]") {
+			elem, rest, err := configString(s)
+			if err != nil {
+				return "", err
+			}
+			elems = append(elems, elem)
+			s = strings.TrimSpace(rest)
+			if strings.HasPrefix(s, ",") {
+				s = strings.TrimSpace(s[1:])
+			} else if !strings.HasPrefix(s, "]") {
+				return "", fmt.Errorf("invalid array")
+			}
+		}
+		return strings.Join(elems, ","), configComment(s[1:])
+	}
+	if strings.HasPrefix(s, `"`) || strings.HasPrefix(s, "'") {
+		value, rest, err := configString(s)
+		if err != nil {
+			return "", err
+		}
+		return value, configComment(rest)
+	}
+	if i := strings.Index(s, "#"); i >= 0 {
+		s = strings.TrimSpace(s[:i])
+	}
+	if s == "" {
+		return "", fmt.Errorf("missing value")
+	}
+	return s, nil
+}
+
+// configString parses the quoted string at the start of s, returning it and
+// the rest of s.
+func configString(s string) (value, rest string, err error) {
+	switch {
+	case strings.HasPrefix(s, "'"):
+		if i := strings.Index(s[1:], "'"); i >= 0 {
+			return s[1 : i+1], s[i+2:], nil
+		}
+	case strings.HasPrefix(s, `"`):
+		for i := 1; i < len(s); i++ {
+			if s[i] == '\\' {
+				i++
+			} else if s[i] == '"' {
+				value, err := strconv.Unquote(s[:i+1])
+				return value, s[i+1:], err
+			}
+		}
+	default:
+		return "", "", fmt.Errorf("invalid string: %s", s)
+	}
+	return "", "", fmt.Errorf("unterminated string: %s", s)
+}
+
+// configComment returns an error unless s is empty or a comment.
+func configComment(s string) error {
+	if s = strings.TrimSpace(s); s != "" && s[0] != '#' {
+		return fmt.Errorf("unexpected %q", s)
+	}
+	return nil
+}
+
+// configBools, configInts, and configDurations locate the boolean, integer,
+// and duration Options named by the keys of a configuration file.
+var (
+	configBools = map[string]func(opts *Options) *bool{
+		"recursive":          func(opts *Options) *bool { return &opts.Recursive },
+		"follow-symlinks":    func(opts *Options) *bool { return &opts.FollowSymlinks },
+		"follow-within-root": func(opts *Options) *bool { return &opts.FollowWithinRoot },
+		"one-file-system":    func(opts *Options) *bool { return &opts.OneFileSystem },
+		"archives":           func(opts *Options) *bool { return &opts.Archives },
+		"exit-on-error":      func(opts *Options) *bool { return &opts.ExitOnError },
+		"skip-hidden":        func(opts *Options) *bool { return &opts.SkipHidden },
+		"ignore-case":        func(opts *Options) *bool { return &opts.IgnoreCase },
+		"include-special":    func(opts *Options) *bool { return &opts.IncludeSpecial },
+		"skip-unreadable":    func(opts *Options) *bool { return &opts.SkipUnreadable },
+		"detect-changes":     func(opts *Options) *bool { return &opts.DetectChanges },
+		"xattr-cache":        func(opts *Options) *bool { return &opts.UseXattrCache },
+		"normalize-text":     func(opts *Options) *bool { return &opts.NormalizeText },
+		"strip-bom":          func(opts *Options) *bool { return &opts.StripBOM },
+	}
+	configInts = map[string]func(opts *Options) *int{
+		"max-depth":     func(opts *Options) *int { return &opts.MaxDepth },
+		"read-retries":  func(opts *Options) *int { return &opts.ReadRetries },
+		"files-per-sec": func(opts *Options) *int { return &opts.MaxFilesPerSec },
+		"min-copies":    func(opts *Options) *int { return &opts.MinGroupSize },
+	}
+	configDurations = map[string]func(opts *Options) *time.Duration{
+		"file-timeout":         func(opts *Options) *time.Duration { return &opts.PerFileTimeout },
+		"skip-modified-within": func(opts *Options) *time.Duration { return &opts.SkipModifiedWithin },
+	}
+)
+
+func init() {
+	for key, field := range configBools {
+		configSetters[key] = configBool(field)
+	}
+	for key, field := range configInts {
+		configSetters[key] = configInt(field)
+	}
+	for key, field := range configDurations {
+		configSetters[key] = configDuration(field)
+	}
+}
+
+// configSetters set the Options named by the keys of a configuration file
+// read by FromConfig to their values, along with those of configBools,
+// configInts, and configDurations.
+var configSetters = map[string]func(opts *Options, value string) error{
+	"algo": func(opts *Options, value string) error {
+		opts.Algorithm = value
+		return checkDigests([]string{value})
+	},
+	"sort": func(opts *Options, value string) (err error) {
+		opts.GroupOrder, err = ParseGroupOrder(value)
+		return err
+	},
+	"spill-dir": func(opts *Options, value string) error {
+		opts.SpillDir = value
+		return nil
+	},
+	"digests": func(opts *Options, value string) error {
+		opts.Digests = configList(value)
+		return nil
+	},
+	"ignore-files": func(opts *Options, value string) error {
+		opts.IgnoreFiles = configList(value)
+		return nil
+	},
+	"regex":         configRegexp(func(opts *Options) **regexp.Regexp { return &opts.MatchRegexp }),
+	"exclude-regex": configRegexp(func(opts *Options) **regexp.Regexp { return &opts.ExcludeRegexp }),
+	"match": func(opts *Options, value string) error {
+		switch value {
+		case "content":
+			opts.Matcher = nil
+		case "image":
+			opts.Matcher = NewImageMatcher(DefaultImageThreshold)
+		case "photo":
+			opts.Matcher = PhotoMatcher{}
+		case "audio":
+			opts.Matcher = AudioMatcher{}
+		case "name-size":
+			opts.Matcher = NameSizeMatcher{}
+		case "size-mtime":
+			opts.Matcher = SizeModTimeMatcher{}
+		default:
+			return fmt.Errorf("unknown match method: %q", value)
+		}
+		return nil
+	},
+}
+
+// configMatcher returns the value of the match key of a configuration file
+// that sets m.
+func configMatcher(m Matcher) string {
+	switch m.(type) {
+	case nil:
+		return ""
+	case *ImageMatcher:
+		return "image"
+	case PhotoMatcher:
+		return "photo"
+	case AudioMatcher:
+		return "audio"
+	case NameSizeMatcher:
+		return "name-size"
+	case SizeModTimeMatcher:
+		return "size-mtime"
+	}
+	return fmt.Sprintf("%T", m)
+}
+
+// settings returns the options set in opts that a configuration file may
+// set, as values that FromConfig reads, by key, leaving out those left at
+// their zero values. A Matcher that the match key cannot set is named by its
+// Go type.
+func (opts *Options) settings() map[string]string {
+	m := make(map[string]string)
+	for key, field := range configBools {
+		if *field(opts) {
+			m[key] = "true"
+		}
+	}
+	for key, field := range configInts {
+		if n := *field(opts); n != 0 {
+			m[key] = strconv.Itoa(n)
+		}
+	}
+	for key, field := range configDurations {
+		if d := *field(opts); d != 0 {
+			m[key] = d.String()
+		}
+	}
+	for key, value := range map[string]string{
+		"algo":         opts.Algorithm,
+		"spill-dir":    opts.SpillDir,
+		"digests":      strings.Join(opts.Digests, ","),
+		"ignore-files": strings.Join(opts.IgnoreFiles, ","),
+		"match":        configMatcher(opts.Matcher),
+	} {
+		if value != "" {
+			m[key] = value
+		}
+	}
+	if opts.GroupOrder == ByWastedBytes {
+		m["sort"] = "wasted"
+	}
+	if opts.MatchRegexp != nil {
+		m["regex"] = opts.MatchRegexp.String()
+	}
+	if opts.ExcludeRegexp != nil {
+		m["exclude-regex"] = opts.ExcludeRegexp.String()
+	}
+	return m
+}
+
+// FromConfig reads a configuration file from r, as ReadConfig does, and sets
+// the options it names, leaving others as they are. The keys are named after
+// the flags of the dedup command: recursive, follow-symlinks,
+// follow-within-root, one-file-system, archives, exit-on-error, skip-hidden,
+// ignore-case, include-special, skip-unreadable, detect-changes, xattr-cache,
+// normalize-text, and strip-bom are booleans; max-depth, read-retries,
+// files-per-sec, and min-copies, for MinGroupSize, are integers;
+// file-timeout, for PerFileTimeout, and skip-modified-within are durations
+// such as "5m"; regex and exclude-regex are regular expressions; digests and
+// ignore-files are arrays; algo names Algorithm; sort is "sum" or "wasted",
+// setting GroupOrder; spill-dir is a path; and match is "content", "image",
+// "photo", "audio", "name-size", or "size-mtime", setting Matcher.
+// Unknown keys are errors.
+func (opts *Options) FromConfig(r io.Reader) error {
+	settings, err := ReadConfig(r)
+	if err != nil {
+		return err
+	}
+	for _, s := range settings {
+		set, ok := configSetters[s.Key]
+		if !ok {
+			return fmt.Errorf("dedup: config line %d: unknown setting %q", s.Line, s.Key)
+		}
+		if err := set(opts, s.Value); err != nil {
+			return fmt.Errorf("dedup: config line %d: %s: %v", s.Line, s.Key, err)
+		}
+	}
+	return nil
+}
+
+func configBool(field func(opts *Options) *bool) func(opts *Options, value string) error {
+	return func(opts *Options, value string) error {
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean: %q", value)
+		}
+		*field(opts) = b
+		return nil
+	}
+}
+
+func configInt(field func(opts *Options) *int) func(opts *Options, value string) error {
+	return func(opts *Options, value string) error {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 0 {
+			return fmt.Errorf("invalid count: %q", value)
+		}
+		*field(opts) = n
+		return nil
+	}
+}
+
+func configDuration(field func(opts *Options) *time.Duration) func(opts *Options, value string) error {
+	return func(opts *Options, value string) error {
+		d, err := time.ParseDuration(value)
+		if err != nil || d < 0 {
+			return fmt.Errorf("invalid duration: %q", value)
+		}
+		*field(opts) = d
+		return nil
+	}
+}
+
+func configRegexp(field func(opts *Options) **regexp.Regexp) func(opts *Options, value string) error {
+	return func(opts *Options, value string) error {
+		re, err := regexp.Compile(value)
+		if err != nil {
+			return err
+		}
+		*field(opts) = re
+		return nil
+	}
+}
+
+// configList splits the comma-separated value of an array setting.
+func configList(value string) []string {
+	if value == "" {
+		return nil
+	}
+	return strings.Split(value, ",")
+}
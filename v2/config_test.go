@@ -0,0 +1,70 @@
+package dedup
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestReadConfig(t *testing.T) {
+	settings, err := ReadConfig(strings.NewReader(`# Defaults.
+recursive = true
+exclude-regex = "/(node_modules|\\.git)/" # Not evaluated.
+
+digests = ["md5", 'sha256']
+timeout=5m
+`))
+	if err != nil {
+		t.Fatalf("ReadConfig() = %v", err)
+	}
+	want := []ConfigSetting{
+		{"recursive", "true", 2},
+		{"exclude-regex", `/(node_modules|\.git)/`, 3},
+		{"digests", "md5,sha256", 5},
+		{"timeout", "5m", 6},
+	}
+	if !reflect.DeepEqual(settings, want) {
+		t.Errorf("ReadConfig() = %q; want %q", settings, want)
+	}
+
+	for _, s := range []string{
+		"recursive\n",
+		"= true\n",
+		"recursive =\n",
+		"regex = \"unterminated\n",
+		"regex = \"a\" b\n",
+		"digests = [\"md5\" \"sha1\"]\n",
+		"[table]\n",
+	} {
+		if _, err := ReadConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadConfig(%q) = nil; want error", s)
+		}
+	}
+}
+
+func TestOptionsFromConfig(t *testing.T) {
+	opts := &Options{SkipHidden: true}
+	err := opts.FromConfig(strings.NewReader(`recursive = true
+match = "name-size"
+exclude-regex = '\.tmp$'
+digests = ["sha256"]
+read-retries = 2
+file-timeout = "1m"
+sort = "wasted"
+`))
+	if err != nil {
+		t.Fatalf("FromConfig() = %v", err)
+	}
+	if !opts.Recursive || !opts.SkipHidden || opts.Matcher != (NameSizeMatcher{}) ||
+		opts.ExcludeRegexp.String() != `\.tmp$` || !reflect.DeepEqual(opts.Digests, []string{"sha256"}) ||
+		opts.ReadRetries != 2 || opts.PerFileTimeout != time.Minute || opts.GroupOrder != ByWastedBytes {
+		t.Errorf("FromConfig() set %+v", opts)
+	}
+
+	for _, s := range []string{"bogus = 1\n", "recursive = yes\n", "max-depth = -1\n", "match = \"md5\"\n", "regex = \"(\"\n", "sort = \"size\"\n"} {
+		if err := new(Options).FromConfig(strings.NewReader(s)); err == nil {
+			t.Errorf("FromConfig(%q) = nil; want error", s)
+		}
+	}
+}
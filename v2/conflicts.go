@@ -0,0 +1,79 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"sort"
+)
+
+// NameConflict is a set of files with the same name whose contents differ,
+// such as two photos named "IMG_0001.JPG" in libraries being merged: the
+// inverse of a group of duplicates.
+type NameConflict struct {
+	Name  string   // Base name of the files.
+	Files []*File  // Sorted by path.
+	Sums  []Digest // Checksum of each file in Files.
+}
+
+// NameConflicts returns the groups of files in s that have the same base
+// name, wherever they lie, but not all the same checksum. Every file with the
+// name is included, including copies of one another. Groups are sorted by
+// name.
+func (s *Sums) NameConflicts() []NameConflict {
+	type entry struct {
+		file *File
+		sum  Digest
+	}
+	m := make(map[string][]entry)
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		for _, file := range files {
+			name := baseName(file.Path)
+			m[name] = append(m[name], entry{file, sum})
+		}
+		return true
+	})
+
+	var conflicts []NameConflict
+	for name, entries := range m {
+		differ := false
+		for _, e := range entries[1:] {
+			if e.sum != entries[0].sum {
+				differ = true
+				break
+			}
+		}
+		if !differ {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].file.Path < entries[j].file.Path })
+		c := NameConflict{Name: name}
+		for _, e := range entries {
+			c.Files = append(c.Files, e.file)
+			c.Sums = append(c.Sums, e.sum)
+		}
+		conflicts = append(conflicts, c)
+	}
+	sort.Slice(conflicts, func(i, j int) bool { return conflicts[i].Name < conflicts[j].Name })
+	return conflicts
+}
+
+// WriteConflicts writes a summary of the groups returned by NameConflicts to
+// w in the following format, where each file is followed by its checksum:
+//
+//	"IMG_0001.JPG":
+//	- "/path/to/a/IMG_0001.JPG" da39a3ee5e6b4b0d3255bfef95601890afd80709
+//	- "/path/to/b/IMG_0001.JPG" 5d09322ad01e91d1eed68a86ba5f9cde52163e68
+//	...
+func (s *Sums) WriteConflicts(w io.Writer) error {
+	for _, c := range s.NameConflicts() {
+		if _, err := fmt.Fprintf(w, "%q:\n", c.Name); err != nil {
+			return err
+		}
+		for i, file := range c.Files {
+			if _, err := fmt.Fprintf(w, "- %q %x\n", file.Path, c.Sums[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
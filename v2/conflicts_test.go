@@ -0,0 +1,36 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestSumsWriteConflicts(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/a/IMG_0001.JPG")
+	add("blue", "/b/IMG_0001.JPG")
+	add("aqua", "/c/IMG_0001.JPG") // Copy of a conflicting file.
+	add("gray", "/a/notes.txt")
+	add("gray", "/b/notes.txt") // Copies only.
+	add("lime", "/a/img_0001.jpg")
+	add("navy", "/b/x.zip!/inner/report.doc")
+	add("teal", "/a/report.doc")
+
+	var buf bytes.Buffer
+	if err := sums.WriteConflicts(&buf); err != nil {
+		t.Fatalf("WriteConflicts() = %v", err)
+	}
+	want := fmt.Sprintf(`"IMG_0001.JPG":
+- "/a/IMG_0001.JPG" %x
+- "/b/IMG_0001.JPG" %x
+- "/c/IMG_0001.JPG" %x
+"report.doc":
+- "/a/report.doc" %x
+- "/b/x.zip!/inner/report.doc" %x
+`, keySum["aqua"], keySum["blue"], keySum["aqua"], keySum["teal"], keySum["navy"])
+	if got := buf.String(); got != want {
+		t.Errorf("WriteConflicts() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,97 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Coverage lists which files of a live directory tree have copies in a
+// backup, such as a zip or tar archive evaluated under Options.Archives, as
+// returned by Sums.Coverage.
+type Coverage struct {
+	Present []CoveredFile `json:"present"` // Live files with copies in the backup, which may be deleted without losing their contents.
+	Missing []string      `json:"missing"` // Paths of the live files without copies in the backup.
+}
+
+// CoveredFile is a live file listed in a Coverage, along with its copies in
+// the backup.
+type CoveredFile struct {
+	Path   string   `json:"path"`
+	Sum    string   `json:"sum"`    // Hex-encoded checksum of the file.
+	Copies []string `json:"copies"` // Paths of the copies in the backup, sorted.
+}
+
+// Coverage returns which of the files in s that lie within live have copies
+// in s that lie within backup, such as the paths given to FilterPaths
+// "/data" and "/backups/data.tar!". Files within live are matched as by
+// RootStats, so that backup may lie within live or the other way around: each
+// file counts for the longer of the two roots it lies within. Files within
+// neither are ignored. Live files that were not evaluated into s, such as
+// those skipped under Options.Precount for their unique sizes, are not listed
+// at all. Each list in the Coverage is sorted by path.
+func (s *Sums) Coverage(live, backup string) *Coverage {
+	_, rootOf := rootMatcher([]string{live, backup})
+	c := &Coverage{Present: []CoveredFile{}, Missing: []string{}}
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		var lives, copies []string
+		for _, file := range files {
+			switch rootOf(file.Path) {
+			case 0:
+				lives = append(lives, file.Path)
+			case 1:
+				copies = append(copies, file.Path)
+			}
+		}
+		if len(copies) == 0 {
+			c.Missing = append(c.Missing, lives...)
+			return true
+		}
+		sort.Strings(copies)
+		for _, path := range lives {
+			c.Present = append(c.Present, CoveredFile{Path: path, Sum: hex.EncodeToString([]byte(sum)), Copies: copies})
+		}
+		return true
+	})
+	sort.Slice(c.Present, func(i, j int) bool { return c.Present[i].Path < c.Present[j].Path })
+	sort.Strings(c.Missing)
+	return c
+}
+
+// Complete reports whether every live file listed in c has a copy in the
+// backup.
+func (c *Coverage) Complete() bool {
+	return len(c.Missing) == 0
+}
+
+// WriteJSON writes c to w as an indented JSON document.
+func (c *Coverage) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(c, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteText writes c to w in the following format, naming the first copy of
+// each file present:
+//
+//	present "/data/file1" (in "/backups/data.tar!/file1")
+//	missing "/data/file2"
+//	...
+func (c *Coverage) WriteText(w io.Writer) error {
+	for _, f := range c.Present {
+		if _, err := fmt.Fprintf(w, "present %q (in %q)\n", f.Path, f.Copies[0]); err != nil {
+			return err
+		}
+	}
+	for _, path := range c.Missing {
+		if _, err := fmt.Fprintf(w, "missing %q\n", path); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package dedup
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/hex"
+	"reflect"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestSumsCoverage(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, b := range map[string][]byte{"a": []byte("aqua"), "sub/b": []byte("blue"), "b2": []byte("blue"), "x": []byte("extra")} {
+		f, _ := w.Create(name)
+		_, _ = f.Write(b)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs := filesys.Map(map[string][]byte{
+		"live/a":      []byte("aqua"),
+		"live/a2":     []byte("aqua"),
+		"live/sub/b":  []byte("blue"),
+		"live/c":      []byte("lime"),
+		"backup.zip":  buf.Bytes(),
+		"other/black": []byte("black"),
+	}, nil)
+	sums, err := FilterPaths([]string{"live", "backup.zip!", "other"}, &Options{Recursive: true, Archives: true, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+
+	c := sums.Coverage("live", "backup.zip!")
+	aqua, blue := hex.EncodeToString([]byte(sha1Sum([]byte("aqua")))), hex.EncodeToString([]byte(sha1Sum([]byte("blue"))))
+	want := &Coverage{
+		Present: []CoveredFile{
+			{Path: "live/a", Sum: aqua, Copies: []string{"backup.zip!/a"}},
+			{Path: "live/a2", Sum: aqua, Copies: []string{"backup.zip!/a"}},
+			{Path: "live/sub/b", Sum: blue, Copies: []string{"backup.zip!/b2", "backup.zip!/sub/b"}},
+		},
+		Missing: []string{"live/c"},
+	}
+	if !reflect.DeepEqual(c, want) {
+		t.Errorf("Coverage() = %+v; want %+v", c, want)
+	}
+	if c.Complete() {
+		t.Error("Complete() = true; want false")
+	}
+
+	var text bytes.Buffer
+	_ = c.WriteText(&text)
+	if got, want := text.String(), `present "live/a" (in "backup.zip!/a")
+present "live/a2" (in "backup.zip!/a")
+present "live/sub/b" (in "backup.zip!/b2")
+missing "live/c"
+`; got != want {
+		t.Errorf("WriteText() wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	// A backup within the live tree only counts as the backup.
+	sums, _ = FilterDir(".", &Options{Recursive: true, Archives: true, FileSystem: fs})
+	if c := sums.Coverage(".", "backup.zip!"); len(c.Present) != 3 || len(c.Missing) != 3 {
+		t.Errorf("Coverage() of a backup within the live tree = %+v; want 3 present, 3 missing", c)
+	}
+}
@@ -0,0 +1,908 @@
+// Package dedup exposes primitives for detecting files with duplicate checksums
+// from a list of file paths.
+//
+// Filter evaluates the files whose paths it reads, FilterDir and FilterPaths
+// those found below the paths given, and a Watcher those of a directory as
+// they change, each returning the checksums of the files evaluated in a
+// Sums. Options configures an evaluation; each of its fields documents how it
+// interacts with the others. Files are grouped by the checksums of their
+// contents unless a Matcher compares them otherwise, and Actions and Plans
+// dispose of the duplicates found.
+package dedup
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// Options groups configuration options for Filter and FilterDir.
+type Options struct {
+	FollowSymlinks bool            // Follow symbolic links, and junctions on Windows; see File.Links.
+	Recursive      bool            // Recurse if reading from a directory.
+	MaxDepth       int             // Limit recursion depth, like find -maxdepth; 0 means no limit.
+	OneFileSystem  bool            // Do not descend into directories on other devices than the root.
+	Archives       bool            // Also evaluate the members of zip and tar archives, as "archive.zip!/inner/path".
+	ExitOnError    bool            // Stop if an error occurs.
+	ExitOnDup      bool            // Stop if a file with a previously-seen checksum is found.
+	MinGroupSize   int             // Only report duplicates once at least this many files share a checksum; 0 means 2.
+	ReportVanished bool            // Report listed files that vanish as errors instead of skipping them.
+	IgnoreCase     bool            // Compare paths case-insensitively, so that no file is evaluated twice.
+	SkipHidden     bool            // Skip files and directories named ".*", or hidden on Windows.
+	IncludeSpecial bool            // Also evaluate named pipes, sockets, and devices.
+	ReadRetries    int             // Retry reading a file this many times if an I/O error occurs.
+	TimeReads      bool            // Record how each file was read in Result.Read.
+	ChunkMode      bool            // Also index content-defined chunks of files in Sums.Chunks; ignored if Matcher is set.
+	UseXattrCache  bool            // Cache checksums in the user.dedup.sha1 extended attribute of files; ignored if Matcher, ChunkMode, Digests, or Algorithm is set.
+	MaxBytesPerSec int64           // Limit the rate at which all workers together read file contents; 0 means no limit.
+	MaxFilesPerSec int             // Limit the rate at which all workers together evaluate files; 0 means no limit.
+	LowPriority    bool            // Use fewer workers, and lower the priority of the process on Linux.
+	RawIOHints     bool            // Keep local files out of the page cache on Linux; see filesys.OSWithHints.
+	Cancel         <-chan struct{} // Close to signal cancellation; the Errors returned then include ErrCanceled.
+	GracefulCancel bool            // Finish the files under way once Cancel is closed, and return the partial Sums.
+	Matcher        Matcher         // Compute checksums; if nil, the SHA1 checksum of each file's contents is used.
+	UniqWriter     io.Writer       // Write paths of files with previously-unseen checksums.
+	DupWriter      io.Writer       // Write paths of files with previously-seen checksums.
+	UniqSink       Sink            // Receive results for files with previously-unseen checksums.
+	DupSink        Sink            // Receive results for files with previously-seen checksums.
+	ErrWriter      io.Writer       // Write errors.
+	GroupErrors    bool            // Write errors grouped by directory once evaluation stops.
+
+	// FollowWithinRoot is like FollowSymlinks, but only follows the links
+	// that lead within the paths given to FilterDir or FilterPaths, or within
+	// the directory watched by a Watcher, and skips the others; Filter,
+	// whose paths have no root, then follows none. It is ignored if
+	// FollowSymlinks is set.
+	FollowWithinRoot bool
+
+	// Canonical, if not nil, contains known content, such as an index loaded
+	// with ReadIndex. Files whose checksums it contains are reported as
+	// duplicates of its copies.
+	Canonical *Sums
+
+	// Stages, if not nil, contains custom steps run on each file as it is
+	// evaluated.
+	Stages *Stages
+
+	// MatchRegexp, if not nil, restricts evaluation to the files whose paths
+	// it matches. ExcludeRegexp, if not nil, skips the files whose paths it
+	// matches, and the directories whose paths it matches with a trailing
+	// separator. Both match paths as listed, before links are followed.
+	MatchRegexp   *regexp.Regexp
+	ExcludeRegexp *regexp.Regexp
+
+	// IgnoreFiles names ignore files, such as ".gitignore", whose rules, in
+	// the syntax of .gitignore files, skip files below the directories
+	// containing them. The rules of those in deeper directories, and of those
+	// named later, take precedence.
+	IgnoreFiles []string
+
+	// Algorithm names the digest used as the checksum of each file, among
+	// those of Digests; it is "sha1" if empty. "blake3" is recommended for
+	// large files on machines with several cores, as it hashes each file on
+	// all of them at once. Checksums may only be compared with those of
+	// evaluations under the same Algorithm, such as those of a Canonical
+	// index or of a StatePath. It is ignored if Matcher is set.
+	Algorithm string
+
+	// Digests names digests computed in addition to the checksum of each
+	// file and stored in File.Digests: "blake3", "md5", "sha1", "sha256", or
+	// "sha512". They are included in the output of Sums.WriteAllDup and
+	// Sums.WriteIndex. It is ignored if Matcher is set.
+	Digests []string
+
+	// Progress, if not nil, is updated as files are evaluated, so that the
+	// progress of the evaluation may be polled while it runs.
+	Progress *Progress
+
+	// Logger, if not nil, receives records of errors, skipped files, and
+	// traces of the evaluation; see Logger.
+	Logger Logger
+
+	// Metrics, if not nil, counts the files evaluated, bytes read, errors,
+	// and duplicates as the evaluation proceeds, for monitoring.
+	Metrics Metrics
+
+	// OnFile, if not nil, is called with each file evaluated, or with an
+	// error for a file, whose File then only has a Path; errors that concern
+	// no file in particular are not passed to it. It is called in the order
+	// that files are reported, never concurrently, from the goroutine that
+	// called Filter, FilterDir, or Watcher.Run, and holds up the evaluation
+	// while it runs.
+	OnFile func(file File, sum Digest, dup bool, err error)
+
+	// CaseCollisions, if not nil, records the entries of the directories read
+	// whose names differ only in case.
+	CaseCollisions *CaseCollisions
+
+	// Precount makes FilterDir and FilterPaths list every file, with its
+	// size, before reading any, and sets the total size of the files to be
+	// read on Progress. Files whose sizes no other file shares are then
+	// skipped unless Matcher or Canonical is set: they are counted in
+	// Stats.FilesSkipped, but not in NumFiles, and not reported to UniqWriter
+	// or UniqSink. It is ignored by Filter and Watcher, and under LowMemory.
+	Precount bool
+
+	// BrokenLinkWriter, if not nil, receives the path of each broken symbolic
+	// link encountered; such links are then not reported as errors.
+	BrokenLinkWriter io.Writer
+
+	// OutputBuffer, if positive, is the number of paths that may wait to be
+	// written to UniqWriter and DupWriter, by a goroutine of their own,
+	// before the workers wait for them. OutputDropPercent, if positive, drops
+	// paths instead once the buffer is at least that percent full; they are
+	// counted in Stats.OutputDropped.
+	OutputBuffer      int
+	OutputDropPercent int
+
+	// StatePath names a file to which FilterDir saves its progress every
+	// CheckpointInterval, or DefaultCheckpointInterval if it is 0, so that
+	// calling FilterDir again with the same path and StatePath resumes it
+	// from the last checkpoint saved. The files evaluated before resuming
+	// are included in the Sums returned, but not sent to writers and sinks
+	// again. The file is removed once every file has been evaluated.
+	// StatePath is not supported with ChunkMode, LowMemory, or Priority.
+	StatePath          string
+	CheckpointInterval time.Duration
+
+	// MaxFiles and MaxTotalBytes, if positive, stop evaluation before another
+	// file would exceed either the number of files evaluated or their total
+	// size: the files under way are finished, and the partial Sums is
+	// returned with a *BudgetExceededError among Errors. They are ignored by
+	// Watcher.
+	MaxFiles      int
+	MaxTotalBytes int64
+
+	// Deadline, if not zero, is the time at which evaluation stops: the files
+	// under way are finished, and the partial Sums is returned with
+	// ErrDeadlineExceeded among Errors. It is ignored by Watcher.
+	Deadline time.Time
+
+	// SamplePercent, if positive, makes FilterDir and FilterPaths list every
+	// file, as under Precount, then only evaluate the files of a random
+	// SamplePercent percent of the sizes shared by several files, for
+	// Sums.Estimate to extrapolate from. It is ignored by Filter and Watcher,
+	// under LowMemory, and if Matcher or Canonical is set.
+	SamplePercent float64
+
+	// StrictMatch, if any of its fields are set, makes files only be
+	// considered duplicates if they also share the metadata it selects,
+	// which then follows their checksums in the Sums returned and in
+	// Results. It is ignored if Canonical is set, whose checksums are of
+	// contents alone.
+	StrictMatch StrictMatch
+
+	// SameDirOnly makes files only be considered duplicates of files in the
+	// same directory, which then follows their checksums, as under
+	// StrictMatch. It is ignored if Canonical is set.
+	SameDirOnly bool
+
+	// CrossDirOnly makes files only be reported as duplicates once a copy in
+	// another directory has been evaluated, ignoring copies kept side by side
+	// in one directory: their groups are left out by Sums.DupGroups and the
+	// reports, but counted in Stats, as under MinGroupSize. It is ignored if
+	// SameDirOnly or Canonical is set.
+	CrossDirOnly bool
+
+	// NormalizeText makes text files be compared with the whitespace and
+	// carriage returns at the end of each line left out; files with NUL
+	// bytes among their first 8000 bytes are binary files, compared as they
+	// are. It sets Matcher, and is ignored if Matcher is set already.
+	NormalizeText bool
+
+	// StripBOM, along with NormalizeText, also leaves a UTF-8 byte order mark
+	// at the start of text files out of their checksums.
+	StripBOM bool
+
+	// LongReport makes the reports written from the Sums returned include
+	// the mode, owner, and modification time of each file.
+	LongReport bool
+
+	// ReportHeader makes the JSON, CSV, and YAML reports written from the
+	// Sums returned begin with their Header.
+	ReportHeader bool
+
+	// GroupOrder is the order in which Sums.DupGroups and the reports written
+	// from the Sums returned list groups of duplicates. Whatever the order,
+	// groups are listed in the same order from one evaluation of the same
+	// files to the next, so that reports may be diffed.
+	GroupOrder GroupOrder
+
+	// LinkPaths sets how the files that links led to under FollowSymlinks or
+	// FollowWithinRoot are named in the output: by their own path, the
+	// default, by that of the link, or by both.
+	LinkPaths LinkPaths
+
+	// SkipUnreadable, if true, makes files and directories that may not be
+	// read for lack of permission be skipped instead of reported as errors;
+	// they are counted in Stats.PermissionDenied.
+	SkipUnreadable bool
+
+	// PerFileTimeout, if positive, limits the time spent reading each file,
+	// retries included: a file that takes longer is closed and reported
+	// with an *Error whose cause is os.ErrDeadlineExceeded. Its read is
+	// abandoned, so that nothing it would have recorded, in the Sums or in
+	// the extended attributes of the file under UseXattrCache, is kept.
+	PerFileTimeout time.Duration
+
+	// SkipModifiedWithin, if positive, skips files modified less than this
+	// long before they are evaluated; they are counted in Stats.FilesSkipped.
+	// It is ignored by Watcher.
+	SkipModifiedWithin time.Duration
+
+	// DetectChanges makes each file be stat'ed again once read, and reported
+	// with an *UnstableError if its size or modification time changed.
+	DetectChanges bool
+
+	// SpillDir names a directory in which the files evaluated are held in
+	// temporary files, rather than in memory; see NewSpilledSums. The Close
+	// method of the Sums returned removes them. Directories found under
+	// Recursive, once too many wait to be read, are likewise held there, or
+	// in the default directory for temporary files. It is ignored by
+	// Watcher.
+	SpillDir string
+
+	// LowMemory makes FilterDir and FilterPaths list every file to temporary
+	// files in SpillDir, or in the default directory for temporary files,
+	// divided into buckets by size, then evaluate them one bucket at a time,
+	// so that their use of memory stays bounded. Files are then reported in
+	// order of their buckets rather than as they are listed, unique sizes
+	// are skipped as under Precount, and the Sums returned is held on disk,
+	// as under SpillDir, and should be closed. It is ignored by Filter and
+	// Watcher.
+	LowMemory bool
+
+	// Priority, if any of its fields are set, makes FilterDir and FilterPaths
+	// list every file before reading any, then evaluate them in the order it
+	// selects, such as the largest first, so that the duplicates that waste
+	// the most space may be found first when the evaluation may be cut
+	// short. Every file listed is held in memory until it is evaluated. It
+	// is ignored by Filter and Watcher, and under LowMemory.
+	Priority Priority
+
+	// BufferConfig bounds the buffers that files are read into and kept for
+	// reuse. The zero value sets no bounds.
+	BufferConfig BufferConfig
+
+	// AbsPaths makes the paths of the files evaluated absolute and clean.
+	// URLs are left as they are. It is ignored by Watcher.
+	AbsPaths bool
+
+	// RelPaths makes the paths of the files evaluated relative to the single
+	// path given to FilterDir or FilterPaths, or to its directory if it is a
+	// file; several paths are an error. It takes precedence over AbsPaths,
+	// and is ignored by Filter, whose paths have no root, and by Watcher.
+	RelPaths bool
+
+	// InputParser, if not nil, parses the lines read by Filter into the
+	// paths of the files to evaluate. If nil, a LineParser is used, which
+	// skips blank lines and drops carriage returns ending lines.
+	InputParser InputParser
+
+	// FileSystem, if not nil, is the file system in which paths are looked
+	// up and files read. If nil, the local file system is read through
+	// filesys.OSWithHints under RawIOHints and through filesys.OS otherwise,
+	// and paths may also be URLs, as handled by filesys.URLs. Under Archives,
+	// it is wrapped by filesys.Archives. It is ignored by Watcher, which
+	// watches the local file system.
+	FileSystem filesys.FileSystem
+
+	linkRoots []string     // Directories within which links are followed under FollowWithinRoot.
+	byteLimit *tokenBucket // Enforce MaxBytesPerSec.
+	budget    *budget      // Enforce MaxFiles and MaxTotalBytes.
+	seed      int64        // Seed of the sample drawn under SamplePercent, if not 0.
+	fileLimit *tokenBucket // Enforce MaxFilesPerSec.
+}
+
+// Filter reads newline-delimited file paths from r, evaluates each file in
+// search of duplicate checksums, and returns a *Sums and any error(s) that
+// may have occurred during evaluation. If err is non-nil, its type will be
+// Errors. The lines read are parsed by Options.InputParser. A file whose
+// path is read more than once, as written the same way once cleaned, or
+// compared case-insensitively under the IgnoreCase option, is evaluated once;
+// so is a file that several symbolic links followed lead to.
+func Filter(r io.Reader, opts *Options) (*Sums, error) {
+	if err := opts.checkAlgorithms(); err != nil {
+		return nil, Errors{err}
+	}
+	opts = setup(opts)
+	if opts.InputParser == nil {
+		opts.InputParser = LineParser{}
+	}
+	if opts.AbsPaths {
+		opts.InputParser = absParser{opts.InputParser}
+	}
+	f := newChanFilter(readLines(r, opts.InputParser), opts.procs(maxProcs), opts)
+	if f.targets == nil {
+		f.targets = make(map[string]*linkTarget) // Evaluate paths listed twice once.
+	}
+	if err := spillSums(f, opts); err != nil {
+		return nil, Errors{err}
+	}
+	return run(f, opts)
+}
+
+// FilterDir is like Filter except it reads file paths from the directory
+// located at path.
+func FilterDir(path string, opts *Options) (*Sums, error) {
+	return FilterPaths([]string{path}, opts)
+}
+
+// FilterPaths is like FilterDir except it evaluates each of paths, which may
+// locate files as well as directories, in order. A path given more than once
+// is evaluated once, as are paths that lie within a directory also given when
+// reading recursively without MaxDepth.
+func FilterPaths(paths []string, opts *Options) (*Sums, error) {
+	if err := opts.checkAlgorithms(); err != nil {
+		return nil, Errors{err}
+	}
+	opts = setup(opts)
+	if opts.AbsPaths && !opts.RelPaths {
+		var err error
+		if paths, err = absPaths(paths); err != nil {
+			return nil, Errors{err}
+		}
+	}
+	paths = roots(paths, opts)
+	if opts.RelPaths {
+		if len(paths) != 1 {
+			return nil, Errors{errRelPaths}
+		}
+		paths = []string{relRoot(paths[0], opts)}
+	}
+	opts.linkRoots = paths
+	if opts.LowMemory {
+		return filterLowMemory(paths, opts)
+	}
+	if opts.Priority.enabled() {
+		return filterPriority(paths, opts)
+	}
+	f := newDirFilter(paths, opts)
+	if opts.Precount || opts.SamplePercent > 0 {
+		sizes, ok := precount(paths, opts)
+		if !ok {
+			f.Sums().stopped()
+			return f.Sums(), nil
+		}
+		var total uint64
+		if opts.SamplePercent > 0 {
+			total = f.f.sampled(sizes)
+		} else {
+			total = f.f.precounted(sizes)
+		}
+		if opts.Progress != nil {
+			opts.Progress.SetTotal(total)
+		}
+	}
+	if opts.StatePath == "" {
+		if err := spillSums(f, opts); err != nil {
+			return nil, Errors{err}
+		}
+		return run(f, opts)
+	}
+	if opts.ChunkMode {
+		return nil, Errors{errChunkState}
+	}
+	st, err := readState(opts.StatePath, paths)
+	if err != nil {
+		return nil, Errors{err}
+	}
+	if err := spillSums(f, opts); err != nil {
+		return nil, Errors{err}
+	}
+	if st != nil {
+		if err := f.resume(st); err != nil {
+			_ = f.Sums().Close()
+			return nil, Errors{err}
+		}
+	}
+	c := newCheckpointFilter(f, opts.StatePath, opts.CheckpointInterval)
+	sums, err := run(c, opts)
+	if ferr := c.finish(); ferr != nil {
+		errs, _ := err.(Errors)
+		err = append(errs, ferr)
+	}
+	return sums, err
+}
+
+// pathKey returns the key under which the file located at path is recorded
+// as evaluated: path cleaned, unless it is a URL, and in lower case under the
+// IgnoreCase option.
+func (opts *Options) pathKey(path string) string {
+	if !filesys.IsURL(path) {
+		path = filepath.Clean(path)
+	}
+	if opts.IgnoreCase {
+		path = strings.ToLower(path)
+	}
+	return path
+}
+
+// roots returns paths without those that are given more than once, or that lie
+// within a directory also given whose files are all read under the Recursive
+// and MaxDepth options, so that no file is evaluated more than once. Paths are
+// compared case-insensitively under the IgnoreCase option.
+func roots(paths []string, opts *Options) []string {
+	var out, keys []string
+	seen := make(map[string]bool)
+	for _, p := range paths {
+		if !filesys.IsURL(p) {
+			p = filepath.Clean(p)
+		}
+		key := opts.pathKey(p)
+		if !seen[key] {
+			seen[key] = true
+			out = append(out, p)
+			keys = append(keys, key)
+		}
+	}
+	if !opts.Recursive || opts.MaxDepth > 0 {
+		return out
+	}
+	var kept []string
+	for i, p := range out {
+		within := false
+		for _, q := range keys {
+			if keys[i] != q && !filesys.IsURL(p) && strings.HasPrefix(keys[i], strings.TrimSuffix(q, string(filepath.Separator))+string(filepath.Separator)) {
+				within = true
+				break
+			}
+		}
+		if !within {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// setup returns a copy of opts with its file system and rate limits
+// configured, lowering the priority of the process under the LowPriority
+// option.
+func setup(opts *Options) *Options {
+	o := *opts
+	if o.FileSystem == nil && o.RawIOHints {
+		o.FileSystem = filesys.URLs(filesys.OSWithHints())
+	} else if o.FileSystem == nil {
+		o.FileSystem = filesys.URLs(filesys.OS())
+	}
+	if o.Archives {
+		o.FileSystem = filesys.Archives(o.FileSystem)
+	}
+	if o.NormalizeText && o.Matcher == nil {
+		o.Matcher = textMatcher{stripBOM: o.StripBOM}
+	}
+	o.byteLimit = newTokenBucket(o.MaxBytesPerSec)
+	o.fileLimit = newTokenBucket(int64(o.MaxFilesPerSec))
+	o.budget = newBudget(o.MaxFiles, o.MaxTotalBytes)
+	if o.LowPriority {
+		lowerPriorityOnce.Do(lowerPriority)
+	}
+	return &o
+}
+
+var lowerPriorityOnce sync.Once
+
+// lowPriorityProcs is the greatest number of worker goroutines of each kind
+// started under the LowPriority option.
+const lowPriorityProcs = 1
+
+// procs returns n, or lowPriorityProcs if it is less under the LowPriority
+// option.
+func (opts *Options) procs(n int) int {
+	if opts.LowPriority && n > lowPriorityProcs {
+		return lowPriorityProcs
+	}
+	return n
+}
+
+// skipUnreadable reports whether err indicates that a file or directory may
+// not be read for lack of permission and is to be skipped under the
+// SkipUnreadable option, recording it in sums, if not nil, if so.
+func (opts *Options) skipUnreadable(sums *Sums, err error) bool {
+	if !opts.SkipUnreadable || !errors.Is(err, os.ErrPermission) {
+		return false
+	}
+	if sums != nil {
+		sums.denied()
+		path, _ := pathCause(err)
+		opts.logSkip(path, "permission denied")
+	}
+	return true
+}
+
+// matches reports whether the file located at path is evaluated under the
+// MatchRegexp and ExcludeRegexp options.
+func (opts *Options) matches(path string) bool {
+	if opts.ExcludeRegexp != nil && opts.ExcludeRegexp.MatchString(path) {
+		return false
+	}
+	return opts.MatchRegexp == nil || opts.MatchRegexp.MatchString(path)
+}
+
+// excludesDir reports whether the directory located at path is skipped under
+// the ExcludeRegexp option.
+func (opts *Options) excludesDir(path string) bool {
+	if opts.ExcludeRegexp == nil {
+		return false
+	}
+	sep := string(filepath.Separator)
+	if filesys.IsURL(path) {
+		sep = "/"
+	}
+	return opts.ExcludeRegexp.MatchString(path + sep)
+}
+
+// descend reports whether a sub-directory found at depth should be read
+// under the Recursive and MaxDepth options.
+func (opts *Options) descend(depth int) bool {
+	if !opts.Recursive {
+		return false
+	}
+	return opts.MaxDepth <= 0 || depth < opts.MaxDepth
+}
+
+// run starts and monitors the specified filter and returns f.Sums() and any
+// error(s) that may have occurred. If err is non-nil, it will be of type
+// Errors; if ExitOnError is true, err will contain the first error that
+// occurred, otherwise it will contain all errors encountered during
+// evaluation.
+func run(f filter, opts *Options) (sums *Sums, err error) {
+	var errors Errors
+	var stopped bool // Whether evaluation stopped before every file was evaluated.
+	var overBudget, canceled, pastDeadline bool
+	if opts.Progress != nil {
+		opts.Progress.begin(f.Sums())
+	}
+	f.Sums().setMinGroupSize(opts.MinGroupSize)
+	f.Sums().setLongReport(opts.LongReport)
+	f.Sums().setCrossDirOnly(opts.CrossDirOnly && !opts.SameDirOnly && opts.Canonical == nil)
+	f.Sums().setGroupOrder(opts.GroupOrder)
+	f.Sums().setLinkPaths(opts.LinkPaths)
+	start := time.Now()
+	f.Sums().started(opts, start)
+	f.Start()
+	out := newOutput(opts)
+	uniq, dup, errc, cancel := f.Uniq(), f.Dup(), f.Err(), opts.Cancel
+	exceeded := opts.budget.C()
+	var deadline <-chan time.Time
+	if !opts.Deadline.IsZero() {
+		timer := time.NewTimer(time.Until(opts.Deadline))
+		defer timer.Stop()
+		deadline = timer.C
+	}
+loop:
+	for uniq != nil || dup != nil || errc != nil {
+		select {
+		case <-exceeded:
+			stopped, overBudget = true, true
+			exceeded = nil
+			f.Drain()
+		case <-deadline:
+			stopped, pastDeadline = true, true
+			deadline = nil
+			f.Drain()
+		case <-cancel:
+			stopped, canceled = true, true
+			if opts.GracefulCancel {
+				cancel = nil // Keep receiving until the files under way are done.
+				f.Drain()
+				continue
+			}
+			f.Cancel()
+			break loop
+		case err, ok := <-errc:
+			if !ok {
+				errc = nil // Closed: stop receiving.
+				continue
+			}
+			if path := errPath(err); opts.OnFile != nil && path != "" {
+				opts.OnFile(File{Path: path}, "", false, err)
+			}
+			if link, ok := err.(*BrokenLinkError); ok && opts.BrokenLinkWriter != nil {
+				_, _ = fmt.Fprintln(opts.BrokenLinkWriter, link.Path)
+				continue
+			}
+			if opts.ErrWriter != nil && !opts.GroupErrors {
+				_, _ = fmt.Fprintln(opts.ErrWriter, err)
+			}
+			if opts.Metrics != nil {
+				opts.Metrics.Error()
+			}
+			errors = append(errors, err)
+			if opts.ExitOnError {
+				stopped = true
+				f.Cancel()
+				break loop
+			}
+		case r, ok := <-dup:
+			if !ok {
+				dup = nil
+				continue
+			}
+			written := time.Now()
+			out.println(opts.DupWriter, opts.LinkPaths.line(r.Path, r.Link))
+			onFile(opts, r)
+			if opts.DupSink != nil {
+				if err := opts.DupSink.Write(r); err != nil {
+					errors = append(errors, err)
+				}
+			}
+			f.Sums().timed(outputTime, time.Since(written))
+			if opts.ExitOnDup {
+				stopped = true
+				f.Cancel()
+				break loop
+			}
+		case r, ok := <-uniq:
+			if !ok {
+				uniq = nil
+				continue
+			}
+			written := time.Now()
+			out.println(opts.UniqWriter, opts.LinkPaths.line(r.Path, r.Link))
+			onFile(opts, r)
+			if opts.UniqSink != nil {
+				if err := opts.UniqSink.Write(r); err != nil {
+					errors = append(errors, err)
+				}
+			}
+			f.Sums().timed(outputTime, time.Since(written))
+		}
+	}
+	written := time.Now()
+	dropped := out.close()
+	for _, sink := range []Sink{opts.UniqSink, opts.DupSink} {
+		if sink == nil {
+			continue
+		}
+		if err := sink.Flush(); err != nil {
+			errors = append(errors, err)
+		}
+	}
+	sums = f.Sums()
+	sums.timed(outputTime, time.Since(written))
+	sums.timed(elapsedTime, time.Since(start))
+	sums.finished(time.Now())
+	sums.errored(len(errors))
+	sums.dropped(dropped)
+	if overBudget {
+		errors = append(errors, opts.budget.err())
+	}
+	if stopped {
+		sums.stopped()
+	}
+	if opts.ErrWriter != nil && opts.GroupErrors {
+		for _, g := range errors.Rollup() {
+			_, _ = fmt.Fprintln(opts.ErrWriter, g)
+		}
+	}
+	if canceled {
+		errors = append(errors, ErrCanceled)
+	}
+	if pastDeadline {
+		errors = append(errors, ErrDeadlineExceeded)
+	}
+	if len(errors) > 0 {
+		err = errors
+	}
+	return
+}
+
+// onFile passes r to the OnFile callback of opts, if set.
+func onFile(opts *Options, r Result) {
+	if opts.OnFile != nil {
+		opts.OnFile(File{Path: r.Path, Info: r.Info, Digests: r.Digests}, r.Sum, r.Dup, nil)
+	}
+}
+
+// signal provides a broadcast mechanism by exposing a receive-only channel
+// that is guaranteed to be closed only once, when Once is called.
+type signal struct {
+	c    chan struct{}
+	once *sync.Once
+}
+
+func newSignal() *signal {
+	return &signal{
+		c:    make(chan struct{}),
+		once: new(sync.Once),
+	}
+}
+
+// C returns a receive-only view of the channel managed by s. Subscribers
+// will receive the zero value for the channel when s.Once is called.
+func (s *signal) C() <-chan struct{} { return s.c }
+
+// Once closes the channel managed by s the first time it is called.
+// Subsequent calls of Once have no effect.
+func (s *signal) Once() {
+	s.once.Do(func() { close(s.c) })
+}
+
+// readLines returns an unbuffered channel on which the file paths in the
+// newline-delimited text lines read from r are sent, as parsed by p. The
+// channel is closed when all lines have been read from r.
+func readLines(r io.Reader, p InputParser) <-chan listedFile {
+	c := make(chan listedFile)
+	go func() {
+		defer close(c)
+		s := bufio.NewScanner(r)
+		for s.Scan() {
+			if path, ok := p.ParseLine(s.Text()); ok {
+				c <- listedFile{path: path}
+			}
+		}
+	}()
+	return c
+}
+
+// lstat wraps fs.Lstat, resolving symbolic links for which follow, if not
+// nil, returns true given the path each leads to, as resolved by resolveLink. If path is a symbolic link
+// so followed, info will be the os.FileInfo of the linked file and newPath
+// will be its path; otherwise, info will be the os.FileInfo of the file
+// located at path, and newPath will be equal to path. If the target of a
+// followed link does not exist, err will be a *BrokenLinkError; otherwise, a
+// non-nil err will be an *Error.
+func lstat(fs filesys.FileSystem, path string, follow func(target string) bool) (info os.FileInfo, newPath string, err error) {
+	info, err = fs.Lstat(path)
+	if err != nil {
+		err = newError("lstat", path, err)
+		return
+	}
+	newPath = path
+	if follow != nil && isSymlink(info) {
+		var target string
+		target, err = fs.Readlink(path)
+		if err != nil {
+			err = newError("readlink", path, err)
+			return
+		}
+		resolved := resolveLink(path, target)
+		if !follow(resolved) {
+			return
+		}
+		newPath = resolved
+		info, err = fs.Lstat(newPath)
+		if os.IsNotExist(err) {
+			err = &BrokenLinkError{Path: path, Target: target}
+		} else if err != nil {
+			err = newError("lstat", newPath, err)
+		}
+	}
+	return
+}
+
+// resolveLink returns the path of the file that target, as read from the
+// symbolic link located at path, leads to: a relative target is relative to
+// the directory of the link, not to the working directory.
+func resolveLink(path, target string) string {
+	if filepath.IsAbs(target) || filesys.IsURL(target) {
+		return target
+	}
+	return filepath.Join(filepath.Dir(path), target)
+}
+
+// followAll is passed to lstat to follow every link.
+func followAll(string) bool { return true }
+
+// lstat is like the lstat function with the file system of opts, following
+// links under the FollowSymlinks and FollowWithinRoot options.
+func (opts *Options) lstat(path string) (os.FileInfo, string, error) {
+	switch {
+	case opts.FollowSymlinks:
+		return lstat(opts.FileSystem, path, followAll)
+	case opts.FollowWithinRoot:
+		return lstat(opts.FileSystem, path, func(target string) bool { return withinRoots(target, opts.linkRoots) })
+	}
+	return lstat(opts.FileSystem, path, nil)
+}
+
+// followsLinks reports whether any links are followed under opts.
+func (opts *Options) followsLinks() bool {
+	return opts.FollowSymlinks || opts.FollowWithinRoot && len(opts.linkRoots) > 0
+}
+
+// skipsLink reports whether info, as returned by opts.lstat, describes a
+// link left unfollowed under FollowWithinRoot, since it leads out of the
+// roots. Such a link is skipped rather than opened, which would read its
+// target.
+func (opts *Options) skipsLink(info os.FileInfo) bool {
+	return !opts.FollowSymlinks && opts.FollowWithinRoot && len(opts.linkRoots) > 0 && isSymlink(info)
+}
+
+// withinRoots reports whether the file located at path lies within one of the
+// directories located at roots, comparing their absolute paths.
+func withinRoots(path string, roots []string) bool {
+	if filesys.IsURL(path) {
+		return false
+	}
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return false
+	}
+	for _, root := range roots {
+		if filesys.IsURL(root) {
+			continue
+		}
+		r, err := filepath.Abs(root)
+		if err != nil {
+			continue
+		}
+		if rel, err := filepath.Rel(r, abs); err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+// isSymlink reports whether info describes a symbolic link, or a junction on
+// Windows, which are followed like symbolic links under FollowSymlinks.
+func isSymlink(info os.FileInfo) bool {
+	return info.Mode()&os.ModeSymlink == os.ModeSymlink || isDirLink(info)
+}
+
+// isSpecial reports whether info describes a named pipe, socket, device, or
+// other file that is neither regular, a directory, nor a symbolic link.
+func isSpecial(info os.FileInfo) bool {
+	return info.Mode()&(os.ModeNamedPipe|os.ModeSocket|os.ModeDevice|os.ModeCharDevice|os.ModeIrregular) != 0 && !isDirLink(info)
+}
+
+// mergeErrors returns a receive-only channel on which errors received from
+// each channel in ins are sent. The channel will be closed once all values
+// have been received from each channel in ins. Once stop is closed, such as
+// when the filter whose errors are merged is canceled and they are no longer
+// received, errors are received from ins and dropped, so that neither their
+// senders nor the goroutines forwarding them block forever.
+func mergeErrors(stop <-chan struct{}, ins ...<-chan error) <-chan error {
+	var wg sync.WaitGroup
+	out := make(chan error)
+	multiplex := func(in <-chan error) {
+		defer wg.Done()
+		for err := range in {
+			select {
+			case <-stop: // Keep receiving, so that senders do not block.
+			case out <- err:
+			}
+		}
+	}
+	wg.Add(len(ins))
+	for _, in := range ins {
+		go multiplex(in)
+	}
+	go func() {
+		wg.Wait()
+		close(out)
+	}()
+	return out
+}
+
+var maxProcs = effectiveProcs()
+
+// effectiveProcs returns the lesser of runtime.GOMAXPROCS(0) and the number
+// of CPUs allowed by the CPU quota of the process, if any, so that worker
+// pools in a constrained container do not oversubscribe the CPUs available.
+func effectiveProcs() int {
+	n := runtime.GOMAXPROCS(0)
+	if limit, ok := cpuLimit(); ok && limit < n {
+		n = limit
+	}
+	return n
+}
+
+// ratioMaxProcs returns the greater of maxProcs*n/d and 1.
+func ratioMaxProcs(n, d int) int {
+	if x := maxProcs * n / d; x >= 1 {
+		return x
+	}
+	return 1
+}
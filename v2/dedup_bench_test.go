@@ -0,0 +1,156 @@
+package dedup_test
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2"
+)
+
+var (
+	dir = flag.String("dedup.dir", "", "The directory from which FilterDir should read.")
+)
+
+func TestMain(m *testing.M) {
+	flag.Parse()
+	os.Exit(m.Run())
+}
+
+// BenchmarkFilterDir evaluates the tree under -dedup.dir; see also
+// BenchmarkFilterDirDisk, which evaluates synthetic trees.
+func BenchmarkFilterDir(b *testing.B) {
+	if *dir == "" {
+		b.Skip("-dedup.dir not specified")
+	}
+
+	opts := new(dedup.Options)
+	opts.Recursive = true
+
+	var result dedup.Stats
+	for i := 0; i < b.N; i++ {
+		sums, err := dedup.FilterDir(*dir, opts)
+		if err != nil {
+			b.Fatalf("unexpected error: %v\n", err)
+		}
+		result = sums.Stats()
+	}
+	b.SetBytes(int64(result.NumBytes))
+
+	b.Logf("Examined %d files (%d B) and found %d (%d B) duplicates.\n",
+		result.NumFiles, result.NumBytes, result.NumDupFiles, result.NumDupBytes)
+}
+
+// BenchmarkFilter evaluates the files under -dedup.dir, listed as paths
+// read by Filter.
+func BenchmarkFilter(b *testing.B) {
+	if *dir == "" {
+		b.Skip("-dedup.dir not specified")
+	}
+
+	var paths strings.Builder
+	err := filepath.Walk(*dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			fmt.Fprintln(&paths, path)
+		}
+		return err
+	})
+	if err != nil {
+		b.Fatalf("unexpected error: %v\n", err)
+	}
+	b.ResetTimer()
+
+	var n uint64
+	for i := 0; i < b.N; i++ {
+		sums, err := dedup.Filter(strings.NewReader(paths.String()), new(dedup.Options))
+		if err != nil {
+			b.Fatalf("unexpected error: %v\n", err)
+		}
+		n = sums.Stats().NumBytes
+	}
+	b.SetBytes(int64(n))
+}
+
+// benchAlgorithms are the Options.Algorithm values compared by benchmarks.
+var benchAlgorithms = []string{"sha1", "sha256", "blake3"}
+
+// BenchmarkHashReader compares the algorithms on inputs of the sizes of
+// small documents, photos, and videos.
+func BenchmarkHashReader(b *testing.B) {
+	for _, size := range []int{4 << 10, 4 << 20, 64 << 20} {
+		data := make([]byte, size)
+		rand.New(rand.NewSource(1)).Read(data)
+		for _, algo := range benchAlgorithms {
+			b.Run(fmt.Sprintf("%s/%dKiB", algo, size>>10), func(b *testing.B) {
+				b.SetBytes(int64(size))
+				for i := 0; i < b.N; i++ {
+					if _, err := dedup.HashReader(bytes.NewReader(data), algo); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkFilterDirAlgorithm compares the algorithms on the tree under
+// -dedup.dir, or else on a tree of many small files and a few large ones,
+// some of them duplicates.
+func BenchmarkFilterDirAlgorithm(b *testing.B) {
+	root := *dir
+	if root == "" {
+		var err error
+		if root, err = benchTree(); err != nil {
+			b.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+	}
+	for _, algo := range benchAlgorithms {
+		b.Run(algo, func(b *testing.B) {
+			var n uint64
+			for i := 0; i < b.N; i++ {
+				sums, err := dedup.FilterDir(root, &dedup.Options{Recursive: true, Algorithm: algo})
+				if err != nil {
+					b.Fatal(err)
+				}
+				n = sums.Stats().NumBytes
+			}
+			b.SetBytes(int64(n))
+		})
+	}
+}
+
+// benchTree writes a tree of 1000 files of 16 KiB and 8 files of 16 MiB,
+// a tenth of them copies of others, to a temporary directory.
+func benchTree() (string, error) {
+	root, err := ioutil.TempDir("", "dedup-bench")
+	if err != nil {
+		return "", err
+	}
+	rnd := rand.New(rand.NewSource(1))
+	write := func(name string, size int, i int) error {
+		data := make([]byte, size)
+		rnd.Read(data)
+		if i%10 == 9 {
+			rand.New(rand.NewSource(int64(size))).Read(data)
+		}
+		return ioutil.WriteFile(filepath.Join(root, name), data, 0644)
+	}
+	for i := 0; i < 1000; i++ {
+		if err := write(fmt.Sprintf("small-%d", i), 16<<10, i); err != nil {
+			return "", err
+		}
+	}
+	for i := 0; i < 8; i++ {
+		if err := write(fmt.Sprintf("large-%d", i), 16<<20, i); err != nil {
+			return "", err
+		}
+	}
+	return root, nil
+}
@@ -0,0 +1,1181 @@
+package dedup
+
+import (
+	"archive/zip"
+	"bytes"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+var (
+	Dup1    = randBytes(1e6)
+	Dup2    = randBytes(1e6)
+	Dup3    = randBytes(1e6)
+	Dup1Sum = sha1Sum(Dup1)
+	Dup2Sum = sha1Sum(Dup2)
+	Dup3Sum = sha1Sum(Dup3)
+
+	Files = map[string][]byte{
+		"dup1":                 Dup1,
+		"other/dup3":           Dup3,
+		"other/lime":           []byte("lime"),
+		"root/black":           []byte("black"),
+		"root/dup2":            Dup2,
+		"root/err":             nil,
+		"root/foo/bar/dup1":    Dup1,
+		"root/foo/baz/err":     nil,
+		"root/foo/bar/green":   []byte("green"),
+		"root/foo/baz/dup2":    Dup2,
+		"root/foo/baz/yellow":  []byte("yellow"),
+		"root/foo/blue":        []byte("blue"),
+		"root/foo/dup3":        Dup3,
+		"root/foo/err":         nil,
+		"root/link":            []byte("../dup1"), // symlink => dup1
+		"root/red":             []byte("red"),
+		"root/qux/quux/aqua":   []byte("aqua"),
+		"root/qux/quux/dup1":   Dup1,
+		"root/qux/quux/link":   []byte("../../../other"), // symlink => other
+		"root/qux/quuz/dup2":   Dup2,
+		"root/qux/quuz/err":    nil,
+		"root/qux/quuz/purple": []byte("purple"),
+		"root/qux/dup3":        Dup3,
+		"root/qux/err":         nil,
+		"root/qux/fuchsia":     []byte("fuchsia"),
+	}
+
+	FS filesys.FileSystem = testFS{
+		filesys.Map(Files, []string{"root/link", "root/qux/quux/link"}),
+		map[string]string{
+			"root/foo/baz/err":  "permission denied",
+			"root/foo/err":      "permission denied",
+			"root/qux/quuz/err": "permission denied",
+			"root/qux/err":      "permission denied",
+			"root/err":          "permission denied",
+		},
+	}
+)
+
+type testFS struct {
+	filesys.FileSystem
+	errs map[string]string // Paths to causes of errors opening them.
+}
+
+func (fs testFS) Open(path string) (filesys.File, error) {
+	if s, ok := fs.errs[path]; ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: errors.New(s)}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+// dupString returns a string for sum and paths in the format
+// used by WriteAllDup.
+func dupString(sum Digest, paths ...string) string {
+	var b strings.Builder
+	b.WriteString(fmt.Sprintf("%x:\n", sum))
+	for _, path := range paths {
+		b.WriteString(fmt.Sprintf("- %q\n", path))
+	}
+	return b.String()
+}
+
+// sha1Sum returns the Digest of b computed by the default matcher.
+func sha1Sum(b []byte) Digest {
+	sum := sha1.Sum(b)
+	return Digest(sum[:])
+}
+
+func randBytes(n int64) []byte {
+	b := make([]byte, n)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return b
+}
+
+func pathReader(paths ...string) io.Reader {
+	return strings.NewReader(strings.Join(paths, "\n") + "\n")
+}
+
+func TestFilter(t *testing.T) {
+	tests := []struct {
+		r     io.Reader
+		opts  *Options
+		check func(*Sums, error)
+	}{
+		{
+			r:    strings.NewReader(""),
+			opts: &Options{FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				if got := sums.Stats().NumFiles; got != 0 {
+					t.Errorf("1: Stats().NumFiles = %d; want 0", got)
+				}
+				if err != nil {
+					t.Errorf("1: unexpected error: %v", err)
+				}
+			},
+		},
+		{
+			r: pathReader(
+				"root/black",
+				"root/dup2",
+				"root/err",
+				"root/foo/bar/dup1",
+				"root/foo/baz/err",
+				"root/foo/bar/green",
+				"root/foo/baz/dup2",
+				"root/foo/baz/yellow",
+				"root/foo/blue",
+				"root/foo/dup3",
+				"root/foo/err",
+				"root/link",
+				"root/red",
+				"root/qux/quux/aqua",
+				"root/qux/quux/dup1",
+				"root/qux/quux/link",
+				"root/qux/quuz/dup2",
+				"root/qux/quuz/err",
+				"root/qux/quuz/purple",
+				"root/qux/dup3",
+				"root/qux/err",
+				"root/qux/fuchsia",
+			),
+			opts: &Options{FollowSymlinks: true, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				want := uint64(16) // root/**/* = 22 files, less 5 errors, less 1 symlink to a directory
+				if got := sums.Stats().NumFiles; got != want {
+					t.Errorf("2: Stats().NumFiles = %d; want %d", got, want)
+				}
+				checkSums(t, "2: ", sums, []string{
+					dupString(Dup1Sum, "dup1", "root/foo/bar/dup1", "root/qux/quux/dup1"),
+					dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2", "root/qux/quuz/dup2"),
+					dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+				})
+				checkErrors(t, "2: ", err, []string{
+					"open root/foo/baz/err: permission denied",
+					"open root/foo/err: permission denied",
+					"open root/qux/quuz/err: permission denied",
+					"open root/qux/err: permission denied",
+					"open root/err: permission denied",
+				})
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt.check(Filter(tt.r, tt.opts))
+	}
+}
+
+func TestFilterDir(t *testing.T) {
+	tests := []struct {
+		path  string
+		opts  *Options
+		check func(*Sums, error)
+	}{
+		{
+			path: "bogus",
+			opts: &Options{FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				if err == nil || err.Error() != "lstat bogus: file does not exist" {
+					t.Errorf("1: got %v; want lstat bogus: file does not exist", err)
+				}
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				want := uint64(4) // root/{black,dup2,link,red}
+				if got := sums.Stats().NumFiles; got != want {
+					t.Errorf("2: Stats().NumFiles = %d; want %d", got, want)
+				}
+				checkErrors(t, "2: ", err, []string{
+					"open root/err: permission denied",
+				})
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{FollowSymlinks: true, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				want := uint64(4) // dup1, root/{black,dup2,red}
+				if got := sums.Stats().NumFiles; got != want {
+					t.Errorf("3: Stats().NumFiles = %d; want %d", got, want)
+				}
+				checkErrors(t, "3: ", err, []string{
+					"open root/err: permission denied",
+				})
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{Recursive: true, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				checkSums(t, "4: ", sums, []string{
+					dupString(Dup1Sum, "root/foo/bar/dup1", "root/qux/quux/dup1"),
+					dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2", "root/qux/quuz/dup2"),
+					dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+				})
+				checkErrors(t, "4: ", err, []string{
+					"open root/foo/baz/err: permission denied",
+					"open root/foo/err: permission denied",
+					"open root/qux/quuz/err: permission denied",
+					"open root/qux/err: permission denied",
+					"open root/err: permission denied",
+				})
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{Recursive: true, FollowSymlinks: true, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				checkSums(t, "5: ", sums, []string{
+					dupString(Dup1Sum, "dup1", "root/foo/bar/dup1", "root/qux/quux/dup1"),
+					dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2", "root/qux/quuz/dup2"),
+					dupString(Dup3Sum, "other/dup3", "root/foo/dup3", "root/qux/dup3"),
+				})
+				checkErrors(t, "5: ", err, []string{
+					"open root/foo/baz/err: permission denied",
+					"open root/foo/err: permission denied",
+					"open root/qux/quuz/err: permission denied",
+					"open root/qux/err: permission denied",
+					"open root/err: permission denied",
+				})
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{Recursive: true, MaxDepth: 2, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				want := uint64(8) // root/{black,dup2,link,red}, root/{foo,qux}/*
+				if got := sums.Stats().NumFiles; got != want {
+					t.Errorf("6: Stats().NumFiles = %d; want %d", got, want)
+				}
+				checkSums(t, "6: ", sums, []string{
+					dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+				})
+				checkErrors(t, "6: ", err, []string{
+					"open root/foo/err: permission denied",
+					"open root/qux/err: permission denied",
+					"open root/err: permission denied",
+				})
+			},
+		},
+		{
+			path: "root",
+			opts: &Options{Recursive: true, MaxDepth: 1, FileSystem: FS},
+			check: func(sums *Sums, err error) {
+				want := uint64(4) // root/{black,dup2,link,red}
+				if got := sums.Stats().NumFiles; got != want {
+					t.Errorf("7: Stats().NumFiles = %d; want %d", got, want)
+				}
+			},
+		},
+	}
+	for _, tt := range tests {
+		tt.check(FilterDir(tt.path, tt.opts))
+	}
+}
+
+func TestFilterPaths(t *testing.T) {
+	tests := []struct {
+		paths []string
+		opts  *Options
+		want  []string
+	}{
+		{
+			paths: []string{"root/foo/bar", "other", "dup1"},
+			opts:  &Options{FileSystem: FS},
+			want: []string{
+				dupString(Dup1Sum, "dup1", "root/foo/bar/dup1"),
+			},
+		},
+		{
+			// root/qux and other/ lie within directories given, and dup1 is
+			// given twice.
+			paths: []string{"root/qux", "other/", "root", "dup1", "other", "./dup1"},
+			opts:  &Options{Recursive: true, FileSystem: FS},
+			want: []string{
+				dupString(Dup1Sum, "dup1", "root/foo/bar/dup1", "root/qux/quux/dup1"),
+				dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2", "root/qux/quuz/dup2"),
+				dupString(Dup3Sum, "other/dup3", "root/foo/dup3", "root/qux/dup3"),
+			},
+		},
+	}
+	for i, tt := range tests {
+		sums, _ := FilterPaths(tt.paths, tt.opts)
+		checkSums(t, fmt.Sprintf("%d: ", i+1), sums, tt.want)
+	}
+
+	// Under MaxDepth, root/qux is read although it lies within root, since
+	// its files lie deeper below root than root is read.
+	sums, _ := FilterPaths([]string{"root/qux", "root"}, &Options{Recursive: true, MaxDepth: 1, FileSystem: FS})
+	want := uint64(6) // root/{black,dup2,link,red}, root/qux/{dup3,fuchsia}
+	if got := sums.Stats().NumFiles; got != want {
+		t.Errorf("Stats().NumFiles = %d; want %d", got, want)
+	}
+}
+
+func TestRootsIgnoreCase(t *testing.T) {
+	paths := []string{"root", "Root/Qux", "ROOT", "other"}
+	tests := []struct {
+		ignoreCase bool
+		want       []string
+	}{
+		{false, []string{"root", "Root/Qux", "ROOT", "other"}},
+		{true, []string{"root", "other"}},
+	}
+	for _, tt := range tests {
+		got := roots(paths, &Options{Recursive: true, IgnoreCase: tt.ignoreCase})
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("IgnoreCase %v: roots(%q) = %q; want %q", tt.ignoreCase, paths, got, tt.want)
+		}
+	}
+}
+
+func TestFilterDirBrokenLinks(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/file":    []byte("file"),
+		"root/link":    []byte("file"),
+		"root/dangle1": []byte("missing"),
+		"root/dangle2": []byte("../missing"),
+	}, []string{"root/link", "root/dangle1", "root/dangle2"})
+
+	_, err := FilterDir("root", &Options{FollowSymlinks: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, []string{
+		"root/dangle1: broken symbolic link to missing",
+		"root/dangle2: broken symbolic link to ../missing",
+	})
+	for _, e := range err.(Errors) {
+		if _, ok := e.(*BrokenLinkError); !ok {
+			t.Errorf("1: want *BrokenLinkError; got %#v", e)
+		}
+	}
+
+	var buf bytes.Buffer
+	sums, err := FilterDir("root", &Options{FollowSymlinks: true, BrokenLinkWriter: &buf, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	if got, want := buf.String(), "root/dangle1\nroot/dangle2\n"; got != want &&
+		got != "root/dangle2\nroot/dangle1\n" {
+		t.Errorf("2: BrokenLinkWriter got %q; want %q", got, want)
+	}
+	// root/link leads to root/file, which is evaluated once.
+	if got := sums.Stats().NumFiles; got != 1 {
+		t.Errorf("2: Stats().NumFiles = %d; want 1", got)
+	}
+	sums.RangeDigests(func(sum Digest, files []*File) bool {
+		if got := fmt.Sprintf("%s %v", files[0].Path, files[0].Links); got != "root/file [root/link]" {
+			t.Errorf("2: Path, Links = %s; want root/file [root/link]", got)
+		}
+		return true
+	})
+}
+
+func TestFilterDirRelativeLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.MkdirAll(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// Neither target exists relative to the working directory.
+	for link, target := range map[string]string{"sub/valid": "../file", "sub/dangle": "file"} {
+		if err := os.Symlink(target, filepath.Join(root, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+
+	var buf bytes.Buffer
+	sums, err := FilterDir(root, &Options{Recursive: true, FollowSymlinks: true, BrokenLinkWriter: &buf})
+	checkErrors(t, "", err, nil)
+	if got, want := buf.String(), filepath.Join(root, "sub/dangle")+"\n"; got != want {
+		t.Errorf("BrokenLinkWriter got %q; want %q", got, want)
+	}
+	files, _ := sums.GetDigest(sha1Sum([]byte("file")))
+	if want := []string{filepath.Join(root, "sub/valid")}; len(files) != 1 || !reflect.DeepEqual(files[0].Links, want) {
+		t.Errorf("files of file = %v; want 1 linked to by %v", files, want)
+	}
+}
+
+func TestFilterListedTwice(t *testing.T) {
+	r := pathReader("root/dup2", "root/foo/baz/dup2", "root/dup2")
+	sums, err := Filter(r, &Options{FileSystem: FS})
+	checkErrors(t, "1: ", err, nil)
+	checkSums(t, "1: ", sums, []string{dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2")})
+	if st := sums.Stats(); st.NumDupFiles != 1 || st.FilesSkipped != 1 {
+		t.Errorf("1: NumDupFiles, FilesSkipped = %d, %d; want 1, 1", st.NumDupFiles, st.FilesSkipped)
+	}
+
+	sums, err = Filter(pathReader("dup1", "root/link"), &Options{FollowSymlinks: true, FileSystem: FS})
+	checkErrors(t, "2: ", err, nil)
+	files, _ := sums.GetDigest(Dup1Sum)
+	if len(files) != 1 || files[0].Path != "dup1" || fmt.Sprint(files[0].Links) != "[root/link]" {
+		t.Errorf("2: Get() = %v; want dup1, linked to by root/link", files)
+	}
+
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "file")
+	if err := ioutil.WriteFile(path, []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	sep := string(filepath.Separator)
+	sums, err = Filter(pathReader(path, dir+sep+"."+sep+"file", dir+sep+sep+"file"), &Options{})
+	checkErrors(t, "3: ", err, nil)
+	if st := sums.Stats(); st.NumFiles != 1 || st.FilesSkipped != 2 {
+		t.Errorf("3: NumFiles, FilesSkipped = %d, %d; want 1, 2", st.NumFiles, st.FilesSkipped)
+	}
+}
+
+func TestFilterDirSymlinkTargets(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/file":    []byte("file"),
+		"root/l1":      []byte("file"),
+		"root/l2":      []byte("file"),
+		"root/sub/l3":  []byte("../file"),
+		"root/sub/dup": []byte("file"),
+	}, []string{"root/l1", "root/l2", "root/sub/l3"})
+
+	sums, err := FilterDir("root", &Options{Recursive: true, FollowSymlinks: true, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	// Only root/sub/dup is a duplicate of root/file; the links are not.
+	checkSums(t, "", sums, []string{dupString(sha1Sum([]byte("file")), "root/file", "root/sub/dup")})
+	if st := sums.Stats(); st.NumDupFiles != 1 || st.FilesSkipped != 3 {
+		t.Errorf("NumDupFiles, FilesSkipped = %d, %d; want 1, 3", st.NumDupFiles, st.FilesSkipped)
+	}
+	files, _ := sums.GetDigest(sha1Sum([]byte("file")))
+	for _, file := range files {
+		sort.Strings(file.Links)
+		want := "[]"
+		if file.Path == "root/file" {
+			want = "[root/l1 root/l2 root/sub/l3]"
+		}
+		if got := fmt.Sprint(file.Links); got != want {
+			t.Errorf("%s: Links = %s; want %s", file.Path, got, want)
+		}
+	}
+}
+
+func TestFilterLinkPaths(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"a/file":    []byte("file"),
+		"root/dup":  []byte("file"),
+		"root/link": []byte("../a/file"),
+	}, []string{"root/link"})
+
+	for i, tt := range []struct {
+		links LinkPaths
+		lines []string
+		text  string
+	}{
+		{LinkTargets, []string{"a/file", "root/dup"}, `- "a/file"`},
+		{LinkSources, []string{"root/dup", "root/link"}, `- "root/link"`},
+		{LinkSourcesAndTargets, []string{"root/dup\troot/dup", "root/link\ta/file"}, `- "root/link" (symbolic link to "a/file")`},
+	} {
+		var out bytes.Buffer
+		opts := &Options{FollowSymlinks: true, LinkPaths: tt.links, UniqWriter: &out, DupWriter: &out, FileSystem: fs}
+		sums, err := Filter(pathReader("root/dup", "root/link"), opts)
+		checkErrors(t, fmt.Sprintf("%d: ", i), err, nil)
+		lines := strings.Split(strings.TrimSuffix(out.String(), "\n"), "\n")
+		sort.Strings(lines)
+		if !reflect.DeepEqual(lines, tt.lines) {
+			t.Errorf("%d: wrote %q; want %q", i, lines, tt.lines)
+		}
+		out.Reset()
+		if err := sums.WriteAllDup(&out); err != nil || !strings.Contains(out.String(), tt.text+"\n") {
+			t.Errorf("%d: WriteAllDup() = %v, wrote %q; want %s", i, err, out.String(), tt.text)
+		}
+	}
+
+	var out bytes.Buffer
+	sums, _ := Filter(pathReader("root/dup", "root/link"), &Options{FollowSymlinks: true, LinkPaths: LinkSourcesAndTargets, FileSystem: fs})
+	_ = sums.WriteReport(&out, FormatCSV)
+	if got := out.String(); !strings.HasPrefix(got, "sum,size,path,link,target\n") || !strings.Contains(got, ",root/link,,a/file\n") || !strings.Contains(got, ",root/dup,,root/dup\n") {
+		t.Errorf("WriteReport(csv) = %q; want targets", got)
+	}
+}
+
+func TestFilterDirFollowWithinRoot(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/file":  []byte("file"),
+		"root/in":    []byte("file"),
+		"root/out":   []byte("../other/file"),
+		"other/file": []byte("file"),
+	}, []string{"root/in", "root/out"})
+
+	sums, err := FilterDir("root", &Options{FollowWithinRoot: true, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	// root/out leads out of root, so it is skipped, and other/file not
+	// evaluated at all.
+	if st := sums.Stats(); st.NumFiles != 1 || st.FilesSkipped != 2 {
+		t.Errorf("NumFiles, FilesSkipped = %d, %d; want 1, 2", st.NumFiles, st.FilesSkipped)
+	}
+	files, _ := sums.GetDigest(sha1Sum([]byte("file")))
+	if got := fmt.Sprintf("%d %s %v", len(files), files[0].Path, files[0].Links); got != "1 root/file [root/in]" {
+		t.Errorf("files of file = %s; want 1 root/file [root/in]", got)
+	}
+
+	// The same on disk, with a relative link within the root and an
+	// absolute one out of it, whose target must not be read.
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for name, contents := range map[string]string{"root/sub/file": "file", "other/file": "other"} {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"root/in": "sub/file", "root/out": filepath.Join(dir, "other/file")} {
+		if err := os.Symlink(target, filepath.Join(dir, link)); err != nil {
+			t.Skip(err)
+		}
+	}
+	sums, err = FilterDir(filepath.Join(dir, "root"), &Options{Recursive: true, FollowWithinRoot: true})
+	checkErrors(t, "disk: ", err, nil)
+	files, _ = sums.GetDigest(sha1Sum([]byte("file")))
+	if want := []string{filepath.Join(dir, "root/in")}; len(files) != 1 || !reflect.DeepEqual(files[0].Links, want) {
+		t.Errorf("disk: files of file = %v; want 1 linked to by %v", files, want)
+	}
+	if sums.Contains(sha1Sum([]byte("other"))) || sums.Stats().BytesRead != 4 {
+		t.Errorf("disk: root/out was read; BytesRead = %d, want 4", sums.Stats().BytesRead)
+	}
+}
+
+func TestFilterDirArchives(t *testing.T) {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, b := range map[string][]byte{"dup1": Dup1, "sub/dup2": Dup2, "sub/lime": []byte("lime")} {
+		f, _ := w.Create(name)
+		_, _ = f.Write(b)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	fs := filesys.Map(map[string][]byte{
+		"root/dup1":       Dup1,
+		"root/a/copy.zip": buf.Bytes(),
+		"root/b/copy.zip": buf.Bytes(),
+		"root/bad.zip":    []byte("bad"),
+	}, nil)
+
+	sums, err := FilterDir("root", &Options{Recursive: true, Archives: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, []string{
+		"lstat root/bad.zip!: zip: not a valid zip file",
+	})
+	checkSums(t, "1: ", sums, []string{
+		dupString(Dup1Sum, "root/a/copy.zip!/dup1", "root/b/copy.zip!/dup1", "root/dup1"),
+		dupString(Dup2Sum, "root/a/copy.zip!/sub/dup2", "root/b/copy.zip!/sub/dup2"),
+		dupString(sha1Sum([]byte("lime")), "root/a/copy.zip!/sub/lime", "root/b/copy.zip!/sub/lime"),
+		dupString(sha1Sum(buf.Bytes()), "root/a/copy.zip", "root/b/copy.zip"),
+	})
+
+	sums, err = FilterDir("root", &Options{Recursive: true, MaxDepth: 3, Archives: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, []string{
+		"lstat root/bad.zip!: zip: not a valid zip file",
+	})
+	if got := sums.Stats().NumFiles; got != 6 { // Less archive members at depth 3.
+		t.Errorf("2: Stats().NumFiles = %d; want 6", got)
+	}
+}
+
+// vanishFS simulates files that are deleted after being listed.
+type vanishFS struct {
+	filesys.FileSystem
+	vanished map[string]bool
+}
+
+func (fs vanishFS) Open(path string) (filesys.File, error) {
+	if fs.vanished[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrNotExist}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+func (fs vanishFS) Lstat(path string) (os.FileInfo, error) {
+	if fs.vanished[path] {
+		return nil, &os.PathError{Op: "lstat", Path: path, Err: os.ErrNotExist}
+	}
+	return fs.FileSystem.Lstat(path)
+}
+
+func TestFilterDirVanished(t *testing.T) {
+	fs := vanishFS{
+		filesys.Map(map[string][]byte{
+			"root/file1":     []byte("file1"),
+			"root/file2":     []byte("file2"),
+			"root/sub/file3": []byte("file3"),
+		}, nil),
+		map[string]bool{"root/file2": true, "root/sub": true},
+	}
+
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	if got := sums.Stats(); got.NumFiles != 1 || got.NumVanished != 2 {
+		t.Errorf("1: Stats() = %+v; want 1 file, 2 vanished", got)
+	}
+
+	sums, err = FilterDir("root", &Options{Recursive: true, ReportVanished: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, []string{
+		"lstat root/file2: file does not exist",
+		"lstat root/sub: file does not exist",
+	})
+	if got := sums.Stats().NumVanished; got != 0 {
+		t.Errorf("2: Stats().NumVanished = %d; want 0", got)
+	}
+
+	sums, err = Filter(pathReader("root/file1", "root/file2"), &Options{FileSystem: fs})
+	checkErrors(t, "3: ", err, []string{
+		"lstat root/file2: file does not exist",
+	})
+	if got := sums.Stats().NumVanished; got != 0 {
+		t.Errorf("3: Stats().NumVanished = %d; want 0", got)
+	}
+}
+
+func checkSums(t *testing.T, prefix string, sums *Sums, want []string) {
+	var buf bytes.Buffer
+	if err := sums.WriteAllDup(&buf); err != nil {
+		t.Errorf("%sWriteAllDup() = %v", prefix, err)
+		return
+	}
+
+	s := buf.String()
+	for _, dup := range want {
+		if i := strings.Index(s, dup); i >= 0 {
+			s = s[:i] + s[i+len(dup):] // Found dup; remove it from s
+		} else {
+			t.Errorf("%swant WriteAllDup to write:\n%s", prefix, dup)
+		}
+	}
+	if s != "" {
+		t.Errorf("%sdid not want WriteAllDup to write:\n%s", prefix, s)
+	}
+}
+
+func checkErrors(t *testing.T, prefix string, err error, want []string) {
+	if want == nil {
+		if err != nil {
+			t.Errorf("%serr = %#v; want <nil>", prefix, err)
+		}
+		return
+	}
+
+	errs, ok := err.(Errors)
+	if !ok {
+		t.Errorf("%swant err.(Errors); got %#v", prefix, err)
+		return
+	}
+
+	seen := make(map[string]bool)
+	for _, got := range errs {
+		g := got.Error()
+		for _, w := range want {
+			if g == w {
+				seen[g] = true
+				break
+			}
+		}
+		if !seen[g] {
+			t.Errorf("%sdid not want err.(Errors) to include: %#v", prefix, g)
+		}
+	}
+	for _, w := range want {
+		if !seen[w] {
+			t.Errorf("%swant err.(Errors) to include: %s", prefix, w)
+		}
+	}
+}
+
+// specialFS simulates special files, such as named pipes and devices, whose
+// contents are read as for regular files.
+type specialFS struct {
+	filesys.FileSystem
+	modes map[string]os.FileMode
+}
+
+func (fs specialFS) Lstat(path string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(path)
+	if mode, ok := fs.modes[path]; ok && err == nil {
+		return specialInfo{info, mode}, nil
+	}
+	return info, err
+}
+
+type specialInfo struct {
+	os.FileInfo
+	mode os.FileMode
+}
+
+func (i specialInfo) Mode() os.FileMode { return i.mode }
+
+func TestFilterDirSpecial(t *testing.T) {
+	fs := specialFS{
+		filesys.Map(map[string][]byte{
+			"root/file": []byte("same"),
+			"root/fifo": []byte("same"),
+			"root/tty":  []byte("same"),
+		}, nil),
+		map[string]os.FileMode{
+			"root/fifo": os.ModeNamedPipe,
+			"root/tty":  os.ModeDevice | os.ModeCharDevice,
+		},
+	}
+
+	sums, err := FilterDir("root", &Options{FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	if got := sums.Stats(); got.NumFiles != 1 || got.NumSpecial != 2 {
+		t.Errorf("1: Stats() = %+v; want 1 file, 2 special", got)
+	}
+
+	sums, err = Filter(pathReader("root/file", "root/fifo"), &Options{IncludeSpecial: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	if got := sums.Stats(); got.NumFiles != 2 || got.NumDupFiles != 1 || got.NumSpecial != 0 {
+		t.Errorf("2: Stats() = %+v; want 2 files, 1 duplicate, 0 special", got)
+	}
+}
+
+func TestFilterDirRegexp(t *testing.T) {
+	tests := []struct {
+		opts *Options
+		want []string
+	}{
+		{
+			opts: &Options{Recursive: true, MatchRegexp: regexp.MustCompile(`(?i)/DUP1$`), FileSystem: FS},
+			want: []string{
+				dupString(Dup1Sum, "root/foo/bar/dup1", "root/qux/quux/dup1"),
+			},
+		},
+		{
+			// Directories are excluded by their paths with a trailing
+			// separator; root/qux/dup3 is excluded as a file.
+			opts: &Options{Recursive: true, ExcludeRegexp: regexp.MustCompile(`/(quux|baz)/|qux/dup3`), FileSystem: FS},
+			want: []string{
+				dupString(Dup2Sum, "root/dup2", "root/qux/quuz/dup2"),
+			},
+		},
+	}
+	for i, tt := range tests {
+		sums, _ := FilterDir("root", tt.opts)
+		checkSums(t, fmt.Sprintf("%d: ", i+1), sums, tt.want)
+	}
+
+	opts := &Options{ExcludeRegexp: regexp.MustCompile(`/black$`), FileSystem: FS}
+	sums, _ := Filter(pathReader("root/black", "root/red"), opts)
+	if got := sums.Stats().NumFiles; got != 1 {
+		t.Errorf("Filter() evaluated %d files; want 1", got)
+	}
+}
+
+func TestFilterDirSkipHidden(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		".root/file":        []byte("same"),
+		".root/.hidden":     []byte("same"),
+		".root/.git/object": []byte("same"),
+		".root/sub/file":    []byte("same"),
+	}, nil)
+	for _, tt := range []struct {
+		skip bool
+		want uint64
+	}{
+		{false, 4},
+		{true, 2}, // .root itself is read, since it is given.
+	} {
+		sums, err := FilterDir(".root", &Options{Recursive: true, SkipHidden: tt.skip, FileSystem: fs})
+		checkErrors(t, "", err, nil)
+		if got := sums.Stats().NumFiles; got != tt.want {
+			t.Errorf("SkipHidden %v: Stats().NumFiles = %d; want %d", tt.skip, got, tt.want)
+		}
+	}
+}
+
+func TestFilterDirReadStats(t *testing.T) {
+	// root/qux/quux and root/foo/baz are excluded as directories, and
+	// root/qux/dup3 as a file.
+	opts := &Options{Recursive: true, ExcludeRegexp: regexp.MustCompile(`/(quux|baz)/|qux/dup3`), FileSystem: FS}
+	sums, err := FilterDir("root", opts)
+	st := sums.Stats()
+	if st.FilesSkipped != 3 {
+		t.Errorf("FilesSkipped = %d; want 3", st.FilesSkipped)
+	}
+	if errs, _ := err.(Errors); st.ErrorsCount != uint64(len(errs)) || len(errs) == 0 {
+		t.Errorf("ErrorsCount = %d; want %d", st.ErrorsCount, len(errs))
+	}
+	// Files that failed to open were not read; the others were read whole.
+	if st.BytesRead != st.NumBytes {
+		t.Errorf("BytesRead = %d; want NumBytes = %d", st.BytesRead, st.NumBytes)
+	}
+}
+
+func TestFilterDirGracefulCancel(t *testing.T) {
+	for _, graceful := range []bool{false, true} {
+		cancel := make(chan struct{})
+		var once sync.Once
+		stop := StageFunc(func(r *Result) error {
+			once.Do(func() { close(cancel) })
+			return nil
+		})
+		results := NewCollector(-1)
+		opts := &Options{
+			Recursive:      true,
+			Cancel:         cancel,
+			GracefulCancel: graceful,
+			Stages:         &Stages{Report: []Stage{stop}},
+			UniqSink:       results,
+			DupSink:        results,
+			FileSystem:     FS,
+		}
+		sums, err := FilterDir("root", opts)
+		if !sums.Partial() {
+			t.Errorf("GracefulCancel %v: Partial() = false; want true", graceful)
+		}
+		if !errors.Is(err, ErrCanceled) {
+			t.Errorf("GracefulCancel %v: err = %v; want ErrCanceled", graceful, err)
+		}
+		// Every file evaluated was reported, whereas the last files evaluated
+		// may be abandoned without GracefulCancel.
+		if n := len(results.Results()); graceful && uint64(n) != sums.Stats().NumFiles {
+			t.Errorf("GracefulCancel %v: %d results reported; want NumFiles = %d", graceful, n, sums.Stats().NumFiles)
+		}
+	}
+
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	if sums.Partial() || errors.Is(err, ErrCanceled) {
+		t.Errorf("Partial(), err = true, %v after a complete evaluation; want false, no ErrCanceled", err)
+	}
+}
+
+// lstatFS is a FileSystem that counts calls to Lstat.
+type lstatFS struct {
+	filesys.FileSystem
+	n *uint64
+}
+
+func (fs lstatFS) Lstat(path string) (os.FileInfo, error) {
+	atomic.AddUint64(fs.n, 1)
+	return fs.FileSystem.Lstat(path)
+}
+
+func TestFilterDirLstatOnce(t *testing.T) {
+	fs := lstatFS{filesys.Map(map[string][]byte{
+		"root/a":     []byte("a"),
+		"root/b":     []byte("a"),
+		"root/sub/c": []byte("c"),
+	}, nil), new(uint64)}
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: fs})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := sums.Stats().NumFiles; got != 3 {
+		t.Errorf("Stats().NumFiles = %d; want 3", got)
+	}
+	// Each file is stat'ed once, as its directory is read. root/sub is
+	// stat'ed then and when it is read itself, and root when it is read and
+	// to choose the number of workers.
+	if got := atomic.LoadUint64(fs.n); got != 7 {
+		t.Errorf("Lstat called %d times; want 7", got)
+	}
+}
+
+func TestFilterDirMinGroupSize(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a1": []byte("a"),
+		"root/a2": []byte("a"),
+		"root/a3": []byte("a"),
+		"root/b1": []byte("b"),
+		"root/b2": []byte("b"),
+	}, nil)
+	dup := NewCollector(-1)
+	sums, err := FilterDir("root", &Options{MinGroupSize: 3, DupSink: dup, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+
+	// The second copy of a is reported along with the third; b has too few
+	// copies to be reported at all.
+	results := dup.Results()
+	if len(results) != 2 || results[0].Sum != sha1Sum([]byte("a")) || results[1].Sum != sha1Sum([]byte("a")) {
+		t.Errorf("duplicates reported = %v; want 2 copies of a", results)
+	}
+	var buf bytes.Buffer
+	if err := sums.WriteAllDup(&buf); err != nil {
+		t.Fatal(err)
+	}
+	if got := buf.String(); strings.Contains(got, "root/b") || !strings.Contains(got, "root/a3") {
+		t.Errorf("WriteAllDup() wrote %q; want only the group of a", got)
+	}
+	if got := sums.Stats().NumDupFiles; got != 3 {
+		t.Errorf("Stats().NumDupFiles = %d; want 3", got)
+	}
+}
+
+// timeFS is a FileSystem whose files have the modification times returned by
+// modTime for the nth call to Lstat for their paths, from 0.
+type timeFS struct {
+	filesys.FileSystem
+	modTime func(path string, n int) time.Time
+	mu      *sync.Mutex
+	n       map[string]int
+}
+
+func (fs timeFS) Lstat(path string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(path)
+	if err != nil || info.IsDir() {
+		return info, err
+	}
+	fs.mu.Lock()
+	n := fs.n[path]
+	fs.n[path]++
+	fs.mu.Unlock()
+	return timeInfo{info, fs.modTime(path, n)}, nil
+}
+
+type timeInfo struct {
+	os.FileInfo
+	modTime time.Time
+}
+
+func (i timeInfo) ModTime() time.Time { return i.modTime }
+
+func TestFilterDirSkipModifiedWithin(t *testing.T) {
+	start := time.Now()
+	fs := timeFS{filesys.Map(map[string][]byte{
+		"root/new":     []byte("a"),
+		"root/old":     []byte("a"),
+		"root/growing": []byte("a"),
+	}, nil), func(path string, n int) time.Time {
+		switch path {
+		case "root/new":
+			return start
+		case "root/growing":
+			return start.Add(time.Duration(n-60) * time.Minute)
+		}
+		return start.Add(-time.Hour)
+	}, new(sync.Mutex), make(map[string]int)}
+
+	sums, err := FilterDir("root", &Options{SkipModifiedWithin: time.Minute, DetectChanges: true, FileSystem: fs})
+	checkErrors(t, "", err, []string{"root/growing: file changed while being read"})
+	if got := sums.Stats(); got.NumFiles != 1 || got.FilesSkipped != 1 {
+		t.Errorf("Stats() = %+v; want 1 file, 1 skipped", got)
+	}
+	if files, _ := sums.GetDigest(sha1Sum([]byte("a"))); len(files) != 1 || files[0].Path != "root/old" {
+		t.Errorf("Get(a) = %v; want root/old", files)
+	}
+}
+
+// hangFS is a FileSystem whose files located at paths in hang cannot be read
+// until release is closed, or until they are closed, which is then sent on
+// closed.
+type hangFS struct {
+	filesys.FileSystem
+	hang    map[string]bool
+	release chan struct{}
+	closed  chan string
+}
+
+func (fs hangFS) Open(path string) (filesys.File, error) {
+	file, err := fs.FileSystem.Open(path)
+	if err != nil || !fs.hang[path] {
+		return file, err
+	}
+	return &hangFile{File: file, fs: fs, path: path, done: make(chan struct{})}, nil
+}
+
+type hangFile struct {
+	filesys.File
+	fs   hangFS
+	path string
+	once sync.Once
+	done chan struct{}
+}
+
+func (f *hangFile) Read(b []byte) (int, error) {
+	select {
+	case <-f.fs.release:
+		return f.File.Read(b)
+	case <-f.done:
+		return 0, os.ErrClosed
+	}
+}
+
+func (f *hangFile) Close() error {
+	f.once.Do(func() {
+		close(f.done)
+		f.fs.closed <- f.path
+	})
+	return f.File.Close()
+}
+
+func TestFilterDirPerFileTimeout(t *testing.T) {
+	fs := hangFS{filesys.Map(map[string][]byte{
+		"root/a":    []byte("a"),
+		"root/b":    []byte("a"),
+		"root/hang": []byte("a"),
+	}, nil), map[string]bool{"root/hang": true}, make(chan struct{}), make(chan string, 1)}
+	defer close(fs.release)
+
+	sums, err := FilterDir("root", &Options{PerFileTimeout: 50 * time.Millisecond, ReadRetries: 3, FileSystem: fs})
+	checkErrors(t, "", err, []string{"read root/hang: i/o timeout"})
+	if errs, ok := err.(Errors); ok && !errors.Is(errs[0], os.ErrDeadlineExceeded) {
+		t.Errorf("err = %#v; want os.ErrDeadlineExceeded", errs[0])
+	}
+	// The file timed out is closed, so that its read gives up, without
+	// recording anything, rather than hang.
+	select {
+	case <-fs.closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("root/hang was not closed once timed out")
+	}
+	if got := sums.Stats(); got.NumFiles != 2 || got.NumDupFiles != 1 || got.BytesRead != 2 {
+		t.Errorf("Stats() = %+v; want 2 files, 1 duplicate, 2 bytes read", got)
+	}
+}
+
+// permFS is a filesys.FileSystem that denies permission to open or read some
+// paths.
+type permFS struct {
+	filesys.FileSystem
+	denied map[string]bool
+}
+
+func (fs permFS) Open(path string) (filesys.File, error) {
+	if fs.denied[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+func (fs permFS) Readdirnames(path string) ([]string, error) {
+	if fs.denied[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+	}
+	return fs.FileSystem.Readdirnames(path)
+}
+
+func TestFilterDirSkipUnreadable(t *testing.T) {
+	fs := permFS{filesys.Map(map[string][]byte{
+		"root/a":        []byte("a"),
+		"root/b":        []byte("a"),
+		"root/secret":   []byte("s"),
+		"root/locked/c": []byte("c"),
+	}, nil), map[string]bool{"root/secret": true, "root/locked": true}}
+
+	_, err := FilterDir("root", &Options{Recursive: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, []string{
+		"open root/locked: permission denied",
+		"open root/secret: permission denied",
+	})
+
+	sums, err := FilterDir("root", &Options{Recursive: true, SkipUnreadable: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	if got := sums.Stats(); got.PermissionDenied != 2 || got.ErrorsCount != 0 || got.NumDupFiles != 1 {
+		t.Errorf("2: Stats() = %+v; want 2 denied, no errors, 1 duplicate", got)
+	}
+}
+
+func TestFilterDirBudget(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("root/%02d", i)] = []byte("0123456789")
+	}
+	fs := filesys.Map(files, nil)
+
+	for _, tt := range []struct {
+		opts  Options
+		files int
+	}{
+		{Options{MaxFiles: 5}, 5},
+		{Options{MaxTotalBytes: 35}, 3},
+		{Options{MaxFiles: 5, MaxTotalBytes: 1000}, 5},
+		{Options{MaxFiles: 20}, 20},
+	} {
+		opts := tt.opts
+		opts.FileSystem = fs
+		sums, err := FilterDir("root", &opts)
+		st := sums.Stats()
+		if st.NumFiles != uint64(tt.files) || st.NumBytes != uint64(10*tt.files) {
+			t.Errorf("%+v: Stats() = %v; want %d files", tt.opts, st, tt.files)
+		}
+		if tt.files == 20 {
+			checkErrors(t, "", err, nil)
+			continue
+		}
+		errs, _ := err.(Errors)
+		if len(errs) != 1 {
+			t.Fatalf("%+v: err = %v; want *BudgetExceededError", tt.opts, err)
+		}
+		if e, ok := errs[0].(*BudgetExceededError); !ok || e.Files != tt.files || e.Bytes != int64(10*tt.files) {
+			t.Errorf("%+v: err = %#v; want %d files", tt.opts, errs[0], tt.files)
+		}
+		if !sums.Partial() {
+			t.Errorf("%+v: Partial() = false; want true", tt.opts)
+		}
+	}
+}
+
+func TestFilterDirDeadline(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("root/%02d", i)] = []byte("0123456789")
+	}
+	fs := filesys.Map(files, nil)
+
+	// One file at a time, each taking 10ms, so that the deadline falls
+	// midway.
+	slow := StageFunc(func(r *Result) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	opts := &Options{Deadline: time.Now().Add(50 * time.Millisecond), ReportHeader: true, LowPriority: true, Stages: &Stages{Stat: []Stage{slow}}, FileSystem: fs}
+	sums, err := FilterDir("root", opts)
+	if !reflect.DeepEqual(err, Errors{ErrDeadlineExceeded}) {
+		t.Errorf("FilterDir() = %v; want %v", err, ErrDeadlineExceeded)
+	}
+	if st := sums.Stats(); st.NumFiles == 0 || st.NumFiles >= 20 {
+		t.Errorf("Stats() = %v; want some of the 20 files", st)
+	}
+	if !sums.Partial() {
+		t.Error("Partial() = false; want true")
+	}
+	var buf bytes.Buffer
+	_ = sums.WriteReport(&buf, FormatJSON)
+	var r report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil || !r.Partial || r.Header == nil || !r.Header.Partial {
+		t.Errorf("WriteReport() = %s, %v; want it marked partial", buf.Bytes(), err)
+	}
+
+	// Without a deadline, or before it, every file is evaluated.
+	for _, deadline := range []time.Time{{}, time.Now().Add(time.Hour)} {
+		sums, err := FilterDir("root", &Options{Deadline: deadline, FileSystem: fs})
+		checkErrors(t, "", err, nil)
+		if st := sums.Stats(); st.NumFiles != 20 || sums.Partial() {
+			t.Errorf("Deadline %v: Stats() = %v, Partial() = %v; want 20 files, complete", deadline, st, sums.Partial())
+		}
+	}
+}
@@ -0,0 +1,16 @@
+//go:build windows || plan9
+// +build windows plan9
+
+package dedup
+
+import "os"
+
+// device always reports that info does not carry a device ID.
+func device(info os.FileInfo) (dev uint64, ok bool) {
+	return
+}
+
+// fileID always reports that info does not carry device and inode numbers.
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	return
+}
@@ -0,0 +1,29 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package dedup
+
+import (
+	"os"
+	"syscall"
+)
+
+// device returns the ID of the device containing the file described by info.
+// ok will be false if info does not carry a device ID.
+func device(info os.FileInfo) (dev uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return uint64(st.Dev), true
+}
+
+// fileID returns the device and inode numbers of the file described by info.
+// ok will be false if info does not carry them.
+func fileID(info os.FileInfo) (dev, ino uint64, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok || st.Ino == 0 {
+		return 0, 0, false
+	}
+	return uint64(st.Dev), uint64(st.Ino), true
+}
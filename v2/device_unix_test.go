@@ -0,0 +1,69 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package dedup
+
+import (
+	"os"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// devFS reports the device of each path as that of its longest prefix in
+// devs.
+type devFS struct {
+	filesys.FileSystem
+	devs map[string]uint64
+}
+
+func (fs devFS) Lstat(path string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(path)
+	if err != nil {
+		return nil, err
+	}
+	var dev uint64
+	var n int // Length of longest matching prefix.
+	for p, d := range fs.devs {
+		if len(p) > n && strings.HasPrefix(path, p) {
+			dev, n = d, len(p)
+		}
+	}
+	return devInfo{info, dev}, nil
+}
+
+type devInfo struct {
+	os.FileInfo
+	dev uint64
+}
+
+func (i devInfo) Sys() interface{} {
+	st := new(syscall.Stat_t)
+	v := reflect.ValueOf(st).Elem().FieldByName("Dev")
+	if k := v.Kind(); k >= reflect.Uint && k <= reflect.Uintptr {
+		v.SetUint(i.dev)
+	} else {
+		v.SetInt(int64(i.dev))
+	}
+	return st
+}
+
+func TestFilterDirOneFileSystem(t *testing.T) {
+	fs := devFS{FS, map[string]uint64{"root": 1, "root/qux": 2}}
+
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: fs})
+	if got := sums.Stats().NumFiles; got != 17 {
+		t.Errorf("1: Stats().NumFiles = %d; want 17", got)
+	}
+
+	sums, _ = FilterDir("root", &Options{Recursive: true, OneFileSystem: true, FileSystem: fs})
+	checkSums(t, "2: ", sums, []string{
+		dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2"),
+	})
+	if got := sums.Stats().NumFiles; got != 10 { // root/**/* less root/qux/**/*
+		t.Errorf("2: Stats().NumFiles = %d; want 10", got)
+	}
+}
@@ -0,0 +1,145 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// Diff lists the differences between two Sums, such as indexes of the same
+// directory written by WriteIndex at different times, as returned by
+// Sums.Diff. Files are compared by path.
+type Diff struct {
+	Added      []DiffFile  `json:"added"`      // Files at paths only in the newer Sums.
+	Removed    []DiffFile  `json:"removed"`    // Files at paths only in the older Sums.
+	Changed    []DiffFile  `json:"changed"`    // Files at paths in both whose checksums differ.
+	Duplicated []DiffGroup `json:"duplicated"` // Files sharing checksums that fewer than two files had in the older Sums.
+}
+
+// DiffFile is a file listed in a Diff.
+type DiffFile struct {
+	Path   string `json:"path"`
+	Sum    string `json:"sum"`              // Hex-encoded checksum of the file, in the older Sums if removed.
+	OldSum string `json:"oldSum,omitempty"` // Hex-encoded checksum of the file in the older Sums, if changed.
+}
+
+// DiffGroup is a group of newly duplicated files listed in a Diff.
+type DiffGroup struct {
+	Sum   string   `json:"sum"`   // Hex-encoded checksum shared by the files.
+	Paths []string `json:"paths"` // Sorted.
+}
+
+// Diff returns the differences from s, taken as the older Sums, to newer.
+// Each list in the Diff is sorted by path, or by checksum for Duplicated.
+func (s *Sums) Diff(newer *Sums) *Diff {
+	oldSums, oldCounts := pathSums(s)
+	newSums, _ := pathSums(newer)
+
+	d := &Diff{Added: []DiffFile{}, Removed: []DiffFile{}, Changed: []DiffFile{}, Duplicated: []DiffGroup{}}
+	for path, sum := range newSums {
+		oldSum, ok := oldSums[path]
+		switch {
+		case !ok:
+			d.Added = append(d.Added, DiffFile{Path: path, Sum: hex.EncodeToString([]byte(sum))})
+		case oldSum != sum:
+			d.Changed = append(d.Changed, DiffFile{
+				Path:   path,
+				Sum:    hex.EncodeToString([]byte(sum)),
+				OldSum: hex.EncodeToString([]byte(oldSum)),
+			})
+		}
+	}
+	for path, sum := range oldSums {
+		if _, ok := newSums[path]; !ok {
+			d.Removed = append(d.Removed, DiffFile{Path: path, Sum: hex.EncodeToString([]byte(sum))})
+		}
+	}
+	for _, files := range [][]DiffFile{d.Added, d.Removed, d.Changed} {
+		sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	}
+
+	newer.RangeDigests(func(sum Digest, files []*File) bool {
+		if len(files) < 2 || oldCounts[sum] >= 2 {
+			return true
+		}
+		g := DiffGroup{Sum: hex.EncodeToString([]byte(sum))}
+		for _, file := range sortedFiles(files) {
+			g.Paths = append(g.Paths, file.Path)
+		}
+		d.Duplicated = append(d.Duplicated, g)
+		return true
+	})
+	sort.Slice(d.Duplicated, func(i, j int) bool { return d.Duplicated[i].Sum < d.Duplicated[j].Sum })
+	return d
+}
+
+// pathSums returns the checksum of each file in s by path, and the number of
+// files under each checksum.
+func pathSums(s *Sums) (map[string]Digest, map[Digest]int) {
+	sums := make(map[string]Digest)
+	counts := make(map[Digest]int)
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		for _, file := range files {
+			sums[file.Path] = sum
+		}
+		counts[sum] = len(files)
+		return true
+	})
+	return sums, counts
+}
+
+// Empty reports whether d lists no differences.
+func (d *Diff) Empty() bool {
+	return len(d.Added) == 0 && len(d.Removed) == 0 && len(d.Changed) == 0 && len(d.Duplicated) == 0
+}
+
+// WriteJSON writes d to w as an indented JSON document.
+func (d *Diff) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(d, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteText writes d to w in the following format:
+//
+//	added "/path/to/file1"
+//	removed "/path/to/file2"
+//	changed "/path/to/file3" (<old checksum> -> <checksum>)
+//	duplicated <checksum>: "/path/to/file4" "/path/to/file5"
+//	...
+func (d *Diff) WriteText(w io.Writer) error {
+	for _, f := range d.Added {
+		if _, err := fmt.Fprintf(w, "added %q\n", f.Path); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.Removed {
+		if _, err := fmt.Fprintf(w, "removed %q\n", f.Path); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.Changed {
+		if _, err := fmt.Fprintf(w, "changed %q (%s -> %s)\n", f.Path, f.OldSum, f.Sum); err != nil {
+			return err
+		}
+	}
+	for _, g := range d.Duplicated {
+		if _, err := fmt.Fprintf(w, "duplicated %s:", g.Sum); err != nil {
+			return err
+		}
+		for _, path := range g.Paths {
+			if _, err := fmt.Fprintf(w, " %q", path); err != nil {
+				return err
+			}
+		}
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,57 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestSumsDiff(t *testing.T) {
+	older, newer := NewSums(), NewSums()
+	add := func(sums *Sums, key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add(older, "aqua", "/kept")
+	add(older, "blue", "/changed")
+	add(older, "gray", "/removed")
+	add(older, "lime", "/dup1")
+	add(older, "lime", "/dup2")
+	add(newer, "aqua", "/kept")
+	add(newer, "navy", "/changed")
+	add(newer, "aqua", "/added")
+	add(newer, "lime", "/dup1")
+	add(newer, "lime", "/dup2")
+	add(newer, "lime", "/dup3")
+
+	d := older.Diff(newer)
+	hexSum := func(key string) string { return fmt.Sprintf("%x", keySum[key]) }
+	want := &Diff{
+		Added:      []DiffFile{{Path: "/added", Sum: hexSum("aqua")}, {Path: "/dup3", Sum: hexSum("lime")}},
+		Removed:    []DiffFile{{Path: "/removed", Sum: hexSum("gray")}},
+		Changed:    []DiffFile{{Path: "/changed", Sum: hexSum("navy"), OldSum: hexSum("blue")}},
+		Duplicated: []DiffGroup{{Sum: hexSum("aqua"), Paths: []string{"/added", "/kept"}}},
+	}
+	if !reflect.DeepEqual(d, want) {
+		t.Errorf("Diff() = %+v; want %+v", d, want)
+	}
+	if d.Empty() {
+		t.Error("Empty() = true; want false")
+	}
+
+	var buf bytes.Buffer
+	if err := d.WriteText(&buf); err != nil {
+		t.Fatal(err)
+	}
+	wantText := fmt.Sprintf(`added "/added"
+added "/dup3"
+removed "/removed"
+changed "/changed" (%s -> %s)
+duplicated %s: "/added" "/kept"
+`, hexSum("blue"), hexSum("navy"), hexSum("aqua"))
+	if got := buf.String(); got != wantText {
+		t.Errorf("WriteText() wrote:\n%s\nwant:\n%s", got, wantText)
+	}
+
+	if d := newer.Diff(newer); !d.Empty() {
+		t.Errorf("Diff() of itself = %+v; want no differences", d)
+	}
+}
@@ -0,0 +1,144 @@
+package dedup
+
+import (
+	"crypto/md5"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// digestFuncs holds the hash functions that may be named in Options.Digests.
+var digestFuncs = map[string]func() hash.Hash{
+	"blake3": newBLAKE3,
+	"md5":    md5.New,
+	"sha1":   sha1.New,
+	"sha256": sha256.New,
+	"sha512": sha512.New,
+}
+
+// HashFile returns the digest of the contents of the file located at path in
+// fs computed by the hash function named algo, one of the digests supported
+// by Options.Digests, along with the os.FileInfo of the file read. Symbolic
+// links are followed, and errors are reported as they are by Filter: if the
+// target of a link does not exist, err will be a *BrokenLinkError; otherwise,
+// a non-nil err will be an *Error, unless algo is not supported. If fs is nil,
+// the local file system is used, and paths may also be URLs as for FilterDir.
+// The "sha1" digest of a file equals its Digest under the default Options.
+func HashFile(fs filesys.FileSystem, path, algo string) (Digest, os.FileInfo, error) {
+	if err := checkDigests([]string{algo}); err != nil {
+		return "", nil, err
+	}
+	if fs == nil {
+		fs = filesys.URLs(filesys.OS())
+	}
+	info, path, err := lstat(fs, path, followAll)
+	if err != nil {
+		return "", nil, err
+	}
+	r, err := fs.Open(path)
+	if err != nil {
+		return "", nil, newError("open", path, err)
+	}
+	defer r.Close()
+	sum, err := HashReader(r, algo)
+	if err != nil {
+		return "", nil, newError("read", path, err)
+	}
+	return sum, info, nil
+}
+
+// HashReader returns the digest of the data read from r until EOF, computed
+// by the hash function named algo as in HashFile.
+func HashReader(r io.Reader, algo string) (Digest, error) {
+	if err := checkDigests([]string{algo}); err != nil {
+		return "", err
+	}
+	d := newDigester([]string{algo})
+	buf := hashBufs.Get()
+	defer hashBufs.Put(buf)
+	if _, err := buf.ReadFrom(r); err != nil {
+		return "", err
+	}
+	_, _ = d.Write(buf.Bytes())
+	return d.sums()[algo], nil
+}
+
+// contentSum returns the checksum of the contents b of a file under the
+// Algorithm option algo, which is to have been checked with checkAlgorithms.
+func contentSum(b []byte, algo string) Digest {
+	if algo == "" || algo == "sha1" {
+		sum := sha1.Sum(b)
+		return Digest(sum[:])
+	}
+	h := digestFuncs[algo]()
+	_, _ = h.Write(b)
+	return Digest(h.Sum(nil))
+}
+
+// hashBufs holds the buffers into which HashReader reads data, as a
+// chanFilter does before computing checksums.
+var hashBufs = newBufferPool(BufferConfig{})
+
+// checkAlgorithms returns an error if the Algorithm or Digests options name
+// a digest that is not supported.
+func (opts *Options) checkAlgorithms() error {
+	if opts.Algorithm != "" {
+		if err := checkDigests([]string{opts.Algorithm}); err != nil {
+			return err
+		}
+	}
+	return checkDigests(opts.Digests)
+}
+
+// checkDigests returns an error if names contains a digest that is not
+// supported.
+func checkDigests(names []string) error {
+	for _, name := range names {
+		if _, ok := digestFuncs[name]; !ok {
+			return fmt.Errorf("dedup: unknown digest %q", name)
+		}
+	}
+	return nil
+}
+
+// digester is an io.Writer that computes several digests of the data written
+// to it at once.
+type digester struct {
+	names  []string
+	hashes []hash.Hash
+}
+
+// newDigester returns a *digester computing the digests named in names, which
+// are to have been checked with checkDigests, or nil if names is empty.
+func newDigester(names []string) *digester {
+	if len(names) == 0 {
+		return nil
+	}
+	d := &digester{names: names}
+	for _, name := range names {
+		d.hashes = append(d.hashes, digestFuncs[name]())
+	}
+	return d
+}
+
+func (d *digester) Write(b []byte) (int, error) {
+	for _, h := range d.hashes {
+		_, _ = h.Write(b) // Never returns an error.
+	}
+	return len(b), nil
+}
+
+// sums returns the digests of the data written to d by name.
+func (d *digester) sums() map[string]Digest {
+	sums := make(map[string]Digest, len(d.names))
+	for i, name := range d.names {
+		sums[name] = Digest(d.hashes[i].Sum(nil))
+	}
+	return sums
+}
@@ -0,0 +1,99 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDigests(t *testing.T) {
+	md5Sum, sha256Sum := md5.Sum(Dup1), sha256.Sum256(Dup1)
+	want := map[string]Digest{"md5": Digest(md5Sum[:]), "sha256": Digest(sha256Sum[:])}
+
+	dup := NewCollector(-1)
+	sums, _ := FilterDir("root", &Options{Recursive: true, Digests: []string{"sha256", "md5"}, DupSink: dup, FileSystem: FS})
+	for _, r := range dup.Results() {
+		if r.Sum == Dup1Sum && !reflect.DeepEqual(r.Digests, want) {
+			t.Errorf("%s: Result.Digests = %x; want %x", r.Path, r.Digests, want)
+		}
+	}
+	files, _ := sums.GetDigest(Dup1Sum)
+	if len(files) != 2 {
+		t.Fatalf("Get(Dup1Sum) = %d files; want 2", len(files))
+	}
+	for _, file := range files {
+		if !reflect.DeepEqual(file.Digests, want) {
+			t.Errorf("%s: Digests = %x; want %x", file.Path, file.Digests, want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := sums.WriteAllDup(&buf); err != nil {
+		t.Fatalf("WriteAllDup() = %v", err)
+	}
+	group := fmt.Sprintf("%x:\n  md5: %x\n  sha256: %x\n- %q\n", Dup1Sum, md5Sum, sha256Sum, "root/foo/bar/dup1")
+	if !strings.Contains(buf.String(), group) {
+		t.Errorf("WriteAllDup() wrote:\n%s\nwant it to contain:\n%s", buf.String(), group)
+	}
+
+	buf.Reset()
+	if err := sums.WriteIndex(&buf); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	loaded, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatalf("ReadIndex() = %v", err)
+	}
+	files, _ = loaded.GetDigest(Dup1Sum)
+	for _, file := range files {
+		if !reflect.DeepEqual(file.Digests, want) {
+			t.Errorf("%s: loaded Digests = %x; want %x", file.Path, file.Digests, want)
+		}
+	}
+
+	_, err = FilterDir("root", &Options{Digests: []string{"crc32"}, FileSystem: FS})
+	checkErrors(t, "unknown: ", err, []string{`dedup: unknown digest "crc32"`})
+}
+
+func TestHashFile(t *testing.T) {
+	sum, info, err := HashFile(FS, "root/dup2", "sha1")
+	if err != nil || sum != Dup2Sum || info.Size() != int64(len(Dup2)) {
+		t.Errorf("HashFile(root/dup2) = %x, %v, %v; want %x, size %d, <nil>", sum, info, err, Dup2Sum, len(Dup2))
+	}
+	if _, _, err := HashFile(FS, "root/err", "sha1"); err == nil || err.Error() != "open root/err: permission denied" {
+		t.Errorf("HashFile(root/err) = %v; want open error", err)
+	}
+
+	fs := filesys.Map(map[string][]byte{
+		"root/file":   []byte("file"),
+		"root/link":   []byte("file"),
+		"root/dangle": []byte("missing"),
+	}, []string{"root/link", "root/dangle"})
+	want := sha256.Sum256([]byte("file"))
+	if sum, info, err := HashFile(fs, "root/link", "sha256"); err != nil || sum != Digest(want[:]) || isSymlink(info) {
+		t.Errorf("HashFile(root/link) = %x, %v, %v; want %x of root/file", sum, info, err, want)
+	}
+	if _, _, err := HashFile(fs, "root/dangle", "sha256"); !errors.As(err, new(*BrokenLinkError)) {
+		t.Errorf("HashFile(root/dangle) = %v; want *BrokenLinkError", err)
+	}
+	if _, _, err := HashFile(fs, "root/file", "crc32"); err == nil {
+		t.Error("HashFile(crc32) = nil; want error")
+	}
+}
+
+func TestHashReader(t *testing.T) {
+	want := md5.Sum(Dup3)
+	if sum, err := HashReader(bytes.NewReader(Dup3), "md5"); err != nil || sum != Digest(want[:]) {
+		t.Errorf("HashReader(md5) = %x, %v; want %x, <nil>", sum, err, want)
+	}
+	if _, err := HashReader(bytes.NewReader(Dup3), "crc32"); err == nil {
+		t.Error("HashReader(crc32) = nil; want error")
+	}
+}
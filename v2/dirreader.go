@@ -0,0 +1,530 @@
+package dedup
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// dirReader concurrently reads the files and directories located at roots
+// and sends files on out, along with their os.FileInfo if they were stat'ed
+// while reading, errors on err.
+type dirReader struct {
+	// Number of file paths sent on out, accessed atomically: first so that it is
+	// 64-bit aligned on 32-bit platforms.
+	emitted uint64
+	blocked int64 // Nanoseconds spent waiting to send on out when recording Timings, accessed atomically.
+
+	roots []string // Paths of files and directories to be read.
+	depth int      // Depth of roots; see dirItem.
+	opts  *Options
+	sums  *Sums // Record vanished files and Timings, if not nil.
+
+	numProcs  int            // Number of worker goroutines to start.
+	busyProcs sync.WaitGroup // Coordinate active worker goroutines.
+
+	// Directories to be read are pushed onto pending; workers pop the most
+	// recently pushed directory, so that pending stays short on deep trees.
+	// Enqueueing never blocks: once pending holds maxPendingDirs directories,
+	// the older half is moved to spill, and read back once pending is empty.
+	// active counts the directories being read: reading is done once pending
+	// and spill are empty and active is 0. Back-pressure is applied by out,
+	// which is bounded.
+	mu        sync.Mutex
+	cond      *sync.Cond // Signaled when pending grows, or active drops to 0.
+	pending   []dirItem
+	spill     *os.File // Batches of directories moved from pending, if not nil.
+	spillEnds []int64  // Offsets in spill at which each batch ends.
+	spillErr  error    // First error writing or reading spill.
+	spillSent bool     // Whether spillErr was sent on err.
+	active    int
+	paused    bool // Whether workers wait instead of reading pending; see pause.
+	resumed   bool // Whether pending was restored by resume instead of holding root.
+
+	// visited records the directories read when links are followed, so
+	// that a link to one of their ancestors does not make reading loop.
+	visitedMu sync.Mutex
+	visited   map[visitKey]bool
+
+	out    chan listedFile // Outgoing files.
+	err    chan error      // Outgoing errors.
+	cancel *signal         // Signal cancellation.
+}
+
+// dirItem is a directory queued for reading. The directory being evaluated has
+// depth 0, its sub-directories have depth 1, and so on. A dirReader's roots
+// have a depth other than 0 if they lie below that directory.
+type dirItem struct {
+	path  string
+	depth int
+	dev   uint64 // Device containing the root below which path lies, if devOK.
+	devOK bool
+
+	ignore  *ignoreList // Rules from the ignore files of the parent directory and its ancestors.
+	spilled bool        // Whether dir was read back from spill, without ignore.
+}
+
+func newDirReader(roots []string, numProcs int, opts *Options) *dirReader {
+	r := new(dirReader)
+	r.roots = roots
+	r.opts = opts
+	r.numProcs = numProcs
+	r.cond = sync.NewCond(&r.mu)
+	r.out = make(chan listedFile, r.numProcs)
+	r.err = make(chan error, r.numProcs)
+	r.cancel = newSignal()
+	if opts.followsLinks() {
+		r.visited = make(map[visitKey]bool)
+	}
+	return r
+}
+
+// visitKey identifies a directory: by its device and inode numbers where the
+// file system reports them, or else by its cleaned path.
+type visitKey struct {
+	dev, ino uint64
+	path     string
+}
+
+// newVisitKey returns the visitKey of the directory located at path,
+// described by info.
+func newVisitKey(path string, info os.FileInfo) visitKey {
+	if dev, ino, ok := fileID(info); ok {
+		return visitKey{dev: dev, ino: ino}
+	}
+	return visitKey{path: filepath.Clean(path)}
+}
+
+// visit records the directory located at path, described by info, as read,
+// returning false if it had been already, as when several links followed
+// lead to it. Directories are only recorded when links are followed.
+func (r *dirReader) visit(path string, info os.FileInfo) bool {
+	if r.visited == nil {
+		return true
+	}
+	key := newVisitKey(path, info)
+	r.visitedMu.Lock()
+	defer r.visitedMu.Unlock()
+	if r.visited[key] {
+		return false
+	}
+	r.visited[key] = true
+	return true
+}
+
+// Start launches worker goroutines and begins reading the configured
+// root directory. Not to be called more than once on the same instance.
+func (r *dirReader) Start() {
+	if !r.resumed {
+		// Pushed in reverse, so that roots are read in order.
+		for i := len(r.roots) - 1; i >= 0; i-- {
+			r.pending = append(r.pending, dirItem{path: r.roots[i], depth: r.depth})
+		}
+	}
+	r.busyProcs.Add(r.numProcs)
+	for i := 0; i < r.numProcs; i++ {
+		go r.worker()
+	}
+
+	go func() {
+		r.busyProcs.Wait()
+		r.closeSpill()
+		if r.sums != nil {
+			r.sums.timed(listingTime, -time.Duration(atomic.LoadInt64(&r.blocked)))
+		}
+		close(r.out)
+		close(r.err)
+	}()
+}
+
+// Cancel signals worker goroutines to return immediately the first time it is
+// called. Subsequent calls to Cancel have no effect.
+func (r *dirReader) Cancel() {
+	r.cancel.Once()
+	r.mu.Lock()
+	r.cond.Broadcast() // Wake workers waiting in next.
+	r.mu.Unlock()
+	r.busyProcs.Wait()
+}
+
+func (r *dirReader) worker() {
+	defer r.busyProcs.Done()
+	for {
+		dir, ok := r.next()
+		r.sendSpillErr()
+		if !ok {
+			return
+		}
+		start := time.Now()
+		r.handle(dir)
+		if r.sums != nil {
+			r.sums.timed(listingTime, time.Since(start))
+		}
+		r.finish()
+	}
+}
+
+// next pops a directory from r.pending, waiting while it is empty and other
+// directories are being read, or while r is paused. It returns false once
+// reading is done or has been canceled.
+func (r *dirReader) next() (dirItem, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for {
+		for (r.paused || !r.queued() && r.active > 0) && !r.canceled() {
+			r.cond.Wait()
+		}
+		if !r.queued() || r.canceled() {
+			return dirItem{}, false
+		}
+		if len(r.pending) == 0 {
+			r.unspill()
+		}
+		if len(r.pending) > 0 {
+			break
+		}
+	}
+	dir := r.pending[len(r.pending)-1]
+	r.pending[len(r.pending)-1] = dirItem{}
+	r.pending = r.pending[:len(r.pending)-1]
+	r.active++
+	return dir, true
+}
+
+// finish records that a directory returned by next has been read, waking the
+// other workers, and pause, if no other directory is being read.
+func (r *dirReader) finish() {
+	r.mu.Lock()
+	r.active--
+	if r.active == 0 {
+		r.cond.Broadcast()
+	}
+	r.mu.Unlock()
+}
+
+// pause stops workers from reading further directories, waits for those being
+// read to be done, and returns the directories that remain to be read. Every
+// file in the directories read so far has then been sent on r.out. Reading
+// continues once unpause is called.
+func (r *dirReader) pause() []dirItem {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.paused = true
+	for r.active > 0 && !r.canceled() {
+		r.cond.Wait()
+	}
+	var pending []dirItem
+	if len(r.spillEnds) > 0 {
+		dirs, err := r.readSpill(0, r.spillEnds[len(r.spillEnds)-1])
+		if err != nil && r.spillErr == nil {
+			r.spillErr = err
+		}
+		pending = dirs
+	}
+	return append(pending, r.pending...)
+}
+
+func (r *dirReader) unpause() {
+	r.mu.Lock()
+	r.paused = false
+	r.cond.Broadcast()
+	r.mu.Unlock()
+}
+
+// resume configures r to read the directories in pending, as returned by
+// pause, instead of roots. Not to be called after Start.
+func (r *dirReader) resume(pending []dirItem) {
+	if len(r.opts.IgnoreFiles) > 0 {
+		for i := range pending {
+			pending[i].ignore = r.ignoresAbove(pending[i].path)
+		}
+	}
+	r.pending = pending
+	r.resumed = true
+}
+
+func (r *dirReader) canceled() bool {
+	select {
+	case <-r.cancel.C():
+		return true
+	default:
+		return false
+	}
+}
+
+// queued reports whether directories remain to be read, in pending or spill.
+// To be called with r.mu held.
+func (r *dirReader) queued() bool { return len(r.pending) > 0 || len(r.spillEnds) > 0 }
+
+func (r *dirReader) enqueue(dir dirItem) {
+	r.mu.Lock()
+	if len(r.pending) >= maxPendingDirs {
+		r.spillPending()
+	}
+	r.pending = append(r.pending, dir)
+	r.cond.Signal()
+	r.mu.Unlock()
+	r.sendSpillErr()
+}
+
+// sendSpillErr sends the first error writing or reading spill on r.err, once.
+func (r *dirReader) sendSpillErr() {
+	r.mu.Lock()
+	err := r.spillErr
+	if err == nil || r.spillSent {
+		r.mu.Unlock()
+		return
+	}
+	r.spillSent = true
+	r.mu.Unlock()
+	r.emitErr(err)
+}
+
+// handle reads file names from the directory located at dir.path and sends
+// file paths on r.out. If dir.path is "/dir" and a file is named "file1",
+// "/dir/file1" is sent on r.out. If the Recursive option is set and a
+// sub-directory is encountered, it is enqueued for reading unless doing so
+// would exceed MaxDepth. Hidden files and sub-directories are skipped under
+// the SkipHidden option, as are those matched by the ignore files in dir.path
+// and its ancestors under the IgnoreFiles option, and junctions and links to
+// directories on Windows unless followed. If dir.path is the location
+// of a regular file instead of a directory, that file is sent on r.out and
+// handle returns.
+func (r *dirReader) handle(dir dirItem) {
+	info, path, err := r.opts.lstat(dir.path)
+	if err != nil {
+		if dir.depth == r.depth || !r.skipVanished(err) {
+			r.emitErr(err)
+		}
+		return
+	}
+	if !info.IsDir() {
+		r.emit(listed(dir.path, path, info))
+		r.enqueueArchive(path, dir.depth)
+		return
+	}
+	if !r.visit(path, info) {
+		r.skipped(path, "directory already read")
+		return
+	}
+	if dir.depth == r.depth {
+		dir.dev, dir.devOK = device(info)
+	}
+	if dir.spilled && len(r.opts.IgnoreFiles) > 0 {
+		dir.ignore = r.ignoresAbove(dir.path)
+	}
+
+	ignore := dir.ignore
+	if len(r.opts.IgnoreFiles) > 0 {
+		ignore = r.readIgnores(path, r.ignoreFilesIn(path), dir.ignore)
+	}
+	if r.sums != nil {
+		r.opts.logDebug("reading directory", "path", path)
+	}
+	var names []string // Names listed, for CaseCollisions.
+	done, err := r.readDir(path, func(e dirEntry) bool {
+		if r.opts.CaseCollisions != nil {
+			names = append(names, e.name)
+		}
+		return r.handleEntry(dir, path, e, ignore)
+	})
+	if err != nil {
+		if dir.depth == r.depth || !r.skipVanished(err) {
+			r.emitErr(err)
+		}
+		return
+	}
+	if done && r.opts.CaseCollisions != nil {
+		r.opts.CaseCollisions.record(path, names)
+	}
+}
+
+// dirEntry is an entry of a directory being read. Its type is known if the
+// file system listed it, as a filesys.DirReader does.
+type dirEntry struct {
+	name  string
+	typ   os.FileMode // Type bits of the mode of the entry, if typed.
+	typed bool
+}
+
+// errStopReadDir stops a call to filesys.ReadDir made by readDir.
+var errStopReadDir = errors.New("dedup: stop reading directory")
+
+// readDir calls fn with each entry of the directory located at path, as they
+// are listed if the file system is a filesys.DirReader, or else all at once
+// after reading their names, until fn returns false. done will be false if
+// fn did so.
+func (r *dirReader) readDir(path string, fn func(e dirEntry) bool) (done bool, err error) {
+	err = filesys.ReadDir(r.opts.FileSystem, path, func(entries []os.DirEntry) error {
+		for _, e := range entries {
+			if !fn(dirEntry{name: e.Name(), typ: e.Type(), typed: true}) {
+				return errStopReadDir
+			}
+		}
+		return nil
+	})
+	switch {
+	case err == nil:
+		return true, nil
+	case err == errStopReadDir:
+		return false, nil
+	case !errors.Is(err, filesys.ErrNoReadDir):
+		return false, newError("readdir", path, err)
+	}
+
+	names, err := r.opts.FileSystem.Readdirnames(path)
+	if err != nil {
+		return false, newError("readdirnames", path, err)
+	}
+	for _, name := range names {
+		if !fn(dirEntry{name: name}) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// handleEntry handles the entry e of the directory located at path, read as
+// dir, as described for handle, given the ignoreList for path. The entry is
+// only stat'ed if its type does not suffice; see needInfo. It returns false
+// once r is canceled.
+func (r *dirReader) handleEntry(dir dirItem, path string, e dirEntry, ignore *ignoreList) bool {
+	select {
+	case <-r.cancel.C():
+		return false
+	default:
+	}
+	listedPath := join(path, e.name)
+	if r.opts.SkipHidden && strings.HasPrefix(e.name, ".") {
+		r.skipped(listedPath, "hidden")
+		return true
+	}
+
+	fullPath := listedPath
+	isDir := e.typ.IsDir()
+	var info os.FileInfo
+	if r.needInfo(e) {
+		var err error
+		info, fullPath, err = r.opts.lstat(fullPath)
+		if err != nil {
+			if !r.skipVanished(err) {
+				r.emitErr(err)
+			}
+			return true
+		}
+		isDir = info.IsDir()
+	}
+	switch {
+	case info != nil && r.opts.SkipHidden && hasHiddenAttr(info):
+		r.skipped(fullPath, "hidden")
+		return true
+	case info != nil && isDirLink(info):
+		r.skipped(fullPath, "directory link")
+		return true
+	case ignore.ignored(fullPath, isDir):
+		r.skipped(fullPath, "ignored")
+		return true
+	}
+	if !isDir {
+		r.emit(listed(listedPath, fullPath, info))
+		r.enqueueArchive(fullPath, dir.depth)
+	} else if r.opts.excludesDir(fullPath) {
+		r.skipped(fullPath, "excluded")
+	} else if r.descend(dir.depth+1) && r.sameDevice(info, dir) {
+		r.enqueue(dirItem{path: fullPath, depth: dir.depth + 1, dev: dir.dev, devOK: dir.devOK, ignore: ignore})
+	}
+	return true
+}
+
+// needInfo reports whether the entry e is to be stat'ed to be handled:
+// unless its type is known, it is a link, which may be followed, or a
+// directory whose device matters under OneFileSystem, or it may have the
+// hidden attribute under SkipHidden.
+func (r *dirReader) needInfo(e dirEntry) bool {
+	return !e.typed || e.typ&(os.ModeSymlink|os.ModeIrregular) != 0 ||
+		e.typ.IsDir() && r.opts.OneFileSystem || r.opts.SkipHidden && hiddenAttrs
+}
+
+// join joins the directory dir and name, preserving the slashes following the
+// scheme if dir is a URL.
+func join(dir, name string) string {
+	if filesys.IsURL(dir) {
+		return filesys.JoinURL(dir, name)
+	}
+	return filepath.Join(dir, name)
+}
+
+// enqueueArchive enqueues the members of the file located at path, found in
+// a directory at depth, for reading as a sub-directory if the Archives option
+// is set and the file is an archive.
+func (r *dirReader) enqueueArchive(path string, depth int) {
+	if r.opts.Archives && filesys.IsArchive(path) && r.descend(depth+1) {
+		r.enqueue(dirItem{path: path + filesys.ArchiveSep, depth: depth + 1})
+	}
+}
+
+// descend reports whether a sub-directory found at depth should be read.
+func (r *dirReader) descend(depth int) bool { return r.opts.descend(depth) }
+
+// skipVanished reports whether err indicates that a listed file or directory
+// no longer exists and should be skipped, recording it in r.sums if so.
+func (r *dirReader) skipVanished(err error) bool {
+	if r.opts.ReportVanished || !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	if r.sums != nil {
+		r.sums.vanished()
+		path, _ := pathCause(err)
+		r.opts.logSkip(path, "vanished")
+	}
+	return true
+}
+
+// skipped records the file or directory located at path, excluded for
+// reason, in r.sums, if set, and logs it. Files listed by precount, which
+// sets no r.sums, are skipped again by the evaluation that follows.
+func (r *dirReader) skipped(path, reason string) {
+	if r.sums != nil {
+		r.sums.skipped()
+		r.opts.logSkip(path, reason)
+	}
+}
+
+// sameDevice reports whether the directory described by info, found in
+// parent, may be read under the OneFileSystem option.
+func (r *dirReader) sameDevice(info os.FileInfo, parent dirItem) bool {
+	if !r.opts.OneFileSystem || !parent.devOK {
+		return true
+	}
+	dev, ok := device(info)
+	return !ok || dev == parent.dev
+}
+
+func (r *dirReader) emit(file listedFile) {
+	start := time.Now()
+	select {
+	case <-r.cancel.C():
+	case r.out <- file:
+		atomic.AddUint64(&r.emitted, 1)
+	}
+	atomic.AddInt64(&r.blocked, int64(time.Since(start)))
+}
+
+func (r *dirReader) emitErr(err error) {
+	if r.opts.skipUnreadable(r.sums, err) {
+		return
+	}
+	if r.sums != nil {
+		r.opts.logError(err)
+	}
+	select {
+	case <-r.cancel.C():
+	case r.err <- err:
+	}
+}
@@ -0,0 +1,341 @@
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// treeFS is a FileSystem of directories that each contain fanout
+// sub-directories, named d0, d1, and so on, down to depth, whose leaves each
+// contain files empty files, named f0, f1, and so on.
+type treeFS struct {
+	fanout, depth, files int
+}
+
+// level returns the depth of the file or directory located at pth, and
+// whether it is a file.
+func (fs treeFS) level(pth string) (depth int, file bool, ok bool) {
+	if pth == "/" {
+		return 0, false, true
+	}
+	for _, name := range strings.Split(strings.TrimPrefix(pth, "/"), "/") {
+		if file || len(name) < 2 {
+			return 0, false, false
+		}
+		n, err := strconv.Atoi(name[1:])
+		switch {
+		case err != nil:
+			return 0, false, false
+		case name[0] == 'd' && n < fs.fanout && depth < fs.depth:
+			depth++
+		case name[0] == 'f' && n < fs.files && depth == fs.depth:
+			file = true
+		default:
+			return 0, false, false
+		}
+	}
+	return depth, file, true
+}
+
+func (fs treeFS) Open(pth string) (filesys.File, error) {
+	return nil, &os.PathError{Op: "open", Path: pth, Err: os.ErrPermission}
+}
+
+func (fs treeFS) Lstat(pth string) (os.FileInfo, error) {
+	_, file, ok := fs.level(pth)
+	if !ok {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: os.ErrNotExist}
+	}
+	return treeInfo{name: pth[strings.LastIndex(pth, "/")+1:], dir: !file}, nil
+}
+
+func (fs treeFS) Readlink(pth string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: pth, Err: os.ErrInvalid}
+}
+
+func (fs treeFS) Readdirnames(pth string) ([]string, error) {
+	depth, file, ok := fs.level(pth)
+	if !ok || file {
+		return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: os.ErrNotExist}
+	}
+	prefix, n := "d", fs.fanout
+	if depth == fs.depth {
+		prefix, n = "f", fs.files
+	}
+	names := make([]string, n)
+	for i := range names {
+		names[i] = prefix + strconv.Itoa(i)
+	}
+	return names, nil
+}
+
+type treeInfo struct {
+	name string
+	dir  bool
+}
+
+func (i treeInfo) Name() string       { return i.name }
+func (i treeInfo) Size() int64        { return 0 }
+func (i treeInfo) ModTime() time.Time { return time.Time{} }
+func (i treeInfo) IsDir() bool        { return i.dir }
+func (i treeInfo) Sys() interface{}   { return nil }
+
+func (i treeInfo) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir
+	}
+	return 0
+}
+
+// count returns the number of files in fs.
+func (fs treeFS) count() int {
+	n := fs.files
+	for i := 0; i < fs.depth; i++ {
+		n *= fs.fanout
+	}
+	return n
+}
+
+func TestDirReader(t *testing.T) {
+	for _, fs := range []treeFS{
+		{fanout: 3, depth: 4, files: 5},
+		{fanout: 200, depth: 1, files: 20},
+		{fanout: 1, depth: 100, files: 1},
+	} {
+		opts := &Options{Recursive: true, FileSystem: fs}
+		r := newDirReader([]string{"/"}, 4, opts)
+		r.Start()
+		seen := make(map[string]bool)
+		for r.out != nil || r.err != nil {
+			select {
+			case file, ok := <-r.out:
+				if !ok {
+					r.out = nil
+				} else if seen[file.path] {
+					t.Errorf("%+v: read %s twice", fs, file.path)
+				} else {
+					seen[file.path] = true
+				}
+			case err, ok := <-r.err:
+				if !ok {
+					r.err = nil
+				} else {
+					t.Errorf("%+v: %v", fs, err)
+				}
+			}
+		}
+		if len(seen) != fs.count() {
+			t.Errorf("%+v: read %d files; want %d", fs, len(seen), fs.count())
+		}
+	}
+}
+
+// streamFS is a treeFS that lists directories in batches, as a
+// filesys.DirReader, and counts calls to Lstat.
+type streamFS struct {
+	treeFS
+	lstats *uint64
+}
+
+func (fs streamFS) Lstat(pth string) (os.FileInfo, error) {
+	atomic.AddUint64(fs.lstats, 1)
+	return fs.treeFS.Lstat(pth)
+}
+
+func (fs streamFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	names, err := fs.Readdirnames(pth)
+	if err != nil {
+		return err
+	}
+	var entries []os.DirEntry
+	for i, name := range names {
+		info, _ := fs.treeFS.Lstat(strings.TrimSuffix(pth, "/") + "/" + name)
+		entries = append(entries, infoEntry{info})
+		if len(entries) == 7 || i == len(names)-1 {
+			if err := fn(entries); err != nil {
+				return err
+			}
+			entries = nil
+		}
+	}
+	return nil
+}
+
+type infoEntry struct{ os.FileInfo }
+
+func (e infoEntry) Type() os.FileMode          { return e.Mode().Type() }
+func (e infoEntry) Info() (os.FileInfo, error) { return e.FileInfo, nil }
+
+func TestDirReaderReadDir(t *testing.T) {
+	tree := treeFS{fanout: 3, depth: 4, files: 5}
+	fs := streamFS{tree, new(uint64)}
+	opts := &Options{Recursive: true, FileSystem: fs}
+	r := newDirReader([]string{"/"}, 4, opts)
+	r.Start()
+	n := 0
+	for r.out != nil || r.err != nil {
+		select {
+		case _, ok := <-r.out:
+			if !ok {
+				r.out = nil
+			} else {
+				n++
+			}
+		case err, ok := <-r.err:
+			if !ok {
+				r.err = nil
+			} else {
+				t.Error(err)
+			}
+		}
+	}
+	if n != tree.count() {
+		t.Errorf("read %d files; want %d", n, tree.count())
+	}
+	// Only the directories read are stat'ed, not the entries listed.
+	dirs := 0
+	for i, m := 0, 1; i <= tree.depth; i, m = i+1, m*tree.fanout {
+		dirs += m
+	}
+	if got := atomic.LoadUint64(fs.lstats); got != uint64(dirs) {
+		t.Errorf("Lstat called %d times; want %d", got, dirs)
+	}
+}
+
+func TestDirReaderSpill(t *testing.T) {
+	defer func(n int) { maxPendingDirs = n }(maxPendingDirs)
+	maxPendingDirs = 4
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	tree := treeFS{fanout: 20, depth: 3, files: 2}
+	opts := &Options{Recursive: true, FileSystem: tree, SpillDir: dir}
+	r := newDirReader([]string{"/"}, 4, opts)
+	r.Start()
+	seen := make(map[string]bool)
+	for r.out != nil || r.err != nil {
+		select {
+		case file, ok := <-r.out:
+			if !ok {
+				r.out = nil
+			} else if seen[file.path] {
+				t.Errorf("read %s twice", file.path)
+			} else {
+				seen[file.path] = true
+			}
+		case err, ok := <-r.err:
+			if !ok {
+				r.err = nil
+			} else {
+				t.Error(err)
+			}
+		}
+	}
+	if len(seen) != tree.count() {
+		t.Errorf("read %d files; want %d", len(seen), tree.count())
+	}
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("spill left %d files in %s", len(names), dir)
+	}
+
+	// The rules of the ignore files above a spilled directory are read again.
+	files := map[string][]byte{"root/.dedupignore": []byte("*.o\n")}
+	for i := 0; i < 10; i++ {
+		files[fmt.Sprintf("root/d%d/a.o", i)] = []byte("same")
+		files[fmt.Sprintf("root/d%d/b", i)] = []byte(strconv.Itoa(i))
+	}
+	opts = &Options{Recursive: true, IgnoreFiles: []string{".dedupignore"}, FileSystem: filesys.Map(files, nil), SpillDir: dir}
+	sums, err := FilterDir("root", opts)
+	checkErrors(t, "", err, nil)
+	if got := sums.Stats().NumFiles; got != 11 {
+		t.Errorf("Stats().NumFiles = %d; want 11", got)
+	}
+}
+
+func TestDirReaderLinkLoop(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if err := os.MkdirAll(filepath.Join(dir, "root/sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "root/file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	onDisk := os.Symlink("..", filepath.Join(dir, "root/sub/up")) == nil
+
+	for i, tc := range []struct {
+		root string
+		fs   filesys.FileSystem
+	}{
+		{"root", filesys.Map(map[string][]byte{
+			"root/file":   []byte("file"),
+			"root/sub/up": []byte(".."),
+		}, []string{"root/sub/up"})},
+		{filepath.Join(dir, "root"), nil},
+	} {
+		if tc.fs == nil && !onDisk {
+			continue
+		}
+		done := make(chan struct{})
+		var sums *Sums
+		go func() {
+			defer close(done)
+			sums, err = FilterDir(tc.root, &Options{Recursive: true, FollowSymlinks: true, FileSystem: tc.fs})
+		}()
+		select {
+		case <-done:
+		case <-time.After(10 * time.Second):
+			t.Fatalf("%d: reading a link to an ancestor did not stop", i)
+		}
+		checkErrors(t, fmt.Sprintf("%d: ", i), err, nil)
+		if st := sums.Stats(); st.NumFiles != 1 || st.FilesSkipped != 1 {
+			t.Errorf("%d: NumFiles, FilesSkipped = %d, %d; want 1, 1", i, st.NumFiles, st.FilesSkipped)
+		}
+	}
+}
+
+// BenchmarkDirReader measures the throughput of reading directories, without
+// evaluating the files found, for trees of about a million files that are
+// wide, deep, or both.
+func BenchmarkDirReader(b *testing.B) {
+	for _, bc := range []struct {
+		name string
+		fs   treeFS
+	}{
+		{"wide", treeFS{fanout: 1000, depth: 1, files: 1000}},
+		{"deep", treeFS{fanout: 2, depth: 16, files: 16}},
+		{"bushy", treeFS{fanout: 10, depth: 4, files: 100}},
+	} {
+		b.Run(bc.name, func(b *testing.B) {
+			opts := &Options{Recursive: true, FileSystem: bc.fs}
+			start := time.Now()
+			for i := 0; i < b.N; i++ {
+				r := newDirReader([]string{"/"}, ratioMaxProcs(1, 4), opts)
+				r.Start()
+				n := 0
+				for range r.out {
+					n++
+				}
+				if n != bc.fs.count() {
+					b.Fatalf("read %d files; want %d", n, bc.fs.count())
+				}
+			}
+			b.ReportMetric(float64(bc.fs.count()*b.N)/time.Since(start).Seconds(), "files/s")
+		})
+	}
+}
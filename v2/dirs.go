@@ -0,0 +1,22 @@
+package dedup
+
+import "path/filepath"
+
+// dirKey returns sum followed by the directory of the file located at path,
+// so that only files sharing both share the key under Options.SameDirOnly.
+func dirKey(sum Digest, path string) Digest {
+	return sum + Digest(filepath.Dir(path))
+}
+
+// spansDirs reports whether files reside in more than one directory.
+func spansDirs(files []*File) bool {
+	if len(files) == 0 {
+		return false
+	}
+	for _, file := range files[1:] {
+		if filepath.Dir(file.Path) != filepath.Dir(files[0].Path) {
+			return true
+		}
+	}
+	return false
+}
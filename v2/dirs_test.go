@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirDirs(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a/1":      []byte("spread"),
+		"root/a/2":      []byte("spread"),
+		"root/b/1":      []byte("spread"),
+		"root/c/1":      []byte("side by side"),
+		"root/c/1 (1)":  []byte("side by side"),
+		"root/c/unique": []byte("u"),
+	}, nil)
+
+	var dup bytes.Buffer
+	sums, err := FilterDir("root", &Options{Recursive: true, CrossDirOnly: true, DupWriter: &dup, FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	// Which copies of spread are reported depends on the order in which they
+	// are evaluated, but never those of side by side.
+	got := strings.Split(strings.TrimSpace(dup.String()), "\n")
+	if dup.Len() == 0 || len(got) > 2 || strings.Contains(dup.String(), "root/c/") {
+		t.Errorf("1: reported %q as duplicates; want 1 or 2 copies of spread", got)
+	}
+	groups := sums.DupGroups()
+	if len(groups) != 1 || len(groups[0].Files) != 3 {
+		t.Errorf("1: DupGroups() = %v; want the 3 copies of spread", groups)
+	}
+
+	sums, err = FilterDir("root", &Options{Recursive: true, SameDirOnly: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	spread, side := sha1Sum([]byte("spread")), sha1Sum([]byte("side by side"))
+	checkSums(t, "2: ", sums, []string{
+		dupString(dirKey(spread, "root/a/1"), "root/a/1", "root/a/2"),
+		dupString(dirKey(side, "root/c/1"), "root/c/1", "root/c/1 (1)"),
+	})
+}
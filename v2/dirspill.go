@@ -0,0 +1,143 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// maxPendingDirs is the greatest number of directories that a dirReader
+// holds in memory waiting to be read; see spillPending.
+var maxPendingDirs = 1 << 14
+
+// spillPending moves the older half of r.pending to r.spill, a temporary
+// file created in SpillDir, or in the default directory for temporary files,
+// as a batch that unspill reads back once r.pending is empty. The ignore
+// lists of the directories moved are not kept; handle reads them again. If
+// the batch cannot be written, r.pending keeps it, grows as needed from then
+// on, and the error is sent on r.err. To be called with r.mu held.
+func (r *dirReader) spillPending() {
+	if r.spillErr != nil {
+		return
+	}
+	if r.spill == nil {
+		f, err := ioutil.TempFile(r.opts.SpillDir, "dedup-dirs")
+		if err != nil {
+			r.spillErr = err
+			return
+		}
+		r.spill = f
+	}
+	n := (len(r.pending) + 1) / 2
+	w := bufio.NewWriter(r.spill)
+	for _, dir := range r.pending[:n] {
+		writeDirItem(w, dir)
+	}
+	if err := w.Flush(); err != nil {
+		r.spillErr = err
+		return
+	}
+	end, err := r.spill.Seek(0, io.SeekCurrent)
+	if err != nil {
+		r.spillErr = err
+		return
+	}
+	r.spillEnds = append(r.spillEnds, end)
+	m := copy(r.pending, r.pending[n:])
+	for i := m; i < len(r.pending); i++ {
+		r.pending[i] = dirItem{}
+	}
+	r.pending = r.pending[:m]
+}
+
+// unspill moves the batch last written to r.spill back to r.pending, which
+// is empty. To be called with r.mu held.
+func (r *dirReader) unspill() {
+	start := int64(0)
+	if n := len(r.spillEnds); n > 1 {
+		start = r.spillEnds[n-2]
+	}
+	dirs, err := r.readSpill(start, r.spillEnds[len(r.spillEnds)-1])
+	if err == nil {
+		err = r.spill.Truncate(start)
+	}
+	if err == nil {
+		_, err = r.spill.Seek(start, io.SeekStart)
+	}
+	if err != nil && r.spillErr == nil {
+		r.spillErr = err
+	}
+	r.spillEnds = r.spillEnds[:len(r.spillEnds)-1]
+	r.pending = append(r.pending, dirs...)
+}
+
+// readSpill reads the directories written to r.spill between the offsets
+// start and end.
+func (r *dirReader) readSpill(start, end int64) ([]dirItem, error) {
+	br := bufio.NewReader(io.NewSectionReader(r.spill, start, end-start))
+	var dirs []dirItem
+	for {
+		dir, err := readDirItem(br)
+		if err == io.EOF {
+			return dirs, nil
+		} else if err != nil {
+			return dirs, err
+		}
+		dirs = append(dirs, dir)
+	}
+}
+
+// closeSpill removes r.spill, if created.
+func (r *dirReader) closeSpill() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.spill != nil {
+		_ = r.spill.Close()
+		_ = os.Remove(r.spill.Name())
+		r.spill, r.spillEnds = nil, nil
+	}
+}
+
+// writeDirItem writes dir to w, without its ignore list.
+func writeDirItem(w *bufio.Writer, dir dirItem) {
+	var buf [binary.MaxVarintLen64]byte
+	_, _ = w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(dir.path)))])
+	_, _ = w.WriteString(dir.path)
+	_, _ = w.Write(buf[:binary.PutVarint(buf[:], int64(dir.depth))])
+	_, _ = w.Write(buf[:binary.PutUvarint(buf[:], dir.dev)])
+	devOK := byte(0)
+	if dir.devOK {
+		devOK = 1
+	}
+	_ = w.WriteByte(devOK)
+}
+
+// readDirItem reads a dirItem written by writeDirItem from r, returning
+// io.EOF if there are no more.
+func readDirItem(r *bufio.Reader) (dir dirItem, err error) {
+	n, err := binary.ReadUvarint(r)
+	if err != nil {
+		return dir, err
+	}
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return dir, unexpectedEOF(err)
+	}
+	dir.path = string(b)
+	depth, err := binary.ReadVarint(r)
+	if err != nil {
+		return dir, unexpectedEOF(err)
+	}
+	dir.depth = int(depth)
+	if dir.dev, err = binary.ReadUvarint(r); err != nil {
+		return dir, unexpectedEOF(err)
+	}
+	devOK, err := r.ReadByte()
+	if err != nil {
+		return dir, unexpectedEOF(err)
+	}
+	dir.devOK, dir.spilled = devOK == 1, true
+	return dir, nil
+}
@@ -0,0 +1,166 @@
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Errors implements the error interface for a slice of errors.
+type Errors []error
+
+func (el Errors) Error() string {
+	s := make([]string, len(el))
+	for i, err := range el {
+		s[i] = err.Error()
+	}
+	return strings.Join(s, "\n")
+}
+
+// Is reports whether any of the errors in el matches target, as by
+// errors.Is, so that errors.Is(err, ErrCanceled) reports whether an
+// evaluation that returned err was canceled.
+func (el Errors) Is(target error) bool {
+	for _, err := range el {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ErrCanceled is included in the Errors returned by Filter, FilterDir, and
+// FilterPaths if the evaluation was interrupted by the closing of
+// Options.Cancel, so that interruption can be told apart from completion.
+// The Sums returned then report Partial.
+var ErrCanceled = errors.New("dedup: evaluation canceled")
+
+// ErrDeadlineExceeded is included in the Errors returned by Filter,
+// FilterDir, and FilterPaths if the evaluation stopped at Options.Deadline.
+// The Sums returned then report Partial.
+var ErrDeadlineExceeded = errors.New("dedup: evaluation deadline exceeded")
+
+// Rollup groups the errors in el that occurred for files in the same
+// directory and for the same reason, such as a permission error, so that an
+// unreadable subtree can be reported in a single line rather than one line
+// per file. Errors that do not identify a path are each returned in a group
+// of their own. Groups are sorted by directory.
+func (el Errors) Rollup() []ErrorGroup {
+	var groups []ErrorGroup
+	index := make(map[[2]string]int) // {dir, cause} to index in groups
+	for _, err := range el {
+		path, cause := pathCause(err)
+		if path == "" {
+			groups = append(groups, ErrorGroup{Errs: Errors{err}})
+			continue
+		}
+		key := [2]string{filepath.Dir(path), cause.Error()}
+		if i, ok := index[key]; ok {
+			groups[i].Errs = append(groups[i].Errs, err)
+			continue
+		}
+		index[key] = len(groups)
+		groups = append(groups, ErrorGroup{Dir: key[0], Cause: cause, Errs: Errors{err}})
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Dir < groups[j].Dir })
+	return groups
+}
+
+// pathCause returns the path identified by err, if any, and the underlying
+// cause of err.
+func pathCause(err error) (path string, cause error) {
+	var e *Error
+	if errors.As(err, &e) {
+		return e.Path, e.Err
+	}
+	var pe *os.PathError
+	if errors.As(err, &pe) {
+		return pe.Path, pe.Err
+	}
+	return "", err
+}
+
+// ErrorGroup is a set of errors that occurred for files in directory Dir for
+// the same underlying Cause.
+type ErrorGroup struct {
+	Dir   string // Empty if the errors do not identify a path.
+	Cause error
+	Errs  Errors
+}
+
+// String returns the error message of g's only error if it has one, and a
+// summary such as "/secure: 14 files skipped: permission denied" otherwise.
+func (g ErrorGroup) String() string {
+	if len(g.Errs) == 1 {
+		return g.Errs[0].Error()
+	}
+	return fmt.Sprintf("%s: %d files skipped: %v", g.Dir, len(g.Errs), g.Cause)
+}
+
+// Error records an error that occurred while evaluating a file, along with the
+// operation and the path of the file that caused it. Errors returned by Filter
+// and FilterDir contain values of type *Error, except where noted otherwise.
+//
+// Err is the underlying cause, so errors.Is(err, os.ErrPermission) and the
+// like may be used to distinguish between kinds of failure.
+type Error struct {
+	Op   string // Operation that failed: "lstat", "readlink", "readdirnames", "open", "read", "watch", or "checkpoint".
+	Path string // Path of the file on which Op was performed.
+	Err  error
+}
+
+// newError returns an *Error for op on path caused by err. If err is an
+// *os.PathError, its operation, path, and cause are used instead so that the
+// message is not repeated; if it already is an *Error, it is returned as is.
+func newError(op, path string, err error) *Error {
+	switch err := err.(type) {
+	case *Error:
+		return err
+	case *os.PathError:
+		return &Error{Op: err.Op, Path: err.Path, Err: err.Err}
+	}
+	return &Error{Op: op, Path: path, Err: err}
+}
+
+func (e *Error) Error() string { return e.Op + " " + e.Path + ": " + e.Err.Error() }
+
+func (e *Error) Unwrap() error { return e.Err }
+
+// BrokenLinkError records a symbolic link whose target does not exist. It is
+// reported in place of an *Error so that broken links can be told apart from
+// other failures.
+type BrokenLinkError struct {
+	Path   string // Path of the symbolic link.
+	Target string // Path the link refers to, if known.
+}
+
+func (e *BrokenLinkError) Error() string {
+	if e.Target == "" {
+		return e.Path + ": broken symbolic link"
+	}
+	return e.Path + ": broken symbolic link to " + e.Target
+}
+
+// UnstableError records a file whose size or modification time changed while
+// it was read under Options.DetectChanges, whose checksum was discarded as
+// possibly torn.
+type UnstableError struct {
+	Path string
+}
+
+func (e *UnstableError) Error() string { return e.Path + ": file changed while being read" }
+
+// BudgetExceededError is returned, among Errors, by an evaluation that
+// stopped as evaluating another file would have exceeded Options.MaxFiles or
+// Options.MaxTotalBytes. The Sums returned are then partial.
+type BudgetExceededError struct {
+	Files int   // Files evaluated within the budget.
+	Bytes int64 // Total size of those files.
+}
+
+func (e *BudgetExceededError) Error() string {
+	return fmt.Sprintf("dedup: budget exceeded after %d files (%d bytes)", e.Files, e.Bytes)
+}
@@ -0,0 +1,189 @@
+package dedup
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"reflect"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestErrorsRollup(t *testing.T) {
+	denied := func(path string) error {
+		return &os.PathError{Op: "open", Path: path, Err: syscall.EACCES}
+	}
+	errs := Errors{
+		denied("secure/a"),
+		errors.New("no path"),
+		denied("secure/b"),
+		&os.PathError{Op: "read", Path: "secure/c", Err: syscall.EIO},
+		denied("other/d"),
+		denied("secure/e"),
+	}
+
+	var got []string
+	for _, g := range errs.Rollup() {
+		got = append(got, g.String())
+	}
+	want := []string{
+		"no path",
+		"open other/d: permission denied",
+		"secure: 3 files skipped: permission denied",
+		"read secure/c: input/output error",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Rollup() = %q; want %q", got, want)
+	}
+}
+
+func TestError(t *testing.T) {
+	fs := deniedFS{FS, map[string]bool{"root/red": true}}
+	_, err := FilterDir("root", &Options{FileSystem: fs})
+	errs, ok := err.(Errors)
+	if !ok || len(errs) != 2 {
+		t.Fatalf("err = %v; want 2 errors", err)
+	}
+	for _, err := range errs {
+		var e *Error
+		if !errors.As(err, &e) {
+			t.Errorf("want *Error; got %#v", err)
+			continue
+		}
+		if e.Op != "open" || (e.Path != "root/red" && e.Path != "root/err") {
+			t.Errorf("got Op %q, Path %q; want open of root/red or root/err", e.Op, e.Path)
+		}
+		if denied := errors.Is(err, os.ErrPermission); denied != (e.Path == "root/red") {
+			t.Errorf("errors.Is(%v, os.ErrPermission) = %t", err, denied)
+		}
+	}
+
+	_, err = FilterDir("bogus", &Options{FileSystem: FS})
+	if errs, _ := err.(Errors); len(errs) != 1 || !errors.Is(errs[0], os.ErrNotExist) {
+		t.Errorf("err = %v; want os.ErrNotExist", err)
+	}
+	got := newError("read", "x", &os.PathError{Op: "open", Path: "y", Err: os.ErrClosed})
+	if got.Op != "open" || got.Path != "y" || got.Err != os.ErrClosed {
+		t.Errorf("newError(*os.PathError) = %#v; want fields of *os.PathError", got)
+	}
+}
+
+func TestFilterGroupErrors(t *testing.T) {
+	fs := deniedFS{FS, map[string]bool{
+		"root/foo/baz/err":    true,
+		"root/foo/baz/dup2":   true,
+		"root/foo/baz/yellow": true,
+	}}
+
+	var buf bytes.Buffer
+	_, err := FilterDir("root/foo/baz", &Options{ErrWriter: &buf, GroupErrors: true, FileSystem: fs})
+	if got, want := buf.String(), "root/foo/baz: 3 files skipped: permission denied\n"; got != want {
+		t.Errorf("ErrWriter got %q; want %q", got, want)
+	}
+	if errs, ok := err.(Errors); !ok || len(errs) != 3 {
+		t.Errorf("err = %v; want 3 errors", err)
+	}
+}
+
+// deniedFS fails to open each path in denied with a permission error.
+type deniedFS struct {
+	filesys.FileSystem
+	denied map[string]bool
+}
+
+func (fs deniedFS) Open(path string) (filesys.File, error) {
+	if fs.denied[path] {
+		return nil, &os.PathError{Op: "open", Path: path, Err: syscall.EACCES}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+// stallWriter stalls for 10ms every 500 writes, as a consumer of errors that
+// falls behind the workers emitting them would, and closes cancel, if not
+// nil, once it has been written to n times.
+type stallWriter struct {
+	writes int
+	n      int
+	cancel chan struct{}
+}
+
+func (w *stallWriter) Write(p []byte) (int, error) {
+	if w.writes++; w.writes%500 == 0 {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if w.writes == w.n && w.cancel != nil {
+		close(w.cancel)
+	}
+	return len(p), nil
+}
+
+func TestFilterDirErrorStress(t *testing.T) {
+	const numFiles = 5000
+	files := make(map[string][]byte, numFiles)
+	denied := make(map[string]bool, numFiles)
+	for i := 0; i < numFiles; i++ {
+		path := fmt.Sprintf("root/%d/%d", i%10, i)
+		files[path] = []byte(fmt.Sprint(i))
+		denied[path] = true
+	}
+	fs := permFS{filesys.Map(files, nil), denied}
+
+	before := runtime.NumGoroutine()
+	for _, tt := range []struct {
+		name string
+		opts func() *Options
+		want func(n int) bool // Number of errors returned.
+	}{
+		{"all errors", func() *Options {
+			return &Options{Recursive: true, ErrWriter: &stallWriter{}}
+		}, func(n int) bool { return n == numFiles }},
+		{"grouped", func() *Options {
+			return &Options{Recursive: true, GroupErrors: true, ErrWriter: &stallWriter{}}
+		}, func(n int) bool { return n == numFiles }},
+		{"ExitOnError", func() *Options {
+			return &Options{Recursive: true, ExitOnError: true, ErrWriter: &stallWriter{}}
+		}, func(n int) bool { return n == 1 }},
+		{"Cancel", func() *Options {
+			cancel := make(chan struct{})
+			return &Options{Recursive: true, Cancel: cancel, ErrWriter: &stallWriter{n: 100, cancel: cancel}}
+		}, func(n int) bool { return n > 100 && n < numFiles }},
+		{"Precount", func() *Options {
+			return &Options{Recursive: true, Precount: true, ExitOnError: true}
+		}, func(n int) bool { return n <= 1 }},
+		{"LowMemory", func() *Options {
+			return &Options{Recursive: true, LowMemory: true, ExitOnError: true}
+		}, func(n int) bool { return n <= 1 }},
+	} {
+		opts := tt.opts()
+		opts.FileSystem = fs
+		done := make(chan error, 1)
+		go func() {
+			_, err := FilterDir("root", opts)
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			errs, _ := err.(Errors)
+			if !tt.want(len(errs)) {
+				t.Errorf("%s: FilterDir() = %d errors", tt.name, len(errs))
+			}
+		case <-time.After(30 * time.Second):
+			t.Fatalf("%s: FilterDir() did not return: deadlock", tt.name)
+		}
+	}
+
+	// Every goroutine emitting or forwarding errors returns, even those whose
+	// errors were no longer received.
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > before && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if n := runtime.NumGoroutine(); n > before {
+		t.Errorf("%d goroutines left running; want at most %d", n, before)
+	}
+}
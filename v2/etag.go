@@ -0,0 +1,35 @@
+package dedup
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"io"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// ETagMatcher is a Matcher that compares files by the MD5 checksums of their
+// contents. For objects read from S3 whose ETags are MD5 checksums, as they
+// are for objects uploaded in a single part, the ETag is used instead of
+// downloading the contents. Note that the ETags of objects encrypted with
+// SSE-KMS look like MD5 checksums but are not.
+type ETagMatcher struct{}
+
+var _ Matcher = ETagMatcher{}
+
+func (ETagMatcher) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	if obj, ok := file.Info.Sys().(*filesys.ObjectInfo); ok {
+		if b, err := hex.DecodeString(obj.ETag); err == nil && len(b) == md5.Size {
+			return Digest(b), nil
+		}
+	}
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	h := md5.New()
+	if _, err := io.Copy(h, r); err != nil {
+		return "", err
+	}
+	return Digest(h.Sum(nil)), nil
+}
@@ -0,0 +1,67 @@
+package dedup
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"os"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// etagFS simulates objects read from S3 with the given ETags, which fail to
+// open so as to show that they were not read.
+type etagFS struct {
+	filesys.FileSystem
+	etags map[string]string
+}
+
+type etagInfo struct {
+	os.FileInfo
+	obj *filesys.ObjectInfo
+}
+
+func (i etagInfo) Sys() interface{} { return i.obj }
+
+func (fs etagFS) Lstat(path string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(path)
+	if etag, ok := fs.etags[path]; ok && err == nil {
+		info = etagInfo{info, &filesys.ObjectInfo{Key: path, ETag: etag}}
+	}
+	return info, err
+}
+
+func (fs etagFS) Open(path string) (filesys.File, error) {
+	if _, ok := fs.etags[path]; ok {
+		return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+func TestETagMatcher(t *testing.T) {
+	md5Hex := func(b []byte) string {
+		sum := md5.Sum(b)
+		return hex.EncodeToString(sum[:])
+	}
+	fs := etagFS{
+		filesys.Map(map[string][]byte{
+			"root/local":     Dup1,
+			"root/object":    nil,
+			"root/multipart": Dup2,
+			"root/other":     Dup2,
+		}, nil),
+		map[string]string{
+			"root/object":    md5Hex(Dup1),
+			"root/multipart": md5Hex(Dup2) + "-2",
+		},
+	}
+
+	sums, err := FilterDir("root", &Options{Matcher: ETagMatcher{}, FileSystem: fs})
+	checkErrors(t, "", err, []string{
+		"open root/multipart: permission denied",
+	})
+	sum := md5.Sum(Dup1)
+	checkSums(t, "", sums, []string{
+		dupString(Digest(sum[:]), "root/local", "root/object"),
+	})
+}
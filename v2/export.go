@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// exportHeader is the first line of an export written by WriteExport.
+const exportHeader = "# dedup export"
+
+// WriteExport writes every file in s to w in a compact line-oriented format
+// that ReadExport loads again, so that the scans of several machines, such
+// as of the disks being consolidated, can be combined. After a header line,
+// each file is written on a line of its own as its hex-encoded checksum,
+// size, host, and path, quoted as by strconv.Quote, separated by tabs.
+// Files are sorted as by WriteIndex. host, which may not contain tabs or
+// newlines, names the machine the files were found on.
+func (s *Sums) WriteExport(w io.Writer, host string) error {
+	if host == "" || strings.ContainsAny(host, "\t\r\n") {
+		return fmt.Errorf("dedup: invalid export host: %q", host)
+	}
+	bw := bufio.NewWriter(w)
+	_, _ = fmt.Fprintln(bw, exportHeader)
+	for _, f := range s.indexFiles() {
+		_, _ = fmt.Fprintf(bw, "%s\t%d\t%s\t%s\n", f.Sum, f.Size, host, strconv.Quote(f.Path))
+	}
+	return bw.Flush()
+}
+
+// ReadExport reads an export written by WriteExport from r and returns a
+// *Sums containing its files, the path of each being prefixed by its host
+// and a colon, as in "nas:/data/a", so that the files of different hosts
+// stay apart when exports are combined with Merge. The os.FileInfo of each
+// file only reports its size.
+func ReadExport(r io.Reader) (*Sums, error) {
+	sums := NewSums()
+	sc := bufio.NewScanner(r)
+	if !sc.Scan() || strings.TrimSuffix(sc.Text(), "\r") != exportHeader {
+		if err := sc.Err(); err != nil {
+			return nil, fmt.Errorf("dedup: reading export: %w", err)
+		}
+		return nil, errors.New("dedup: reading export: missing header")
+	}
+	for n := 2; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		sum, file, err := exportedFile(line)
+		if err != nil {
+			return nil, fmt.Errorf("dedup: reading export: line %d: %w", n, err)
+		}
+		sums.AppendDigest(sum, file)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("dedup: reading export: %w", err)
+	}
+	return sums, nil
+}
+
+// exportedFile parses a line of an export.
+func exportedFile(line string) (Digest, *File, error) {
+	fields := strings.SplitN(line, "\t", 4)
+	if len(fields) != 4 {
+		return "", nil, fmt.Errorf("invalid line: %q", line)
+	}
+	sum, err := hex.DecodeString(fields[0])
+	if err != nil || len(sum) == 0 {
+		return "", nil, fmt.Errorf("invalid checksum: %q", fields[0])
+	}
+	size, err := strconv.ParseInt(fields[1], 10, 64)
+	if err != nil || size < 0 {
+		return "", nil, fmt.Errorf("invalid size: %q", fields[1])
+	}
+	path, err := strconv.Unquote(fields[3])
+	if err != nil || fields[2] == "" {
+		return "", nil, fmt.Errorf("invalid line: %q", line)
+	}
+	path = fields[2] + ":" + path
+	return Digest(sum), &File{Path: path, Info: &indexInfo{f: indexFile{Path: path, Size: size}}}, nil
+}
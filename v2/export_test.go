@@ -0,0 +1,54 @@
+package dedup
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestExportMerge(t *testing.T) {
+	a, _ := FilterDir("root", &Options{FileSystem: filesys.Map(map[string][]byte{
+		"root/a":      []byte("a"),
+		"root/b\tc":   []byte("b"),
+		"root/unique": []byte("u"),
+	}, nil)})
+	b, _ := FilterDir("root", &Options{FileSystem: filesys.Map(map[string][]byte{
+		"root/a": []byte("a"),
+		"root/b": []byte("b"),
+		"root/c": []byte("b"),
+	}, nil)})
+
+	merged := NewSums()
+	for _, x := range []struct {
+		host string
+		sums *Sums
+	}{{"laptop", a}, {"nas", b}} {
+		var buf bytes.Buffer
+		if err := x.sums.WriteExport(&buf, x.host); err != nil {
+			t.Fatalf("WriteExport(%s) = %v", x.host, err)
+		}
+		sums, err := ReadExport(&buf)
+		if err != nil {
+			t.Fatalf("ReadExport(%s) = %v", x.host, err)
+		}
+		merged.Merge(sums)
+	}
+	checkSums(t, "", merged, []string{
+		dupString(sha1Sum([]byte("a")), "laptop:root/a", "nas:root/a"),
+		dupString(sha1Sum([]byte("b")), "laptop:root/b\tc", "nas:root/b", "nas:root/c"),
+	})
+	if got := merged.Stats(); got.NumFiles != 6 || got.NumDupFiles != 3 {
+		t.Errorf("Stats() = %v; want 6 files, 3 duplicates", got)
+	}
+
+	if err := a.WriteExport(&bytes.Buffer{}, "bad\thost"); err == nil {
+		t.Error("WriteExport(invalid host) = nil; want error")
+	}
+	for _, s := range []string{"", "not an export\n", exportHeader + "\nbogus\t1\th\t\"p\"\n"} {
+		if _, err := ReadExport(strings.NewReader(s)); err == nil {
+			t.Errorf("ReadExport(%q) = nil; want error", s)
+		}
+	}
+}
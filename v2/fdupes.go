@@ -0,0 +1,77 @@
+package dedup
+
+import (
+	"bufio"
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// writeFdupes writes the groups of duplicates in s to w as fdupes and jdupes
+// list them: the path of each file on a line of its own, each group followed
+// by a blank line.
+func (s *Sums) writeFdupes(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	links := s.linkPaths()
+	s.rangeDupGroups(func(g Group) bool {
+		for _, file := range g.Files {
+			path, _ := links.paths(file)
+			_, _ = bw.WriteString(path + "\n")
+		}
+		_, err := bw.WriteString("\n")
+		return err == nil
+	})
+	return bw.Flush()
+}
+
+// fdupesSize matches the line giving the size of the files of a group that
+// precedes it in the output of fdupes -S and jdupes -S.
+var fdupesSize = regexp.MustCompile(`^(\d+) bytes? each:$`)
+
+// ReadFdupes reads the groups of duplicates listed by fdupes or jdupes, as
+// written by WriteReport in FormatFdupes, from r and returns a *Sums
+// containing their files, so that their results may serve as a baseline or
+// be reported in the other formats of WriteReport. Groups are separated by
+// blank lines, and may each be preceded by the line giving the size of their
+// files written by fdupes -S, which the os.FileInfo of each file then
+// reports, and which otherwise reports a size of 0. As fdupes does not list
+// checksums, the files of each group are filed under the SHA1 checksum of
+// the paths of the group instead of that of their contents, so that they are
+// only duplicates of each other.
+func ReadFdupes(r io.Reader) (*Sums, error) {
+	sums := NewSums()
+	var paths []string
+	var size int64
+	flush := func() {
+		if len(paths) > 0 {
+			sum := sha1.Sum([]byte(strings.Join(paths, "\x00")))
+			for _, path := range paths {
+				sums.AppendDigest(Digest(sum[:]), &File{Path: path, Info: &indexInfo{f: indexFile{Path: path, Size: size}}})
+			}
+		}
+		paths, size = nil, 0
+	}
+	sc := bufio.NewScanner(r)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		switch m := fdupesSize.FindStringSubmatch(line); {
+		case line == "":
+			flush()
+		case m != nil && len(paths) == 0:
+			var err error
+			if size, err = strconv.ParseInt(m[1], 10, 64); err != nil {
+				return nil, fmt.Errorf("dedup: reading fdupes output: line %d: invalid size: %q", n, m[1])
+			}
+		default:
+			paths = append(paths, line)
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("dedup: reading fdupes output: %w", err)
+	}
+	flush()
+	return sums, nil
+}
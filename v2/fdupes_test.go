@@ -0,0 +1,60 @@
+package dedup
+
+import (
+	"bytes"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+func TestWriteReportFdupes(t *testing.T) {
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	groups := map[Digest]string{
+		Dup1Sum: "root/foo/bar/dup1\nroot/qux/quux/dup1\n\n",
+		Dup2Sum: "root/dup2\nroot/foo/baz/dup2\nroot/qux/quuz/dup2\n\n",
+		Dup3Sum: "root/foo/dup3\nroot/qux/dup3\n\n",
+	}
+	sorted := []Digest{Dup1Sum, Dup2Sum, Dup3Sum}
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+	var want string
+	for _, sum := range sorted {
+		want += groups[sum]
+	}
+
+	var buf bytes.Buffer
+	if err := sums.WriteReport(&buf, FormatFdupes); err != nil {
+		t.Fatalf("WriteReport(fdupes) = %v", err)
+	}
+	if got := buf.String(); got != want {
+		t.Errorf("WriteReport(fdupes) = %q; want %q", got, want)
+	}
+
+	read, err := ReadFdupes(&buf)
+	if err != nil {
+		t.Fatalf("ReadFdupes() = %v", err)
+	}
+	if got := read.Stats(); got.NumFiles != 7 || got.NumDupFiles != 4 {
+		t.Errorf("ReadFdupes() read %d files, %d duplicates; want 7, 4", got.NumFiles, got.NumDupFiles)
+	}
+}
+
+func TestReadFdupes(t *testing.T) {
+	sums, err := ReadFdupes(strings.NewReader("6 bytes each:\r\n/a/1\r\n/b/1\r\n\r\n1 byte each:\n/a/2\n/b/2\n/c/2\n\n/a/3 bytes each:\n/b/3\n"))
+	if err != nil {
+		t.Fatalf("ReadFdupes() = %v", err)
+	}
+	var got []string
+	for _, g := range sums.DupGroups() {
+		var paths []string
+		for _, file := range g.Files {
+			paths = append(paths, file.Path)
+		}
+		got = append(got, strings.Join(paths, " ")+" "+strings.Repeat("+", int(g.Files[0].Info.Size())))
+	}
+	sort.Strings(got)
+	want := []string{"/a/1 /b/1 ++++++", "/a/2 /b/2 /c/2 +", "/a/3 bytes each: /b/3 "}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("ReadFdupes() groups = %q; want %q", got, want)
+	}
+}
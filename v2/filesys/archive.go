@@ -0,0 +1,468 @@
+package filesys
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ArchiveSep separates the path of an archive from the paths of its members
+// in paths understood by the FileSystem returned by Archives.
+const ArchiveSep = "!"
+
+// IsArchive reports whether name has the extension of an archive format read
+// by the FileSystem returned by Archives: .zip, .tar, .tar.gz, or .tgz.
+func IsArchive(name string) bool {
+	_, ok := archiveFormat(name)
+	return ok
+}
+
+type format int
+
+const (
+	formatZip format = iota
+	formatTar
+	formatTarGz
+)
+
+func archiveFormat(name string) (format, bool) {
+	name = strings.ToLower(name)
+	switch {
+	case strings.HasSuffix(name, ".zip"):
+		return formatZip, true
+	case strings.HasSuffix(name, ".tar"):
+		return formatTar, true
+	case strings.HasSuffix(name, ".tar.gz"), strings.HasSuffix(name, ".tgz"):
+		return formatTarGz, true
+	}
+	return 0, false
+}
+
+// Archives returns a FileSystem that presents zip and tar archives in fs,
+// whether or not they are gzip-compressed, as read-only directories: the
+// members of the archive located at "dir/a.zip" are located under
+// "dir/a.zip!", such as "dir/a.zip!/inner/path", and archives within
+// archives are presented the same way. All other paths are passed to fs.
+// Readlink reports the targets of links in archives relative to the
+// directories of the links, as os.Readlink reports relative links.
+//
+// The index of an archive is read once, when a path within it is first
+// accessed. Opening a member reads it into memory; members of a gzipped tar
+// archive are found by decompressing the archive from the start.
+func Archives(fs FileSystem) FileSystem {
+	return &archiveFS{fs: fs, archives: make(map[string]*archive)}
+}
+
+type archiveFS struct {
+	fs       FileSystem
+	mu       sync.Mutex
+	archives map[string]*archive // Archive paths to loaded archives.
+}
+
+// archive holds the index of the members of an archive.
+type archive struct {
+	once sync.Once
+	err  error
+	fs   FileSystem // Archives(members).
+}
+
+// split splits pth into the path of an archive and the path of a member
+// within it. ok is false if pth is not within an archive.
+func split(pth string) (archivePath, member string, ok bool) {
+	for i := 0; i < len(pth); i++ {
+		if !strings.HasPrefix(pth[i:], ArchiveSep) {
+			continue
+		}
+		rest := pth[i+len(ArchiveSep):]
+		if rest != "" && rest[0] != '/' || !IsArchive(pth[:i]) {
+			continue
+		}
+		return pth[:i], strings.TrimPrefix(rest, "/"), true
+	}
+	return "", "", false
+}
+
+// load returns the FileSystem of the members of the archive located at pth.
+func (fs *archiveFS) load(pth string) (FileSystem, error) {
+	fs.mu.Lock()
+	a, ok := fs.archives[pth]
+	if !ok {
+		a = new(archive)
+		fs.archives[pth] = a
+	}
+	fs.mu.Unlock()
+
+	a.once.Do(func() {
+		var m *members
+		if m, a.err = readMembers(fs.fs, pth); a.err == nil {
+			a.fs = Archives(m)
+		}
+	})
+	return a.fs, a.err
+}
+
+// resolve returns the FileSystem containing pth and the path of pth within
+// it.
+func (fs *archiveFS) resolve(op, pth string) (FileSystem, string, error) {
+	archivePath, member, ok := split(pth)
+	if !ok {
+		return fs.fs, pth, nil
+	}
+	mfs, err := fs.load(archivePath)
+	if err != nil {
+		return nil, "", &os.PathError{Op: op, Path: pth, Err: err}
+	}
+	return mfs, member, nil
+}
+
+// withPath replaces the path of a *os.PathError returned for a member with
+// the path of the member within fs.
+func withPath(err error, pth string) error {
+	if pe, ok := err.(*os.PathError); ok {
+		return &os.PathError{Op: pe.Op, Path: pth, Err: pe.Err}
+	}
+	return err
+}
+
+func (fs *archiveFS) Open(pth string) (File, error) {
+	mfs, member, err := fs.resolve("open", pth)
+	if err != nil {
+		return nil, err
+	}
+	f, err := mfs.Open(member)
+	return f, withPath(err, pth)
+}
+
+func (fs *archiveFS) Lstat(pth string) (os.FileInfo, error) {
+	mfs, member, err := fs.resolve("lstat", pth)
+	if err != nil {
+		return nil, err
+	}
+	info, err := mfs.Lstat(member)
+	return info, withPath(err, pth)
+}
+
+func (fs *archiveFS) Readlink(pth string) (string, error) {
+	archivePath, _, ok := split(pth)
+	mfs, member, err := fs.resolve("readlink", pth)
+	if err != nil {
+		return "", err
+	}
+	target, err := mfs.Readlink(member)
+	if err != nil {
+		return "", withPath(err, pth)
+	}
+	if ok {
+		// Relative to the directory of the link, as os.Readlink would be.
+		target = archivePath + ArchiveSep + "/" + target
+		if rel, err := filepath.Rel(filepath.Dir(pth), target); err == nil {
+			target = rel
+		}
+	}
+	return target, nil
+}
+
+func (fs *archiveFS) Readdirnames(pth string) ([]string, error) {
+	mfs, member, err := fs.resolve("readdirnames", pth)
+	if err != nil {
+		return nil, err
+	}
+	names, err := mfs.Readdirnames(member)
+	return names, withPath(err, pth)
+}
+
+func (fs *archiveFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	mfs, member, err := fs.resolve("readdir", pth)
+	if err != nil {
+		return err
+	}
+	return withPath(ReadDir(mfs, member, fn), pth)
+}
+
+func (fs *archiveFS) Getxattr(pth, name string) ([]byte, error) {
+	mfs, member, err := fs.resolve("getxattr", pth)
+	if err != nil {
+		return nil, err
+	}
+	value, err := GetXattr(mfs, member, name)
+	return value, withPath(err, pth)
+}
+
+func (fs *archiveFS) Setxattr(pth, name string, value []byte) error {
+	mfs, member, err := fs.resolve("setxattr", pth)
+	if err != nil {
+		return err
+	}
+	return withPath(SetXattr(mfs, member, name, value), pth)
+}
+
+// members is a FileSystem for the members of an archive, located at paths
+// relative to the root of the archive.
+type members struct {
+	fs     FileSystem
+	path   string
+	format format
+	infos  map[string]os.FileInfo // Member paths to infos; "" is the root.
+	links  map[string]string      // Member paths to link targets.
+	dirs   map[string][]string    // Directory paths to sorted member names.
+}
+
+// readMembers reads the index of the archive located at pth in fs.
+func readMembers(fs FileSystem, pth string) (*members, error) {
+	m := &members{
+		fs:    fs,
+		path:  pth,
+		infos: map[string]os.FileInfo{"": dirInfo(path.Base(pth)+ArchiveSep, false)},
+		links: make(map[string]string),
+		dirs:  map[string][]string{"": nil},
+	}
+	m.format, _ = archiveFormat(pth)
+	err := m.walk(func(name string, info os.FileInfo, link string, _ func() ([]byte, error)) bool {
+		m.add(name, info, link)
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, names := range m.dirs {
+		sort.Strings(names)
+	}
+	return m, nil
+}
+
+// cleanMember returns the cleaned path of a member named name, or "" if
+// name refers to the root of the archive or outside of it.
+func cleanMember(name string) string {
+	name = path.Clean("/" + name)[1:]
+	if name == "" || strings.HasPrefix(name, "../") {
+		return ""
+	}
+	return name
+}
+
+// add records a member and its parent directories.
+func (m *members) add(name string, info os.FileInfo, link string) {
+	if name = cleanMember(name); name == "" {
+		return
+	}
+	if _, ok := m.infos[name]; ok && !info.IsDir() {
+		return // Keep the first of duplicate members, as extraction would not.
+	}
+	if _, ok := m.infos[name]; !ok {
+		m.addName(name)
+	}
+	m.infos[name] = info
+	if link != "" {
+		m.links[name] = link
+	}
+	if info.IsDir() {
+		if _, ok := m.dirs[name]; !ok {
+			m.dirs[name] = nil
+		}
+	}
+}
+
+// addName adds name to the listing of its parent directory, creating the
+// parent if it has not been seen.
+func (m *members) addName(name string) {
+	dir := path.Dir(name)
+	if dir == "." {
+		dir = ""
+	}
+	if _, ok := m.infos[dir]; !ok {
+		m.infos[dir] = dirInfo(path.Base(dir), false)
+		m.dirs[dir] = nil
+		m.addName(dir)
+	}
+	m.dirs[dir] = append(m.dirs[dir], path.Base(name))
+}
+
+// walk calls f for each member of the archive, in order, until f returns
+// false. read reads the contents of the member.
+func (m *members) walk(f func(name string, info os.FileInfo, link string, read func() ([]byte, error)) bool) error {
+	r, err := m.fs.Open(m.path)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	if m.format == formatZip {
+		size, err := r.Seek(0, io.SeekEnd)
+		if err != nil {
+			return err
+		}
+		zr, err := zip.NewReader(&readerAt{r: r}, size)
+		if err != nil {
+			return err
+		}
+		for _, zf := range zr.File {
+			zf := zf
+			read := func() ([]byte, error) {
+				rc, err := zf.Open()
+				if err != nil {
+					return nil, err
+				}
+				defer rc.Close()
+				return ioutil.ReadAll(rc)
+			}
+			link := ""
+			if zf.Mode()&os.ModeSymlink != 0 {
+				b, err := read()
+				if err != nil {
+					return err
+				}
+				link = string(b)
+			}
+			if !f(zf.Name, zf.FileInfo(), link, read) {
+				break
+			}
+		}
+		return nil
+	}
+
+	var in io.Reader = r
+	if m.format == formatTarGz {
+		gz, err := gzip.NewReader(r)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		in = gz
+	}
+	tr := tar.NewReader(in)
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		link := ""
+		switch hdr.Typeflag {
+		case tar.TypeSymlink:
+			link = hdr.Linkname
+		case tar.TypeLink:
+			// Hard links are presented as symbolic links to the member
+			// they link to, which is named relative to the root.
+			link = "/" + hdr.Linkname
+			hdr.Typeflag = tar.TypeSymlink
+		case tar.TypeReg, tar.TypeDir:
+		default:
+			continue
+		}
+		read := func() ([]byte, error) { return ioutil.ReadAll(tr) }
+		if !f(hdr.Name, hdr.FileInfo(), link, read) {
+			return nil
+		}
+	}
+}
+
+// maxLinks is the greatest number of symbolic links followed by Open.
+const maxLinks = 40
+
+// errLinkLoop is the cause of the error returned by Open for a member that
+// leads through more than maxLinks symbolic links. syscall.ELOOP is not
+// defined on every platform, such as Plan 9.
+var errLinkLoop = errors.New("too many levels of symbolic links")
+
+func (m *members) Open(pth string) (File, error) { return m.open(pth, 0) }
+
+func (m *members) open(pth string, links int) (File, error) {
+	pth = cleanMember(pth)
+	info, ok := m.infos[pth]
+	if !ok {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: os.ErrNotExist}
+	}
+	if info.IsDir() {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: syscall.EISDIR}
+	}
+	if _, ok := m.links[pth]; ok {
+		if links == maxLinks {
+			return nil, &os.PathError{Op: "open", Path: pth, Err: errLinkLoop}
+		}
+		target, _ := m.Readlink(pth)
+		return m.open(target, links+1)
+	}
+
+	var b []byte
+	var readErr error
+	found := false
+	err := m.walk(func(name string, _ os.FileInfo, _ string, read func() ([]byte, error)) bool {
+		if cleanMember(name) != pth {
+			return true
+		}
+		found = true
+		b, readErr = read()
+		return false
+	})
+	if err == nil {
+		err = readErr
+	}
+	if err == nil && !found {
+		err = os.ErrNotExist
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: err}
+	}
+	return nopCloser{bytes.NewReader(b)}, nil
+}
+
+func (m *members) Lstat(pth string) (os.FileInfo, error) {
+	if info, ok := m.infos[cleanMember(pth)]; ok {
+		return info, nil
+	}
+	return nil, &os.PathError{Op: "lstat", Path: pth, Err: os.ErrNotExist}
+}
+
+// Readlink returns the target of the symbolic link located at pth relative
+// to the root of the archive.
+func (m *members) Readlink(pth string) (string, error) {
+	pth = cleanMember(pth)
+	target, ok := m.links[pth]
+	if !ok {
+		return "", &os.PathError{Op: "readlink", Path: pth, Err: syscall.EINVAL}
+	}
+	if path.IsAbs(target) {
+		target = target[1:]
+	} else {
+		target = path.Join(path.Dir(pth), target)
+	}
+	return cleanMember(target), nil
+}
+
+func (m *members) Readdirnames(pth string) ([]string, error) {
+	names, ok := m.dirs[cleanMember(pth)]
+	if !ok {
+		return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: os.ErrNotExist}
+	}
+	return append([]string(nil), names...), nil
+}
+
+// readerAt implements io.ReaderAt for a File. It is not safe for concurrent
+// use.
+type readerAt struct {
+	r File
+}
+
+func (ra *readerAt) ReadAt(p []byte, off int64) (int, error) {
+	if _, err := ra.r.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(ra.r, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
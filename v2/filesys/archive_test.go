@@ -0,0 +1,151 @@
+package filesys
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func zipBytes(files map[string]string) []byte {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for name, contents := range files {
+		f, err := w.Create(name)
+		if err != nil {
+			panic(err)
+		}
+		_, _ = f.Write([]byte(contents))
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func tgzBytes(hdrs []*tar.Header, contents []string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for i, hdr := range hdrs {
+		hdr.Size = int64(len(contents[i]))
+		if err := w.WriteHeader(hdr); err != nil {
+			panic(err)
+		}
+		_, _ = w.Write([]byte(contents[i]))
+	}
+	if err := w.Close(); err != nil {
+		panic(err)
+	}
+	if err := gz.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+var archiveFiles = Archives(Map(map[string][]byte{
+	"dir/a.zip": zipBytes(map[string]string{
+		"file1":       "file1 contents",
+		"sub/file2":   "file2 contents",
+		"sub/b.zip!x": "not an archive",
+	}),
+	"dir/b.tgz": tgzBytes([]*tar.Header{
+		{Name: "./file3", Typeflag: tar.TypeReg, Mode: 0644},
+		{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "file3", Mode: 0777},
+		{Name: "hard", Typeflag: tar.TypeLink, Linkname: "file3", Mode: 0644},
+		{Name: "inner.zip", Typeflag: tar.TypeReg, Mode: 0644},
+	}, []string{"file3 contents", "", "", string(zipBytes(map[string]string{
+		"file4": "file4 contents",
+	}))}),
+	"dir/c.zip": []byte("corrupt"),
+	"dir/file5": []byte("file5 contents"),
+}, nil))
+
+func TestArchivesReaddirnames(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"dir", []string{"a.zip", "b.tgz", "c.zip", "file5"}},
+		{"dir/a.zip!", []string{"file1", "sub"}},
+		{"dir/a.zip!/sub", []string{"b.zip!x", "file2"}},
+		{"dir/b.tgz!", []string{"file3", "hard", "inner.zip", "link"}},
+		{"dir/b.tgz!/inner.zip!", []string{"file4"}},
+	}
+	for _, tt := range tests {
+		got, err := archiveFiles.Readdirnames(tt.path)
+		if err != nil {
+			t.Errorf("Readdirnames(%q) = %v", tt.path, err)
+		} else if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("Readdirnames(%q) = %v; want %v", tt.path, got, tt.want)
+		}
+	}
+}
+
+func TestArchivesOpen(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"dir/file5", "file5 contents"},
+		{"dir/a.zip!/file1", "file1 contents"},
+		{"dir/a.zip!/sub/file2", "file2 contents"},
+		{"dir/a.zip!/sub/b.zip!x", "not an archive"},
+		{"dir/b.tgz!/file3", "file3 contents"},
+		{"dir/b.tgz!/link", "file3 contents"},
+		{"dir/b.tgz!/hard", "file3 contents"},
+		{"dir/b.tgz!/inner.zip!/file4", "file4 contents"},
+	}
+	for _, tt := range tests {
+		f, err := archiveFiles.Open(tt.path)
+		if err != nil {
+			t.Errorf("Open(%q) = %v", tt.path, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(f)
+		if string(b) != tt.want {
+			t.Errorf("Open(%q) read %q; want %q", tt.path, b, tt.want)
+		}
+	}
+
+	for _, path := range []string{"dir/a.zip!/bogus", "dir/bogus.zip!/file1"} {
+		if _, err := archiveFiles.Open(path); !os.IsNotExist(err) {
+			t.Errorf("Open(%q) = %v; want not exist", path, err)
+		}
+	}
+	if _, err := archiveFiles.Open("dir/c.zip!/file"); err == nil {
+		t.Errorf("Open(%q) = nil; want error", "dir/c.zip!/file")
+	}
+}
+
+func TestArchivesLstat(t *testing.T) {
+	tests := []struct {
+		path string
+		dir  bool
+		link bool
+	}{
+		{"dir/a.zip", false, false},
+		{"dir/a.zip!", true, false},
+		{"dir/a.zip!/sub", true, false},
+		{"dir/b.tgz!/link", false, true},
+		{"dir/b.tgz!/hard", false, true},
+	}
+	for _, tt := range tests {
+		info, err := archiveFiles.Lstat(tt.path)
+		if err != nil {
+			t.Errorf("Lstat(%q) = %v", tt.path, err)
+			continue
+		}
+		if info.IsDir() != tt.dir || (info.Mode()&os.ModeSymlink != 0) != tt.link {
+			t.Errorf("Lstat(%q) = %v; want dir %t, link %t", tt.path, info.Mode(), tt.dir, tt.link)
+		}
+	}
+
+	if got, err := archiveFiles.Readlink("dir/b.tgz!/link"); err != nil || got != "file3" {
+		t.Errorf("Readlink() = %q, %v; want %q", got, err, "file3")
+	}
+}
@@ -0,0 +1,65 @@
+package filesys
+
+import (
+	"os"
+	"path/filepath"
+)
+
+// Dir returns a FileSystem in which relative paths are located in the
+// directory dir of fs, which may be a URL, and absolute paths and URLs are
+// passed to fs as they are, so that the files found in dir are named
+// relative to it.
+func Dir(fs FileSystem, dir string) FileSystem {
+	return dirFS{fs: fs, dir: dir}
+}
+
+type dirFS struct {
+	fs  FileSystem
+	dir string
+}
+
+var (
+	_ DirReader = dirFS{}
+	_ Xattrs    = dirFS{}
+)
+
+// join returns the path in fs.fs of pth.
+func (fs dirFS) join(pth string) string {
+	switch {
+	case filepath.IsAbs(pth) || IsURL(pth):
+		return pth
+	case IsURL(fs.dir) && pth == ".":
+		return fs.dir
+	case IsURL(fs.dir):
+		return JoinURL(fs.dir, filepath.ToSlash(pth))
+	}
+	return filepath.Join(fs.dir, pth)
+}
+
+func (fs dirFS) Open(pth string) (File, error) {
+	return fs.fs.Open(fs.join(pth))
+}
+
+func (fs dirFS) Lstat(pth string) (os.FileInfo, error) {
+	return fs.fs.Lstat(fs.join(pth))
+}
+
+func (fs dirFS) Readlink(pth string) (string, error) {
+	return fs.fs.Readlink(fs.join(pth))
+}
+
+func (fs dirFS) Readdirnames(pth string) ([]string, error) {
+	return fs.fs.Readdirnames(fs.join(pth))
+}
+
+func (fs dirFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	return ReadDir(fs.fs, fs.join(pth), fn)
+}
+
+func (fs dirFS) Getxattr(pth, name string) ([]byte, error) {
+	return GetXattr(fs.fs, fs.join(pth), name)
+}
+
+func (fs dirFS) Setxattr(pth, name string, value []byte) error {
+	return SetXattr(fs.fs, fs.join(pth), name, value)
+}
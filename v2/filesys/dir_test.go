@@ -0,0 +1,29 @@
+package filesys
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+)
+
+func TestDir(t *testing.T) {
+	fs := Dir(FS, "bar")
+	f, err := fs.Open("baz/file3")
+	if err != nil {
+		t.Fatalf("Open(baz/file3) = %v", err)
+	}
+	b, _ := ioutil.ReadAll(f)
+	if string(b) != "file3 contents" {
+		t.Errorf("want file3 contents; got %s", b)
+	}
+	if target, err := fs.Readlink("link1"); err != nil || target != "foo/file2" {
+		t.Errorf("Readlink(link1) = %q, %v; want foo/file2", target, err)
+	}
+	names, err := fs.Readdirnames(".")
+	if want := []string{"baz", "file4", "link1"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("Readdirnames(.) = %q, %v; want %q", names, err, want)
+	}
+	if _, err := fs.Lstat("file1"); err == nil {
+		t.Errorf("Lstat(file1) = <nil>; want an error outside bar")
+	}
+}
@@ -0,0 +1,106 @@
+// Package filesys provides an abstraction for working with file systems,
+// mainly to facilitate testing.
+package filesys
+
+import (
+	"io"
+	"os"
+	"sort"
+)
+
+// FileSystem provides the interface for operations over a file system.
+type FileSystem interface {
+	Open(path string) (File, error)
+	Lstat(path string) (os.FileInfo, error)
+	Readlink(path string) (string, error)
+	Readdirnames(path string) ([]string, error)
+}
+
+// Mover is implemented by FileSystems that can move files, such as the one
+// returned by OS.
+type Mover interface {
+	FileSystem
+	Rename(oldpath, newpath string) error         // Move a file, replacing any file at newpath.
+	MkdirAll(path string, perm os.FileMode) error // Create a directory and any missing parents.
+}
+
+// MutableFileSystem is implemented by FileSystems whose files can be
+// created, changed, and removed, such as the ones returned by OS and Map.
+type MutableFileSystem interface {
+	Mover
+	Create(path string) (io.WriteCloser, error) // Create or truncate a file for writing.
+	Remove(path string) error                   // Remove a file or an empty directory.
+	Link(oldpath, newpath string) error         // Make newpath a hard link to the file at oldpath.
+	Symlink(oldname, newname string) error      // Make newname a symbolic link to oldname.
+}
+
+// File provides the interface implemented by values returned from a file
+// system's Open method.
+type File interface {
+	io.Reader
+	io.Seeker
+	io.Closer
+}
+
+// OS returns a FileSystem for working with os files.
+func OS() FileSystem {
+	return osFS{}
+}
+
+// OSWithHints returns a FileSystem like the one returned by OS, except that
+// on Linux files are opened with O_NOATIME where permitted, so that reading
+// them leaves their access times alone, and the kernel is advised that they
+// are read sequentially and that their pages are no longer needed once they
+// are closed, so that reading many files does not evict the page cache.
+func OSWithHints() FileSystem {
+	return osFS{hints: true}
+}
+
+// osFS operates on paths as given, except on Windows, where long paths are
+// given the prefix that lifts the MAX_PATH limit; see longPath.
+type osFS struct {
+	hints bool // Open files with openHinted.
+}
+
+var _ MutableFileSystem = osFS{}
+
+func (fs osFS) Open(pth string) (File, error) {
+	if fs.hints {
+		return openHinted(longPath(pth))
+	}
+	return os.Open(longPath(pth))
+}
+
+func (osFS) Lstat(pth string) (os.FileInfo, error) { return os.Lstat(longPath(pth)) }
+
+func (osFS) Readlink(pth string) (string, error) { return os.Readlink(longPath(pth)) }
+
+func (osFS) Readdirnames(pth string) (names []string, err error) {
+	f, err := os.Open(longPath(pth))
+	if err != nil {
+		return
+	}
+	names, err = f.Readdirnames(0)
+	_ = f.Close()
+	if err != nil {
+		return
+	}
+	sort.Strings(names)
+	return
+}
+
+func (osFS) Rename(oldpath, newpath string) error {
+	return os.Rename(longPath(oldpath), longPath(newpath))
+}
+
+func (osFS) MkdirAll(pth string, perm os.FileMode) error { return os.MkdirAll(longPath(pth), perm) }
+
+func (osFS) Create(pth string) (io.WriteCloser, error) { return os.Create(longPath(pth)) }
+
+func (osFS) Remove(pth string) error { return os.Remove(longPath(pth)) }
+
+func (osFS) Link(oldpath, newpath string) error {
+	return os.Link(longPath(oldpath), longPath(newpath))
+}
+
+func (osFS) Symlink(oldname, newname string) error { return os.Symlink(oldname, longPath(newname)) }
@@ -0,0 +1,49 @@
+//go:build linux && (amd64 || arm64)
+// +build linux
+// +build amd64 arm64
+
+package filesys
+
+import (
+	"errors"
+	"os"
+	"syscall"
+)
+
+// Advice given to the kernel with posix_fadvise.
+const (
+	fadvSequential = 2 // POSIX_FADV_SEQUENTIAL
+	fadvDontNeed   = 4 // POSIX_FADV_DONTNEED
+)
+
+// openHinted opens the file located at pth for reading with O_NOATIME, unless
+// that is not permitted, which it only is to the owner of the file and to
+// privileged processes, and advises the kernel that it is read sequentially
+// and that its cached pages may be dropped once it is closed.
+func openHinted(pth string) (File, error) {
+	f, err := os.OpenFile(pth, os.O_RDONLY|syscall.O_NOATIME, 0)
+	if errors.Is(err, syscall.EPERM) {
+		f, err = os.Open(pth)
+	}
+	if err != nil {
+		return nil, err
+	}
+	fadvise(f, fadvSequential)
+	return hintedFile{f}, nil
+}
+
+// hintedFile is a file opened by openHinted.
+type hintedFile struct {
+	*os.File
+}
+
+func (f hintedFile) Close() error {
+	fadvise(f.File, fadvDontNeed)
+	return f.File.Close()
+}
+
+// fadvise gives the kernel advice about the whole of f, ignoring errors since
+// advice is only a hint.
+func fadvise(f *os.File, advice int) {
+	_, _, _ = syscall.Syscall6(syscall.SYS_FADVISE64, f.Fd(), 0, 0, uintptr(advice), 0, 0)
+}
@@ -0,0 +1,35 @@
+package filesys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOSWithHints(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	pth := filepath.Join(root, "file")
+	if err := ioutil.WriteFile(pth, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f, err := OSWithHints().Open(pth)
+	if err != nil {
+		t.Fatalf("Open() = %v", err)
+	}
+	b, err := ioutil.ReadAll(f)
+	if err != nil || string(b) != "contents" {
+		t.Errorf("read %q, %v; want %q", b, err, "contents")
+	}
+	if err := f.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if _, err := OSWithHints().Open(filepath.Join(root, "missing")); !os.IsNotExist(err) {
+		t.Errorf("Open(missing) = %v; want an error satisfying os.IsNotExist", err)
+	}
+}
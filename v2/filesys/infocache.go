@@ -0,0 +1,53 @@
+package filesys
+
+import (
+	"os"
+	"sync"
+)
+
+// maxCachedInfos is the greatest number of os.FileInfos held by an
+// infoCache; those listed beyond it are not cached.
+const maxCachedInfos = 1 << 16
+
+// infoCache holds the os.FileInfos of the files listed by the Readdirnames
+// method of a remote FileSystem, so that the first Lstat of each may be
+// answered without a round trip to the server. Each is handed out once, as
+// the file may change afterwards, and at most maxCachedInfos are held, so
+// that listing a large tree does not hold on to memory in proportion to it.
+// The zero value is an empty infoCache.
+type infoCache struct {
+	mu    sync.Mutex
+	infos map[string]os.FileInfo
+}
+
+// put caches info for key, unless the cache is full.
+func (c *infoCache) put(key string, info os.FileInfo) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.infos == nil {
+		c.infos = make(map[string]os.FileInfo)
+	}
+	if _, ok := c.infos[key]; ok || len(c.infos) < maxCachedInfos {
+		c.infos[key] = info
+	}
+}
+
+// take returns the info cached for key, if any, and removes it from the
+// cache.
+func (c *infoCache) take(key string) (os.FileInfo, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	info, ok := c.infos[key]
+	delete(c.infos, key)
+	return info, ok
+}
+
+// drop removes the info cached for key, if any.
+func (c *infoCache) drop(key string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.infos, key)
+}
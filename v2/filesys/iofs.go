@@ -0,0 +1,129 @@
+package filesys
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// errNoSeek is the cause of the errors returned by the Seek method of the
+// files of the FileSystem returned by FromFS, for files of the fs.FS that are
+// not io.Seekers.
+var errNoSeek = errors.New("seeking is not supported")
+
+// FromFS returns a FileSystem for fsys, such as an embed.FS or the fs.FS
+// returned by os.DirFS, whose paths are the paths of fsys written with the
+// separator of the operating system, so that paths joined with filepath.Join
+// may be given to it. Since an fs.FS has no symbolic links, Lstat is fs.Stat
+// and Readlink always fails. The files it opens can only seek if those of
+// fsys are io.Seekers.
+func FromFS(fsys fs.FS) FileSystem {
+	return ioFS{fsys}
+}
+
+type ioFS struct {
+	fsys fs.FS
+}
+
+var _ DirReader = ioFS{}
+
+// name returns the name in fs of the file located at pth, or an error if it
+// is not a valid name for fs.FS.
+func (ioFS) name(op, pth string) (string, error) {
+	name := path.Clean(filepath.ToSlash(pth))
+	if !fs.ValidPath(name) {
+		return "", &os.PathError{Op: op, Path: pth, Err: fs.ErrInvalid}
+	}
+	return name, nil
+}
+
+func (ifs ioFS) Open(pth string) (File, error) {
+	name, err := ifs.name("open", pth)
+	if err != nil {
+		return nil, err
+	}
+	f, err := ifs.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	return ioFile{f, pth}, nil
+}
+
+func (ifs ioFS) Lstat(pth string) (os.FileInfo, error) {
+	name, err := ifs.name("lstat", pth)
+	if err != nil {
+		return nil, err
+	}
+	return fs.Stat(ifs.fsys, name)
+}
+
+func (ioFS) Readlink(pth string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: pth, Err: fs.ErrInvalid}
+}
+
+func (ifs ioFS) Readdirnames(pth string) ([]string, error) {
+	name, err := ifs.name("readdirnames", pth)
+	if err != nil {
+		return nil, err
+	}
+	entries, err := fs.ReadDir(ifs.fsys, name)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func (ifs ioFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	name, err := ifs.name("readdir", pth)
+	if err != nil {
+		return err
+	}
+	f, err := ifs.fsys.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	d, ok := f.(fs.ReadDirFile)
+	if !ok {
+		entries, err := fs.ReadDir(ifs.fsys, name)
+		if err == nil && len(entries) > 0 {
+			err = fn(entries)
+		}
+		return err
+	}
+	for {
+		entries, err := d.ReadDir(dirBatchSize)
+		if len(entries) > 0 {
+			if ferr := fn(entries); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
+
+// ioFile is a file opened by the FileSystem returned by FromFS.
+type ioFile struct {
+	fs.File
+	pth string
+}
+
+func (f ioFile) Seek(offset int64, whence int) (int64, error) {
+	if s, ok := f.File.(io.Seeker); ok {
+		return s.Seek(offset, whence)
+	}
+	return 0, &os.PathError{Op: "seek", Path: f.pth, Err: errNoSeek}
+}
@@ -0,0 +1,59 @@
+package filesys
+
+import (
+	"errors"
+	"io"
+	"io/fs"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"testing/fstest"
+)
+
+func TestFromFS(t *testing.T) {
+	fsys := FromFS(fstest.MapFS{
+		"a/b":   {Data: []byte("b")},
+		"a/c/d": {Data: []byte("dd")},
+		"e":     {Data: []byte("eee")},
+	})
+
+	if names, err := fsys.Readdirnames("a"); err != nil || !reflect.DeepEqual(names, []string{"b", "c"}) {
+		t.Errorf("Readdirnames(a) = %q, %v; want [b c]", names, err)
+	}
+	var listed []string
+	err := ReadDir(fsys, ".", func(entries []os.DirEntry) error {
+		for _, e := range entries {
+			listed = append(listed, e.Name())
+		}
+		return nil
+	})
+	if err != nil || !reflect.DeepEqual(listed, []string{"a", "e"}) {
+		t.Errorf("ReadDir(.) listed %q, %v; want [a e]", listed, err)
+	}
+
+	pth := filepath.Join("a", "c", "d")
+	if info, err := fsys.Lstat(pth); err != nil || info.Size() != 2 {
+		t.Errorf("Lstat(%s) = %v, %v; want a file of 2 bytes", pth, info, err)
+	}
+	f, err := fsys.Open(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, _ := ioutil.ReadAll(f)
+	if _, err := f.Seek(0, io.SeekStart); err != nil || string(b) != "dd" {
+		t.Errorf("read %q, Seek() = %v; want dd, seekable", b, err)
+	}
+	_ = f.Close()
+
+	if _, err := fsys.Open("/e"); !errors.Is(err, fs.ErrInvalid) {
+		t.Errorf("Open(/e) = %v; want %v", err, fs.ErrInvalid)
+	}
+	if _, err := fsys.Lstat("missing"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("Lstat(missing) = %v; want %v", err, fs.ErrNotExist)
+	}
+	if _, err := fsys.Readlink("e"); err == nil {
+		t.Error("Readlink(e) = nil; want an error")
+	}
+}
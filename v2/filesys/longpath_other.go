@@ -0,0 +1,7 @@
+//go:build !windows
+// +build !windows
+
+package filesys
+
+// longPath returns pth: only Windows limits the length of paths.
+func longPath(pth string) string { return pth }
@@ -0,0 +1,30 @@
+package filesys
+
+import (
+	"path/filepath"
+	"strings"
+)
+
+// maxPath is the length from which paths are given the long path prefix, so
+// that directories, whose paths are limited to MAX_PATH less room for an 8.3
+// file name, may be created as well as files.
+const maxPath = 248
+
+// longPath returns pth in the form that Windows accepts beyond MAX_PATH: made
+// absolute and prefixed with \\?\, or with \\?\UNC\ in place of the leading
+// \\ of a UNC path. pth is returned as is if it is short enough, already has
+// a prefix, or cannot be made absolute. The os package does this itself for
+// most absolute paths, but not for relative ones or those containing "..".
+func longPath(pth string) string {
+	if len(pth) < maxPath || strings.HasPrefix(pth, `\\?\`) || strings.HasPrefix(pth, `\\.\`) {
+		return pth
+	}
+	abs, err := filepath.Abs(pth)
+	if err != nil {
+		return pth
+	}
+	if strings.HasPrefix(abs, `\\`) {
+		return `\\?\UNC\` + abs[2:]
+	}
+	return `\\?\` + abs
+}
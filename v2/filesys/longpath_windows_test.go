@@ -0,0 +1,65 @@
+package filesys
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLongPath(t *testing.T) {
+	long := strings.Repeat("d", 100) + `\` + strings.Repeat("e", 100) + `\` + strings.Repeat("f", 100)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		pth, want string
+	}{
+		{`C:\short`, `C:\short`},
+		{`C:\` + long, `\\?\C:\` + long},
+		{`C:\x\..\` + long, `\\?\C:\` + long},
+		{long, `\\?\` + filepath.Join(wd, long)},
+		{`\\server\share\` + long, `\\?\UNC\server\share\` + long},
+		{`\\?\C:\` + long, `\\?\C:\` + long},
+	}
+	for _, tt := range tests {
+		if got := longPath(tt.pth); got != tt.want {
+			t.Errorf("longPath(%q) = %q; want %q", tt.pth, got, tt.want)
+		}
+	}
+}
+
+func TestOSLongPath(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// A relative path, which the os package would not lengthen.
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, root)
+	if err != nil {
+		t.Skip(err) // The temporary directory is on another volume.
+	}
+	pth := filepath.Join(rel, strings.Repeat("d", maxPath), strings.Repeat("e", maxPath))
+	fs := OS().(Mover)
+	if err := fs.MkdirAll(pth, 0755); err != nil {
+		t.Fatalf("MkdirAll(%q): %v", pth, err)
+	}
+	if err := ioutil.WriteFile(longPath(filepath.Join(pth, "f")), []byte("f"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	names, err := fs.Readdirnames(pth)
+	if err != nil || len(names) != 1 || names[0] != "f" {
+		t.Errorf("Readdirnames(%q) = %q, %v; want [f]", pth, names, err)
+	}
+	if _, err := fs.Lstat(filepath.Join(pth, "f")); err != nil {
+		t.Errorf("Lstat: %v", err)
+	}
+}
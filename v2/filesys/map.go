@@ -0,0 +1,392 @@
+package filesys
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Map returns a FileSystem for m, wherein keys are file paths and values
+// are file contents. File paths should not contain a leading slash. If links
+// is not nil, it will be used to simulate symbolic links: for each key in m
+// that is also in links, its value in m is treated as the link target,
+// which, as for os.Readlink, is relative to the directory of the link.
+//
+// The FileSystem returned is also a MutableFileSystem, for testing code that
+// changes files without touching the disk; its changes are made to m, which
+// may be nil to start out empty. Directories exist as long as they contain
+// files, or once created by MkdirAll until removed.
+func Map(m map[string][]byte, links []string) FileSystem {
+	if m == nil {
+		m = make(map[string][]byte)
+	}
+	lm := make(map[string]interface{})
+	for _, link := range links {
+		lm[link] = nil
+	}
+	return &mapFS{files: m, links: lm, dirs: make(map[string]bool), inodes: make(map[string]int)}
+}
+
+type mapFS struct {
+	mu     sync.RWMutex
+	files  map[string][]byte
+	links  map[string]interface{} // Symbolic link lookup; values ignored.
+	dirs   map[string]bool        // Directories created by MkdirAll.
+	inodes map[string]int         // Files sharing their contents as hard links, by path; see Link.
+	inode  int                    // Last inode assigned.
+}
+
+var _ MutableFileSystem = (*mapFS)(nil)
+
+// errNotEmpty is the cause of the errors returned by Remove and Rename for a
+// directory that is not empty, as errNotEmpty is not defined on every
+// platform, such as Plan 9.
+var errNotEmpty = errors.New("directory not empty")
+
+func (fs *mapFS) Open(pth string) (File, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	b, exist := fs.files[pth]
+	if !exist {
+		return nil, os.ErrNotExist
+	}
+	return nopCloser{bytes.NewReader(b)}, nil
+}
+
+func (fs *mapFS) Lstat(pth string) (os.FileInfo, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, link := fs.links[pth]
+	b, exist := fs.files[pth]
+	if exist {
+		return fileInfo(pth, len(b), link), nil
+	}
+	if fs.isDir(pth) {
+		return dirInfo(pth, link), nil
+	}
+	return nil, os.ErrNotExist
+}
+
+func (fs *mapFS) Readlink(pth string) (string, error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	_, link := fs.links[pth]
+	b, exist := fs.files[pth]
+	if exist && link {
+		return string(b), nil
+	}
+	return "", &os.PathError{Op: "readlink", Path: pth, Err: syscall.EINVAL}
+}
+
+// Readdirnames reports the names of files contained by the directory at pth.
+// To read the top-level directory, specify an empty string.
+func (fs *mapFS) Readdirnames(pth string) (names []string, err error) {
+	fs.mu.RLock()
+	defer fs.mu.RUnlock()
+
+	return fs.readdirnames(pth)
+}
+
+func (fs *mapFS) readdirnames(pth string) (names []string, err error) {
+	pth = path.Clean(pth)
+	if pth == "" || pth == "/" {
+		pth = "."
+	}
+	seen := make(map[string]bool)
+	paths := make([]string, 0, len(fs.files)+len(fs.dirs))
+	for p := range fs.files {
+		paths = append(paths, p)
+	}
+	for p := range fs.dirs {
+		paths = append(paths, p)
+	}
+	for _, p := range paths {
+		dir := path.Dir(p)
+		file := true
+		var lastBase string
+		for {
+			if dir == pth {
+				base := lastBase
+				if file {
+					base = path.Base(p)
+				}
+				seen[base] = true
+			}
+			if dir == "." {
+				break
+			} else {
+				file = false
+				lastBase = path.Base(dir)
+				dir = path.Dir(dir)
+			}
+		}
+	}
+	if len(seen) > 0 {
+		for name := range seen {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+	} else if !fs.dirs[pth] {
+		err = os.ErrNotExist
+	}
+	return
+}
+
+// isDir reports whether a directory exists at pth.
+func (fs *mapFS) isDir(pth string) bool {
+	if fs.dirs[path.Clean(pth)] {
+		return true
+	}
+	names, _ := fs.readdirnames(pth)
+	return len(names) > 0
+}
+
+func (fs *mapFS) Create(pth string) (io.WriteCloser, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checkParent("open", pth); err != nil {
+		return nil, err
+	}
+	if fs.isDir(pth) {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: syscall.EISDIR}
+	}
+	if _, exist := fs.files[pth]; !exist {
+		fs.files[pth] = nil
+	}
+	delete(fs.links, pth)
+	return &mapWriter{fs: fs, path: pth}, nil
+}
+
+// mapWriter writes the contents of a file of a mapFS once closed.
+type mapWriter struct {
+	bytes.Buffer
+	fs   *mapFS
+	path string
+}
+
+func (w *mapWriter) Close() error {
+	w.fs.mu.Lock()
+	defer w.fs.mu.Unlock()
+
+	b := w.Bytes()
+	w.fs.files[w.path] = b
+	if inode, ok := w.fs.inodes[w.path]; ok {
+		for p, i := range w.fs.inodes {
+			if i == inode {
+				w.fs.files[p] = b
+			}
+		}
+	}
+	return nil
+}
+
+func (fs *mapFS) Remove(pth string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if _, exist := fs.files[pth]; exist {
+		delete(fs.files, pth)
+		delete(fs.links, pth)
+		delete(fs.inodes, pth)
+		return nil
+	}
+	if names, _ := fs.readdirnames(pth); len(names) > 0 {
+		return &os.PathError{Op: "remove", Path: pth, Err: errNotEmpty}
+	}
+	if !fs.dirs[path.Clean(pth)] {
+		return &os.PathError{Op: "remove", Path: pth, Err: os.ErrNotExist}
+	}
+	delete(fs.dirs, path.Clean(pth))
+	return nil
+}
+
+func (fs *mapFS) Rename(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if path.Clean(oldpath) == path.Clean(newpath) {
+		return nil
+	}
+	if err := fs.checkParent("rename", newpath); err != nil {
+		return err
+	}
+	if b, exist := fs.files[oldpath]; exist {
+		if fs.isDir(newpath) {
+			return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.EISDIR}
+		}
+		fs.move(oldpath, newpath, b)
+		return nil
+	}
+	if !fs.isDir(oldpath) {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if _, exist := fs.files[newpath]; exist {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: syscall.ENOTDIR}
+	}
+	if names, _ := fs.readdirnames(newpath); len(names) > 0 {
+		return &os.LinkError{Op: "rename", Old: oldpath, New: newpath, Err: errNotEmpty}
+	}
+	old := path.Clean(oldpath)
+	var files, dirs []string
+	for p := range fs.files {
+		if strings.HasPrefix(p, old+"/") {
+			files = append(files, p)
+		}
+	}
+	for d := range fs.dirs {
+		if d == old || strings.HasPrefix(d, old+"/") {
+			dirs = append(dirs, d)
+		}
+	}
+	for _, p := range files {
+		fs.move(p, path.Join(newpath, p[len(old):]), fs.files[p])
+	}
+	for _, d := range dirs {
+		delete(fs.dirs, d)
+		fs.dirs[path.Join(newpath, d[len(old):])] = true
+	}
+	return nil
+}
+
+// move moves the file at oldpath, with contents b, to newpath, replacing any
+// file there.
+func (fs *mapFS) move(oldpath, newpath string, b []byte) {
+	delete(fs.links, newpath)
+	delete(fs.inodes, newpath)
+	fs.files[newpath] = b
+	if _, link := fs.links[oldpath]; link {
+		fs.links[newpath] = nil
+	}
+	if inode, ok := fs.inodes[oldpath]; ok {
+		fs.inodes[newpath] = inode
+	}
+	delete(fs.files, oldpath)
+	delete(fs.links, oldpath)
+	delete(fs.inodes, oldpath)
+}
+
+func (fs *mapFS) MkdirAll(pth string, perm os.FileMode) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	for p := path.Clean(pth); p != "." && p != "/"; p = path.Dir(p) {
+		if _, exist := fs.files[p]; exist {
+			return &os.PathError{Op: "mkdir", Path: p, Err: syscall.ENOTDIR}
+		}
+		fs.dirs[p] = true
+	}
+	return nil
+}
+
+// Link makes newpath a hard link to the file at oldpath: writing either
+// changes both.
+func (fs *mapFS) Link(oldpath, newpath string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	b, exist := fs.files[oldpath]
+	if _, link := fs.links[oldpath]; !exist || link {
+		return &os.LinkError{Op: "link", Old: oldpath, New: newpath, Err: os.ErrNotExist}
+	}
+	if err := fs.checkNew("link", oldpath, newpath); err != nil {
+		return err
+	}
+	inode, ok := fs.inodes[oldpath]
+	if !ok {
+		fs.inode++
+		inode = fs.inode
+		fs.inodes[oldpath] = inode
+	}
+	fs.files[newpath] = b
+	fs.inodes[newpath] = inode
+	return nil
+}
+
+func (fs *mapFS) Symlink(oldname, newname string) error {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+
+	if err := fs.checkNew("symlink", oldname, newname); err != nil {
+		return err
+	}
+	fs.files[newname] = []byte(oldname)
+	fs.links[newname] = nil
+	return nil
+}
+
+// checkNew returns an error if newpath may not be created by op.
+func (fs *mapFS) checkNew(op, oldpath, newpath string) error {
+	if _, exist := fs.files[newpath]; exist || fs.isDir(newpath) {
+		return &os.LinkError{Op: op, Old: oldpath, New: newpath, Err: os.ErrExist}
+	}
+	if err := fs.checkParent(op, newpath); err != nil {
+		return &os.LinkError{Op: op, Old: oldpath, New: newpath, Err: err.(*os.PathError).Err}
+	}
+	return nil
+}
+
+// checkParent returns an error if the parent of pth, other than the
+// top-level directory, is not a directory.
+func (fs *mapFS) checkParent(op, pth string) error {
+	dir := path.Dir(path.Clean(pth))
+	if dir == "." || dir == "/" {
+		return nil
+	}
+	if _, exist := fs.files[dir]; exist {
+		return &os.PathError{Op: op, Path: pth, Err: syscall.ENOTDIR}
+	}
+	if !fs.isDir(dir) {
+		return &os.PathError{Op: op, Path: pth, Err: os.ErrNotExist}
+	}
+	return nil
+}
+
+func fileInfo(pth string, size int, link bool) os.FileInfo {
+	var mode os.FileMode
+	if link {
+		mode = os.ModeSymlink
+	}
+	return &info{name: path.Base(pth), size: size, mode: mode}
+}
+
+func dirInfo(pth string, link bool) os.FileInfo {
+	var mode os.FileMode
+	if link {
+		mode = os.ModeSymlink
+	}
+	return &info{name: path.Base(pth), dir: true, mode: mode}
+}
+
+// info implements os.FileInfo.
+type info struct {
+	name string
+	size int
+	mode os.FileMode
+	dir  bool
+}
+
+var _ os.FileInfo = (*info)(nil)
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return int64(i.size) }
+func (i *info) Mode() os.FileMode  { return i.mode }
+func (i *info) ModTime() time.Time { return time.Time{} }
+func (i *info) IsDir() bool        { return i.dir }
+func (i *info) Sys() interface{}   { return nil }
+
+type nopCloser struct {
+	io.ReadSeeker
+}
+
+func (c nopCloser) Close() error { return nil }
@@ -0,0 +1,240 @@
+package filesys
+
+import (
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+var FS = Map(
+	map[string][]byte{
+		"bar/baz/file3": []byte("file3 contents"),
+		"bar/file4":     []byte("file4 contents"),
+		"bar/link1":     []byte("foo/file2"),
+		"foo/file2":     []byte("file2 contents"),
+		"foo/link2":     []byte("bar/baz"),
+		"file1":         []byte("file1 contents"),
+	},
+	[]string{
+		"bar/link1",
+		"foo/link2",
+	},
+)
+
+func TestOpen(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"bar/baz/file3", "file3 contents"},
+		{"bar/link1", "foo/file2"},
+		{"foo/file2", "file2 contents"},
+		{"foo/link2", "bar/baz"},
+		{"file1", "file1 contents"},
+	}
+	for _, tt := range tests {
+		f, err := FS.Open(tt.path)
+		if err != nil {
+			t.Errorf("Open(%q) = %v", tt.path, err)
+			continue
+		}
+		b, _ := ioutil.ReadAll(f)
+		if string(b) != tt.want {
+			t.Errorf("want %s; got %s", tt.want, string(b))
+		}
+	}
+
+	if _, err := FS.Open("foo/bogus"); err != os.ErrNotExist {
+		t.Errorf("want os.ErrNotExist; got %v", err)
+	}
+}
+
+func TestLstat(t *testing.T) {
+	tests := []struct {
+		path string
+		want os.FileInfo
+	}{
+		{"file1", fileInfo("file1", len("file1 contents"), false)},
+		{"bar/link1", fileInfo("link1", len("foo/file2"), true)},
+		{"foo/link2", fileInfo("link2", len("bar/baz"), true)},
+	}
+	for _, tt := range tests {
+		i, err := FS.Lstat(tt.path)
+		if err != nil {
+			t.Errorf("Lstat(%q) = %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.want, i) {
+			t.Errorf("want %#v; got %#v", tt.want, i)
+		}
+	}
+
+	if _, err := FS.Lstat("foo/bogus"); err != os.ErrNotExist {
+		t.Errorf("want os.ErrNotExist; got %v", err)
+	}
+}
+
+func TestReadlink(t *testing.T) {
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"bar/link1", "foo/file2"},
+		{"foo/link2", "bar/baz"},
+	}
+	for _, tt := range tests {
+		got, err := FS.Readlink(tt.path)
+		if err != nil {
+			t.Errorf("Readlink(%q) = %v", tt.path, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("Readlink(%q) = %q; want %q", tt.path, got, tt.want)
+		}
+	}
+
+	_, err := FS.Readlink("foo/file2")
+	if _, ok := err.(*os.PathError); err == nil || !ok {
+		t.Errorf("want os.PathError; got %v", err)
+	}
+}
+
+func TestReaddirnames(t *testing.T) {
+	tests := []struct {
+		path string
+		want []string
+	}{
+		{"", []string{"bar", "file1", "foo"}},
+		{".", []string{"bar", "file1", "foo"}},
+		{"/", []string{"bar", "file1", "foo"}},
+		{"bar", []string{"baz", "file4", "link1"}},
+		{"bar/baz", []string{"file3"}},
+		{"./bar/baz/../baz/", []string{"file3"}},
+		{"foo", []string{"file2", "link2"}},
+	}
+	for _, tt := range tests {
+		got, err := FS.Readdirnames(tt.path)
+		if err != nil {
+			t.Errorf("Readdirnames(%q) = %v", tt.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(tt.want, got) {
+			t.Errorf("Readdirnames(%q) = %v; want %v", tt.path, got, tt.want)
+		}
+	}
+
+	if _, err := FS.Readdirnames("file1"); err != os.ErrNotExist {
+		t.Errorf("want os.ErrNotExist; got %v", err)
+	}
+	if _, err := FS.Readdirnames(".."); err != os.ErrNotExist {
+		t.Errorf("want os.ErrNotExist; got %v", err)
+	}
+}
+
+func TestMutableFileSystem(t *testing.T) {
+	dir, err := ioutil.TempDir("", "filesys")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for name, tc := range map[string]struct {
+		fs   MutableFileSystem
+		root string
+	}{
+		"Map": {Map(nil, nil).(MutableFileSystem), "root"},
+		"OS":  {OS().(MutableFileSystem), dir + "/root"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			fs, root := tc.fs, tc.root
+			write := func(pth, contents string) {
+				w, err := fs.Create(pth)
+				if err != nil {
+					t.Fatalf("Create(%q) = %v", pth, err)
+				}
+				_, _ = w.Write([]byte(contents))
+				if err := w.Close(); err != nil {
+					t.Fatalf("Close() = %v", err)
+				}
+			}
+			read := func(pth string) string {
+				f, err := fs.Open(pth)
+				if err != nil {
+					return err.Error()
+				}
+				defer f.Close()
+				b, _ := ioutil.ReadAll(f)
+				return string(b)
+			}
+			list := func(pth string) []string {
+				names, err := fs.Readdirnames(pth)
+				if err != nil {
+					t.Fatalf("Readdirnames(%q) = %v", pth, err)
+				}
+				return names
+			}
+
+			if err := fs.MkdirAll(root+"/a/empty", 0755); err != nil {
+				t.Fatalf("MkdirAll = %v", err)
+			}
+			if got := list(root + "/a/empty"); len(got) != 0 {
+				t.Errorf("empty directory lists %q", got)
+			}
+			if _, err := fs.Create(root + "/missing/file"); err == nil {
+				t.Errorf("Create in a missing directory succeeded")
+			}
+
+			write(root+"/a/file", "one")
+			if err := fs.Link(root+"/a/file", root+"/a/hard"); err != nil {
+				t.Fatalf("Link = %v", err)
+			}
+			write(root+"/a/file", "two")
+			if got := read(root + "/a/hard"); got != "two" {
+				t.Errorf("hard link reads %q after writing the file; want two", got)
+			}
+			if err := fs.Link(root+"/a/file", root+"/a/hard"); err == nil {
+				t.Errorf("Link over an existing file succeeded")
+			}
+
+			if err := fs.Symlink("file", root+"/a/sym"); err != nil {
+				t.Fatalf("Symlink = %v", err)
+			}
+			if target, err := fs.Readlink(root + "/a/sym"); err != nil || target != "file" {
+				t.Errorf("Readlink = %q, %v; want file", target, err)
+			}
+			if info, err := fs.Lstat(root + "/a/sym"); err != nil || info.Mode()&os.ModeSymlink == 0 {
+				t.Errorf("Lstat of symbolic link = %v, %v", info, err)
+			}
+
+			if err := fs.Remove(root + "/a"); err == nil {
+				t.Errorf("Remove of a non-empty directory succeeded")
+			}
+			if err := fs.Rename(root+"/a", root+"/b"); err != nil {
+				t.Fatalf("Rename of directory = %v", err)
+			}
+			if got, want := list(root+"/b"), []string{"empty", "file", "hard", "sym"}; !reflect.DeepEqual(got, want) {
+				t.Errorf("renamed directory lists %q; want %q", got, want)
+			}
+			write(root+"/b/new", "three")
+			if err := fs.Rename(root+"/b/new", root+"/b/file"); err != nil {
+				t.Fatalf("Rename of file = %v", err)
+			}
+			if got := read(root + "/b/file"); got != "three" {
+				t.Errorf("renamed file reads %q; want three", got)
+			}
+			if got := read(root + "/b/hard"); got != "two" {
+				t.Errorf("hard link to replaced file reads %q; want two", got)
+			}
+
+			for _, pth := range []string{"/b/empty", "/b/file", "/b/hard", "/b/sym", "/b"} {
+				if err := fs.Remove(root + pth); err != nil {
+					t.Errorf("Remove(%q) = %v", pth, err)
+				}
+			}
+			if _, err := fs.Lstat(root + "/b"); !os.IsNotExist(err) {
+				t.Errorf("Lstat of removed directory = %v; want not exist", err)
+			}
+		})
+	}
+}
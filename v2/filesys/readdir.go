@@ -0,0 +1,59 @@
+package filesys
+
+import (
+	"errors"
+	"io"
+	"os"
+)
+
+// DirReader is implemented by FileSystems that can list the entries of a
+// directory in batches, along with their types, as they are read, such as the
+// one returned by OS. Unlike Readdirnames, ReadDir does not hold the names of
+// every entry in memory at once, nor sort them.
+type DirReader interface {
+	// ReadDir calls fn with successive batches of the entries of the
+	// directory located at pth, in no particular order, until every entry
+	// has been listed or fn returns an error, which ReadDir then returns.
+	ReadDir(pth string, fn func(entries []os.DirEntry) error) error
+}
+
+// ErrNoReadDir is the cause of the errors returned by ReadDir for file
+// systems that cannot list directories in batches; Readdirnames may be used
+// instead.
+var ErrNoReadDir = errors.New("reading directories in batches is not supported")
+
+// ReadDir lists the directory located at pth in fs as DirReader.ReadDir
+// does. fn is not called if fs is not a DirReader.
+func ReadDir(fs FileSystem, pth string, fn func(entries []os.DirEntry) error) error {
+	if d, ok := fs.(DirReader); ok {
+		return d.ReadDir(pth, fn)
+	}
+	return &os.PathError{Op: "readdir", Path: pth, Err: ErrNoReadDir}
+}
+
+// dirBatchSize is the number of entries passed at once by the ReadDir method
+// of the FileSystem returned by OS.
+const dirBatchSize = 1024
+
+var _ DirReader = osFS{}
+
+func (osFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	f, err := os.Open(longPath(pth))
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	for {
+		entries, err := f.ReadDir(dirBatchSize)
+		if len(entries) > 0 {
+			if ferr := fn(entries); ferr != nil {
+				return ferr
+			}
+		}
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package filesys
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestOSReadDir(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	n := 2*dirBatchSize + 10
+	for i := 0; i < n; i++ {
+		if err := ioutil.WriteFile(filepath.Join(root, fmt.Sprint(i)), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.Mkdir(filepath.Join(root, "dir"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	seen := make(map[string]os.FileMode)
+	batches := 0
+	err = ReadDir(Archives(URLs(OS())), root, func(entries []os.DirEntry) error {
+		batches++
+		if len(entries) > dirBatchSize {
+			t.Errorf("batch of %d entries; want at most %d", len(entries), dirBatchSize)
+		}
+		for _, e := range entries {
+			seen[e.Name()] = e.Type()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("ReadDir() = %v", err)
+	}
+	if len(seen) != n+1 || batches < 3 {
+		t.Errorf("ReadDir() listed %d entries in %d batches; want %d in at least 3", len(seen), batches, n+1)
+	}
+	if seen["dir"] != os.ModeDir || seen["0"] != 0 {
+		t.Errorf("types = %v, %v; want %v, %v", seen["dir"], seen["0"], os.ModeDir, os.FileMode(0))
+	}
+
+	// Listing stops at the first error returned by fn.
+	stop := errors.New("stop")
+	batches = 0
+	err = OS().(DirReader).ReadDir(root, func(entries []os.DirEntry) error {
+		batches++
+		return stop
+	})
+	if err != stop || batches != 1 {
+		t.Errorf("ReadDir() = %v after %d batches; want %v after 1", err, batches, stop)
+	}
+}
+
+func TestReadDirUnsupported(t *testing.T) {
+	fs := Map(map[string][]byte{"dir/file": nil}, nil)
+	err := ReadDir(fs, "dir", func(entries []os.DirEntry) error {
+		t.Error("fn called")
+		return nil
+	})
+	if !errors.Is(err, ErrNoReadDir) {
+		t.Errorf("ReadDir() = %v; want %v", err, ErrNoReadDir)
+	}
+}
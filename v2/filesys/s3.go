@@ -0,0 +1,513 @@
+package filesys
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+func init() {
+	Register("s3", func(u *url.URL) (FileSystem, error) {
+		return S3(u.Host, S3ConfigFromEnv()), nil
+	})
+}
+
+// S3Config configures the FileSystem returned by S3.
+type S3Config struct {
+	Endpoint        string       // Base URL of the API; https://s3.<Region>.amazonaws.com if empty.
+	Region          string       // Region used to sign requests; us-east-1 if empty.
+	AccessKeyID     string       // Requests are not signed if empty.
+	SecretAccessKey string       // Secret for AccessKeyID.
+	SessionToken    string       // Temporary credentials, if any.
+	Client          *http.Client // http.DefaultClient if nil.
+}
+
+// S3ConfigFromEnv returns an S3Config read from the environment variables
+// used by the AWS command line tools: AWS_ENDPOINT_URL, AWS_REGION or
+// AWS_DEFAULT_REGION, AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY, and
+// AWS_SESSION_TOKEN.
+func S3ConfigFromEnv() S3Config {
+	cfg := S3Config{
+		Endpoint:        os.Getenv("AWS_ENDPOINT_URL"),
+		Region:          os.Getenv("AWS_REGION"),
+		AccessKeyID:     os.Getenv("AWS_ACCESS_KEY_ID"),
+		SecretAccessKey: os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		SessionToken:    os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if cfg.Region == "" {
+		cfg.Region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	return cfg
+}
+
+// ObjectInfo is returned by the Sys method of the os.FileInfo of an object
+// read from S3.
+type ObjectInfo struct {
+	Key  string
+	ETag string // Entity tag, without quotes. For objects uploaded in a single part without SSE-KMS, it is the MD5 checksum of the contents.
+}
+
+// S3 returns a FileSystem for the objects in bucket, read with the
+// ListObjectsV2 and GetObject operations of an S3-compatible API. Paths are
+// URLs of the form "s3://bucket/key"; keys are split on slashes into
+// directories, as the S3 console does. Objects are streamed as they are
+// read, and requests use path-style URLs, which S3-compatible services
+// generally support.
+func S3(bucket string, cfg S3Config) FileSystem {
+	if cfg.Region == "" {
+		cfg.Region = "us-east-1"
+	}
+	if cfg.Endpoint == "" {
+		cfg.Endpoint = "https://s3." + cfg.Region + ".amazonaws.com"
+	}
+	if cfg.Client == nil {
+		cfg.Client = http.DefaultClient
+	}
+	return &s3FS{bucket: bucket, cfg: cfg}
+}
+
+type s3FS struct {
+	bucket string
+	cfg    S3Config
+	infos  infoCache // Keys to infos of listed objects and prefixes.
+}
+
+// key returns the key of the object or prefix located at pth, without
+// leading or trailing slashes.
+func (fs *s3FS) key(pth string) (string, error) {
+	root := "s3://" + fs.bucket
+	if pth != root && !strings.HasPrefix(pth, root+"/") {
+		return "", fmt.Errorf("not in bucket %s", fs.bucket)
+	}
+	return strings.Trim(pth[len(root):], "/"), nil
+}
+
+func (fs *s3FS) Open(pth string) (File, error) {
+	key, err := fs.key(pth)
+	if err == nil && key == "" {
+		err = syscall.EISDIR
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: err}
+	}
+	fs.infos.drop(key)
+	resp, err := fs.send("GET", key, nil, "")
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: err}
+	}
+	return &s3File{fs: fs, key: key, pth: pth, size: resp.ContentLength, body: resp.Body}, nil
+}
+
+func (fs *s3FS) Lstat(pth string) (os.FileInfo, error) {
+	key, err := fs.key(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: err}
+	}
+	if key == "" {
+		return &s3Info{name: fs.bucket, dir: true}, nil
+	}
+	if info, ok := fs.infos.take(key); ok {
+		return info, nil
+	}
+
+	// Not listed yet: a key is a directory if any key starts with it and a
+	// slash, and an object otherwise.
+	res, err := fs.list(key+"/", "", 1)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: err}
+	}
+	if len(res.Contents) > 0 || len(res.CommonPrefixes) > 0 {
+		return &s3Info{name: base(key), dir: true}, nil
+	}
+	res, err = fs.list(key, "", 1)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: err}
+	}
+	if len(res.Contents) == 0 || res.Contents[0].Key != key {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: os.ErrNotExist}
+	}
+	return res.Contents[0].info(), nil
+}
+
+func (fs *s3FS) Readlink(pth string) (string, error) {
+	return "", &os.PathError{Op: "readlink", Path: pth, Err: syscall.EINVAL}
+}
+
+func (fs *s3FS) Readdirnames(pth string) ([]string, error) {
+	key, err := fs.key(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: err}
+	}
+	prefix := key
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	seen := make(map[string]bool)
+	var names []string
+	var token string
+	for {
+		res, err := fs.list(prefix, token, 0)
+		if err != nil {
+			return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: err}
+		}
+		for _, p := range res.CommonPrefixes {
+			name := strings.TrimSuffix(p.Prefix[len(prefix):], "/")
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+				fs.infos.put(prefix+name, &s3Info{name: name, dir: true})
+			}
+		}
+		for _, obj := range res.Contents {
+			name := obj.Key[len(prefix):]
+			if name != "" && !seen[name] { // Skip directory markers.
+				seen[name] = true
+				names = append(names, name)
+				fs.infos.put(obj.Key, obj.info())
+			}
+		}
+		if !res.IsTruncated || res.NextContinuationToken == "" {
+			break
+		}
+		token = res.NextContinuationToken
+	}
+	if len(names) == 0 && key != "" {
+		return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: os.ErrNotExist}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// listResult is the response to a ListObjectsV2 request.
+type listResult struct {
+	IsTruncated           bool
+	NextContinuationToken string
+	Contents              []object
+	CommonPrefixes        []struct{ Prefix string }
+}
+
+type object struct {
+	Key          string
+	LastModified time.Time
+	ETag         string
+	Size         int64
+}
+
+func (obj object) info() os.FileInfo {
+	return &s3Info{
+		name:  base(obj.Key),
+		size:  obj.Size,
+		mtime: obj.LastModified,
+		obj:   &ObjectInfo{Key: obj.Key, ETag: strings.Trim(obj.ETag, `"`)},
+	}
+}
+
+// list lists the keys starting with prefix, grouped by the next slash. If
+// max is positive, at most max keys are listed.
+func (fs *s3FS) list(prefix, token string, max int) (*listResult, error) {
+	q := url.Values{"list-type": {"2"}, "delimiter": {"/"}}
+	if prefix != "" {
+		q.Set("prefix", prefix)
+	}
+	if token != "" {
+		q.Set("continuation-token", token)
+	}
+	if max > 0 {
+		q.Set("max-keys", fmt.Sprint(max))
+	}
+	b, err := fs.do("GET", "", q)
+	if err != nil {
+		return nil, err
+	}
+	res := new(listResult)
+	if err := xml.Unmarshal(b, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// s3Error is the body of an error response.
+type s3Error struct {
+	Code    string
+	Message string
+}
+
+// do sends a request for key in fs.bucket and returns the response body.
+func (fs *s3FS) do(method, key string, query url.Values) ([]byte, error) {
+	resp, err := fs.send(method, key, query, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	return ioutil.ReadAll(resp.Body)
+}
+
+// send sends a request for key in fs.bucket, with the Range header set to
+// rng unless it is empty, and returns the response if it succeeded, whose
+// body the caller must close.
+func (fs *s3FS) send(method, key string, query url.Values, rng string) (*http.Response, error) {
+	pth := "/" + fs.bucket + "/" + key
+	u, err := url.Parse(fs.cfg.Endpoint)
+	if err != nil {
+		return nil, err
+	}
+	base := strings.TrimSuffix(u.EscapedPath(), "/")
+	u.Path = strings.TrimSuffix(u.Path, "/") + pth
+	u.RawPath = base + uriEncode(pth, false)
+	u.RawQuery = canonicalQuery(query)
+
+	req, err := http.NewRequest(method, u.String(), nil)
+	if err != nil {
+		return nil, err
+	}
+	if rng != "" {
+		req.Header.Set("Range", rng)
+	}
+	fs.cfg.sign(req, time.Now().UTC())
+	resp, err := fs.cfg.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode/100 == 2 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	b, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+	var e s3Error
+	_ = xml.Unmarshal(b, &e)
+	switch {
+	case resp.StatusCode == http.StatusNotFound && (e.Code == "" || e.Code == "NoSuchKey"):
+		return nil, os.ErrNotExist
+	case resp.StatusCode == http.StatusForbidden && e.Code == "":
+		return nil, os.ErrPermission
+	case e.Code != "":
+		return nil, fmt.Errorf("%s: %s", e.Code, e.Message)
+	}
+	return nil, fmt.Errorf("unexpected response: %s", resp.Status)
+}
+
+// emptySHA256 is the hex-encoded SHA-256 checksum of an empty payload.
+const emptySHA256 = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// sign signs req with AWS Signature Version 4 at time now, signing the Host
+// header and every header already set in req. req must have an empty body.
+func (cfg *S3Config) sign(req *http.Request, now time.Time) {
+	if cfg.AccessKeyID == "" {
+		return
+	}
+	amzDate := now.Format("20060102T150405Z")
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", emptySHA256)
+	if cfg.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", cfg.SessionToken)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for name, values := range req.Header {
+		headers[strings.ToLower(name)] = strings.TrimSpace(strings.Join(values, ","))
+	}
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, name := range names {
+		canonicalHeaders.WriteString(name + ":" + headers[name] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		req.URL.EscapedPath(),
+		req.URL.RawQuery,
+		canonicalHeaders.String(),
+		signedHeaders,
+		emptySHA256,
+	}, "\n")
+	scope := now.Format("20060102") + "/" + cfg.Region + "/s3/aws4_request"
+	stringToSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hexSHA256(canonicalRequest)
+
+	key := []byte("AWS4" + cfg.SecretAccessKey)
+	for _, s := range []string{now.Format("20060102"), cfg.Region, "s3", "aws4_request"} {
+		key = hmacSHA256(key, s)
+	}
+	signature := hex.EncodeToString(hmacSHA256(key, stringToSign))
+	req.Header.Set("Authorization", "AWS4-HMAC-SHA256 Credential="+cfg.AccessKeyID+"/"+scope+
+		", SignedHeaders="+signedHeaders+", Signature="+signature)
+}
+
+func hmacSHA256(key []byte, s string) []byte {
+	h := hmac.New(sha256.New, key)
+	h.Write([]byte(s))
+	return h.Sum(nil)
+}
+
+func hexSHA256(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalQuery encodes q sorted by key, as Signature Version 4 requires.
+func canonicalQuery(q url.Values) string {
+	keys := make([]string, 0, len(q))
+	for k := range q {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	var parts []string
+	for _, k := range keys {
+		for _, v := range q[k] {
+			parts = append(parts, uriEncode(k, true)+"="+uriEncode(v, true))
+		}
+	}
+	return strings.Join(parts, "&")
+}
+
+// uriEncode percent-encodes every byte of s other than unreserved characters
+// and, unless encodeSlash is true, slashes.
+func uriEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9',
+			c == '-', c == '.', c == '_', c == '~', c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
+
+// base returns the last element of key.
+func base(key string) string {
+	return key[strings.LastIndex(key, "/")+1:]
+}
+
+// s3Info implements os.FileInfo for objects and prefixes.
+type s3Info struct {
+	name  string
+	size  int64
+	mtime time.Time
+	dir   bool
+	obj   *ObjectInfo
+}
+
+func (i *s3Info) Name() string       { return i.name }
+func (i *s3Info) Size() int64        { return i.size }
+func (i *s3Info) ModTime() time.Time { return i.mtime }
+func (i *s3Info) IsDir() bool        { return i.dir }
+
+func (i *s3Info) Sys() interface{} {
+	if i.obj == nil {
+		return nil
+	}
+	return i.obj
+}
+
+func (i *s3Info) Mode() os.FileMode {
+	if i.dir {
+		return os.ModeDir | 0555
+	}
+	return 0444
+}
+
+// s3File is an object opened by an s3FS, streamed from the body of a
+// GetObject response. Seeking closes the body; the next read requests the
+// rest of the object from the new offset. Close may be called concurrently
+// with Read, to give up on a read that hangs.
+type s3File struct {
+	fs   *s3FS
+	key  string
+	pth  string
+	size int64 // -1 if unknown.
+
+	mu     sync.Mutex
+	off    int64
+	body   io.ReadCloser // Body of the response for the object from off, if requested.
+	closed bool
+}
+
+func (f *s3File) Read(p []byte) (int, error) {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return 0, &os.PathError{Op: "read", Path: f.pth, Err: os.ErrClosed}
+	}
+	if f.body == nil {
+		if f.size >= 0 && f.off >= f.size {
+			f.mu.Unlock()
+			return 0, io.EOF
+		}
+		resp, err := f.fs.send("GET", f.key, nil, fmt.Sprintf("bytes=%d-", f.off))
+		if err != nil {
+			f.mu.Unlock()
+			return 0, &os.PathError{Op: "read", Path: f.pth, Err: err}
+		}
+		f.body = resp.Body
+	}
+	body := f.body
+	f.mu.Unlock()
+
+	n, err := body.Read(p)
+	f.mu.Lock()
+	f.off += int64(n)
+	f.mu.Unlock()
+	return n, err
+}
+
+func (f *s3File) Seek(offset int64, whence int) (int64, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		if f.size < 0 {
+			return f.off, syscall.EINVAL
+		}
+		offset += f.size
+	default:
+		return f.off, syscall.EINVAL
+	}
+	if offset < 0 {
+		return f.off, syscall.EINVAL
+	}
+	if offset != f.off && f.body != nil {
+		_ = f.body.Close()
+		f.body = nil
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *s3File) Close() error {
+	f.mu.Lock()
+	body := f.body
+	f.body, f.closed = nil, true
+	f.mu.Unlock()
+	if body == nil {
+		return nil
+	}
+	return body.Close()
+}
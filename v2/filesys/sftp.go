@@ -0,0 +1,695 @@
+package filesys
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"os/exec"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+func init() {
+	Register("sftp", func(u *url.URL) (FileSystem, error) {
+		return SFTP(u, SFTPConfig{}), nil
+	})
+}
+
+// SFTPConfig configures the FileSystem returned by SFTP.
+type SFTPConfig struct {
+	// Conns is the greatest number of SFTP sessions opened at once, so that
+	// concurrent operations are not serialized on a single SSH channel.
+	// Sessions are opened as needed; if Conns is 0, at most 4 are opened.
+	Conns int
+
+	// Dial, if not nil, is called to open each SFTP session. Otherwise,
+	// sessions are opened by running "ssh -s [-p port] -- [user@]host sftp",
+	// so that the user's SSH configuration, keys, and agent are used.
+	Dial func() (io.ReadWriteCloser, error)
+}
+
+// SFTP returns a FileSystem for the files on the server identified by the
+// user and host of u, read over SFTP (protocol version 3). Paths are URLs of
+// the form "sftp://user@host/path/to/file", where the path is absolute.
+func SFTP(u *url.URL, cfg SFTPConfig) FileSystem {
+	if cfg.Conns <= 0 {
+		cfg.Conns = 4
+	}
+	root := &url.URL{Scheme: "sftp", User: u.User, Host: u.Host}
+	if cfg.Dial == nil {
+		cfg.Dial = func() (io.ReadWriteCloser, error) { return dialSSH(root) }
+	}
+	return &sftpFS{
+		prefix: root.String(),
+		dial:   cfg.Dial,
+		slots:  make([]sftpSlot, cfg.Conns),
+	}
+}
+
+type sftpFS struct {
+	prefix string // URL of the server.
+	dial   func() (io.ReadWriteCloser, error)
+	next   uint32     // Index of the next slot to use, modulo len(slots).
+	slots  []sftpSlot // Pool of sessions.
+	infos  infoCache  // Remote paths to infos read from directories.
+}
+
+// sftpSlot holds a session in the pool of an sftpFS.
+type sftpSlot struct {
+	mu   sync.Mutex
+	conn *sftpConn
+}
+
+// conn returns a session from the pool, opening it if necessary. Sessions
+// are used in turn.
+func (fs *sftpFS) conn() (*sftpConn, error) {
+	s := &fs.slots[int(atomic.AddUint32(&fs.next, 1))%len(fs.slots)]
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.conn != nil && s.conn.broken() == nil {
+		return s.conn, nil
+	}
+	rwc, err := fs.dial()
+	if err != nil {
+		return nil, err
+	}
+	if s.conn, err = newSFTPConn(rwc); err != nil {
+		_ = rwc.Close()
+		s.conn = nil
+		return nil, fmt.Errorf("starting sftp session: %v", err)
+	}
+	return s.conn, nil
+}
+
+// remote returns the path on the server of the file located at pth.
+func (fs *sftpFS) remote(pth string) (string, error) {
+	if pth != fs.prefix && !strings.HasPrefix(pth, fs.prefix+"/") {
+		return "", fmt.Errorf("not on %s", fs.prefix)
+	}
+	return path.Clean("/" + pth[len(fs.prefix):]), nil
+}
+
+func (fs *sftpFS) Open(pth string) (File, error) {
+	f, err := fs.open(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: "open", Path: pth, Err: err}
+	}
+	return f, nil
+}
+
+func (fs *sftpFS) open(pth string) (File, error) {
+	rpath, err := fs.remote(pth)
+	if err != nil {
+		return nil, err
+	}
+	fs.infos.drop(rpath)
+	c, err := fs.conn()
+	if err != nil {
+		return nil, err
+	}
+	var b sftpBuffer
+	b.string(rpath)
+	b.uint32(sftpReadFlag)
+	b.uint32(0) // No attributes.
+	handle, err := c.handle(sftpOpen, b)
+	if err != nil {
+		return nil, err
+	}
+	return &sftpFile{c: c, handle: handle}, nil
+}
+
+func (fs *sftpFS) Lstat(pth string) (os.FileInfo, error) {
+	rpath, err := fs.remote(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: err}
+	}
+	if info, ok := fs.infos.take(rpath); ok {
+		return info, nil
+	}
+
+	c, err := fs.conn()
+	var info os.FileInfo
+	if err == nil {
+		var b sftpBuffer
+		b.string(rpath)
+		info, err = c.attrs(sftpLstat, b, path.Base(rpath))
+	}
+	if err != nil {
+		return nil, &os.PathError{Op: "lstat", Path: pth, Err: err}
+	}
+	return info, nil
+}
+
+func (fs *sftpFS) Readlink(pth string) (string, error) {
+	rpath, err := fs.remote(pth)
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: pth, Err: err}
+	}
+	c, err := fs.conn()
+	var names []sftpEntry
+	if err == nil {
+		var b sftpBuffer
+		b.string(rpath)
+		names, err = c.names(sftpReadlink, b)
+	}
+	if err == nil && len(names) != 1 {
+		err = errors.New("unexpected response to readlink")
+	}
+	if err != nil {
+		return "", &os.PathError{Op: "readlink", Path: pth, Err: err}
+	}
+	target := names[0].name
+	if !path.IsAbs(target) {
+		target = path.Join(path.Dir(rpath), target)
+	}
+	return fs.prefix + path.Clean(target), nil
+}
+
+func (fs *sftpFS) Readdirnames(pth string) ([]string, error) {
+	names, err := fs.readdirnames(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: "readdirnames", Path: pth, Err: err}
+	}
+	return names, nil
+}
+
+func (fs *sftpFS) readdirnames(pth string) ([]string, error) {
+	rpath, err := fs.remote(pth)
+	if err != nil {
+		return nil, err
+	}
+	c, err := fs.conn()
+	if err != nil {
+		return nil, err
+	}
+	var b sftpBuffer
+	b.string(rpath)
+	handle, err := c.handle(sftpOpendir, b)
+	if err != nil {
+		return nil, err
+	}
+	defer c.close(handle)
+
+	var names []string
+	for {
+		var b sftpBuffer
+		b.string(handle)
+		entries, err := c.names(sftpReaddir, b)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			if e.name == "." || e.name == ".." {
+				continue
+			}
+			names = append(names, e.name)
+			if e.info != nil {
+				fs.infos.put(path.Join(rpath, e.name), e.info)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// dialSSH opens an SFTP session on the server identified by u by running
+// ssh.
+func dialSSH(u *url.URL) (io.ReadWriteCloser, error) {
+	args, err := sshArgs(u)
+	if err != nil {
+		return nil, err
+	}
+	cmd := exec.Command("ssh", args...)
+	cmd.Stderr = os.Stderr
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	r, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &cmdConn{ReadCloser: r, WriteCloser: w, cmd: cmd}, nil
+}
+
+// sshArgs returns the arguments to ssh that open an SFTP session on the
+// server identified by u. A user, host, or port beginning with "-" is
+// refused, lest ssh take it for an option.
+func sshArgs(u *url.URL) ([]string, error) {
+	args := []string{"-s", "-o", "BatchMode=yes"}
+	host, port := u.Hostname(), u.Port()
+	var user string
+	if u.User != nil {
+		user = u.User.Username()
+	}
+	for _, s := range []string{user, host, port} {
+		if strings.HasPrefix(s, "-") {
+			return nil, fmt.Errorf("invalid ssh destination %q", s)
+		}
+	}
+	if port != "" {
+		args = append(args, "-p", port)
+	}
+	if user != "" {
+		host = user + "@" + host
+	}
+	return append(args, "--", host, "sftp"), nil
+}
+
+// cmdConn is an io.ReadWriteCloser for the standard output and input of a
+// running command.
+type cmdConn struct {
+	io.ReadCloser
+	io.WriteCloser
+	cmd *exec.Cmd
+}
+
+func (c *cmdConn) Close() error {
+	_ = c.WriteCloser.Close()
+	_ = c.cmd.Process.Kill()
+	return c.cmd.Wait()
+}
+
+// SFTP packet types and constants from draft-ietf-secsh-filexfer-02.
+const (
+	sftpInit     = 1
+	sftpVersion  = 2
+	sftpOpen     = 3
+	sftpClose    = 4
+	sftpRead     = 5
+	sftpLstat    = 7
+	sftpFstat    = 8
+	sftpOpendir  = 11
+	sftpReaddir  = 12
+	sftpReadlink = 19
+	sftpStatus   = 101
+	sftpHandle   = 102
+	sftpData     = 103
+	sftpName     = 104
+	sftpAttrs    = 105
+
+	sftpReadFlag = 1
+
+	sftpOK          = 0
+	sftpEOF         = 1
+	sftpNoSuchFile  = 2
+	sftpPermDenied  = 3
+	sftpMaxReadSize = 32 << 10
+
+	sftpAttrSize        = 0x1
+	sftpAttrUIDGID      = 0x2
+	sftpAttrPermissions = 0x4
+	sftpAttrACModTime   = 0x8
+	sftpAttrExtended    = 0x80000000
+)
+
+// sftpBuffer builds the payload of a request.
+type sftpBuffer []byte
+
+func (b *sftpBuffer) uint32(v uint32) {
+	*b = append(*b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+func (b *sftpBuffer) uint64(v uint64) {
+	b.uint32(uint32(v >> 32))
+	b.uint32(uint32(v))
+}
+
+func (b *sftpBuffer) string(s string) {
+	b.uint32(uint32(len(s)))
+	*b = append(*b, s...)
+}
+
+// sftpReader parses the payload of a response, recording the first error.
+type sftpReader struct {
+	b   []byte
+	err error
+}
+
+var errSFTPShort = errors.New("short sftp packet")
+
+func (r *sftpReader) uint32() uint32 {
+	if len(r.b) < 4 {
+		r.err, r.b = errSFTPShort, nil
+		return 0
+	}
+	v := binary.BigEndian.Uint32(r.b)
+	r.b = r.b[4:]
+	return v
+}
+
+func (r *sftpReader) uint64() uint64 {
+	return uint64(r.uint32())<<32 | uint64(r.uint32())
+}
+
+func (r *sftpReader) string() string {
+	n := r.uint32()
+	if uint32(len(r.b)) < n {
+		r.err, r.b = errSFTPShort, nil
+		return ""
+	}
+	s := string(r.b[:n])
+	r.b = r.b[n:]
+	return s
+}
+
+// attrs parses file attributes into an os.FileInfo for a file named name.
+// It returns nil if the attributes do not include the file's mode.
+func (r *sftpReader) attrs(name string) os.FileInfo {
+	info := &sftpInfo{name: name}
+	flags := r.uint32()
+	if flags&sftpAttrSize != 0 {
+		info.size = int64(r.uint64())
+	}
+	if flags&sftpAttrUIDGID != 0 {
+		r.uint32()
+		r.uint32()
+	}
+	if flags&sftpAttrPermissions != 0 {
+		info.mode = unixMode(r.uint32())
+	}
+	if flags&sftpAttrACModTime != 0 {
+		r.uint32()
+		info.mtime = time.Unix(int64(r.uint32()), 0)
+	}
+	if flags&sftpAttrExtended != 0 {
+		for n := r.uint32(); n > 0 && r.err == nil; n-- {
+			r.string()
+			r.string()
+		}
+	}
+	if flags&sftpAttrPermissions == 0 {
+		return nil
+	}
+	return info
+}
+
+// unixMode converts the mode bits of a Unix file to an os.FileMode.
+func unixMode(m uint32) os.FileMode {
+	mode := os.FileMode(m & 0777)
+	switch m & 0170000 {
+	case 0040000:
+		mode |= os.ModeDir
+	case 0120000:
+		mode |= os.ModeSymlink
+	case 0010000:
+		mode |= os.ModeNamedPipe
+	case 0140000:
+		mode |= os.ModeSocket
+	case 0020000:
+		mode |= os.ModeDevice | os.ModeCharDevice
+	case 0060000:
+		mode |= os.ModeDevice
+	}
+	return mode
+}
+
+// sftpInfo implements os.FileInfo for files read over SFTP.
+type sftpInfo struct {
+	name  string
+	size  int64
+	mode  os.FileMode
+	mtime time.Time
+}
+
+func (i *sftpInfo) Name() string       { return i.name }
+func (i *sftpInfo) Size() int64        { return i.size }
+func (i *sftpInfo) Mode() os.FileMode  { return i.mode }
+func (i *sftpInfo) ModTime() time.Time { return i.mtime }
+func (i *sftpInfo) IsDir() bool        { return i.mode.IsDir() }
+func (i *sftpInfo) Sys() interface{}   { return nil }
+
+// sftpConn is an SFTP session. Requests may be sent concurrently; responses
+// are matched to them by request ID.
+type sftpConn struct {
+	rwc io.ReadWriteCloser
+	wmu sync.Mutex // Serialize writes.
+
+	mu      sync.Mutex
+	id      uint32
+	pending map[uint32]chan sftpPacket
+	err     error // Error that ended the session, if any.
+}
+
+type sftpPacket struct {
+	typ  byte
+	data []byte
+}
+
+func newSFTPConn(rwc io.ReadWriteCloser) (*sftpConn, error) {
+	c := &sftpConn{rwc: rwc, pending: make(map[uint32]chan sftpPacket)}
+	var b sftpBuffer
+	b.uint32(3)
+	if err := c.write(sftpInit, b); err != nil {
+		return nil, err
+	}
+	p, err := c.read()
+	if err != nil {
+		return nil, err
+	}
+	if p.typ != sftpVersion {
+		return nil, fmt.Errorf("unexpected sftp packet type %d", p.typ)
+	}
+	go c.readLoop()
+	return c, nil
+}
+
+func (c *sftpConn) write(typ byte, payload []byte) error {
+	c.wmu.Lock()
+	defer c.wmu.Unlock()
+
+	b := make([]byte, 5, 5+len(payload))
+	binary.BigEndian.PutUint32(b, uint32(1+len(payload)))
+	b[4] = typ
+	_, err := c.rwc.Write(append(b, payload...))
+	return err
+}
+
+func (c *sftpConn) read() (sftpPacket, error) {
+	var hdr [5]byte
+	if _, err := io.ReadFull(c.rwc, hdr[:]); err != nil {
+		return sftpPacket{}, err
+	}
+	n := binary.BigEndian.Uint32(hdr[:4])
+	if n < 1 || n > 1<<24 {
+		return sftpPacket{}, fmt.Errorf("bad sftp packet length %d", n)
+	}
+	data := make([]byte, n-1)
+	if _, err := io.ReadFull(c.rwc, data); err != nil {
+		return sftpPacket{}, err
+	}
+	return sftpPacket{typ: hdr[4], data: data}, nil
+}
+
+// readLoop dispatches responses to pending requests until the session ends.
+func (c *sftpConn) readLoop() {
+	for {
+		p, err := c.read()
+		if err == nil && len(p.data) < 4 {
+			err = errSFTPShort
+		}
+		if err != nil {
+			c.mu.Lock()
+			c.err = fmt.Errorf("sftp session ended: %v", err)
+			for id, ch := range c.pending {
+				close(ch)
+				delete(c.pending, id)
+			}
+			c.mu.Unlock()
+			_ = c.rwc.Close()
+			return
+		}
+		id := binary.BigEndian.Uint32(p.data)
+		p.data = p.data[4:]
+		c.mu.Lock()
+		ch, ok := c.pending[id]
+		delete(c.pending, id)
+		c.mu.Unlock()
+		if ok {
+			ch <- p
+		}
+	}
+}
+
+// broken returns the error that ended the session, if any.
+func (c *sftpConn) broken() error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.err
+}
+
+// request sends a request of type typ and returns the response. A status
+// response other than OK is returned as an error; EOF is returned as io.EOF.
+func (c *sftpConn) request(typ byte, payload []byte) (sftpPacket, error) {
+	ch := make(chan sftpPacket, 1)
+	c.mu.Lock()
+	if c.err != nil {
+		c.mu.Unlock()
+		return sftpPacket{}, c.err
+	}
+	c.id++
+	id := c.id
+	c.pending[id] = ch
+	c.mu.Unlock()
+
+	b := make(sftpBuffer, 0, 4+len(payload))
+	b.uint32(id)
+	if err := c.write(typ, append(b, payload...)); err != nil {
+		c.mu.Lock()
+		delete(c.pending, id)
+		c.mu.Unlock()
+		return sftpPacket{}, err
+	}
+	p, ok := <-ch
+	if !ok {
+		return sftpPacket{}, c.broken()
+	}
+	if p.typ == sftpStatus {
+		r := &sftpReader{b: p.data}
+		code, msg := r.uint32(), r.string()
+		switch code {
+		case sftpOK:
+		case sftpEOF:
+			return p, io.EOF
+		case sftpNoSuchFile:
+			return p, os.ErrNotExist
+		case sftpPermDenied:
+			return p, os.ErrPermission
+		default:
+			if msg == "" {
+				msg = fmt.Sprintf("sftp status %d", code)
+			}
+			return p, errors.New(msg)
+		}
+	}
+	return p, nil
+}
+
+// expect sends a request and returns the payload of a response of type
+// want.
+func (c *sftpConn) expect(typ byte, payload []byte, want byte) (*sftpReader, error) {
+	p, err := c.request(typ, payload)
+	if err != nil {
+		return nil, err
+	}
+	if p.typ != want {
+		return nil, fmt.Errorf("unexpected sftp packet type %d", p.typ)
+	}
+	return &sftpReader{b: p.data}, nil
+}
+
+func (c *sftpConn) handle(typ byte, payload []byte) (string, error) {
+	r, err := c.expect(typ, payload, sftpHandle)
+	if err != nil {
+		return "", err
+	}
+	h := r.string()
+	return h, r.err
+}
+
+func (c *sftpConn) attrs(typ byte, payload []byte, name string) (os.FileInfo, error) {
+	r, err := c.expect(typ, payload, sftpAttrs)
+	if err != nil {
+		return nil, err
+	}
+	info := r.attrs(name)
+	if info == nil && r.err == nil {
+		r.err = errors.New("sftp server did not report file mode")
+	}
+	return info, r.err
+}
+
+type sftpEntry struct {
+	name string
+	info os.FileInfo
+}
+
+func (c *sftpConn) names(typ byte, payload []byte) ([]sftpEntry, error) {
+	r, err := c.expect(typ, payload, sftpName)
+	if err != nil {
+		return nil, err
+	}
+	n := r.uint32()
+	names := make([]sftpEntry, 0, n)
+	for ; n > 0 && r.err == nil; n-- {
+		name := r.string()
+		r.string() // Long name, as printed by ls -l.
+		names = append(names, sftpEntry{name: name, info: r.attrs(name)})
+	}
+	return names, r.err
+}
+
+func (c *sftpConn) close(handle string) error {
+	var b sftpBuffer
+	b.string(handle)
+	_, err := c.request(sftpClose, b)
+	return err
+}
+
+// sftpFile is an open file read over SFTP.
+type sftpFile struct {
+	c      *sftpConn
+	handle string
+	off    int64
+}
+
+func (f *sftpFile) Read(p []byte) (int, error) {
+	if len(p) > sftpMaxReadSize {
+		p = p[:sftpMaxReadSize]
+	}
+	var b sftpBuffer
+	b.string(f.handle)
+	b.uint64(uint64(f.off))
+	b.uint32(uint32(len(p)))
+	r, err := f.c.expect(sftpRead, b, sftpData)
+	if err != nil {
+		return 0, err
+	}
+	data := r.string()
+	if r.err != nil {
+		return 0, r.err
+	}
+	n := copy(p, data)
+	f.off += int64(n)
+	return n, nil
+}
+
+func (f *sftpFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.off
+	case io.SeekEnd:
+		var b sftpBuffer
+		b.string(f.handle)
+		info, err := f.c.attrs(sftpFstat, b, "")
+		if err != nil {
+			return f.off, err
+		}
+		offset += info.Size()
+	default:
+		return f.off, syscall.EINVAL
+	}
+	if offset < 0 {
+		return f.off, syscall.EINVAL
+	}
+	f.off = offset
+	return offset, nil
+}
+
+func (f *sftpFile) Close() error { return f.c.close(f.handle) }
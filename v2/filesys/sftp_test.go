@@ -0,0 +1,271 @@
+package filesys
+
+import (
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/url"
+	"os"
+	"path"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"testing"
+)
+
+// serveSFTP serves the SFTP requests used by sftpFS on conn for the files in
+// fs, which are located at the remote paths without their leading slash.
+func serveSFTP(conn net.Conn, fs FileSystem) {
+	defer conn.Close()
+	handles := make(map[string]interface{}) // File or []string.
+	dirs := make(map[string]string)         // Paths of the directories open, by handle.
+	next := 0
+	reply := func(typ byte, id uint32, payload sftpBuffer) {
+		var b sftpBuffer
+		b.uint32(uint32(5 + len(payload)))
+		b = append(b, typ)
+		b.uint32(id)
+		_, _ = conn.Write(append(b, payload...))
+	}
+	status := func(id uint32, err error) {
+		var b sftpBuffer
+		switch {
+		case err == nil:
+			b.uint32(sftpOK)
+		case err == io.EOF:
+			b.uint32(sftpEOF)
+		case os.IsNotExist(err):
+			b.uint32(sftpNoSuchFile)
+		default:
+			b.uint32(4)
+		}
+		b.string("")
+		b.string("")
+		reply(sftpStatus, id, b)
+	}
+	attrs := func(b *sftpBuffer, info os.FileInfo) {
+		b.uint32(sftpAttrSize | sftpAttrPermissions)
+		b.uint64(uint64(info.Size()))
+		mode := uint32(0100644)
+		if info.IsDir() {
+			mode = 040755
+		} else if info.Mode()&os.ModeSymlink != 0 {
+			mode = 0120777
+		}
+		b.uint32(mode)
+	}
+
+	for {
+		var hdr [5]byte
+		if _, err := io.ReadFull(conn, hdr[:]); err != nil {
+			return
+		}
+		data := make([]byte, binary.BigEndian.Uint32(hdr[:])-1)
+		if _, err := io.ReadFull(conn, data); err != nil {
+			return
+		}
+		r := &sftpReader{b: data}
+		if hdr[4] == sftpInit {
+			var b sftpBuffer
+			b.uint32(uint32(1 + 4))
+			b = append(b, sftpVersion)
+			b.uint32(3)
+			_, _ = conn.Write(b)
+			continue
+		}
+		id := r.uint32()
+		switch hdr[4] {
+		case sftpLstat:
+			info, err := fs.Lstat(r.string()[1:])
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			var b sftpBuffer
+			attrs(&b, info)
+			reply(sftpAttrs, id, b)
+		case sftpOpen, sftpOpendir:
+			pth := r.string()[1:]
+			var h interface{}
+			var err error
+			if hdr[4] == sftpOpen {
+				h, err = fs.Open(pth)
+			} else if names, derr := fs.Readdirnames(pth); derr == nil {
+				h, err = append([]string{".", ".."}, names...), nil
+			} else {
+				err = derr
+			}
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			next++
+			handle := string(rune('a' + next))
+			handles[handle] = h
+			if hdr[4] == sftpOpendir {
+				dirs[handle] = pth
+			}
+			var b sftpBuffer
+			b.string(handle)
+			reply(sftpHandle, id, b)
+		case sftpReaddir:
+			handle := r.string()
+			names, _ := handles[handle].([]string)
+			if len(names) == 0 {
+				status(id, io.EOF)
+				continue
+			}
+			var b sftpBuffer
+			b.uint32(uint32(len(names)))
+			for _, name := range names {
+				b.string(name)
+				b.string("")
+				if info, err := fs.Lstat(path.Join(dirs[handle], name)); err == nil && name != "." && name != ".." {
+					attrs(&b, info)
+				} else {
+					b.uint32(0) // No attributes.
+				}
+			}
+			handles[handle] = []string(nil)
+			reply(sftpName, id, b)
+		case sftpRead:
+			f, _ := handles[r.string()].(File)
+			off, n := r.uint64(), r.uint32()
+			buf := make([]byte, n)
+			_, _ = f.Seek(int64(off), io.SeekStart)
+			m, err := f.Read(buf)
+			if m == 0 {
+				status(id, err)
+				continue
+			}
+			var b sftpBuffer
+			b.string(string(buf[:m]))
+			reply(sftpData, id, b)
+		case sftpClose:
+			handle := r.string()
+			delete(handles, handle)
+			delete(dirs, handle)
+			status(id, nil)
+		case sftpReadlink:
+			target, err := fs.Readlink(r.string()[1:])
+			if err != nil {
+				status(id, err)
+				continue
+			}
+			var b sftpBuffer
+			b.uint32(1)
+			b.string(target)
+			b.string("")
+			b.uint32(0)
+			reply(sftpName, id, b)
+		default:
+			status(id, os.ErrInvalid)
+		}
+	}
+}
+
+func TestSFTP(t *testing.T) {
+	var dials int32
+	u, _ := url.Parse("sftp://user@host/")
+	fs := SFTP(u, SFTPConfig{Conns: 2, Dial: func() (io.ReadWriteCloser, error) {
+		atomic.AddInt32(&dials, 1)
+		client, server := net.Pipe()
+		go serveSFTP(server, FS)
+		return client, nil
+	}})
+
+	names, err := fs.Readdirnames("sftp://user@host/bar")
+	if want := []string{"baz", "file4", "link1"}; err != nil || !reflect.DeepEqual(names, want) {
+		t.Errorf("Readdirnames() = %v, %v; want %v", names, err, want)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			f, err := fs.Open("sftp://user@host/bar/baz/file3")
+			if err != nil {
+				t.Errorf("Open() = %v", err)
+				return
+			}
+			defer f.Close()
+			if b, _ := ioutil.ReadAll(f); string(b) != "file3 contents" {
+				t.Errorf("Open() read %q; want %q", b, "file3 contents")
+			}
+		}()
+	}
+	wg.Wait()
+	if n := atomic.LoadInt32(&dials); n != 2 {
+		t.Errorf("dialed %d sessions; want 2", n)
+	}
+
+	info, err := fs.Lstat("sftp://user@host/bar/link1")
+	if err != nil || info.Mode()&os.ModeSymlink == 0 || info.Name() != "link1" {
+		t.Errorf("Lstat() = %+v, %v; want symbolic link", info, err)
+	}
+	info, err = fs.Lstat("sftp://user@host/bar/baz")
+	if err != nil || !info.IsDir() {
+		t.Errorf("Lstat() = %+v, %v; want directory", info, err)
+	}
+	if _, err := fs.Lstat("sftp://user@host/bogus"); !os.IsNotExist(err) {
+		t.Errorf("Lstat(bogus) = %v; want not exist", err)
+	}
+	if target, err := fs.Readlink("sftp://user@host/bar/link1"); err != nil ||
+		target != "sftp://user@host"+path.Join("/bar", "foo/file2") {
+		t.Errorf("Readlink() = %q, %v", target, err)
+	}
+}
+
+func TestSFTPListedInfos(t *testing.T) {
+	m := Map(map[string][]byte{"dir/a": []byte("a")}, nil)
+	u, _ := url.Parse("sftp://user@host/")
+	fs := SFTP(u, SFTPConfig{Dial: func() (io.ReadWriteCloser, error) {
+		client, server := net.Pipe()
+		go serveSFTP(server, m)
+		return client, nil
+	}})
+
+	if _, err := fs.Readdirnames("sftp://user@host/dir"); err != nil {
+		t.Fatal(err)
+	}
+	w, _ := m.(MutableFileSystem).Create("dir/a")
+	_, _ = w.Write([]byte("longer"))
+	_ = w.Close()
+
+	// The info listed is used once; the file is stat'ed again from then on.
+	for _, want := range []int64{1, 6} {
+		if info, err := fs.Lstat("sftp://user@host/dir/a"); err != nil || info.Size() != want {
+			t.Errorf("Lstat() = %+v, %v; want %d bytes", info, err, want)
+		}
+	}
+	if n := len(fs.(*sftpFS).infos.infos); n != 0 {
+		t.Errorf("%d infos cached once stat'ed; want 0", n)
+	}
+}
+
+func TestSSHArgs(t *testing.T) {
+	for _, tc := range []struct {
+		url  string
+		want []string // nil if refused.
+	}{
+		{"sftp://h/", []string{"-s", "-o", "BatchMode=yes", "--", "h", "sftp"}},
+		{"sftp://u@h:2222/", []string{"-s", "-o", "BatchMode=yes", "-p", "2222", "--", "u@h", "sftp"}},
+		{"sftp://-oProxyCommand=sh@h/", nil},
+		{"sftp://-oProxyCommand=sh/", nil},
+	} {
+		u, err := url.Parse(tc.url)
+		if err != nil {
+			t.Fatal(err)
+		}
+		args, err := sshArgs(u)
+		if tc.want == nil {
+			if err == nil {
+				t.Errorf("sshArgs(%s) = %q; want an error", tc.url, args)
+			}
+		} else if err != nil || !reflect.DeepEqual(args, tc.want) {
+			t.Errorf("sshArgs(%s) = %q, %v; want %q", tc.url, args, err, tc.want)
+		}
+	}
+}
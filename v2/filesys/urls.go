@@ -0,0 +1,168 @@
+package filesys
+
+import (
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+)
+
+// Opener returns a FileSystem for the paths under the location described by
+// u, which has a scheme and host and no path. The returned FileSystem is
+// passed whole URLs, such as "s3://bucket/prefix/key", as paths.
+type Opener func(u *url.URL) (FileSystem, error)
+
+var (
+	openersMu sync.Mutex
+	openers   = make(map[string]Opener)
+)
+
+// Register makes the FileSystems returned by open available to URLs for
+// paths that are URLs with the given scheme. It panics if scheme is already
+// registered.
+func Register(scheme string, open Opener) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	if _, ok := openers[scheme]; ok {
+		panic("filesys: Register called twice for scheme " + scheme)
+	}
+	openers[scheme] = open
+}
+
+// IsURL reports whether pth is a URL with a registered scheme, such as
+// "s3://bucket/prefix".
+func IsURL(pth string) bool {
+	_, ok := opener(scheme(pth))
+	return ok
+}
+
+// JoinURL joins the URL dir and name with a slash. Unlike path.Join, it does
+// not collapse the slashes following the scheme.
+func JoinURL(dir, name string) string {
+	return strings.TrimSuffix(dir, "/") + "/" + name
+}
+
+func scheme(pth string) string {
+	if i := strings.Index(pth, "://"); i > 0 {
+		return pth[:i]
+	}
+	return ""
+}
+
+func opener(scheme string) (Opener, bool) {
+	openersMu.Lock()
+	defer openersMu.Unlock()
+
+	open, ok := openers[scheme]
+	return open, ok
+}
+
+// URLs returns a FileSystem that passes paths that are URLs with a registered
+// scheme to a FileSystem opened for their scheme and host, and all other
+// paths to fs. Each such FileSystem is opened once, when it is first needed.
+func URLs(fs FileSystem) FileSystem {
+	return &urlFS{fs: fs, m: make(map[string]*remote)}
+}
+
+type urlFS struct {
+	fs FileSystem
+	mu sync.Mutex
+	m  map[string]*remote // Scheme, user, and host to opened FileSystems.
+}
+
+// remote is a FileSystem opened for a scheme and host.
+type remote struct {
+	once sync.Once
+	fs   FileSystem
+	err  error
+}
+
+// resolve returns the FileSystem for pth.
+func (fs *urlFS) resolve(op, pth string) (FileSystem, error) {
+	open, ok := opener(scheme(pth))
+	if !ok {
+		return fs.fs, nil
+	}
+	u, err := url.Parse(pth)
+	if err != nil {
+		return nil, &os.PathError{Op: op, Path: pth, Err: err}
+	}
+	root := &url.URL{Scheme: u.Scheme, User: u.User, Host: u.Host}
+	key := root.String()
+
+	fs.mu.Lock()
+	r, ok := fs.m[key]
+	if !ok {
+		r = new(remote)
+		fs.m[key] = r
+	}
+	fs.mu.Unlock()
+
+	r.once.Do(func() {
+		if r.fs, r.err = open(root); r.err != nil {
+			r.err = fmt.Errorf("%s: %v", key, r.err)
+		}
+	})
+	if r.err != nil {
+		return nil, &os.PathError{Op: op, Path: pth, Err: r.err}
+	}
+	return r.fs, nil
+}
+
+func (fs *urlFS) Open(pth string) (File, error) {
+	rfs, err := fs.resolve("open", pth)
+	if err != nil {
+		return nil, err
+	}
+	return rfs.Open(pth)
+}
+
+func (fs *urlFS) Lstat(pth string) (os.FileInfo, error) {
+	rfs, err := fs.resolve("lstat", pth)
+	if err != nil {
+		return nil, err
+	}
+	return rfs.Lstat(pth)
+}
+
+func (fs *urlFS) Readlink(pth string) (string, error) {
+	rfs, err := fs.resolve("readlink", pth)
+	if err != nil {
+		return "", err
+	}
+	return rfs.Readlink(pth)
+}
+
+func (fs *urlFS) Readdirnames(pth string) ([]string, error) {
+	rfs, err := fs.resolve("readdirnames", pth)
+	if err != nil {
+		return nil, err
+	}
+	return rfs.Readdirnames(pth)
+}
+
+func (fs *urlFS) ReadDir(pth string, fn func(entries []os.DirEntry) error) error {
+	rfs, err := fs.resolve("readdir", pth)
+	if err != nil {
+		return err
+	}
+	return ReadDir(rfs, pth, fn)
+}
+
+func (fs *urlFS) Getxattr(pth, name string) ([]byte, error) {
+	rfs, err := fs.resolve("getxattr", pth)
+	if err != nil {
+		return nil, err
+	}
+	return GetXattr(rfs, pth, name)
+}
+
+func (fs *urlFS) Setxattr(pth, name string, value []byte) error {
+	rfs, err := fs.resolve("setxattr", pth)
+	if err != nil {
+		return err
+	}
+	return SetXattr(rfs, pth, name, value)
+}
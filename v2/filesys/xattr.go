@@ -0,0 +1,35 @@
+package filesys
+
+import (
+	"errors"
+	"os"
+)
+
+// Xattrs is implemented by FileSystems that support extended attributes, such
+// as the one returned by OS on Linux.
+type Xattrs interface {
+	Getxattr(path, name string) ([]byte, error)
+	Setxattr(path, name string, value []byte) error
+}
+
+// ErrNoXattrs is the cause of the errors returned by GetXattr and SetXattr for
+// file systems that do not support extended attributes.
+var ErrNoXattrs = errors.New("extended attributes are not supported")
+
+// GetXattr returns the value of the extended attribute name of the file
+// located at pth in fs, following symbolic links.
+func GetXattr(fs FileSystem, pth, name string) ([]byte, error) {
+	if x, ok := fs.(Xattrs); ok {
+		return x.Getxattr(pth, name)
+	}
+	return nil, &os.PathError{Op: "getxattr", Path: pth, Err: ErrNoXattrs}
+}
+
+// SetXattr sets the extended attribute name of the file located at pth in fs
+// to value, following symbolic links.
+func SetXattr(fs FileSystem, pth, name string, value []byte) error {
+	if x, ok := fs.(Xattrs); ok {
+		return x.Setxattr(pth, name, value)
+	}
+	return &os.PathError{Op: "setxattr", Path: pth, Err: ErrNoXattrs}
+}
@@ -0,0 +1,33 @@
+package filesys
+
+import (
+	"os"
+	"syscall"
+)
+
+var _ Xattrs = osFS{}
+
+func (osFS) Getxattr(pth, name string) ([]byte, error) {
+	buf := make([]byte, 128)
+	for {
+		n, err := syscall.Getxattr(pth, name, buf)
+		if err == syscall.ERANGE {
+			// The value grew: query its size and try again.
+			if n, err = syscall.Getxattr(pth, name, nil); err == nil {
+				buf = make([]byte, n)
+				continue
+			}
+		}
+		if err != nil {
+			return nil, &os.PathError{Op: "getxattr", Path: pth, Err: err}
+		}
+		return buf[:n], nil
+	}
+}
+
+func (osFS) Setxattr(pth, name string, value []byte) error {
+	if err := syscall.Setxattr(pth, name, value, 0); err != nil {
+		return &os.PathError{Op: "setxattr", Path: pth, Err: err}
+	}
+	return nil
+}
@@ -0,0 +1,859 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// filter is the interface implemented by types that evaluate a list of file
+// paths looking for files with duplicate checksums.
+//
+// Uniq, Dup, and Err will be closed once all files have been evaluated, if
+// Cancel is called, or once the files being evaluated when Drain is called
+// have been.
+type filter interface {
+	Start()
+	Uniq() <-chan Result // Outgoing files with previously-unseen checksums.
+	Dup() <-chan Result  // Outgoing files with previously-seen checksums.
+	Err() <-chan error   // Outgoing errors.
+	Sums() *Sums
+	Cancel()
+	Drain() // Stop evaluating new files, but finish and report those under way.
+}
+
+// listedFile is a file to be evaluated by a chanFilter.
+type listedFile struct {
+	path string
+	info os.FileInfo // As returned by lstat for path, if already stat'ed while listing it; else nil.
+	link string      // Path of the symbolic link followed to path while listing it, if any.
+}
+
+// listed returns the listedFile for the file listed at listedPath, which lstat
+// resolved to path and info.
+func listed(listedPath, path string, info os.FileInfo) listedFile {
+	file := listedFile{path: path, info: info}
+	if path != listedPath {
+		file.link = listedPath
+	}
+	return file
+}
+
+// linkTarget is a file found under the FollowSymlinks option, which is
+// evaluated once however many links lead to it.
+type linkTarget struct {
+	file  *File    // Once grouped into Sums.
+	links []string // Paths of the links found to lead to the file before then.
+}
+
+// chanFilter is an implementation of the filter interface for file paths read
+// from a channel. It coordinates a set of worker goroutines that handle
+// channel I/O, file checksums, and errors.
+type chanFilter struct {
+	// Number of paths received from f.in and handled, accessed atomically:
+	// first so that it is 64-bit aligned on 32-bit platforms.
+	handled uint64
+
+	opts *Options
+
+	sums      *Sums
+	bufs      *bufferPool
+	numProcs  int            // Number of worker goroutines to start.
+	busyProcs sync.WaitGroup // Coordinate active worker goroutines.
+
+	listed bool              // Whether f.in carries paths read from a directory.
+	sizes  map[int64]int     // Number of files of each size, if precounted; see precounted.
+	subset bool              // Whether sizes only holds the sizes sampled; see sampled.
+	in     <-chan listedFile // Incoming files.
+	uniq   chan Result
+	dup    chan Result
+	err    chan error
+	cancel *signal // Signal cancellation.
+	drain  *signal // Signal workers to return once done with the current file.
+
+	targetsMu sync.Mutex
+	targets   map[string]*linkTarget // Files found under FollowSymlinks, or listed by Filter, by pathKey, whether or not through links.
+
+	heldMu   sync.Mutex
+	held     map[Digest][]Result // Duplicates not yet reported under MinGroupSize, if above 2.
+	released map[Digest]bool     // Checksums shared by MinGroupSize files.
+
+	verifyMu sync.Mutex // Add files one at a time if the Matcher is a Verifier.
+}
+
+var _ filter = (*chanFilter)(nil)
+
+func newChanFilter(in <-chan listedFile, numProcs int, opts *Options) *chanFilter {
+	f := new(chanFilter)
+	f.opts = opts
+	f.sums = NewSums()
+	f.bufs = newBufferPool(opts.BufferConfig)
+	f.numProcs = numProcs
+	f.in = in
+	f.uniq = make(chan Result, f.numProcs)
+	f.dup = make(chan Result, f.numProcs)
+	f.err = make(chan error, f.numProcs) // So that workers emitting errors do not wait on each one to be received.
+	f.cancel = newSignal()
+	f.drain = newSignal()
+	if opts.followsLinks() {
+		f.targets = make(map[string]*linkTarget)
+	}
+	if opts.MinGroupSize > 2 {
+		f.held = make(map[Digest][]Result)
+		f.released = make(map[Digest]bool)
+	}
+	return f
+}
+
+func (f *chanFilter) Uniq() <-chan Result { return f.uniq }
+
+func (f *chanFilter) Dup() <-chan Result { return f.dup }
+
+func (f *chanFilter) Err() <-chan error { return f.err }
+
+func (f *chanFilter) Sums() *Sums { return f.sums }
+
+// Start launches worker goroutines and begins handling values received from
+// f.in. Not to be called more than once on the same instance.
+func (f *chanFilter) Start() {
+	f.busyProcs.Add(f.numProcs)
+	for i := 0; i < f.numProcs; i++ {
+		go f.worker()
+	}
+	go func() {
+		f.busyProcs.Wait()
+		close(f.uniq)
+		close(f.dup)
+		close(f.err)
+	}()
+}
+
+// Cancel signals worker goroutines to return the first time it is called.
+// Subsequent calls to Cancel have no effect.
+func (f *chanFilter) Cancel() {
+	f.cancel.Once()
+	f.busyProcs.Wait()
+}
+
+// Drain signals worker goroutines to return once done with the file they are
+// evaluating, if any, without receiving more paths.
+func (f *chanFilter) Drain() {
+	f.drain.Once()
+}
+
+func (f *chanFilter) worker() {
+	defer f.busyProcs.Done()
+	for {
+		select {
+		case <-f.drain.C():
+			return
+		default:
+		}
+		select {
+		case <-f.cancel.C():
+			return
+		case <-f.drain.C():
+			return
+		case file, ok := <-f.in:
+			if !ok { // f.in was closed: stop working.
+				return
+			}
+			f.handle(file)
+			atomic.AddUint64(&f.handled, 1)
+		}
+	}
+}
+
+// handle reads the file located at listed.path, computes and stores its
+// checksum, and sends its path on f.Uniq or f.Dup, depending on whether its
+// checksum has been previously seen. The file is only stat'ed if listed.info
+// is nil.
+func (f *chanFilter) handle(listed listedFile) {
+	if !f.opts.matches(listed.path) {
+		f.skipped(listed.path, "excluded")
+		return
+	}
+	f.opts.fileLimit.wait(1, f.cancel.C())
+	info, path, link := listed.info, listed.path, listed.link
+	if info == nil {
+		var err error
+		start := time.Now()
+		info, path, err = f.opts.lstat(path)
+		f.sums.timed(listingTime, time.Since(start))
+		if err != nil {
+			if f.listed && f.skipVanished(err) {
+				return
+			}
+			f.emitErr(err)
+			return
+		}
+		if path != listed.path {
+			link = listed.path
+		}
+	}
+	if info.IsDir() {
+		return
+	}
+	if isDirLink(info) { // Not followed: the directory is not evaluated.
+		f.skipped(path, "directory link")
+		return
+	}
+	if f.opts.skipsLink(info) {
+		f.skipped(path, "link out of root")
+		return
+	}
+	if isSpecial(info) && !f.opts.IncludeSpecial {
+		f.sums.special()
+		f.opts.logSkip(path, "special file")
+		return
+	}
+	if f.sizes != nil && f.sizes[info.Size()] < 2 {
+		if f.subset {
+			f.skipped(path, "unique size or not sampled")
+		} else {
+			f.skipped(path, "unique size")
+		}
+		return
+	}
+	if f.targets != nil && !f.claim(path, link) {
+		if link == "" {
+			f.skipped(path, "already evaluated")
+		} else {
+			f.skipped(path, "link target already evaluated")
+		}
+		return
+	}
+	if d := f.opts.SkipModifiedWithin; d > 0 && time.Since(info.ModTime()) < d {
+		f.skipped(path, "recently modified")
+		return
+	}
+	if !f.opts.budget.take(info.Size()) {
+		f.opts.logSkip(path, "budget exceeded")
+		return
+	}
+
+	if p := f.opts.Progress; p != nil {
+		p.enter(path)
+		defer p.leave(path)
+	}
+	var stages Stages
+	if f.opts.Stages != nil {
+		stages = *f.opts.Stages
+	}
+	r := Result{Path: path, Info: info, Link: link}
+	if err := process(stages.Stat, &r); err != nil {
+		f.skipOrEmitErr(err)
+		return
+	}
+
+	file := &File{Path: r.Path, Info: r.Info, link: r.Link}
+	if err := f.readWithin(file, &r); err != nil {
+		f.skipOrEmitErr(err)
+		return
+	}
+	if f.opts.DetectChanges {
+		if err := f.checkUnchanged(file); err != nil {
+			if !f.listed || !f.skipVanished(err) {
+				f.emitErr(err)
+			}
+			return
+		}
+	}
+	r.Digests = file.Digests
+	if err := process(stages.Hash, &r); err != nil {
+		f.skipOrEmitErr(err)
+		return
+	}
+
+	if f.opts.StrictMatch.enabled() && f.opts.Canonical == nil {
+		r.Sum = f.opts.StrictMatch.key(r.Sum, file.Info)
+	}
+	if f.opts.SameDirOnly && f.opts.Canonical == nil {
+		r.Sum = dirKey(r.Sum, file.Path)
+	}
+	var n int
+	if v, ok := f.opts.Matcher.(Verifier); ok {
+		var err error
+		if r.Sum, n, err = f.addVerified(v, r.Sum, file); err != nil {
+			f.skipOrEmitErr(err)
+			return
+		}
+	} else {
+		n = f.sums.add(r.Sum, file)
+	}
+	r.Dup = n > 1
+	if r.Dup && f.opts.CrossDirOnly && !f.opts.SameDirOnly && f.opts.Canonical == nil {
+		files, _ := f.sums.GetDigest(r.Sum)
+		r.Dup = spansDirs(files)
+	}
+	if f.targets != nil {
+		f.grouped(path, file)
+	}
+	if r.Chunks != nil {
+		f.sums.Chunks().Add(file, r.Chunks)
+	}
+	if f.opts.Canonical != nil {
+		r.Canonical = canonicalCopies(f.opts.Canonical, r.Sum, r.Path)
+		r.Dup = r.Dup || len(r.Canonical) > 0
+	}
+	if err := process(stages.Report, &r); err != nil {
+		f.skipOrEmitErr(err)
+		return
+	}
+	if m := f.opts.Metrics; m != nil {
+		m.FileHashed()
+		if r.Dup {
+			m.Dup()
+		}
+	}
+	if f.opts.Logger != nil {
+		f.opts.logDebug("evaluated", "path", r.Path, "sum", hex.EncodeToString([]byte(r.Sum)), "dup", r.Dup)
+	}
+	switch {
+	case r.Dup && f.held != nil && len(r.Canonical) == 0:
+		for _, r := range f.release(r, n) {
+			f.emitDup(r)
+		}
+	case r.Dup:
+		f.emitDup(r)
+	default:
+		f.emitUniq(r)
+	}
+}
+
+// release returns the duplicate r, with n files sharing its checksum, along
+// with the duplicates with the same checksum held back until then, once at
+// least MinGroupSize files share it; until then, r is held back in turn.
+func (f *chanFilter) release(r Result, n int) []Result {
+	f.heldMu.Lock()
+	defer f.heldMu.Unlock()
+
+	if n < f.opts.MinGroupSize && !f.released[r.Sum] {
+		f.held[r.Sum] = append(f.held[r.Sum], r)
+		return nil
+	}
+	// Duplicates evaluated concurrently may be released after a later one.
+	f.released[r.Sum] = true
+	rs := append(f.held[r.Sum], r)
+	delete(f.held, r.Sum)
+	return rs
+}
+
+// claim reports whether the file located at path, found through the link
+// located at link unless link is empty, is to be evaluated under the
+// FollowSymlinks option, or by Filter: only if it was not found before,
+// whether through a link or not, under the same pathKey. link is recorded in
+// the Links of the file regardless.
+func (f *chanFilter) claim(path, link string) bool {
+	key := f.opts.pathKey(path)
+	f.targetsMu.Lock()
+	defer f.targetsMu.Unlock()
+
+	t, found := f.targets[key]
+	if !found {
+		t = new(linkTarget)
+		f.targets[key] = t
+	}
+	if link != "" && t.file != nil {
+		f.sums.addLinks(t.file, link)
+	} else if link != "" {
+		t.links = append(t.links, link)
+	}
+	return !found
+}
+
+// grouped records that the file located at path, claimed by claim, has been
+// grouped into f.sums as file, along with the links to it found meanwhile.
+func (f *chanFilter) grouped(path string, file *File) {
+	f.targetsMu.Lock()
+	defer f.targetsMu.Unlock()
+
+	t := f.targets[f.opts.pathKey(path)]
+	t.file = file
+	f.sums.addLinks(file, t.links...)
+	t.links = nil
+}
+
+// open opens file for reading.
+func (f *chanFilter) open(file *File) (filesys.File, error) {
+	r, err := f.opts.FileSystem.Open(file.Path)
+	switch {
+	case err == nil:
+		return r, nil
+	case isSymlink(file.Info) && os.IsNotExist(err):
+		return nil, &BrokenLinkError{Path: file.Path}
+	case f.listed && f.skipVanished(err):
+		return nil, ErrSkip
+	}
+	return nil, newError("open", file.Path, err)
+}
+
+// readRetryDelay is the time waited before the first retry of a failed read;
+// it doubles with each subsequent retry of the same file.
+var readRetryDelay = 100 * time.Millisecond
+
+// read computes the checksum, and chunks if Options.ChunkMode is set, of file
+// and stores them in r, retrying up to Options.ReadRetries times if an I/O
+// error occurs. If Options.TimeReads is set, it also records how the file was
+// read in r. What it records in f.sums goes through g, which may be nil.
+func (f *chanFilter) read(file *File, r *Result, g *readGuard) (err error) {
+	stats := new(ReadStats)
+	start := time.Now()
+	delay := readRetryDelay
+	r.Sum, r.Chunks, err = f.sum(file, g)
+	for err != nil && stats.Retries < f.opts.ReadRetries && retryable(err) && !g.isAbandoned() {
+		select {
+		case <-f.cancel.C():
+			return err
+		case <-time.After(delay):
+		}
+		delay *= 2
+		stats.Retries++
+		r.Sum, r.Chunks, err = f.sum(file, g)
+	}
+	stats.Duration = time.Since(start)
+	g.do(func() { f.sums.timed(hashingTime, stats.Duration) })
+	if f.opts.TimeReads {
+		r.Read = stats
+	}
+	return err
+}
+
+// readWithin is like read, but gives up under Options.PerFileTimeout once
+// reading file takes longer, returning an *Error whose cause is
+// os.ErrDeadlineExceeded. The file being read is then closed, so that a read
+// that hangs, such as on an unresponsive network mount, fails and its
+// goroutine exits; whatever it would have recorded is discarded.
+func (f *chanFilter) readWithin(file *File, r *Result) error {
+	d := f.opts.PerFileTimeout
+	if d <= 0 {
+		return f.read(file, r, nil)
+	}
+	// The read works on copies that it may go on writing to once abandoned.
+	fc, rc := *file, *r
+	g := new(readGuard)
+	done := make(chan error, 1)
+	go func() { done <- f.read(&fc, &rc, g) }()
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		g.commit()
+		*file, *r = fc, rc
+		return err
+	case <-timer.C:
+		g.abandon()
+		f.opts.logDebug("read timed out", "path", file.Path, "timeout", d)
+		return &Error{Op: "read", Path: file.Path, Err: os.ErrDeadlineExceeded}
+	}
+}
+
+// readGuard is shared by readWithin with the read it may abandon. The read
+// defers what it would record in the Sums, or in the extended attributes of
+// the file, until readWithin commits it, and readWithin abandons it by
+// discarding those records and closing the file being read. A nil
+// *readGuard records everything at once and is never abandoned.
+type readGuard struct {
+	mu        sync.Mutex
+	abandoned bool
+	deferred  []func()
+	file      filesys.File // File being read, if any.
+}
+
+// do calls fn once g is committed, or at once if g is nil.
+func (g *readGuard) do(fn func()) {
+	if g == nil {
+		fn()
+		return
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if !g.abandoned {
+		g.deferred = append(g.deferred, fn)
+	}
+}
+
+// opened records that r is being read, so that it is closed if g is
+// abandoned. It returns false, having closed r, if g was already abandoned.
+func (g *readGuard) opened(r filesys.File) bool {
+	if g == nil {
+		return true
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	if g.abandoned {
+		_ = r.Close()
+		return false
+	}
+	g.file = r
+	return true
+}
+
+// close closes r, the file recorded by opened, unless abandoning g did.
+func (g *readGuard) close(r filesys.File) {
+	if g != nil {
+		g.mu.Lock()
+		owned := g.file != nil
+		g.file = nil
+		g.mu.Unlock()
+		if !owned {
+			return
+		}
+	}
+	_ = r.Close()
+}
+
+func (g *readGuard) isAbandoned() bool {
+	if g == nil {
+		return false
+	}
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	return g.abandoned
+}
+
+// commit calls the functions given to do, once the read is done.
+func (g *readGuard) commit() {
+	g.mu.Lock()
+	deferred := g.deferred
+	g.deferred = nil
+	g.mu.Unlock()
+	for _, fn := range deferred {
+		fn()
+	}
+}
+
+// abandon discards the functions given to do, and any to come, and closes
+// the file being read in the background, since closing it may hang too.
+func (g *readGuard) abandon() {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	g.abandoned = true
+	g.deferred = nil
+	if r := g.file; r != nil {
+		g.file = nil
+		go func() { _ = r.Close() }()
+	}
+}
+
+// checkUnchanged returns an *UnstableError if the size or modification time
+// of file, once read, differ from those of file.Info, or an *Error if it may
+// no longer be stat'ed.
+func (f *chanFilter) checkUnchanged(file *File) error {
+	info, err := f.opts.FileSystem.Lstat(file.Path)
+	if err != nil {
+		return newError("lstat", file.Path, err)
+	}
+	if info.Size() != file.Info.Size() || !info.ModTime().Equal(file.Info.ModTime()) {
+		return &UnstableError{Path: file.Path}
+	}
+	return nil
+}
+
+// retryable reports whether err is an I/O error that may not occur if the
+// operation is attempted again; errors indicating that a file does not exist
+// or may not be read are not.
+func retryable(err error) bool {
+	if _, ok := err.(*Error); !ok {
+		return false
+	}
+	return !errors.Is(err, os.ErrNotExist) && !errors.Is(err, os.ErrPermission)
+}
+
+// addVerified adds file to f.sums under sum, as confirmed by v, or under the
+// first of the further Digests of the groups sharing sum whose files v
+// confirms that file is alike to, or of a group of its own. It returns the
+// Digest under which file was added and the number of files under it.
+func (f *chanFilter) addVerified(v Verifier, sum Digest, file *File) (Digest, int, error) {
+	f.verifyMu.Lock()
+	defer f.verifyMu.Unlock()
+
+	for i := uint64(0); ; i++ {
+		key := sum
+		if i > 0 {
+			key = Digest(appendUint64([]byte(sum), i))
+		}
+		files, _ := f.sums.GetDigest(key)
+		if len(files) == 0 {
+			return key, f.sums.add(key, file), nil
+		}
+		alike, err := f.verify(v, file, files[0])
+		if err != nil {
+			return "", 0, err
+		}
+		if alike {
+			return key, f.sums.add(key, file), nil
+		}
+	}
+}
+
+// verify calls v.Verify for file and other, opening them as sum does for the
+// Matcher option.
+func (f *chanFilter) verify(v Verifier, file, other *File) (bool, error) {
+	var opened []filesys.File
+	var counted []*countingReader
+	alike, err := v.Verify(file, other, func(file *File) (io.Reader, error) {
+		r, err := f.open(file)
+		if err != nil {
+			return nil, err
+		}
+		c := &countingReader{r: f.limit(r)}
+		opened, counted = append(opened, r), append(counted, c)
+		return c, nil
+	})
+	for i, r := range opened {
+		_ = r.Close()
+		f.bytesRead(counted[i].n)
+	}
+	switch err.(type) {
+	case nil, *Error, *BrokenLinkError:
+	default:
+		if err != ErrSkip {
+			err = newError("read", file.Path, err)
+		}
+	}
+	return alike, err
+}
+
+// sum computes the checksum of file using the Matcher option, or the SHA1
+// checksum of its contents if Matcher is nil. If Matcher is nil, sum also
+// stores the digests listed in Options.Digests in file, computed as the
+// contents are read, and splits the contents into chunks if Options.ChunkMode
+// is set; otherwise, under Options.UseXattrCache, the checksum may be read
+// from, and is stored in, an extended attribute of the file. The file is
+// opened, and what sum records is recorded, through g; see readGuard.
+func (f *chanFilter) sum(file *File, g *readGuard) (Digest, []Chunk, error) {
+	if f.opts.Matcher != nil {
+		var r filesys.File
+		var c *countingReader
+		sum, err := f.opts.Matcher.Sum(file, func() (io.Reader, error) {
+			var err error
+			if r, err = f.open(file); err != nil {
+				return nil, err
+			}
+			if !g.opened(r) {
+				r = nil
+				return nil, ErrSkip
+			}
+			c = &countingReader{r: f.limit(r)}
+			return c, nil
+		})
+		if r != nil {
+			g.close(r)
+			g.do(func() { f.bytesRead(c.n) })
+		}
+		switch err.(type) {
+		case nil, *Error, *BrokenLinkError:
+		default:
+			if err != ErrSkip {
+				err = newError("read", file.Path, err)
+			}
+		}
+		return sum, nil, err
+	}
+
+	cache := f.opts.UseXattrCache && !f.opts.ChunkMode && len(f.opts.Digests) == 0 && f.opts.Algorithm == "" && file.Info.Mode().IsRegular()
+	if cache {
+		if sum, ok := f.cachedSum(file); ok {
+			g.do(func() { f.skipped(file.Path, "checksum cached") })
+			return sum, nil, nil
+		}
+	}
+
+	r, err := f.open(file)
+	if err != nil {
+		return "", nil, err
+	}
+	if !g.opened(r) {
+		return "", nil, ErrSkip
+	}
+	defer g.close(r)
+
+	buf := f.bufs.Get()
+	defer f.bufs.Put(buf)
+
+	c := &countingReader{r: f.limit(r)}
+	var src io.Reader = c
+	digests := newDigester(f.opts.Digests)
+	if digests != nil {
+		src = io.TeeReader(src, digests)
+	}
+	_, err = buf.ReadFrom(src)
+	g.do(func() { f.bytesRead(c.n) })
+	if err != nil {
+		return "", nil, newError("read", file.Path, err)
+	}
+	if digests != nil {
+		file.Digests = digests.sums()
+	}
+	var chunks []Chunk
+	if f.opts.ChunkMode {
+		chunks = chunk(buf.Bytes())
+	}
+	sum := contentSum(buf.Bytes(), f.opts.Algorithm)
+	if cache {
+		g.do(func() { f.cacheSum(file, sum) })
+	}
+	return sum, chunks, nil
+}
+
+// limit returns a reader of r that is limited by Options.MaxBytesPerSec.
+func (f *chanFilter) limit(r io.Reader) io.Reader {
+	if f.opts.byteLimit == nil {
+		return r
+	}
+	return &limitedReader{r: r, b: f.opts.byteLimit, cancel: f.cancel.C()}
+}
+
+// countingReader is an io.Reader that counts the bytes read from an
+// underlying io.Reader.
+type countingReader struct {
+	r io.Reader
+	n uint64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += uint64(n)
+	return n, err
+}
+
+// bytesRead records n bytes read in f.sums and under the Metrics option.
+func (f *chanFilter) bytesRead(n uint64) {
+	f.sums.read(n)
+	if f.opts.Metrics != nil {
+		f.opts.Metrics.BytesRead(n)
+	}
+}
+
+// skipVanished reports whether err indicates that a listed file no longer
+// exists and should be skipped, recording it in f.sums if so.
+func (f *chanFilter) skipVanished(err error) bool {
+	if f.opts.ReportVanished || !errors.Is(err, os.ErrNotExist) {
+		return false
+	}
+	f.sums.vanished()
+	path, _ := pathCause(err)
+	f.opts.logSkip(path, "vanished")
+	return true
+}
+
+// skipped records the file located at path, skipped for reason, in f.sums
+// and logs it.
+func (f *chanFilter) skipped(path, reason string) {
+	f.sums.skipped()
+	f.opts.logSkip(path, reason)
+}
+
+// skipOrEmitErr emits err unless it is ErrSkip.
+func (f *chanFilter) skipOrEmitErr(err error) {
+	if err != ErrSkip {
+		f.emitErr(err)
+	}
+}
+
+func (f *chanFilter) emitDup(r Result) {
+	select {
+	case <-f.cancel.C():
+	case f.dup <- r:
+	}
+}
+
+func (f *chanFilter) emitUniq(r Result) {
+	select {
+	case <-f.cancel.C():
+	case f.uniq <- r:
+	}
+}
+
+func (f *chanFilter) emitErr(err error) {
+	if f.opts.skipUnreadable(f.sums, err) {
+		return
+	}
+	f.opts.logError(err)
+	select {
+	case <-f.cancel.C():
+	case f.err <- err:
+	}
+}
+
+// dirFilter is an implementation of the filter interface for file paths read
+// from directories. It coordinates a dirReader and a chanFilter: it configures
+// the output of the former as the input of the latter and forwards errors
+// emitted by either on Err.
+type dirFilter struct {
+	r   *dirReader
+	f   *chanFilter
+	err <-chan error
+}
+
+var _ filter = (*dirFilter)(nil)
+
+// rotationalProcs is the greatest number of files read concurrently from
+// rotational storage, where concurrent reads cause the disk to seek back and
+// forth rather than improving throughput.
+const rotationalProcs = 2
+
+func newDirFilter(paths []string, opts *Options) *dirFilter {
+	numProcs := ratioMaxProcs(3, 4)
+	for _, path := range paths {
+		if info, err := opts.FileSystem.Lstat(path); err == nil && isRotational(info) && numProcs > rotationalProcs {
+			numProcs = rotationalProcs
+		}
+	}
+
+	d := new(dirFilter)
+	d.r = newDirReader(paths, opts.procs(ratioMaxProcs(1, 4)), opts)
+	d.f = newChanFilter(d.r.out, opts.procs(numProcs), opts)
+	d.f.listed = true
+	d.r.sums = d.f.sums
+	d.err = mergeErrors(d.f.cancel.C(), d.r.err, d.f.err)
+	return d
+}
+
+func (d *dirFilter) Uniq() <-chan Result { return d.f.Uniq() }
+
+func (d *dirFilter) Dup() <-chan Result { return d.f.Dup() }
+
+func (d *dirFilter) Err() <-chan error { return d.err }
+
+func (d *dirFilter) Sums() *Sums { return d.f.Sums() }
+
+// Start instructs the dirReader and chanFilter managed by d to start. Not to
+// be called more than once on the same instance.
+func (d *dirFilter) Start() {
+	d.r.Start()
+	d.f.Start()
+}
+
+// Drain interrupts the dirReader managed by d, and drains its chanFilter.
+func (d *dirFilter) Drain() {
+	d.f.Drain()
+	d.r.Cancel()
+}
+
+// Cancel interrupts the dirReader and chanFilter managed by d and waits for
+// both to return.
+func (d *dirFilter) Cancel() {
+	var wg sync.WaitGroup
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		d.r.Cancel()
+	}()
+	go func() {
+		defer wg.Done()
+		d.f.Cancel()
+	}()
+	wg.Wait()
+}
@@ -0,0 +1,3 @@
+module github.com/bdragon/dedup/v2
+
+go 1.16
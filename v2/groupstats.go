@@ -0,0 +1,241 @@
+package dedup
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// GroupStats breaks Stats down by file extension and by top-level directory.
+type GroupStats struct {
+	ByExt []CategoryStats // Keyed by lower-cased extension, such as ".jpg", or "".
+	ByDir []CategoryStats // Keyed by top-level directory.
+}
+
+// CategoryStats contains a summary of the files in one category.
+type CategoryStats struct {
+	Category string
+	Stats
+}
+
+// GroupStats reports the number of files, bytes, duplicate files, and
+// duplicate bytes examined, broken down by file extension and by top-level
+// directory: the first path component below the deepest directory containing
+// all files in s. Within each set of files sharing a checksum, the file with
+// the lexicographically least path is considered the original and the others
+// its duplicates. Categories are sorted by duplicate bytes in descending order,
+// then by name.
+func (s *Sums) GroupStats() GroupStats {
+	var all []string
+	byPath := make(map[string]*File)
+	dups := make(map[string]bool)
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		for i, path := range sortedPaths(files) {
+			all = append(all, path)
+			dups[path] = i > 0
+		}
+		for _, file := range files {
+			byPath[file.Path] = file
+		}
+		return true
+	})
+
+	root := commonDir(all)
+	ext := make(map[string]*Stats)
+	dir := make(map[string]*Stats)
+	for _, path := range all {
+		size := uint64(byPath[path].Info.Size())
+		for _, st := range []*Stats{
+			category(ext, strings.ToLower(filepath.Ext(path))),
+			category(dir, topDir(root, path)),
+		} {
+			st.NumFiles++
+			st.NumBytes += size
+			if dups[path] {
+				st.NumDupFiles++
+				st.NumDupBytes += size
+			}
+		}
+	}
+	return GroupStats{ByExt: sortedCategories(ext), ByDir: sortedCategories(dir)}
+}
+
+// RootStats summarizes the duplicates found within one of the roots of an
+// evaluation of several, such as a source and its backup, or across two of
+// them, as returned by Sums.RootStats.
+type RootStats struct {
+	Root  string // Root of the files considered the originals of the duplicates.
+	Other string // Root of the duplicates, which is Root for those within it.
+
+	NumDupFiles      uint64
+	NumDupBytes      uint64
+	ReclaimableBytes uint64 // The part of NumDupBytes that disposing of the duplicates would free; see Stats.ReclaimableBytes.
+}
+
+// Within reports whether r summarizes the duplicates within a single root.
+func (r RootStats) Within() bool {
+	return r.Root == r.Other
+}
+
+// RootStats breaks the duplicates in s down by the roots whose files they
+// duplicate and in which they were found, among roots, such as the paths
+// given to FilterPaths: within each set of files sharing a checksum, the file
+// found in the first of roots, with the lexicographically least path among
+// those, is considered the original and the others its duplicates, each
+// counted for the pair of its root and that of the original. Thus, with roots
+// {"src", "backup"}, the duplicates within src, within backup, and in backup
+// of files in src are reported, and the last show how much of backup
+// duplicates src. A summary is returned for every root, and for every pair
+// of roots in the order of roots, even if it counts no duplicates. Files
+// that lie within none of roots are counted under the root "" after them,
+// if any. Relative roots also match the absolute paths of the files within
+// them, as recorded under Options.AbsPaths.
+func (s *Sums) RootStats(roots []string) []RootStats {
+	clean, rootOf := rootMatcher(roots)
+	n := len(clean) + 1 // Including files within none of roots.
+	stats := make([][]RootStats, n)
+	for i := range stats {
+		stats[i] = make([]RootStats, n)
+	}
+	var outside bool
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		ranks := make(map[*File]int, len(files))
+		for _, file := range files {
+			ranks[file] = rootOf(file.Path)
+		}
+		sorted := append([]*File(nil), files...)
+		sort.SliceStable(sorted, func(i, j int) bool {
+			if ri, rj := ranks[sorted[i]], ranks[sorted[j]]; ri != rj {
+				return ri < rj
+			}
+			return sorted[i].Path < sorted[j].Path
+		})
+		orig := ranks[sorted[0]]
+		for i, file := range sorted[1:] {
+			st := &stats[orig][ranks[file]]
+			size := uint64(file.Info.Size())
+			st.NumDupFiles++
+			st.NumDupBytes += size
+			if linkedTo(sorted[:i+1], file) == nil {
+				st.ReclaimableBytes += size
+			}
+			outside = outside || ranks[file] == len(clean)
+		}
+		return true
+	})
+
+	if !outside {
+		n--
+	}
+	clean = append(clean, "")
+	var rs []RootStats
+	for i := 0; i < n; i++ {
+		for j := i; j < n; j++ {
+			st := stats[i][j]
+			st.Root, st.Other = clean[i], clean[j]
+			rs = append(rs, st)
+		}
+	}
+	return rs
+}
+
+func (c CategoryStats) String() string {
+	return c.Category + ": " + c.Stats.String()
+}
+
+func category(m map[string]*Stats, key string) *Stats {
+	st, ok := m[key]
+	if !ok {
+		st = new(Stats)
+		m[key] = st
+	}
+	return st
+}
+
+func sortedCategories(m map[string]*Stats) []CategoryStats {
+	cs := make([]CategoryStats, 0, len(m))
+	for key, st := range m {
+		cs = append(cs, CategoryStats{Category: key, Stats: *st})
+	}
+	sort.Slice(cs, func(i, j int) bool {
+		if cs[i].NumDupBytes != cs[j].NumDupBytes {
+			return cs[i].NumDupBytes > cs[j].NumDupBytes
+		}
+		return cs[i].Category < cs[j].Category
+	})
+	return cs
+}
+
+// commonDir returns the deepest directory containing every path in paths.
+func commonDir(paths []string) string {
+	if len(paths) == 0 {
+		return ""
+	}
+	dir := filepath.Dir(paths[0])
+	for _, path := range paths[1:] {
+		for !within(dir, path) {
+			parent := filepath.Dir(dir)
+			if parent == dir {
+				break
+			}
+			dir = parent
+		}
+	}
+	return dir
+}
+
+// rootMatcher returns roots cleaned, except those that are URLs, and a
+// function returning the index among them of the root that the file located
+// at path lies within, the longest if several do, or len(roots) if none.
+// Relative roots also match the absolute paths of the files within them.
+func rootMatcher(roots []string) (clean []string, rootOf func(path string) int) {
+	clean = make([]string, len(roots))
+	abs := make([]string, len(roots)) // Matched against absolute paths.
+	for i, root := range roots {
+		clean[i], abs[i] = root, root
+		if !filesys.IsURL(root) {
+			clean[i] = filepath.Clean(root)
+			if a, err := filepath.Abs(root); err == nil {
+				abs[i] = a
+			}
+		}
+	}
+	rootOf = func(path string) int {
+		match := clean
+		if filepath.IsAbs(path) {
+			match = abs
+		}
+		best := len(match)
+		for i, root := range match {
+			if (path == root || within(root, path)) && (best == len(match) || len(root) > len(match[best])) {
+				best = i
+			}
+		}
+		return best
+	}
+	return clean, rootOf
+}
+
+// within reports whether path is located below dir.
+func within(dir, path string) bool {
+	if dir == "." {
+		return !filepath.IsAbs(path)
+	}
+	return strings.HasPrefix(path, strings.TrimSuffix(dir, string(filepath.Separator))+string(filepath.Separator))
+}
+
+// topDir returns the directory containing path that is an immediate child of
+// root, or root itself if path is located directly in root.
+func topDir(root, path string) string {
+	rel, err := filepath.Rel(root, path)
+	if err != nil {
+		return filepath.Dir(path)
+	}
+	parts := strings.SplitN(rel, string(filepath.Separator), 2)
+	if len(parts) < 2 {
+		return root
+	}
+	return filepath.Join(root, parts[0])
+}
@@ -0,0 +1,92 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSumsGroupStats(t *testing.T) {
+	sums := NewSums()
+	add := func(key string, paths ...string) {
+		for _, path := range paths {
+			sums.AppendDigest(keySum[key], fakeFile(path, key))
+		}
+	}
+	add("aqua", "/x/a/1.jpg", "/x/b/1.JPG", "/x/b/2.jpg")
+	add("black", "/x/a/2.txt", "/x/3.txt")
+	add("blue", "/x/c/4")
+
+	got := sums.GroupStats()
+	aqua, black, blue := uint64(len("aqua")), uint64(len("black")), uint64(len("blue"))
+	wantExt := []CategoryStats{
+		{".jpg", Stats{NumFiles: 3, NumBytes: 3 * aqua, NumDupFiles: 2, NumDupBytes: 2 * aqua}},
+		{".txt", Stats{NumFiles: 2, NumBytes: 2 * black, NumDupFiles: 1, NumDupBytes: black}},
+		{"", Stats{NumFiles: 1, NumBytes: blue}},
+	}
+	wantDir := []CategoryStats{
+		{"/x/b", Stats{NumFiles: 2, NumBytes: 2 * aqua, NumDupFiles: 2, NumDupBytes: 2 * aqua}},
+		{"/x/a", Stats{NumFiles: 2, NumBytes: aqua + black, NumDupFiles: 1, NumDupBytes: black}},
+		{"/x", Stats{NumFiles: 1, NumBytes: black}},
+		{"/x/c", Stats{NumFiles: 1, NumBytes: blue}},
+	}
+	if !reflect.DeepEqual(got.ByExt, wantExt) {
+		t.Errorf("ByExt = %+v; want %+v", got.ByExt, wantExt)
+	}
+	if !reflect.DeepEqual(got.ByDir, wantDir) {
+		t.Errorf("ByDir = %+v; want %+v", got.ByDir, wantDir)
+	}
+}
+
+func TestCommonDir(t *testing.T) {
+	tests := []struct {
+		paths []string
+		want  string
+	}{
+		{nil, ""},
+		{[]string{"root/a"}, "root"},
+		{[]string{"root/foo/a", "root/qux/b"}, "root"},
+		{[]string{"root/foo/a", "rootx/b"}, "."},
+		{[]string{"/a/b/c", "/a/b/d/e"}, "/a/b"},
+		{[]string{"/a/b", "/c/d"}, "/"},
+	}
+	for _, tt := range tests {
+		if got := commonDir(tt.paths); got != tt.want {
+			t.Errorf("commonDir(%q) = %q; want %q", tt.paths, got, tt.want)
+		}
+	}
+}
+
+func TestSumsRootStats(t *testing.T) {
+	sums := NewSums()
+	add := func(key string, paths ...string) {
+		for _, path := range paths {
+			sums.AppendDigest(keySum[key], fakeFile(path, key))
+		}
+	}
+	add("aqua", "/backup/1", "/src/1", "/src/2")
+	add("black", "/backup/a/3", "/backup/b/3")
+	add("blue", "/src/4", "/other/4")
+	add("lime", "/src/5")
+
+	aqua, black, blue := uint64(len("aqua")), uint64(len("black")), uint64(len("blue"))
+	want := []RootStats{
+		{Root: "/src", Other: "/src", NumDupFiles: 1, NumDupBytes: aqua, ReclaimableBytes: aqua},
+		{Root: "/src", Other: "/backup", NumDupFiles: 1, NumDupBytes: aqua, ReclaimableBytes: aqua},
+		{Root: "/src", Other: "", NumDupFiles: 1, NumDupBytes: blue, ReclaimableBytes: blue},
+		{Root: "/backup", Other: "/backup", NumDupFiles: 1, NumDupBytes: black, ReclaimableBytes: black},
+		{Root: "/backup", Other: ""},
+		{Root: "", Other: ""},
+	}
+	if got := sums.RootStats([]string{"/src/", "/backup"}); !reflect.DeepEqual(got, want) {
+		t.Errorf("RootStats() = %+v; want %+v", got, want)
+	}
+	if !want[0].Within() || want[1].Within() {
+		t.Errorf("Within() = %v, %v; want true, false", want[0].Within(), want[1].Within())
+	}
+
+	// Without files outside the roots, no root "" is reported.
+	sums.RemoveSum(keySum["blue"])
+	if got := sums.RootStats([]string{"/src", "/backup"}); len(got) != 3 {
+		t.Errorf("RootStats() = %+v; want 3 summaries", got)
+	}
+}
@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"os"
+	"time"
+)
+
+// Version is the version of this package and of the dedup command, as
+// recorded in the headers of reports.
+const Version = "0.1.0"
+
+// Header describes the evaluation into a Sums, so that the reports written
+// from it under Options.ReportHeader say how they were made.
+type Header struct {
+	Version   string            `json:"version"`        // Version of dedup.
+	Host      string            `json:"host,omitempty"` // Hostname of the machine the evaluation ran on, if known.
+	Start     time.Time         `json:"start"`
+	End       time.Time         `json:"end"`
+	Seconds   float64           `json:"seconds"`           // Time from Start to End.
+	Algorithm string            `json:"algorithm"`         // Digest whose checksums were compared; see Options.Algorithm.
+	Options   map[string]string `json:"options"`           // Options set, by the keys of FromConfig.
+	Partial   bool              `json:"partial,omitempty"` // Whether the evaluation stopped early, as reported by Sums.Partial.
+}
+
+// newHeader returns the header of an evaluation under opts starting at
+// start.
+func newHeader(opts *Options, start time.Time) *Header {
+	h := &Header{Version: Version, Start: start, Algorithm: opts.Algorithm, Options: opts.settings()}
+	if h.Algorithm == "" {
+		h.Algorithm = "sha1"
+	}
+	h.Host, _ = os.Hostname()
+	return h
+}
+
+// Header returns the header describing the evaluation into s by Filter,
+// FilterDir, or FilterPaths, whose End is the time at which it finished. ok
+// will be false if s was not evaluated into, such as if it was read from an
+// index, or if the evaluation is under way.
+func (s *Sums) Header() (h Header, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.header == nil || s.header.End.IsZero() {
+		return Header{}, false
+	}
+	h = *s.header
+	h.Partial = s.partial
+	return h, true
+}
+
+// reportHeader returns the header that reports written from s begin with,
+// or nil if none.
+func (s *Sums) reportHeader() *Header {
+	if h, ok := s.Header(); ok && s.headed() {
+		return &h
+	}
+	return nil
+}
+
+func (s *Sums) headed() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.writeHeader
+}
+
+// started records the start of an evaluation into s under opts.
+func (s *Sums) started(opts *Options, start time.Time) {
+	h := newHeader(opts, start)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.header, s.writeHeader = h, opts.ReportHeader
+}
+
+// finished records the end of the evaluation into s.
+func (s *Sums) finished(end time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.header != nil {
+		s.header.End = end
+		s.header.Seconds = end.Sub(s.header.Start).Seconds()
+	}
+}
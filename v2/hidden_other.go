@@ -0,0 +1,13 @@
+//go:build !windows
+// +build !windows
+
+package dedup
+
+import "os"
+
+// hasHiddenAttr reports that files have no hidden attribute: only their
+// names make them hidden.
+func hasHiddenAttr(info os.FileInfo) bool { return false }
+
+// hiddenAttrs reports that files have no hidden attribute.
+const hiddenAttrs = false
@@ -0,0 +1,16 @@
+package dedup
+
+import (
+	"os"
+	"syscall"
+)
+
+// hasHiddenAttr reports whether the file described by info has the hidden
+// attribute set.
+func hasHiddenAttr(info os.FileInfo) bool {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_HIDDEN != 0
+}
+
+// hiddenAttrs reports that files may have the hidden attribute.
+const hiddenAttrs = true
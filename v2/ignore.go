@@ -0,0 +1,204 @@
+package dedup
+
+import (
+	"bufio"
+	"io"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// ignoreRule is a pattern read from an ignore file, in the syntax of
+// .gitignore files.
+type ignoreRule struct {
+	segments []string // Pattern split at slashes; "**" matches any number of segments.
+	negate   bool     // Pattern started with "!": re-include matching entries.
+	dirOnly  bool     // Pattern ended with "/": only match directories.
+	anchored bool     // Pattern contained a slash: match from the ignore file's directory.
+}
+
+// parseIgnore reads rules from r, one per line, in the syntax of .gitignore
+// files. Blank lines and lines starting with "#" are skipped.
+func parseIgnore(r io.Reader) ([]ignoreRule, error) {
+	var rules []ignoreRule
+	s := bufio.NewScanner(r)
+	for s.Scan() {
+		if rule, ok := parseIgnoreRule(s.Text()); ok {
+			rules = append(rules, rule)
+		}
+	}
+	return rules, s.Err()
+}
+
+func parseIgnoreRule(line string) (rule ignoreRule, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	// Trailing spaces are trimmed unless escaped.
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return rule, false
+	}
+	if line[0] == '!' {
+		rule.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		rule.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	if line == "" {
+		return rule, false
+	}
+	rule.anchored = strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+	rule.segments = strings.Split(line, "/")
+	if len(rule.segments) > 1 && rule.segments[0] == "**" {
+		// "**/foo" matches foo at any depth, like an unanchored pattern.
+		rule.anchored = len(rule.segments) > 2 || rule.segments[1] == "**"
+		if !rule.anchored {
+			rule.segments = rule.segments[1:]
+		}
+	}
+	return rule, true
+}
+
+// match reports whether rule matches the entry whose path, relative to the
+// directory of the ignore file, consists of segments.
+func (rule ignoreRule) match(segments []string, isDir bool) bool {
+	if rule.dirOnly && !isDir {
+		return false
+	}
+	if !rule.anchored {
+		ok, _ := path.Match(rule.segments[0], segments[len(segments)-1])
+		return ok
+	}
+	return matchSegments(rule.segments, segments)
+}
+
+// matchSegments reports whether the path segments in name match those in
+// pattern, where "**" matches zero or more segments, or one or more at the end
+// of pattern.
+func matchSegments(pattern, name []string) bool {
+	if len(pattern) == 0 {
+		return len(name) == 0
+	}
+	if pattern[0] == "**" {
+		if len(pattern) == 1 {
+			return len(name) > 0
+		}
+		for i := 0; i <= len(name); i++ {
+			if matchSegments(pattern[1:], name[i:]) {
+				return true
+			}
+		}
+		return false
+	}
+	if len(name) == 0 {
+		return false
+	}
+	ok, _ := path.Match(pattern[0], name[0])
+	return ok && matchSegments(pattern[1:], name[1:])
+}
+
+// ignoreList holds the rules read from the ignore files in a directory, and
+// those that apply from its ancestors.
+type ignoreList struct {
+	dir    string
+	rules  []ignoreRule
+	parent *ignoreList
+}
+
+// ignored reports whether the entry located at pth is ignored by the rules in
+// l or its ancestors. Rules in deeper directories take precedence, as do later
+// rules in the same directory: the last rule that matches decides.
+func (l *ignoreList) ignored(pth string, isDir bool) bool {
+	for ; l != nil; l = l.parent {
+		rel := relSegments(l.dir, pth)
+		if rel == nil {
+			continue
+		}
+		for i := len(l.rules) - 1; i >= 0; i-- {
+			if l.rules[i].match(rel, isDir) {
+				return !l.rules[i].negate
+			}
+		}
+	}
+	return false
+}
+
+// relSegments returns the path segments of pth relative to dir, or nil if pth
+// does not lie below dir.
+func relSegments(dir, pth string) []string {
+	sep := string(filepath.Separator)
+	if filesys.IsURL(pth) {
+		sep = "/"
+	}
+	prefix := strings.TrimSuffix(dir, sep) + sep
+	if !strings.HasPrefix(pth, prefix) || len(pth) == len(prefix) {
+		return nil
+	}
+	return strings.Split(pth[len(prefix):], sep)
+}
+
+// ignoreFilesIn returns the names of the ignore files present in the
+// directory located at dir, in the order listed in Options.IgnoreFiles.
+func (r *dirReader) ignoreFilesIn(dir string) []string {
+	var files []string
+	for _, name := range r.opts.IgnoreFiles {
+		if _, err := r.opts.FileSystem.Lstat(join(dir, name)); err == nil {
+			files = append(files, name)
+		}
+	}
+	return files
+}
+
+// readIgnores returns the ignoreList for the directory located at dir, which
+// contains the ignore files named in files, given the list of its parent. It
+// returns parent if files is empty.
+func (r *dirReader) readIgnores(dir string, files []string, parent *ignoreList) *ignoreList {
+	if len(files) == 0 {
+		return parent
+	}
+	l := &ignoreList{dir: dir, parent: parent}
+	for _, name := range files {
+		pth := join(dir, name)
+		f, err := r.opts.FileSystem.Open(pth)
+		if err != nil {
+			r.emitErr(newError("open", pth, err))
+			continue
+		}
+		rules, err := parseIgnore(f)
+		_ = f.Close()
+		if err != nil {
+			r.emitErr(newError("read", pth, err))
+		}
+		l.rules = append(l.rules, rules...)
+	}
+	return l
+}
+
+// ignoresAbove returns the ignoreList of the parent of the directory located
+// at dir, which lies below one of r.roots, reading the ignore files in the
+// directories from that root down. It is used for directories restored by
+// resume, whose lists are not saved.
+func (r *dirReader) ignoresAbove(dir string) *ignoreList {
+	for _, root := range r.roots {
+		rel := relSegments(root, dir)
+		if rel == nil {
+			continue
+		}
+		var l *ignoreList
+		cur := root
+		for i := 0; i < len(rel); i++ {
+			l = r.readIgnores(cur, r.ignoreFilesIn(cur), l)
+			cur = join(cur, rel[i])
+		}
+		return l
+	}
+	return nil
+}
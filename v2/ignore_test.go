@@ -0,0 +1,86 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestIgnoreRules(t *testing.T) {
+	tests := []struct {
+		rules string
+		path  string // Relative to the directory of the rules.
+		isDir bool
+		want  bool
+	}{
+		{"*.log", "a.log", false, true},
+		{"*.log", "sub/a.log", false, true},
+		{"*.log", "a.txt", false, false},
+		{"# *.log", "a.log", false, false},
+		{"\\#a", "#a", false, true},
+		{"build/", "build", true, true},
+		{"build/", "build", false, false},
+		{"build/", "sub/build", true, true},
+		{"/build", "build", false, true},
+		{"/build", "sub/build", false, false},
+		{"doc/*.txt", "doc/a.txt", false, true},
+		{"doc/*.txt", "doc/sub/a.txt", false, false},
+		{"doc/*.txt", "sub/doc/a.txt", false, false},
+		{"**/cache", "a/b/cache", true, true},
+		{"**/doc/*.txt", "a/doc/b.txt", false, true},
+		{"a/**/b", "a/b", false, true},
+		{"a/**/b", "a/x/y/b", false, true},
+		{"a/**", "a", true, false},
+		{"a/**", "a/x/y", false, true},
+		{"*.log\n!keep.log", "keep.log", false, false},
+		{"!keep.log\n*.log", "keep.log", false, true},
+		{"trailing  ", "trailing", false, true},
+		{"\\!bang", "!bang", false, true},
+	}
+	for _, tt := range tests {
+		rules, err := parseIgnore(strings.NewReader(tt.rules))
+		if err != nil {
+			t.Fatal(err)
+		}
+		l := &ignoreList{dir: "root", rules: rules}
+		if got := l.ignored("root/"+tt.path, tt.isDir); got != tt.want {
+			t.Errorf("rules %q: ignored(%q, %v) = %v; want %v", tt.rules, tt.path, tt.isDir, got, tt.want)
+		}
+	}
+}
+
+func TestFilterDirIgnoreFiles(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/.gitignore":           []byte("*.o\nbuild/\n"),
+		"root/.dedupignore":         []byte("!keep.o\n"),
+		"root/a.o":                  []byte("same"),
+		"root/keep.o":               []byte("same"),
+		"root/build/b":              []byte("same"),
+		"root/src/c":                []byte("same"),
+		"root/src/d.o":              []byte("same"),
+		"root/src/.gitignore":       []byte("c\n!d.o\n"),
+		"root/src/sub/c":            []byte("same"),
+		"root/src/sub/.dedupignore": nil,
+	}, nil)
+	opts := &Options{Recursive: true, IgnoreFiles: []string{".gitignore", ".dedupignore"}, FileSystem: fs}
+	sums, err := FilterDir("root", opts)
+	checkErrors(t, "", err, nil)
+	want := []string{dupString(sha1Sum([]byte("same")), "root/keep.o", "root/src/d.o")}
+	// The ignore files themselves are evaluated too.
+	if got := sums.Stats().NumFiles; got != 6 {
+		t.Errorf("Stats().NumFiles = %d; want 6", got)
+	}
+	checkSums(t, "", sums, want)
+
+	// The rules of the ancestors of a directory restored from a checkpoint
+	// are read again.
+	r := newDirReader([]string{"root"}, 1, setup(opts))
+	l := r.ignoresAbove("root/src/sub")
+	if l == nil || l.dir != "root/src" || l.parent == nil || l.parent.dir != "root" {
+		t.Fatalf("ignoresAbove() = %+v; want lists of root/src and root", l)
+	}
+	if !l.ignored("root/src/sub/c", false) || l.ignored("root/src/sub/d.o", false) {
+		t.Errorf("ignoresAbove() rules do not apply to root/src/sub")
+	}
+}
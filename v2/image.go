@@ -0,0 +1,138 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"image"
+	_ "image/gif"  // Register GIF decoder.
+	_ "image/jpeg" // Register JPEG decoder.
+	_ "image/png"  // Register PNG decoder.
+	"io"
+	"io/ioutil"
+	"math/bits"
+	"sync"
+)
+
+// ImageMatcher is a Matcher that computes a perceptual difference hash (dHash)
+// of each GIF, JPEG, or PNG image, so that visually identical images are
+// grouped together even if they are encoded differently. Files that cannot be
+// decoded as images are grouped by the SHA1 checksum of their contents.
+type ImageMatcher struct {
+	// Threshold is the greatest number of bits by which the hashes of two
+	// images may differ for the images to be considered identical. Each
+	// image is grouped with the first image evaluated whose hash is within
+	// Threshold bits of its own, so for Threshold > 0 the grouping of near
+	// matches may depend on the order in which files are evaluated.
+	Threshold int
+
+	mu     sync.Mutex
+	hashes []uint64        // Hashes of groups seen so far, in order.
+	seen   map[uint64]bool // Set of hashes.
+}
+
+var _ Matcher = (*ImageMatcher)(nil)
+
+// DefaultImageThreshold is a Threshold for ImageMatcher under which images
+// that were merely re-encoded or resized are still grouped together.
+const DefaultImageThreshold = 4
+
+// NewImageMatcher returns an *ImageMatcher with the specified threshold.
+func NewImageMatcher(threshold int) *ImageMatcher {
+	return &ImageMatcher{Threshold: threshold}
+}
+
+func (m *ImageMatcher) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	img, _, err := image.Decode(bytes.NewReader(b))
+	if err != nil {
+		sum := sha1.Sum(b)
+		return Digest(sum[:]), nil
+	}
+	var sum [8]byte
+	binary.BigEndian.PutUint64(sum[:], m.group(dHash(img)))
+	return Digest(sum[:]), nil
+}
+
+// group returns the hash of the group to which an image with hash h belongs,
+// registering h as a new group if there is none.
+func (m *ImageMatcher) group(h uint64) uint64 {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.seen == nil {
+		m.seen = make(map[uint64]bool)
+	}
+	if m.seen[h] {
+		return h
+	}
+	if m.Threshold > 0 {
+		for _, g := range m.hashes {
+			if bits.OnesCount64(g^h) <= m.Threshold {
+				return g
+			}
+		}
+	}
+	m.hashes = append(m.hashes, h)
+	m.seen[h] = true
+	return h
+}
+
+// dHash returns the difference hash of img: img is reduced to 9x8 cells of
+// average luminance, and each bit records whether a cell is darker than its
+// right-hand neighbor.
+func dHash(img image.Image) uint64 {
+	const w, h = 9, 8
+	b := img.Bounds()
+	var lum [h][w]float64
+	for y := 0; y < h; y++ {
+		y0, y1 := span(b.Min.Y, b.Dy(), y, h)
+		for x := 0; x < w; x++ {
+			x0, x1 := span(b.Min.X, b.Dx(), x, w)
+			lum[y][x] = meanLuminance(img, x0, y0, x1, y1)
+		}
+	}
+	var hash uint64
+	for y := 0; y < h; y++ {
+		for x := 0; x < w-1; x++ {
+			hash <<= 1
+			if lum[y][x] < lum[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// span returns the bounds of cell i of n cells dividing size pixels starting
+// at min. Cells are at least one pixel wide.
+func span(min, size, i, n int) (lo, hi int) {
+	lo, hi = min+i*size/n, min+(i+1)*size/n
+	if hi <= lo {
+		hi = lo + 1
+	}
+	return
+}
+
+// meanLuminance returns the mean luminance of the pixels of img within the
+// rectangle (x0, y0)-(x1, y1), sampling at most 16x16 of them.
+func meanLuminance(img image.Image, x0, y0, x1, y1 int) float64 {
+	dx, dy := (x1-x0+15)/16, (y1-y0+15)/16
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += dy {
+		for x := x0; x < x1; x += dx {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
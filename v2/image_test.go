@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"math/bits"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// testImage returns a w x h image of a gradient overlaid with a pattern of
+// blocks; if flip is true, the image is mirrored horizontally.
+func testImage(w, h int, flip bool) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			u := x
+			if flip {
+				u = w - 1 - x
+			}
+			v := u * 128 / w
+			if (u*5/w+y*3/h)%3 == 0 {
+				v += 100
+			}
+			img.Set(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return img
+}
+
+func encodeImage(t *testing.T, img image.Image, format string) []byte {
+	var buf bytes.Buffer
+	var err error
+	switch format {
+	case "png":
+		err = png.Encode(&buf, img)
+	case "jpeg":
+		err = jpeg.Encode(&buf, img, &jpeg.Options{Quality: 80})
+	case "gif":
+		err = gif.Encode(&buf, img, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestImageMatcher(t *testing.T) {
+	img, other := testImage(64, 48, false), testImage(64, 48, true)
+	fs := filesys.Map(map[string][]byte{
+		"img/a.png":     encodeImage(t, img, "png"),
+		"img/a.jpg":     encodeImage(t, img, "jpeg"),
+		"img/a.gif":     encodeImage(t, img, "gif"),
+		"img/big.png":   encodeImage(t, testImage(640, 480, false), "png"),
+		"img/other.png": encodeImage(t, other, "png"),
+		"img/text1":     []byte("not an image"),
+		"img/text2":     []byte("not an image"),
+	}, nil)
+
+	sums, err := FilterDir("img", &Options{Matcher: NewImageMatcher(4), FileSystem: fs})
+	checkErrors(t, "", err, nil)
+
+	var groups [][]string
+	sums.RangeDigests(func(sum Digest, files []*File) bool {
+		groups = append(groups, sortedPaths(files))
+		return true
+	})
+	if len(groups) != 3 {
+		t.Fatalf("got %d groups %v; want 3", len(groups), groups)
+	}
+	for _, paths := range groups {
+		switch paths[0] {
+		case "img/a.gif":
+			if len(paths) != 4 {
+				t.Errorf("want a.gif, a.jpg, a.png, big.png grouped; got %v", paths)
+			}
+		case "img/other.png":
+			if len(paths) != 1 {
+				t.Errorf("want other.png alone; got %v", paths)
+			}
+		case "img/text1":
+			if len(paths) != 2 {
+				t.Errorf("want text1, text2 grouped; got %v", paths)
+			}
+		default:
+			t.Errorf("unexpected group %v", paths)
+		}
+	}
+}
+
+func TestDHash(t *testing.T) {
+	a, b := dHash(testImage(90, 80, false)), dHash(testImage(90, 80, true))
+	if a == b {
+		t.Errorf("dHash of different images = %#x for both", a)
+	}
+	if c := dHash(testImage(900, 800, false)); bits.OnesCount64(a^c) > 4 {
+		t.Errorf("dHash of resized image = %#x; want within 4 bits of %#x", c, a)
+	}
+}
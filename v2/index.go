@@ -0,0 +1,138 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"sort"
+	"time"
+)
+
+// indexFile is the serialized form of a File and its checksum.
+type indexFile struct {
+	Sum     string      `json:"sum"`
+	Path    string      `json:"path"`
+	Size    int64       `json:"size"`
+	Mode    os.FileMode `json:"mode"`
+	ModTime time.Time   `json:"mtime"`
+
+	Digests map[string]string `json:"digests,omitempty"` // Hex-encoded File.Digests by name.
+	Link    string            `json:"link,omitempty"`    // Path of the first file with the same checksum that is a hard link to the same file.
+}
+
+type index struct {
+	Files []indexFile `json:"files"`
+}
+
+// WriteIndex writes every file in s, along with its checksum, size, mode,
+// modification time, digests, if any, and the file it is a hard link to, if
+// any, to w as a JSON document that can be
+// loaded again with ReadIndex. Files are sorted by checksum and then by path,
+// so that the index of a given set of files is always written identically.
+func (s *Sums) WriteIndex(w io.Writer) error {
+	b, err := json.MarshalIndent(index{Files: s.indexFiles()}, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// indexFiles returns the serialized form of every file in s, sorted by
+// checksum and then by path.
+func (s *Sums) indexFiles() []indexFile {
+	files := []indexFile{}
+	s.RangeDigests(func(sum Digest, fs []*File) bool {
+		fs = sortedFiles(fs)
+		for i, file := range fs {
+			var link string
+			if l := linkedTo(fs[:i], file); l != nil {
+				link = l.Path
+			}
+			files = append(files, indexFile{
+				Sum:     hex.EncodeToString([]byte(sum)),
+				Path:    file.Path,
+				Size:    file.Info.Size(),
+				Mode:    file.Info.Mode(),
+				ModTime: file.Info.ModTime().UTC(),
+				Digests: hexDigests(file.Digests),
+				Link:    link,
+			})
+		}
+		return true
+	})
+	sort.Slice(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.Sum != b.Sum {
+			return a.Sum < b.Sum
+		}
+		return a.Path < b.Path
+	})
+	return files
+}
+
+// hexDigests returns the hex-encoded form of digests, or nil if it is empty.
+func hexDigests(digests map[string]Digest) map[string]string {
+	if len(digests) == 0 {
+		return nil
+	}
+	m := make(map[string]string, len(digests))
+	for name, sum := range digests {
+		m[name] = hex.EncodeToString([]byte(sum))
+	}
+	return m
+}
+
+// ReadIndex reads an index written by WriteIndex from r and returns a *Sums
+// containing its files. The os.FileInfo of each file reports the size, mode,
+// and modification time recorded in the index.
+func ReadIndex(r io.Reader) (*Sums, error) {
+	var x index
+	if err := json.NewDecoder(r).Decode(&x); err != nil {
+		return nil, fmt.Errorf("dedup: reading index: %w", err)
+	}
+	sums, err := sumsOf(x.Files)
+	if err != nil {
+		return nil, fmt.Errorf("dedup: reading index: %w", err)
+	}
+	return sums, nil
+}
+
+// sumsOf returns a *Sums containing files.
+func sumsOf(files []indexFile) (*Sums, error) {
+	sums := NewSums()
+	for _, f := range files {
+		sum, file, err := indexedFile(f)
+		if err != nil {
+			return nil, err
+		}
+		sums.AppendDigest(sum, file)
+	}
+	return sums, nil
+}
+
+// indexInfo implements os.FileInfo for a file loaded from an index.
+type indexInfo struct {
+	f indexFile
+}
+
+var _ os.FileInfo = (*indexInfo)(nil)
+
+func (i *indexInfo) Name() string       { return path.Base(i.f.Path) }
+func (i *indexInfo) Size() int64        { return i.f.Size }
+func (i *indexInfo) Mode() os.FileMode  { return i.f.Mode }
+func (i *indexInfo) ModTime() time.Time { return i.f.ModTime }
+func (i *indexInfo) IsDir() bool        { return i.f.Mode.IsDir() }
+func (i *indexInfo) Sys() interface{}   { return nil }
+
+// id identifies the file that i describes, which other files in an index may
+// be hard links to.
+func (i *indexInfo) id() string {
+	if i.f.Link != "" {
+		return i.f.Link
+	}
+	return i.f.Path
+}
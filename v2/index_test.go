@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestIndexRoundTrip(t *testing.T) {
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+
+	var buf bytes.Buffer
+	if err := sums.WriteIndex(&buf); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	loaded, err := ReadIndex(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatalf("ReadIndex() = %v", err)
+	}
+	if got, want := loaded.Stats(), indexedStats(sums.Stats()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+	checkSums(t, "", loaded, []string{
+		dupString(Dup1Sum, "root/foo/bar/dup1", "root/qux/quux/dup1"),
+		dupString(Dup2Sum, "root/dup2", "root/foo/baz/dup2", "root/qux/quuz/dup2"),
+		dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+	})
+
+	var buf2 bytes.Buffer
+	if err := loaded.WriteIndex(&buf2); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	if buf.String() != buf2.String() {
+		t.Errorf("index differs after round trip:\n%s\nwant:\n%s", buf2.String(), buf.String())
+	}
+
+	if _, err := ReadIndex(strings.NewReader(`{"files":[{"sum":"bogus"}]}`)); err == nil {
+		t.Error("ReadIndex(invalid checksum) = nil; want error")
+	}
+}
+
+// indexedStats returns the part of st that is recorded in an index, which
+// lists files but not how they were evaluated.
+func indexedStats(st Stats) Stats {
+	st.BytesRead, st.FilesSkipped, st.ErrorsCount = 0, 0, 0
+	st.Timings = Timings{}
+	return st
+}
+
+func TestSignedIndex(t *testing.T) {
+	pub, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sums, _ := FilterDir("root", &Options{FileSystem: FS})
+
+	var index, sig bytes.Buffer
+	if err := sums.WriteSignedIndex(&index, &sig, priv); err != nil {
+		t.Fatalf("WriteSignedIndex() = %v", err)
+	}
+	loaded, err := ReadSignedIndex(bytes.NewReader(index.Bytes()), bytes.NewReader(sig.Bytes()), pub)
+	if err != nil {
+		t.Fatalf("ReadSignedIndex() = %v", err)
+	}
+	if got, want := loaded.Stats(), indexedStats(sums.Stats()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+
+	tampered := bytes.Replace(index.Bytes(), []byte("root/red"), []byte("root/rex"), 1)
+	if _, err := ReadSignedIndex(bytes.NewReader(tampered), bytes.NewReader(sig.Bytes()), pub); err != ErrBadSignature {
+		t.Errorf("ReadSignedIndex(tampered) = %v; want ErrBadSignature", err)
+	}
+
+	other, _, _ := ed25519.GenerateKey(rand.Reader)
+	if _, err := ReadSignedIndex(bytes.NewReader(index.Bytes()), bytes.NewReader(sig.Bytes()), other); err != ErrBadSignature {
+		t.Errorf("ReadSignedIndex(other key) = %v; want ErrBadSignature", err)
+	}
+}
+
+func TestMarshalKeys(t *testing.T) {
+	pub, priv, _ := ed25519.GenerateKey(rand.Reader)
+
+	b, err := MarshalPrivateKey(priv)
+	if err != nil {
+		t.Fatalf("MarshalPrivateKey() = %v", err)
+	}
+	if got, err := ParsePrivateKey(b); err != nil || !priv.Equal(got) {
+		t.Errorf("ParsePrivateKey() = %v, %v; want %v", got, err, priv)
+	}
+
+	b, err = MarshalPublicKey(pub)
+	if err != nil {
+		t.Fatalf("MarshalPublicKey() = %v", err)
+	}
+	if got, err := ParsePublicKey(b); err != nil || !pub.Equal(got) {
+		t.Errorf("ParsePublicKey() = %v, %v; want %v", got, err, pub)
+	}
+	if _, err := ParsePublicKey([]byte("bogus")); err == nil {
+		t.Error("ParsePublicKey(bogus) = nil; want error")
+	}
+}
@@ -0,0 +1,141 @@
+package dedup
+
+import (
+	"strconv"
+	"strings"
+)
+
+// InputParser is the interface implemented by types that parse the lines
+// read by Filter into the paths of the files to evaluate.
+type InputParser interface {
+	// ParseLine returns the path given on line, which does not include
+	// the newline ending it, or ok false if line gives none.
+	ParseLine(line string) (path string, ok bool)
+}
+
+// LineParser is an InputParser for lists of paths written by hand or by other
+// tools: blank lines are skipped, and a carriage return ending a line, as in
+// the lists written on Windows, is dropped. The other characters of each line
+// are taken as they are unless Unquote is set.
+type LineParser struct {
+	Comments bool // Skip lines whose first character other than a space or tab is "#".
+
+	// Unquote, if true, makes the paths of lines be unquoted as by a POSIX
+	// shell, as in the output of ls --quoting-style=shell-escape or of the
+	// printf %q of bash: text in single quotes is taken as it is,
+	// backslashes escape the characters that follow them outside of quotes
+	// and some of them in double quotes, and $'...' quotes are unquoted as
+	// in bash. Spaces and tabs around the path are left out. Lines that are
+	// not well quoted are taken as they are. As backslashes are escapes,
+	// Unquote is not meant for lists of Windows paths.
+	Unquote bool
+}
+
+var _ InputParser = LineParser{}
+
+func (p LineParser) ParseLine(line string) (path string, ok bool) {
+	line = strings.TrimSuffix(line, "\r")
+	trimmed := strings.Trim(line, " \t")
+	if trimmed == "" || p.Comments && trimmed[0] == '#' {
+		return "", false
+	}
+	if p.Unquote {
+		if s, ok := shellUnquote(trimmed); ok {
+			return s, s != ""
+		}
+	}
+	return line, true
+}
+
+// shellUnquote unquotes s, a single word quoted as by a POSIX shell. ok
+// will be false if s is not well quoted, or is several words.
+func shellUnquote(s string) (string, bool) {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t':
+			return "", false
+		case c == '\\':
+			if i++; i == len(s) {
+				return "", false
+			}
+			b.WriteByte(s[i])
+		case c == '\'':
+			j := strings.IndexByte(s[i+1:], '\'')
+			if j < 0 {
+				return "", false
+			}
+			b.WriteString(s[i+1 : i+1+j])
+			i += j + 1
+		case c == '"':
+			for i++; i < len(s) && s[i] != '"'; i++ {
+				if s[i] == '\\' && i+1 < len(s) && strings.IndexByte("$`\"\\", s[i+1]) >= 0 {
+					i++
+				}
+				b.WriteByte(s[i])
+			}
+			if i == len(s) {
+				return "", false
+			}
+		case c == '$' && i+1 < len(s) && s[i+1] == '\'':
+			n, ok := ansiUnquote(&b, s[i+2:])
+			if !ok {
+				return "", false
+			}
+			i += n + 2
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return b.String(), true
+}
+
+// ansiUnquote writes the text of the $'...' quote whose contents start s to
+// b, with its escape sequences replaced, and returns the number of bytes of
+// s up to its closing quote.
+func ansiUnquote(b *strings.Builder, s string) (int, bool) {
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\'':
+			return i, true
+		case '\\':
+			if i+1 == len(s) {
+				return 0, false
+			}
+			n := 2 // Length of the escape sequence.
+			switch e := s[i+1]; e {
+			case 'a', 'b', 'f', 'n', 'r', 't', 'v':
+				b.WriteByte("\a\b\f\n\r\t\v"[strings.IndexByte("abfnrtv", e)])
+			case 'e', 'E':
+				b.WriteByte(0x1b)
+			case '\\', '\'', '"', '?':
+				b.WriteByte(e)
+			case 'x':
+				for n < 4 && i+n < len(s) && isHexDigit(s[i+n]) {
+					n++
+				}
+				if n == 2 {
+					return 0, false
+				}
+				v, _ := strconv.ParseUint(s[i+2:i+n], 16, 8)
+				b.WriteByte(byte(v))
+			case '0', '1', '2', '3', '4', '5', '6', '7':
+				for n = 1; n < 4 && i+n < len(s) && '0' <= s[i+n] && s[i+n] <= '7'; n++ {
+				}
+				v, _ := strconv.ParseUint(s[i+1:i+n], 8, 16)
+				b.WriteByte(byte(v))
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(e)
+			}
+			i += n - 1
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+	return 0, false
+}
+
+func isHexDigit(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
@@ -0,0 +1,56 @@
+package dedup
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestLineParser(t *testing.T) {
+	tests := []struct {
+		p    LineParser
+		line string
+		path string
+		ok   bool
+	}{
+		{LineParser{}, "root/a", "root/a", true},
+		{LineParser{}, "root/a\r", "root/a", true},
+		{LineParser{}, "", "", false},
+		{LineParser{}, " \t\r", "", false},
+		{LineParser{}, " root/a b ", " root/a b ", true},
+		{LineParser{}, "# root/a", "# root/a", true},
+		{LineParser{Comments: true}, "  # root/a", "", false},
+		{LineParser{Comments: true}, "root/#a", "root/#a", true},
+		{LineParser{}, "'root/a b'", "'root/a b'", true},
+		{LineParser{Unquote: true}, " 'root/a b'\r", "root/a b", true},
+		{LineParser{Unquote: true}, `root/a\ b\'s`, "root/a b's", true},
+		{LineParser{Unquote: true}, `"root/\$a \"b\" \c"`, `root/$a "b" \c`, true},
+		{LineParser{Unquote: true}, `'root/a'$'\n\tb\x41\101\'\q'`, "root/a\n\tbAA'\\q", true},
+		{LineParser{Unquote: true}, "root/a b", "root/a b", true},
+		{LineParser{Unquote: true}, "'root/a", "'root/a", true},
+		{LineParser{Unquote: true}, `"root/a`, `"root/a`, true},
+		{LineParser{Unquote: true}, `root/a\`, `root/a\`, true},
+		{LineParser{Unquote: true}, "''", "", false},
+	}
+	for i, tt := range tests {
+		path, ok := tt.p.ParseLine(tt.line)
+		if path != tt.path || ok != tt.ok {
+			t.Errorf("%d: %+v.ParseLine(%q) = %q, %v; want %q, %v", i+1, tt.p, tt.line, path, ok, tt.path, tt.ok)
+		}
+	}
+}
+
+func TestFilterInputParser(t *testing.T) {
+	input := "root/foo/bar/dup1\r\n\n# Copies\nroot/qux/quux/dup1\r\n\nroot/red\n"
+
+	sums, err := Filter(strings.NewReader(input), &Options{FileSystem: FS})
+	checkErrors(t, "1: ", err, []string{"lstat # Copies: file does not exist"})
+	if n := sums.Stats().NumFiles; n != 3 {
+		t.Errorf("1: evaluated %d files; want 3", n)
+	}
+
+	sums, err = Filter(strings.NewReader(input), &Options{InputParser: LineParser{Comments: true}, FileSystem: FS})
+	checkErrors(t, "2: ", err, nil)
+	checkSums(t, "2: ", sums, []string{
+		dupString(Dup1Sum, "root/foo/bar/dup1", "root/qux/quux/dup1"),
+	})
+}
@@ -0,0 +1,49 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"io/fs"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// FilterFS is like FilterPaths, except that it evaluates the files in the
+// subtrees of fsys located at roots, such as "." for every file, through the
+// FileSystem returned by filesys.FromFS in place of Options.FileSystem, and
+// that it is canceled along with ctx. The subtrees are listed and their files
+// evaluated concurrently, into the same Sums, as FilterPaths does for
+// several paths; they are walked as under the Recursive option, whether or
+// not it is set.
+//
+// As with a group of goroutines sharing a context, Options.ExitOnError makes
+// the evaluation stop at the first error, which is then the only one
+// returned; otherwise, every error is collected and returned. Once ctx is
+// done, evaluation stops as when Options.Cancel is closed, and the Errors
+// returned include ctx.Err() along with ErrCanceled, so that errors.Is
+// reports context.Canceled or context.DeadlineExceeded.
+func FilterFS(ctx context.Context, fsys fs.FS, roots []string, opts *Options) (*Sums, error) {
+	o := *opts
+	o.FileSystem = filesys.FromFS(fsys)
+	o.Recursive = true
+	if done := ctx.Done(); done != nil {
+		parent, cancel := o.Cancel, make(chan struct{})
+		returned := make(chan struct{})
+		defer close(returned)
+		go func() {
+			defer close(cancel)
+			select {
+			case <-done:
+			case <-parent:
+			case <-returned:
+			}
+		}()
+		o.Cancel = cancel
+	}
+	sums, err := FilterPaths(roots, &o)
+	if cerr := ctx.Err(); cerr != nil && errors.Is(err, ErrCanceled) {
+		errs, _ := err.(Errors)
+		err = append(errs, cerr)
+	}
+	return sums, err
+}
@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestFilterFS(t *testing.T) {
+	fsys := fstest.MapFS{
+		"photos/a":     {Data: []byte("aqua")},
+		"photos/x/b":   {Data: []byte("blue")},
+		"backup/a":     {Data: []byte("aqua")},
+		"backup/y/z/b": {Data: []byte("blue")},
+		"other/a":      {Data: []byte("aqua")},
+	}
+	sums, err := FilterFS(context.Background(), fsys, []string{"photos", "backup"}, &Options{})
+	checkErrors(t, "", err, nil)
+	checkSums(t, "", sums, []string{
+		dupString(sha1Sum([]byte("aqua")), "backup/a", "photos/a"),
+		dupString(sha1Sum([]byte("blue")), "backup/y/z/b", "photos/x/b"),
+	})
+
+	// Every error is collected, or only the first under ExitOnError.
+	roots := []string{"photos", "missing1", "missing2"}
+	_, err = FilterFS(context.Background(), fsys, roots, &Options{})
+	if errs, ok := err.(Errors); !ok || len(errs) != 2 {
+		t.Errorf("FilterFS() = %v; want 2 errors", err)
+	}
+	_, err = FilterFS(context.Background(), fsys, roots, &Options{ExitOnError: true})
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 {
+		t.Errorf("FilterFS() under ExitOnError = %v; want 1 error", err)
+	}
+
+	// The context is canceled while the first file is evaluated, one at a
+	// time.
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	stall := StageFunc(func(r *Result) error {
+		cancel()
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	sums, err = FilterFS(ctx, fsys, []string{"."}, &Options{LowPriority: true, Stages: &Stages{Stat: []Stage{stall}}})
+	if !errors.Is(err, context.Canceled) || !errors.Is(err, ErrCanceled) || !sums.Partial() {
+		t.Errorf("FilterFS() with a canceled context = %v, Partial() = %v; want %v, partial", err, sums.Partial(), context.Canceled)
+	}
+
+	// Options.Cancel still cancels the evaluation, without a context error.
+	closed := make(chan struct{})
+	close(closed)
+	stall = StageFunc(func(r *Result) error {
+		time.Sleep(10 * time.Millisecond)
+		return nil
+	})
+	_, err = FilterFS(context.Background(), fsys, []string{"."}, &Options{Cancel: closed, LowPriority: true, Stages: &Stages{Stat: []Stage{stall}}})
+	if !errors.Is(err, ErrCanceled) || errors.Is(err, context.Canceled) {
+		t.Errorf("FilterFS() with Options.Cancel closed = %v; want %v alone", err, ErrCanceled)
+	}
+}
@@ -0,0 +1,46 @@
+//go:build go1.23
+// +build go1.23
+
+package dedup
+
+import "iter"
+
+// All returns an iterator over each sum and set of files present in s, for
+// use with range-over-func:
+//
+//	for sum, files := range sums.All() {
+//		...
+//	}
+//
+// Unlike Range, the iteration is over a snapshot of s taken when it begins,
+// so that the body of the loop may call the methods of s, including those
+// that modify it.
+func (s *Sums) All() iter.Seq2[Digest, []*File] {
+	return func(yield func(Digest, []*File) bool) {
+		var sums []Digest
+		var files [][]*File
+		s.RangeDigests(func(sum Digest, fs []*File) bool {
+			sums = append(sums, sum)
+			files = append(files, append([]*File(nil), fs...))
+			return true
+		})
+
+		for i, sum := range sums {
+			if !yield(sum, files[i]) {
+				return
+			}
+		}
+	}
+}
+
+// Dups returns an iterator over the groups of duplicate files in s, as
+// returned by DupGroups.
+func (s *Sums) Dups() iter.Seq[Group] {
+	return func(yield func(Group) bool) {
+		for _, g := range s.DupGroups() {
+			if !yield(g) {
+				return
+			}
+		}
+	}
+}
@@ -0,0 +1,57 @@
+//go:build go1.23
+// +build go1.23
+
+package dedup
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSumsAll(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/a/aqua")
+	add("aqua", "/b/aqua")
+	add("gray", "/a/gray")
+
+	var got []string
+	for sum, files := range sums.All() {
+		sums.Remove(sum, files[0].Path) // The body may modify sums.
+		for _, file := range files {
+			got = append(got, file.Path)
+		}
+	}
+	sort.Strings(got)
+	if want := []string{"/a/aqua", "/a/gray", "/b/aqua"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("All() yielded %q; want %q", got, want)
+	}
+	if n := sums.Stats().NumFiles; n != 1 {
+		t.Errorf("NumFiles = %d after removing a file of each checksum; want 1", n)
+	}
+
+	for range sums.All() {
+		break
+	}
+}
+
+func TestSumsDups(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/a/aqua")
+	add("aqua", "/b/aqua")
+	add("gray", "/a/gray")
+	add("gray", "/b/gray")
+	add("lime", "/a/lime")
+
+	var got []Digest
+	for g := range sums.Dups() {
+		got = append(got, g.Sum)
+	}
+	want := []Digest{keySum["aqua"], keySum["gray"]}
+	sort.Slice(want, func(i, j int) bool { return want[i] < want[j] })
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Dups() yielded %x; want %x", got, want)
+	}
+}
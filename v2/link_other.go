@@ -0,0 +1,10 @@
+//go:build !windows
+// +build !windows
+
+package dedup
+
+import "os"
+
+// isDirLink reports that no file is known to link to a directory without
+// following it: only Windows marks links to directories as such.
+func isDirLink(info os.FileInfo) bool { return false }
@@ -0,0 +1,18 @@
+package dedup
+
+import (
+	"os"
+	"syscall"
+)
+
+// isDirLink reports whether info describes a junction or a symbolic link to a
+// directory: a directory reparse point that the os package reports as a link,
+// with os.ModeSymlink, or as a mount point, with os.ModeIrregular. Other
+// reparse points, such as those of files synchronized with cloud storage, are
+// ordinary directories.
+func isDirLink(info os.FileInfo) bool {
+	attrs, ok := info.Sys().(*syscall.Win32FileAttributeData)
+	return ok && attrs.FileAttributes&syscall.FILE_ATTRIBUTE_REPARSE_POINT != 0 &&
+		attrs.FileAttributes&syscall.FILE_ATTRIBUTE_DIRECTORY != 0 &&
+		info.Mode()&(os.ModeSymlink|os.ModeIrregular) != 0
+}
@@ -0,0 +1,56 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+)
+
+func TestFilterDirJunctions(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	data := filepath.Join(root, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, "file"), []byte("file"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	junction := filepath.Join(root, "junction")
+	if out, err := exec.Command("cmd", "/c", "mklink", "/J", junction, data).CombinedOutput(); err != nil {
+		t.Skipf("mklink: %v: %s", err, out)
+	}
+
+	info, err := os.Lstat(junction)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isSymlink(info) || isSpecial(info) {
+		t.Errorf("junction: isSymlink = %v, isSpecial = %v; want true, false", isSymlink(info), isSpecial(info))
+	}
+
+	// Unless followed, the junction is skipped instead of being read as a
+	// file; followed, the files it leads to are evaluated again.
+	tests := []struct {
+		follow            bool
+		numFiles, skipped uint64
+	}{
+		{false, 1, 1},
+		{true, 2, 0},
+	}
+	for _, tt := range tests {
+		sums, err := FilterDir(root, &Options{Recursive: true, FollowSymlinks: tt.follow})
+		if err != nil {
+			t.Errorf("FollowSymlinks %v: %v", tt.follow, err)
+		}
+		if st := sums.Stats(); st.NumFiles != tt.numFiles || st.FilesSkipped != tt.skipped {
+			t.Errorf("FollowSymlinks %v: NumFiles = %d, FilesSkipped = %d; want %d, %d",
+				tt.follow, st.NumFiles, st.FilesSkipped, tt.numFiles, tt.skipped)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package dedup
+
+// Logger receives structured records of the events of an evaluation: errors,
+// at the Error level, as they are also reported; files and directories
+// skipped, at the Info level; and traces of each directory read and file
+// evaluated, at the Debug level. args are alternating keys and values, as
+// for log/slog, whose *slog.Logger implements Logger, so that an evaluation
+// may log to a service's own logger. Logger methods may be called from any
+// goroutine.
+type Logger interface {
+	Debug(msg string, args ...interface{})
+	Info(msg string, args ...interface{})
+	Error(msg string, args ...interface{})
+}
+
+// logError logs err under the Logger option, if set.
+func (opts *Options) logError(err error) {
+	if opts.Logger != nil {
+		opts.Logger.Error("evaluation error", "err", err)
+	}
+}
+
+// logSkip logs the skipping of the file located at path for reason under the
+// Logger option, if set.
+func (opts *Options) logSkip(path, reason string) {
+	if opts.Logger != nil {
+		opts.Logger.Info("skipped", "path", path, "reason", reason)
+	}
+}
+
+// logDebug logs msg and args under the Logger option, if set.
+func (opts *Options) logDebug(msg string, args ...interface{}) {
+	if opts.Logger != nil {
+		opts.Logger.Debug(msg, args...)
+	}
+}
@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"sync"
+	"testing"
+)
+
+// recordLogger is a Logger that records the messages of the records it
+// receives at each level, along with their path, if any.
+type recordLogger struct {
+	mu      sync.Mutex
+	records map[string][]string // Levels to messages and paths.
+}
+
+func (l *recordLogger) Debug(msg string, args ...interface{}) { l.record("debug", msg, args) }
+func (l *recordLogger) Info(msg string, args ...interface{})  { l.record("info", msg, args) }
+func (l *recordLogger) Error(msg string, args ...interface{}) { l.record("error", msg, args) }
+
+func (l *recordLogger) record(level, msg string, args []interface{}) {
+	for i := 0; i+1 < len(args); i += 2 {
+		if args[i] == "path" {
+			msg = fmt.Sprintf("%s %v", msg, args[i+1])
+		}
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.records == nil {
+		l.records = make(map[string][]string)
+	}
+	l.records[level] = append(l.records[level], msg)
+}
+
+func (l *recordLogger) count(level, msg string) (n int) {
+	for _, m := range l.records[level] {
+		if m == msg {
+			n++
+		}
+	}
+	return n
+}
+
+func TestFilterDirLogger(t *testing.T) {
+	l := new(recordLogger)
+	opts := &Options{
+		Recursive:     true,
+		ExcludeRegexp: regexp.MustCompile(`/qux/`),
+		Logger:        l,
+		FileSystem:    FS,
+	}
+	_, err := FilterDir("root", opts)
+
+	if got, want := len(l.records["error"]), len(err.(Errors)); got != want {
+		t.Errorf("logged %d errors; want %d", got, want)
+	}
+	skipped := append([]string(nil), l.records["info"]...)
+	sort.Strings(skipped)
+	if want := []string{"skipped root/qux"}; fmt.Sprint(skipped) != fmt.Sprint(want) {
+		t.Errorf("logged skips %q; want %q", skipped, want)
+	}
+	if n := l.count("debug", "reading directory root/foo/bar"); n != 1 {
+		t.Errorf("logged reading root/foo/bar %d times; want 1", n)
+	}
+	if n := l.count("debug", "evaluated root/foo/bar/dup1"); n != 1 {
+		t.Errorf("logged evaluating root/foo/bar/dup1 %d times; want 1", n)
+	}
+}
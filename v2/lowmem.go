@@ -0,0 +1,363 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// lowMemBuckets is the number of temporary files among which the files
+// listed under Options.LowMemory are divided by size, so that each bucket,
+// holding every file of the sizes it is given, may be read into memory on its
+// own.
+const lowMemBuckets = 256
+
+// errLowMemoryState is returned for Options that set both StatePath and
+// LowMemory, as the state of an evaluation under LowMemory lies in its
+// temporary files.
+var errLowMemoryState = errors.New("dedup: StatePath is not supported with LowMemory")
+
+// filterLowMemory evaluates the files located at roots as FilterPaths does
+// under the LowMemory option.
+func filterLowMemory(roots []string, opts *Options) (*Sums, error) {
+	if opts.StatePath != "" {
+		return nil, Errors{errLowMemoryState}
+	}
+	l, err := newLowMemFilter(roots, opts)
+	if err != nil {
+		return nil, Errors{err}
+	}
+	if err := l.Sums().spillTo(opts.SpillDir); err != nil {
+		_ = os.RemoveAll(l.dir)
+		return nil, Errors{err}
+	}
+	return run(l, opts)
+}
+
+// lowMemFilter is an implementation of the filter interface for FilterPaths
+// under the LowMemory option. It first lists every file located at its roots,
+// appending the size and path of each to the bucket for its size in a
+// temporary directory, then reads the buckets one at a time, sorts their
+// files by size, and passes those whose sizes several files share on to a
+// chanFilter. Files that cannot be stat'ed while listing are passed on at
+// once, so that the chanFilter reports their errors.
+type lowMemFilter struct {
+	roots []string
+	opts  *Options
+	dir   string // Temporary directory holding the buckets.
+
+	f    *chanFilter
+	in   chan listedFile // Input of f.
+	err  chan error      // Errors writing or reading the buckets.
+	errs <-chan error    // Outgoing errors, from f, the dirReader, and err.
+	r    *dirReader
+	stop *signal       // Signal to stop listing and feeding f.
+	done chan struct{} // Closed once feeding f is done.
+}
+
+var _ filter = (*lowMemFilter)(nil)
+
+func newLowMemFilter(roots []string, opts *Options) (*lowMemFilter, error) {
+	dir, err := ioutil.TempDir(opts.SpillDir, "dedup-list")
+	if err != nil {
+		return nil, err
+	}
+	l := &lowMemFilter{roots: roots, opts: opts, dir: dir}
+	l.in = make(chan listedFile)
+	l.f = newChanFilter(l.in, opts.procs(ratioMaxProcs(3, 4)), opts)
+	l.f.listed = true
+	l.r = newDirReader(roots, opts.procs(ratioMaxProcs(1, 4)), opts)
+	l.r.sums = l.f.sums
+	l.err = make(chan error)
+	l.errs = mergeErrors(l.f.cancel.C(), l.r.err, l.f.err, l.err)
+	l.stop = newSignal()
+	l.done = make(chan struct{})
+	return l, nil
+}
+
+func (l *lowMemFilter) Uniq() <-chan Result { return l.f.Uniq() }
+
+func (l *lowMemFilter) Dup() <-chan Result { return l.f.Dup() }
+
+func (l *lowMemFilter) Err() <-chan error { return l.errs }
+
+func (l *lowMemFilter) Sums() *Sums { return l.f.Sums() }
+
+// Start begins listing the files located at the roots of l, and the
+// chanFilter that evaluates them. Not to be called more than once on the same
+// instance.
+func (l *lowMemFilter) Start() {
+	l.f.Start()
+	go l.feed()
+}
+
+// Drain stops listing files and passing them on, and drains the chanFilter
+// managed by l.
+func (l *lowMemFilter) Drain() {
+	l.f.Drain()
+	l.stop.Once()
+	l.r.Cancel()
+}
+
+// Cancel stops listing files and interrupts the chanFilter managed by l, and
+// waits for both to return and the temporary files of l to be removed.
+func (l *lowMemFilter) Cancel() {
+	l.stop.Once()
+	l.r.Cancel()
+	l.f.Cancel()
+	<-l.done
+}
+
+// feed lists the files located at the roots of l into its buckets, then
+// passes them on to its chanFilter a bucket at a time, and finally removes
+// the buckets.
+func (l *lowMemFilter) feed() {
+	defer close(l.done)
+	defer close(l.in)
+	defer close(l.err)
+	defer os.RemoveAll(l.dir)
+
+	if err := l.list(); err != nil {
+		l.emitErr(err)
+		return
+	}
+	for i := 0; i < lowMemBuckets; i++ {
+		if err := l.feedBucket(i); err != nil {
+			l.emitErr(err)
+			return
+		}
+		if l.stopped() {
+			return
+		}
+	}
+}
+
+// lowMemRecord is a file listed into a bucket.
+type lowMemRecord struct {
+	size int64
+	path string
+	link string // Path of the symbolic link followed to path, if any.
+}
+
+// list lists the files located at the roots of l into its buckets, returning
+// the first error writing them.
+func (l *lowMemFilter) list() error {
+	var mu sync.Mutex
+	var files [lowMemBuckets]*os.File
+	var bufs [lowMemBuckets]*bufio.Writer
+	var werr error
+	write := func(rec lowMemRecord) {
+		if err := l.write(&mu, &files, &bufs, rec); err != nil {
+			mu.Lock()
+			if werr == nil {
+				werr = err
+			}
+			mu.Unlock()
+			l.r.Cancel()
+		}
+	}
+
+	l.r.Start()
+	var wg sync.WaitGroup
+	numProcs := l.opts.procs(ratioMaxProcs(3, 4))
+	wg.Add(numProcs)
+	for i := 0; i < numProcs; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range l.r.out {
+				l.listed(file, write)
+			}
+		}()
+	}
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-l.stop.C():
+			l.r.Cancel()
+		case <-finished:
+		}
+	}()
+	wg.Wait()
+	close(finished)
+
+	for i, f := range files {
+		if f == nil {
+			continue
+		}
+		if err := bufs[i].Flush(); err != nil && werr == nil {
+			werr = err
+		}
+		if err := f.Close(); err != nil && werr == nil {
+			werr = err
+		}
+	}
+	return werr
+}
+
+// write appends rec to the bucket for its size among files, creating it if
+// need be, through its buffer among bufs. It is called with mu unlocked.
+func (l *lowMemFilter) write(mu *sync.Mutex, files *[lowMemBuckets]*os.File, bufs *[lowMemBuckets]*bufio.Writer, rec lowMemRecord) error {
+	mu.Lock()
+	defer mu.Unlock()
+
+	i := int(uint64(rec.size) % lowMemBuckets)
+	if bufs[i] == nil {
+		f, err := os.Create(filepath.Join(l.dir, fmt.Sprint(i)))
+		if err != nil {
+			return err
+		}
+		files[i], bufs[i] = f, bufio.NewWriter(f)
+	}
+	return writeLowMemRecord(bufs[i], rec)
+}
+
+// listed writes the file listed to its bucket, or passes it on at once if it
+// cannot be stat'ed, is excluded, or is a special file or a link skipped, for
+// the chanFilter to report as such.
+func (l *lowMemFilter) listed(file listedFile, write func(lowMemRecord)) {
+	if !l.opts.matches(file.path) {
+		l.send(file)
+		return
+	}
+	if file.info == nil {
+		info, path, err := l.opts.lstat(file.path)
+		if err != nil {
+			l.send(file)
+			return
+		}
+		file = listed(file.path, path, info)
+	}
+	switch {
+	case file.info.IsDir():
+	case isDirLink(file.info) || isSpecial(file.info) || l.opts.skipsLink(file.info):
+		l.send(file)
+	default:
+		write(lowMemRecord{size: file.info.Size(), path: file.path, link: file.link})
+	}
+}
+
+// feedBucket reads bucket i and passes its files on to the chanFilter of l,
+// in order of size, skipping those whose sizes are unique unless a Matcher or
+// Canonical is set, as Options.Precount does.
+func (l *lowMemFilter) feedBucket(i int) error {
+	f, err := os.Open(filepath.Join(l.dir, fmt.Sprint(i)))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil // Nothing was listed into bucket i.
+	}
+	if err != nil {
+		return err
+	}
+	var recs []lowMemRecord
+	br := bufio.NewReader(f)
+	for {
+		rec, err := readLowMemRecord(br)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			_ = f.Close()
+			return fmt.Errorf("dedup: reading listed files: %w", err)
+		}
+		recs = append(recs, rec)
+	}
+	_ = f.Close()
+	_ = os.Remove(f.Name()) // Free the space for the next buckets.
+
+	sort.SliceStable(recs, func(i, j int) bool { return recs[i].size < recs[j].size })
+	prefilter := l.opts.Matcher == nil && l.opts.Canonical == nil
+	for start := 0; start < len(recs); {
+		end := start + 1
+		for end < len(recs) && recs[end].size == recs[start].size {
+			end++
+		}
+		for _, rec := range recs[start:end] {
+			if prefilter && end-start < 2 {
+				l.f.skipped(rec.path, "unique size")
+				continue
+			}
+			if !l.send(listedFile{path: rec.path, link: rec.link}) {
+				return nil
+			}
+		}
+		start = end
+	}
+	return nil
+}
+
+// send passes file on to the chanFilter of l, and reports whether it did
+// before l was stopped.
+func (l *lowMemFilter) send(file listedFile) bool {
+	select {
+	case <-l.stop.C():
+		return false
+	case l.in <- file:
+		return true
+	}
+}
+
+func (l *lowMemFilter) emitErr(err error) {
+	l.opts.logError(err)
+	select {
+	case <-l.stop.C():
+	case l.err <- err:
+	}
+}
+
+func (l *lowMemFilter) stopped() bool {
+	select {
+	case <-l.stop.C():
+		return true
+	default:
+		return false
+	}
+}
+
+// writeLowMemRecord writes rec to w as the varint of its size followed by the
+// length-prefixed path and link.
+func writeLowMemRecord(w *bufio.Writer, rec lowMemRecord) error {
+	var buf [binary.MaxVarintLen64]byte
+	_, _ = w.Write(buf[:binary.PutVarint(buf[:], rec.size)])
+	for _, s := range []string{rec.path, rec.link} {
+		_, _ = w.Write(buf[:binary.PutUvarint(buf[:], uint64(len(s)))])
+		if _, err := w.WriteString(s); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readLowMemRecord reads a record written by writeLowMemRecord from r,
+// returning io.EOF if there are no more.
+func readLowMemRecord(r *bufio.Reader) (rec lowMemRecord, err error) {
+	if rec.size, err = binary.ReadVarint(r); err != nil {
+		return rec, err
+	}
+	var strs [2]string
+	for i := range strs {
+		n, err := binary.ReadUvarint(r)
+		if err != nil {
+			return rec, unexpectedEOF(err)
+		}
+		b := make([]byte, n)
+		if _, err := io.ReadFull(r, b); err != nil {
+			return rec, unexpectedEOF(err)
+		}
+		strs[i] = string(b)
+	}
+	rec.path, rec.link = strs[0], strs[1]
+	return rec, nil
+}
+
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
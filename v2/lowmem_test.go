@@ -0,0 +1,71 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFilterDirLowMemory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want, wantErr := FilterDir("root", &Options{Recursive: true, Precount: true, FileSystem: FS})
+	sums, err := FilterDir("root", &Options{Recursive: true, LowMemory: true, SpillDir: dir, FileSystem: FS})
+	if got, want := len(err.(Errors)), len(wantErr.(Errors)); got != want {
+		t.Errorf("FilterDir() = %d errors; want %d, as under Precount", got, want)
+	}
+	if got, want := untimed(sums.Stats()), untimed(want.Stats()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %v; want %v, as under Precount", got, want)
+	}
+	var got, wantBuf bytes.Buffer
+	_ = sums.WriteAllDup(&got)
+	_ = want.WriteAllDup(&wantBuf)
+	if got.String() != wantBuf.String() {
+		t.Errorf("WriteAllDup() wrote:\n%s\nwant:\n%s", got.String(), wantBuf.String())
+	}
+
+	// Only the spilled Sums remain in dir, the listed files having been
+	// removed.
+	if names, _ := ioutil.ReadDir(dir); len(names) != 1 {
+		t.Errorf("%s holds %d files before Close; want 1", dir, len(names))
+	}
+	if err := sums.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("%s holds %d files after Close; want none", dir, len(names))
+	}
+
+	if _, err := FilterDir("root", &Options{LowMemory: true, StatePath: "state", FileSystem: FS}); !reflect.DeepEqual(err, Errors{errLowMemoryState}) {
+		t.Errorf("FilterDir() with StatePath = %v; want %v", err, errLowMemoryState)
+	}
+}
+
+func TestLowMemRecords(t *testing.T) {
+	recs := []lowMemRecord{{size: 0, path: "a"}, {size: 1 << 40, path: "b/c", link: "d"}, {size: 7, path: ""}}
+	var b bytes.Buffer
+	w := bufio.NewWriter(&b)
+	for _, rec := range recs {
+		if err := writeLowMemRecord(w, rec); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = w.Flush()
+	r := bufio.NewReader(&b)
+	for _, want := range recs {
+		if got, err := readLowMemRecord(r); err != nil || got != want {
+			t.Errorf("readLowMemRecord() = %+v, %v; want %+v", got, err, want)
+		}
+	}
+	if _, err := readLowMemRecord(r); err != io.EOF {
+		t.Errorf("readLowMemRecord() at end = %v; want EOF", err)
+	}
+}
@@ -0,0 +1,27 @@
+package dedup
+
+import "io"
+
+// Matcher is the interface implemented by types that compute the Digest
+// under which a file is grouped with others, in place of the default SHA1
+// checksum of its contents. Implementations must be safe for concurrent use.
+type Matcher interface {
+	// Sum returns the Digest of file. open opens the file for reading;
+	// Sum need not call it if the Digest can be computed without reading
+	// the file's contents. The file is closed once Sum returns.
+	Sum(file *File, open func() (io.Reader, error)) (Digest, error)
+}
+
+// Verifier is an optional interface that a Matcher may implement to confirm
+// that a file is alike to the files already grouped under its Digest, such
+// as when the Digest is a fingerprint that unrelated files may share on
+// occasion. A file that is not confirmed to be alike to them is grouped with
+// others like it under a Digest of its own: the Digest of the Matcher
+// followed by a count of the groups that share it before. Files are added to
+// the groups of an evaluation one at a time while Verify is called.
+type Verifier interface {
+	// Verify reports whether file is alike to other, the first file
+	// grouped under the Digest that they share. open opens either file for
+	// reading; the files opened are closed once Verify returns.
+	Verify(file, other *File, open func(file *File) (io.Reader, error)) (bool, error)
+}
@@ -0,0 +1,66 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"io/ioutil"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// sizeVerifier is a Matcher grouping files by size, and a Verifier
+// confirming that they share their contents as well.
+type sizeVerifier struct{}
+
+func (sizeVerifier) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	b := make([]byte, 8)
+	binary.BigEndian.PutUint64(b, uint64(file.Info.Size()))
+	return Digest(b), nil
+}
+
+func (sizeVerifier) Verify(file, other *File, open func(file *File) (io.Reader, error)) (bool, error) {
+	var contents [2][]byte
+	for i, f := range []*File{file, other} {
+		r, err := open(f)
+		if err != nil {
+			return false, err
+		}
+		if contents[i], err = ioutil.ReadAll(r); err != nil {
+			return false, err
+		}
+	}
+	return bytes.Equal(contents[0], contents[1]), nil
+}
+
+func TestFilterDirVerifier(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a": []byte("abc"),
+		"root/b": []byte("abc"),
+		"root/c": []byte("xyz"),
+		"root/d": []byte("xyz"),
+		"root/e": []byte("pqr"),
+	}, nil)
+	sums, err := FilterDir("root", &Options{Matcher: sizeVerifier{}, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+
+	var got []string
+	for _, g := range sums.DupGroups() {
+		var paths []string
+		for _, file := range g.Files {
+			paths = append(paths, file.Path)
+		}
+		got = append(got, strings.Join(paths, " "))
+	}
+	sort.Strings(got)
+	if want := []string{"root/a root/b", "root/c root/d"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("DupGroups() = %q; want %q", got, want)
+	}
+	if got := sums.Stats().NumDupFiles; got != 2 {
+		t.Errorf("NumDupFiles = %d; want 2", got)
+	}
+}
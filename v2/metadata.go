@@ -0,0 +1,45 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// NameSizeMatcher is a Matcher that groups files by their base names and
+// sizes, without reading their contents. It is much faster than comparing
+// contents on slow network file systems, but only gives an estimate: files
+// with the same name and size may differ, and copies that were renamed are
+// not found. The steps that Sums.Plan returns for its groups thus fail when
+// applied to files whose contents differ; see Step.Apply.
+type NameSizeMatcher struct{}
+
+var _ Matcher = NameSizeMatcher{}
+
+func (NameSizeMatcher) Sum(file *File, _ func() (io.Reader, error)) (Digest, error) {
+	b := make([]byte, 8, 8+len(file.Path))
+	binary.BigEndian.PutUint64(b, uint64(file.Info.Size()))
+	return Digest(append(b, baseName(file.Path)...)), nil
+}
+
+// SizeModTimeMatcher is a Matcher that groups files by their sizes and
+// modification times, without reading their contents. Like NameSizeMatcher,
+// it only gives an estimate, but it also groups copies that were renamed, as
+// long as their modification times were preserved when copying.
+type SizeModTimeMatcher struct{}
+
+var _ Matcher = SizeModTimeMatcher{}
+
+func (SizeModTimeMatcher) Sum(file *File, _ func() (io.Reader, error)) (Digest, error) {
+	var b [16]byte
+	binary.BigEndian.PutUint64(b[:8], uint64(file.Info.Size()))
+	binary.BigEndian.PutUint64(b[8:], uint64(file.Info.ModTime().UnixNano()))
+	return Digest(b[:]), nil
+}
+
+// baseName returns the last element of path, which may be a path in the local
+// file system, a URL, or a path within an archive.
+func baseName(path string) string {
+	return path[strings.LastIndexAny(path, "/"+string(filepath.Separator))+1:]
+}
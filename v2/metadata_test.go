@@ -0,0 +1,97 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// metadataFS gives files the given modification times, and fails to open
+// them so as to show that they were not read.
+type metadataFS struct {
+	filesys.FileSystem
+	mtimes map[string]time.Time
+}
+
+type mtimeInfo struct {
+	os.FileInfo
+	mtime time.Time
+}
+
+func (i mtimeInfo) ModTime() time.Time { return i.mtime }
+
+func (fs metadataFS) Lstat(path string) (os.FileInfo, error) {
+	info, err := fs.FileSystem.Lstat(path)
+	if err == nil && !info.IsDir() {
+		info = mtimeInfo{info, fs.mtimes[path]}
+	}
+	return info, err
+}
+
+func (fs metadataFS) Open(path string) (filesys.File, error) {
+	return nil, &os.PathError{Op: "open", Path: path, Err: os.ErrPermission}
+}
+
+func TestMetadataMatchers(t *testing.T) {
+	t0 := time.Unix(1e9, 0)
+	fs := metadataFS{
+		filesys.Map(map[string][]byte{
+			"root/a/photo.jpg": Dup1,
+			"root/b/photo.jpg": Dup2, // Same name and size, different contents.
+			"root/b/copy.jpg":  Dup1,
+			"root/c/photo.jpg": []byte("short"),
+		}, nil),
+		map[string]time.Time{
+			"root/a/photo.jpg": t0,
+			"root/b/photo.jpg": t0.Add(time.Second),
+			"root/b/copy.jpg":  t0,
+			"root/c/photo.jpg": t0,
+		},
+	}
+	nameSize := func(name string, size uint64) Digest {
+		b := make([]byte, 8)
+		binary.BigEndian.PutUint64(b, size)
+		return Digest(append(b, name...))
+	}
+	sizeModTime := func(size uint64, mtime time.Time) Digest {
+		var b [16]byte
+		binary.BigEndian.PutUint64(b[:8], size)
+		binary.BigEndian.PutUint64(b[8:], uint64(mtime.UnixNano()))
+		return Digest(b[:])
+	}
+
+	for _, tc := range []struct {
+		name    string
+		matcher Matcher
+		want    []string
+	}{
+		{"NameSize", NameSizeMatcher{}, []string{
+			dupString(nameSize("photo.jpg", 1e6), "root/a/photo.jpg", "root/b/photo.jpg"),
+		}},
+		{"SizeModTime", SizeModTimeMatcher{}, []string{
+			dupString(sizeModTime(1e6, t0), "root/a/photo.jpg", "root/b/copy.jpg"),
+		}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			sums, err := FilterDir("root", &Options{Recursive: true, Matcher: tc.matcher, FileSystem: fs})
+			checkErrors(t, "", err, nil)
+			checkSums(t, "", sums, tc.want)
+		})
+	}
+}
+
+func TestBaseName(t *testing.T) {
+	for path, want := range map[string]string{
+		"file":                        "file",
+		"dir/file":                    "file",
+		"s3://bucket/dir/file":        "file",
+		"dir/archive.zip!/inner/file": "file",
+	} {
+		if got := baseName(path); got != want {
+			t.Errorf("baseName(%q) = %q, want %q", path, got, want)
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"sync/atomic"
+)
+
+// Metrics receives counts of the work done by evaluations as it is done, so
+// that long-running or scheduled evaluations may be monitored. Its methods
+// may be called from any goroutine. Counters implements Metrics.
+type Metrics interface {
+	FileHashed()        // A file was evaluated.
+	BytesRead(n uint64) // n bytes of files were read.
+	Error()             // An error was reported.
+	Dup()               // A file with a previously-seen checksum was reported.
+}
+
+// Counters is a Metrics that counts the work done by the evaluations it is
+// set on, across evaluations, and exports the counts in the Prometheus text
+// format.
+type Counters struct {
+	filesHashed uint64 // Accessed atomically.
+	bytesRead   uint64 // Accessed atomically.
+	errors      uint64 // Accessed atomically.
+	dups        uint64 // Accessed atomically.
+}
+
+var _ Metrics = (*Counters)(nil)
+
+// NewCounters returns a *Counters with every count 0.
+func NewCounters() *Counters {
+	return new(Counters)
+}
+
+// FileHashed, BytesRead, Error, and Dup implement Metrics.
+func (c *Counters) FileHashed()        { atomic.AddUint64(&c.filesHashed, 1) }
+func (c *Counters) BytesRead(n uint64) { atomic.AddUint64(&c.bytesRead, n) }
+func (c *Counters) Error()             { atomic.AddUint64(&c.errors, 1) }
+func (c *Counters) Dup()               { atomic.AddUint64(&c.dups, 1) }
+
+// WritePrometheus writes the counts of c to w in the Prometheus text
+// exposition format, as counters named dedup_files_hashed_total,
+// dedup_bytes_read_total, dedup_errors_total, and dedup_dups_total.
+func (c *Counters) WritePrometheus(w io.Writer) error {
+	for _, m := range []struct {
+		name, help string
+		n          *uint64
+	}{
+		{"dedup_files_hashed_total", "Files evaluated.", &c.filesHashed},
+		{"dedup_bytes_read_total", "Bytes of files read.", &c.bytesRead},
+		{"dedup_errors_total", "Errors reported.", &c.errors},
+		{"dedup_dups_total", "Files with previously-seen checksums reported.", &c.dups},
+	} {
+		_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s counter\n%s %d\n",
+			m.name, m.help, m.name, m.name, atomic.LoadUint64(m.n))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,38 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestFilterDirMetrics(t *testing.T) {
+	c := NewCounters()
+	sums, err := FilterDir("root", &Options{Recursive: true, Metrics: c, FileSystem: FS})
+	st := sums.Stats()
+
+	var buf bytes.Buffer
+	if err := c.WritePrometheus(&buf); err != nil {
+		t.Fatalf("WritePrometheus() = %v", err)
+	}
+	for _, want := range []string{
+		fmt.Sprintf("dedup_files_hashed_total %d\n", st.NumFiles),
+		fmt.Sprintf("dedup_bytes_read_total %d\n", st.BytesRead),
+		fmt.Sprintf("dedup_errors_total %d\n", len(err.(Errors))),
+		fmt.Sprintf("dedup_dups_total %d\n", st.NumDupFiles),
+		"# TYPE dedup_dups_total counter\n",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("WritePrometheus() wrote:\n%s\nwant it to contain %q", buf.String(), want)
+		}
+	}
+
+	// Counts accumulate across evaluations.
+	_, _ = FilterDir("root", &Options{Recursive: true, Metrics: c, FileSystem: FS})
+	buf.Reset()
+	_ = c.WritePrometheus(&buf)
+	if want := fmt.Sprintf("dedup_files_hashed_total %d\n", 2*st.NumFiles); !strings.Contains(buf.String(), want) {
+		t.Errorf("WritePrometheus() wrote:\n%s\nwant it to contain %q", buf.String(), want)
+	}
+}
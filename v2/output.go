@@ -0,0 +1,70 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+)
+
+// output writes the paths reported to UniqWriter and DupWriter. Under the
+// OutputBuffer option, paths are written by a goroutine of its own, so that a
+// slow writer, such as a pipe to a busy consumer, does not hold up workers
+// until OutputBuffer paths are waiting to be written.
+type output struct {
+	lines   chan outputLine // Paths waiting to be written, if buffered.
+	dropAt  int             // Number of paths waiting from which further paths are dropped, or 0 to wait.
+	dropped int
+	done    chan struct{} // Closed once every path buffered has been written.
+}
+
+type outputLine struct {
+	w    io.Writer
+	path string
+}
+
+// newOutput returns an *output buffering paths under the OutputBuffer and
+// OutputDropPercent options of opts.
+func newOutput(opts *Options) *output {
+	o := new(output)
+	n := opts.OutputBuffer
+	if n <= 0 || opts.UniqWriter == nil && opts.DupWriter == nil {
+		return o
+	}
+	o.lines = make(chan outputLine, n)
+	if p := opts.OutputDropPercent; p > 0 {
+		if o.dropAt = (n*p + 99) / 100; o.dropAt > n {
+			o.dropAt = n
+		}
+	}
+	o.done = make(chan struct{})
+	go func() {
+		defer close(o.done)
+		for l := range o.lines {
+			_, _ = fmt.Fprintln(l.w, l.path)
+		}
+	}()
+	return o
+}
+
+// println writes path to w, if not nil, followed by a newline, or buffers it
+// to be written, or drops it if too many paths are waiting.
+func (o *output) println(w io.Writer, path string) {
+	switch {
+	case w == nil:
+	case o.lines == nil:
+		_, _ = fmt.Fprintln(w, path)
+	case o.dropAt > 0 && len(o.lines) >= o.dropAt:
+		o.dropped++
+	default:
+		o.lines <- outputLine{w, path}
+	}
+}
+
+// close waits until every path buffered has been written, and returns the
+// number of paths dropped.
+func (o *output) close() int {
+	if o.lines != nil {
+		close(o.lines)
+		<-o.done
+	}
+	return o.dropped
+}
@@ -0,0 +1,60 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// slowWriter is an io.Writer that takes delay to write.
+type slowWriter struct {
+	mu    sync.Mutex
+	buf   bytes.Buffer
+	delay time.Duration
+}
+
+func (w *slowWriter) Write(b []byte) (int, error) {
+	time.Sleep(w.delay)
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return w.buf.Write(b)
+}
+
+func (w *slowWriter) lines() int {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	return strings.Count(w.buf.String(), "\n")
+}
+
+func TestFilterDirOutputBuffer(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 0; i < 20; i++ {
+		files[fmt.Sprintf("root/%02d", i)] = []byte(fmt.Sprint(i))
+	}
+	fs := filesys.Map(files, nil)
+
+	w := &slowWriter{delay: time.Millisecond}
+	sums, err := FilterDir("root", &Options{UniqWriter: w, OutputBuffer: 4, FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	if got := w.lines(); got != 20 {
+		t.Errorf("1: wrote %d paths; want 20", got)
+	}
+	if got := sums.Stats().OutputDropped; got != 0 {
+		t.Errorf("1: Stats().OutputDropped = %d; want 0", got)
+	}
+
+	// While the first path is held up in the writer, only one more may wait
+	// to be written: others are dropped.
+	w = &slowWriter{delay: 50 * time.Millisecond}
+	sums, err = FilterDir("root", &Options{UniqWriter: w, OutputBuffer: 1, OutputDropPercent: 100, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	dropped := sums.Stats().OutputDropped
+	if dropped == 0 || uint64(w.lines())+dropped != 20 {
+		t.Errorf("2: wrote %d paths and dropped %d; want some dropped, 20 in all", w.lines(), dropped)
+	}
+}
@@ -0,0 +1,19 @@
+//go:build !windows && !plan9
+// +build !windows,!plan9
+
+package dedup
+
+import (
+	"os"
+	"syscall"
+)
+
+// owner returns the user and group IDs of the owner of the file described by
+// info. ok will be false if info does not carry them.
+func owner(info os.FileInfo) (uid, gid int, ok bool) {
+	st, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return
+	}
+	return int(st.Uid), int(st.Gid), true
+}
@@ -0,0 +1,61 @@
+package dedup
+
+import (
+	"errors"
+	"path/filepath"
+	"strings"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// errRelPaths is returned when the RelPaths option is set and several paths
+// are given to FilterPaths.
+var errRelPaths = errors.New("dedup: RelPaths requires a single path")
+
+// absPaths returns paths made absolute, except for URLs.
+func absPaths(paths []string) ([]string, error) {
+	abs := make([]string, len(paths))
+	for i, p := range paths {
+		abs[i] = p
+		if !filesys.IsURL(p) {
+			var err error
+			if abs[i], err = filepath.Abs(p); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return abs, nil
+}
+
+// relRoot confines the evaluation under opts to root, the single path given
+// to FilterPaths under the RelPaths option, and returns the path of root in
+// the file system of opts then: "." for a directory, or the base name of a
+// file, whose directory the evaluation is then confined to.
+func relRoot(root string, opts *Options) string {
+	dir, path := root, "."
+	if info, _, err := lstat(opts.FileSystem, root, followAll); err == nil && !info.IsDir() {
+		if i := strings.LastIndex(root, "/"); filesys.IsURL(root) {
+			dir, path = root[:i], root[i+1:]
+		} else {
+			dir, path = filepath.Dir(root), filepath.Base(root)
+		}
+	}
+	opts.FileSystem = filesys.Dir(opts.FileSystem, dir)
+	return path
+}
+
+// absParser is an InputParser that makes the paths parsed by p absolute,
+// except for URLs, under the AbsPaths option.
+type absParser struct {
+	p InputParser
+}
+
+func (p absParser) ParseLine(line string) (string, bool) {
+	path, ok := p.p.ParseLine(line)
+	if ok && !filesys.IsURL(path) {
+		if abs, err := filepath.Abs(path); err == nil {
+			path = abs
+		}
+	}
+	return path, ok
+}
@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirAbsPaths(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a, b := filepath.Join(dir, "a"), filepath.Join(dir, "sub", "b")
+	if err := os.Mkdir(filepath.Dir(b), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, p := range []string{a, b} {
+		if err := ioutil.WriteFile(p, []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rel, err := filepath.Rel(wd, dir)
+	if err != nil {
+		t.Skip(err)
+	}
+	sum := sha1Sum([]byte("same"))
+
+	sums, err := FilterDir(filepath.Join(rel, "sub", ".."), &Options{Recursive: true, AbsPaths: true})
+	checkErrors(t, "1: ", err, nil)
+	checkSums(t, "1: ", sums, []string{dupString(sum, a, b)})
+
+	input := strings.Join([]string{filepath.Join(rel, "a"), filepath.Join(rel, "sub", ".", "b")}, "\n")
+	sums, err = Filter(strings.NewReader(input), &Options{AbsPaths: true})
+	checkErrors(t, "2: ", err, nil)
+	checkSums(t, "2: ", sums, []string{dupString(sum, a, b)})
+}
+
+func TestFilterDirRelPaths(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a":     []byte("same"),
+		"root/sub/b": []byte("same"),
+		"other/c":    []byte("same"),
+	}, nil)
+	sum := sha1Sum([]byte("same"))
+
+	sums, err := FilterDir("root", &Options{Recursive: true, RelPaths: true, AbsPaths: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	checkSums(t, "1: ", sums, []string{dupString(sum, "a", filepath.Join("sub", "b"))})
+
+	sums, err = FilterPaths([]string{"root/sub/b"}, &Options{RelPaths: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	if files, ok := sums.GetDigest(sum); !ok || len(files) != 1 || files[0].Path != "b" {
+		t.Errorf("2: Get() = %v, %v; want b", files, ok)
+	}
+
+	_, err = FilterPaths([]string{"root", "other"}, &Options{RelPaths: true, FileSystem: fs})
+	checkErrors(t, "3: ", err, []string{errRelPaths.Error()})
+}
@@ -0,0 +1,109 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"hash"
+	"io"
+	"io/ioutil"
+)
+
+// PhotoMatcher is a Matcher that computes the SHA1 checksum of each JPEG or
+// PNG image without its metadata, such as EXIF, XMP, IPTC, and comments, so
+// that the same photo saved by tools that only touched its metadata is
+// grouped with the original, while images whose pixels were encoded anew
+// are not, unlike with ImageMatcher. Other files, and images that cannot be
+// parsed, are grouped by the SHA1 checksum of their contents.
+type PhotoMatcher struct{}
+
+var _ Matcher = PhotoMatcher{}
+
+var (
+	jpegStart = []byte{0xff, 0xd8}
+	pngStart  = []byte("\x89PNG\r\n\x1a\n")
+)
+
+func (PhotoMatcher) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	ok := false
+	switch {
+	case bytes.HasPrefix(b, jpegStart):
+		ok = hashJPEG(h, b)
+	case bytes.HasPrefix(b, pngStart):
+		ok = hashPNG(h, b)
+	}
+	if !ok {
+		h.Reset()
+		_, _ = h.Write(b)
+	}
+	return Digest(h.Sum(nil)), nil
+}
+
+// hashJPEG writes the JPEG image b to h, leaving out the APP1 segments, which
+// hold EXIF and XMP metadata, the APP13 segments, which hold IPTC metadata,
+// and comments, until the start of the compressed image data, which is
+// written in full. It reports whether b could be parsed.
+func hashJPEG(h hash.Hash, b []byte) bool {
+	_, _ = h.Write(jpegStart)
+	for i := len(jpegStart); ; {
+		for i < len(b) && b[i] == 0xff && i+1 < len(b) && b[i+1] == 0xff {
+			i++ // Fill bytes.
+		}
+		if i+4 > len(b) || b[i] != 0xff {
+			return false
+		}
+		marker := b[i+1]
+		n := 2 + int(binary.BigEndian.Uint16(b[i+2:]))
+		if n < 4 || i+n > len(b) {
+			return false
+		}
+		switch marker {
+		case 0xe1, 0xed, 0xfe: // APP1, APP13, COM.
+		case 0xda: // SOS.
+			_, _ = h.Write(b[i:])
+			return true
+		default:
+			_, _ = h.Write(b[i : i+n])
+		}
+		i += n
+	}
+}
+
+// pngMetadata holds the types of the PNG chunks that hashPNG leaves out.
+var pngMetadata = map[string]bool{
+	"tEXt": true,
+	"zTXt": true,
+	"iTXt": true,
+	"eXIf": true,
+	"tIME": true,
+}
+
+// hashPNG writes the PNG image b to h, leaving out the chunks holding text,
+// including XMP metadata, EXIF metadata, and the time of the last change. It
+// reports whether b could be parsed.
+func hashPNG(h hash.Hash, b []byte) bool {
+	_, _ = h.Write(pngStart)
+	for i := len(pngStart); i < len(b); {
+		if i+8 > len(b) {
+			return false
+		}
+		n := 12 + int(binary.BigEndian.Uint32(b[i:]))
+		if n < 12 || i+n > len(b) {
+			return false
+		}
+		if !pngMetadata[string(b[i+4:i+8])] {
+			_, _ = h.Write(b[i : i+n])
+		}
+		i += n
+	}
+	return true
+}
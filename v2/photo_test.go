@@ -0,0 +1,67 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"hash/crc32"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// withJPEGSegment returns the JPEG image b with a segment inserted after its
+// start marker.
+func withJPEGSegment(b []byte, marker byte, data string) []byte {
+	seg := []byte{0xff, marker, 0, 0}
+	binary.BigEndian.PutUint16(seg[2:], uint16(2+len(data)))
+	seg = append(seg, data...)
+	return append(append(append([]byte(nil), b[:2]...), seg...), b[2:]...)
+}
+
+// withPNGChunk returns the PNG image b with a chunk inserted after its
+// header chunk.
+func withPNGChunk(b []byte, typ, data string) []byte {
+	chunk := make([]byte, 4, 12+len(data))
+	binary.BigEndian.PutUint32(chunk, uint32(len(data)))
+	chunk = append(append(chunk, typ...), data...)
+	chunk = append(chunk, 0, 0, 0, 0)
+	binary.BigEndian.PutUint32(chunk[len(chunk)-4:], crc32.ChecksumIEEE(chunk[4:len(chunk)-4]))
+	const after = 8 + 12 + 13 // Signature and IHDR.
+	return append(append(append([]byte(nil), b[:after]...), chunk...), b[after:]...)
+}
+
+func TestPhotoMatcher(t *testing.T) {
+	jpg := encodeImage(t, testImage(64, 48, false), "jpeg")
+	png := encodeImage(t, testImage(64, 48, false), "png")
+	fs := filesys.Map(map[string][]byte{
+		"root/a.jpg":    jpg,
+		"root/b.jpg":    withJPEGSegment(jpg, 0xe1, "Exif\x00\x00fake"),
+		"root/c.jpg":    withJPEGSegment(withJPEGSegment(jpg, 0xfe, "comment"), 0xe1, "http://ns.adobe.com/xap/1.0/\x00<x/>"),
+		"root/d.jpg":    encodeImage(t, testImage(64, 48, true), "jpeg"),
+		"root/a.png":    png,
+		"root/b.png":    withPNGChunk(png, "tEXt", "Software\x00editor"),
+		"root/c.png":    withPNGChunk(png, "sRGB", "\x00"),
+		"root/text.txt": []byte("not an image"),
+		"root/bad.jpg":  append(append([]byte(nil), jpegStart...), 0xff),
+	}, nil)
+
+	sums, err := FilterDir("root", &Options{Matcher: PhotoMatcher{}, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	var groups []string
+	for _, g := range sums.DupGroups() {
+		var paths []string
+		for _, file := range g.Files {
+			paths = append(paths, file.Path)
+		}
+		groups = append(groups, strings.Join(paths, " "))
+	}
+	sort.Strings(groups)
+	if want := []string{"root/a.jpg root/b.jpg root/c.jpg", "root/a.png root/b.png"}; !reflect.DeepEqual(groups, want) {
+		t.Errorf("DupGroups() = %q; want %q", groups, want)
+	}
+	if got := sums.Stats().NumFiles; got != 9 {
+		t.Errorf("NumFiles = %d; want 9", got)
+	}
+}
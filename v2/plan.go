@@ -0,0 +1,277 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/rand"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// Operations that a Step may perform on a duplicate file.
+const (
+	OpDelete  = "delete"  // Remove the file.
+	OpLink    = "link"    // Replace the file with a hard link to the copy kept.
+	OpSymlink = "symlink" // Replace the file with a symbolic link to the copy kept.
+)
+
+// Policy configures the Plan returned by Sums.Plan.
+type Policy struct {
+	Op   string                    // OpDelete, OpLink, or OpSymlink.
+	Keep func(files []*File) *File // Choose the file kept in each group; KeepFirst if nil.
+}
+
+// KeepFirst returns the file whose path sorts first.
+func KeepFirst(files []*File) *File {
+	return keepBy(files, func(a, b *File) bool { return false })
+}
+
+// KeepOldest returns the file modified least recently, or the file whose path
+// sorts first among those modified at the same time.
+func KeepOldest(files []*File) *File {
+	return keepBy(files, func(a, b *File) bool { return a.Info.ModTime().Before(b.Info.ModTime()) })
+}
+
+// KeepNewest returns the file modified most recently, or the file whose path
+// sorts first among those modified at the same time.
+func KeepNewest(files []*File) *File {
+	return keepBy(files, func(a, b *File) bool { return a.Info.ModTime().After(b.Info.ModTime()) })
+}
+
+// keepBy returns the first file in files according to less, breaking ties by
+// path.
+func keepBy(files []*File, less func(a, b *File) bool) *File {
+	var keep *File
+	for _, file := range files {
+		if keep == nil || less(file, keep) || !less(keep, file) && file.Path < keep.Path {
+			keep = file
+		}
+	}
+	return keep
+}
+
+// Plan lists the steps that dispose of duplicate files, as returned by
+// Sums.Plan. It may be saved with WriteJSON, reviewed, and read back with
+// ReadPlan before it is applied.
+type Plan struct {
+	Steps     []Step `json:"steps"`
+	Reclaimed uint64 `json:"reclaimed"` // Bytes freed by applying every step.
+}
+
+// Step is an operation planned on a duplicate file.
+type Step struct {
+	Op      string    `json:"op"`    // OpDelete, OpLink, or OpSymlink.
+	Path    string    `json:"path"`  // Duplicate file to operate on.
+	Keep    string    `json:"keep"`  // Copy of the file that is kept.
+	Sum     string    `json:"sum"`   // Hex-encoded checksum of both files.
+	Size    int64     `json:"size"`  // Size of Path when the step was planned.
+	ModTime time.Time `json:"mtime"` // Modification time of Path when the step was planned.
+}
+
+// Plan returns the steps that dispose of the duplicates in each group of files
+// with the same checksum in s according to policy, keeping one file per
+// group. Files that are not in the local file system, and files that are
+// already hard links to the file kept, are left alone. Steps are sorted by
+// path. Groups formed by a Matcher other than the default may hold files that
+// differ, whose steps are refused when applied.
+func (s *Sums) Plan(policy Policy) *Plan {
+	keepFunc := policy.Keep
+	if keepFunc == nil {
+		keepFunc = KeepFirst
+	}
+	p := &Plan{Steps: []Step{}}
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		var local []*File
+		for _, file := range files {
+			if localRegular(file) {
+				local = append(local, file)
+			}
+		}
+		if len(local) < 2 {
+			return true
+		}
+		for _, st := range groupSteps(policy.Op, sum, keepFunc(local), local) {
+			p.Steps = append(p.Steps, st)
+			p.Reclaimed += uint64(st.Size)
+		}
+		return true
+	})
+	sort.Slice(p.Steps, func(i, j int) bool { return p.Steps[i].Path < p.Steps[j].Path })
+	return p
+}
+
+// isLocal reports whether pth names a file in the local file system, rather
+// than a URL or a member of an archive.
+func isLocal(pth string) bool {
+	if filesys.IsURL(pth) {
+		return false
+	}
+	i := strings.Index(pth, filesys.ArchiveSep+string(filepath.Separator))
+	return i < 0 || !filesys.IsArchive(pth[:i])
+}
+
+// WriteJSON writes p to w as an indented JSON document.
+func (p *Plan) WriteJSON(w io.Writer) error {
+	b, err := json.MarshalIndent(p, "", "\t")
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(b, '\n'))
+	return err
+}
+
+// WriteText writes p to w in the following format:
+//
+//	delete "/path/to/file2" (copy of "/path/to/file1")
+//	...
+func (p *Plan) WriteText(w io.Writer) error {
+	for _, st := range p.Steps {
+		if _, err := fmt.Fprintf(w, "%s %q (copy of %q)\n", st.Op, st.Path, st.Keep); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// ReadPlan reads a plan written by Plan.WriteJSON from r.
+func ReadPlan(r io.Reader) (*Plan, error) {
+	p := new(Plan)
+	if err := json.NewDecoder(r).Decode(p); err != nil {
+		return nil, fmt.Errorf("dedup: reading plan: %w", err)
+	}
+	for _, st := range p.Steps {
+		if st.Op != OpDelete && st.Op != OpLink && st.Op != OpSymlink {
+			return nil, fmt.Errorf("dedup: reading plan: unknown op %q for %q", st.Op, st.Path)
+		}
+	}
+	return p, nil
+}
+
+// Apply applies every step in p, continuing past steps that fail. If err is
+// non-nil, its type will be Errors.
+func (p *Plan) Apply() error {
+	var errs Errors
+	for _, st := range p.Steps {
+		if err := st.Apply(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Apply performs st, provided that the file kept still exists with the same
+// contents as the duplicate, and that the duplicate has not been modified
+// since st was planned. A link is created under an unused name next to the
+// duplicate and renamed over it, so that the duplicate's path is never
+// missing. Symbolic links point to the absolute path of the file kept.
+func (st Step) Apply() error {
+	if err := st.check(); err != nil {
+		return err
+	}
+	switch st.Op {
+	case OpDelete:
+		return os.Remove(st.Path)
+	case OpLink:
+		return st.replace(func(tmp string) error { return os.Link(st.Keep, tmp) })
+	case OpSymlink:
+		target, err := filepath.Abs(st.Keep)
+		if err != nil {
+			return err
+		}
+		return st.replace(func(tmp string) error { return os.Symlink(target, tmp) })
+	}
+	return fmt.Errorf("dedup: %s: unknown op %q", st.Path, st.Op)
+}
+
+// replace calls link to create a link next to the duplicate of st, under a
+// name that no file has, as os.CreateTemp picks, then renames the link over
+// the duplicate.
+func (st Step) replace(link func(tmp string) error) error {
+	prefix := filepath.Join(filepath.Dir(st.Path), ".dedup-"+filepath.Base(st.Path)+"-")
+	var tmp string
+	for i := 0; ; i++ {
+		tmp = prefix + strconv.FormatUint(uint64(rand.Uint32()), 10)
+		err := link(tmp)
+		if err == nil {
+			break
+		} else if !os.IsExist(err) || i == 10000 {
+			return err
+		}
+	}
+	if err := os.Rename(tmp, st.Path); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return nil
+}
+
+// check returns an error unless the file kept by st still exists with the
+// same contents as the duplicate, and the duplicate has not been modified
+// since st was planned. The contents are compared byte for byte, so that
+// steps planned from files grouped by a Matcher other than the default, or
+// from an index gone stale, fail rather than lose data.
+func (st Step) check() error {
+	if st.Path == st.Keep {
+		return fmt.Errorf("dedup: %s: file to keep is the duplicate itself", st.Path)
+	}
+	if _, err := os.Stat(st.Keep); err != nil {
+		return err
+	}
+	info, err := os.Lstat(st.Path)
+	if err != nil {
+		return err
+	}
+	if !info.Mode().IsRegular() || info.Size() != st.Size || !info.ModTime().Equal(st.ModTime) {
+		return fmt.Errorf("dedup: %s: changed since it was planned", st.Path)
+	}
+	same, err := sameContents(st.Keep, st.Path)
+	if err != nil {
+		return err
+	}
+	if !same {
+		return fmt.Errorf("dedup: %s: contents differ from %s", st.Path, st.Keep)
+	}
+	return nil
+}
+
+// sameContents reports whether the files located at a and b hold the same
+// bytes.
+func sameContents(a, b string) (bool, error) {
+	fa, err := os.Open(a)
+	if err != nil {
+		return false, err
+	}
+	defer fa.Close()
+	fb, err := os.Open(b)
+	if err != nil {
+		return false, err
+	}
+	defer fb.Close()
+	bufA, bufB := make([]byte, 32*1024), make([]byte, 32*1024)
+	for {
+		na, errA := io.ReadFull(fa, bufA)
+		nb, errB := io.ReadFull(fb, bufB)
+		if !bytes.Equal(bufA[:na], bufB[:nb]) {
+			return false, nil
+		}
+		for _, err := range []error{errA, errB} {
+			if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+				return false, err
+			}
+		}
+		if errA != nil || errB != nil {
+			return errA != nil && errB != nil, nil
+		}
+	}
+}
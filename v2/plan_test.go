@@ -0,0 +1,141 @@
+package dedup
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPlan(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for name, contents := range map[string]string{
+		"a": "same", "b": "same", "c": "same", "d": "other",
+	} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sums, err := FilterDir(root, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := sums.Plan(Policy{Op: OpDelete})
+	var paths []string
+	for _, st := range plan.Steps {
+		if st.Op != OpDelete || st.Keep != filepath.Join(root, "a") {
+			t.Errorf("step = %+v; want deletion keeping a", st)
+		}
+		paths = append(paths, filepath.Base(st.Path))
+	}
+	if want := []string{"b", "c"}; !reflect.DeepEqual(paths, want) {
+		t.Errorf("planned %v; want %v", paths, want)
+	}
+	if plan.Reclaimed != 8 {
+		t.Errorf("Reclaimed = %d; want 8", plan.Reclaimed)
+	}
+
+	var buf bytes.Buffer
+	if err := plan.WriteJSON(&buf); err != nil {
+		t.Fatal(err)
+	}
+	read, err := ReadPlan(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(read.Steps) != 2 || !read.Steps[0].ModTime.Equal(plan.Steps[0].ModTime) {
+		t.Fatalf("ReadPlan() = %+v; want %+v", read, plan)
+	}
+
+	// Steps for files modified since the plan was made are not applied.
+	if err := ioutil.WriteFile(filepath.Join(root, "c"), []byte("changed"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	err = read.Apply()
+	if errs, ok := err.(Errors); !ok || len(errs) != 1 || !strings.Contains(errs[0].Error(), "changed") {
+		t.Errorf("Apply() = %v; want error for c", err)
+	}
+	for name, want := range map[string]bool{"a": true, "b": false, "c": true} {
+		if _, err := os.Stat(filepath.Join(root, name)); (err == nil) != want {
+			t.Errorf("%s exists = %v; want %v", name, err == nil, want)
+		}
+	}
+}
+
+func TestKeepPolicies(t *testing.T) {
+	file := func(path string, mtime int64) *File {
+		return &File{Path: path, Info: &indexInfo{indexFile{Path: path, ModTime: time.Unix(mtime, 0)}}}
+	}
+	files := []*File{file("/b", 2), file("/a", 2), file("/c", 1), file("/d", 3)}
+	for _, tc := range []struct {
+		name string
+		keep func([]*File) *File
+		want string
+	}{
+		{"KeepFirst", KeepFirst, "/a"},
+		{"KeepOldest", KeepOldest, "/c"},
+		{"KeepNewest", KeepNewest, "/d"},
+	} {
+		if got := tc.keep(files).Path; got != tc.want {
+			t.Errorf("%s() = %s; want %s", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestStepApply(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	write := func(name, contents string) Step {
+		pth := filepath.Join(root, name)
+		if err := ioutil.WriteFile(pth, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+		info, err := os.Lstat(pth)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return Step{Op: OpLink, Path: pth, Keep: filepath.Join(root, "keep"), Size: info.Size(), ModTime: info.ModTime()}
+	}
+	write("keep", "same")
+
+	// Steps whose files differ, as when planned from files grouped by their
+	// names and sizes, are not applied.
+	st := write("other", "diff")
+	if err := st.Apply(); err == nil || !strings.Contains(err.Error(), "contents differ") {
+		t.Errorf("Apply() = %v; want error for differing contents", err)
+	}
+	if b, _ := ioutil.ReadFile(st.Path); string(b) != "diff" {
+		t.Errorf("%s holds %q after Apply; want %q", st.Path, b, "diff")
+	}
+
+	// A file left where the link would be created is not in the way.
+	st = write("dup", "same")
+	write(".dedup-dup", "left")
+	if err := st.Apply(); err != nil {
+		t.Fatal(err)
+	}
+	keep, _ := os.Stat(st.Keep)
+	dup, _ := os.Stat(st.Path)
+	if !os.SameFile(keep, dup) {
+		t.Errorf("%s is not a link to %s", st.Path, st.Keep)
+	}
+	if b, _ := ioutil.ReadFile(filepath.Join(root, ".dedup-dup")); string(b) != "left" {
+		t.Errorf(".dedup-dup holds %q; want %q", b, "left")
+	}
+	names, _ := filepath.Glob(filepath.Join(root, ".dedup-dup-*"))
+	if len(names) != 0 {
+		t.Errorf("Apply left %v", names)
+	}
+}
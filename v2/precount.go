@@ -0,0 +1,77 @@
+package dedup
+
+import "sync"
+
+// precount lists the files located at roots as FilterPaths evaluates them,
+// without reading their contents, and returns the number of files of each
+// size. ok will be false if Options.Cancel was closed meanwhile. Errors are
+// not reported, since the evaluation that follows encounters them again.
+func precount(roots []string, opts *Options) (sizes map[int64]int, ok bool) {
+	r := newDirReader(roots, opts.procs(ratioMaxProcs(1, 4)), opts)
+	r.Start()
+	go func() {
+		for range r.err {
+		}
+	}()
+
+	var mu sync.Mutex
+	sizes = make(map[int64]int)
+	var wg sync.WaitGroup
+	numProcs := opts.procs(ratioMaxProcs(3, 4))
+	wg.Add(numProcs)
+	for i := 0; i < numProcs; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range r.out {
+				if !opts.matches(file.path) {
+					continue
+				}
+				info := file.info
+				if info == nil {
+					var err error
+					if info, _, err = opts.lstat(file.path); err != nil {
+						continue
+					}
+				}
+				if info.IsDir() || isSpecial(info) && !opts.IncludeSpecial {
+					continue
+				}
+				mu.Lock()
+				sizes[info.Size()]++
+				mu.Unlock()
+			}
+		}()
+	}
+	done := make(chan struct{})
+	go func() {
+		wg.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return sizes, true
+	case <-opts.Cancel:
+		r.Cancel()
+		<-done
+		return nil, false
+	}
+}
+
+// precounted configures f to skip the files whose sizes are unique among
+// sizes, as returned by precount, since they cannot have duplicates. Files
+// are not skipped if a Matcher is set, since it may group files of different
+// sizes, or if Canonical is set. It returns the total size of the files that
+// remain to be read.
+func (f *chanFilter) precounted(sizes map[int64]int) (total uint64) {
+	prefilter := f.opts.Matcher == nil && f.opts.Canonical == nil
+	if prefilter {
+		f.sizes = sizes
+	}
+	for size, n := range sizes {
+		if n > 1 || !prefilter {
+			total += uint64(size) * uint64(n)
+		}
+	}
+	return total
+}
@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirPrecount(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a":     []byte("12345"),
+		"root/b":     []byte("abcde"), // Same size as root/a.
+		"root/c":     []byte("xyz"),   // Unique size: skipped.
+		"root/d/dup": Dup1,
+		"root/e/dup": Dup1,
+	}, nil)
+
+	p := NewProgress()
+	sums, err := FilterDir("root", &Options{Recursive: true, Precount: true, Progress: p, FileSystem: fs})
+	checkErrors(t, "", err, nil)
+	checkSums(t, "", sums, []string{
+		dupString(Dup1Sum, "root/d/dup", "root/e/dup"),
+	})
+	st := sums.Stats()
+	if st.NumFiles != 4 || st.FilesSkipped != 1 || st.BytesRead != st.NumBytes {
+		t.Errorf("Stats() = %+v; want 4 files read, 1 skipped", st)
+	}
+	if _, ok := sums.GetDigest(sha1Sum([]byte("xyz"))); ok {
+		t.Error("root/c was evaluated; want it skipped")
+	}
+	snap := p.StatsSnapshot()
+	if want := uint64(2*5 + 2*len(Dup1)); snap.TotalBytes != want || snap.Percent != 100 {
+		t.Errorf("StatsSnapshot() = %+v; want TotalBytes %d, Percent 100", snap, want)
+	}
+
+	// Size-matching files are not skipped with a Matcher, which may group
+	// files of different sizes.
+	sums, _ = FilterDir("root", &Options{Recursive: true, Precount: true, Matcher: ETagMatcher{}, FileSystem: fs})
+	if st := sums.Stats(); st.NumFiles != 5 || st.FilesSkipped != 0 {
+		t.Errorf("with Matcher: Stats() = %+v; want 5 files, none skipped", st)
+	}
+}
@@ -0,0 +1,224 @@
+package dedup
+
+import (
+	"errors"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// Priority selects the files that FilterDir and FilterPaths evaluate first
+// under Options.Priority, so that the duplicates that waste the most space
+// are found early when the evaluation may not finish, such as under
+// ExitOnDup, MaxFiles, or MaxTotalBytes. Files are then evaluated in the
+// order of Dirs, then of size if LargestFirst is set, and then of path.
+type Priority struct {
+	// LargestFirst, if true, makes files be evaluated from the largest to
+	// the smallest.
+	LargestFirst bool
+
+	// Dirs, if not empty, lists directories whose files are evaluated
+	// before those of the directories that follow them, and before all
+	// other files. Dirs are matched against the paths of files as listed,
+	// so should be written as the paths given to FilterPaths are, such as
+	// below one of them.
+	Dirs []string
+}
+
+// enabled reports whether p selects an order other than that of listing.
+func (p Priority) enabled() bool {
+	return p.LargestFirst || len(p.Dirs) > 0
+}
+
+// rank returns the position among p.Dirs of the directory that the file
+// located at path lies within, or len(p.Dirs) if none.
+func (p Priority) rank(path string) int {
+	for i, dir := range p.Dirs {
+		if dir = filepath.Clean(dir); path == dir || within(dir, path) {
+			return i
+		}
+	}
+	return len(p.Dirs)
+}
+
+// errPriorityState is returned for Options that set both StatePath and
+// Priority, as evaluating files out of the order they are listed in leaves
+// no position in the listing to resume from.
+var errPriorityState = errors.New("dedup: StatePath is not supported with Priority")
+
+// filterPriority evaluates the files located at roots as FilterPaths does
+// under the Priority option.
+func filterPriority(roots []string, opts *Options) (*Sums, error) {
+	if opts.StatePath != "" {
+		return nil, Errors{errPriorityState}
+	}
+	p := newPriorityFilter(roots, opts)
+	if err := spillSums(p, opts); err != nil {
+		return nil, Errors{err}
+	}
+	return run(p, opts)
+}
+
+// priorityFilter is an implementation of the filter interface for FilterPaths
+// under the Priority option. It lists every file located at its roots and stats
+// it, as precount does, then sorts the files by Options.Priority and passes
+// them on to a chanFilter, which it only starts then. Files that are excluded
+// or cannot be stat'ed are passed on first, so that the chanFilter reports them
+// as such.
+type priorityFilter struct {
+	opts *Options
+	r    *dirReader
+	f    *chanFilter
+	in   chan listedFile // Input of f.
+	errs <-chan error    // Outgoing errors, from f and r.
+	stop *signal         // Signal to stop listing and feeding f.
+	done chan struct{}   // Closed once feeding f is done.
+}
+
+var _ filter = (*priorityFilter)(nil)
+
+func newPriorityFilter(roots []string, opts *Options) *priorityFilter {
+	p := &priorityFilter{opts: opts}
+	p.in = make(chan listedFile)
+	p.f = newChanFilter(p.in, opts.procs(ratioMaxProcs(3, 4)), opts)
+	p.f.listed = true
+	p.r = newDirReader(roots, opts.procs(ratioMaxProcs(1, 4)), opts)
+	p.r.sums = p.f.sums
+	p.errs = mergeErrors(p.f.cancel.C(), p.r.err, p.f.err)
+	p.stop = newSignal()
+	p.done = make(chan struct{})
+	return p
+}
+
+func (p *priorityFilter) Uniq() <-chan Result { return p.f.Uniq() }
+
+func (p *priorityFilter) Dup() <-chan Result { return p.f.Dup() }
+
+func (p *priorityFilter) Err() <-chan error { return p.errs }
+
+func (p *priorityFilter) Sums() *Sums { return p.f.Sums() }
+
+// Start begins listing the files located at the roots of p. Its chanFilter
+// starts once they are all listed. Not to be called more than once on the
+// same instance.
+func (p *priorityFilter) Start() {
+	go p.feed()
+}
+
+// Drain stops listing files and passing them on, and drains the chanFilter
+// managed by p.
+func (p *priorityFilter) Drain() {
+	p.f.Drain()
+	p.stop.Once()
+	p.r.Cancel()
+}
+
+// Cancel stops listing files and interrupts the chanFilter managed by p, and
+// waits for both to return.
+func (p *priorityFilter) Cancel() {
+	p.stop.Once()
+	p.r.Cancel()
+	<-p.done
+	p.f.Cancel()
+}
+
+// prioritized is a file listed by a priorityFilter.
+type prioritized struct {
+	file listedFile
+	rank int // Position among Priority.Dirs, or -1 to be passed on first.
+}
+
+// feed lists the files located at the roots of p, then starts its chanFilter
+// and passes them on to it in order.
+func (p *priorityFilter) feed() {
+	defer close(p.done)
+	defer close(p.in)
+
+	files := p.list()
+	if p.opts.Precount || p.opts.SamplePercent > 0 {
+		sizes := make(map[int64]int)
+		for _, file := range files {
+			if info := file.file.info; info != nil && !isSpecial(info) {
+				sizes[info.Size()]++
+			}
+		}
+		var total uint64
+		if p.opts.SamplePercent > 0 {
+			total = p.f.sampled(sizes)
+		} else {
+			total = p.f.precounted(sizes)
+		}
+		if p.opts.Progress != nil {
+			p.opts.Progress.SetTotal(total)
+		}
+	}
+	// The chanFilter is started even if p was stopped, so that its outputs
+	// are closed.
+	p.f.Start()
+
+	largest := p.opts.Priority.LargestFirst
+	sort.SliceStable(files, func(i, j int) bool {
+		a, b := files[i], files[j]
+		if a.rank != b.rank || a.rank < 0 {
+			return a.rank < b.rank
+		}
+		if sa, sb := a.file.info.Size(), b.file.info.Size(); largest && sa != sb {
+			return sa > sb
+		}
+		return a.file.path < b.file.path
+	})
+	for _, file := range files {
+		select {
+		case <-p.stop.C():
+			return
+		case p.in <- file.file:
+		}
+	}
+}
+
+// list lists and stats the files located at the roots of p, stopping early
+// if p is stopped.
+func (p *priorityFilter) list() []prioritized {
+	p.r.Start()
+	finished := make(chan struct{})
+	go func() {
+		select {
+		case <-p.stop.C():
+			p.r.Cancel()
+		case <-finished:
+		}
+	}()
+	defer close(finished)
+
+	var mu sync.Mutex
+	var files []prioritized
+	var wg sync.WaitGroup
+	numProcs := p.opts.procs(ratioMaxProcs(3, 4))
+	wg.Add(numProcs)
+	for i := 0; i < numProcs; i++ {
+		go func() {
+			defer wg.Done()
+			for file := range p.r.out {
+				f := prioritized{file: file, rank: -1}
+				if p.opts.matches(file.path) {
+					if file.info == nil {
+						if info, path, err := p.opts.lstat(file.path); err == nil {
+							f.file = listed(file.path, path, info)
+						}
+					}
+					if f.file.info != nil {
+						if f.file.info.IsDir() {
+							continue
+						}
+						f.rank = p.opts.Priority.rank(f.file.path)
+					}
+				}
+				mu.Lock()
+				files = append(files, f)
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+	return files
+}
@@ -0,0 +1,47 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"strconv"
+	"syscall"
+)
+
+// The scheduling and I/O priorities set by lowerPriority, as by
+// "nice -n 19 ionice -c 2 -n 7".
+const (
+	lowNice          = 19
+	ioprioClassBE    = 2  // Best-effort I/O scheduling class.
+	ioprioClassShift = 13 // Bits of the I/O priority holding its class.
+	lowIOPrio        = ioprioClassBE<<ioprioClassShift | 7
+	ioprioWhoProcess = 1
+)
+
+// lowerPriorityRuns is the greatest number of times that lowerPriority scans
+// the threads of the process for threads created meanwhile.
+const lowerPriorityRuns = 3
+
+// lowerPriority lowers the scheduling and I/O priorities of the current
+// process. On Linux both apply to individual threads, so they are set for
+// every thread of the process; threads created later inherit them.
+func lowerPriority() {
+	done := make(map[int]bool)
+	for i := 0; i < lowerPriorityRuns; i++ {
+		infos, err := ioutil.ReadDir("/proc/self/task")
+		if err != nil {
+			return
+		}
+		more := false
+		for _, info := range infos {
+			tid, err := strconv.Atoi(info.Name())
+			if err != nil || done[tid] {
+				continue
+			}
+			done[tid], more = true, true
+			_ = syscall.Setpriority(syscall.PRIO_PROCESS, tid, lowNice)
+			_, _, _ = syscall.Syscall(syscall.SYS_IOPRIO_SET, ioprioWhoProcess, uintptr(tid), lowIOPrio)
+		}
+		if !more {
+			return
+		}
+	}
+}
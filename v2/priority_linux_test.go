@@ -0,0 +1,38 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+)
+
+func TestLowerPriority(t *testing.T) {
+	lowerPriority()
+	tasks, err := filepath.Glob("/proc/self/task/*")
+	if err != nil || len(tasks) == 0 {
+		t.Fatalf("listing threads: %v", err)
+	}
+	for _, task := range tasks {
+		b, err := ioutil.ReadFile(filepath.Join(task, "stat"))
+		if err != nil {
+			continue // The thread exited.
+		}
+		// The nice value is the 19th field; the 2nd, the command name, is
+		// parenthesized and may contain spaces.
+		fields := strings.Fields(string(b[strings.LastIndexByte(string(b), ')')+1:]))
+		if nice := fields[16]; nice != "19" {
+			t.Errorf("%s: nice = %s; want 19", task, nice)
+		}
+	}
+	prio, _, errno := syscall.Syscall(syscall.SYS_IOPRIO_GET, ioprioWhoProcess, 0, 0)
+	if errno == 0 && prio != lowIOPrio {
+		t.Errorf("I/O priority = %#x; want %#x", prio, lowIOPrio)
+	}
+
+	opts := &Options{LowPriority: true}
+	if n := opts.procs(8); n != lowPriorityProcs {
+		t.Errorf("procs(8) = %d; want %d", n, lowPriorityProcs)
+	}
+}
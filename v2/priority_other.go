@@ -0,0 +1,8 @@
+//go:build !linux
+// +build !linux
+
+package dedup
+
+// lowerPriority has no effect: lowering the priority of the process is only
+// supported on Linux.
+func lowerPriority() {}
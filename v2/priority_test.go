@@ -0,0 +1,55 @@
+package dedup
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirPriority(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/a/small": []byte("1"),
+		"root/a/large": []byte("1234567890"),
+		"root/b/small": []byte("1"),
+		"root/b/mid":   []byte("12345"),
+		"root/c/large": []byte("1234567890"),
+	}, nil)
+	for _, tt := range []struct {
+		priority Priority
+		want     []string
+	}{
+		{Priority{LargestFirst: true}, []string{"root/a/large", "root/c/large", "root/b/mid", "root/a/small", "root/b/small"}},
+		{Priority{Dirs: []string{"root/c", "root/b/"}}, []string{"root/c/large", "root/b/mid", "root/b/small", "root/a/large", "root/a/small"}},
+		{Priority{LargestFirst: true, Dirs: []string{"root/b"}}, []string{"root/b/mid", "root/b/small", "root/a/large", "root/c/large", "root/a/small"}},
+	} {
+		// One file at a time, so that the Stat stage sees files in the order
+		// they are evaluated in.
+		var got []string
+		stat := StageFunc(func(r *Result) error {
+			got = append(got, r.Path)
+			return nil
+		})
+		sums, err := FilterDir("root", &Options{Recursive: true, Priority: tt.priority, LowPriority: true, Stages: &Stages{Stat: []Stage{stat}}, FileSystem: fs})
+		checkErrors(t, "", err, nil)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%+v: evaluated %q; want %q", tt.priority, got, tt.want)
+		}
+		if st := sums.Stats(); st.NumFiles != 5 || st.NumDupFiles != 2 {
+			t.Errorf("%+v: Stats() = %+v; want 5 files, 2 duplicates", tt.priority, st)
+		}
+	}
+
+	// The largest duplicates are found first.
+	sums, _ := FilterDir("root", &Options{Recursive: true, Priority: Priority{LargestFirst: true}, ExitOnDup: true, LowPriority: true, FileSystem: fs})
+	checkSums(t, "ExitOnDup: ", sums, []string{
+		dupString(sha1Sum([]byte("1234567890")), "root/a/large", "root/c/large"),
+	})
+
+	// Errors are reported as without Priority.
+	_, want := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	_, err := FilterDir("root", &Options{Recursive: true, Priority: Priority{LargestFirst: true}, FileSystem: FS})
+	if len(err.(Errors)) != len(want.(Errors)) {
+		t.Errorf("FilterDir() = %v; want %v", err, want)
+	}
+}
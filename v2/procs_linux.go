@@ -0,0 +1,71 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// cgroupCPULimit returns the number of CPUs the current process may use
+// according to its cgroup CPU quota, rounded up, reading cgroup files below
+// root (normally "/"). Both cgroup v2 (cpu.max) and v1 (cpu.cfs_quota_us and
+// cpu.cfs_period_us) are supported. ok will be false if no quota applies.
+func cgroupCPULimit(root string) (n int, ok bool) {
+	if b, err := ioutil.ReadFile(filepath.Join(root, "sys/fs/cgroup/cpu.max")); err == nil {
+		fields := strings.Fields(string(b))
+		if len(fields) != 2 || fields[0] == "max" {
+			return 0, false
+		}
+		return quotaCPUs(fields[0], fields[1])
+	}
+	quota, err := ioutil.ReadFile(filepath.Join(root, "sys/fs/cgroup/cpu/cpu.cfs_quota_us"))
+	if err != nil {
+		return 0, false
+	}
+	period, err := ioutil.ReadFile(filepath.Join(root, "sys/fs/cgroup/cpu/cpu.cfs_period_us"))
+	if err != nil {
+		return 0, false
+	}
+	return quotaCPUs(strings.TrimSpace(string(quota)), strings.TrimSpace(string(period)))
+}
+
+// quotaCPUs returns quota/period rounded up. ok will be false if either is
+// not a positive integer.
+func quotaCPUs(quota, period string) (n int, ok bool) {
+	q, err := strconv.ParseInt(quota, 10, 64)
+	if err != nil || q <= 0 {
+		return 0, false
+	}
+	p, err := strconv.ParseInt(period, 10, 64)
+	if err != nil || p <= 0 {
+		return 0, false
+	}
+	return int((q + p - 1) / p), true
+}
+
+// rotational reports whether the file described by info resides on a
+// rotational block device, such as a hard disk drive, according to sysfs
+// below root (normally "/").
+func rotational(root string, info os.FileInfo) bool {
+	dev, ok := device(info)
+	if !ok {
+		return false
+	}
+	major := (dev>>8)&0xfff | (dev>>32)&^0xfff
+	minor := dev&0xff | (dev>>12)&^0xff
+	dir := filepath.Join(root, "sys/dev/block", strconv.FormatUint(major, 10)+":"+strconv.FormatUint(minor, 10))
+	// A partition has no queue of its own; its parent device does. dir is a
+	// symbolic link, so ".." must not be resolved lexically by filepath.Join.
+	for _, p := range []string{"/queue/rotational", "/../queue/rotational"} {
+		if b, err := ioutil.ReadFile(dir + p); err == nil {
+			return strings.TrimSpace(string(b)) == "1"
+		}
+	}
+	return false
+}
+
+func cpuLimit() (int, bool) { return cgroupCPULimit("/") }
+
+func isRotational(info os.FileInfo) bool { return rotational("/", info) }
@@ -0,0 +1,88 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestCgroupCPULimit(t *testing.T) {
+	tests := []struct {
+		files  map[string]string
+		want   int
+		wantOK bool
+	}{
+		{map[string]string{}, 0, false},
+		{map[string]string{"cpu.max": "max 100000\n"}, 0, false},
+		{map[string]string{"cpu.max": "200000 100000\n"}, 2, true},
+		{map[string]string{"cpu.max": "150000 100000\n"}, 2, true},
+		{map[string]string{"cpu.max": "50000 100000\n"}, 1, true},
+		{map[string]string{"cpu/cpu.cfs_quota_us": "-1\n", "cpu/cpu.cfs_period_us": "100000\n"}, 0, false},
+		{map[string]string{"cpu/cpu.cfs_quota_us": "400000\n", "cpu/cpu.cfs_period_us": "100000\n"}, 4, true},
+	}
+	for i, tt := range tests {
+		root, err := ioutil.TempDir("", "dedup")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(root)
+		for name, contents := range tt.files {
+			path := filepath.Join(root, "sys/fs/cgroup", name)
+			_ = os.MkdirAll(filepath.Dir(path), 0755)
+			if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n, ok := cgroupCPULimit(root); n != tt.want || ok != tt.wantOK {
+			t.Errorf("%d: cgroupCPULimit() = %d, %t; want %d, %t", i+1, n, ok, tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestRotational(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	// Simulate sysfs entries for a rotational disk sda (8:0) with partition
+	// sda1 (8:1), and a non-rotational disk nvme0n1 (259:0).
+	for path, contents := range map[string]string{
+		"sys/block/sda/queue/rotational":     "1\n",
+		"sys/block/sda/sda1/dev":             "8:1\n",
+		"sys/block/nvme0n1/queue/rotational": "0\n",
+	} {
+		path = filepath.Join(root, path)
+		_ = os.MkdirAll(filepath.Dir(path), 0755)
+		if err := ioutil.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_ = os.MkdirAll(filepath.Join(root, "sys/dev/block"), 0755)
+	for link, target := range map[string]string{
+		"8:0":   "../../block/sda",
+		"8:1":   "../../block/sda/sda1",
+		"259:0": "../../block/nvme0n1",
+	} {
+		if err := os.Symlink(target, filepath.Join(root, "sys/dev/block", link)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		dev  uint64
+		want bool
+	}{
+		{8<<8 | 0, true},
+		{8<<8 | 1, true},
+		{259<<8 | 0, false},
+		{7<<8 | 0, false}, // Unknown device.
+	}
+	for _, tt := range tests {
+		if got := rotational(root, devInfo{nil, tt.dev}); got != tt.want {
+			t.Errorf("rotational(%#x) = %t; want %t", tt.dev, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+// +build !linux
+
+package dedup
+
+import "os"
+
+// cpuLimit reports that no CPU quota applies.
+func cpuLimit() (int, bool) { return 0, false }
+
+// isRotational reports that the device containing the file described by info
+// is not known to be rotational.
+func isRotational(info os.FileInfo) bool { return false }
@@ -0,0 +1,121 @@
+package dedup
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// Progress reports the progress of an evaluation while it runs, for progress
+// displays. Set Options.Progress to a *Progress returned by NewProgress; its
+// methods may then be called from any goroutine, during and after the
+// evaluation.
+type Progress struct {
+	mu    sync.Mutex
+	total uint64 // Bytes to be examined, if known.
+	sums  *Sums  // Results of the evaluation, once started.
+	start time.Time
+	base  Stats // Stats of sums when the evaluation started, such as after resuming.
+
+	current map[string]int // Number of evaluations under way of each file, by path.
+}
+
+// Snapshot is the progress of an evaluation at a point in time, as returned
+// by Progress.StatsSnapshot. Rates are averaged since the evaluation started.
+type Snapshot struct {
+	Stats                     // Counts so far.
+	Elapsed     time.Duration // Time since the evaluation started.
+	FilesPerSec float64       // Files evaluated per second.
+	BytesPerSec float64       // Bytes of files examined per second.
+	TotalBytes  uint64        // Total set with SetTotal, such as under Options.Precount; 0 if unknown.
+	Percent     float64       // NumBytes as a percentage of TotalBytes; 0 if unknown.
+	ETA         time.Duration // Estimated time until TotalBytes are examined; negative if unknown.
+	Current     []string      // Sorted paths of the files being evaluated.
+}
+
+// NewProgress returns a *Progress for an evaluation that has yet to start.
+func NewProgress() *Progress {
+	return new(Progress)
+}
+
+// SetTotal sets the total number of bytes of files to be examined, counted
+// beforehand, from which StatsSnapshot estimates the time remaining.
+func (p *Progress) SetTotal(bytes uint64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.total = bytes
+}
+
+// StatsSnapshot returns the progress of the evaluation so far. Its Stats are
+// zero until the evaluation starts.
+func (p *Progress) StatsSnapshot() Snapshot {
+	p.mu.Lock()
+	sums, start, base, total := p.sums, p.start, p.base, p.total
+	var current []string
+	for path := range p.current {
+		current = append(current, path)
+	}
+	p.mu.Unlock()
+	sort.Strings(current)
+
+	snap := Snapshot{TotalBytes: total, ETA: -1, Current: current}
+	if sums == nil {
+		return snap
+	}
+	snap.Stats = sums.Stats()
+	snap.Elapsed = time.Since(start)
+	if secs := snap.Elapsed.Seconds(); secs > 0 {
+		snap.FilesPerSec = float64(snap.NumFiles-base.NumFiles) / secs
+		snap.BytesPerSec = float64(snap.NumBytes-base.NumBytes) / secs
+	}
+	if total > 0 {
+		snap.Percent = 100 * float64(snap.NumBytes) / float64(total)
+	}
+	switch {
+	case total == 0:
+	case snap.NumBytes >= total:
+		snap.ETA = 0
+	case snap.BytesPerSec > 0:
+		snap.ETA = time.Duration(float64(total-snap.NumBytes) / snap.BytesPerSec * float64(time.Second))
+	}
+	return snap
+}
+
+// begin records the start of an evaluation into sums. Evaluations after the
+// first, such as those run by a Watcher into the same Sums, are part of the
+// same progress.
+func (p *Progress) begin(sums *Sums) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.sums != nil {
+		return
+	}
+	p.sums = sums
+	p.start = time.Now()
+	p.base = sums.Stats()
+}
+
+// enter records that the file located at path is being evaluated, until
+// leave is called for it.
+func (p *Progress) enter(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current == nil {
+		p.current = make(map[string]int)
+	}
+	p.current[path]++
+}
+
+// leave records that an evaluation of the file located at path recorded by
+// enter is done.
+func (p *Progress) leave(path string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.current[path]--; p.current[path] <= 0 {
+		delete(p.current, path)
+	}
+}
@@ -0,0 +1,63 @@
+package dedup
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestProgress(t *testing.T) {
+	p := NewProgress()
+	if snap := p.StatsSnapshot(); snap.NumFiles != 0 || snap.ETA >= 0 {
+		t.Errorf("StatsSnapshot() before start = %+v; want zero Stats, unknown ETA", snap)
+	}
+
+	counted, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	total := counted.Stats().NumBytes
+	p.SetTotal(total)
+
+	// Poll while files are evaluated: each snapshot is taken after the file
+	// concerned was grouped into Sums.
+	var mu sync.Mutex
+	var snaps []Snapshot
+	poll := StageFunc(func(r *Result) error {
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		snap := p.StatsSnapshot()
+		var current bool
+		for _, path := range snap.Current {
+			current = current || path == r.Path
+		}
+		if !current {
+			t.Errorf("StatsSnapshot().Current = %q while evaluating %s; want it included", snap.Current, r.Path)
+		}
+		snaps = append(snaps, snap)
+		return nil
+	})
+	opts := &Options{Recursive: true, Progress: p, Stages: &Stages{Report: []Stage{poll}}, FileSystem: FS}
+	sums, _ := FilterDir("root", opts)
+
+	if len(snaps) == 0 {
+		t.Fatal("no snapshots taken")
+	}
+	for i, snap := range snaps {
+		if snap.NumFiles == 0 || snap.Elapsed <= 0 || snap.FilesPerSec <= 0 || snap.TotalBytes != total {
+			t.Errorf("%d: StatsSnapshot() = %+v; want files evaluated at a positive rate", i, snap)
+		}
+		if snap.NumBytes > 0 && snap.NumBytes < total && snap.ETA <= 0 {
+			t.Errorf("%d: ETA = %v with %d of %d bytes examined; want positive", i, snap.ETA, snap.NumBytes, total)
+		}
+	}
+
+	snap := p.StatsSnapshot()
+	if snap.Stats != sums.Stats() {
+		t.Errorf("StatsSnapshot().Stats after run = %v; want %v", snap.Stats, sums.Stats())
+	}
+	if snap.ETA != 0 {
+		t.Errorf("ETA after run = %v; want 0", snap.ETA)
+	}
+	if len(snap.Current) != 0 {
+		t.Errorf("Current after run = %q; want none", snap.Current)
+	}
+}
@@ -0,0 +1,268 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// ManifestName is the name of the manifest recording the files moved into a
+// Quarantine, which is kept in its directory as newline-delimited JSON.
+const ManifestName = "dedup-manifest.jsonl"
+
+// Quarantine is a directory into which duplicate files are moved instead of
+// being deleted, and from which they may be restored.
+type Quarantine struct {
+	dir   string
+	trash bool // Whether dir is a freedesktop.org trash directory.
+	fs    filesys.Mover
+}
+
+// QuarantineEntry records a file moved into a Quarantine.
+type QuarantineEntry struct {
+	Path string    `json:"path"` // Original path of the file.
+	Dest string    `json:"dest"` // Path of the file in the quarantine.
+	Keep string    `json:"keep"` // Copy of the file that was kept.
+	Sum  string    `json:"sum"`  // Hex-encoded checksum of the file.
+	Time time.Time `json:"time"` // When the file was moved.
+}
+
+// NewQuarantine returns a *Quarantine for the directory located at dir, into
+// which files are moved at their absolute paths below dir, so that
+// "/data/photos/a.jpg" is moved to dir + "/data/photos/a.jpg". dir is created
+// when the first file is moved.
+func NewQuarantine(dir string) *Quarantine {
+	return &Quarantine{dir: dir, fs: filesys.OS().(filesys.Mover)}
+}
+
+// Trash returns a *Quarantine for the trash of the current user, as specified
+// by freedesktop.org, into which files are moved the way a file manager would
+// move them: the trash may then be reviewed and emptied with a file manager.
+// Trash is not supported on Windows and macOS.
+func Trash() (*Quarantine, error) {
+	if runtime.GOOS == "windows" || runtime.GOOS == "darwin" {
+		return nil, errors.New("dedup: the trash is not supported on " + runtime.GOOS)
+	}
+	dir := os.Getenv("XDG_DATA_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil, err
+		}
+		dir = filepath.Join(home, ".local", "share")
+	}
+	return &Quarantine{dir: filepath.Join(dir, "Trash"), trash: true, fs: filesys.OS().(filesys.Mover)}, nil
+}
+
+// Dir returns the directory of q.
+func (q *Quarantine) Dir() string { return q.dir }
+
+// Move moves the duplicate deleted by st into q instead, provided that the
+// file kept still exists and that the duplicate has not been modified since
+// st was planned, and records it in the manifest.
+func (q *Quarantine) Move(st Step) error {
+	if err := st.check(); err != nil {
+		return err
+	}
+	abs, err := filepath.Abs(st.Path)
+	if err != nil {
+		return err
+	}
+	e := QuarantineEntry{Path: abs, Keep: st.Keep, Sum: st.Sum, Time: time.Now()}
+	if q.trash {
+		e.Dest, err = q.reserve(abs, e.Time)
+	} else {
+		e.Dest = filepath.Join(q.dir, abs[len(filepath.VolumeName(abs)):])
+		err = q.fs.MkdirAll(filepath.Dir(e.Dest), 0755)
+	}
+	if err != nil {
+		return err
+	}
+	if _, err := os.Lstat(e.Dest); err == nil {
+		return fmt.Errorf("dedup: %s: %s is already in quarantine", st.Path, e.Dest)
+	}
+	if err := q.fs.Rename(abs, e.Dest); err != nil {
+		if q.trash {
+			_ = os.Remove(q.infoPath(e.Dest))
+		}
+		return err
+	}
+	return q.record(e)
+}
+
+// reserve returns an unused path in the trash for the file located at abs,
+// creating its trash info file so that no other program uses the same path.
+func (q *Quarantine) reserve(abs string, now time.Time) (string, error) {
+	for _, dir := range []string{"files", "info"} {
+		if err := q.fs.MkdirAll(filepath.Join(q.dir, dir), 0700); err != nil {
+			return "", err
+		}
+	}
+	base := filepath.Base(abs)
+	for i := 1; ; i++ {
+		name := base
+		if i > 1 {
+			name += "." + strconv.Itoa(i)
+		}
+		dest := filepath.Join(q.dir, "files", name)
+		f, err := os.OpenFile(q.infoPath(dest), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+		if os.IsExist(err) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		if _, err := os.Lstat(dest); err == nil {
+			_ = f.Close()
+			_ = os.Remove(q.infoPath(dest))
+			continue
+		}
+		u := url.URL{Path: abs}
+		_, err = fmt.Fprintf(f, "[Trash Info]\nPath=%s\nDeletionDate=%s\n",
+			u.EscapedPath(), now.Format("2006-01-02T15:04:05"))
+		if cerr := f.Close(); err == nil {
+			err = cerr
+		}
+		if err != nil {
+			_ = os.Remove(q.infoPath(dest))
+			return "", err
+		}
+		return dest, nil
+	}
+}
+
+// infoPath returns the path of the trash info file for the file located at
+// dest in the trash.
+func (q *Quarantine) infoPath(dest string) string {
+	return filepath.Join(q.dir, "info", filepath.Base(dest)+".trashinfo")
+}
+
+// record appends e to the manifest.
+func (q *Quarantine) record(e QuarantineEntry) error {
+	b, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(q.dir, ManifestName), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0600)
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(append(b, '\n'))
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+// Entries returns the files recorded in the manifest of q, in the order in
+// which they were moved.
+func (q *Quarantine) Entries() ([]QuarantineEntry, error) {
+	f, err := os.Open(filepath.Join(q.dir, ManifestName))
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var entries []QuarantineEntry
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var e QuarantineEntry
+		if err := json.Unmarshal(s.Bytes(), &e); err != nil {
+			return nil, fmt.Errorf("dedup: reading manifest: %w", err)
+		}
+		entries = append(entries, e)
+	}
+	return entries, s.Err()
+}
+
+// Restore moves every file recorded in the manifest of q back to its original
+// path, unless a file exists there, and returns the entries restored. Files
+// that cannot be restored remain in the manifest. If err is non-nil, its type
+// will be Errors.
+func (q *Quarantine) Restore() ([]QuarantineEntry, error) {
+	entries, err := q.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var restored, remaining []QuarantineEntry
+	var errs Errors
+	for _, e := range entries {
+		if err := q.restore(e); err != nil {
+			errs = append(errs, err)
+			remaining = append(remaining, e)
+			continue
+		}
+		restored = append(restored, e)
+	}
+	if err := q.rewrite(remaining); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return restored, errs
+	}
+	return restored, nil
+}
+
+func (q *Quarantine) restore(e QuarantineEntry) error {
+	if _, err := os.Lstat(e.Path); err == nil {
+		return fmt.Errorf("dedup: cannot restore %s: file exists", e.Path)
+	}
+	if _, err := os.Lstat(e.Dest); err != nil {
+		return fmt.Errorf("dedup: cannot restore %s: %w", e.Path, err)
+	}
+	if err := q.fs.MkdirAll(filepath.Dir(e.Path), 0755); err != nil {
+		return err
+	}
+	if err := q.fs.Rename(e.Dest, e.Path); err != nil {
+		return err
+	}
+	if q.trash {
+		_ = os.Remove(q.infoPath(e.Dest))
+	}
+	return nil
+}
+
+// rewrite replaces the manifest of q with entries, removing it if entries is
+// empty.
+func (q *Quarantine) rewrite(entries []QuarantineEntry) error {
+	pth := filepath.Join(q.dir, ManifestName)
+	if len(entries) == 0 {
+		if err := os.Remove(pth); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	tmp := pth + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	enc := json.NewEncoder(w)
+	for _, e := range entries {
+		if err = enc.Encode(e); err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return q.fs.Rename(tmp, pth)
+}
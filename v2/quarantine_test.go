@@ -0,0 +1,98 @@
+package dedup
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQuarantine(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	data := filepath.Join(root, "data")
+	if err := os.Mkdir(data, 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(data, name), []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	sums, err := FilterDir(data, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := sums.Plan(Policy{Op: OpDelete})
+	if len(plan.Steps) != 1 {
+		t.Fatalf("Plan() = %+v; want 1 step", plan)
+	}
+
+	trash := func(t *testing.T) *Quarantine {
+		defer os.Setenv("XDG_DATA_HOME", os.Getenv("XDG_DATA_HOME"))
+		os.Setenv("XDG_DATA_HOME", filepath.Join(root, "share"))
+		q, err := Trash()
+		if err != nil {
+			t.Skip(err)
+		}
+		return q
+	}
+	for _, tc := range []struct {
+		name string
+		q    func(t *testing.T) *Quarantine
+		dest string
+	}{
+		{"dir", func(*testing.T) *Quarantine { return NewQuarantine(filepath.Join(root, "q")) }, filepath.Join(root, "q", data, "b")},
+		{"trash", trash, filepath.Join(root, "share", "Trash", "files", "b")},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			q := tc.q(t)
+			if err := q.Move(plan.Steps[0]); err != nil {
+				t.Fatalf("Move() = %v", err)
+			}
+			if _, err := os.Stat(filepath.Join(data, "b")); !os.IsNotExist(err) {
+				t.Errorf("b still exists: %v", err)
+			}
+			entries, err := q.Entries()
+			if err != nil || len(entries) != 1 || entries[0].Dest != tc.dest || entries[0].Path != filepath.Join(data, "b") {
+				t.Fatalf("Entries() = %+v, %v; want b moved to %s", entries, err, tc.dest)
+			}
+			if _, err := os.Stat(tc.dest); err != nil {
+				t.Errorf("moved file: %v", err)
+			}
+
+			restored, err := q.Restore()
+			if err != nil || len(restored) != 1 {
+				t.Fatalf("Restore() = %+v, %v", restored, err)
+			}
+			if b, err := ioutil.ReadFile(filepath.Join(data, "b")); err != nil || string(b) != "same" {
+				t.Errorf("restored b = %q, %v", b, err)
+			}
+			if entries, err := q.Entries(); err != nil || len(entries) != 0 {
+				t.Errorf("Entries() after Restore() = %+v, %v; want none", entries, err)
+			}
+			if infos, _ := filepath.Glob(filepath.Join(q.Dir(), "info", "*")); len(infos) != 0 {
+				t.Errorf("trash info files remain: %v", infos)
+			}
+		})
+	}
+
+	// A file is not restored over one that exists.
+	q := NewQuarantine(filepath.Join(root, "q"))
+	if err := q.Move(plan.Steps[0]); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(data, "b"), []byte("new"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := q.Restore(); err == nil || !strings.Contains(err.Error(), "file exists") {
+		t.Errorf("Restore() = %v; want file exists error", err)
+	}
+	if entries, _ := q.Entries(); len(entries) != 1 {
+		t.Errorf("Entries() = %+v; want the entry that was not restored", entries)
+	}
+}
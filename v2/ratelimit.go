@@ -0,0 +1,75 @@
+package dedup
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+// tokenBucket limits the rate of an operation shared by concurrent workers.
+// Tokens accrue at rate per second, up to one second's worth; a caller taking
+// more tokens than are available goes into debt and waits until it is repaid,
+// so that callers are served in the order in which they arrive. A nil
+// *tokenBucket imposes no limit.
+type tokenBucket struct {
+	mu     sync.Mutex
+	rate   float64   // Tokens per second.
+	tokens float64   // Tokens available, or owed if negative.
+	last   time.Time // When tokens was last updated.
+}
+
+// newTokenBucket returns a *tokenBucket that is initially empty, or nil if
+// rate is not positive.
+func newTokenBucket(rate int64) *tokenBucket {
+	if rate <= 0 {
+		return nil
+	}
+	return &tokenBucket{rate: float64(rate), last: time.Now()}
+}
+
+// wait takes n tokens from b, waiting until they are available or cancel is
+// closed.
+func (b *tokenBucket) wait(n int64, cancel <-chan struct{}) {
+	if b == nil || n <= 0 {
+		return
+	}
+	b.mu.Lock()
+	now := time.Now()
+	b.tokens += now.Sub(b.last).Seconds() * b.rate
+	if b.tokens > b.rate {
+		b.tokens = b.rate
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	delay := time.Duration(-b.tokens / b.rate * float64(time.Second))
+	b.mu.Unlock()
+	if delay <= 0 {
+		return
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-cancel:
+	case <-t.C:
+	}
+}
+
+// limitChunk is the greatest number of bytes read at once by a limitedReader,
+// so that large reads do not cause long waits.
+const limitChunk = 64 << 10
+
+// limitedReader reads from r no faster than b allows.
+type limitedReader struct {
+	r      io.Reader
+	b      *tokenBucket
+	cancel <-chan struct{}
+}
+
+func (r *limitedReader) Read(p []byte) (int, error) {
+	if len(p) > limitChunk {
+		p = p[:limitChunk]
+	}
+	n, err := r.r.Read(p)
+	r.b.wait(int64(n), r.cancel)
+	return n, err
+}
@@ -0,0 +1,61 @@
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTokenBucket(t *testing.T) {
+	if b := newTokenBucket(0); b != nil {
+		t.Errorf("newTokenBucket(0) = %+v; want nil", b)
+	}
+	var b *tokenBucket
+	b.wait(1, nil) // No limit: does not block.
+
+	b = newTokenBucket(1)
+	cancel := make(chan struct{})
+	close(cancel)
+	start := time.Now()
+	b.wait(3600, cancel)
+	if d := time.Since(start); d > time.Second {
+		t.Errorf("wait() after cancellation took %v", d)
+	}
+}
+
+func TestFilterRateLimit(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for i := 0; i < 20; i++ {
+		contents := strings.Repeat(fmt.Sprint(i%4), 1000)
+		if err := ioutil.WriteFile(filepath.Join(root, fmt.Sprint(i)), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, tc := range []struct {
+		name string
+		opts Options
+	}{
+		{"bytes", Options{MaxBytesPerSec: 80000}}, // 20000 bytes in 0.25s.
+		{"files", Options{MaxFilesPerSec: 80}},    // 20 files in 0.25s.
+	} {
+		start := time.Now()
+		sums, err := FilterDir(root, &tc.opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if d := time.Since(start); d < 200*time.Millisecond {
+			t.Errorf("%s: took %v; want about 250ms", tc.name, d)
+		}
+		if stats := sums.Stats(); stats.NumFiles != 20 || stats.NumDupFiles != 16 {
+			t.Errorf("%s: Stats() = %+v; want 20 files, 16 duplicates", tc.name, stats)
+		}
+	}
+}
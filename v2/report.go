@@ -0,0 +1,377 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// Formats in which WriteReport can write the summary of duplicate files.
+const (
+	FormatText   = "text"   // As written by WriteAllDup.
+	FormatJSON   = "json"   // A JSON document listing each group of duplicates.
+	FormatCSV    = "csv"    // CSV with a header and a row per duplicate file.
+	FormatYAML   = "yaml"   // A YAML document mapping each checksum to its group of duplicates.
+	FormatFdupes = "fdupes" // The paths of each group of duplicates, as listed by fdupes and jdupes.
+)
+
+// LinkPaths is how files that symbolic links led to are named in output;
+// see Options.LinkPaths.
+type LinkPaths int
+
+const (
+	LinkTargets           LinkPaths = iota // By the path of the file.
+	LinkSources                            // By the path of the link.
+	LinkSourcesAndTargets                  // By the path of the link, followed by that of the file.
+)
+
+// paths returns the path by which file is named under p, and the path of
+// the file that it is a link to if that is named as well.
+func (p LinkPaths) paths(file *File) (path, target string) {
+	switch {
+	case file.link == "" || p == LinkTargets:
+		return file.Path, ""
+	case p == LinkSources:
+		return file.link, ""
+	}
+	return file.link, file.Path
+}
+
+// line returns the line naming the file located at path, which the link at
+// link led to unless link is empty, under p: under LinkSourcesAndTargets,
+// the path of the link, or of the file if none, and that of the file,
+// separated by a tab.
+func (p LinkPaths) line(path, link string) string {
+	if link == "" {
+		link = path
+	}
+	switch p {
+	case LinkSources:
+		return link
+	case LinkSourcesAndTargets:
+		return link + "\t" + path
+	}
+	return path
+}
+
+// reportGroup is the serialized form of a group of duplicate files.
+type reportGroup struct {
+	Sum     string            `json:"sum"`
+	Size    int64             `json:"size"`
+	Digests map[string]string `json:"digests,omitempty"` // Hex-encoded File.Digests by name.
+	Files   []reportFile      `json:"files"`
+}
+
+type reportFile struct {
+	Path   string `json:"path"`
+	Target string `json:"target,omitempty"` // Path of the file that the symbolic link at Path leads to, under LinkSourcesAndTargets.
+	Link   string `json:"link,omitempty"`   // Path of the file listed before it that it is a hard link to.
+
+	fileMeta // Under Options.LongReport.
+}
+
+// fileMeta is the serialized form of the mode, owner, and modification time
+// of a file, included in reports under Options.LongReport.
+type fileMeta struct {
+	Mode    string `json:"mode,omitempty"`
+	UID     *int   `json:"uid,omitempty"` // Unless unknown; see File.Owner.
+	GID     *int   `json:"gid,omitempty"`
+	ModTime string `json:"mtime,omitempty"` // In UTC, as RFC 3339.
+}
+
+// newFileMeta returns the metadata of file.
+func newFileMeta(file *File) fileMeta {
+	m := fileMeta{
+		Mode:    file.Info.Mode().String(),
+		ModTime: file.Info.ModTime().UTC().Format(time.RFC3339),
+	}
+	if uid, gid, ok := file.Owner(); ok {
+		m.UID, m.GID = &uid, &gid
+	}
+	return m
+}
+
+// String returns m as written by WriteAllDup.
+func (m fileMeta) String() string {
+	if m.UID == nil {
+		return m.Mode + " " + m.ModTime
+	}
+	return fmt.Sprintf("%s %d:%d %s", m.Mode, *m.UID, *m.GID, m.ModTime)
+}
+
+// owner returns the user and group IDs of m as strings, or empty strings if
+// unknown.
+func (m fileMeta) owner() (uid, gid string) {
+	if m.UID == nil {
+		return "", ""
+	}
+	return strconv.Itoa(*m.UID), strconv.Itoa(*m.GID)
+}
+
+type report struct {
+	Header  *Header       `json:"header,omitempty"` // Under Options.ReportHeader.
+	Partial bool          `json:"partial,omitempty"`
+	Groups  []reportGroup `json:"groups"`
+}
+
+// WriteReport writes a summary of duplicate files and their checksums to w
+// in format. FormatText writes it as WriteAllDup does. FormatCSV writes rows
+// of sum, size, path, and link, the path of the file that it is a hard link
+// to, if any, under a header naming those columns. FormatJSON writes a JSON
+// document of the following form:
+//
+//	{"groups": [{"sum": "da39a3…", "size": 0, "digests": {…},
+//	  "files": [{"path": "/path/to/file1"}, …]}, …]}
+//
+// which also holds "partial": true, preceding groups, if s is Partial, such as
+// after stopping at Options.Deadline.
+//
+// FormatYAML writes a YAML document of the following form, in which, unlike
+// the YAML-like format of FormatText, every key and string is quoted:
+//
+//	---
+//	"da39a3ee5e6b4b0d3255bfef95601890afd80709":
+//	  size: 0
+//	  digests:
+//	    "sha256": "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+//	  files:
+//	    - path: "/path/to/file1"
+//	    - path: "/path/to/file3"
+//	      link: "/path/to/file1"
+//	...
+//
+// FormatFdupes writes the path of each file on a line of its own, each group
+// followed by a blank line, as fdupes and jdupes do, for scripts written for
+// them; ReadFdupes reads it back.
+//
+// Under the Options.LongReport of the evaluation into s, each file also
+// carries its mode, uid and gid, unless unknown, and mtime, its
+// modification time in UTC as RFC 3339: as further columns under FormatCSV,
+// and as further keys of each file under FormatJSON and FormatYAML. It is
+// left out under FormatFdupes. Files are named as set by the
+// Options.LinkPaths of the evaluation into s; under LinkSourcesAndTargets,
+// the path of the file that a link led to is the further target column under
+// FormatCSV, following link, and the target key of each such file under
+// FormatJSON and FormatYAML.
+//
+// Under the Options.ReportHeader of the evaluation into s, the report begins
+// with the Header of s: as the header key, preceding groups, under
+// FormatJSON, and as a comment line holding it as a JSON object, such as
+//
+//	# {"version":"0.1.0","host":"nas","start":"2024-05-01T10:00:00Z",…}
+//
+// under FormatCSV and FormatYAML, which a csv.Reader whose Comment is '#'
+// skips.
+//
+// Groups and their files are sorted as DupGroups returns them, and omitted
+// likewise under Options.MinGroupSize.
+func (s *Sums) WriteReport(w io.Writer, format string) error {
+	switch format {
+	case FormatText:
+		return s.WriteAllDup(w)
+	case FormatJSON:
+		b, err := json.MarshalIndent(report{Header: s.reportHeader(), Partial: s.Partial(), Groups: s.reportGroups()}, "", "\t")
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(append(b, '\n'))
+		return err
+	case FormatCSV:
+		if err := s.writeHeaderComment(w); err != nil {
+			return err
+		}
+		cw := csv.NewWriter(w)
+		header := []string{"sum", "size", "path", "link"}
+		targets := s.linkPaths() == LinkSourcesAndTargets
+		if targets {
+			header = append(header, "target")
+		}
+		if s.longReport() {
+			header = append(header, "mode", "uid", "gid", "mtime")
+		}
+		_ = cw.Write(header)
+		s.rangeReportGroups(func(g reportGroup) bool {
+			size := strconv.FormatInt(g.Size, 10)
+			for _, file := range g.Files {
+				row := []string{g.Sum, size, file.Path, file.Link}
+				if targets {
+					path := file.Target
+					if path == "" {
+						path = file.Path
+					}
+					row = append(row, path)
+				}
+				if m := file.fileMeta; m.Mode != "" {
+					uid, gid := m.owner()
+					row = append(row, m.Mode, uid, gid, m.ModTime)
+				}
+				_ = cw.Write(row)
+			}
+			return cw.Error() == nil
+		})
+		cw.Flush()
+		return cw.Error()
+	case FormatYAML:
+		if err := s.writeHeaderComment(w); err != nil {
+			return err
+		}
+		return s.writeYAML(w)
+	case FormatFdupes:
+		return s.writeFdupes(w)
+	}
+	return fmt.Errorf("unknown report format: %q", format)
+}
+
+// writeHeaderComment writes the header of the reports written from s, if
+// any, to w as a comment line holding it as a JSON object.
+func (s *Sums) writeHeaderComment(w io.Writer) error {
+	h := s.reportHeader()
+	if h == nil {
+		return nil
+	}
+	b, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "# %s\n", b)
+	return err
+}
+
+// WriteAllDupToFile writes the summary of duplicate files that WriteReport
+// writes in format to the file located at pth, replacing it atomically: the
+// summary is written to a temporary file in the same directory, which is
+// renamed to pth once complete, so that a previous report is never replaced
+// by one that is only partly written.
+func (s *Sums) WriteAllDupToFile(pth, format string) error {
+	switch format {
+	case FormatText, FormatJSON, FormatCSV, FormatYAML, FormatFdupes:
+	default:
+		return fmt.Errorf("unknown report format: %q", format)
+	}
+	return writeFile(pth, 0644, func(w io.Writer) error {
+		return s.WriteReport(w, format)
+	})
+}
+
+// reportGroups returns the serialized form of every group of duplicates in
+// s, sorted by checksum and then by path.
+func (s *Sums) reportGroups() []reportGroup {
+	groups := []reportGroup{}
+	s.rangeReportGroups(func(g reportGroup) bool {
+		groups = append(groups, g)
+		return true
+	})
+	return groups
+}
+
+// rangeReportGroups calls f with the serialized form of each group of
+// duplicates in s in turn, as rangeDupGroups does, until f returns false.
+func (s *Sums) rangeReportGroups(f func(g reportGroup) bool) {
+	long, links := s.longReport(), s.linkPaths()
+	s.rangeDupGroups(func(dg Group) bool {
+		g := reportGroup{
+			Sum:     hex.EncodeToString([]byte(dg.Sum)),
+			Size:    dg.Files[0].Info.Size(),
+			Digests: hexDigests(groupDigests(dg.Files)),
+			Files:   make([]reportFile, len(dg.Files)),
+		}
+		for i, file := range dg.Files {
+			g.Files[i].Path, g.Files[i].Target = links.paths(file)
+			if link := linkedTo(dg.Files[:i], file); link != nil {
+				g.Files[i].Link, _ = links.paths(link)
+			}
+			if long {
+				g.Files[i].fileMeta = newFileMeta(file)
+			}
+		}
+		return f(g)
+	})
+}
+
+// writeYAML writes the groups of duplicates in s to w as a YAML document in
+// the form documented by WriteReport. Strings are written as YAML double-quoted scalars, whose
+// escape sequences are a superset of those of Go's quoted strings; bytes that
+// are not valid UTF-8 are written as \x escapes, which YAML reads as the
+// code points of the same value.
+func (s *Sums) writeYAML(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var started bool
+	s.rangeReportGroups(func(g reportGroup) bool {
+		if !started {
+			_, _ = bw.WriteString("---\n")
+			started = true
+		}
+		_, _ = fmt.Fprintf(bw, "%s:\n  size: %d\n", strconv.Quote(g.Sum), g.Size)
+		if len(g.Digests) > 0 {
+			_, _ = bw.WriteString("  digests:\n")
+			for _, name := range sortedKeys(g.Digests) {
+				_, _ = fmt.Fprintf(bw, "    %s: %s\n", strconv.Quote(name), strconv.Quote(g.Digests[name]))
+			}
+		}
+		_, _ = bw.WriteString("  files:\n")
+		for _, file := range g.Files {
+			_, _ = fmt.Fprintf(bw, "    - path: %s\n", strconv.Quote(file.Path))
+			if file.Target != "" {
+				_, _ = fmt.Fprintf(bw, "      target: %s\n", strconv.Quote(file.Target))
+			}
+			if file.Link != "" {
+				_, _ = fmt.Fprintf(bw, "      link: %s\n", strconv.Quote(file.Link))
+			}
+			if m := file.fileMeta; m.Mode != "" {
+				_, _ = fmt.Fprintf(bw, "      mode: %s\n", strconv.Quote(m.Mode))
+				if m.UID != nil {
+					_, _ = fmt.Fprintf(bw, "      uid: %d\n      gid: %d\n", *m.UID, *m.GID)
+				}
+				_, _ = fmt.Fprintf(bw, "      mtime: %s\n", strconv.Quote(m.ModTime))
+			}
+		}
+		return true
+	})
+	if !started {
+		_, _ = bw.WriteString("--- {}\n")
+	}
+	_, _ = bw.WriteString("...\n")
+	return bw.Flush()
+}
+
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// writeFile calls write to write the file located at pth with permissions
+// perm, replacing it atomically by way of a temporary file that is removed if
+// write fails.
+func writeFile(pth string, perm os.FileMode, write func(w io.Writer) error) error {
+	tmp, err := ioutil.TempFile(filepath.Dir(pth), filepath.Base(pth)+".tmp")
+	if err != nil {
+		return err
+	}
+	err = tmp.Chmod(perm)
+	if err == nil {
+		err = write(tmp)
+	}
+	if cerr := tmp.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), pth)
+	}
+	if err != nil {
+		_ = os.Remove(tmp.Name())
+	}
+	return err
+}
@@ -0,0 +1,263 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteReport(t *testing.T) {
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	want := []reportGroup{
+		{Sum: hex.EncodeToString([]byte(Dup1Sum)), Size: int64(len(Dup1)), Files: []reportFile{
+			{Path: "root/foo/bar/dup1"}, {Path: "root/qux/quux/dup1"},
+		}},
+		{Sum: hex.EncodeToString([]byte(Dup2Sum)), Size: int64(len(Dup2)), Files: []reportFile{
+			{Path: "root/dup2"}, {Path: "root/foo/baz/dup2"}, {Path: "root/qux/quuz/dup2"},
+		}},
+		{Sum: hex.EncodeToString([]byte(Dup3Sum)), Size: int64(len(Dup3)), Files: []reportFile{
+			{Path: "root/foo/dup3"}, {Path: "root/qux/dup3"},
+		}},
+	}
+	sort.Slice(want, func(i, j int) bool { return want[i].Sum < want[j].Sum })
+
+	var buf bytes.Buffer
+	if err := sums.WriteReport(&buf, FormatJSON); err != nil {
+		t.Fatalf("WriteReport(json) = %v", err)
+	}
+	var r report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if !reflect.DeepEqual(r.Groups, want) {
+		t.Errorf("json groups = %v; want %v", r.Groups, want)
+	}
+
+	buf.Reset()
+	if err := sums.WriteReport(&buf, FormatCSV); err != nil {
+		t.Fatalf("WriteReport(csv) = %v", err)
+	}
+	rows, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatalf("csv.ReadAll() = %v", err)
+	}
+	if want := []string{"sum", "size", "path", "link"}; !reflect.DeepEqual(rows[0], want) {
+		t.Errorf("csv header = %q; want %q", rows[0], want)
+	}
+	var paths []string
+	for _, row := range rows[1:] {
+		paths = append(paths, row[2])
+	}
+	var wantPaths []string
+	for _, g := range want {
+		for _, file := range g.Files {
+			wantPaths = append(wantPaths, file.Path)
+		}
+	}
+	if !reflect.DeepEqual(paths, wantPaths) {
+		t.Errorf("csv paths = %q; want %q", paths, wantPaths)
+	}
+
+	if err := sums.WriteReport(&buf, "xml"); err == nil {
+		t.Error(`WriteReport("xml") = nil; want error`)
+	}
+}
+
+func TestWriteReportLong(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	for _, name := range []string{"a", "b"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("dup"), 0640); err != nil {
+			t.Fatal(err)
+		}
+	}
+	info, err := os.Lstat(filepath.Join(dir, "a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := newFileMeta(&File{Path: "a", Info: info})
+
+	sums, _ := FilterDir(dir, &Options{LongReport: true})
+	var buf bytes.Buffer
+	_ = sums.WriteAllDup(&buf)
+	want := dupString(sha1Sum([]byte("dup")))
+	for _, name := range []string{"a", "b"} {
+		want += fmt.Sprintf("- %q %s\n", filepath.Join(dir, name), meta)
+	}
+	if buf.String() != want {
+		t.Errorf("WriteAllDup() = %q; want %q", buf.String(), want)
+	}
+	if meta.Mode != "-rw-r-----" && meta.Mode != "-rw-rw-rw-" {
+		t.Errorf("mode = %s; want -rw-r-----", meta.Mode)
+	}
+
+	buf.Reset()
+	_ = sums.WriteReport(&buf, FormatJSON)
+	var r report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if got := r.Groups[0].Files[1].fileMeta; !reflect.DeepEqual(got, meta) {
+		t.Errorf("json file = %+v; want %+v", got, meta)
+	}
+
+	buf.Reset()
+	_ = sums.WriteReport(&buf, FormatCSV)
+	rows, _ := csv.NewReader(&buf).ReadAll()
+	uid, gid := meta.owner()
+	if want := []string{meta.Mode, uid, gid, meta.ModTime}; len(rows) != 3 || !reflect.DeepEqual(rows[1][4:], want) {
+		t.Errorf("csv rows = %q; want %q", rows, want)
+	}
+}
+
+func TestWriteAllDupToFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	pth := filepath.Join(dir, "report.json")
+
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	if err := sums.WriteAllDupToFile(pth, FormatJSON); err != nil {
+		t.Fatalf("WriteAllDupToFile() = %v", err)
+	}
+	var want bytes.Buffer
+	_ = sums.WriteReport(&want, FormatJSON)
+	checkFile(t, pth, want.String())
+
+	if err := sums.WriteAllDupToFile(pth, "xml"); err == nil {
+		t.Error(`WriteAllDupToFile("xml") = nil; want error`)
+	}
+	errWrite := errors.New("write failed")
+	err = writeFile(pth, 0644, func(w io.Writer) error {
+		_, _ = io.WriteString(w, "partial")
+		return errWrite
+	})
+	if err != errWrite {
+		t.Errorf("writeFile() = %v; want %v", err, errWrite)
+	}
+	checkFile(t, pth, want.String())
+
+	names, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 1 {
+		t.Errorf("%d files remain in %s; want 1", len(names), dir)
+	}
+}
+
+func checkFile(t *testing.T, pth, want string) {
+	t.Helper()
+	b, err := ioutil.ReadFile(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(b) != want {
+		t.Errorf("%s contains %q; want %q", pth, b, want)
+	}
+}
+
+func TestWriteReportYAML(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/a/with \"quotes\"")
+	add("aqua", "/b/line\nbreak")
+	add("aqua", "/c/# not a comment: ---")
+	add("gray", "/a/unique")
+
+	var buf bytes.Buffer
+	if err := sums.WriteReport(&buf, FormatYAML); err != nil {
+		t.Fatalf("WriteReport(yaml) = %v", err)
+	}
+	want := fmt.Sprintf(`---
+"%x":
+  size: 4
+  files:
+    - path: "/a/with \"quotes\""
+    - path: "/b/line\nbreak"
+    - path: "/c/# not a comment: ---"
+...
+`, keySum["aqua"])
+	if got := buf.String(); got != want {
+		t.Errorf("WriteReport(yaml) wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	buf.Reset()
+	if err := NewSums().WriteReport(&buf, FormatYAML); err != nil {
+		t.Fatalf("WriteReport(yaml) = %v", err)
+	}
+	if got, want := buf.String(), "--- {}\n...\n"; got != want {
+		t.Errorf("WriteReport(yaml) of no duplicates wrote %q; want %q", got, want)
+	}
+}
+
+func TestWriteReportHeader(t *testing.T) {
+	before := time.Now()
+	sums, _ := FilterDir("root", &Options{Recursive: true, MaxDepth: 3, Digests: []string{"md5"}, ReportHeader: true, FileSystem: FS})
+	h, ok := sums.Header()
+	if !ok {
+		t.Fatal("Header() = false; want the header of the evaluation")
+	}
+	want := map[string]string{"recursive": "true", "max-depth": "3", "digests": "md5"}
+	if h.Version != Version || h.Algorithm != "sha1" || !reflect.DeepEqual(h.Options, want) {
+		t.Errorf("Header() = %+v; want version %s, algorithm sha1, options %v", h, Version, want)
+	}
+	if h.Start.Before(before) || h.End.Before(h.Start) || h.Seconds != h.End.Sub(h.Start).Seconds() {
+		t.Errorf("Header() = %+v; want it to start after %v and end after its start", h, before)
+	}
+
+	var buf bytes.Buffer
+	_ = sums.WriteReport(&buf, FormatJSON)
+	var r report
+	if err := json.Unmarshal(buf.Bytes(), &r); err != nil {
+		t.Fatalf("json.Unmarshal() = %v", err)
+	}
+	if r.Header == nil || r.Header.Version != Version || !r.Header.End.Equal(h.End) || len(r.Groups) != 3 {
+		t.Errorf("json header = %+v, %d groups; want %+v, 3 groups", r.Header, len(r.Groups), h)
+	}
+
+	for _, format := range []string{FormatCSV, FormatYAML} {
+		buf.Reset()
+		_ = sums.WriteReport(&buf, format)
+		line, _ := buf.ReadString('\n')
+		var got Header
+		if !strings.HasPrefix(line, "# ") || json.Unmarshal([]byte(line[2:]), &got) != nil || got.Version != Version {
+			t.Errorf("WriteReport(%s) begins with %q; want the header as a comment", format, line)
+		}
+	}
+	buf.Reset()
+	_ = sums.WriteReport(&buf, FormatCSV)
+	cr := csv.NewReader(&buf)
+	cr.Comment = '#'
+	if rows, err := cr.ReadAll(); err != nil || rows[0][0] != "sum" {
+		t.Errorf("csv.ReadAll() = %q, %v; want the header skipped", rows, err)
+	}
+
+	// Without ReportHeader, the Header is recorded but not written.
+	sums, _ = FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	buf.Reset()
+	_ = sums.WriteReport(&buf, FormatJSON)
+	if _, ok := sums.Header(); !ok || strings.Contains(buf.String(), `"header"`) {
+		t.Errorf("Header() = %v, WriteReport(json) = %q; want a header, not written", ok, buf.String())
+	}
+	if _, ok := NewSums().Header(); ok {
+		t.Error("NewSums().Header() = true; want false")
+	}
+}
@@ -0,0 +1,139 @@
+package dedup
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"time"
+)
+
+// sample records which sizes of files are evaluated under the SamplePercent
+// option, and what the sample is drawn from, to extrapolate from it.
+type sample struct {
+	sizes      map[int64]int // Number of files of each size sampled.
+	groups     int           // Number of sizes shared by several files.
+	totalBytes uint64        // Total size of the files of those sizes.
+}
+
+// newSample draws a sample of percent of the sizes shared by several files
+// among sizes, as returned by precount, using rnd.
+func newSample(sizes map[int64]int, percent float64, rnd *rand.Rand) *sample {
+	var candidates []int64
+	s := &sample{sizes: make(map[int64]int)}
+	for size, n := range sizes {
+		if n > 1 {
+			candidates = append(candidates, size)
+			s.totalBytes += uint64(size) * uint64(n)
+		}
+	}
+	sort.Slice(candidates, func(i, j int) bool { return candidates[i] < candidates[j] })
+	rnd.Shuffle(len(candidates), func(i, j int) {
+		candidates[i], candidates[j] = candidates[j], candidates[i]
+	})
+	s.groups = len(candidates)
+	k := int(math.Ceil(float64(len(candidates)) * percent / 100))
+	if k > len(candidates) {
+		k = len(candidates)
+	}
+	for _, size := range candidates[:k] {
+		s.sizes[size] = sizes[size]
+	}
+	return s
+}
+
+// sampled configures f to only evaluate files whose sizes are in the sample
+// drawn under the SamplePercent option from sizes, as returned by precount,
+// unless a Matcher or Canonical is set, as for precounted. It returns the
+// total size of the files that remain to be read.
+func (f *chanFilter) sampled(sizes map[int64]int) (total uint64) {
+	if f.opts.Matcher != nil || f.opts.Canonical != nil {
+		return f.precounted(sizes)
+	}
+	seed := f.opts.seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	s := newSample(sizes, f.opts.SamplePercent, rand.New(rand.NewSource(seed)))
+	f.sizes, f.subset = s.sizes, true
+	f.sums.setSample(s)
+	for size, n := range s.sizes {
+		total += uint64(size) * uint64(n)
+	}
+	return total
+}
+
+// Estimate is an estimate of the duplication among all the files listed by
+// an evaluation under Options.SamplePercent, extrapolated from the sample of
+// them that was evaluated. Files are sampled by size: all the files of each
+// size sampled are evaluated, which finds all the duplicates among them.
+type Estimate struct {
+	Groups        int    // Number of sizes shared by several files, which could have duplicates.
+	SampledGroups int    // Number of those sizes sampled.
+	TotalBytes    uint64 // Total size of the files that could have duplicates.
+	SampledBytes  uint64 // Total size of the files sampled.
+
+	// DupBytes is the estimated number of bytes of duplicates among all the
+	// files, as Stats.NumDupBytes would count them after a full evaluation,
+	// and Low and High bound its 95% confidence interval.
+	DupBytes  uint64
+	Low, High uint64
+}
+
+// Estimate extrapolates the duplication among all the files listed by the
+// evaluation into s from the files sampled under Options.SamplePercent, as a
+// ratio estimate from a cluster sample of sizes. ok will be false unless s
+// was evaluated under SamplePercent.
+func (s *Sums) Estimate() (e Estimate, ok bool) {
+	s.mu.Lock()
+	sm := s.sample
+	s.mu.Unlock()
+	if sm == nil {
+		return e, false
+	}
+
+	dups := make(map[int64]uint64) // Bytes of duplicates of each size.
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		if len(files) > 1 && files[0].Info != nil {
+			size := files[0].Info.Size()
+			dups[size] += uint64(size) * uint64(len(files)-1)
+		}
+		return true
+	})
+
+	var y, x float64 // Totals of duplicate and sampled bytes.
+	for size, n := range sm.sizes {
+		y += float64(dups[size])
+		x += float64(size) * float64(n)
+	}
+	e = Estimate{
+		Groups:        sm.groups,
+		SampledGroups: len(sm.sizes),
+		TotalBytes:    sm.totalBytes,
+		SampledBytes:  uint64(x),
+	}
+	if x == 0 {
+		e.High = e.TotalBytes
+		return e, true
+	}
+	r := y / x
+	total := float64(e.TotalBytes)
+	e.DupBytes = uint64(math.Round(r * total))
+	n, N := float64(e.SampledGroups), float64(e.Groups)
+	if n == N {
+		e.Low, e.High = e.DupBytes, e.DupBytes
+		return e, true
+	}
+	if n < 2 {
+		e.High = e.TotalBytes
+		return e, true
+	}
+	var ss float64 // Sum of squared residuals of the ratio.
+	for size, k := range sm.sizes {
+		d := float64(dups[size]) - r*float64(size)*float64(k)
+		ss += d * d
+	}
+	margin := 1.96 * math.Sqrt(N*N*(1-n/N)*ss/(n-1)/n)
+	e.Low = uint64(math.Max(0, math.Round(r*total-margin)))
+	e.High = uint64(math.Min(total, math.Round(r*total+margin)))
+	return e, true
+}
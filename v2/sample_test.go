@@ -0,0 +1,52 @@
+package dedup
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirSample(t *testing.T) {
+	files := make(map[string][]byte)
+	for i := 1; i <= 20; i++ {
+		// Two copies, and one file that differs, of each of 20 sizes.
+		b := strings.Repeat("a", i)
+		files[fmt.Sprintf("root/%02d-a", i)] = []byte(b)
+		files[fmt.Sprintf("root/%02d-b", i)] = []byte(b)
+		files[fmt.Sprintf("root/%02d-c", i)] = []byte(strings.Repeat("b", i))
+	}
+	files["root/unique"] = []byte(strings.Repeat("c", 100))
+	fs := filesys.Map(files, nil)
+
+	sums, err := FilterDir("root", &Options{FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	if _, ok := sums.Estimate(); ok {
+		t.Errorf("1: Estimate() ok = true; want false without SamplePercent")
+	}
+	want := sums.Stats().NumDupBytes
+
+	sums, err = FilterDir("root", &Options{SamplePercent: 100, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	e, ok := sums.Estimate()
+	if !ok || e.DupBytes != want || e.Low != want || e.High != want {
+		t.Errorf("2: Estimate() = %+v, %v; want exactly %d bytes", e, ok, want)
+	}
+	if e.Groups != 20 || e.SampledGroups != 20 {
+		t.Errorf("2: sampled %d of %d sizes; want 20 of 20", e.SampledGroups, e.Groups)
+	}
+
+	sums, err = FilterDir("root", &Options{SamplePercent: 25, seed: 1, FileSystem: fs})
+	checkErrors(t, "3: ", err, nil)
+	e, ok = sums.Estimate()
+	if !ok || e.Groups != 20 || e.SampledGroups != 5 {
+		t.Fatalf("3: Estimate() = %+v, %v; want 5 of 20 sizes sampled", e, ok)
+	}
+	if e.Low > want || e.High < want || e.Low > e.DupBytes || e.High < e.DupBytes {
+		t.Errorf("3: Estimate() = %+v; want %d bytes within [Low, High]", e, want)
+	}
+	if n := sums.Stats().NumFiles; n != 15 {
+		t.Errorf("3: evaluated %d files; want 15", n)
+	}
+}
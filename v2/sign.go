@@ -0,0 +1,104 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+)
+
+// ErrBadSignature is returned by ReadSignedIndex if an index does not match
+// its signature.
+var ErrBadSignature = errors.New("dedup: index signature verification failed")
+
+// WriteSignedIndex is like WriteIndex, but also signs the index with key and
+// writes the base64-encoded Ed25519 signature to sig.
+func (s *Sums) WriteSignedIndex(w, sig io.Writer, key ed25519.PrivateKey) error {
+	var buf bytes.Buffer
+	if err := s.WriteIndex(&buf); err != nil {
+		return err
+	}
+	b := ed25519.Sign(key, buf.Bytes())
+	if _, err := w.Write(buf.Bytes()); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(sig, base64.StdEncoding.EncodeToString(b))
+	return err
+}
+
+// ReadSignedIndex is like ReadIndex, but first verifies the index read from r
+// against the base64-encoded Ed25519 signature read from sig using key. If
+// verification fails, ReadSignedIndex returns ErrBadSignature.
+func ReadSignedIndex(r, sig io.Reader, key ed25519.PublicKey) (*Sums, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+	enc, err := ioutil.ReadAll(sig)
+	if err != nil {
+		return nil, err
+	}
+	b, err := base64.StdEncoding.DecodeString(string(bytes.TrimSpace(enc)))
+	if err != nil || !ed25519.Verify(key, data, b) {
+		return nil, ErrBadSignature
+	}
+	return ReadIndex(bytes.NewReader(data))
+}
+
+// MarshalPrivateKey encodes key as a PEM block of type "PRIVATE KEY".
+func MarshalPrivateKey(key ed25519.PrivateKey) ([]byte, error) {
+	der, err := x509.MarshalPKCS8PrivateKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), nil
+}
+
+// MarshalPublicKey encodes key as a PEM block of type "PUBLIC KEY".
+func MarshalPublicKey(key ed25519.PublicKey) ([]byte, error) {
+	der, err := x509.MarshalPKIXPublicKey(key)
+	if err != nil {
+		return nil, err
+	}
+	return pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}), nil
+}
+
+// ParsePrivateKey decodes an Ed25519 private key encoded by
+// MarshalPrivateKey.
+func ParsePrivateKey(b []byte) (ed25519.PrivateKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PRIVATE KEY" {
+		return nil, errors.New("dedup: no PEM private key found")
+	}
+	k, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PrivateKey)
+	if !ok {
+		return nil, errors.New("dedup: not an Ed25519 private key")
+	}
+	return key, nil
+}
+
+// ParsePublicKey decodes an Ed25519 public key encoded by MarshalPublicKey.
+func ParsePublicKey(b []byte) (ed25519.PublicKey, error) {
+	block, _ := pem.Decode(b)
+	if block == nil || block.Type != "PUBLIC KEY" {
+		return nil, errors.New("dedup: no PEM public key found")
+	}
+	k, err := x509.ParsePKIXPublicKey(block.Bytes)
+	if err != nil {
+		return nil, err
+	}
+	key, ok := k.(ed25519.PublicKey)
+	if !ok {
+		return nil, errors.New("dedup: not an Ed25519 public key")
+	}
+	return key, nil
+}
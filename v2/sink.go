@@ -0,0 +1,142 @@
+package dedup
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"os"
+	"sync"
+	"time"
+)
+
+// Result describes a file that has been evaluated.
+type Result struct {
+	Path string
+	Info os.FileInfo
+	Sum  Digest
+	Dup  bool   // Whether Sum had been seen before, or is in Options.Canonical.
+	Link string // Path of the symbolic link that led to the file at Path, if any.
+
+	Canonical []*File // Canonical copies of the file, if Options.Canonical is set.
+
+	Read    *ReadStats        // How the file was read, if Options.TimeReads is set.
+	Chunks  []Chunk           // Content-defined chunks of the file, if Options.ChunkMode is set.
+	Digests map[string]Digest // Digests of the file, if Options.Digests is set; see File.Digests.
+}
+
+// ReadStats describes how a file was read.
+type ReadStats struct {
+	Duration time.Duration // Time spent opening and reading the file, including retries.
+	Retries  int           // Number of failed attempts to read the file before it was read.
+}
+
+// Sink is the interface implemented by types that receive results as files
+// are evaluated. Write and Flush are never called concurrently by Filter or
+// FilterDir; Flush is called once, after the last call to Write.
+type Sink interface {
+	Write(r Result) error
+	Flush() error
+}
+
+// WriterSink is a Sink that writes the path of each result to an underlying
+// io.Writer, one per line. Output is buffered until Flush is called.
+type WriterSink struct {
+	w   io.Writer
+	buf *bufio.Writer
+}
+
+var _ Sink = (*WriterSink)(nil)
+
+// NewWriterSink returns a *WriterSink that writes to w.
+func NewWriterSink(w io.Writer) *WriterSink {
+	return &WriterSink{w: w, buf: bufio.NewWriter(w)}
+}
+
+// CreateFileSink creates or truncates the file located at path and returns a
+// *WriterSink that writes to it. The caller should Close the sink when done.
+func CreateFileSink(path string) (*WriterSink, error) {
+	f, err := os.Create(path)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(f), nil
+}
+
+// DialSink connects to address on the named network as net.Dial does and
+// returns a *WriterSink that writes to the connection. The caller should Close
+// the sink when done.
+func DialSink(network, address string) (*WriterSink, error) {
+	conn, err := net.Dial(network, address)
+	if err != nil {
+		return nil, err
+	}
+	return NewWriterSink(conn), nil
+}
+
+func (s *WriterSink) Write(r Result) error {
+	_, err := s.buf.WriteString(r.Path + "\n")
+	return err
+}
+
+func (s *WriterSink) Flush() error { return s.buf.Flush() }
+
+// Close flushes s and closes the underlying io.Writer if it implements
+// io.Closer.
+func (s *WriterSink) Close() error {
+	err := s.Flush()
+	if c, ok := s.w.(io.Closer); ok {
+		if cerr := c.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// Collector is a Sink that stores results in memory, up to a limit. It is
+// safe for concurrent use.
+type Collector struct {
+	mu      sync.Mutex
+	max     int
+	results []Result
+	dropped int
+}
+
+var _ Sink = (*Collector)(nil)
+
+// NewCollector returns a *Collector that stores at most max results; any
+// further results are counted but discarded. If max is negative, the number
+// of results stored is not limited.
+func NewCollector(max int) *Collector {
+	return &Collector{max: max}
+}
+
+func (c *Collector) Write(r Result) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if c.max >= 0 && len(c.results) >= c.max {
+		c.dropped++
+	} else {
+		c.results = append(c.results, r)
+	}
+	return nil
+}
+
+func (c *Collector) Flush() error { return nil }
+
+// Results returns a copy of the results stored by c, in the order received.
+func (c *Collector) Results() []Result {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return append([]Result(nil), c.results...)
+}
+
+// Dropped reports the number of results discarded because the limit was
+// reached.
+func (c *Collector) Dropped() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	return c.dropped
+}
@@ -0,0 +1,188 @@
+package dedup
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterSinks(t *testing.T) {
+	uniq, dup := NewCollector(-1), NewCollector(-1)
+	_, err := FilterDir("root/foo", &Options{Recursive: true, UniqSink: uniq, DupSink: dup, FileSystem: FS})
+	checkErrors(t, "", err, []string{
+		"open root/foo/baz/err: permission denied",
+		"open root/foo/err: permission denied",
+	})
+
+	if n := len(uniq.Results()); n != 6 { // root/foo/**/* less 2 errors
+		t.Errorf("len(uniq.Results()) = %d; want 6", n)
+	}
+	for _, r := range uniq.Results() {
+		if r.Dup || r.Info == nil || r.Sum == "" {
+			t.Errorf("unexpected uniq result: %+v", r)
+		}
+	}
+	if n := len(dup.Results()); n != 0 {
+		t.Errorf("len(dup.Results()) = %d; want 0", n)
+	}
+}
+
+func TestFilterOnFile(t *testing.T) {
+	var files, dups int
+	var failed []string
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: FS, OnFile: func(file File, sum Digest, dup bool, err error) {
+		switch {
+		case err != nil:
+			if sum != "" || dup {
+				t.Errorf("OnFile(%q, %x, %t, %v) for an error", file.Path, sum, dup, err)
+			}
+			failed = append(failed, file.Path)
+		case file.Info == nil || sum == "":
+			t.Errorf("OnFile(%q, %x, %t, nil) without Info or Sum", file.Path, sum, dup)
+		case dup:
+			dups++
+			fallthrough
+		default:
+			files++
+		}
+	}})
+	if err == nil {
+		t.Fatal("FilterDir() = nil error; want permission errors")
+	}
+	st := sums.Stats()
+	if files != int(st.NumFiles) || dups != int(st.NumDupFiles) {
+		t.Errorf("OnFile called for %d files, %d duplicates; want %d, %d", files, dups, st.NumFiles, st.NumDupFiles)
+	}
+	sort.Strings(failed)
+	if want := []string{"root/err", "root/foo/baz/err", "root/foo/err", "root/qux/err", "root/qux/quuz/err"}; !reflect.DeepEqual(failed, want) {
+		t.Errorf("OnFile called with errors for %q; want %q", failed, want)
+	}
+}
+
+func TestCollector(t *testing.T) {
+	c := NewCollector(2)
+	for _, path := range []string{"a", "b", "c"} {
+		if err := c.Write(Result{Path: path}); err != nil {
+			t.Fatalf("Write() = %v", err)
+		}
+	}
+	if got := c.Results(); len(got) != 2 || got[0].Path != "a" || got[1].Path != "b" {
+		t.Errorf("Results() = %+v; want a, b", got)
+	}
+	if got := c.Dropped(); got != 1 {
+		t.Errorf("Dropped() = %d; want 1", got)
+	}
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "out")
+	s, err := CreateFileSink(path)
+	if err != nil {
+		t.Fatalf("CreateFileSink() = %v", err)
+	}
+	_, _ = FilterDir("root", &Options{UniqSink: s, DupSink: s, FileSystem: FS})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+
+	b, _ := ioutil.ReadFile(path)
+	lines := strings.Split(strings.TrimSpace(string(b)), "\n")
+	sort.Strings(lines)
+	if got, want := strings.Join(lines, " "), "root/black root/dup2 root/link root/red"; got != want {
+		t.Errorf("sink wrote %q; want %q", got, want)
+	}
+}
+
+func TestDialSink(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Skipf("cannot listen: %v", err)
+	}
+	defer l.Close()
+	received := make(chan string)
+	go func() {
+		conn, err := l.Accept()
+		if err != nil {
+			close(received)
+			return
+		}
+		b, _ := ioutil.ReadAll(conn)
+		received <- string(b)
+	}()
+
+	s, err := DialSink("tcp", l.Addr().String())
+	if err != nil {
+		t.Fatalf("DialSink() = %v", err)
+	}
+	_ = s.Write(Result{Path: "a"})
+	_ = s.Write(Result{Path: "b"})
+	if err := s.Close(); err != nil {
+		t.Fatalf("Close() = %v", err)
+	}
+	if got := <-received; got != "a\nb\n" {
+		t.Errorf("received %q; want %q", got, "a\nb\n")
+	}
+}
+
+// flakyFS simulates files that fail to open a number of times before they
+// can be read.
+type flakyFS struct {
+	filesys.FileSystem
+	mu       sync.Mutex
+	failures map[string]int
+}
+
+func (fs *flakyFS) Open(path string) (filesys.File, error) {
+	fs.mu.Lock()
+	defer fs.mu.Unlock()
+	if fs.failures[path] > 0 {
+		fs.failures[path]--
+		return nil, &os.PathError{Op: "open", Path: path, Err: errors.New("input/output error")}
+	}
+	return fs.FileSystem.Open(path)
+}
+
+func TestFilterReadRetries(t *testing.T) {
+	defer func(d time.Duration) { readRetryDelay = d }(readRetryDelay)
+	readRetryDelay = 0
+
+	fs := &flakyFS{
+		FileSystem: filesys.Map(map[string][]byte{
+			"root/ok":    []byte("ok"),
+			"root/flaky": []byte("flaky"),
+			"root/bad":   []byte("bad"),
+		}, nil),
+		failures: map[string]int{"root/flaky": 2, "root/bad": 5},
+	}
+	c := NewCollector(-1)
+	_, err := FilterDir("root", &Options{ReadRetries: 2, TimeReads: true, UniqSink: c, FileSystem: fs})
+	checkErrors(t, "", err, []string{
+		"open root/bad: input/output error",
+	})
+
+	retries := make(map[string]int)
+	for _, r := range c.Results() {
+		if r.Read == nil {
+			t.Fatalf("%s: Read = nil", r.Path)
+		}
+		retries[r.Path] = r.Read.Retries
+	}
+	if len(retries) != 2 || retries["root/ok"] != 0 || retries["root/flaky"] != 2 {
+		t.Errorf("retries = %v; want root/ok: 0, root/flaky: 2", retries)
+	}
+}
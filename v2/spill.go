@@ -0,0 +1,291 @@
+package dedup
+
+import (
+	"bufio"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// spillBuckets is the number of files among which the files of a spilled
+// Sums are divided by the first byte of their checksums, so that each bucket
+// may be read into memory on its own, and buckets read in order yield
+// checksums in order.
+const spillBuckets = 64
+
+// spill holds the files of a Sums created by NewSpilledSums on disk: each is
+// appended to the bucket for its checksum as a line of JSON, as it is
+// recorded in an index, and only the number of files under each checksum, and
+// the files removed since, are held in memory.
+type spill struct {
+	dir     string
+	counts  map[Digest]int
+	removed map[spillKey]int       // Number of the first records of each file to skip, having been removed.
+	buckets [spillBuckets]*os.File // Opened once written to.
+	bufs    [spillBuckets]*bufio.Writer
+	err     error // First error writing or reading the buckets.
+}
+
+type spillKey struct {
+	sum  Digest
+	path string
+}
+
+// NewSpilledSums returns a *Sums whose files are held in temporary files in
+// a new directory within dir, rather than in memory, for evaluations of more
+// files than fit in memory; see Options.SpillDir. Reading the files of the
+// Sums, as Range, Get, DupGroups, and the methods that write them do, reads
+// the temporary files one at a time, so that WriteAllDup, WriteTemplate, and
+// WriteReport, except as JSON, keep in memory only the files that share the
+// first byte of their checksums.
+// Files that are hard links to one another are not recognized as such, and
+// File.Links is not recorded, nor are files named by the links that led to
+// them under Options.LinkPaths. Call Close to remove the temporary files once
+// the Sums is no longer needed.
+func NewSpilledSums(dir string) (*Sums, error) {
+	s := NewSums()
+	if err := s.spillTo(dir); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// spillTo makes s, which must be empty, hold its files in a new directory
+// within dir.
+func (s *Sums) spillTo(dir string) error {
+	tmp, err := ioutil.TempDir(dir, "dedup-spill")
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.spill = &spill{dir: tmp, counts: make(map[Digest]int), removed: make(map[spillKey]int)}
+	return nil
+}
+
+// Close removes the temporary files of a Sums returned by NewSpilledSums, or
+// evaluated into under Options.SpillDir, after which its files may no longer
+// be read. It returns the first error that occurred writing or reading them,
+// if any. Close has no effect on other Sums.
+func (s *Sums) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	sp := s.spill
+	if sp == nil || sp.dir == "" {
+		return nil
+	}
+	err := sp.err
+	for _, f := range sp.buckets {
+		if f != nil {
+			_ = f.Close()
+		}
+	}
+	if rerr := os.RemoveAll(sp.dir); err == nil {
+		err = rerr
+	}
+	sp.dir = ""
+	return err
+}
+
+// spillSums makes f evaluate into a spilled Sums under the SpillDir option.
+func spillSums(f filter, opts *Options) error {
+	if opts.SpillDir == "" {
+		return nil
+	}
+	return f.Sums().spillTo(opts.SpillDir)
+}
+
+func spillBucket(sum Digest) int {
+	if len(sum) == 0 {
+		return 0
+	}
+	return int(sum[0]) * spillBuckets / 256
+}
+
+// add appends file to the bucket of sum and returns the number of files
+// under sum once it is added.
+func (sp *spill) add(sum Digest, file *File) int {
+	i := spillBucket(sum)
+	if sp.bufs[i] == nil && sp.err == nil {
+		f, err := os.Create(filepath.Join(sp.dir, fmt.Sprint(i)))
+		if err != nil {
+			sp.err = err
+		} else {
+			sp.buckets[i] = f
+			sp.bufs[i] = bufio.NewWriter(f)
+		}
+	}
+	if sp.bufs[i] != nil {
+		b, err := json.Marshal(indexFile{
+			Sum:     hex.EncodeToString([]byte(sum)),
+			Path:    file.Path,
+			Size:    file.Info.Size(),
+			Mode:    file.Info.Mode(),
+			ModTime: file.Info.ModTime().UTC(),
+			Digests: hexDigests(file.Digests),
+		})
+		if err == nil {
+			_, err = sp.bufs[i].Write(append(b, '\n'))
+		}
+		if err != nil && sp.err == nil {
+			sp.err = err
+		}
+	}
+	sp.counts[sum]++
+	return sp.counts[sum]
+}
+
+// load returns the files under each checksum in bucket i for which keep
+// returns true, or every checksum if keep is nil, less those removed.
+func (sp *spill) load(i int, keep func(sum Digest) bool) map[Digest][]*File {
+	m := make(map[Digest][]*File)
+	if sp.bufs[i] == nil || sp.dir == "" {
+		return m
+	}
+	if err := sp.bufs[i].Flush(); err != nil {
+		sp.fail(err)
+		return m
+	}
+	f, err := os.Open(sp.buckets[i].Name())
+	if err != nil {
+		sp.fail(err)
+		return m
+	}
+	defer f.Close()
+
+	var skip map[spillKey]int // Records yet to skip of removed files.
+	r := bufio.NewReader(f)
+	for {
+		line, err := r.ReadBytes('\n')
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			sp.fail(err)
+			break
+		}
+		var x indexFile
+		if err := json.Unmarshal(line, &x); err != nil {
+			sp.fail(err)
+			break
+		}
+		sum, file, err := indexedFile(x)
+		if err != nil {
+			sp.fail(err)
+			break
+		}
+		if keep != nil && !keep(sum) {
+			continue
+		}
+		if key := (spillKey{sum, file.Path}); sp.removed[key] > 0 {
+			if skip == nil {
+				skip = make(map[spillKey]int)
+			}
+			if _, ok := skip[key]; !ok {
+				skip[key] = sp.removed[key]
+			}
+			if skip[key] > 0 {
+				skip[key]--
+				continue
+			}
+		}
+		m[sum] = append(m[sum], file)
+	}
+	return m
+}
+
+func (sp *spill) fail(err error) {
+	if sp.err == nil {
+		sp.err = fmt.Errorf("dedup: reading spilled files: %w", err)
+	}
+}
+
+// get returns the files under sum.
+func (sp *spill) get(sum Digest) []*File {
+	return sp.load(spillBucket(sum), func(s Digest) bool { return s == sum })[sum]
+}
+
+// remove records the files under sum located at path, or every file under
+// sum if path is empty, as removed, and returns them.
+func (sp *spill) remove(sum Digest, path string) []*File {
+	var removed []*File
+	for _, file := range sp.get(sum) {
+		if path == "" || file.Path == path {
+			sp.removed[spillKey{sum, file.Path}]++
+			removed = append(removed, file)
+			if path != "" {
+				break
+			}
+		}
+	}
+	if sp.counts[sum] -= len(removed); sp.counts[sum] <= 0 {
+		delete(sp.counts, sum)
+	}
+	return removed
+}
+
+// rangeBuckets calls f with the files under each checksum of each bucket in
+// turn for which keep returns true, or every checksum if keep is nil, with
+// the checksums of each bucket sorted if sorted is set, until f returns
+// false.
+func (sp *spill) rangeBuckets(keep func(sum Digest) bool, sorted bool, f func(sum Digest, files []*File) bool) {
+	for i := 0; i < spillBuckets; i++ {
+		m := sp.load(i, keep)
+		sums := make([]Digest, 0, len(m))
+		for sum := range m {
+			sums = append(sums, sum)
+		}
+		if sorted {
+			sort.Slice(sums, func(i, j int) bool { return sums[i] < sums[j] })
+		}
+		for _, sum := range sums {
+			if !f(sum, m[sum]) {
+				return
+			}
+		}
+	}
+}
+
+// spilledRemove updates the Stats of s, which is spilled, to account for the
+// removal of files under sum.
+func (s *Sums) spilledRemove(sum Digest, files []*File) {
+	n := s.spill.counts[sum] + len(files)
+	for _, file := range files {
+		numBytes := uint64(file.Info.Size())
+		s.r.NumFiles--
+		s.r.NumBytes -= numBytes
+		if n > 1 {
+			s.r.NumDupFiles--
+			s.r.NumDupBytes -= numBytes
+			s.r.ReclaimableBytes -= numBytes
+		}
+		n--
+	}
+}
+
+// indexedFile returns the checksum and File recorded as f in an index.
+func indexedFile(f indexFile) (Digest, *File, error) {
+	b, err := hex.DecodeString(f.Sum)
+	if err != nil || len(b) == 0 {
+		return "", nil, fmt.Errorf("invalid checksum %q for %q", f.Sum, f.Path)
+	}
+	file := &File{Path: f.Path, Info: &indexInfo{f}}
+	for name, digest := range f.Digests {
+		d, err := hex.DecodeString(digest)
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid %s digest %q for %q", name, digest, f.Path)
+		}
+		if file.Digests == nil {
+			file.Digests = make(map[string]Digest)
+		}
+		file.Digests[name] = Digest(d)
+	}
+	return Digest(b), file, nil
+}
@@ -0,0 +1,103 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"reflect"
+	"testing"
+)
+
+func TestFilterDirSpillDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	want, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	sums, _ := FilterDir("root", &Options{Recursive: true, SpillDir: dir, FileSystem: FS})
+	if got, want := untimed(sums.Stats()), untimed(want.Stats()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+	var got, wantBuf bytes.Buffer
+	_ = sums.WriteAllDup(&got)
+	_ = want.WriteAllDup(&wantBuf)
+	if got.String() != wantBuf.String() {
+		t.Errorf("WriteAllDup() wrote:\n%s\nwant:\n%s", got.String(), wantBuf.String())
+	}
+	if files, ok := sums.GetDigest(Dup1Sum); !ok || len(files) != 2 || files[0].Info.Size() != int64(len(Dup1)) {
+		t.Errorf("Get(Dup1Sum) = %d files, %v; want 2 of size %d", len(files), ok, len(Dup1))
+	}
+
+	if sums.Remove(Dup1Sum, "root/foo/bar/dup1") == nil {
+		t.Error("Remove(Dup1Sum, root/foo/bar/dup1) = nil; want the file")
+	}
+	want.Remove(Dup1Sum, "root/foo/bar/dup1")
+	if files, _ := sums.RemoveSum(Dup2Sum); len(files) != 3 {
+		t.Errorf("RemoveSum(Dup2Sum) = %d files; want 3", len(files))
+	}
+	want.RemoveSum(Dup2Sum)
+	if got, want := untimed(sums.Stats()), untimed(want.Stats()); !reflect.DeepEqual(got, want) {
+		t.Errorf("Stats() after removing = %v; want %v", got, want)
+	}
+	checkSums(t, "", sums, []string{
+		dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+	})
+
+	// A file removed and then added again is listed once.
+	file := fakeFile("root/qux/dup3", string(Dup3))
+	sums.Remove(Dup3Sum, file.Path)
+	sums.AppendDigest(Dup3Sum, file)
+	checkSums(t, "re-added: ", sums, []string{
+		dupString(Dup3Sum, "root/foo/dup3", "root/qux/dup3"),
+	})
+
+	if err := sums.Close(); err != nil {
+		t.Errorf("Close() = %v", err)
+	}
+	if names, _ := ioutil.ReadDir(dir); len(names) != 0 {
+		t.Errorf("%d files remain in %s after Close; want 0", len(names), dir)
+	}
+}
+
+func TestSpilledSumsOrder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	sums, err := NewSpilledSums(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sums.Close()
+	for i := 0; i < 200; i++ {
+		sum := sha1Sum([]byte(fmt.Sprint(i)))
+		sums.AppendDigest(sum, fakeFile(fmt.Sprintf("/a/%d", i), ""))
+		sums.AppendDigest(sum, fakeFile(fmt.Sprintf("/b/%d", i), ""))
+	}
+	groups := sums.DupGroups()
+	if len(groups) != 200 {
+		t.Fatalf("DupGroups() = %d groups; want 200", len(groups))
+	}
+	for i := 1; i < len(groups); i++ {
+		if groups[i-1].Sum >= groups[i].Sum {
+			t.Fatalf("DupGroups() not sorted: %x before %x", groups[i-1].Sum, groups[i].Sum)
+		}
+	}
+
+	sums.AppendDigest(sha1Sum([]byte("199")), fakeFile("/c/199", "large"))
+	sums.setGroupOrder(ByWastedBytes)
+	groups = sums.DupGroups()
+	if len(groups) != 200 || groups[0].Sum != sha1Sum([]byte("199")) {
+		t.Fatalf("DupGroups() by wasted bytes = %d groups starting with %x; want 200 starting with that of 199", len(groups), groups[0].Sum)
+	}
+	for i := 2; i < len(groups); i++ {
+		if groups[i-1].Sum >= groups[i].Sum {
+			t.Fatalf("DupGroups() by wasted bytes not sorted: %x before %x", groups[i-1].Sum, groups[i].Sum)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"time"
+)
+
+// sqliteSchema lists the tables of the databases written by WriteSQLite, in
+// the order they are written.
+var sqliteSchema = []struct{ name, sql string }{
+	{"files", "CREATE TABLE files (id INTEGER PRIMARY KEY, path TEXT NOT NULL, size INTEGER NOT NULL, mode TEXT NOT NULL, mtime TEXT NOT NULL, sum TEXT NOT NULL, link TEXT, group_id INTEGER REFERENCES dup_groups (id))"},
+	{"digests", "CREATE TABLE digests (file_id INTEGER NOT NULL REFERENCES files (id), name TEXT NOT NULL, digest TEXT NOT NULL)"},
+	{"dup_groups", "CREATE TABLE dup_groups (id INTEGER PRIMARY KEY, sum TEXT NOT NULL, size INTEGER NOT NULL, files INTEGER NOT NULL, wasted_bytes INTEGER NOT NULL)"},
+}
+
+// WriteSQLite writes every file in s to w as a SQLite 3 database, for
+// querying with the sqlite3 shell or any other SQLite client, with the
+// following tables:
+//
+//	files (id INTEGER PRIMARY KEY, path TEXT, size INTEGER, mode TEXT, mtime TEXT, sum TEXT, link TEXT, group_id INTEGER)
+//	digests (file_id INTEGER, name TEXT, digest TEXT)
+//	dup_groups (id INTEGER PRIMARY KEY, sum TEXT, size INTEGER, files INTEGER, wasted_bytes INTEGER)
+//
+// Files are numbered in the order of WriteIndex. Checksums and digests are
+// hex-encoded, modes are written as by os.FileMode.String, modification
+// times in UTC as by time.RFC3339Nano, and link is the path of the file that
+// a file is a hard link to, if any. The group_id of a file names its group
+// in dup_groups, which lists the groups of duplicates that DupGroups returns,
+// in the same order, or is NULL if it has none. The tables have no indexes;
+// for large databases, queries may be sped up by creating some, such as by
+//
+//	CREATE INDEX files_sum ON files (sum);
+//
+// The whole database is built in memory before it is written.
+func (s *Sums) WriteSQLite(w io.Writer) error {
+	groups := s.DupGroups()
+	groupIDs := make(map[string]int64, len(groups)) // By hex-encoded checksum.
+	dupGroups := new(sqliteTable)
+	for _, g := range groups {
+		groupIDs[hex.EncodeToString([]byte(g.Sum))] = dupGroups.insert(nil, hex.EncodeToString([]byte(g.Sum)), g.Files[0].Info.Size(), int64(len(g.Files)), int64(g.WastedBytes))
+	}
+
+	files, digests := new(sqliteTable), new(sqliteTable)
+	for _, f := range s.indexFiles() {
+		var link, groupID interface{}
+		if f.Link != "" {
+			link = f.Link
+		}
+		if id, ok := groupIDs[f.Sum]; ok {
+			groupID = id
+		}
+		id := files.insert(nil, f.Path, f.Size, f.Mode.String(), f.ModTime.Format(time.RFC3339Nano), f.Sum, link, groupID)
+		for _, name := range sortedKeys(f.Digests) {
+			digests.insert(id, name, f.Digests[name])
+		}
+	}
+
+	// Page 1 holds the header of the database and the schema, which names
+	// the root pages of the tables.
+	db := &sqliteDB{pages: [][]byte{make([]byte, sqlitePageSize)}}
+	var schema [][]byte
+	for i, t := range []*sqliteTable{files, digests, dupGroups} {
+		root := t.write(db)
+		record := sqliteRecord([]interface{}{"table", sqliteSchema[i].name, sqliteSchema[i].name, int64(root), sqliteSchema[i].sql})
+		schema = append(schema, sqliteCell(db, int64(i+1), record))
+	}
+	page := db.pages[0]
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1                 // Legacy journaling.
+	page[21], page[22], page[23] = 64, 32, 32 // Payload fractions, which must be these.
+	binary.BigEndian.PutUint32(page[24:], 1)  // File change counter.
+	binary.BigEndian.PutUint32(page[28:], uint32(len(db.pages)))
+	binary.BigEndian.PutUint32(page[40:], 1)       // Schema cookie.
+	binary.BigEndian.PutUint32(page[44:], 4)       // Schema format, for serial types 8 and 9.
+	binary.BigEndian.PutUint32(page[56:], 1)       // UTF-8.
+	binary.BigEndian.PutUint32(page[92:], 1)       // Version valid for, the file change counter.
+	binary.BigEndian.PutUint32(page[96:], 3031001) // SQLite version number.
+	writeSQLitePage(page, 100, sqliteTableLeaf, schema, 0)
+
+	for _, page := range db.pages {
+		if _, err := w.Write(page); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// WriteSQLiteFile writes the database that WriteSQLite writes to the file
+// located at pth, replacing it atomically as WriteAllDupToFile does.
+func (s *Sums) WriteSQLiteFile(pth string) error {
+	return writeFile(pth, 0644, s.WriteSQLite)
+}
+
+const sqlitePageSize = 4096
+
+// Types of b-tree pages.
+const (
+	sqliteTableInterior = 0x05
+	sqliteTableLeaf     = 0x0d
+)
+
+// sqliteDB holds the pages of a database being built, page n being
+// pages[n-1].
+type sqliteDB struct {
+	pages [][]byte
+}
+
+// alloc appends a page to db and returns its number.
+func (db *sqliteDB) alloc() (uint32, []byte) {
+	page := make([]byte, sqlitePageSize)
+	db.pages = append(db.pages, page)
+	return uint32(len(db.pages)), page
+}
+
+// sqliteTable holds the rows of a table being built, numbered from 1.
+type sqliteTable struct {
+	rows [][]interface{}
+}
+
+// insert adds a row of values, each nil, an int64, or a string, to t and
+// returns its rowid. A nil first value leaves the INTEGER PRIMARY KEY column
+// that it stands for to alias the rowid.
+func (t *sqliteTable) insert(values ...interface{}) int64 {
+	t.rows = append(t.rows, values)
+	return int64(len(t.rows))
+}
+
+// write writes the b-tree of t to pages of db, and returns its root page.
+func (t *sqliteTable) write(db *sqliteDB) uint32 {
+	var children []sqliteChild
+	var cells [][]byte
+	used := 8 // Size of the header of a leaf page.
+	flush := func(key int64) {
+		n, page := db.alloc()
+		writeSQLitePage(page, 0, sqliteTableLeaf, cells, 0)
+		children = append(children, sqliteChild{page: n, key: key})
+		cells, used = nil, 8
+	}
+	for i, values := range t.rows {
+		rowid := int64(i + 1)
+		cell := sqliteCell(db, rowid, sqliteRecord(values))
+		if used+2+len(cell) > sqlitePageSize {
+			flush(rowid - 1)
+		}
+		cells = append(cells, cell)
+		used += 2 + len(cell)
+	}
+	if len(cells) > 0 || len(children) == 0 {
+		flush(int64(len(t.rows)))
+	}
+	for len(children) > 1 {
+		children = writeSQLiteInterior(db, children)
+	}
+	return children[0].page
+}
+
+// sqliteChild is a page of a b-tree along with the greatest rowid in it.
+type sqliteChild struct {
+	page uint32
+	key  int64
+}
+
+// writeSQLiteInterior writes the interior pages of a b-tree whose pages one
+// level below are children, and returns them, to be written in turn.
+func writeSQLiteInterior(db *sqliteDB, children []sqliteChild) []sqliteChild {
+	var parents []sqliteChild
+	var cells [][]byte
+	used := 12 // Size of the header of an interior page.
+	right := children[0]
+	for _, child := range children[1:] {
+		cell := appendSQLiteVarint(appendUint32(nil, right.page), uint64(right.key))
+		if used+2+len(cell) > sqlitePageSize {
+			n, page := db.alloc()
+			writeSQLitePage(page, 0, sqliteTableInterior, cells, right.page)
+			parents = append(parents, sqliteChild{page: n, key: right.key})
+			cells, used = nil, 12
+		} else {
+			cells = append(cells, cell)
+			used += 2 + len(cell)
+		}
+		right = child
+	}
+	n, page := db.alloc()
+	writeSQLitePage(page, 0, sqliteTableInterior, cells, right.page)
+	return append(parents, sqliteChild{page: n, key: right.key})
+}
+
+// writeSQLitePage writes a b-tree page of type typ holding cells to page,
+// starting at off, and pointing right to its rightmost child if it is an
+// interior page.
+func writeSQLitePage(page []byte, off int, typ byte, cells [][]byte, right uint32) {
+	hdr := page[off:]
+	hdr[0] = typ
+	binary.BigEndian.PutUint16(hdr[3:], uint16(len(cells)))
+	ptrs := 8
+	if typ == sqliteTableInterior {
+		binary.BigEndian.PutUint32(hdr[8:], right)
+		ptrs = 12
+	}
+	end := len(page)
+	for i, cell := range cells {
+		end -= len(cell)
+		copy(page[end:], cell)
+		binary.BigEndian.PutUint16(hdr[ptrs+2*i:], uint16(end))
+	}
+	binary.BigEndian.PutUint16(hdr[5:], uint16(end))
+}
+
+// sqliteCell returns the cell of a table leaf holding the row rowid with the
+// record payload, spilling the part of payload that does not fit a page to
+// overflow pages of db.
+func sqliteCell(db *sqliteDB, rowid int64, payload []byte) []byte {
+	cell := appendSQLiteVarint(nil, uint64(len(payload)))
+	cell = appendSQLiteVarint(cell, uint64(rowid))
+	const usable = sqlitePageSize
+	maxLocal := usable - 35
+	if len(payload) <= maxLocal {
+		return append(cell, payload...)
+	}
+	minLocal := (usable-12)*32/255 - 23
+	local := minLocal + (len(payload)-minLocal)%(usable-4)
+	if local > maxLocal {
+		local = minLocal
+	}
+	cell = append(cell, payload[:local]...)
+	overflow := payload[local:]
+	first, page := db.alloc()
+	for {
+		n := copy(page[4:], overflow)
+		if overflow = overflow[n:]; len(overflow) == 0 {
+			break
+		}
+		next, nextPage := db.alloc()
+		binary.BigEndian.PutUint32(page[:4], next)
+		page = nextPage
+	}
+	return appendUint32(cell, first)
+}
+
+func appendUint32(b []byte, v uint32) []byte {
+	return append(b, byte(v>>24), byte(v>>16), byte(v>>8), byte(v))
+}
+
+// sqliteRecord returns values, each nil, an int64, or a string, in the
+// record format of SQLite.
+func sqliteRecord(values []interface{}) []byte {
+	var types, data []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendSQLiteVarint(types, 0)
+		case int64:
+			if v == 0 || v == 1 {
+				types = appendSQLiteVarint(types, 8+uint64(v))
+				break
+			}
+			typ, size := uint64(6), 8
+			for i, n := range []int{1, 2, 3, 4, 6} {
+				if limit := int64(1) << (8*n - 1); -limit <= v && v < limit {
+					typ, size = uint64(i+1), n
+					break
+				}
+			}
+			types = appendSQLiteVarint(types, typ)
+			for i := size - 1; i >= 0; i-- {
+				data = append(data, byte(v>>(8*i)))
+			}
+		case string:
+			types = appendSQLiteVarint(types, 13+2*uint64(len(v)))
+			data = append(data, v...)
+		}
+	}
+	// The size of the header includes the varint giving it.
+	n := len(types) + 1
+	for len(appendSQLiteVarint(nil, uint64(n))) > n-len(types) {
+		n++
+	}
+	record := appendSQLiteVarint(nil, uint64(n))
+	record = append(record, types...)
+	return append(record, data...)
+}
+
+// appendSQLiteVarint appends v to b as a SQLite variable-length integer: big
+// endian groups of 7 bits, the high bit of each byte but the last set, with
+// a ninth byte holding 8 bits if needed.
+func appendSQLiteVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	n := 0
+	for {
+		buf[n] = byte(v & 0x7f)
+		n++
+		if v >>= 7; v == 0 {
+			break
+		}
+	}
+	for i := n - 1; i >= 0; i-- {
+		if i > 0 {
+			buf[i] |= 0x80
+		}
+		b = append(b, buf[i])
+	}
+	return b
+}
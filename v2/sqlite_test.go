@@ -0,0 +1,190 @@
+package dedup
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSumsWriteSQLite(t *testing.T) {
+	sums, _ := FilterDir("root", &Options{Recursive: true, Digests: []string{"md5"}, FileSystem: FS})
+	var b bytes.Buffer
+	if err := sums.WriteSQLite(&b); err != nil {
+		t.Fatal(err)
+	}
+	tables := readSQLite(t, b.Bytes())
+
+	st := sums.Stats()
+	if n := len(tables["files"]); n != int(st.NumFiles) {
+		t.Errorf("files has %d rows; want %d", n, st.NumFiles)
+	}
+	if n := len(tables["digests"]); n != int(st.NumFiles) {
+		t.Errorf("digests has %d rows; want %d", n, st.NumFiles)
+	}
+	var groups []string
+	for _, row := range tables["dup_groups"] {
+		groups = append(groups, fmt.Sprint(row[1:]...))
+	}
+	var want []string
+	for _, g := range sums.DupGroups() {
+		want = append(want, fmt.Sprint(hex.EncodeToString([]byte(g.Sum)), g.Files[0].Info.Size(), len(g.Files), g.WastedBytes))
+	}
+	if !reflect.DeepEqual(groups, want) {
+		t.Errorf("dup_groups = %q; want %q", groups, want)
+	}
+	for _, row := range tables["files"] {
+		if path, groupID := row[1].(string), row[7]; strings.HasPrefix(path[strings.LastIndex(path, "/"):], "/dup") != (groupID != nil) {
+			t.Errorf("%s: group_id = %v", path, groupID)
+		}
+	}
+}
+
+func TestSumsWriteSQLiteLarge(t *testing.T) {
+	sums := NewSums()
+	long := "/" + strings.Repeat("long/", 2000) // Spilled to overflow pages.
+	for i := 0; i < 20000; i++ {
+		path := fmt.Sprintf("/%05d", i)
+		if i == 1234 {
+			path = long
+		}
+		sums.AppendDigest(sha1Sum([]byte(fmt.Sprint(i%10000))), fakeFile(path, fmt.Sprint(i%10000)))
+	}
+	var b bytes.Buffer
+	if err := sums.WriteSQLite(&b); err != nil {
+		t.Fatal(err)
+	}
+	tables := readSQLite(t, b.Bytes())
+	files := tables["files"]
+	if len(files) != 20000 || len(tables["dup_groups"]) != 10000 {
+		t.Fatalf("files has %d rows, dup_groups %d; want 20000, 10000", len(files), len(tables["dup_groups"]))
+	}
+	var found bool
+	for _, row := range files {
+		found = found || row[1] == long
+	}
+	if !found {
+		t.Errorf("files has no row for the long path")
+	}
+}
+
+// readSQLite returns the rows of the tables of the SQLite database db,
+// written by WriteSQLite, by name.
+func readSQLite(t *testing.T, db []byte) map[string][][]interface{} {
+	t.Helper()
+	if !bytes.HasPrefix(db, []byte("SQLite format 3\x00")) || len(db)%sqlitePageSize != 0 {
+		t.Fatalf("invalid database of %d bytes", len(db))
+	}
+	if n := binary.BigEndian.Uint32(db[28:]); int(n) != len(db)/sqlitePageSize {
+		t.Fatalf("header gives %d pages; want %d", n, len(db)/sqlitePageSize)
+	}
+	page := func(n uint32) []byte { return db[(n-1)*sqlitePageSize : n*sqlitePageSize] }
+	var rows func(n uint32, off int, last int64) ([][]interface{}, int64)
+	rows = func(n uint32, off int, last int64) (rs [][]interface{}, _ int64) {
+		p := page(n)
+		hdr := p[off:]
+		ncells := int(binary.BigEndian.Uint16(hdr[3:]))
+		switch hdr[0] {
+		case sqliteTableInterior:
+			var ptrs []uint32
+			for i := 0; i < ncells; i++ {
+				cell := p[binary.BigEndian.Uint16(hdr[12+2*i:]):]
+				ptrs = append(ptrs, binary.BigEndian.Uint32(cell))
+			}
+			ptrs = append(ptrs, binary.BigEndian.Uint32(hdr[8:]))
+			for _, child := range ptrs {
+				var r [][]interface{}
+				r, last = rows(child, 0, last)
+				rs = append(rs, r...)
+			}
+			return rs, last
+		case sqliteTableLeaf:
+			for i := 0; i < ncells; i++ {
+				cell := p[binary.BigEndian.Uint16(hdr[8+2*i:]):]
+				size, n := sqliteVarint(cell)
+				rowid, m := sqliteVarint(cell[n:])
+				if int64(rowid) <= last {
+					t.Fatalf("rowid %d after %d", rowid, last)
+				}
+				last = int64(rowid)
+				payload := cell[n+m:]
+				if int(size) <= sqlitePageSize-35 {
+					payload = payload[:size]
+				} else {
+					minLocal := (sqlitePageSize-12)*32/255 - 23
+					local := minLocal + (int(size)-minLocal)%(sqlitePageSize-4)
+					if local > sqlitePageSize-35 {
+						local = minLocal
+					}
+					payload = append([]byte(nil), payload[:local]...)
+					for next := binary.BigEndian.Uint32(cell[n+m+local:]); next != 0; {
+						p := page(next)
+						payload = append(payload, p[4:]...)
+						next = binary.BigEndian.Uint32(p)
+					}
+					payload = payload[:size]
+				}
+				row := sqliteValues(t, payload)
+				if row[0] == nil {
+					row[0] = int64(rowid)
+				}
+				rs = append(rs, row)
+			}
+			return rs, last
+		}
+		t.Fatalf("page %d has type %#x", n, hdr[0])
+		return nil, 0
+	}
+	schema, _ := rows(1, 100, 0)
+	tables := make(map[string][][]interface{})
+	for _, row := range schema {
+		tables[row[1].(string)], _ = rows(uint32(row[3].(int64)), 0, 0)
+	}
+	return tables
+}
+
+// sqliteValues decodes the values of the SQLite record b.
+func sqliteValues(t *testing.T, b []byte) []interface{} {
+	size, n := sqliteVarint(b)
+	types, data := b[n:size], b[size:]
+	var values []interface{}
+	for len(types) > 0 {
+		typ, n := sqliteVarint(types)
+		types = types[n:]
+		switch {
+		case typ == 0:
+			values = append(values, nil)
+		case typ == 8 || typ == 9:
+			values = append(values, int64(typ-8))
+		case typ >= 1 && typ <= 6:
+			size := []int{1, 2, 3, 4, 6, 8}[typ-1]
+			v := int64(int8(data[0]))
+			for _, c := range data[1:size] {
+				v = v<<8 | int64(c)
+			}
+			values, data = append(values, v), data[size:]
+		case typ >= 13 && typ%2 == 1:
+			size := (typ - 13) / 2
+			values, data = append(values, string(data[:size])), data[size:]
+		default:
+			t.Fatalf("unexpected serial type %d", typ)
+		}
+	}
+	return values
+}
+
+// sqliteVarint decodes the SQLite variable-length integer at the start of b
+// and returns it along with its length.
+func sqliteVarint(b []byte) (uint64, int) {
+	var v uint64
+	for i := 0; i < 8; i++ {
+		v = v<<7 | uint64(b[i]&0x7f)
+		if b[i] < 0x80 {
+			return v, i + 1
+		}
+	}
+	return v<<8 | uint64(b[8]), 9
+}
@@ -0,0 +1,46 @@
+package dedup
+
+import "errors"
+
+// ErrSkip may be returned by a Stage or Matcher to skip a file without
+// reporting an error.
+var ErrSkip = errors.New("dedup: skip file")
+
+// Stage is the interface implemented by custom steps in the evaluation of
+// each file, such as virus scanning or tagging. Process is called from
+// multiple goroutines concurrently, so implementations must be safe for
+// concurrent use.
+type Stage interface {
+	// Process examines, and may modify, the result for a file. If it
+	// returns ErrSkip, evaluation of the file stops silently; any other
+	// non-nil error stops evaluation of the file and is reported.
+	Process(r *Result) error
+}
+
+// StageFunc is an adapter to allow the use of an ordinary function as a
+// Stage.
+type StageFunc func(r *Result) error
+
+var _ Stage = StageFunc(nil)
+
+func (f StageFunc) Process(r *Result) error { return f(r) }
+
+// Stages groups custom steps by the point in the evaluation of each file at
+// which they are run: files are listed, stat'ed, hashed by the Matcher,
+// grouped into Sums, and finally reported to the writers and sinks in
+// Options. The stages at each point are run in order.
+type Stages struct {
+	Stat   []Stage // Run before the file is read; Path and Info are set.
+	Hash   []Stage // Run before the file is grouped; Sum is set too.
+	Report []Stage // Run before the file is reported; Dup and Canonical are set too.
+}
+
+// process runs each stage in stages on r, stopping at the first error.
+func process(stages []Stage, r *Result) error {
+	for _, s := range stages {
+		if err := s.Process(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
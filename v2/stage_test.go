@@ -0,0 +1,42 @@
+package dedup
+
+import (
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestFilterStages(t *testing.T) {
+	var mu sync.Mutex
+	var reported []string
+	stages := &Stages{
+		Stat: []Stage{StageFunc(func(r *Result) error {
+			if strings.HasSuffix(r.Path, "/err") {
+				return ErrSkip
+			}
+			return nil
+		})},
+		Hash: []Stage{StageFunc(func(r *Result) error {
+			if strings.HasSuffix(r.Path, "/red") {
+				return errors.New("infected: " + r.Path)
+			}
+			return nil
+		})},
+		Report: []Stage{StageFunc(func(r *Result) error {
+			mu.Lock()
+			defer mu.Unlock()
+			reported = append(reported, r.Path)
+			return nil
+		})},
+	}
+
+	sums, err := FilterDir("root", &Options{Stages: stages, FileSystem: FS})
+	checkErrors(t, "", err, []string{
+		"infected: root/red",
+	})
+	checkSums(t, "", sums, nil)
+	if got := sums.Stats().NumFiles; got != uint64(len(reported)) || got != 3 {
+		t.Errorf("NumFiles = %d, reported %v; want 3 of each", got, reported)
+	}
+}
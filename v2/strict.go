@@ -0,0 +1,44 @@
+package dedup
+
+import (
+	"encoding/binary"
+	"os"
+)
+
+// StrictMatch selects the metadata that files must share, besides their
+// checksums, to be considered duplicates under Options.StrictMatch, such as
+// to verify that a backup preserved it rather than to find wasted space.
+type StrictMatch struct {
+	ModTime bool // Modification times, to the nanosecond that the file system records.
+	Mode    bool // Permissions and mode bits.
+	Owner   bool // User and group IDs of the owners, where known; see File.Owner.
+}
+
+// enabled reports whether m selects any metadata.
+func (m StrictMatch) enabled() bool {
+	return m != StrictMatch{}
+}
+
+// key returns sum followed by the metadata of the file described by info
+// that m selects, so that only files sharing both share the key.
+func (m StrictMatch) key(sum Digest, info os.FileInfo) Digest {
+	b := []byte(sum)
+	if m.ModTime {
+		b = appendUint64(b, uint64(info.ModTime().UnixNano()))
+	}
+	if m.Mode {
+		b = appendUint64(b, uint64(info.Mode()))
+	}
+	if m.Owner {
+		if uid, gid, ok := owner(info); ok {
+			b = appendUint64(b, uint64(uid)<<32|uint64(uint32(gid)))
+		}
+	}
+	return Digest(b)
+}
+
+func appendUint64(b []byte, n uint64) []byte {
+	var x [8]byte
+	binary.BigEndian.PutUint64(x[:], n)
+	return append(b, x[:]...)
+}
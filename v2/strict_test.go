@@ -0,0 +1,34 @@
+package dedup
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirStrictMatch(t *testing.T) {
+	old, now := time.Unix(1e9, 0), time.Unix(2e9, 0)
+	fs := timeFS{filesys.Map(map[string][]byte{
+		"root/a":      []byte("dup"),
+		"root/b":      []byte("dup"),
+		"root/c":      []byte("dup"),
+		"root/unique": []byte("u"),
+	}, nil), func(path string, n int) time.Time {
+		if path == "root/c" {
+			return old
+		}
+		return now
+	}, new(sync.Mutex), make(map[string]int)}
+
+	sums, _ := FilterDir("root", &Options{FileSystem: fs})
+	if got := sums.Stats().NumDupFiles; got != 2 {
+		t.Errorf("1: NumDupFiles = %d; want 2", got)
+	}
+
+	sums, _ = FilterDir("root", &Options{StrictMatch: StrictMatch{ModTime: true, Mode: true}, FileSystem: fs})
+	info, _ := fs.Lstat("root/a")
+	want := StrictMatch{ModTime: true, Mode: true}.key(sha1Sum([]byte("dup")), info)
+	checkSums(t, "2: ", sums, []string{dupString(want, "root/a", "root/b")})
+}
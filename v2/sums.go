@@ -0,0 +1,759 @@
+package dedup
+
+import (
+	"crypto/sha1"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+)
+
+// Sum is a type alias for [sha1.Size]byte.
+type Sum [sha1.Size]byte
+
+// Digest identifies the contents of a file. Files with equal Digests are
+// considered duplicates. By default, a Digest holds the raw bytes of the SHA1
+// checksum of a file's contents, the same as a Sum, but Options.Algorithm and
+// Matcher may use keys of any length; formatting a Digest with %x prints it in
+// hexadecimal either way.
+type Digest string
+
+// File pairs a path with the os.FileInfo for the file located at that path.
+type File struct {
+	Path string
+	Info os.FileInfo
+
+	Digests map[string]Digest // Additional digests of the file's contents by name, if Options.Digests is set.
+
+	// Links lists the paths of the symbolic links that were found to lead
+	// to the file under Options.FollowSymlinks. The file is evaluated once
+	// however many links lead to it, and Path is its own path.
+	Links []string
+
+	link string // Path of the link through which the file was evaluated, if any; see Options.LinkPaths.
+}
+
+// Owner returns the user and group IDs of the owner of the file, as recorded
+// in Info. ok will be false if Info does not carry them, as on Windows or
+// for files loaded from an index.
+func (f *File) Owner() (uid, gid int, ok bool) {
+	if f.Info == nil {
+		return
+	}
+	return owner(f.Info)
+}
+
+// Stats contains a summary of files and bytes examined by Sums.
+type Stats struct {
+	NumFiles    uint64
+	NumBytes    uint64
+	NumDupFiles uint64
+	NumDupBytes uint64
+	NumVanished uint64 // Files that vanished after being listed.
+	NumSpecial  uint64 // Named pipes, sockets, and devices skipped; see Options.IncludeSpecial.
+
+	// PermissionDenied is the number of files and directories skipped under
+	// Options.SkipUnreadable since they could not be read.
+	PermissionDenied uint64
+
+	// ReclaimableBytes is the part of NumDupBytes that disposing of
+	// duplicates would free: duplicates that are hard links to a file
+	// already counted with the same checksum take no space of their own.
+	ReclaimableBytes uint64
+
+	// BytesRead is the number of bytes of file contents actually read,
+	// including failed attempts, whereas NumBytes is the sum of the sizes of
+	// files examined.
+	BytesRead uint64
+
+	// FilesSkipped is the number of files that were not read: those whose
+	// checksums were found in the cache under Options.UseXattrCache, which
+	// are counted in NumFiles nonetheless, and the files and directories
+	// excluded under MatchRegexp, ExcludeRegexp, SkipHidden, or IgnoreFiles,
+	// which are not. A directory excluded counts once, whatever it contains.
+	FilesSkipped uint64
+
+	ErrorsCount   uint64 // Errors that occurred during evaluation.
+	OutputDropped uint64 // Paths not written to Options.UniqWriter or DupWriter under OutputDropPercent.
+
+	Timings Timings // Time taken by the evaluation, once done.
+}
+
+func (s Stats) String() string {
+	return fmt.Sprintf("%d (%d B) duplicate files / %d (%d B) total files",
+		s.NumDupFiles, s.NumDupBytes, s.NumFiles, s.NumBytes)
+}
+
+// Sums is a map of checksums to files that is safe for concurrent access from
+// multiple goroutines.
+type Sums struct {
+	mu      sync.Mutex
+	m       map[Digest][]*File
+	r       Stats
+	chunks  *ChunkIndex
+	partial bool   // Whether an evaluation into s stopped early.
+	spill   *spill // Files held on disk instead of in m, if set; see NewSpilledSums.
+
+	minGroup int  // Fewest files of the groups written by WriteAllDup; see Options.MinGroupSize.
+	long     bool // Whether reports include the owner, mode, and modification time of files; see Options.LongReport.
+	crossDir bool // Whether groups written by WriteAllDup span several directories; see Options.CrossDirOnly.
+	order    GroupOrder
+	links    LinkPaths
+
+	header      *Header // Set once evaluated into; see Header.
+	writeHeader bool    // Whether reports begin with header; see Options.ReportHeader.
+
+	// sample records the sizes of the files sampled under
+	// Options.SamplePercent, if any.
+	sample *sample
+}
+
+// NewSums initializes a Sums and returns a pointer to it.
+func NewSums() *Sums {
+	s := new(Sums)
+	s.m = make(map[Digest][]*File)
+	return s
+}
+
+// Get returns the list of files for sum. ok will be false if s does not
+// contain any files for sum, true otherwise.
+func (s *Sums) Get(sum Sum) (files []*File, ok bool) {
+	return s.GetDigest(Digest(sum[:]))
+}
+
+// GetDigest is like Get, except that it looks up a Digest of any length.
+func (s *Sums) GetDigest(sum Digest) (files []*File, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spill != nil {
+		files = s.spill.get(sum)
+		return files, len(files) > 0
+	}
+	files, ok = s.m[sum]
+	return
+}
+
+// Contains reports whether s contains any files for sum.
+func (s *Sums) Contains(sum Digest) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spill != nil {
+		return s.spill.counts[sum] > 0
+	}
+	return len(s.m[sum]) > 0
+}
+
+// Append stores file in the set of files under checksum sum. Append does not
+// attempt to verify whether sum is a valid checksum for file. Append returns
+// false if file is the first encountered for sum, true otherwise.
+func (s *Sums) Append(sum Sum, file *File) (dup bool) {
+	return s.AppendDigest(Digest(sum[:]), file)
+}
+
+// AppendDigest is like Append, except that it stores file under a Digest of
+// any length.
+func (s *Sums) AppendDigest(sum Digest, file *File) (dup bool) {
+	return s.add(sum, file) > 1
+}
+
+// add is like AppendDigest, except that it returns the number of files under sum
+// once file is added.
+func (s *Sums) add(sum Digest, file *File) (n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	numBytes := uint64(file.Info.Size())
+
+	s.r.NumFiles++
+	s.r.NumBytes += numBytes
+
+	if s.spill != nil {
+		n = s.spill.add(sum, file)
+		if n > 1 {
+			s.r.NumDupFiles++
+			s.r.NumDupBytes += numBytes
+			s.r.ReclaimableBytes += numBytes
+		}
+		return n
+	}
+	if files, ok := s.m[sum]; ok {
+		if linkedTo(files, file) == nil {
+			s.r.ReclaimableBytes += numBytes
+		}
+		s.m[sum] = append(files, file)
+		s.r.NumDupFiles++
+		s.r.NumDupBytes += numBytes
+	} else {
+		s.m[sum] = []*File{file}
+	}
+	return len(s.m[sum])
+}
+
+// Remove removes the file located at path from the set of files under
+// checksum sum and returns it, updating Stats accordingly. If it was the only
+// file under sum, sum is removed as well. Remove returns nil if s does not
+// contain such a file.
+func (s *Sums) Remove(sum Digest, path string) *File {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spill != nil {
+		removed := s.spill.remove(sum, path)
+		if len(removed) == 0 {
+			return nil
+		}
+		s.spilledRemove(sum, removed)
+		return removed[0]
+	}
+
+	files := s.m[sum]
+	for i, file := range files {
+		if file.Path != path {
+			continue
+		}
+		numBytes := uint64(file.Info.Size())
+		s.r.NumFiles--
+		s.r.NumBytes -= numBytes
+		if len(files) > 1 {
+			s.r.NumDupFiles--
+			s.r.NumDupBytes -= numBytes
+			s.r.ReclaimableBytes -= reclaimable(files)
+			s.m[sum] = append(files[:i:i], files[i+1:]...)
+			s.r.ReclaimableBytes += reclaimable(s.m[sum])
+		} else {
+			delete(s.m, sum)
+		}
+		return file
+	}
+	return nil
+}
+
+// RemoveSum removes checksum sum and all of its files from s and returns the
+// files, updating Stats accordingly. ok will be false if s does not contain
+// any files for sum, true otherwise.
+func (s *Sums) RemoveSum(sum Digest) (files []*File, ok bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spill != nil {
+		files = s.spill.remove(sum, "")
+		s.spilledRemove(sum, files)
+		return files, len(files) > 0
+	}
+
+	files, ok = s.m[sum]
+	s.r.ReclaimableBytes -= reclaimable(files)
+	for i, file := range files {
+		numBytes := uint64(file.Info.Size())
+		s.r.NumFiles--
+		s.r.NumBytes -= numBytes
+		if i > 0 {
+			s.r.NumDupFiles--
+			s.r.NumDupBytes -= numBytes
+		}
+	}
+	delete(s.m, sum)
+	return
+}
+
+// Merge appends every file in other to s, as if by AppendDigest, so that the
+// results of scans of disjoint sets of files can be combined. other is not
+// modified. Merging s into itself has no effect.
+func (s *Sums) Merge(other *Sums) {
+	if s == other {
+		return
+	}
+
+	other.mu.Lock()
+	m := make(map[Digest][]*File, len(other.m))
+	for sum, files := range other.m {
+		m[sum] = append([]*File(nil), files...)
+	}
+	if other.spill != nil {
+		other.spill.rangeBuckets(nil, false, func(sum Digest, files []*File) bool {
+			m[sum] = files
+			return true
+		})
+	}
+	r := other.r
+	partial := other.partial
+	chunks := other.chunks
+	other.mu.Unlock()
+
+	for sum, files := range m {
+		for _, file := range files {
+			s.AppendDigest(sum, file)
+		}
+	}
+
+	s.mu.Lock()
+	s.r.NumVanished += r.NumVanished
+	s.r.NumSpecial += r.NumSpecial
+	s.r.PermissionDenied += r.PermissionDenied
+	s.r.BytesRead += r.BytesRead
+	s.r.FilesSkipped += r.FilesSkipped
+	s.r.ErrorsCount += r.ErrorsCount
+	s.r.OutputDropped += r.OutputDropped
+	s.r.Timings.add(r.Timings)
+	s.partial = s.partial || partial
+	s.mu.Unlock()
+
+	if chunks != nil {
+		s.Chunks().merge(chunks)
+	}
+}
+
+// Range calls f sequentially for each sum and set of files present in s. If
+// f returns false, Range stops the iteration. If s is modified concurrently,
+// Range may reflect any mapping for a given key during the Range call.
+// Digests that are not SHA1 checksums, as under Options.Algorithm or Matcher,
+// are skipped; RangeDigests reports them too.
+func (s *Sums) Range(f func(sum Sum, files []*File) bool) {
+	s.RangeDigests(func(digest Digest, files []*File) bool {
+		var sum Sum
+		if len(digest) != len(sum) {
+			return true
+		}
+		copy(sum[:], digest)
+		return f(sum, files)
+	})
+}
+
+// RangeDigests is like Range, except that it calls f for every Digest in s,
+// whatever its length. With Go 1.23 or later, All iterates over s with
+// range-over-func instead.
+func (s *Sums) RangeDigests(f func(sum Digest, files []*File) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.spill != nil {
+		s.spill.rangeBuckets(nil, false, f)
+		return
+	}
+
+	for sum, files := range s.m {
+		if !f(sum, files) {
+			break
+		}
+	}
+}
+
+// Chunks returns the index of content-defined chunks of files in s, which is
+// populated if Options.ChunkMode is set.
+func (s *Sums) Chunks() *ChunkIndex {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.chunks == nil {
+		s.chunks = NewChunkIndex()
+	}
+	return s.chunks
+}
+
+// vanished records a file that was listed but no longer exists.
+func (s *Sums) vanished() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.NumVanished++
+}
+
+// denied records a file or directory skipped as it could not be read.
+func (s *Sums) denied() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.PermissionDenied++
+}
+
+// special records a special file that was skipped.
+func (s *Sums) special() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.NumSpecial++
+}
+
+// Partial reports whether s holds the results of an evaluation that stopped
+// before every file was evaluated: because Options.Cancel was closed, or under
+// ExitOnError or ExitOnDup. Every file in s was evaluated nonetheless, but
+// unless Options.GracefulCancel was set, the last files evaluated may not have
+// been reported to writers and sinks.
+func (s *Sums) Partial() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.partial
+}
+
+// stopped records that an evaluation into s stopped early.
+func (s *Sums) stopped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.partial = true
+}
+
+// setMinGroupSize sets the fewest files of the groups written by WriteAllDup.
+func (s *Sums) setMinGroupSize(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.minGroup = n
+}
+
+// setSample records the sample drawn under Options.SamplePercent.
+func (s *Sums) setSample(sm *sample) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sample = sm
+}
+
+// setCrossDirOnly sets whether the groups written by WriteAllDup and
+// WriteReport are limited to those spanning several directories.
+func (s *Sums) setCrossDirOnly(crossDir bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.crossDir = crossDir
+}
+
+// setGroupOrder sets the order of the groups returned by DupGroups and
+// written by WriteAllDup and WriteReport.
+func (s *Sums) setGroupOrder(order GroupOrder) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.order = order
+}
+
+// setLinkPaths sets how files that links led to are named in the reports
+// written by WriteAllDup and WriteReport.
+func (s *Sums) setLinkPaths(links LinkPaths) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.links = links
+}
+
+// linkPaths returns how files that links led to are named in reports.
+func (s *Sums) linkPaths() LinkPaths {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.links
+}
+
+// setLongReport sets whether the reports written by WriteAllDup and
+// WriteReport include the owner, mode, and modification time of files.
+func (s *Sums) setLongReport(long bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.long = long
+}
+
+// longReport reports whether the reports written from s are long; see
+// setLongReport.
+func (s *Sums) longReport() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.long
+}
+
+// addLinks records that the symbolic links located at links lead to file,
+// which is in s.
+func (s *Sums) addLinks(file *File, links ...string) {
+	if len(links) == 0 {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file.Links = append(file.Links, links...)
+}
+
+// read records n bytes read from the contents of a file.
+func (s *Sums) read(n uint64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.BytesRead += n
+}
+
+// skipped records a file that was not read.
+func (s *Sums) skipped() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.FilesSkipped++
+}
+
+// errored records n errors that occurred during evaluation.
+func (s *Sums) errored(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.ErrorsCount += uint64(n)
+}
+
+// dropped records n paths dropped instead of being written.
+func (s *Sums) dropped(n int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.r.OutputDropped += uint64(n)
+}
+
+// Stats reports the number of files, bytes, duplicate files, and duplicate
+// bytes examined, as well as the number of listed files that vanished before
+// they could be examined; see Stats for the other counts it includes.
+func (s *Sums) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.r
+}
+
+// GroupOrder is an order of groups of duplicate files; see
+// Options.GroupOrder.
+type GroupOrder int
+
+const (
+	BySum         GroupOrder = iota // By checksum.
+	ByWastedBytes                   // By WastedBytes, most first, then by checksum.
+)
+
+// ParseGroupOrder returns the GroupOrder named name: "sum" or "wasted".
+func ParseGroupOrder(name string) (GroupOrder, error) {
+	switch name {
+	case "sum":
+		return BySum, nil
+	case "wasted":
+		return ByWastedBytes, nil
+	}
+	return 0, fmt.Errorf("dedup: unknown group order: %q", name)
+}
+
+// Group is a group of duplicate files, as returned by DupGroups.
+type Group struct {
+	Sum   Digest
+	Files []*File // Sorted by path.
+
+	// WastedBytes is the number of bytes that disposing of all but one of
+	// Files would free, not counting files that are hard links to another.
+	WastedBytes uint64
+}
+
+// DupGroups returns the groups of files in s that share a checksum, sorted
+// by checksum or as set by the Options.GroupOrder of the evaluation into s.
+// Groups of fewer files than the Options.MinGroupSize of the
+// evaluation into s are omitted, as they are by WriteAllDup, as are groups
+// within a single directory under its Options.CrossDirOnly.
+func (s *Sums) DupGroups() []Group {
+	var groups []Group
+	s.rangeDupGroups(func(g Group) bool {
+		groups = append(groups, g)
+		return true
+	})
+	return groups
+}
+
+// rangeDupGroups calls f with each of the groups that DupGroups returns in
+// turn, until f returns false. If s is spilled and its groups are sorted by
+// checksum, only the files that share the first byte of the checksum of the
+// group are held in memory meanwhile.
+func (s *Sums) rangeDupGroups(f func(g Group) bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	isGroup := func(n int) bool { return n > 1 && n >= s.minGroup }
+	if s.spill != nil && s.order == BySum {
+		keep := func(sum Digest) bool { return isGroup(s.spill.counts[sum]) }
+		s.spill.rangeBuckets(keep, true, func(sum Digest, files []*File) bool {
+			if s.crossDir && !spansDirs(files) {
+				return true
+			}
+			files = sortedFiles(files)
+			return f(Group{Sum: sum, Files: files, WastedBytes: reclaimable(files)})
+		})
+		return
+	}
+	var groups []Group
+	add := func(sum Digest, files []*File) bool {
+		if !s.crossDir || spansDirs(files) {
+			files = sortedFiles(files)
+			groups = append(groups, Group{Sum: sum, Files: files, WastedBytes: reclaimable(files)})
+		}
+		return true
+	}
+	if s.spill != nil {
+		keep := func(sum Digest) bool { return isGroup(s.spill.counts[sum]) }
+		s.spill.rangeBuckets(keep, false, add)
+	} else {
+		for sum, files := range s.m {
+			if isGroup(len(files)) {
+				add(sum, files)
+			}
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		if s.order == ByWastedBytes && groups[i].WastedBytes != groups[j].WastedBytes {
+			return groups[i].WastedBytes > groups[j].WastedBytes
+		}
+		return groups[i].Sum < groups[j].Sum
+	})
+	for _, g := range groups {
+		if !f(g) {
+			return
+		}
+	}
+}
+
+// WriteAllDup writes a summary of duplicate files and their checksums to w
+// in the following format, where the indented lines list the digests computed
+// under Options.Digests, if any, sorted by name, and files that are hard links
+// to a file listed before them are annotated as such:
+//
+//	da39a3ee5e6b4b0d3255bfef95601890afd80709:
+//	  sha256: e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855
+//	- "/path/to/file1"
+//	- "/path/to/file2"
+//	- "/path/to/file3" (hard link to "/path/to/file1")
+//	...
+//
+// Under the Options.LongReport of the evaluation into s, each path is
+// followed by the mode, owner, and modification time in UTC of the file,
+// omitting the owner where unknown:
+//
+//	da39a3ee5e6b4b0d3255bfef95601890afd80709:
+//	- "/path/to/file1" -rw-r--r-- 1000:1000 2006-01-02T15:04:05Z
+//
+// Under the Options.LinkPaths of the evaluation into s, files that links led
+// to may be named by the path of the link instead, followed by
+// (symbolic link to "/path/to/file") if both are named.
+//
+// Groups are sorted by checksum or as set by the Options.GroupOrder of the
+// evaluation into s, and groups of fewer files than the Options.MinGroupSize
+// of the evaluation into s are omitted; see DupGroups.
+func (s *Sums) WriteAllDup(w io.Writer) (err error) {
+	long, links := s.longReport(), s.linkPaths()
+	s.rangeDupGroups(func(g Group) bool {
+		err = writeDupGroup(w, g, long, links)
+		return err == nil
+	})
+	return err
+}
+
+// writeDupGroup writes g to w in the format of WriteAllDup, including the
+// metadata of each file if long is true, naming files as links sets.
+func writeDupGroup(w io.Writer, g Group, long bool, links LinkPaths) error {
+	if _, err := fmt.Fprintf(w, "%x:\n", g.Sum); err != nil {
+		return err
+	}
+	digests := groupDigests(g.Files)
+	for _, name := range sortedNames(digests) {
+		if _, err := fmt.Fprintf(w, "  %s: %x\n", name, digests[name]); err != nil {
+			return err
+		}
+	}
+	for i, file := range g.Files {
+		var meta string
+		if long {
+			meta = " " + newFileMeta(file).String()
+		}
+		path, target := links.paths(file)
+		if target != "" {
+			meta += fmt.Sprintf(" (symbolic link to %q)", target)
+		}
+		var err error
+		if link := linkedTo(g.Files[:i], file); link != nil {
+			linkPath, _ := links.paths(link)
+			_, err = fmt.Fprintf(w, "- %q%s (hard link to %q)\n", path, meta, linkPath)
+		} else {
+			_, err = fmt.Fprintf(w, "- %q%s\n", path, meta)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// groupDigests returns the digests of the first file in files that has any;
+// files with the same checksum have the same digests.
+func groupDigests(files []*File) map[string]Digest {
+	for _, file := range files {
+		if len(file.Digests) > 0 {
+			return file.Digests
+		}
+	}
+	return nil
+}
+
+func sortedNames(digests map[string]Digest) []string {
+	names := make([]string, 0, len(digests))
+	for name := range digests {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// sortedFiles returns a copy of files sorted by path.
+func sortedFiles(files []*File) []*File {
+	sorted := append([]*File(nil), files...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Path < sorted[j].Path })
+	return sorted
+}
+
+// linkedTo returns the first of files that is a hard link to the same file as
+// file, or nil if there is none.
+func linkedTo(files []*File, file *File) *File {
+	for _, f := range files {
+		if sameFile(f, file) {
+			return f
+		}
+	}
+	return nil
+}
+
+// reclaimable returns the number of bytes freed by disposing of all but the
+// first of files, which share a checksum, not counting files that are hard
+// links to another before them.
+func reclaimable(files []*File) (n uint64) {
+	for i, file := range files {
+		if i > 0 && linkedTo(files[:i], file) == nil {
+			n += uint64(file.Info.Size())
+		}
+	}
+	return n
+}
+
+// sameFile reports whether a and b are hard links to the same file, as
+// os.SameFile does; for files loaded from an index, as recorded there.
+func sameFile(a, b *File) bool {
+	if a.Info == nil || b.Info == nil {
+		return false
+	}
+	ai, aok := a.Info.(*indexInfo)
+	bi, bok := b.Info.(*indexInfo)
+	if aok || bok {
+		return aok && bok && ai.id() == bi.id()
+	}
+	return os.SameFile(a.Info, b.Info)
+}
+
+func sortedPaths(files []*File) []string {
+	paths := make([]string, len(files))
+	for i, file := range files {
+		paths[i] = file.Path
+	}
+	sort.Strings(paths)
+	return paths
+}
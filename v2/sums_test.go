@@ -0,0 +1,396 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+var (
+	keys = []string{
+		"aqua", "black", "blue", "fuchsia", "gray", "green", "lime", "maroon",
+		"navy", "olive", "purple", "red", "silver", "teal", "white", "yellow",
+	}
+	sumKey = make(map[Digest]string, len(keys))
+	keySum = make(map[string]Digest, len(keys))
+)
+
+func init() {
+	for _, key := range keys {
+		sum := sha1Sum([]byte(key))
+		sumKey[sum] = key
+		keySum[key] = sum
+	}
+}
+
+func TestSumsConcurrent(t *testing.T) {
+	const P = 8
+
+	sums := NewSums()
+
+	var wg sync.WaitGroup
+	wg.Add(1 + P)
+
+	go func() { // Add 1 file for keys[0]
+		defer wg.Done()
+		key := keys[0]
+		sums.AppendDigest(keySum[key],
+			fakeFile(fmt.Sprintf("/dir0/%s", key), key))
+	}()
+
+	for i := 0; i < P; i++ { // Add P files for each of keys[1:]
+		go func(i int) {
+			defer wg.Done()
+			for _, key := range keys[1:] {
+				sums.AppendDigest(keySum[key],
+					fakeFile(fmt.Sprintf("/dir%d/%s", i+1, key), key))
+			}
+		}(i)
+	}
+
+	wg.Wait()
+
+	seen := make(map[string][]string) // keys to file paths
+	sums.RangeDigests(func(sum Digest, files []*File) bool {
+		key, ok := sumKey[sum]
+		if !ok {
+			t.Errorf("unwanted checksum: %x", sum)
+		}
+		seen[key] = make([]string, len(files))
+		for i := range files {
+			seen[key][i] = files[i].Path
+		}
+		return true
+	})
+
+	for i, key := range keys {
+		if files, ok := seen[key]; !ok {
+			t.Errorf("want Sums to have checksum %x, but it did not",
+				keySum[key])
+		} else if i == 0 && len(files) != 1 {
+			t.Errorf("want Sums to have 1 file for checksum %x; got %d files",
+				keySum[key], len(files))
+		} else if i > 0 && len(files) != P {
+			t.Errorf("want Sums to have %d files for checksum %x; got %d files",
+				P, keySum[key], len(files))
+		}
+	}
+
+	want := Stats{}
+	want.NumFiles = 1                    // 1 file added for keys[0]
+	want.NumBytes = uint64(len(keys[0])) // len(keys[0]) bytes added for keys[0]
+	for _, key := range keys[1:] {
+		want.NumFiles += P
+		want.NumBytes += P * uint64(len(key))
+		want.NumDupFiles += P - 1
+		want.NumDupBytes += (P - 1) * uint64(len(key))
+	}
+	want.ReclaimableBytes = want.NumDupBytes // No file is a hard link.
+	if got := sums.Stats(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+}
+
+func TestSumsAppend(t *testing.T) {
+	sums := NewSums()
+	sum1, sum2 := sha1.Sum([]byte(keys[0])), sha1.Sum([]byte(keys[1]))
+	emptyFile := fakeFile("", "")
+
+	if dup := sums.Append(sum1, emptyFile); dup {
+		t.Errorf("Append(%x, ...) = true; want false", sum1)
+	}
+	if dup := sums.Append(sum1, emptyFile); !dup {
+		t.Errorf("Append(%x, ...) = false; want true", sum1)
+	}
+
+	// Test concurrently:
+
+	const P = 8
+	done := make(chan bool)
+
+	var mu sync.Mutex // Protect access to added
+	var added bool
+
+	for i := 0; i < P; i++ {
+		go func() {
+			mu.Lock()
+			dup := sums.Append(sum2, emptyFile)
+			added1 := added
+			added = true
+			mu.Unlock()
+
+			if !added1 && dup {
+				t.Errorf("Append(%x, ...) = true; want false", sum2)
+			} else if added1 && !dup {
+				t.Errorf("Append(%x, ...) = false; want true", sum2)
+			}
+			done <- true
+		}()
+	}
+
+	for i := 0; i < P; i++ {
+		<-done
+	}
+	close(done)
+}
+
+func TestSumsDigests(t *testing.T) {
+	sums := NewSums()
+	sum := sha1.Sum([]byte("aqua"))
+	short := Digest("\x01\x02\x03\x04")
+	sums.Append(sum, fakeFile("/a", "aqua"))
+	sums.AppendDigest(Digest(sum[:]), fakeFile("/b", "aqua"))
+	sums.AppendDigest(short, fakeFile("/c", "lime"))
+
+	if files, ok := sums.Get(sum); !ok || len(files) != 2 {
+		t.Errorf("Get(%x) = %d files, %t; want 2, true", sum, len(files), ok)
+	}
+	if files, ok := sums.GetDigest(short); !ok || len(files) != 1 {
+		t.Errorf("GetDigest(%x) = %d files, %t; want 1, true", short, len(files), ok)
+	}
+
+	var got []Sum
+	sums.Range(func(sum Sum, files []*File) bool {
+		got = append(got, sum)
+		return true
+	})
+	if want := []Sum{sum}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Range() visited %x; want %x", got, want)
+	}
+	n := 0
+	sums.RangeDigests(func(Digest, []*File) bool {
+		n++
+		return true
+	})
+	if n != 2 {
+		t.Errorf("RangeDigests() visited %d digests; want 2", n)
+	}
+}
+
+func TestSumsWriteAllDup(t *testing.T) {
+	uniqKeys, dupKeys := keys[:8], keys[8:]
+	sums := NewSums()
+	want := make([]string, 8*3)
+
+	for _, key := range uniqKeys { // Add 1 file for each of uniqKeys
+		sums.AppendDigest(keySum[key], fakeFile(fmt.Sprintf("/%s/file1", key), ""))
+	}
+
+	paths := make([]string, 3)
+	for i, key := range dupKeys { // Add 3 files for each of dupKeys
+		for j := 0; j < 3; j++ {
+			paths[j] = fmt.Sprintf("/%s/file%d", key, j+1)
+			sums.AppendDigest(keySum[key], fakeFile(paths[j], ""))
+		}
+		want[8+i] = dupString(keySum[key], paths...)
+	}
+
+	checkSums(t, "", sums, want)
+}
+
+func TestSumsDupGroups(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/b/aqua")
+	add("aqua", "/a/aqua")
+	add("aqua", "/c/aqua")
+	add("gray", "/b/gray")
+	add("gray", "/a/gray")
+	add("lime", "/a/lime")
+
+	var got []string
+	for _, g := range sums.DupGroups() {
+		paths := make([]string, len(g.Files))
+		for i, file := range g.Files {
+			paths[i] = file.Path
+		}
+		got = append(got, fmt.Sprintf("%s %v %d", sumKey[g.Sum], paths, g.WastedBytes))
+	}
+	want := []string{"aqua [/a/aqua /b/aqua /c/aqua] 8", "gray [/a/gray /b/gray] 4"}
+	if keySum["gray"] < keySum["aqua"] {
+		want[0], want[1] = want[1], want[0]
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DupGroups() = %q; want %q", got, want)
+	}
+
+	sums.setMinGroupSize(3)
+	if groups := sums.DupGroups(); len(groups) != 1 || sumKey[groups[0].Sum] != "aqua" {
+		t.Errorf("DupGroups() with MinGroupSize 3 = %d groups; want aqua only", len(groups))
+	}
+
+	sums.setMinGroupSize(0)
+	sums.setGroupOrder(ByWastedBytes)
+	add("white", "/a/white")
+	add("white", "/b/white")
+	var order []string
+	for _, g := range sums.DupGroups() {
+		order = append(order, sumKey[g.Sum])
+	}
+	// white and gray waste 4 bytes each, and are sorted by checksum.
+	want = []string{"aqua", "gray", "white"}
+	if keySum["white"] < keySum["gray"] {
+		want[1], want[2] = want[2], want[1]
+	}
+	if !reflect.DeepEqual(order, want) {
+		t.Errorf("DupGroups() by wasted bytes = %q; want %q", order, want)
+	}
+}
+
+// info implements os.FileInfo for testing.
+type info struct {
+	name string
+	size int
+}
+
+var _ os.FileInfo = (*info)(nil)
+
+func (i *info) Name() string       { return i.name }
+func (i *info) Size() int64        { return int64(i.size) }
+func (i *info) Mode() os.FileMode  { return 0 }
+func (i *info) ModTime() time.Time { return time.Time{} }
+func (i *info) IsDir() bool        { return false }
+func (i *info) Sys() interface{}   { return nil }
+
+func fakeFile(path string, contents string) *File {
+	return &File{
+		Path: path,
+		Info: &info{
+			name: filepath.Base(path),
+			size: len(contents),
+		},
+	}
+}
+
+func TestSumsRemove(t *testing.T) {
+	sums := NewSums()
+	sum1, sum2 := keySum[keys[0]], keySum[keys[1]]
+	sums.AppendDigest(sum1, fakeFile("/a/1", keys[0]))
+	sums.AppendDigest(sum1, fakeFile("/b/1", keys[0]))
+	sums.AppendDigest(sum1, fakeFile("/c/1", keys[0]))
+	sums.AppendDigest(sum2, fakeFile("/a/2", keys[1]))
+
+	if file := sums.Remove(sum1, "/bogus"); file != nil {
+		t.Errorf("Remove(%x, /bogus) = %v; want nil", sum1, file)
+	}
+	if file := sums.Remove(sum1, "/b/1"); file == nil || file.Path != "/b/1" {
+		t.Errorf("Remove(%x, /b/1) = %v; want /b/1", sum1, file)
+	}
+	if files, _ := sums.GetDigest(sum1); len(files) != 2 || files[0].Path != "/a/1" || files[1].Path != "/c/1" {
+		t.Errorf("Get(%x) = %v; want /a/1, /c/1", sum1, files)
+	}
+	if file := sums.Remove(sum2, "/a/2"); file == nil {
+		t.Errorf("Remove(%x, /a/2) = nil; want /a/2", sum2)
+	}
+	if _, ok := sums.GetDigest(sum2); ok {
+		t.Errorf("Get(%x) ok = true after removing its only file", sum2)
+	}
+
+	n := uint64(len(keys[0]))
+	want := Stats{NumFiles: 2, NumBytes: 2 * n, NumDupFiles: 1, NumDupBytes: n, ReclaimableBytes: n}
+	if got := sums.Stats(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+
+	if files, ok := sums.RemoveSum(sum1); !ok || len(files) != 2 {
+		t.Errorf("RemoveSum(%x) = %v, %t; want 2 files, true", sum1, files, ok)
+	}
+	if got := sums.Stats(); !reflect.DeepEqual(Stats{}, got) {
+		t.Errorf("Stats() = %v; want zero Stats", got)
+	}
+	if _, ok := sums.RemoveSum(sum1); ok {
+		t.Errorf("RemoveSum(%x) ok = true; want false", sum1)
+	}
+}
+
+func TestSumsMerge(t *testing.T) {
+	a, b, whole := NewSums(), NewSums(), NewSums()
+	for i, key := range keys {
+		for j := 0; j < 3; j++ {
+			file := fakeFile(fmt.Sprintf("/dir%d/%s", j, key), key)
+			if (i+j)%2 == 0 {
+				a.AppendDigest(keySum[key], file)
+			} else {
+				b.AppendDigest(keySum[key], file)
+			}
+			whole.AppendDigest(keySum[key], file)
+		}
+	}
+
+	a.Merge(b)
+	a.Merge(a)
+	if got, want := a.Stats(), whole.Stats(); !reflect.DeepEqual(want, got) {
+		t.Errorf("Stats() = %v; want %v", got, want)
+	}
+	for _, key := range keys {
+		if files, _ := a.GetDigest(keySum[key]); len(files) != 3 {
+			t.Errorf("Get(%x) has %d files; want 3", keySum[key], len(files))
+		}
+	}
+	if got := b.Stats().NumFiles; got != uint64(len(keys)*3/2) {
+		t.Errorf("other Stats().NumFiles = %d; want %d", got, len(keys)*3/2)
+	}
+}
+
+func TestSumsHardLinks(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	for _, name := range []string{"a", "c"} {
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte("same"), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for link, target := range map[string]string{"b": "a", "d": "c", "e": "a"} {
+		if err := os.Link(filepath.Join(root, target), filepath.Join(root, link)); err != nil {
+			t.Skipf("cannot create hard links: %v", err)
+		}
+	}
+
+	sums, err := FilterDir(root, &Options{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	check := func(prefix string, sums *Sums, dupBytes, reclaimable uint64) {
+		if got := sums.Stats(); got.NumDupBytes != dupBytes || got.ReclaimableBytes != reclaimable {
+			t.Errorf("%sStats() = %+v; want NumDupBytes %d, ReclaimableBytes %d", prefix, got, dupBytes, reclaimable)
+		}
+	}
+	check("", sums, 16, 4) // Of the two distinct files, one may be disposed of.
+
+	var buf bytes.Buffer
+	if err := sums.WriteAllDup(&buf); err != nil {
+		t.Fatalf("WriteAllDup() = %v", err)
+	}
+	path := func(name string) string { return filepath.Join(root, name) }
+	want := fmt.Sprintf("%x:\n- %q\n- %q (hard link to %q)\n- %q\n- %q (hard link to %q)\n- %q (hard link to %q)\n",
+		sha1Sum([]byte("same")), path("a"), path("b"), path("a"), path("c"), path("d"), path("c"), path("e"), path("a"))
+	if buf.String() != want {
+		t.Errorf("WriteAllDup() wrote:\n%s\nwant:\n%s", buf.String(), want)
+	}
+
+	buf.Reset()
+	if err := sums.WriteIndex(&buf); err != nil {
+		t.Fatalf("WriteIndex() = %v", err)
+	}
+	loaded, err := ReadIndex(&buf)
+	if err != nil {
+		t.Fatalf("ReadIndex() = %v", err)
+	}
+	check("loaded: ", loaded, 16, 4)
+
+	sums.Remove(sha1Sum([]byte("same")), path("a"))
+	check("after removing a: ", sums, 12, 4) // b and e are still links.
+	sums.Remove(sha1Sum([]byte("same")), path("c"))
+	sums.Remove(sha1Sum([]byte("same")), path("d"))
+	check("after removing c and d: ", sums, 4, 0)
+}
@@ -0,0 +1,69 @@
+package dedup
+
+import (
+	"bufio"
+	"io"
+	"text/template"
+)
+
+// TemplateGroup is the context in which WriteTemplate executes its group
+// template for each group of duplicate files.
+type TemplateGroup struct {
+	Sum     string            // Hex-encoded checksum shared by the files.
+	Size    int64             // Size of each file.
+	Digests map[string]string // Hex-encoded File.Digests by name, if any.
+	Files   []TemplateFile    // Files in the group, sorted by path.
+}
+
+// TemplateFile is the context in which WriteTemplate executes its file
+// template for each duplicate file.
+type TemplateFile struct {
+	Sum    string // Hex-encoded checksum of the file.
+	Path   string
+	Size   int64
+	Target string // Path of the file that the symbolic link at Path leads to, under Options.LinkPaths LinkSourcesAndTargets.
+	Link   string // Path of the file listed before it in its group that it is a hard link to, if any.
+	Index  int    // Position of the file in its group, from 0.
+}
+
+// WriteTemplate writes a summary of duplicate files to w by executing group,
+// if not nil, with a TemplateGroup for each group of duplicates, and then
+// file, if not nil, with a TemplateFile for each file in the group. Each
+// execution is followed by a newline. Groups are those returned by
+// DupGroups.
+func (s *Sums) WriteTemplate(w io.Writer, group, file *template.Template) error {
+	bw := bufio.NewWriter(w)
+	var err error
+	s.rangeReportGroups(func(g reportGroup) bool {
+		tg := TemplateGroup{Sum: g.Sum, Size: g.Size, Digests: g.Digests, Files: make([]TemplateFile, len(g.Files))}
+		for i, f := range g.Files {
+			tg.Files[i] = TemplateFile{Sum: g.Sum, Path: f.Path, Target: f.Target, Size: g.Size, Link: f.Link, Index: i}
+		}
+		if group != nil {
+			if err = execLine(bw, group, &tg); err != nil {
+				return false
+			}
+		}
+		if file == nil {
+			return true
+		}
+		for i := range tg.Files {
+			if err = execLine(bw, file, &tg.Files[i]); err != nil {
+				return false
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// execLine executes tmpl with data into w, followed by a newline.
+func execLine(w *bufio.Writer, tmpl *template.Template, data interface{}) error {
+	if err := tmpl.Execute(w, data); err != nil {
+		return err
+	}
+	return w.WriteByte('\n')
+}
@@ -0,0 +1,44 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+	"text/template"
+)
+
+func TestWriteTemplate(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/b/aqua")
+	add("aqua", "/a/aqua")
+	add("gray", "/a/gray")
+	add("gray", "/b/gray")
+	add("lime", "/a/lime")
+
+	group := template.Must(template.New("").Parse("# {{.Sum}} {{len .Files}}"))
+	file := template.Must(template.New("").Parse("{{.Index}} {{.Path}} {{.Size}}"))
+	var buf bytes.Buffer
+	if err := sums.WriteTemplate(&buf, group, file); err != nil {
+		t.Fatalf("WriteTemplate() = %v", err)
+	}
+	first, second := "aqua", "gray"
+	if fmt.Sprintf("%x", keySum[second]) < fmt.Sprintf("%x", keySum[first]) {
+		first, second = second, first
+	}
+	want := fmt.Sprintf(`# %x 2
+0 /a/%s 4
+1 /b/%s 4
+# %x 2
+0 /a/%s 4
+1 /b/%s 4
+`, keySum[first], first, first, keySum[second], second, second)
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTemplate() wrote:\n%s\nwant:\n%s", got, want)
+	}
+
+	bad := template.Must(template.New("").Parse("{{.Nope}}"))
+	if err := sums.WriteTemplate(&buf, nil, bad); err == nil {
+		t.Error("WriteTemplate(missing field) = nil; want error")
+	}
+}
@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"io"
+)
+
+// textSniffLen is the number of bytes at the start of a file that are
+// searched for NUL bytes, which tell binary files apart from text, as git
+// does.
+const textSniffLen = 8000
+
+var utf8BOM = []byte{0xef, 0xbb, 0xbf}
+
+// textMatcher is the Matcher set up under Options.NormalizeText, which
+// computes the SHA1 checksum of the contents of text files with line
+// endings and trailing whitespace normalized, and of other files as they
+// are.
+type textMatcher struct {
+	stripBOM bool // Also leave out a UTF-8 byte order mark; see Options.StripBOM.
+}
+
+var _ Matcher = textMatcher{}
+
+func (m textMatcher) Sum(file *File, open func() (io.Reader, error)) (Digest, error) {
+	r, err := open()
+	if err != nil {
+		return "", err
+	}
+	br := bufio.NewReaderSize(r, textSniffLen)
+	head, err := br.Peek(textSniffLen)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	h := sha1.New()
+	if bytes.IndexByte(head, 0) >= 0 {
+		if _, err := io.Copy(h, br); err != nil {
+			return "", err
+		}
+		return Digest(h.Sum(nil)), nil
+	}
+	if m.stripBOM && bytes.HasPrefix(head, utf8BOM) {
+		_, _ = br.Discard(len(utf8BOM))
+	}
+	if err := normalizeText(h, br); err != nil {
+		return "", err
+	}
+	return Digest(h.Sum(nil)), nil
+}
+
+// normalizeText copies the text read from r to w with the spaces, tabs, and
+// carriage returns at the end of each line left out, so that CRLF line
+// endings become LF.
+func normalizeText(w io.Writer, r io.ByteReader) error {
+	bw := bufio.NewWriter(w)
+	var blank []byte // Whitespace read since the last other byte.
+	for {
+		c, err := r.ReadByte()
+		if err == io.EOF {
+			return bw.Flush()
+		}
+		if err != nil {
+			return err
+		}
+		switch c {
+		case ' ', '\t', '\r':
+			blank = append(blank, c)
+			continue
+		case '\n':
+		default:
+			_, _ = bw.Write(blank)
+		}
+		blank = blank[:0]
+		_ = bw.WriteByte(c)
+	}
+}
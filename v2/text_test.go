@@ -0,0 +1,28 @@
+package dedup
+
+import (
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterDirNormalizeText(t *testing.T) {
+	fs := filesys.Map(map[string][]byte{
+		"root/lf":     []byte("line one\nline two\n"),
+		"root/crlf":   []byte("line one\r\nline two\r\n"),
+		"root/spaces": []byte("line one \t\nline two  \n"),
+		"root/bom":    []byte("\xef\xbb\xbfline one\nline two\n"),
+		"root/inner":  []byte("line  one\nline two\n"),
+		"root/binary": []byte("line one\r\n\x00"),
+		"root/bin2":   []byte("line one\n\x00"),
+	}, nil)
+	lf := sha1Sum([]byte("line one\nline two\n"))
+
+	sums, err := FilterDir("root", &Options{NormalizeText: true, FileSystem: fs})
+	checkErrors(t, "1: ", err, nil)
+	checkSums(t, "1: ", sums, []string{dupString(lf, "root/crlf", "root/lf", "root/spaces")})
+
+	sums, err = FilterDir("root", &Options{NormalizeText: true, StripBOM: true, FileSystem: fs})
+	checkErrors(t, "2: ", err, nil)
+	checkSums(t, "2: ", sums, []string{dupString(lf, "root/bom", "root/crlf", "root/lf", "root/spaces")})
+}
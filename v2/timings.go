@@ -0,0 +1,78 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"time"
+)
+
+// Timings breaks down the time taken by an evaluation, as reported in
+// Stats.Timings once it is done, to help choose the number of workers and
+// the Options.Algorithm. Files are listed, read, and reported concurrently,
+// so Listing and Hashing sum the time spent by all the goroutines doing so,
+// and with Output may add up to more or less than Elapsed.
+type Timings struct {
+	Elapsed time.Duration // Wall time from the start of the evaluation until every file was reported.
+	Listing time.Duration // Time spent reading directories and stat'ing the files found, not counting waits for workers to take them.
+	Hashing time.Duration // Time spent opening, reading, and hashing files, retries included.
+	Output  time.Duration // Time spent writing results to the writers and sinks of Options.
+}
+
+func (t *Timings) add(other Timings) {
+	t.Elapsed += other.Elapsed
+	t.Listing += other.Listing
+	t.Hashing += other.Hashing
+	t.Output += other.Output
+}
+
+// BytesPerSec returns the average number of bytes of files read per second
+// of Timings.Elapsed, or 0 if no time elapsed.
+func (s Stats) BytesPerSec() float64 {
+	if s.Timings.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.BytesRead) / s.Timings.Elapsed.Seconds()
+}
+
+// FilesPerSec returns the average number of files evaluated per second of
+// Timings.Elapsed, or 0 if no time elapsed.
+func (s Stats) FilesPerSec() float64 {
+	if s.Timings.Elapsed <= 0 {
+		return 0
+	}
+	return float64(s.NumFiles) / s.Timings.Elapsed.Seconds()
+}
+
+// WriteTimings writes a report of the time the evaluation into s took, as
+// recorded in Stats.Timings, to w, such as
+//
+//	Elapsed  1.52s
+//	Listing  210ms (all workers)
+//	Hashing  5.8s (all workers)
+//	Output   12ms
+//	Read     612.4 MB/s, 2011.3 files/s
+//
+// where throughput is counted in megabytes of 10^6 bytes.
+func (s *Sums) WriteTimings(w io.Writer) error {
+	st := s.Stats()
+	t := st.Timings
+	_, err := fmt.Fprintf(w, "Elapsed  %v\nListing  %v (all workers)\nHashing  %v (all workers)\nOutput   %v\nRead     %.1f MB/s, %.1f files/s\n",
+		t.Elapsed.Round(time.Millisecond), t.Listing.Round(time.Millisecond),
+		t.Hashing.Round(time.Millisecond), t.Output.Round(time.Millisecond),
+		st.BytesPerSec()/1e6, st.FilesPerSec())
+	return err
+}
+
+// timed adds d to the time spent at the step of the evaluation into s that
+// field selects from its Timings.
+func (s *Sums) timed(field func(t *Timings) *time.Duration, d time.Duration) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	*field(&s.r.Timings) += d
+}
+
+func listingTime(t *Timings) *time.Duration { return &t.Listing }
+func hashingTime(t *Timings) *time.Duration { return &t.Hashing }
+func outputTime(t *Timings) *time.Duration  { return &t.Output }
+func elapsedTime(t *Timings) *time.Duration { return &t.Elapsed }
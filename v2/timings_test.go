@@ -0,0 +1,51 @@
+package dedup
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestFilterDirTimings(t *testing.T) {
+	sums, err := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	checkErrors(t, "", err, []string{
+		"open root/foo/baz/err: permission denied",
+		"open root/foo/err: permission denied",
+		"open root/qux/quuz/err: permission denied",
+		"open root/qux/err: permission denied",
+		"open root/err: permission denied",
+	})
+	if tm := sums.Stats().Timings; tm.Elapsed <= 0 || tm.Listing < 0 || tm.Hashing < 0 || tm.Output < 0 {
+		t.Errorf("Stats().Timings = %+v; want Elapsed > 0 and no negative time", tm)
+	}
+}
+
+// untimed returns st without its Timings, which differ between evaluations.
+func untimed(st Stats) Stats {
+	st.Timings = Timings{}
+	return st
+}
+
+func TestWriteTimings(t *testing.T) {
+	other := NewSums()
+	other.r = Stats{NumFiles: 100, BytesRead: 3e6, Timings: Timings{
+		Elapsed: 2 * time.Second,
+		Listing: 250 * time.Millisecond,
+		Hashing: 3 * time.Second,
+		Output:  10 * time.Millisecond,
+	}}
+	sums := NewSums()
+	sums.Merge(other)
+	if got := sums.Stats().Timings; got != other.r.Timings {
+		t.Errorf("Stats().Timings = %+v after Merge; want %+v", got, other.r.Timings)
+	}
+
+	var buf bytes.Buffer
+	if err := other.WriteTimings(&buf); err != nil {
+		t.Fatal(err)
+	}
+	want := "Elapsed  2s\nListing  250ms (all workers)\nHashing  3s (all workers)\nOutput   10ms\nRead     1.5 MB/s, 50.0 files/s\n"
+	if got := buf.String(); got != want {
+		t.Errorf("WriteTimings() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
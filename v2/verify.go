@@ -0,0 +1,227 @@
+package dedup
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Statuses of the files verified by Verify.
+const (
+	VerifyOK       = "ok"       // The file matches its checksum.
+	VerifyMismatch = "mismatch" // The file does not match its checksum.
+	VerifyMissing  = "missing"  // The file does not exist.
+	VerifyFailed   = "failed"   // The file could not be read.
+)
+
+// VerifyResult is the outcome of verifying a file listed in a manifest.
+type VerifyResult struct {
+	Path   string
+	Algo   string // Name of the digest of the checksums, as for Options.Digests.
+	Status string // VerifyOK, VerifyMismatch, VerifyMissing, or VerifyFailed.
+	Want   Digest // Checksum listed in the manifest.
+	Got    Digest // Checksum of the file, unless missing or failed.
+	Err    error  // Error reading the file, if missing or failed.
+}
+
+// manifestEntry is a file listed in a manifest, with its checksum.
+type manifestEntry struct {
+	path string
+	algo string
+	sum  Digest
+}
+
+// Verify reads a manifest listing files and their checksums from r, such as
+// the output of sha1sum, sha256sum, md5sum, or sha512sum, in their default
+// or BSD-style (--tag) formats, or an index written by Sums.WriteIndex,
+// evaluates each file listed as Filter does under opts, and returns the
+// outcome for each file, in the order listed. Checksums in sha*sum output
+// are told apart by their lengths; those of an index are SHA1 checksums, as
+// computed under the default Options. Matcher, NormalizeText, ChunkMode,
+// Canonical, FollowSymlinks, FollowWithinRoot, SkipUnreadable, and the
+// options that only concern how files are reported are ignored. Files that were not evaluated because the
+// evaluation was canceled or stopped by ExitOnError are omitted. err is only
+// non-nil if the manifest cannot be read.
+func Verify(r io.Reader, opts *Options) ([]VerifyResult, error) {
+	entries, err := readManifest(r)
+	if err != nil {
+		return nil, err
+	}
+
+	var paths, algos []string
+	seenPaths, seenAlgos := make(map[string]bool), make(map[string]bool)
+	for _, e := range entries {
+		if !seenPaths[e.path] {
+			seenPaths[e.path] = true
+			paths = append(paths, e.path)
+		}
+		if !seenAlgos[e.algo] {
+			seenAlgos[e.algo] = true
+			algos = append(algos, e.algo)
+		}
+	}
+	sort.Strings(algos)
+
+	o := *opts
+	o.Matcher = nil
+	o.NormalizeText = false
+	o.ChunkMode = false
+	o.Canonical = nil
+	o.FollowSymlinks = false
+	o.FollowWithinRoot = false
+	o.SkipUnreadable = false
+	o.ExitOnDup = false
+	o.MinGroupSize = 0
+	o.UniqWriter, o.DupWriter, o.ErrWriter, o.BrokenLinkWriter = nil, nil, nil, nil
+	o.Digests = algos
+	c := NewCollector(-1)
+	o.UniqSink, o.DupSink = c, c
+	in := make(chan listedFile, len(paths))
+	for _, path := range paths {
+		in <- listedFile{path: path}
+	}
+	close(in)
+	fopts := setup(&o)
+	_, err = run(newChanFilter(in, fopts.procs(maxProcs), fopts), fopts)
+
+	digests := make(map[string]map[string]Digest)
+	for _, r := range c.Results() {
+		digests[r.Path] = r.Digests
+	}
+	errs := make(map[string]error)
+	if errs2, ok := err.(Errors); ok {
+		for _, err := range errs2 {
+			if path := errPath(err); path != "" {
+				errs[path] = err
+			}
+		}
+	}
+
+	var results []VerifyResult
+	for _, e := range entries {
+		res := VerifyResult{Path: e.path, Algo: e.algo, Want: e.sum}
+		if err, ok := errs[e.path]; ok {
+			res.Status, res.Err = VerifyFailed, err
+			if errors.Is(err, os.ErrNotExist) {
+				res.Status = VerifyMissing
+			}
+		} else if d, ok := digests[e.path]; ok {
+			res.Got = d[e.algo]
+			res.Status = VerifyOK
+			if res.Got != res.Want {
+				res.Status = VerifyMismatch
+			}
+		} else {
+			continue
+		}
+		results = append(results, res)
+	}
+	return results, nil
+}
+
+// errPath returns the path of the file that err was reported for, if any.
+func errPath(err error) string {
+	var link *BrokenLinkError
+	if errors.As(err, &link) {
+		return link.Path
+	}
+	var unstable *UnstableError
+	if errors.As(err, &unstable) {
+		return unstable.Path
+	}
+	path, _ := pathCause(err)
+	return path
+}
+
+// digestLens maps the lengths of the checksums listed by sha*sum to the
+// names of their digests.
+var digestLens = map[int]string{16: "md5", 20: "sha1", 32: "sha256", 64: "sha512"}
+
+// bsdSumLine matches a line of the BSD-style output of sha*sum --tag.
+var bsdSumLine = regexp.MustCompile(`^(MD5|SHA1|SHA256|SHA512) \((.*)\) = ([0-9a-fA-F]+)$`)
+
+// readManifest reads the files listed in a manifest from r, as described for
+// Verify.
+func readManifest(r io.Reader) ([]manifestEntry, error) {
+	br := bufio.NewReader(r)
+	for {
+		b, err := br.Peek(1)
+		if err != nil {
+			return nil, nil // Empty.
+		}
+		if !bytes.ContainsAny(b, " \t\r\n") {
+			break
+		}
+		_, _ = br.ReadByte()
+	}
+	if b, _ := br.Peek(1); b[0] == '{' {
+		sums, err := ReadIndex(br)
+		if err != nil {
+			return nil, err
+		}
+		var entries []manifestEntry
+		for _, f := range sums.indexFiles() {
+			sum, _ := hex.DecodeString(f.Sum)
+			entries = append(entries, manifestEntry{path: f.Path, algo: "sha1", sum: Digest(sum)})
+		}
+		return entries, nil
+	}
+
+	var entries []manifestEntry
+	sc := bufio.NewScanner(br)
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if strings.TrimSpace(line) == "" {
+			continue
+		}
+		e, ok := parseSumLine(line)
+		if !ok {
+			return nil, fmt.Errorf("dedup: reading manifest: invalid line %d: %q", n, line)
+		}
+		entries = append(entries, e)
+	}
+	if err := sc.Err(); err != nil {
+		return nil, fmt.Errorf("dedup: reading manifest: %w", err)
+	}
+	return entries, nil
+}
+
+// parseSumLine parses a line of the output of sha*sum, with or without --tag.
+func parseSumLine(line string) (manifestEntry, bool) {
+	var e manifestEntry
+	var sum string
+	escaped := strings.HasPrefix(line, "\\")
+	if escaped {
+		line = line[1:]
+	}
+	if m := bsdSumLine.FindStringSubmatch(line); m != nil {
+		e.algo, e.path, sum = strings.ToLower(m[1]), m[2], m[3]
+	} else {
+		i := strings.Index(line, " ")
+		if i < 0 || i+1 >= len(line) || line[i+1] != ' ' && line[i+1] != '*' {
+			return e, false
+		}
+		sum, e.path = line[:i], line[i+2:]
+	}
+	b, err := hex.DecodeString(sum)
+	if err != nil || e.path == "" {
+		return e, false
+	}
+	algo, ok := digestLens[len(b)]
+	if !ok || e.algo != "" && algo != e.algo {
+		return e, false
+	}
+	e.algo = algo
+	if escaped {
+		e.path = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r").Replace(e.path)
+	}
+	e.sum = Digest(b)
+	return e, true
+}
@@ -0,0 +1,72 @@
+package dedup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestVerify(t *testing.T) {
+	fs := testFS{filesys.Map(map[string][]byte{
+		"root/a":      []byte("a"),
+		"root/b":      []byte("b"),
+		"root/c d":    []byte("c"),
+		"root/secret": []byte("s"),
+	}, nil), map[string]string{"root/secret": "permission denied"}}
+	sha256Sum := sha256.Sum256([]byte("c"))
+	manifest := fmt.Sprintf("%x  root/a\n%x *root/b\n\nSHA256 (root/c d) = %x\n%x  root/missing\n%x  root/secret\n",
+		sha1Sum([]byte("a")), sha1Sum([]byte("not b")), sha256Sum, sha1Sum(nil), sha1Sum([]byte("s")))
+
+	results, err := Verify(strings.NewReader(manifest), &Options{FileSystem: fs})
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	var got []string
+	for _, r := range results {
+		got = append(got, r.Path+" "+r.Algo+" "+r.Status)
+	}
+	want := []string{
+		"root/a sha1 ok",
+		"root/b sha1 mismatch",
+		"root/c d sha256 ok",
+		"root/missing sha1 missing",
+		"root/secret sha1 failed",
+	}
+	if fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("Verify() = %q; want %q", got, want)
+	}
+	if r := results[1]; r.Got != sha1Sum([]byte("b")) {
+		t.Errorf("%s: Got = %x; want %x", r.Path, r.Got, sha1Sum([]byte("b")))
+	}
+	if r := results[4]; r.Err == nil || r.Err.Error() != "open root/secret: permission denied" {
+		t.Errorf("%s: Err = %v; want permission denied", r.Path, r.Err)
+	}
+
+	if _, err := Verify(strings.NewReader("not a checksum\n"), &Options{FileSystem: fs}); err == nil {
+		t.Error("Verify(invalid) = nil; want error")
+	}
+}
+
+func TestVerifyIndex(t *testing.T) {
+	sums, _ := FilterDir("root", &Options{Recursive: true, FileSystem: FS})
+	var buf bytes.Buffer
+	if err := sums.WriteIndex(&buf); err != nil {
+		t.Fatal(err)
+	}
+	results, err := Verify(&buf, &Options{FileSystem: FS})
+	if err != nil {
+		t.Fatalf("Verify() = %v", err)
+	}
+	if uint64(len(results)) != sums.Stats().NumFiles {
+		t.Errorf("Verify() = %d results; want %d", len(results), sums.Stats().NumFiles)
+	}
+	for _, r := range results {
+		if r.Status != VerifyOK {
+			t.Errorf("%s: Status = %s; want %s", r.Path, r.Status, VerifyOK)
+		}
+	}
+}
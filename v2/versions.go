@@ -0,0 +1,117 @@
+package dedup
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"regexp"
+	"sort"
+)
+
+// versionPatterns match file names commonly given to copies of a file by
+// file managers, editors, and browsers. The first submatch of each pattern,
+// concatenated with the second if present, is the name of the original.
+var versionPatterns = []*regexp.Regexp{
+	regexp.MustCompile(`^Copy(?: \(\d+\))? of (.+)()$`),         // Copy of file.doc, Copy (2) of file.doc
+	regexp.MustCompile(`^(.+?) - Copy(?: \(\d+\))?(\.[^.]*)?$`), // file - Copy.txt, file - Copy (2).txt
+	regexp.MustCompile(`^(.+?) copy(?: \d+)?(\.[^.]*)?$`),       // file copy.txt, file copy 2.txt
+	regexp.MustCompile(`^(.+?) ?\(\d+\)(\.[^.]*)?$`),            // file (1).jpg, file(1).jpg
+	regexp.MustCompile(`^(.+)\.(?:bak|orig|old)()$`),            // file.bak
+	regexp.MustCompile(`^(.+)~()$`),                             // file~
+}
+
+// originalName returns the name of the file of which name appears to be a
+// copy, and whether name matched any of the versioned-copy patterns.
+func originalName(name string) (orig string, ok bool) {
+	orig = name
+	for changed := true; changed; {
+		changed = false
+		for _, re := range versionPatterns {
+			if m := re.FindStringSubmatch(orig); m != nil && m[1]+m[2] != "" {
+				orig = m[1] + m[2]
+				changed, ok = true, true
+			}
+		}
+	}
+	return
+}
+
+// VersionGroup is a set of files in the same directory that appear to be
+// copies of one another according to their names, such as "file.jpg",
+// "file (1).jpg", and "Copy of file.jpg".
+type VersionGroup struct {
+	Path  string   // Path of the original, whether or not it was evaluated.
+	Files []*File  // Sorted by path.
+	Sums  []Digest // Checksum of each file in Files.
+}
+
+// Identical reports whether every file in g has the same checksum.
+func (g VersionGroup) Identical() bool {
+	for _, sum := range g.Sums[1:] {
+		if sum != g.Sums[0] {
+			return false
+		}
+	}
+	return true
+}
+
+// VersionGroups returns the groups of files in s whose names indicate that
+// they are versioned copies of the same file, regardless of whether their
+// contents are identical. Only groups of at least two files are returned,
+// sorted by path of the original.
+func (s *Sums) VersionGroups() []VersionGroup {
+	type entry struct {
+		file *File
+		sum  Digest
+	}
+	m := make(map[string][]entry)
+	versioned := make(map[string]bool)
+	s.RangeDigests(func(sum Digest, files []*File) bool {
+		for _, file := range files {
+			dir, name := filepath.Split(file.Path)
+			orig, ok := originalName(name)
+			key := dir + orig
+			m[key] = append(m[key], entry{file, sum})
+			versioned[key] = versioned[key] || ok
+		}
+		return true
+	})
+
+	var groups []VersionGroup
+	for path, entries := range m {
+		if len(entries) < 2 || !versioned[path] {
+			continue
+		}
+		sort.Slice(entries, func(i, j int) bool { return entries[i].file.Path < entries[j].file.Path })
+		g := VersionGroup{Path: path}
+		for _, e := range entries {
+			g.Files = append(g.Files, e.file)
+			g.Sums = append(g.Sums, e.sum)
+		}
+		groups = append(groups, g)
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i].Path < groups[j].Path })
+	return groups
+}
+
+// WriteVersions writes a summary of the groups returned by VersionGroups to
+// w in the following format, where each file is followed by its checksum:
+//
+//	"/path/to/file.jpg":
+//	- "/path/to/Copy of file.jpg" da39a3ee5e6b4b0d3255bfef95601890afd80709
+//	- "/path/to/file (1).jpg" 5d09322ad01e91d1eed68a86ba5f9cde52163e68
+//	- "/path/to/file.jpg" da39a3ee5e6b4b0d3255bfef95601890afd80709
+//	...
+func (s *Sums) WriteVersions(w io.Writer) error {
+	for _, g := range s.VersionGroups() {
+		if _, err := fmt.Fprintf(w, "%q:\n", g.Path); err != nil {
+			return err
+		}
+		for i, file := range g.Files {
+			if _, err := fmt.Fprintf(w, "- %q %x\n", file.Path, g.Sums[i]); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
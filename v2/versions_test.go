@@ -0,0 +1,74 @@
+package dedup
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestOriginalName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+		ok   bool
+	}{
+		{"file.jpg", "file.jpg", false},
+		{"file (1).jpg", "file.jpg", true},
+		{"file(12).jpg", "file.jpg", true},
+		{"file (1)", "file", true},
+		{"Copy of file.doc", "file.doc", true},
+		{"Copy (2) of file.doc", "file.doc", true},
+		{"file - Copy.txt", "file.txt", true},
+		{"file - Copy (3).txt", "file.txt", true},
+		{"file copy.txt", "file.txt", true},
+		{"file copy 2.txt", "file.txt", true},
+		{"file.txt.bak", "file.txt", true},
+		{"file.txt.orig", "file.txt", true},
+		{"file.txt~", "file.txt", true},
+		{"Copy of file (1).jpg.bak", "file.jpg", true},
+		{".bak", ".bak", false},
+		{"(1)", "(1)", false},
+	}
+	for _, tt := range tests {
+		if got, ok := originalName(tt.name); got != tt.want || ok != tt.ok {
+			t.Errorf("originalName(%q) = %q, %t; want %q, %t", tt.name, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSumsWriteVersions(t *testing.T) {
+	sums := NewSums()
+	add := func(key, path string) { sums.AppendDigest(keySum[key], fakeFile(path, key)) }
+	add("aqua", "/a/photo.jpg")
+	add("aqua", "/a/photo (1).jpg")
+	add("blue", "/a/Copy of photo.jpg")
+	add("aqua", "/b/photo (1).jpg") // Different directory.
+	add("gray", "/a/notes.txt")
+	add("gray", "/a/other.txt")
+	add("lime", "/a/report.doc~") // Original not evaluated.
+	add("navy", "/a/report.doc.bak")
+
+	groups := sums.VersionGroups()
+	if len(groups) != 2 {
+		t.Fatalf("len(VersionGroups()) = %d; want 2", len(groups))
+	}
+	if groups[0].Identical() || groups[1].Identical() {
+		t.Errorf("Identical() = true; want false")
+	}
+
+	var buf bytes.Buffer
+	if err := sums.WriteVersions(&buf); err != nil {
+		t.Fatalf("WriteVersions() = %v", err)
+	}
+	want := fmt.Sprintf(`"/a/photo.jpg":
+- "/a/Copy of photo.jpg" %x
+- "/a/photo (1).jpg" %x
+- "/a/photo.jpg" %x
+"/a/report.doc":
+- "/a/report.doc.bak" %x
+- "/a/report.doc~" %x
+`, keySum["blue"], keySum["aqua"], keySum["aqua"], keySum["navy"], keySum["lime"])
+	if got := buf.String(); got != want {
+		t.Errorf("WriteVersions() wrote:\n%s\nwant:\n%s", got, want)
+	}
+}
@@ -0,0 +1,389 @@
+package dedup
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// Watcher evaluates the files in a directory as FilterDir does, then keeps
+// evaluating files as they are created, modified, or moved into the
+// directory, reporting each result as it is found in the same way. Files are
+// removed from its Sums as they are deleted or moved away. Watching relies on
+// file system notifications, which are only supported on Linux for
+// directories in the local file system.
+type Watcher struct {
+	root  string
+	opts  Options
+	sums  *Sums
+	paths map[string]Digest // Checksums of the files in sums by path.
+	dup   bool              // Whether a duplicate was found, for ExitOnDup.
+
+	rootDev   uint64 // Device containing root, if rootDevOK.
+	rootDevOK bool
+}
+
+// NewWatcher returns a *Watcher for the directory located at path, configured
+// by opts.
+func NewWatcher(path string, opts *Options) *Watcher {
+	return &Watcher{
+		root:  filepath.Clean(path),
+		opts:  *opts,
+		sums:  NewSums(),
+		paths: make(map[string]Digest),
+	}
+}
+
+// Sums returns the checksums of the files currently in the watched directory
+// that have been evaluated.
+func (w *Watcher) Sums() *Sums { return w.sums }
+
+// Run evaluates the files in the watched directory, then watches it until
+// Options.Cancel is closed, or until an error occurs or a duplicate is found
+// if ExitOnError or ExitOnDup is set. If err is non-nil, it will be the error
+// that stopped the Watcher; errors that do not stop it are only reported to
+// Options.ErrWriter. Run is not to be called more than once on the same
+// instance.
+func (w *Watcher) Run() error {
+	if err := w.opts.checkAlgorithms(); err != nil {
+		return err
+	}
+	if filesys.IsURL(w.root) {
+		return fmt.Errorf("dedup: cannot watch %s: not in the local file system", w.root)
+	}
+	info, err := os.Stat(w.root)
+	if err != nil {
+		return err
+	}
+	if !info.IsDir() {
+		return fmt.Errorf("dedup: cannot watch %s: not a directory", w.root)
+	}
+	w.rootDev, w.rootDevOK = device(info)
+
+	n, err := newNotifier()
+	if err != nil {
+		return err
+	}
+	defer n.Close()
+
+	batches, errc := make(chan []watchEvent), make(chan error, 1)
+	done := make(chan struct{})
+	defer close(done)
+	go func() {
+		for {
+			events, err := n.Read()
+			if err != nil {
+				errc <- err
+				return
+			}
+			select {
+			case <-done:
+				return
+			case batches <- events:
+			}
+		}
+	}()
+
+	if err := w.walk(n, w.root, 0); err != nil {
+		return err
+	}
+	if err := w.eval(w.root, 0); w.stop(err) {
+		return err
+	}
+	for {
+		select {
+		case <-w.opts.Cancel:
+			return nil
+		case err := <-errc:
+			return err
+		case events := <-batches:
+			if err := w.handle(n, events); w.stop(err) {
+				return err
+			}
+		}
+	}
+}
+
+// stop reports whether the Watcher should stop after an evaluation returned
+// err.
+func (w *Watcher) stop(err error) bool {
+	select {
+	case <-w.opts.Cancel:
+		return true
+	default:
+	}
+	return err != nil && w.opts.ExitOnError || w.dup && w.opts.ExitOnDup
+}
+
+// handle updates w.sums for events, evaluating the files they concern.
+func (w *Watcher) handle(n notifier, events []watchEvent) error {
+	// Only the last event for each path matters.
+	var paths []string
+	last := make(map[string]watchEvent)
+	for _, ev := range events {
+		if ev.op == watchOverflow {
+			return w.rescan()
+		}
+		if _, ok := last[ev.path]; !ok {
+			paths = append(paths, ev.path)
+		}
+		last[ev.path] = ev
+	}
+
+	var files []string
+	var errs Errors
+	for _, path := range paths {
+		ev := last[path]
+		w.remove(path, ev.dir)
+		depth := w.depth(filepath.Dir(path))
+		switch {
+		case ev.op == watchRemove:
+			if ev.dir {
+				n.Remove(path)
+			}
+		case ev.dir:
+			if !w.opts.descend(depth+1) || !w.sameDevice(path) {
+				continue
+			}
+			if err := w.walk(n, path, depth+1); err != nil {
+				errs = append(errs, err)
+			}
+			if err := w.eval(path, depth+1); err != nil {
+				errs = append(errs, err.(Errors)...)
+			}
+		case ev.op == watchCreate:
+			// Other files are evaluated once written, except symbolic links.
+			if info, err := os.Lstat(path); err == nil && isSymlink(info) {
+				files = append(files, path)
+			}
+		default:
+			files = append(files, path)
+			if w.opts.Archives && filesys.IsArchive(path) && w.opts.descend(depth+1) {
+				if err := w.eval(path+filesys.ArchiveSep, depth+1); err != nil {
+					errs = append(errs, err.(Errors)...)
+				}
+			}
+		}
+	}
+	if len(files) > 0 {
+		if err := w.evalFiles(files); err != nil {
+			errs = append(errs, err.(Errors)...)
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// rescan evaluates the watched directory again from scratch after events
+// were lost.
+func (w *Watcher) rescan() error {
+	err := errors.New("dedup: file system notifications were lost; evaluating " + w.root + " again")
+	if w.opts.ErrWriter != nil {
+		_, _ = fmt.Fprintln(w.opts.ErrWriter, err)
+	}
+	for path, sum := range w.paths {
+		w.sums.Remove(sum, path)
+	}
+	w.paths = make(map[string]Digest)
+	return w.eval(w.root, 0)
+}
+
+// remove removes the file located at path from w.sums, along with the files
+// below it if it is a directory or an archive.
+func (w *Watcher) remove(path string, dir bool) {
+	if sum, ok := w.paths[path]; ok {
+		w.sums.Remove(sum, path)
+		delete(w.paths, path)
+	}
+	if !dir && !(w.opts.Archives && filesys.IsArchive(path)) {
+		return
+	}
+	for p, sum := range w.paths {
+		if strings.HasPrefix(p, path+string(filepath.Separator)) || strings.HasPrefix(p, path+filesys.ArchiveSep) {
+			w.sums.Remove(sum, p)
+			delete(w.paths, p)
+		}
+	}
+}
+
+// walk watches the directory located at dir, found at depth, and the
+// sub-directories below it that are to be read, each once however many links
+// followed lead to it.
+func (w *Watcher) walk(n notifier, dir string, depth int) error {
+	return w.walkDir(n, dir, depth, make(map[visitKey]bool))
+}
+
+// walkDir is walk, skipping the directories in seen, to which it adds those
+// it watches.
+func (w *Watcher) walkDir(n notifier, dir string, depth int, seen map[visitKey]bool) error {
+	if info, err := os.Stat(dir); err == nil {
+		key := newVisitKey(dir, info)
+		if seen[key] {
+			return nil
+		}
+		seen[key] = true
+	}
+	if err := n.Add(dir); errors.Is(err, os.ErrNotExist) {
+		return nil // Removed already: its removal will be handled.
+	} else if err != nil {
+		return newError("watch", dir, err)
+	}
+	names, err := filesys.OS().Readdirnames(dir)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return newError("readdirnames", dir, err)
+	}
+	for _, name := range names {
+		path := filepath.Join(dir, name)
+		info, err := os.Lstat(path)
+		if err == nil && isSymlink(info) && w.follows(path) {
+			info, err = os.Stat(path)
+		}
+		if err != nil || !info.IsDir() || !w.opts.descend(depth+1) || !w.sameDevice(path) {
+			continue
+		}
+		if err := w.walkDir(n, path, depth+1, seen); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// follows reports whether the symbolic link located at path is followed
+// under the FollowSymlinks and FollowWithinRoot options.
+func (w *Watcher) follows(path string) bool {
+	if w.opts.FollowSymlinks || !w.opts.FollowWithinRoot {
+		return w.opts.FollowSymlinks
+	}
+	target, err := os.Readlink(path)
+	if err != nil {
+		return false
+	}
+	return withinRoots(resolveLink(path, target), []string{w.root})
+}
+
+// sameDevice reports whether the directory located at path may be read under
+// the OneFileSystem option.
+func (w *Watcher) sameDevice(path string) bool {
+	if !w.opts.OneFileSystem || !w.rootDevOK {
+		return true
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	dev, ok := device(info)
+	return !ok || dev == w.rootDev
+}
+
+// depth returns the depth of the directory located at dir below w.root.
+func (w *Watcher) depth(dir string) int {
+	rel, err := filepath.Rel(w.root, dir)
+	if err != nil || rel == "." {
+		return 0
+	}
+	return strings.Count(rel, string(filepath.Separator)) + 1
+}
+
+// eval evaluates the files in the directory located at path, found at depth,
+// into w.sums.
+func (w *Watcher) eval(path string, depth int) error {
+	opts := w.setup()
+	d := newDirFilter([]string{path}, opts)
+	d.r.depth = depth
+	d.f.sums = w.sums
+	d.r.sums = w.sums
+	_, err := run(d, opts)
+	return err
+}
+
+// evalFiles evaluates the files located at paths into w.sums.
+func (w *Watcher) evalFiles(paths []string) error {
+	in := make(chan listedFile, len(paths))
+	for _, path := range paths {
+		in <- listedFile{path: path}
+	}
+	close(in)
+	opts := w.setup()
+	f := newChanFilter(in, opts.procs(maxProcs), opts)
+	f.listed = true
+	f.sums = w.sums
+	_, err := run(f, opts)
+	return err
+}
+
+// setup returns the options for an evaluation, which record its results in
+// w.paths. The file system is set up anew, since archives may have changed
+// since the previous evaluation. Files are evaluated once written, so none
+// are skipped under SkipModifiedWithin, MaxFiles, or MaxTotalBytes, nor left
+// unevaluated at Deadline: they would not be evaluated again.
+func (w *Watcher) setup() *Options {
+	o := w.opts
+	o.FileSystem = nil // Only the local file system is watched.
+	opts := setup(&o)
+	opts.SkipModifiedWithin = 0
+	opts.budget = nil
+	opts.Deadline = time.Time{}
+	opts.linkRoots = []string{w.root}
+	opts.UniqSink = recordSink{w, w.opts.UniqSink}
+	opts.DupSink = recordSink{w, w.opts.DupSink}
+	return opts
+}
+
+// recordSink is a Sink that records results in a Watcher before passing them
+// on to another Sink, if not nil.
+type recordSink struct {
+	w    *Watcher
+	next Sink
+}
+
+func (s recordSink) Write(r Result) error {
+	s.w.paths[r.Path] = r.Sum
+	if r.Dup {
+		s.w.dup = true
+	}
+	if s.next != nil {
+		return s.next.Write(r)
+	}
+	return nil
+}
+
+func (s recordSink) Flush() error {
+	if s.next != nil {
+		return s.next.Flush()
+	}
+	return nil
+}
+
+// watchOp is the kind of change reported by a watchEvent.
+type watchOp int
+
+const (
+	watchCreate   watchOp = iota // A file was created.
+	watchWrite                   // A file was written, or moved into a watched directory.
+	watchRemove                  // A file was deleted, or moved out of a watched directory.
+	watchOverflow                // Events were lost.
+)
+
+// watchEvent is a change to a file in a watched directory.
+type watchEvent struct {
+	op   watchOp
+	path string
+	dir  bool // Whether the file is a directory.
+}
+
+// notifier reports changes to the files in watched directories.
+type notifier interface {
+	Add(dir string) error        // Watch the directory located at dir.
+	Remove(dir string)           // Stop watching dir and the directories below it.
+	Read() ([]watchEvent, error) // Wait for changes.
+	Close() error                // Stop watching; Read then returns an error.
+}
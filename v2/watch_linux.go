@@ -0,0 +1,116 @@
+package dedup
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+	"unsafe"
+)
+
+// inotifyMask selects the events reported for watched directories.
+const inotifyMask = syscall.IN_CLOSE_WRITE | syscall.IN_CREATE | syscall.IN_DELETE |
+	syscall.IN_MOVED_FROM | syscall.IN_MOVED_TO | syscall.IN_ONLYDIR
+
+// inotify is a notifier backed by an inotify instance.
+type inotify struct {
+	fd  int
+	f   *os.File // Non-blocking view of fd, so that Close interrupts Read.
+	buf []byte
+
+	mu   sync.Mutex
+	dirs map[int32]string // Watch descriptors to directory paths.
+	wds  map[string]int32 // Directory paths to watch descriptors.
+}
+
+func newNotifier() (notifier, error) {
+	fd, err := syscall.InotifyInit1(syscall.IN_CLOEXEC | syscall.IN_NONBLOCK)
+	if err != nil {
+		return nil, os.NewSyscallError("inotify_init1", err)
+	}
+	return &inotify{
+		fd:   fd,
+		f:    os.NewFile(uintptr(fd), "inotify"),
+		buf:  make([]byte, 64<<10),
+		dirs: make(map[int32]string),
+		wds:  make(map[string]int32),
+	}, nil
+}
+
+func (n *inotify) Add(dir string) error {
+	wd, err := syscall.InotifyAddWatch(n.fd, dir, inotifyMask)
+	if err != nil {
+		return err
+	}
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.dirs[int32(wd)] = dir
+	n.wds[dir] = int32(wd)
+	return nil
+}
+
+func (n *inotify) Remove(dir string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	for path, wd := range n.wds {
+		if path == dir || strings.HasPrefix(path, dir+string(filepath.Separator)) {
+			_, _ = syscall.InotifyRmWatch(n.fd, uint32(wd))
+			delete(n.wds, path)
+			delete(n.dirs, wd)
+		}
+	}
+}
+
+func (n *inotify) Read() ([]watchEvent, error) {
+	m, err := n.f.Read(n.buf)
+	if err != nil {
+		return nil, err
+	}
+
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	var events []watchEvent
+	for off := 0; off+syscall.SizeofInotifyEvent <= m; {
+		raw := (*syscall.InotifyEvent)(unsafe.Pointer(&n.buf[off]))
+		name := n.buf[off+syscall.SizeofInotifyEvent : off+syscall.SizeofInotifyEvent+int(raw.Len)]
+		off += syscall.SizeofInotifyEvent + int(raw.Len)
+
+		if raw.Mask&syscall.IN_Q_OVERFLOW != 0 {
+			events = append(events, watchEvent{op: watchOverflow})
+			continue
+		}
+		dir, ok := n.dirs[raw.Wd]
+		if !ok {
+			continue // Removed.
+		}
+		if raw.Mask&syscall.IN_IGNORED != 0 {
+			delete(n.dirs, raw.Wd)
+			if n.wds[dir] == raw.Wd {
+				delete(n.wds, dir)
+			}
+			continue
+		}
+		ev := watchEvent{
+			path: filepath.Join(dir, strings.TrimRight(string(name), "\x00")),
+			dir:  raw.Mask&syscall.IN_ISDIR != 0,
+		}
+		switch {
+		case raw.Mask&syscall.IN_CREATE != 0:
+			ev.op = watchCreate
+		case raw.Mask&(syscall.IN_CLOSE_WRITE|syscall.IN_MOVED_TO) != 0:
+			ev.op = watchWrite
+		case raw.Mask&(syscall.IN_DELETE|syscall.IN_MOVED_FROM) != 0:
+			ev.op = watchRemove
+		default:
+			continue
+		}
+		events = append(events, ev)
+	}
+	return events, nil
+}
+
+func (n *inotify) Close() error { return n.f.Close() }
@@ -0,0 +1,135 @@
+package dedup
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// chanSink is a Sink that sends results on a channel.
+type chanSink chan Result
+
+func (s chanSink) Write(r Result) error {
+	s <- r
+	return nil
+}
+
+func (s chanSink) Flush() error { return nil }
+
+func TestWatcher(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	write := func(name, contents string) {
+		t.Helper()
+		if err := ioutil.WriteFile(filepath.Join(root, name), []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("file1", "contents")
+
+	cancel := make(chan struct{})
+	results := make(chanSink, 16)
+	w := NewWatcher(root, &Options{Recursive: true, Cancel: cancel, UniqSink: results, DupSink: results})
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run() }()
+	defer func() {
+		close(cancel)
+		if err := <-errc; err != nil {
+			t.Errorf("Run() = %v", err)
+		}
+	}()
+
+	next := func() Result {
+		t.Helper()
+		select {
+		case r := <-results:
+			return r
+		case err := <-errc:
+			t.Fatalf("Run() = %v", err)
+		case <-time.After(5 * time.Second):
+			t.Fatal("timed out waiting for a result")
+		}
+		return Result{}
+	}
+	if r := next(); r.Path != filepath.Join(root, "file1") || r.Dup {
+		t.Fatalf("initial result = %s (dup %v); want file1", r.Path, r.Dup)
+	}
+
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(50 * time.Millisecond) // Let the directory be watched.
+	write("sub/file2", "contents")
+	if r := next(); r.Path != filepath.Join(root, "sub/file2") || !r.Dup {
+		t.Fatalf("result = %s (dup %v); want duplicate sub/file2", r.Path, r.Dup)
+	}
+
+	write("sub/file2", "other contents")
+	if r := next(); r.Path != filepath.Join(root, "sub/file2") || r.Dup {
+		t.Fatalf("result = %s (dup %v); want modified sub/file2", r.Path, r.Dup)
+	}
+	if st := w.Sums().Stats(); st.NumFiles != 2 || st.NumDupFiles != 0 {
+		t.Errorf("Stats() = %+v; want 2 files, no duplicates", st)
+	}
+
+	if err := os.Rename(filepath.Join(root, "sub"), filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	if r := next(); r.Path != filepath.Join(root, "moved/file2") || r.Dup {
+		t.Fatalf("result = %s (dup %v); want moved/file2", r.Path, r.Dup)
+	}
+	if err := os.RemoveAll(filepath.Join(root, "moved")); err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for w.Sums().Stats().NumFiles != 1 && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if st := w.Sums().Stats(); st.NumFiles != 1 {
+		t.Errorf("Stats() = %+v; want 1 file after removal", st)
+	}
+}
+
+func TestWatcherLinkLoop(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	if err := os.Mkdir(filepath.Join(root, "sub"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink("..", filepath.Join(root, "sub/up")); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "file1"), []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cancel := make(chan struct{})
+	results := make(chanSink, 16)
+	w := NewWatcher(root, &Options{Recursive: true, FollowSymlinks: true, Cancel: cancel, UniqSink: results, DupSink: results})
+	errc := make(chan error, 1)
+	go func() { errc <- w.Run() }()
+	select {
+	case r := <-results:
+		if r.Path != filepath.Join(root, "file1") {
+			t.Errorf("got %s; want file1", r.Path)
+		}
+	case err := <-errc:
+		t.Fatalf("Run() = %v", err)
+	case <-time.After(10 * time.Second):
+		t.Fatal("watching a link to an ancestor did not start")
+	}
+	close(cancel)
+	if err := <-errc; err != nil && !errors.Is(err, ErrCanceled) {
+		t.Errorf("Run() = %v", err)
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package dedup
+
+import "errors"
+
+// newNotifier reports that file system notifications are not supported.
+func newNotifier() (notifier, error) {
+	return nil, errors.New("dedup: watching is not supported on this platform")
+}
@@ -0,0 +1,47 @@
+package dedup
+
+import (
+	"encoding/hex"
+	"fmt"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+// xattrName is the extended attribute in which the SHA1 checksum of a file is
+// cached under the UseXattrCache option, along with the size and modification
+// time of the file when it was computed.
+const xattrName = "user.dedup.sha1"
+
+// xattrValue returns the value of xattrName for file with checksum sum.
+func xattrValue(file *File, sum Digest) string {
+	return fmt.Sprintf("%d %d %x", file.Info.ModTime().UnixNano(), file.Info.Size(), sum)
+}
+
+// cachedSum returns the checksum cached for file, if any. ok is false unless
+// the file has not been modified since the checksum was cached.
+func (f *chanFilter) cachedSum(file *File) (sum Digest, ok bool) {
+	value, err := filesys.GetXattr(f.opts.FileSystem, file.Path, xattrName)
+	if err != nil {
+		return "", false
+	}
+	var mtime, size int64
+	var s string
+	if _, err := fmt.Sscanf(string(value), "%d %d %s", &mtime, &size, &s); err != nil {
+		return "", false
+	}
+	if mtime != file.Info.ModTime().UnixNano() || size != file.Info.Size() {
+		return "", false
+	}
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return "", false
+	}
+	return Digest(b), true
+}
+
+// cacheSum caches sum as the checksum of file. Failures, such as for files
+// that may not be written, are ignored: the checksum is computed again next
+// time.
+func (f *chanFilter) cacheSum(file *File, sum Digest) {
+	_ = filesys.SetXattr(f.opts.FileSystem, file.Path, xattrName, []byte(xattrValue(file, sum)))
+}
@@ -0,0 +1,68 @@
+package dedup
+
+import (
+	"crypto/sha1"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bdragon/dedup/v2/filesys"
+)
+
+func TestFilterXattrCache(t *testing.T) {
+	root, err := ioutil.TempDir("", "dedup")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	pth := filepath.Join(root, "file")
+	if err := ioutil.WriteFile(pth, []byte("contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := filesys.SetXattr(filesys.OS(), pth, "user.dedup.test", []byte("x")); err != nil {
+		t.Skip(err)
+	}
+
+	sumOf := func() Digest {
+		t.Helper()
+		sums, err := FilterDir(root, &Options{UseXattrCache: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		var sum Digest
+		sums.RangeDigests(func(s Digest, _ []*File) bool { sum = s; return false })
+		return sum
+	}
+
+	want := sha1.Sum([]byte("contents"))
+	if sum := sumOf(); sum != Digest(want[:]) {
+		t.Fatalf("sum = %x; want %x", sum, want)
+	}
+	info, err := os.Lstat(pth)
+	if err != nil {
+		t.Fatal(err)
+	}
+	value, err := filesys.GetXattr(filesys.OS(), pth, xattrName)
+	if want := xattrValue(&File{Path: pth, Info: info}, Digest(want[:])); err != nil || string(value) != want {
+		t.Fatalf("cached %q, %v; want %q", value, err, want)
+	}
+
+	// A cached checksum is trusted while the file is unmodified...
+	bogus := Digest("bogus")
+	if err := filesys.SetXattr(filesys.OS(), pth, xattrName, []byte(xattrValue(&File{Path: pth, Info: info}, bogus))); err != nil {
+		t.Fatal(err)
+	}
+	if sum := sumOf(); sum != bogus {
+		t.Errorf("sum = %x; want cached %x", sum, bogus)
+	}
+
+	// ...and computed again once it changes.
+	if err := ioutil.WriteFile(pth, []byte("changed contents"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	want = sha1.Sum([]byte("changed contents"))
+	if sum := sumOf(); sum != Digest(want[:]) {
+		t.Errorf("sum = %x; want %x", sum, want)
+	}
+}